@@ -2,9 +2,13 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 
 	"github.com/iltommi1995/blockchain-go/pkg/blockchain_server"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/node"
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
 )
 
 func init() {
@@ -17,10 +21,83 @@ func main() {
 	// Flag serve a parsare i comandi da command line
 	// https://pkg.go.dev/flag
 	port := flag.Uint("port", 5000, "TCP Port Number for Blockchain Service")
+	bind := flag.String("bind", blockchain_server.DEFAULT_BIND_ADDRESS, "Address the HTTP server listens on")
+	mining := flag.Bool("mine", true, "Mine a new block periodically")
+	// Parametri del nodo p2p
+	p2pPort := flag.Uint("p2p-port", 0, "TCP Port Number for the peer-to-peer protocol (default port+1000)")
+	host := flag.String("host", node.DEFAULT_HOST, "Host the p2p node listens on and announces to other peers")
+	chainID := flag.String("chain-id", node.DEFAULT_CHAIN_ID, "Network identifier, each network has its own genesis and peers on other networks are rejected")
+	seeds := flag.String("seeds", "", "Comma separated list of seed peers (host:p2p-port)")
+	peersFile := flag.String("peers-file", "", "Address book file (default peers_<port>.json)")
+	maxOut := flag.Int("max-outbound", node.DEFAULT_MAX_OUTBOUND_PEERS, "Target number of outbound peers")
+	maxIn := flag.Int("max-inbound", node.DEFAULT_MAX_INBOUND_PEERS, "Maximum number of inbound peers")
+	lan := flag.Bool("lan", true, "Discover peers by scanning local ports")
+	nodeKeyFile := flag.String("node-key", "", "Node key file used to authenticate the node to its peers (default node_key_<port>.json)")
+	chainFile := flag.String("chain-file", "", "File where the chain and the pending transactions are saved on exit (default chain_<port>.json)")
+	webhooksFile := flag.String("webhooks-file", "", "File where webhooks and pending deliveries are saved (default webhooks_<port>.json)")
+	apiKeys := flag.String("api-keys", "", "Comma separated list of API keys for admin endpoints")
+	allowedOrigins := flag.String("allowed-origins", "", "Comma separated list of other origins whose pages may open websockets (e.g. https://example.com)")
+	// Keystore con la chiave del miner
+	keystoreDir := flag.String("keystore", "", "Keystore directory with the miner key (default keystore_<port>)")
+	minerAddress := flag.String("miner-address", "", "Address of the miner key in the keystore, needed when it holds more than one key")
+	passwordFile := flag.String("password-file", "", "File with the keystore password (default $"+keystore.PASSWORD_ENV+")")
 	flag.Parse()
 
+	nodeConfig := node.Config{
+		Host:            *host,
+		Port:            uint16(*p2pPort),
+		ChainID:         *chainID,
+		AddressBookPath: *peersFile,
+		MaxOutbound:     *maxOut,
+		MaxInbound:      *maxIn,
+		LanDiscovery:    *lan,
+		NodeKeyPath:     *nodeKeyFile,
+	}
+	if nodeConfig.Port == 0 {
+		nodeConfig.Port = uint16(*port + 1000)
+	}
+	if nodeConfig.AddressBookPath == "" {
+		nodeConfig.AddressBookPath = fmt.Sprintf("peers_%d.json", *port)
+	}
+	if nodeConfig.NodeKeyPath == "" {
+		nodeConfig.NodeKeyPath = fmt.Sprintf("node_key_%d.json", *port)
+	}
+	nodeConfig.Seeds = utils.SplitList(*seeds)
+	if *chainFile == "" {
+		*chainFile = fmt.Sprintf("chain_%d.json", *port)
+	}
+	if *webhooksFile == "" {
+		*webhooksFile = fmt.Sprintf("webhooks_%d.json", *port)
+	}
+	if *keystoreDir == "" {
+		*keystoreDir = fmt.Sprintf("keystore_%d", *port)
+	}
+
+	// Carico la chiave del miner, se il keystore è vuoto ne creo una
+	password, err := keystore.ReadPassword(*passwordFile)
+	if err != nil {
+		log.Fatalf("ERROR: keystore password: %v", err)
+	}
+	miner, created, err := keystore.NewKeystore(*keystoreDir).LoadOrCreate(*minerAddress, password)
+	if err != nil {
+		log.Fatalf("ERROR: loading miner key from %s: %v", *keystoreDir, err)
+	}
+	if created {
+		log.Printf("Created miner key %s in %s", miner.BlockchainAddress(), *keystoreDir)
+	}
+
 	// Creo il blockchain server
-	app := blockchain_server.NewBlockchainServer(uint16(*port))
-	// Starto il server
+	app := blockchain_server.NewBlockchainServer(blockchain_server.Options{
+		BindAddress:    *bind,
+		Port:           uint16(*port),
+		Node:           nodeConfig,
+		ApiKeys:        utils.SplitList(*apiKeys),
+		AllowedOrigins: utils.SplitList(*allowedOrigins),
+		Mining:         *mining,
+		ChainPath:      *chainFile,
+		WebhooksPath:   *webhooksFile,
+		Miner:          miner,
+	})
+	// Starto il server, si ferma con SIGINT o SIGTERM
 	app.Run()
 }
@@ -50,12 +50,13 @@ func main() {
 	walletB := wallet.NewWallet()
 	walletC := wallet.NewWallet()
 
-	blockchain := blockchain.NewBlockchain(walletM.BlockchainAddress(), 20)
+	blockchain := blockchain.NewBlockchain(walletM.BlockchainAddress(), 20, blockchain.DEFAULT_CHAIN_ID)
 
 	// Primo blocco
 
 	// Wallet transaction
 	t := transaction.NewTransaction(walletA.PrivateKey(), walletA.PublicKey(), walletA.BlockchainAddress(), walletB.BlockchainAddress(), 1.0)
+	t.SetChainID(blockchain.ChainID())
 
 	//  Blockchain node side
 
@@ -70,6 +71,7 @@ func main() {
 	// Secondo blocco
 
 	t2 := transaction.NewTransaction(walletC.PrivateKey(), walletC.PublicKey(), walletC.BlockchainAddress(), walletA.BlockchainAddress(), 2.0)
+	t2.SetChainID(blockchain.ChainID())
 
 	isAdded = blockchain.AddTransaction(walletC.BlockchainAddress(),
 		walletA.BlockchainAddress(), 2.0,
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract_request"
+	"github.com/iltommi1995/blockchain-go/pkg/client"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/unsigned_transaction"
+)
+
+func init() {
+	log.SetPrefix("Contract: ")
+	log.SetFlags(0)
+}
+
+// Main per scrivere, pubblicare e chiamare i contratti:
+//
+//	contract compile <source file | ->
+//	contract disasm <hex code>
+//	contract address <sender> <source file | ->
+//	contract [-dir <dir>] [-password-file <file>] [-gateway <urls>] [-gas <gas>] deploy <sender> <source file | ->
+//	contract [-dir <dir>] [-password-file <file>] [-gateway <urls>] [-gas <gas>] call <sender> <contract> [arg...]
+//	contract [-gateway <urls>] [-gas <gas>] [-caller <address>] query <contract> [arg...]
+//	contract [-gateway <urls>] storage <contract>
+//
+// I sorgenti sono nella forma testuale di contract.Assemble, gli
+// argomenti sono numeri decimali, "0x" seguito da esadecimale o
+// stringhe tra virgolette
+// "compile" stampa il codice in esadecimale e "disasm" lo riporta in
+// forma testuale, "address" stampa l'address a cui il sender
+// pubblicherebbe il codice
+// "deploy" e "call" firmano la transazione con la chiave del sender
+// nel keystore e la inviano al nodo, il contratto cambia quando la
+// transazione entra in un blocco; "query" esegue una chiamata
+// sull'ultimo blocco senza cambiarlo e "storage" stampa le chiavi e i
+// valori del contratto
+func main() {
+	dir := flag.String("dir", "keystore_5000", "Keystore directory")
+	passwordFile := flag.String("password-file", "", "File with the password (default $"+keystore.PASSWORD_ENV+")")
+	gateway := flag.String("gateway", "http://localhost:5000", "Blockchain servers, separated by commas")
+	gas := flag.Uint64("gas", contract.MAX_GAS, "Gas limit of the transaction or of the query")
+	caller := flag.String("caller", "", "Address pushed by CALLER in a query")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] compile <file> | disasm <hex> | address <sender> <file> | deploy <sender> <file> | call <sender> <contract> [arg...] | query <contract> [arg...] | storage <contract>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	node := client.NewNodeClient(strings.Split(*gateway, ","), client.Options{})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch command, args := flag.Arg(0), flag.Args()[1:]; {
+	case command == "compile" && len(args) == 1:
+		code := compile(args[0])
+		log.Printf("%d bytes, deploy gas %d", len(code), uint64(len(code))*contract.GAS_CODE_BYTE)
+		fmt.Println(hex.EncodeToString(code))
+	case command == "disasm" && len(args) == 1:
+		code, err := hex.DecodeString(args[0])
+		if err != nil {
+			log.Fatalf("ERROR: invalid code: %v", err)
+		}
+		asm, err := contract.Disassemble(code)
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		fmt.Print(asm)
+	case command == "address" && len(args) == 2:
+		fmt.Println(contract.Address(args[0], compile(args[1])))
+	case command == "deploy" && len(args) == 2:
+		code := compile(args[1])
+		address := contract.Address(args[0], code)
+		m := &contract.Message{Code: hex.EncodeToString(code), GasLimit: *gas}
+		send(ctx, node, *dir, *passwordFile, args[0], address, m)
+		fmt.Println(address)
+	case command == "call" && len(args) >= 2:
+		m := &contract.Message{Args: parseArgs(args[2:]), GasLimit: *gas}
+		send(ctx, node, *dir, *passwordFile, args[0], args[1], m)
+		fmt.Println("Transaction sent")
+	case command == "query" && len(args) >= 1:
+		cr := &contract_request.CallRequest{BlockchainAddress: &args[0], Args: parseArgs(args[1:]), GasLimit: gas}
+		if *caller != "" {
+			cr.Caller = caller
+		}
+		r, err := node.CallContract(ctx, cr)
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		fmt.Printf("return   %s\n", printable(r.Return))
+		fmt.Printf("gas_used %d\n", r.GasUsed)
+	case command == "storage" && len(args) == 1:
+		ci, err := node.Contract(ctx, args[0])
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		keys := make([]string, 0, len(ci.Storage))
+		for k := range ci.Storage {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("%s  %s\n", printable(k), printable(ci.Storage[k]))
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// Funzione che legge e converte un sorgente, dal file o dallo
+// standard input con "-", termina se c'è un errore
+func compile(path string) []byte {
+	var src []byte
+	var err error
+	if path == "-" {
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		src, err = os.ReadFile(path)
+	}
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	code, err := contract.Assemble(string(src))
+	if err != nil {
+		log.Fatalf("ERROR: %s: %v", path, err)
+	}
+	return code
+}
+
+// Funzione che converte gli argomenti in esadecimale, termina se uno
+// non è valido
+func parseArgs(args []string) []string {
+	hexArgs := make([]string, 0, len(args))
+	for _, a := range args {
+		v, err := contract.ParseArg(a)
+		if err != nil {
+			log.Fatalf("ERROR: argument %s: %v", a, err)
+		}
+		hexArgs = append(hexArgs, hex.EncodeToString(v))
+	}
+	return hexArgs
+}
+
+// Funzione che firma con la chiave del sender la transazione del
+// contratto e la invia al nodo, termina se c'è un errore
+func send(ctx context.Context, node *client.NodeClient, dir string, passwordFile string, sender string, recipient string, m *contract.Message) {
+	if err := m.Validate(); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	p, err := keystore.ReadPassword(passwordFile)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	w, err := keystore.NewKeystore(dir).Load(sender, p)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	// La firma vale solo sulla rete del nodo
+	network, err := node.Network(ctx)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	tr, err := unsigned_transaction.NewContractTransaction(network.ChainID, sender, recipient, m).Sign(w)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	if err := node.SendTransaction(ctx, tr); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+}
+
+// Funzione che mostra un valore in esadecimale seguito, se è al più di
+// 8 byte, dal numero e, se è stampabile, dal testo
+func printable(h string) string {
+	v, err := hex.DecodeString(h)
+	if err != nil {
+		return h
+	}
+	var hints []string
+	if n, err := contract.DecodeNum(v); err == nil {
+		hints = append(hints, strconv.FormatUint(n, 10))
+	}
+	if len(v) > 0 && isText(v) {
+		hints = append(hints, strconv.Quote(string(v)))
+	}
+	if len(hints) == 0 {
+		return "0x" + h
+	}
+	return fmt.Sprintf("0x%s (%s)", h, strings.Join(hints, " "))
+}
+
+func isText(v []byte) bool {
+	for _, c := range v {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
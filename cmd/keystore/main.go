@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/locktime"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/script"
+	"github.com/iltommi1995/blockchain-go/pkg/client"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/hd_wallet"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/partial_transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/unsigned_transaction"
+)
+
+func init() {
+	log.SetPrefix("Keystore: ")
+	log.SetFlags(0)
+}
+
+// Variabile d'ambiente con la nuova password per "passwd"
+const NEW_PASSWORD_ENV = "KEYSTORE_NEW_PASSWORD"
+
+// Variabile d'ambiente con la passphrase opzionale della frase per
+// "mnemonic" e "restore"
+const PASSPHRASE_ENV = "MNEMONIC_PASSPHRASE"
+
+// Main per gestire le chiavi di un keystore:
+//
+//	keystore [-dir <dir>] list
+//	keystore [-dir <dir>] [-password-file <file>] new
+//	keystore [-dir <dir>] [-password-file <file>] import <private key hex>
+//	keystore [-dir <dir>] [-password-file <file>] [-new-password-file <file>] passwd <address>
+//	keystore [-dir <dir>] seeds
+//	keystore [-dir <dir>] [-password-file <file>] [-words <n>] mnemonic
+//	keystore [-dir <dir>] [-password-file <file>] [-gateway <urls>] restore
+//	keystore [-dir <dir>] [-password-file <file>] derive <seed id> [account]
+//	keystore [-dir <dir>] [-password-file <file>] -gateway <urls> scan <seed id>
+//	keystore [-dir <dir>] [-password-file <file>] sign <unsigned transaction file | ->
+//	keystore [-dir <dir>] [-password-file <file>] export <address>
+//	keystore [-dir <dir>] multisig <threshold> <public key>...
+//	keystore [-dir <dir>] multisigs
+//	keystore [-dir <dir>] partial <unsigned transaction file | ->
+//	keystore [-dir <dir>] [-password-file <file>] sign-partial <partial transaction file | ->
+//	keystore combine <partial transaction file>...
+//	keystore finalize <partial transaction file | ->
+//	keystore script <locking script>
+//	keystore [-dir <dir>] [-password-file <file>] sign-script <unsigned transaction file | -> <address>
+//	keystore spend-script <unsigned transaction file | -> <locking script> <unlocking script>
+//
+// Le password si leggono dai file o dalle variabili d'ambiente
+// KEYSTORE_PASSWORD e KEYSTORE_NEW_PASSWORD, la passphrase della
+// frase da MNEMONIC_PASSPHRASE
+// "restore" legge la frase dallo standard input e, con -gateway,
+// cerca sul nodo gli indirizzi usati
+// "sign" firma una transazione preparata da "/transaction/unsigned"
+// del wallet server e stampa il json da inviare a "/transaction/relay",
+// non serve la rete
+// "export" stampa in chiaro le chiavi, per firmare nel browser
+// "multisig" salva nel keystore un account multisig, che richiede
+// threshold firme delle chiavi pubbliche, e ne stampa l'address
+// "partial" converte una transazione da firmare in una transazione
+// parzialmente firmata, da passare ai firmatari: ognuno la firma con
+// "sign-partial", con le chiavi che ha nel keystore, le copie firmate
+// si uniscono con "combine" e "finalize" stampa la transazione firmata
+// da inviare a "/transaction/relay"; se il sender è un account
+// multisig la sua policy deve essere nel keystore
+// "script" converte uno script di blocco dalla forma testuale e ne
+// stampa l'address, a cui inviare i fondi, e l'esadecimale;
+// "sign-script" stampa la firma della transazione con la chiave
+// dell'address, da mettere nello script di sblocco, e "spend-script"
+// stampa la transazione che spende i fondi dello script, da inviare a
+// "/transaction/relay", dopo averla verificata
+func main() {
+	dir := flag.String("dir", "keystore_5000", "Keystore directory")
+	passwordFile := flag.String("password-file", "", "File with the password (default $"+keystore.PASSWORD_ENV+")")
+	newPasswordFile := flag.String("new-password-file", "", "File with the new password for passwd (default $"+NEW_PASSWORD_ENV+")")
+	words := flag.Int("words", 12, "Words of a new mnemonic: 12, 15, 18, 21 or 24")
+	gateway := flag.String("gateway", "", "Blockchain servers to scan for used addresses, separated by commas")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] list | new | import <private key hex> | passwd <address> | seeds | mnemonic | restore | derive <seed id> [account] | scan <seed id> | sign <file> | export <address> | multisig <threshold> <public key>... | multisigs | partial <file> | sign-partial <file> | combine <file>... | finalize <file> | script <asm> | sign-script <file> <address> | spend-script <file> <asm> <asm>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	ks := keystore.NewKeystore(*dir)
+
+	switch command, args := flag.Arg(0), flag.Args()[1:]; {
+	case command == "list" && len(args) == 0:
+		list, err := ks.List()
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		for _, kf := range list {
+			fmt.Printf("%s  %s  %s\n", kf.BlockchainAddress, time.Unix(kf.Created, 0).UTC().Format(time.RFC3339), kf.PublicKey)
+		}
+	case command == "new" && len(args) == 0:
+		w, err := ks.Create(password(*passwordFile))
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		fmt.Println(w.BlockchainAddress())
+	case command == "import" && len(args) == 1:
+		w, err := keystore.ParsePrivateKey(args[0])
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		if err := ks.Save(w, password(*passwordFile)); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		fmt.Println(w.BlockchainAddress())
+	case command == "passwd" && len(args) == 1:
+		oldPassword := password(*passwordFile)
+		newPassword := os.Getenv(NEW_PASSWORD_ENV)
+		if *newPasswordFile != "" {
+			newPassword = password(*newPasswordFile)
+		}
+		if newPassword == "" {
+			log.Fatalf("ERROR: set %s or use -new-password-file", NEW_PASSWORD_ENV)
+		}
+		if err := ks.ChangePassword(args[0], oldPassword, newPassword); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		fmt.Println("Password changed")
+	case command == "seeds" && len(args) == 0:
+		seeds, err := ks.Seeds()
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		for _, sf := range seeds {
+			accounts := make([]string, 0, len(sf.Accounts))
+			for _, a := range sf.Accounts {
+				accounts = append(accounts, fmt.Sprintf("%d'=%d", a.Index, a.Addresses))
+			}
+			fmt.Printf("%s  %s  %s\n", sf.ID, time.Unix(sf.Created, 0).UTC().Format(time.RFC3339), strings.Join(accounts, " "))
+		}
+	case command == "mnemonic" && len(args) == 0:
+		if *words < 12 || *words > 24 || *words%3 != 0 {
+			log.Fatalf("ERROR: -words must be 12, 15, 18, 21 or 24")
+		}
+		mnemonic, err := hd_wallet.GenerateMnemonic(*words * 32 / 3)
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		p := password(*passwordFile)
+		sf := saveSeed(ks, mnemonic, p, false)
+		fmt.Println(mnemonic)
+		printSeed(ks, sf.ID, []uint32{1}, p)
+	case command == "restore" && len(args) == 0:
+		mnemonic, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && mnemonic == "" {
+			log.Fatalf("ERROR: reading the mnemonic: %v", err)
+		}
+		p := password(*passwordFile)
+		sf := saveSeed(ks, mnemonic, p, true)
+		addresses := []uint32{1}
+		if *gateway != "" {
+			addresses = scan(sf, p, *gateway)
+		}
+		printSeed(ks, sf.ID, addresses, p)
+	case command == "derive" && (len(args) == 1 || len(args) == 2):
+		account := uint64(0)
+		if len(args) == 2 {
+			var err error
+			if account, err = strconv.ParseUint(args[1], 10, 31); err != nil {
+				log.Fatalf("ERROR: invalid account %s", args[1])
+			}
+		}
+		kf, err := ks.DeriveAddress(args[0], uint32(account), password(*passwordFile))
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		fmt.Printf("%s  %s\n", kf.BlockchainAddress, kf.Path)
+	case command == "scan" && len(args) == 1 && *gateway != "":
+		sf, err := ks.SeedFile(args[0])
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		p := password(*passwordFile)
+		printSeed(ks, sf.ID, scan(sf, p, *gateway), p)
+	case command == "sign" && len(args) == 1:
+		var ut unsigned_transaction.UnsignedTransaction
+		readJson(args[0], "unsigned transaction", &ut)
+		if err := ut.Check(); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		// Quello che si firma va mostrato prima di chiedere la chiave
+		logSigning(&ut)
+		w, err := ks.Load(ut.SenderBlockchainAddress, password(*passwordFile))
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		signed, err := ut.Sign(w)
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		printJson(signed)
+	case command == "export" && len(args) == 1:
+		w, err := ks.Load(args[0], password(*passwordFile))
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		fmt.Printf("private_key %s\npublic_key  %s\n", w.PrivateKeyStr(), w.PublicKeyStr())
+	case command == "multisig" && len(args) >= 2:
+		threshold, err := strconv.Atoi(args[0])
+		if err != nil {
+			log.Fatalf("ERROR: invalid threshold %s", args[0])
+		}
+		p, err := multisig.NewPolicy(threshold, args[1:])
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		mf, err := ks.SaveMultisig(p)
+		if err != nil && !errors.Is(err, keystore.ErrExists) {
+			log.Fatalf("ERROR: %v", err)
+		}
+		fmt.Println(mf.BlockchainAddress)
+	case command == "multisigs" && len(args) == 0:
+		list, err := ks.MultisigList()
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		for _, mf := range list {
+			fmt.Printf("%s  %d-of-%d  %s\n", mf.BlockchainAddress, mf.Threshold, len(mf.PublicKeys), time.Unix(mf.Created, 0).UTC().Format(time.RFC3339))
+		}
+	case command == "partial" && len(args) == 1:
+		var ut unsigned_transaction.UnsignedTransaction
+		readJson(args[0], "unsigned transaction", &ut)
+		var pt *partial_transaction.PartialTransaction
+		var err error
+		if multisig.IsAddress(ut.SenderBlockchainAddress) {
+			var mf *keystore.MultisigFile
+			if mf, err = ks.MultisigFile(ut.SenderBlockchainAddress); err != nil {
+				log.Fatalf("ERROR: %v", err)
+			}
+			pt, err = partial_transaction.NewMultisigPartialTransaction(&ut, &mf.Policy)
+		} else {
+			pt, err = partial_transaction.NewPartialTransaction(&ut)
+		}
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		printJson(pt)
+	case command == "sign-partial" && len(args) == 1:
+		pt := readPartial(args[0])
+		logSigning(pt.Transaction)
+		// Firma con tutte le chiavi dei firmatari che sono nel keystore
+		p := password(*passwordFile)
+		signed := 0
+		for _, s := range pt.Signers {
+			if s.Signed() {
+				continue
+			}
+			w, err := ks.Load(s.BlockchainAddress, p)
+			if errors.Is(err, keystore.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				log.Fatalf("ERROR: %v", err)
+			}
+			if err := pt.Sign(w); err != nil {
+				log.Fatalf("ERROR: %v", err)
+			}
+			log.Printf("Signed by %s", s.BlockchainAddress)
+			signed++
+		}
+		if signed == 0 {
+			log.Fatalf("ERROR: no key of a missing signer in %s", *dir)
+		}
+		printJson(pt)
+	case command == "combine" && len(args) > 0:
+		pts := make([]*partial_transaction.PartialTransaction, 0, len(args))
+		for _, a := range args {
+			pts = append(pts, readPartial(a))
+		}
+		pt, err := partial_transaction.Combine(pts...)
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		if missing := pt.Missing(); len(missing) > 0 {
+			log.Printf("Missing signatures: %s", strings.Join(missing, " "))
+		}
+		printJson(pt)
+	case command == "finalize" && len(args) == 1:
+		tr, err := readPartial(args[0]).Finalize()
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		printJson(tr)
+	case command == "script" && len(args) == 1:
+		lock := assemble(args[0])
+		fmt.Printf("address %s\nscript  %s\n", script.Address(lock), hex.EncodeToString(lock))
+	case command == "sign-script" && len(args) == 2:
+		var ut unsigned_transaction.UnsignedTransaction
+		readJson(args[0], "unsigned transaction", &ut)
+		if err := ut.Check(); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		logSigning(&ut)
+		w, err := ks.Load(args[1], password(*passwordFile))
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		signature, err := ut.SignPayload(w)
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		fmt.Println(signature)
+	case command == "spend-script" && len(args) == 3:
+		var ut unsigned_transaction.UnsignedTransaction
+		readJson(args[0], "unsigned transaction", &ut)
+		if err := ut.Check(); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		tr := ut.Scripted(&script.Witness{
+			LockingScript:   hex.EncodeToString(assemble(args[1])),
+			UnlockingScript: hex.EncodeToString(assemble(args[2])),
+		})
+		if err := tr.Validate(); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		if err := unsigned_transaction.Verify(tr); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		printJson(tr)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// Funzione che legge la password, termina se manca
+func password(path string) string {
+	p, err := keystore.ReadPassword(path)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	return p
+}
+
+// Funzione che legge il json del file, o dello standard input con
+// "-", in v, termina se c'è un errore
+func readJson(path string, what string, v interface{}) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		log.Fatalf("ERROR: invalid %s: %v", what, err)
+	}
+}
+
+// Funzione che legge e controlla una transazione parzialmente firmata
+func readPartial(path string) *partial_transaction.PartialTransaction {
+	var pt partial_transaction.PartialTransaction
+	readJson(path, "partial transaction", &pt)
+	if err := pt.Check(); err != nil {
+		log.Fatalf("ERROR: %s: %v", path, err)
+	}
+	return &pt
+}
+
+// Funzione che converte uno script dalla forma testuale, termina se
+// non è valido
+func assemble(asm string) []byte {
+	b, err := script.Assemble(asm)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	return b
+}
+
+// Funzione che stampa v in json indentato
+func printJson(v interface{}) {
+	m, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(m))
+}
+
+// Funzione che mostra sullo standard error quello che si firma
+func logSigning(ut *unsigned_transaction.UnsignedTransaction) {
+	log.Printf("Signing: send %s from %s to %s on network %s", strconv.FormatFloat(float64(ut.Value), 'f', -1, 32), ut.SenderBlockchainAddress, ut.RecipientBlockchainAddress, ut.ChainID)
+	if ut.ValidAfter != 0 || ut.ValidUntil != 0 {
+		log.Printf("Signing: valid after %d, until %d (0: no limit, below %d: block height, else unix time)", ut.ValidAfter, ut.ValidUntil, locktime.THRESHOLD)
+	}
+	if m := ut.Contract; m != nil && m.Deploy() {
+		log.Printf("Signing: deploy %d hex characters of code, gas limit %d", len(m.Code), m.GasLimit)
+	} else if m != nil {
+		log.Printf("Signing: call with %d arguments, gas limit %d", len(m.Args), m.GasLimit)
+	}
+	if op := ut.Asset; op != nil {
+		log.Printf("Signing: %s %d of asset %s", op.Type, op.Amount, op.Asset)
+	}
+}
+
+// Funzione che salva il seed della frase, termina se c'è un errore
+// Con restore un seed già nel keystore va bene
+func saveSeed(ks *keystore.Keystore, mnemonic string, password string, restore bool) *keystore.SeedFile {
+	seed, err := hd_wallet.Seed(mnemonic, os.Getenv(PASSPHRASE_ENV))
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	sf, err := ks.SaveSeed(seed, password)
+	if err != nil && !(restore && errors.Is(err, keystore.ErrExists)) {
+		log.Fatalf("ERROR: %v", err)
+	}
+	return sf
+}
+
+// Funzione che cerca sul nodo gli indirizzi usati degli account del
+// seed, almeno uno per l'account 0
+func scan(sf *keystore.SeedFile, password string, gateway string) []uint32 {
+	master, err := sf.Decrypt(password)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	node := client.NewNodeClient(strings.Split(gateway, ","), client.Options{})
+	addresses, err := hd_wallet.ScanAccounts(context.Background(), master, hd_wallet.GAP_LIMIT, node.Used)
+	if err != nil {
+		log.Fatalf("ERROR: scan: %v", err)
+	}
+	if addresses[0] == 0 {
+		addresses[0] = 1
+	}
+	return addresses
+}
+
+// Funzione che deriva gli indirizzi mancanti degli account e stampa
+// id del seed e indirizzi
+func printSeed(ks *keystore.Keystore, id string, addresses []uint32, password string) {
+	if _, err := ks.ExtendAccounts(id, addresses, password); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	keys, err := ks.SeedKeys(id)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	fmt.Printf("Seed %s\n", id)
+	for _, kf := range keys {
+		fmt.Printf("%s  %s\n", kf.BlockchainAddress, kf.Path)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain_server"
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet_server"
+)
+
+// Main per generare i documenti OpenAPI dei server dai loro
+// endpoint, con -check controlla che quelli salvati siano aggiornati
+func main() {
+	dir := flag.String("dir", filepath.Join("docs", "openapi"), "Directory of the OpenAPI documents")
+	check := flag.Bool("check", false, "Fail if the saved documents differ from the generated ones")
+	flag.Parse()
+
+	// I server scrivono nel log quando vengono creati
+	log.SetOutput(io.Discard)
+	bcs := blockchain_server.NewBlockchainServer(blockchain_server.Options{})
+	ws := wallet_server.NewWalletServer(0, "", keystore.NewKeystore(""))
+
+	docs := []struct {
+		file     string
+		generate func() (*openapi.Document, error)
+	}{
+		{"blockchain_server.json", bcs.OpenAPI},
+		{"wallet_server.json", ws.OpenAPI},
+	}
+	failed := false
+	for _, d := range docs {
+		path := filepath.Join(*dir, d.file)
+		doc, err := d.generate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		m, err := doc.Marshal()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		if *check {
+			saved, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(saved, m) {
+				fmt.Fprintf(os.Stderr, "%s is out of date, run go run ./cmd/openapi\n", path)
+				failed = true
+			}
+			continue
+		}
+		if err := os.MkdirAll(*dir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(path, m, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		fmt.Println("Written", path)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
 	"github.com/iltommi1995/blockchain-go/pkg/wallet_server"
 )
 
@@ -17,10 +20,18 @@ func main() {
 	port := flag.Uint("port", 8000, "TCP Port Number for Wallet Server")
 	// Parametro per la gateway che permette al wallet di comunicare con il blockchain server
 	gateway := flag.String("gateway", "http://localhost:5000", "Blockchain Gateway")
+	// Directory del keystore con le chiavi dei wallet
+	keystoreDir := flag.String("keystore", "", "Keystore directory with the wallet keys (default keystore_<port>)")
+	// Origini delle pagine che possono aprire il websocket di /rpc
+	allowedOrigins := flag.String("allowed-origins", "", "Comma separated list of other origins whose pages may open websockets (e.g. https://example.com)")
 	flag.Parse()
+	if *keystoreDir == "" {
+		*keystoreDir = fmt.Sprintf("keystore_%d", *port)
+	}
 
 	// Creo il wallet server
-	app := wallet_server.NewWalletServer(uint16(*port), *gateway)
+	app := wallet_server.NewWalletServer(uint16(*port), *gateway, keystore.NewKeystore(*keystoreDir))
+	app.SetAllowedOrigins(utils.SplitList(*allowedOrigins))
 	// Starto il wallet server
 	log.Println("Wallet Server running")
 	app.Run()
@@ -0,0 +1,5 @@
+; Conta le chiamate e ritorna il nuovo valore
+"count" DUP SLOAD 1 ADD  ; "count" n+1
+DUP ROT SWAP             ; n+1 "count" n+1
+SSTORE
+RETURN
@@ -0,0 +1,50 @@
+; Token con un registro dei saldi, le chiavi sono "b:" e l'address
+;
+;   "balance" <address>      ritorna il saldo
+;   "mint" <amount>          crea amount token per chi chiama, solo
+;                            il proprietario, cioè chi chiama per primo
+;   "transfer" <to> <amount> invia amount token da chi chiama a to
+;
+; Gli argomenti sono sullo stack nell'ordine, il nome in fondo
+
+DEPTH 3 EQ @three JUMPI
+DEPTH 2 EQ @two JUMPI
+REVERT
+
+two:                        ; op x
+  SWAP                      ; x op
+  DUP "balance" EQ @balance JUMPI
+  DUP "mint" EQ @mint JUMPI
+  REVERT
+
+balance:                    ; address op
+  POP
+  "b:" SWAP CONCAT SLOAD
+  RETURN
+
+mint:                       ; amount op
+  POP
+  "owner" SLOAD DUP NOT @first JUMPI
+  CALLER EQ @credit JUMPI
+  REVERT
+first:                      ; amount owner
+  POP "owner" CALLER SSTORE
+credit:                     ; amount
+  "b:" CALLER CONCAT DUP SLOAD  ; amount key balance
+  ROT ADD SSTORE
+  STOP
+
+three:                      ; op to amount
+  ROT                       ; to amount op
+  "transfer" EQ NOT @fail JUMPI
+  ; Il saldo di chi chiama, SUB fallisce se non basta
+  "b:" CALLER CONCAT DUP SLOAD  ; to amount key balance
+  ROT DUP ROT SWAP SUB      ; to key amount balance-amount
+  ROT SWAP SSTORE           ; to amount
+  ; Il saldo di to
+  SWAP "b:" SWAP CONCAT DUP SLOAD  ; amount key balance
+  ROT ADD SSTORE
+  STOP
+
+fail:
+  REVERT
@@ -3,6 +3,6 @@ module github.com/iltommi1995/blockchain-go
 go 1.17
 
 require (
-	github.com/btcsuite/btcutil v1.0.2 // indirect
-	golang.org/x/crypto v0.0.0-20220214200702-86341886e292 // indirect
-)
\ No newline at end of file
+	github.com/btcsuite/btcutil v1.0.2
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
+)
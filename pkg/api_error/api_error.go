@@ -0,0 +1,179 @@
+package api_error
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+)
+
+// Codici degli errori, leggibili da un programma, restano stabili
+// anche se cambia il messaggio
+const (
+	CODE_INVALID_JSON         = "invalid_json"
+	CODE_MISSING_FIELD        = "missing_field"
+	CODE_INVALID_FIELD        = "invalid_field"
+	CODE_METHOD_NOT_ALLOWED   = "method_not_allowed"
+	CODE_NOT_FOUND            = "not_found"
+	CODE_UNAUTHORIZED         = "unauthorized"
+	CODE_FORBIDDEN            = "forbidden"
+	CODE_INVALID_SIGNATURE    = "invalid_signature"
+	CODE_WRONG_PASSWORD       = "wrong_password"
+	CODE_INSUFFICIENT_BALANCE = "insufficient_balance"
+	CODE_EXPIRED              = "expired"
+	CODE_TIMEOUT_NOT_REACHED  = "timeout_not_reached"
+	CODE_CONFLICT             = "conflict"
+	CODE_CONTRACT_FAILED      = "contract_failed"
+	CODE_ASSET_FAILED         = "asset_failed"
+	CODE_STALE_BLOCK          = "stale_block"
+	CODE_GATEWAY_UNREACHABLE  = "gateway_unreachable"
+	CODE_GATEWAY_ERROR        = "gateway_error"
+	CODE_INTERNAL             = "internal_error"
+)
+
+// Errore restituito dagli endpoint REST: il codice per i programmi,
+// il messaggio per le persone, il campo della richiesta che lo ha
+// causato, se c'è, e lo stato HTTP con cui viene restituito
+type ApiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+func (e *ApiError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s (%s)", e.Code, e.Message, e.Field)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Funzione per creare un errore
+func New(status int, code string, message string) *ApiError {
+	return &ApiError{Status: status, Code: code, Message: message}
+}
+
+// Metodo che ritorna una copia dell'errore riferita al campo
+func (e *ApiError) WithField(field string) *ApiError {
+	c := *e
+	c.Field = field
+	return &c
+}
+
+// Il body della richiesta non è un json valido
+func InvalidJson(err error) *ApiError {
+	return New(http.StatusBadRequest, CODE_INVALID_JSON, fmt.Sprintf("invalid json body: %v", err))
+}
+
+// Manca un campo obbligatorio
+func MissingField(field string) *ApiError {
+	return New(http.StatusBadRequest, CODE_MISSING_FIELD, fmt.Sprintf("missing field %s", field)).WithField(field)
+}
+
+// Un campo ha un valore non valido
+func InvalidField(field string, reason string) *ApiError {
+	return New(http.StatusBadRequest, CODE_INVALID_FIELD, fmt.Sprintf("invalid %s: %s", field, reason)).WithField(field)
+}
+
+func NotFound(message string) *ApiError {
+	return New(http.StatusNotFound, CODE_NOT_FOUND, message)
+}
+
+func Unauthorized(message string) *ApiError {
+	return New(http.StatusUnauthorized, CODE_UNAUTHORIZED, message)
+}
+
+func Forbidden(message string) *ApiError {
+	return New(http.StatusForbidden, CODE_FORBIDDEN, message)
+}
+
+// La password non decifra la chiave del keystore
+func WrongPassword(field string) *ApiError {
+	return New(http.StatusUnauthorized, CODE_WRONG_PASSWORD, "wrong password").WithField(field)
+}
+
+func Internal(message string) *ApiError {
+	return New(http.StatusInternalServerError, CODE_INTERNAL, message)
+}
+
+// Il server a cui si inoltra la richiesta non risponde
+func GatewayUnreachable(err error) *ApiError {
+	return New(http.StatusBadGateway, CODE_GATEWAY_UNREACHABLE, fmt.Sprintf("blockchain gateway unreachable: %v", err))
+}
+
+// Il server a cui si inoltra la richiesta ha risposto in modo inatteso
+func GatewayError(message string) *ApiError {
+	return New(http.StatusBadGateway, CODE_GATEWAY_ERROR, message)
+}
+
+// Funzione che converte un errore qualsiasi in ApiError, quelli che
+// non lo sono diventano errori interni
+func From(err error) *ApiError {
+	var e *ApiError
+	if errors.As(err, &e) {
+		return e
+	}
+	return Internal(err.Error())
+}
+
+// Funzione per rispondere con l'errore, il body è
+// {"message": "fail", "error": {"code", "message", "field"}}
+// così i client che guardano solo "message" continuano a funzionare
+func Write(w http.ResponseWriter, err error) {
+	e := From(err)
+	m, _ := json.Marshal(struct {
+		Message string    `json:"message"`
+		Error   *ApiError `json:"error"`
+	}{
+		Message: "fail",
+		Error:   e,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	w.Write(m)
+}
+
+// Funzione per rispondere a un metodo HTTP non supportato
+func WriteMethodNotAllowed(w http.ResponseWriter, req *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	Write(w, New(http.StatusMethodNotAllowed, CODE_METHOD_NOT_ALLOWED,
+		fmt.Sprintf("method %s not allowed, use %s", req.Method, strings.Join(allowed, " or "))))
+}
+
+// Funzione che legge l'errore dalla risposta di un altro server
+// che usa questo formato, per inoltrarlo al client
+func Read(resp *http.Response) *ApiError {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return GatewayError(fmt.Sprintf("reading gateway response: %v", err))
+	}
+	var v struct {
+		Error *ApiError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil || v.Error == nil || v.Error.Code == "" {
+		return GatewayError(fmt.Sprintf("gateway responded with status %s", resp.Status))
+	}
+	v.Error.Status = resp.StatusCode
+	return v.Error
+}
+
+// Funzione che ritorna lo schema OpenAPI del body degli errori
+func Schema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"message": openapi.String("always \"fail\""),
+		"error": openapi.Object(map[string]*openapi.Schema{
+			"code": {Type: "string", Enum: []string{
+				CODE_INVALID_JSON, CODE_MISSING_FIELD, CODE_INVALID_FIELD, CODE_METHOD_NOT_ALLOWED,
+				CODE_NOT_FOUND, CODE_UNAUTHORIZED, CODE_FORBIDDEN, CODE_INVALID_SIGNATURE, CODE_WRONG_PASSWORD,
+				CODE_INSUFFICIENT_BALANCE, CODE_EXPIRED, CODE_TIMEOUT_NOT_REACHED, CODE_CONFLICT, CODE_CONTRACT_FAILED, CODE_ASSET_FAILED, CODE_STALE_BLOCK, CODE_GATEWAY_UNREACHABLE,
+				CODE_GATEWAY_ERROR, CODE_INTERNAL,
+			}},
+			"message": openapi.String("human readable description"),
+			"field":   openapi.String("request field that caused the error"),
+		}, "code", "message"),
+	}, "message", "error")
+}
@@ -15,3 +15,10 @@ func (ar *AmountResponse) MarshalJSON() ([]byte, error) {
 		Amount: ar.Amount,
 	})
 }
+
+// Saldo di un account in un token, nell'unità più piccola, risposta in
+// json
+type AssetAmountResponse struct {
+	Asset  string `json:"asset"`
+	Amount uint64 `json:"amount"`
+}
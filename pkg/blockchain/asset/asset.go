@@ -0,0 +1,129 @@
+package asset
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+)
+
+// Tipi delle operazioni sui token
+const (
+	// Crea un token con il sender come emittente, che riceve Amount
+	ISSUE = "issue"
+	// L'emittente crea Amount token per il recipient
+	MINT = "mint"
+	// L'emittente distrugge Amount dei suoi token
+	BURN = "burn"
+	// Il sender invia Amount token al recipient
+	TRANSFER = "transfer"
+)
+
+// Limiti dei metadati di un token
+const (
+	MIN_SYMBOL_SIZE = 3
+	MAX_SYMBOL_SIZE = 12
+	MAX_NAME_SIZE   = 64
+	MAX_DECIMALS    = 18
+)
+
+var (
+	// Il simbolo non è di un token emesso
+	ErrNotFound = errors.New("asset not found")
+	// Un token con lo stesso simbolo è già stato emesso
+	ErrExists = errors.New("asset already issued")
+	// Solo l'emittente può creare e distruggere i token
+	ErrNotIssuer = errors.New("only the issuer can mint and burn")
+	// Il sender non ha abbastanza token
+	ErrInsufficientBalance = errors.New("insufficient asset balance")
+	// La quantità in circolazione supererebbe 2^64-1
+	ErrSupplyOverflow = errors.New("asset supply overflow")
+	// Emissione e distruzione hanno come recipient il sender
+	ErrInvalidRecipient = errors.New("issue and burn must be sent to the sender")
+)
+
+// Operazione di una transazione su un token, identificato dal
+// simbolo Asset
+// Le quantità sono intere, nell'unità più piccola del token: Decimals
+// dice solo come mostrarle, con 2 decimali 150 è 1.50
+// Name e Decimals ci sono solo nell'emissione, l'operazione fa parte
+// del payload firmato dal sender
+type Operation struct {
+	Type     string `json:"type"`
+	Asset    string `json:"asset"`
+	Amount   uint64 `json:"amount"`
+	Name     string `json:"name,omitempty"`
+	Decimals uint8  `json:"decimals,omitempty"`
+}
+
+// Metodo che controlla la forma dell'operazione, senza i saldi
+func (op *Operation) Validate() error {
+	if err := ValidateSymbol(op.Asset); err != nil {
+		return err
+	}
+	switch op.Type {
+	case ISSUE:
+		if op.Name == "" || len(op.Name) > MAX_NAME_SIZE || !printable(op.Name) {
+			return fmt.Errorf("name must be 1 to %d printable ASCII characters", MAX_NAME_SIZE)
+		}
+		if op.Decimals > MAX_DECIMALS {
+			return fmt.Errorf("decimals must be at most %d", MAX_DECIMALS)
+		}
+		return nil
+	case MINT, BURN, TRANSFER:
+		if op.Name != "" || op.Decimals != 0 {
+			return fmt.Errorf("name and decimals are only for %s", ISSUE)
+		}
+		if op.Amount == 0 {
+			return errors.New("amount must be positive")
+		}
+		return nil
+	}
+	return fmt.Errorf("type must be %s, %s, %s or %s", ISSUE, MINT, BURN, TRANSFER)
+}
+
+// Funzione che controlla un simbolo: da MIN_SYMBOL_SIZE a
+// MAX_SYMBOL_SIZE lettere maiuscole e cifre, la prima una lettera
+func ValidateSymbol(symbol string) error {
+	if len(symbol) < MIN_SYMBOL_SIZE || len(symbol) > MAX_SYMBOL_SIZE {
+		return fmt.Errorf("asset must be %d to %d characters", MIN_SYMBOL_SIZE, MAX_SYMBOL_SIZE)
+	}
+	for i, c := range symbol {
+		if !(c >= 'A' && c <= 'Z') && !(i > 0 && c >= '0' && c <= '9') {
+			return errors.New("asset must be upper case letters and digits, starting with a letter")
+		}
+	}
+	return nil
+}
+
+func printable(s string) bool {
+	for _, c := range s {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Funzione che ritorna lo schema OpenAPI dell'operazione
+func Schema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"type":     openapi.String(fmt.Sprintf("%s, %s, %s or %s", ISSUE, MINT, BURN, TRANSFER)),
+		"asset":    openapi.String(fmt.Sprintf("symbol, %d to %d upper case letters and digits", MIN_SYMBOL_SIZE, MAX_SYMBOL_SIZE)),
+		"amount":   openapi.Integer("in the smallest unit of the asset; the initial supply for issue, positive for the others"),
+		"name":     openapi.String("issue only"),
+		"decimals": openapi.Integer(fmt.Sprintf("issue only, at most %d; how amounts are displayed", MAX_DECIMALS)),
+	}, "type", "asset", "amount")
+}
+
+// Funzione che ritorna lo schema OpenAPI di un token emesso
+func InfoSchema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"asset":    openapi.String("symbol"),
+		"name":     openapi.String(""),
+		"decimals": openapi.Integer(""),
+		"issuer":   openapi.String("address that issued the asset, the only one that can mint and burn"),
+		"supply":   openapi.Integer("amount in circulation, in the smallest unit"),
+		"height":   openapi.Integer("height of the block that issued the asset"),
+	}, "asset", "name", "decimals", "issuer", "supply", "height")
+}
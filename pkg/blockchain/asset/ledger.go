@@ -0,0 +1,208 @@
+package asset
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+	"sort"
+)
+
+// Token emesso, con la quantità in circolazione e l'altezza del
+// blocco che lo ha emesso
+type Info struct {
+	Asset    string `json:"asset"`
+	Name     string `json:"name"`
+	Decimals uint8  `json:"decimals"`
+	Issuer   string `json:"issuer"`
+	Supply   uint64 `json:"supply"`
+	Height   int    `json:"height"`
+}
+
+// Saldo di un address in un token
+type balance struct {
+	asset   string
+	address string
+}
+
+// Registro dei token emessi e dei saldi dopo un blocco
+type Ledger struct {
+	assets   map[string]Info
+	balances map[balance]uint64
+}
+
+// Funzione che crea il registro vuoto, quello del genesis
+func NewLedger() *Ledger {
+	return &Ledger{assets: make(map[string]Info), balances: make(map[balance]uint64)}
+}
+
+// Metodo che ritorna una copia del registro, da modificare senza
+// cambiare l'originale
+func (l *Ledger) Clone() *Ledger {
+	c := &Ledger{
+		assets:   make(map[string]Info, len(l.assets)),
+		balances: make(map[balance]uint64, len(l.balances)),
+	}
+	for k, v := range l.assets {
+		c.assets[k] = v
+	}
+	for k, v := range l.balances {
+		c.balances[k] = v
+	}
+	return c
+}
+
+// Metodo che applica al registro l'operazione di una transazione dal
+// sender al recipient, nel blocco all'altezza height
+// Se ritorna un errore il registro non cambia
+func (l *Ledger) Apply(sender string, recipient string, op *Operation, height int) error {
+	if err := op.Validate(); err != nil {
+		return err
+	}
+	if op.Type == ISSUE {
+		if recipient != sender {
+			return ErrInvalidRecipient
+		}
+		if _, ok := l.assets[op.Asset]; ok {
+			return ErrExists
+		}
+		l.assets[op.Asset] = Info{
+			Asset:    op.Asset,
+			Name:     op.Name,
+			Decimals: op.Decimals,
+			Issuer:   sender,
+			Supply:   op.Amount,
+			Height:   height,
+		}
+		l.credit(op.Asset, sender, op.Amount)
+		return nil
+	}
+	info, ok := l.assets[op.Asset]
+	if !ok {
+		return ErrNotFound
+	}
+	switch op.Type {
+	case MINT:
+		if sender != info.Issuer {
+			return ErrNotIssuer
+		}
+		supply, carry := bits.Add64(info.Supply, op.Amount, 0)
+		if carry != 0 {
+			return ErrSupplyOverflow
+		}
+		info.Supply = supply
+		l.assets[op.Asset] = info
+		l.credit(op.Asset, recipient, op.Amount)
+	case BURN:
+		if sender != info.Issuer {
+			return ErrNotIssuer
+		}
+		if recipient != sender {
+			return ErrInvalidRecipient
+		}
+		if err := l.debit(op.Asset, sender, op.Amount); err != nil {
+			return err
+		}
+		info.Supply -= op.Amount
+		l.assets[op.Asset] = info
+	case TRANSFER:
+		if err := l.debit(op.Asset, sender, op.Amount); err != nil {
+			return err
+		}
+		l.credit(op.Asset, recipient, op.Amount)
+	}
+	return nil
+}
+
+// Metodo che aggiunge amount al saldo, non supera 2^64-1 perché la
+// somma dei saldi è la quantità in circolazione
+func (l *Ledger) credit(asset string, address string, amount uint64) {
+	if amount > 0 {
+		l.balances[balance{asset, address}] += amount
+	}
+}
+
+func (l *Ledger) debit(asset string, address string, amount uint64) error {
+	k := balance{asset, address}
+	if l.balances[k] < amount {
+		return ErrInsufficientBalance
+	}
+	if l.balances[k] -= amount; l.balances[k] == 0 {
+		delete(l.balances, k)
+	}
+	return nil
+}
+
+// Metodo che ritorna il saldo dell'address nel token, ErrNotFound se il
+// token non è stato emesso
+func (l *Ledger) Balance(address string, asset string) (uint64, error) {
+	if _, ok := l.assets[asset]; !ok {
+		return 0, ErrNotFound
+	}
+	return l.balances[balance{asset, address}], nil
+}
+
+// Metodo che ritorna il token con il simbolo, ErrNotFound se non è
+// stato emesso
+func (l *Ledger) Asset(asset string) (*Info, error) {
+	info, ok := l.assets[asset]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &info, nil
+}
+
+// Metodo che ritorna tutti i token emessi, in ordine di simbolo
+func (l *Ledger) Assets() []*Info {
+	assets := make([]*Info, 0, len(l.assets))
+	for _, info := range l.assets {
+		info := info
+		assets = append(assets, &info)
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Asset < assets[j].Asset })
+	return assets
+}
+
+// Metodo che ritorna l'hash del registro: lo SHA-256 dei token in
+// ordine di simbolo, ognuno con i suoi metadati, la quantità in
+// circolazione e i saldi in ordine di address, ogni campo preceduto
+// dalla sua lunghezza
+// Senza token è zero, così i blocchi senza token non cambiano
+func (l *Ledger) Root() [32]byte {
+	if len(l.assets) == 0 {
+		return [32]byte{}
+	}
+	h := sha256.New()
+	write := func(b []byte) {
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(len(b)))
+		h.Write(size)
+		h.Write(b)
+	}
+	number := func(n uint64) {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, n)
+		write(b)
+	}
+	holders := make(map[string][]string, len(l.assets))
+	for k := range l.balances {
+		holders[k.asset] = append(holders[k.asset], k.address)
+	}
+	for _, info := range l.Assets() {
+		write([]byte(info.Asset))
+		write([]byte(info.Name))
+		number(uint64(info.Decimals))
+		write([]byte(info.Issuer))
+		number(info.Supply)
+		number(uint64(info.Height))
+		addresses := holders[info.Asset]
+		sort.Strings(addresses)
+		number(uint64(len(addresses)))
+		for _, address := range addresses {
+			write([]byte(address))
+			number(l.balances[balance{info.Asset, address}])
+		}
+	}
+	var root [32]byte
+	copy(root[:], h.Sum(nil))
+	return root
+}
@@ -10,10 +10,13 @@ import (
 )
 
 // Struct dei singoli blocchi
+// StateRoot è l'hash dello stato dei contratti e dei token dopo le
+// transazioni del blocco, zero se non ci sono né contratti né token
 type Block struct {
 	Timestamp    int64
 	Nonce        int
 	PreviousHash [32]byte
+	StateRoot    [32]byte
 	Transactions []*transaction.Transaction
 }
 
@@ -46,6 +49,9 @@ func (b *Block) Print() {
 	fmt.Printf("|| timestamp     %d\n", b.Timestamp)
 	fmt.Printf("|| nonce     %d\n", b.Nonce)
 	fmt.Printf("|| previous_hash     %x\n", b.PreviousHash)
+	if b.StateRoot != [32]byte{} {
+		fmt.Printf("|| state_root     %x\n", b.StateRoot)
+	}
 	fmt.Printf("|| transactions:\n")
 	for _, t := range b.Transactions {
 		t.Print()
@@ -59,37 +65,58 @@ func (b *Block) Hash() [32]byte {
 }
 
 // Funzione per formattare il json
+// Lo state root c'è solo se non è zero, così i blocchi senza contratti
+// e senza token hanno lo stesso json, e lo stesso hash, di prima
 func (b *Block) MarshalJSON() ([]byte, error) {
+	var stateRoot string
+	if b.StateRoot != [32]byte{} {
+		stateRoot = fmt.Sprintf("%x", b.StateRoot)
+	}
 	return json.Marshal(struct {
 		Timestamp    int64                      `json:"timestamp"`
 		Nonce        int                        `json:"nonce"`
 		PreviousHash string                     `json:"previous_hash"`
+		StateRoot    string                     `json:"state_root,omitempty"`
 		Transactions []*transaction.Transaction `json:"transactions"`
 	}{
 		Timestamp:    b.Timestamp,
 		Nonce:        b.Nonce,
 		PreviousHash: fmt.Sprintf("%x", b.PreviousHash),
+		StateRoot:    stateRoot,
 		Transactions: b.Transactions,
 	})
 }
 
 func (b *Block) UnmarshalJSON(data []byte) error {
-	var previousHash string
+	var previousHash, stateRoot string
 	v := &struct {
 		Timestamp    *int64                      `json:"timestamp"`
 		Nonce        *int                        `json:"nonce"`
 		PreviousHash *string                     `json:"previous_hash"`
+		StateRoot    *string                     `json:"state_root"`
 		Transactions *[]*transaction.Transaction `json:"transactions"`
 	}{
 		Timestamp:    &b.Timestamp,
 		Nonce:        &b.Nonce,
 		PreviousHash: &previousHash,
+		StateRoot:    &stateRoot,
 		Transactions: &b.Transactions,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
-	ph, _ := hex.DecodeString(*v.PreviousHash)
-	copy(b.PreviousHash[:], ph[:32])
+	// I blocchi arrivano anche dagli altri nodi, l'hash va controllato
+	ph, err := hex.DecodeString(previousHash)
+	if err != nil || len(ph) != 32 {
+		return fmt.Errorf("invalid previous hash %q", previousHash)
+	}
+	copy(b.PreviousHash[:], ph)
+	if stateRoot != "" {
+		sr, err := hex.DecodeString(stateRoot)
+		if err != nil || len(sr) != 32 {
+			return fmt.Errorf("invalid state root %q", stateRoot)
+		}
+		copy(b.StateRoot[:], sr)
+	}
 	return nil
 }
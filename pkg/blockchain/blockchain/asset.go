@@ -0,0 +1,60 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+)
+
+var (
+	// L'operazione sul token non è valida con i saldi e i token emessi
+	ErrAssetFailed = errors.New("asset transaction failed")
+	// Il simbolo non è di un token emesso
+	ErrAssetNotFound = errors.New("asset not found")
+)
+
+// Funzione che applica al registro l'operazione sul token di una
+// transazione del blocco all'altezza height
+func applyAsset(assets *asset.Ledger, t *blockchain_transaction.Transaction, height int) error {
+	if t.Value != 0 {
+		return errors.New("asset transactions have value 0")
+	}
+	if t.Htlc != nil || t.Contract != nil {
+		return errors.New("asset transaction with htlc or contract data")
+	}
+	return assets.Apply(t.SenderBlockchainAddress, t.RecipientBlockchainAddress, t.Asset, height)
+}
+
+// Metodo che ritorna i token emessi fino all'ultimo blocco, in ordine
+// di simbolo
+func (bc *Blockchain) Assets() []*asset.Info {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.state.assets.Assets()
+}
+
+// Metodo che ritorna il token con il simbolo, ErrAssetNotFound se non è
+// stato emesso
+func (bc *Blockchain) Asset(symbol string) (*asset.Info, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	info, err := bc.state.assets.Asset(symbol)
+	if err != nil {
+		return nil, ErrAssetNotFound
+	}
+	return info, nil
+}
+
+// Metodo per calcolare il saldo di un account in un token, come
+// CalculateTotalAmount per la moneta della catena
+// Ritorna ErrAssetNotFound se il token non è stato emesso
+func (bc *Blockchain) CalculateAssetAmount(blockchainAddress string, symbol string) (uint64, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	amount, err := bc.state.assets.Balance(blockchainAddress, symbol)
+	if err != nil {
+		return 0, ErrAssetNotFound
+	}
+	return amount, nil
+}
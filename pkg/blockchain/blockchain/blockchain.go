@@ -1,104 +1,160 @@
 package blockchain
 
 import (
-	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/script"
 	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
 	"github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+	"github.com/iltommi1995/blockchain-go/pkg/events"
 	"github.com/iltommi1995/blockchain-go/pkg/utils"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
 )
 
 const (
-	MINING_DIFFICULTY                 = 3
-	MINING_SENDER                     = "COINBASE TRANSACTION"
-	MINING_REWARD                     = 1.0
-	MINING_TIMER_SEC                  = 20
-	BLOCKCHAIN_PORT_RANGE_START       = 5000
-	BLOCKCHAIN_PORT_RANGE_END         = 5004
-	NEIGHBOR_IP_RANGE_START           = 0
-	NEIGHBOR_IP_RANGE_END             = 1
-	BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC = 20
+	MINING_DIFFICULTY = 3
+	MINING_SENDER     = "COINBASE TRANSACTION"
+	MINING_REWARD     = 1.0
+	MINING_TIMER_SEC  = 20
+	// Il timestamp di un blocco deve superare la mediana di quelli
+	// degli ultimi MEDIAN_TIME_BLOCKS blocchi e non può essere più
+	// avanti dell'orologio locale di MAX_FUTURE_BLOCK_TIME_SEC
+	MEDIAN_TIME_BLOCKS        = 11
+	MAX_FUTURE_BLOCK_TIME_SEC = 2 * 60
+	// Rete di default, ogni rete ha il suo genesis
+	DEFAULT_CHAIN_ID = "blockchain-go"
 )
 
+// Motivi per cui una transazione o un blocco minato vengono rifiutati
+var (
+	ErrInvalidSignature    = errors.New("invalid transaction signature")
+	ErrInsufficientBalance = errors.New("sender doesn't have enough balance")
+	ErrInvalidValue        = errors.New("transaction value must be positive")
+	// La transazione ha superato valid_until
+	ErrExpired = errors.New("transaction is expired")
+	// La transazione è firmata per un'altra rete
+	ErrWrongChain = errors.New("transaction is for another chain")
+	// La transazione, a parte le firme, è già nella catena o nel pool
+	ErrReplayed = errors.New("transaction is already in the chain or in the pool")
+	// Durante il mining è arrivato un altro blocco
+	ErrStaleBlock = errors.New("chain changed while mining")
+)
+
+// Rete a cui la blockchain annuncia le nuove transazioni e i nuovi
+// blocchi, la implementa il nodo p2p
+type Network interface {
+	BroadcastTransaction(tr *transaction_request.TransactionRequest)
+	BroadcastBlock(b *block.Block)
+}
+
 // Struct della blockchain
+// La catena e il transaction pool sono protetti da mux: i metodi
+// pubblici prendono il lock da soli, quelli privati che iniziano
+// con la minuscola vanno chiamati con il lock già preso
+// I blocchi e le transazioni non vengono mai modificati dopo
+// essere stati aggiunti, quindi le copie delle slice ritornate
+// dai getter si possono leggere senza lock
 type Blockchain struct {
-	transactionPool   []*blockchain_transaction.Transaction
-	chain             []*block.Block
+	transactionPool []*blockchain_transaction.Transaction
+	chain           []*block.Block
+	// Stato dei contratti e dei token dopo l'ultimo blocco della catena
+	state             *chainState
+	chainID           string
+	genesisHash       [32]byte
 	blockchainAddress string
 	port              uint16
-	mux               sync.Mutex
-	neighbors         []string
-	muxNeighbors      sync.Mutex
+	mux               sync.RWMutex
+	network           Network
+	clock             clock.Clock
+	// Eventi della catena e del transaction pool
+	events *events.Bus
+
+	// Miner in background, se attivo
+	miner    *miner
+	minerMux sync.Mutex
 }
 
+// Miner in background: cancel lo ferma e done viene chiuso
+// quando ha finito l'ultimo blocco
+type miner struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Metodo che ritorna una copia della catena
 func (bc *Blockchain) Chain() []*block.Block {
-	return bc.chain
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	chain := make([]*block.Block, len(bc.chain))
+	copy(chain, bc.chain)
+	return chain
+}
+
+// Metodo per collegare la blockchain alla rete
+func (bc *Blockchain) SetNetwork(network Network) {
+	bc.network = network
 }
 
-func (bc *Blockchain) Neighbors() []string {
-	return bc.neighbors
+// Metodo per cambiare l'orologio usato per il mining, serve
+// alle simulazioni
+func (bc *Blockchain) SetClock(c clock.Clock) {
+	bc.clock = c
 }
 
-// Funzione per creare una nuova Blockchain
-func NewBlockchain(blockchainAddress string, port uint16) *Blockchain {
-	// Crea la blockchain passando un blocco vuoto
-	b := &block.Block{}
+// Funzione per creare una nuova Blockchain sulla rete chainID, se è
+// vuoto su quella di default
+func NewBlockchain(blockchainAddress string, port uint16, chainID string) *Blockchain {
+	if chainID == "" {
+		chainID = DEFAULT_CHAIN_ID
+	}
 	bc := new(Blockchain)
 	bc.blockchainAddress = blockchainAddress
-	bc.CreateBlock(0, 0, b.Hash())
+	bc.chainID = chainID
+	bc.clock = clock.Real()
+	bc.events = events.NewBus()
+	bc.state = newChainState()
+	// Il genesis punta all'hash del chain ID, così le reti diverse
+	// hanno catene diverse fin dal primo blocco
+	bc.CreateBlock(0, 0, sha256.Sum256([]byte(chainID)))
+	bc.genesisHash = bc.chain[0].Hash()
 	bc.port = port
 	return bc
 }
 
-func (bc *Blockchain) SetNeighbors() {
-	bc.neighbors = utils.FindNeighbors(
-		"127.0.0.1",
-		bc.port,
-		NEIGHBOR_IP_RANGE_START,
-		NEIGHBOR_IP_RANGE_END,
-		BLOCKCHAIN_PORT_RANGE_START,
-		BLOCKCHAIN_PORT_RANGE_END,
-	)
-	log.Printf("%v", bc.neighbors)
-}
-
-func (bc *Blockchain) Run() {
-	log.Println("Finding neighbors...")
-	bc.StartSyncNeighbors()
-	log.Println("Sync blockchain with neighbors...")
-	bc.ResolveConflicts()
+// La sincronizzazione con i vicini la fa il nodo p2p, il mining
+// si ferma quando ctx viene cancellato
+func (bc *Blockchain) Run(ctx context.Context) {
 	log.Println("Activating mining...")
-	bc.StartMining()
+	bc.StartMining(ctx)
 }
 
-func (bc *Blockchain) SyncNeighbors() {
-	bc.muxNeighbors.Lock()
-	defer bc.muxNeighbors.Unlock()
-	bc.SetNeighbors()
-}
-
-func (bc *Blockchain) StartSyncNeighbors() {
-	bc.SyncNeighbors()
-	_ = time.AfterFunc(time.Second*BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC, bc.StartSyncNeighbors)
-}
-
-// Getter del transaction pool
+// Getter del transaction pool, ritorna una copia
 func (bc *Blockchain) TransactionPool() []*blockchain_transaction.Transaction {
-	return bc.transactionPool
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	pool := make([]*blockchain_transaction.Transaction, len(bc.transactionPool))
+	copy(pool, bc.transactionPool)
+	return pool
 }
 
 func (bc *Blockchain) ClearTransactionPool() {
-	bc.transactionPool = bc.transactionPool[:0]
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.transactionPool = []*blockchain_transaction.Transaction{}
 }
 
 // Metodo per restituire in json la block
@@ -106,25 +162,39 @@ func (bc *Blockchain) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Blocks []*block.Block `json:"chain"`
 	}{
-		Blocks: bc.chain,
+		Blocks: bc.Chain(),
 	})
 }
 
 func (bc *Blockchain) UnmarshalJSON(data []byte) error {
+	var chain []*block.Block
 	v := &struct {
 		Blocks *[]*block.Block `json:"chain"`
 	}{
-		Blocks: &bc.chain,
+		Blocks: &chain,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
+	state, err := stateOf(chain)
+	if err != nil {
+		return err
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.chain = chain
+	bc.state = state
 	return nil
 }
 
 // Metodo di Blockchain, utilizzato per cerare un nuovo blocco, ritorna un puntatore a Block
 func (bc *Blockchain) CreateBlock(timestamp int64, nonce int, previousHash [32]byte) *block.Block {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.createBlock(timestamp, nonce, previousHash)
+}
 
+func (bc *Blockchain) createBlock(timestamp int64, nonce int, previousHash [32]byte) *block.Block {
 	// Viene passato il transaction pool per le transazioni
 	b := block.NewBlock(timestamp, nonce, previousHash, bc.transactionPool)
 	if len(bc.chain) == 0 {
@@ -136,26 +206,25 @@ func (bc *Blockchain) CreateBlock(timestamp int64, nonce int, previousHash [32]b
 	// Si svuota il transaction pool
 	bc.transactionPool = []*blockchain_transaction.Transaction{}
 
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/transactions", n)
-		client := &http.Client{}
-		req, _ := http.NewRequest("DELETE", endpoint, nil)
-		resp, _ := client.Do(req)
-		log.Printf("%v", resp)
-	}
-
 	return b
 }
 
 // Metodo per ritornare l'ultimo blocco della blockchain
 func (bc *Blockchain) LastBlock() *block.Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.lastBlock()
+}
+
+func (bc *Blockchain) lastBlock() *block.Block {
 	return bc.chain[len(bc.chain)-1]
 }
 
 // Metodo per stampare i dati della blockchain
 func (bc *Blockchain) Print() {
-	fmt.Printf("\n%s BLOCKCHAIN WITH %x BLOCKS %s\n\n", strings.Repeat("*", 25), len(bc.chain), strings.Repeat("*", 25))
-	for i, block := range bc.chain {
+	chain := bc.Chain()
+	fmt.Printf("\n%s BLOCKCHAIN WITH %x BLOCKS %s\n\n", strings.Repeat("*", 25), len(chain), strings.Repeat("*", 25))
+	for i, block := range chain {
 		fmt.Printf("\n%s Block %d %s \n", strings.Repeat("=", 25), i, strings.Repeat("=", 25))
 		fmt.Print("||\n")
 		block.Print()
@@ -165,92 +234,201 @@ func (bc *Blockchain) Print() {
 }
 
 // Metodo della blockchain per creare una transazione
-// ritorna un bool per verificare che AddTransaction sia andato a ubon fine
-func (bc *Blockchain) CreateTransaction(sender string, recipient string, value float32, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
-	isTransacted := bc.AddTransaction(sender, recipient, value, senderPublicKey, s)
-
-	// PARTE DA COMMENTARE
-	if isTransacted {
-		for _, n := range bc.neighbors {
-			publicKeyStr := fmt.Sprintf("%064x%064x", senderPublicKey.X.Bytes(), senderPublicKey.Y.Bytes())
-			signatureStr := s.String()
-			bt := &transaction_request.TransactionRequest{
-				SenderBlockchainAddress:    &sender,
-				RecipientBlockchainAddress: &recipient,
-				SenderPublicKey:            &publicKeyStr,
-				Value:                      &value,
-				Signature:                  &signatureStr,
-			}
-			m, _ := json.Marshal(bt)
-			buf := bytes.NewBuffer(m)
-			endpoint := fmt.Sprintf("http://%s/transactions", n)
-			client := &http.Client{}
-			req, _ := http.NewRequest("PUT", endpoint, buf)
-			resp, _ := client.Do(req)
-			log.Printf("%v", resp)
-		}
+// ritorna l'errore di AddTransaction se la transazione viene rifiutata
+func (bc *Blockchain) CreateTransaction(sender string, recipient string, value float32, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) error {
+	if err := bc.AddTransaction(sender, recipient, value, senderPublicKey, s); err != nil {
+		return err
 	}
-	return isTransacted
+
+	// Se la transazione è valida viene annunciata ai vicini
+	if bc.network != nil {
+		publicKeyStr := publicKeyString(senderPublicKey)
+		signatureStr := s.String()
+		chainID := bc.chainID
+		bc.network.BroadcastTransaction(&transaction_request.TransactionRequest{
+			SenderBlockchainAddress:    &sender,
+			RecipientBlockchainAddress: &recipient,
+			SenderPublicKey:            &publicKeyStr,
+			Value:                      &value,
+			ChainID:                    &chainID,
+			Signature:                  &signatureStr,
+		})
+	}
+	return nil
+}
+
+// Metodo della blockchain per creare una transazione da una richiesta
+// già validata, con chiave pubblica e firma o con il witness di un
+// account multisig e con i limiti di validità
+// ritorna l'errore di AddTransactionRequest se viene rifiutata
+func (bc *Blockchain) CreateTransactionRequest(tr *transaction_request.TransactionRequest) error {
+	if err := bc.AddTransactionRequest(tr); err != nil {
+		return err
+	}
+	if bc.network != nil {
+		bc.network.BroadcastTransaction(tr)
+	}
+	return nil
 }
 
 // Metodo per aggiungere una transazione al transactionPool
-func (bc *Blockchain) AddTransaction(sender string, recipient string, value float32, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
+// Ritorna ErrInvalidValue, ErrInvalidSignature, ErrWrongChain,
+// ErrReplayed o ErrInsufficientBalance se la transazione viene
+// rifiutata, la firma deve essere fatta per la rete della blockchain
+// Le transazioni degli account multisig e quelle con i limiti di
+// validità si aggiungono con AddTransactionRequest
+func (bc *Blockchain) AddTransaction(sender string, recipient string, value float32, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
 	t := blockchain_transaction.NewTransaction(sender, recipient, value)
+	t.ChainID = bc.chainID
+	if senderPublicKey != nil && s != nil {
+		t.SenderPublicKey, t.Signature = publicKeyString(senderPublicKey), s.String()
+	}
+	return bc.addTransaction(t)
+}
+
+// Funzione che ritorna la chiave pubblica in esadecimale, nello stesso
+// formato di sender_public_key
+func publicKeyString(publicKey *ecdsa.PublicKey) string {
+	return fmt.Sprintf("%064x%064x", publicKey.X.Bytes(), publicKey.Y.Bytes())
+}
+
+// Metodo per aggiungere al transactionPool la transazione di una
+// richiesta già validata: gli account multisig firmano con il witness,
+// che deve avere la policy dell'address del sender e almeno tante
+// firme valide quanto la soglia, i fondi degli HTLC si spendono con il
+// contratto senza firme e quelli degli script con lo script di sblocco
+// Le transazioni coinbase le crea solo il miner
+// Ritorna gli stessi errori di AddTransaction, ErrExpired se la
+// transazione non può più entrare in un blocco, ErrInvalidScript se non
+// soddisfa lo script e, per i fondi degli HTLC, gli errori di checkHtlc
+func (bc *Blockchain) AddTransactionRequest(tr *transaction_request.TransactionRequest) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if *tr.SenderBlockchainAddress == MINING_SENDER {
+		log.Println("ERROR: coinbase transaction rejected")
+		return ErrInvalidSignature
+	}
+	return bc.addTransaction(tr.Transaction())
+}
+
+func (bc *Blockchain) addTransaction(t *blockchain_transaction.Transaction) error {
+	sender, value := t.SenderBlockchainAddress, t.Value
 
 	// Se il sender è il miner, non va confermata la transazione
 	if sender == MINING_SENDER {
 		bc.transactionPool = append([]*blockchain_transaction.Transaction{t}, bc.transactionPool...)
-		return true
+		return nil
 	}
 
-	// Se la firma della transazione viene verificata
-	if bc.VerifyTransactionSignature(senderPublicKey, s, t) {
-		// Controllo che il sender abbia i soldi che invia
-		/*
-		 */
-		if bc.CalculateTotalAmount(sender) < value {
-			// In caso negativo do errore
-			log.Println("ERROR: transaction rejected because sender doasn't have enough balance in wallet")
-			return false
+	// Un valore negativo toglierebbe soldi al recipient, le
+	// transazioni dei contratti e dei token non inviano fondi
+	if (t.Contract != nil || t.Asset != nil) && value != 0 {
+		log.Println("ERROR: contract or asset transaction rejected because value is not 0")
+		return ErrInvalidValue
+	}
+	if t.Contract == nil && t.Asset == nil && !(value > 0) {
+		log.Println("ERROR: transaction rejected because value is not positive")
+		return ErrInvalidValue
+	}
+
+	// Una firma vale solo sulla rete per cui è stata fatta
+	if t.ChainID != bc.chainID {
+		log.Printf("ERROR: transaction for chain %q rejected", t.ChainID)
+		return ErrWrongChain
+	}
+
+	// Se la firma della transazione non viene verificata do errore:
+	// i fondi degli HTLC si spendono con il contratto, quelli degli
+	// script con lo script di sblocco, gli account multisig firmano con
+	// il witness, gli altri con la chiave del sender, che deve essere
+	// quella del suo address
+	if htlc.IsAddress(sender) || t.Htlc != nil {
+		if err := bc.checkHtlc(t); err != nil {
+			log.Printf("ERROR: Verify HTLC spend: %v", err)
+			return err
 		}
-		// Aggiungi la transazione al transaction Pool
-		bc.transactionPool = append(bc.transactionPool, t)
-		return true
+	} else if script.IsAddress(sender) || t.Script != nil {
+		if err := verifyScript(t); err != nil {
+			log.Printf("ERROR: Verify script spend: %v", err)
+			return fmt.Errorf("%w: %v", ErrInvalidScript, err)
+		}
+	} else if multisig.IsAddress(sender) || t.Witness != nil {
+		if err := verifyWitness(t); err != nil {
+			log.Printf("ERROR: Verify Transaction: %v", err)
+			return ErrInvalidSignature
+		}
+	} else if err := bc.verifySignature(t); err != nil {
+		log.Printf("ERROR: Verify Transaction: %v", err)
+		return ErrInvalidSignature
+	}
 
-		// In caso contrario errore
-	} else {
-		log.Println("ERROR: Verify Transaction")
+	// Lo stesso payload firmato entra una volta sola, chi vuole
+	// ripetere una transazione la firma con un altro nonce
+	if bc.replayed(t) {
+		log.Println("ERROR: transaction rejected because it is already in the chain or in the pool")
+		return ErrReplayed
 	}
-	return false
+
+	// Una transazione scaduta non entrerebbe mai in un blocco, una non
+	// ancora valida resta nel pool finché non lo diventa
+	if t.Expired(len(bc.chain), medianTimePast(bc.chain)) {
+		log.Println("ERROR: transaction rejected because it is expired")
+		return ErrExpired
+	}
+
+	// Controllo che il sender abbia i soldi che invia, tolti quelli
+	// che spende con le transazioni già nel pool
+	if bc.availableAmount(sender) < value {
+		// In caso negativo do errore
+		log.Println("ERROR: transaction rejected because sender doasn't have enough balance in wallet")
+		return ErrInsufficientBalance
+	}
+	// La transazione di un contratto o di un token deve riuscire sullo
+	// stato
+	if err := bc.checkState(t); err != nil {
+		log.Printf("ERROR: %v", err)
+		return err
+	}
+	// Aggiungi la transazione al transaction Pool
+	bc.transactionPool = append(bc.transactionPool, t)
+	bc.publishAccepted(t)
+	return nil
 }
 
 // Metodo per aggiungere una transazione al transactionPool
 func (bc *Blockchain) AddCoinbaseTransaction(sender string, recipient string, value float32) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
 	t := blockchain_transaction.NewTransaction(sender, recipient, value)
 	bc.transactionPool = append([]*blockchain_transaction.Transaction{t}, bc.transactionPool...)
 }
 
 // Metodo per copiatre il transaction pool
 func (bc *Blockchain) CopyTransactionPool() []*blockchain_transaction.Transaction {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.copyTransactionPool()
+}
+
+func (bc *Blockchain) copyTransactionPool() []*blockchain_transaction.Transaction {
 	// Creo array di transazioni vuoto
 	transactions := make([]*blockchain_transaction.Transaction, 0)
 	// Per ogni transazione nel transactionPool della blockchain
 	for _, t := range bc.transactionPool {
 		// Aggiungo all'array transactions la transazione
-		transactions = append(transactions,
-			blockchain_transaction.NewTransaction(
-				t.SenderBlockchainAddress,
-				t.RecipientBlockchainAddress,
-				t.Value))
+		c := *t
+		transactions = append(transactions, &c)
 	}
 	// Ritorno l'array popolato
 	return transactions
 }
 
 // Metodo di *Blockchain per
-// Prende come parametri i dati di un blocco (nonce, previousHash, transactions[]) più la difficoltà
+// Prende come parametri i dati di un blocco (nonce, previousHash, stateRoot, transactions[]) più la difficoltà
 // Ritorna true o false
-func (bc *Blockchain) ValidProof(timestamp int64, nonce int, previousHash [32]byte, transactions []*blockchain_transaction.Transaction, difficulty int) bool {
+func (bc *Blockchain) ValidProof(timestamp int64, nonce int, previousHash [32]byte, stateRoot [32]byte, transactions []*blockchain_transaction.Transaction, difficulty int) bool {
 	// In base alla difficoltà viene scelto il numero di zeri che deve avere l'hash del blocco'
 	zeros := strings.Repeat("0", difficulty)
 	// Blocco da indovinare
@@ -258,6 +436,7 @@ func (bc *Blockchain) ValidProof(timestamp int64, nonce int, previousHash [32]by
 		Timestamp:    timestamp,
 		Nonce:        nonce,
 		PreviousHash: previousHash,
+		StateRoot:    stateRoot,
 		Transactions: transactions,
 	}
 	// Hash del blocco
@@ -273,14 +452,23 @@ func (bc *Blockchain) ValidProof(timestamp int64, nonce int, previousHash [32]by
 // Metodo per *Blockchain, ritorna un int, il nonce
 func (bc *Blockchain) ProofOfWork(timestamp int64) int {
 	// Si crea la copia delle transazioni del transaction pool
-	transactions := bc.CopyTransactionPool()
-	// Si recupera l'hash del blocco precedente
-	previousHash := bc.LastBlock().Hash()
+	// e si recupera l'hash del blocco precedente
+	bc.mux.RLock()
+	transactions := bc.copyTransactionPool()
+	previousHash := bc.lastBlock().Hash()
+	stateRoot := bc.pendingState().root()
+	bc.mux.RUnlock()
+	return bc.proofOfWork(timestamp, previousHash, stateRoot, transactions)
+}
+
+// La proof of work si fa senza lock, così chi legge la catena
+// non aspetta la fine del mining
+func (bc *Blockchain) proofOfWork(timestamp int64, previousHash [32]byte, stateRoot [32]byte, transactions []*blockchain_transaction.Transaction) int {
 	// Si parte da nonce = 0
 	nonce := 0
 	// Si calcola l'hash del nuovo blocco richiamando il metodo ValidProof, se non ritorna
 	// true si aumenta di 1 il nonce e si riprova, fin quando il target non viene raggiunto
-	for !bc.ValidProof(timestamp, nonce, previousHash, transactions, MINING_DIFFICULTY) {
+	for !bc.ValidProof(timestamp, nonce, previousHash, stateRoot, transactions, MINING_DIFFICULTY) {
 		nonce += 1
 	}
 	log.Println("Nonce found!")
@@ -289,16 +477,11 @@ func (bc *Blockchain) ProofOfWork(timestamp int64) int {
 }
 
 // Metodo di Blockchain per il mining
-func (bc *Blockchain) Mining() bool {
-	// Mutex permette di bloccare una parte di codice per far sì che
-	// venga eseguita da una sola goroutine alla volta
-	bc.mux.Lock()
-	// Con defer, sì fa si che l'esecuzione di uno statement sia
-	// differita fino al return della funzione
-	// In sostanza rendo sincrono ogni cosa che avviene
-	// dentro alla funzione di mining
-	defer bc.mux.Unlock()
-
+// Le transazioni del blocco si prendono dal transaction pool con il
+// lock, la proof of work si fa senza, e il blocco viene aggiunto solo
+// se nel frattempo la catena non è cambiata
+// Ritorna ErrStaleBlock se un altro blocco è arrivato prima
+func (bc *Blockchain) Mining() error {
 	// Se il transaction pool è vuoto, non mino il blocco
 	/*
 		Commento questa parte, così si può minare anche senza transazioni
@@ -308,36 +491,147 @@ func (bc *Blockchain) Mining() bool {
 		}
 
 	*/
-	// Tempo
-	timestamp := time.Now().UnixNano()
-	// Creo transazione coinbasem passando i dati
-	bc.AddTransaction(MINING_SENDER, bc.blockchainAddress, MINING_REWARD, nil, nil)
+	bc.mux.RLock()
+	// Tempo, almeno dopo la mediana degli ultimi blocchi, che è quella
+	// con cui si controllano i limiti di validità delle transazioni
+	median := medianTimePast(bc.chain)
+	timestamp := bc.clock.Now().UnixNano()
+	if timestamp <= median {
+		timestamp = median + 1
+	}
+	// Transazioni del blocco, prima quella coinbase, poi quelle del
+	// pool che possono entrare nel blocco
+	// Le transazioni vengono applicate allo stato: quelle che
+	// falliscono, anche perché il sender non ha più i fondi, vengono
+	// scartate e quelle che superano il gas del blocco aspettano il
+	// prossimo
+	coinbase := blockchain_transaction.NewTransaction(MINING_SENDER, bc.blockchainAddress, MINING_REWARD)
+	transactions := []*blockchain_transaction.Transaction{coinbase}
+	state := bc.state.clone()
+	applyTransaction(state, coinbase, len(bc.chain))
+	failed := make(map[*blockchain_transaction.Transaction]bool)
+	var gas uint64
+	for _, t := range bc.transactionPool {
+		if !t.ValidAt(len(bc.chain), median) {
+			continue
+		}
+		if t.Contract != nil && gas+t.Contract.GasLimit > contract.MAX_BLOCK_GAS {
+			continue
+		}
+		if err := applyTransaction(state, t, len(bc.chain)); err != nil {
+			log.Printf("ERROR: transaction from %s dropped: %v", t.SenderBlockchainAddress, err)
+			failed[t] = true
+			continue
+		}
+		if t.Contract != nil {
+			gas += t.Contract.GasLimit
+		}
+		transactions = append(transactions, t)
+	}
+	previousHash := bc.lastBlock().Hash()
+	stateRoot := state.root()
+	bc.mux.RUnlock()
+
 	// Creo il nonce
 	log.Println("Start mining...")
-	nonce := bc.ProofOfWork(timestamp)
-	// Creo il nuovo blocco
-	previousHash := bc.LastBlock().Hash()
-	bc.CreateBlock(timestamp, nonce, previousHash)
+	nonce := bc.proofOfWork(timestamp, previousHash, stateRoot, transactions)
+
+	// Creo il nuovo blocco, se la catena non è cambiata
+	bc.mux.Lock()
+	if bc.lastBlock().Hash() != previousHash {
+		bc.mux.Unlock()
+		log.Println("action=mining, status=stale")
+		return ErrStaleBlock
+	}
+	b := block.NewBlock(timestamp, nonce, previousHash, transactions)
+	b.StateRoot = stateRoot
+	bc.chain = append(bc.chain, b)
+	bc.state = state
+	bc.removeFailed(failed)
+	bc.removeConfirmed([]*block.Block{b})
+	bc.removeExpired()
+	bc.publishBlocks(len(bc.chain) - 1)
+	bc.mux.Unlock()
 	log.Println("action=mining, status=success")
 
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/consensus", n)
-		client := &http.Client{}
-		req, _ := http.NewRequest("PUT", endpoint, nil)
-		resp, _ := client.Do(req)
-		log.Printf("%v", resp)
+	// Il nuovo blocco viene annunciato ai vicini
+	if bc.network != nil {
+		bc.network.BroadcastBlock(b)
+	}
+	return nil
+}
+
+// Metodo per avviare il mining in background: mina subito un blocco
+// e poi uno ogni MINING_TIMER_SEC, finché ctx non viene cancellato
+// o non viene chiamato StopMining
+// Ritorna false se il miner era già attivo
+func (bc *Blockchain) StartMining(ctx context.Context) bool {
+	bc.minerMux.Lock()
+	defer bc.minerMux.Unlock()
+	if bc.miner != nil {
+		return false
 	}
+	ctx, cancel := context.WithCancel(ctx)
+	m := &miner{cancel: cancel, done: make(chan struct{})}
+	bc.miner = m
+	go bc.miningLoop(ctx, m)
 	return true
 }
 
-func (bc *Blockchain) StartMining() {
-	bc.Mining()
-	_ = time.AfterFunc(time.Second*MINING_TIMER_SEC, bc.StartMining)
+// Goroutine del miner
+func (bc *Blockchain) miningLoop(ctx context.Context, m *miner) {
+	defer func() {
+		bc.minerMux.Lock()
+		if bc.miner == m {
+			bc.miner = nil
+		}
+		bc.minerMux.Unlock()
+		close(m.done)
+	}()
+	ticker := bc.clock.NewTicker(time.Second * MINING_TIMER_SEC)
+	defer ticker.Stop()
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		bc.Mining()
+		select {
+		case <-ticker.C():
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Metodo per fermare il mining in background, aspetta che il
+// blocco in corso sia finito
+func (bc *Blockchain) StopMining() {
+	bc.minerMux.Lock()
+	m := bc.miner
+	bc.minerMux.Unlock()
+	if m == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+}
+
+// Metodo che dice se il mining in background è attivo
+func (bc *Blockchain) IsMining() bool {
+	bc.minerMux.Lock()
+	defer bc.minerMux.Unlock()
+	return bc.miner != nil
 }
 
 // Metodo per calcolare il bilancio di un account
 // prende in input l'indirizzo dell'account di cui bisogna calcolare il bilancio
 func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.calculateTotalAmount(blockchainAddress)
+}
+
+func (bc *Blockchain) calculateTotalAmount(blockchainAddress string) float32 {
 	// Si setta inizialmente a zero
 	var totalAmount float32 = 0.0
 	// Per ogni blocco della blockchain
@@ -360,56 +654,57 @@ func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
 	return totalAmount
 }
 
+// Metodo che ritorna il bilancio dell'address dopo l'ultimo blocco
+// meno quello che invia con le transazioni del pool, va chiamato con
+// il lock
+func (bc *Blockchain) availableAmount(blockchainAddress string) float32 {
+	amount := bc.calculateTotalAmount(blockchainAddress)
+	for _, t := range bc.transactionPool {
+		if t.SenderBlockchainAddress == blockchainAddress {
+			amount -= t.Value
+		}
+	}
+	return amount
+}
+
 func (bc *Blockchain) ValidChain(chain []*block.Block) bool {
+	_, ok := bc.validChain(chain)
+	return ok
+}
+
+// Metodo che valida la catena e ritorna lo stato dei contratti e dei
+// token dopo l'ultimo blocco
+func (bc *Blockchain) validChain(chain []*block.Block) (*chainState, bool) {
 	log.Println("Validating blockchain...")
 
+	// La catena deve partire dalla stessa genesis
+	if len(chain) == 0 || chain[0].Hash() != bc.genesisHash {
+		return nil, false
+	}
+	state := newChainState()
+
 	preBlock := chain[0]
 	currentIndex := 1
 	for currentIndex < len(chain) {
 		// PREVIOUS HASH NON FUNZIONA
 		b := chain[currentIndex]
 
-		if b.PreviousHash != preBlock.Hash() {
-			return false
+		if b.PreviousHash != preBlock.Hash() || !bc.wellFormed(b, chain[:currentIndex]) {
+			return nil, false
 		}
 
-		if !bc.ValidProof(b.Timestamp, b.Nonce, b.PreviousHash, b.Transactions, MINING_DIFFICULTY) {
-			return false
+		if !bc.ValidProof(b.Timestamp, b.Nonce, b.PreviousHash, b.StateRoot, b.Transactions, MINING_DIFFICULTY) {
+			return nil, false
+		}
+		var err error
+		if state, err = applyBlock(state, b, currentIndex); err != nil {
+			log.Printf("ERROR: block %d: %v", currentIndex, err)
+			return nil, false
 		}
 		preBlock = b
 		currentIndex += 1
 	}
-	return true
-}
-
-func (bc *Blockchain) ResolveConflicts() bool {
-	var longestChain []*block.Block = nil
-	maxLength := len(bc.chain)
-
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/chain", n)
-		resp, _ := http.Get(endpoint)
-		if resp.StatusCode == 200 {
-			var bcResp Blockchain
-			decoder := json.NewDecoder(resp.Body)
-			_ = decoder.Decode(&bcResp)
-
-			chain := bcResp.Chain()
-
-			if len(chain) > maxLength && bc.ValidChain(chain) {
-				maxLength = len(chain)
-				longestChain = chain
-			}
-		}
-	}
-
-	if longestChain != nil {
-		bc.chain = longestChain
-		log.Printf("Resolve conflicts replaced")
-		return true
-	}
-	log.Printf("Resolve conflicts not replaced")
-	return false
+	return state, true
 }
 
 // Metodo per verificare la signature di una transazione
@@ -417,15 +712,22 @@ func (bc *Blockchain) ResolveConflicts() bool {
 // 1- Public Key del sender della transazione
 // 2- Signature generata dal sender attraverso la sua chiave privata
 // 3- La transazione firmata
-// Ritorna un bool
+// Ritorna un bool, false anche se la chiave non è quella dell'address
+// del sender, altrimenti chiunque potrebbe firmare per lui
 func (bc *Blockchain) VerifyTransactionSignature(
 	senderPublicKey *ecdsa.PublicKey,
 	s *utils.Signature,
 	t *blockchain_transaction.Transaction) bool {
-	// Faccio json della transazione
-	m, _ := json.Marshal(t)
+	if !senderPublicKey.Curve.IsOnCurve(senderPublicKey.X, senderPublicKey.Y) {
+		return false
+	}
+	if wallet.AddressFromPublicKey(senderPublicKey) != t.SenderBlockchainAddress {
+		return false
+	}
+	// Faccio json della transazione, senza witness
+	m := t.SigningPayload()
 	// Calcolo l'hash del json della transazione
-	h := sha256.Sum256([]byte(m))
+	h := sha256.Sum256(m)
 	// Uso funzione della libreria ecdsa
 	// Devo passare:
 	// - chiave pubblica sender
@@ -434,3 +736,33 @@ func (bc *Blockchain) VerifyTransactionSignature(
 	// - S (da signature)
 	return ecdsa.Verify(senderPublicKey, h[:], s.R, s.S)
 }
+
+// Metodo che verifica la chiave pubblica e la firma che la transazione
+// di un address normale porta con sé, nella richiesta o nel blocco
+func (bc *Blockchain) verifySignature(t *blockchain_transaction.Transaction) error {
+	if !utils.IsHex256Pair(t.SenderPublicKey) {
+		return errors.New("missing or invalid sender public key")
+	}
+	if !utils.IsHex256Pair(t.Signature) {
+		return errors.New("missing or invalid signature")
+	}
+	if !bc.VerifyTransactionSignature(utils.PublicKeyFromString(t.SenderPublicKey), utils.SignatureFromString(t.Signature), t) {
+		return errors.New("signature does not match the sender")
+	}
+	return nil
+}
+
+// Funzione che verifica il witness di una transazione di un account
+// multisig, sui byte firmati che non lo contengono
+func verifyWitness(t *blockchain_transaction.Transaction) error {
+	if !multisig.IsAddress(t.SenderBlockchainAddress) {
+		return errors.New("witness of a sender that is not multisig")
+	}
+	if t.Witness == nil {
+		return errors.New("multisig transaction without witness")
+	}
+	if t.Script != nil {
+		return errors.New("multisig transaction with a script")
+	}
+	return t.Witness.Verify(t.SenderBlockchainAddress, t.SigningPayload())
+}
@@ -0,0 +1,737 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+	wallet_transaction "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+)
+
+// I log della blockchain si vedono solo con -v
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// Funzione che crea la richiesta di una transazione firmata dal wallet
+func signedRequest(w *wallet.Wallet, recipient string, value float32) *transaction_request.TransactionRequest {
+	sender := w.BlockchainAddress()
+	publicKey := w.PublicKeyStr()
+	chainID, nonce := DEFAULT_CHAIN_ID, blockchain_transaction.NewNonce()
+	transaction := wallet_transaction.NewTransaction(w.PrivateKey(), w.PublicKey(), sender, recipient, value)
+	transaction.SetChainID(chainID)
+	transaction.SetNonce(nonce)
+	signature := transaction.GenerateSignature().String()
+	return &transaction_request.TransactionRequest{
+		SenderBlockchainAddress:    &sender,
+		RecipientBlockchainAddress: &recipient,
+		SenderPublicKey:            &publicKey,
+		Value:                      &value,
+		ChainID:                    &chainID,
+		Nonce:                      &nonce,
+		Signature:                  &signature,
+	}
+}
+
+// Funzione che firma la transazione con la chiave del wallet, che può
+// non essere quella del sender, per DEFAULT_CHAIN_ID se la transazione
+// non ha già un chain ID
+func sign(t *testing.T, w *wallet.Wallet, tx *blockchain_transaction.Transaction) *blockchain_transaction.Transaction {
+	t.Helper()
+	if tx.ChainID == "" {
+		tx.ChainID = DEFAULT_CHAIN_ID
+	}
+	h := sha256.Sum256(tx.SigningPayload())
+	r, s, err := ecdsa.Sign(rand.Reader, w.PrivateKey(), h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.SenderPublicKey = w.PublicKeyStr()
+	tx.Signature = (&utils.Signature{R: r, S: s}).String()
+	return tx
+}
+
+// Funzione che crea la transazione di un'operazione su un token
+func assetTransaction(sender string, recipient string, op *asset.Operation) *blockchain_transaction.Transaction {
+	tx := blockchain_transaction.NewTransaction(sender, recipient, 0)
+	tx.Asset = op
+	return tx
+}
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Funzione che mina, come farebbe un peer, un blocco in cima alla
+// catena con la coinbase, le transazioni e lo state root che ne risulta
+func peerBlock(bc *Blockchain, miner string, transactions ...*blockchain_transaction.Transaction) *block.Block {
+	coinbase := blockchain_transaction.NewTransaction(MINING_SENDER, miner, MINING_REWARD)
+	return rawBlock(bc, append([]*blockchain_transaction.Transaction{coinbase}, transactions...)...)
+}
+
+// Funzione che mina un blocco in cima alla catena con esattamente le
+// transazioni date, anche senza la coinbase
+func rawBlock(bc *Blockchain, transactions ...*blockchain_transaction.Transaction) *block.Block {
+	return timedBlock(bc, bc.clock.Now().UnixNano(), transactions...)
+}
+
+// Funzione che mina un blocco in cima alla catena con il timestamp e
+// le transazioni dati
+func timedBlock(bc *Blockchain, timestamp int64, transactions ...*blockchain_transaction.Transaction) *block.Block {
+	state := bc.state.clone()
+	for _, tx := range transactions {
+		applyTransaction(state, tx, bc.Height()+1)
+	}
+	previousHash := bc.LastBlock().Hash()
+	b := block.NewBlock(timestamp, bc.proofOfWork(timestamp, previousHash, state.root(), transactions), previousHash, transactions)
+	b.StateRoot = state.root()
+	return b
+}
+
+// Funzione che crea una blockchain e le fa minare n blocchi
+func minedBlockchain(t *testing.T, miner *wallet.Wallet, n int) *Blockchain {
+	t.Helper()
+	bc := NewBlockchain(miner.BlockchainAddress(), 5000, DEFAULT_CHAIN_ID)
+	for i := 0; i < n; i++ {
+		if err := bc.Mining(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return bc
+}
+
+// Due transazioni che insieme superano il bilancio: la seconda non
+// entra nel pool, così il blocco non spende più di quello che c'è
+func TestPoolDoubleSpend(t *testing.T) {
+	miner, recipient := wallet.NewWallet(), wallet.NewWallet()
+	bc := minedBlockchain(t, miner, 1)
+	if err := bc.AddTransactionRequest(signedRequest(miner, recipient.BlockchainAddress(), 0.6)); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransactionRequest(signedRequest(miner, recipient.BlockchainAddress(), 0.6)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("second spend: %v, expected %v", err, ErrInsufficientBalance)
+	}
+	if err := bc.Mining(); err != nil {
+		t.Fatal(err)
+	}
+	if amount := bc.CalculateTotalAmount(recipient.BlockchainAddress()); amount != 0.6 {
+		t.Fatalf("recipient has %v, expected 0.6", amount)
+	}
+	if amount := bc.CalculateTotalAmount(miner.BlockchainAddress()); amount != 2*MINING_REWARD-0.6 {
+		t.Fatalf("miner has %v, expected %v", amount, 2*MINING_REWARD-0.6)
+	}
+}
+
+// Transazioni, mining, sostituzione della catena e letture da molte
+// goroutine insieme: la catena resta collegata, la catena più lunga
+// ricevuta vince e nessuna transazione resta nel pool dopo essere
+// entrata in un blocco
+// Va eseguito anche con go test -race
+func TestConcurrentAccess(t *testing.T) {
+	const (
+		senders       = 8
+		txsPerSender  = 5
+		miners        = 2
+		blocksPerMine = 2
+		readers       = 4
+		peerHeight    = 6
+	)
+	miner := wallet.NewWallet()
+	bc := minedBlockchain(t, miner, 2)
+	// Catena più lunga di un altro nodo, con lo stesso blocco genesi
+	peer := minedBlockchain(t, wallet.NewWallet(), peerHeight)
+	peerChain := peer.Chain()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	errs := make(chan error, senders*txsPerSender+miners*blocksPerMine+peerHeight+readers)
+
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < txsPerSender; j++ {
+				err := bc.AddTransactionRequest(signedRequest(miner, wallet.NewWallet().BlockchainAddress(), 0.1))
+				// Dopo la sostituzione della catena il miner non ha più fondi
+				if err != nil && !errors.Is(err, ErrInsufficientBalance) {
+					errs <- err
+				}
+			}
+		}()
+	}
+	for i := 0; i < miners; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < blocksPerMine; j++ {
+				if err := bc.Mining(); err != nil && !errors.Is(err, ErrStaleBlock) {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 2; n <= len(peerChain); n++ {
+			if _, err := bc.ReplaceChain(peerChain[:n]); err != nil {
+				errs <- err
+			}
+		}
+	}()
+
+	var readersWg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		readersWg.Add(1)
+		go func() {
+			defer readersWg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				chain := bc.Chain()
+				for h := 1; h < len(chain); h++ {
+					if chain[h].PreviousHash != chain[h-1].Hash() {
+						errs <- errors.New("chain read with a broken link")
+						return
+					}
+				}
+				seen := make(map[interface{}]bool)
+				for _, tx := range bc.TransactionPool() {
+					if seen[tx] {
+						errs <- errors.New("transaction twice in the pool")
+						return
+					}
+					seen[tx] = true
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	readersWg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	chain := bc.Chain()
+	if len(chain)-1 < peerHeight {
+		t.Fatalf("height %d, expected at least the %d of the longer chain", len(chain)-1, peerHeight)
+	}
+	if chain[0].Hash() != peerChain[0].Hash() {
+		t.Fatal("genesis block changed")
+	}
+	for h := 1; h < len(chain); h++ {
+		if chain[h].PreviousHash != chain[h-1].Hash() {
+			t.Fatalf("block %d does not link to block %d", h, h-1)
+		}
+	}
+	confirmed := make(map[interface{}]bool)
+	for _, b := range chain {
+		for _, tx := range b.Transactions {
+			if confirmed[tx] {
+				t.Fatal("transaction confirmed twice")
+			}
+			confirmed[tx] = true
+		}
+	}
+	for _, tx := range bc.TransactionPool() {
+		if confirmed[tx] {
+			t.Fatal("confirmed transaction still in the pool")
+		}
+	}
+}
+
+// La chiave pubblica deve essere quella dell'address del sender: una
+// firma valida con un'altra chiave non basta, e le transazioni coinbase
+// non si possono inviare
+func TestSenderKeyBinding(t *testing.T) {
+	alice, mallory := wallet.NewWallet(), wallet.NewWallet()
+	bc := minedBlockchain(t, alice, 1)
+
+	forged := signedRequest(mallory, mallory.BlockchainAddress(), 0.5)
+	sender := alice.BlockchainAddress()
+	forged.SenderBlockchainAddress = &sender
+	signature := wallet_transaction.NewTransaction(mallory.PrivateKey(), mallory.PublicKey(), sender, mallory.BlockchainAddress(), 0.5).GenerateSignature().String()
+	forged.Signature = &signature
+	if err := bc.AddTransactionRequest(forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("transaction signed by another key: %v, expected %v", err, ErrInvalidSignature)
+	}
+	if bc.VerifyTransactionSignature(mallory.PublicKey(), utils.SignatureFromString(signature), forged.Transaction()) {
+		t.Fatal("signature verified with a key of another address")
+	}
+
+	coinbase := signedRequest(mallory, mallory.BlockchainAddress(), 100)
+	miningSender := MINING_SENDER
+	coinbase.SenderBlockchainAddress = &miningSender
+	if err := bc.AddTransactionRequest(coinbase); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("coinbase transaction: %v, expected %v", err, ErrInvalidSignature)
+	}
+
+	if err := bc.AddTransactionRequest(signedRequest(alice, mallory.BlockchainAddress(), 0.5)); err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.TransactionPool()) != 1 {
+		t.Fatalf("%d transactions in the pool, expected 1", len(bc.TransactionPool()))
+	}
+}
+
+// Le transazioni dei blocchi ricevuti portano chiave e firma: un blocco
+// che sposta i token di un address senza la sua firma viene rifiutato
+// anche se la proof of work e lo state root sono validi, e i saldi dei
+// token fanno parte dello state root
+func TestBlockSignatures(t *testing.T) {
+	alice, mallory := wallet.NewWallet(), wallet.NewWallet()
+	bc := minedBlockchain(t, alice, 1)
+	issue := sign(t, alice, assetTransaction(alice.BlockchainAddress(), alice.BlockchainAddress(), &asset.Operation{Type: asset.ISSUE, Asset: "GOLD", Amount: 100, Name: "Gold"}))
+	issued := peerBlock(bc, mallory.BlockchainAddress(), issue)
+	if issued.StateRoot == [32]byte{} {
+		t.Fatal("state root does not cover the assets")
+	}
+	if err := bc.AddBlock(issued); err != nil {
+		t.Fatal(err)
+	}
+	if tx := bc.LastBlock().Transactions[1]; tx.SenderPublicKey != alice.PublicKeyStr() || tx.Signature != issue.Signature {
+		t.Fatal("block transaction without the public key and the signature")
+	}
+
+	transfer := func() *blockchain_transaction.Transaction {
+		return assetTransaction(alice.BlockchainAddress(), mallory.BlockchainAddress(), &asset.Operation{Type: asset.TRANSFER, Asset: "GOLD", Amount: 100})
+	}
+	forged := map[string]*blockchain_transaction.Transaction{
+		"unsigned":          transfer(),
+		"signed by another": sign(t, mallory, transfer()),
+		"signature of another transaction": func() *blockchain_transaction.Transaction {
+			tx := sign(t, alice, transfer())
+			tx.Asset = &asset.Operation{Type: asset.TRANSFER, Asset: "GOLD", Amount: 99}
+			return tx
+		}(),
+	}
+	for name, tx := range forged {
+		b := peerBlock(bc, mallory.BlockchainAddress(), tx)
+		if err := bc.AddBlock(b); !errors.Is(err, ErrInvalidBlock) {
+			t.Fatalf("%s: %v, expected %v", name, err, ErrInvalidBlock)
+		}
+		if _, err := bc.ReplaceChain(append(bc.Chain(), b)); !errors.Is(err, ErrInvalidChain) {
+			t.Fatalf("%s: %v, expected %v", name, err, ErrInvalidChain)
+		}
+	}
+	if err := bc.Restore(bc.Chain(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if balance, _ := bc.CalculateAssetAmount(mallory.BlockchainAddress(), "GOLD"); balance != 0 {
+		t.Fatalf("mallory holds %d GOLD", balance)
+	}
+
+	// Un blocco con lo state root dei soli contratti non è valido
+	valid := peerBlock(bc, mallory.BlockchainAddress(), sign(t, alice, transfer()))
+	stale := *valid
+	stale.StateRoot = bc.state.contracts.Root()
+	stale.Nonce = bc.proofOfWork(stale.Timestamp, stale.PreviousHash, stale.StateRoot, stale.Transactions)
+	if err := bc.AddBlock(&stale); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("block without the assets in the state root: %v, expected %v", err, ErrInvalidBlock)
+	}
+	if err := bc.AddBlock(valid); err != nil {
+		t.Fatal(err)
+	}
+	if balance, _ := bc.CalculateAssetAmount(mallory.BlockchainAddress(), "GOLD"); balance != 100 {
+		t.Fatalf("mallory holds %d GOLD, expected 100", balance)
+	}
+}
+
+// Funzione che crea la richiesta di una transazione già firmata, come
+// arriverebbe da un peer
+func requestOf(tx *blockchain_transaction.Transaction) *transaction_request.TransactionRequest {
+	return &transaction_request.TransactionRequest{
+		SenderBlockchainAddress:    &tx.SenderBlockchainAddress,
+		RecipientBlockchainAddress: &tx.RecipientBlockchainAddress,
+		SenderPublicKey:            &tx.SenderPublicKey,
+		Value:                      &tx.Value,
+		ChainID:                    &tx.ChainID,
+		Nonce:                      &tx.Nonce,
+		Signature:                  &tx.Signature,
+		Contract:                   tx.Contract,
+	}
+}
+
+// Una chiamata firmata a un contratto entra una volta sola: inviarla
+// di nuovo non la esegue una seconda volta, né dal pool né in un
+// blocco, mentre la stessa chiamata con un altro nonce sì
+func TestContractCallReplay(t *testing.T) {
+	alice := wallet.NewWallet()
+	bc := minedBlockchain(t, alice, 1)
+	code, err := contract.Assemble(`"count" DUP SLOAD 1 ADD DUP ROT SWAP SSTORE RETURN`)
+	check(t, err)
+	address := contract.Address(alice.BlockchainAddress(), code)
+	deploy := blockchain_transaction.NewTransaction(alice.BlockchainAddress(), address, 0)
+	deploy.Contract = &contract.Message{Code: hex.EncodeToString(code), GasLimit: 100000}
+	check(t, bc.AddBlock(peerBlock(bc, alice.BlockchainAddress(), sign(t, alice, deploy))))
+
+	call := func() *blockchain_transaction.Transaction {
+		tx := blockchain_transaction.NewTransaction(alice.BlockchainAddress(), address, 0)
+		tx.Contract = &contract.Message{GasLimit: 10000}
+		tx.Nonce = blockchain_transaction.NewNonce()
+		return sign(t, alice, tx)
+	}
+	count := func() string {
+		t.Helper()
+		result, err := bc.CallContract(address, alice.BlockchainAddress(), nil, 10000)
+		check(t, err)
+		return result.Return
+	}
+
+	first := call()
+	check(t, bc.AddTransactionRequest(requestOf(first)))
+	check(t, bc.Mining())
+	afterFirst := count()
+	if err := bc.AddTransactionRequest(requestOf(first)); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("replayed call: %v, expected %v", err, ErrReplayed)
+	}
+	if err := bc.AddBlock(peerBlock(bc, alice.BlockchainAddress(), first)); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("block with a replayed call: %v, expected %v", err, ErrInvalidBlock)
+	}
+	if count() != afterFirst {
+		t.Fatal("the replayed call ran again")
+	}
+
+	check(t, bc.AddTransactionRequest(requestOf(call())))
+	check(t, bc.Mining())
+	if count() == afterFirst {
+		t.Fatal("a new call with another nonce did not run")
+	}
+}
+
+// CALLER è il sender della transazione, quindi chi chiama un contratto
+// a nome di un altro address deve avere la sua chiave, sia nel pool
+// sia nei blocchi ricevuti, e le coinbase non chiamano contratti
+func TestContractCaller(t *testing.T) {
+	alice, mallory := wallet.NewWallet(), wallet.NewWallet()
+	bc := minedBlockchain(t, alice, 1)
+	code, err := contract.Assemble(`"owner" CALLER SSTORE STOP`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := contract.Address(alice.BlockchainAddress(), code)
+	deploy := blockchain_transaction.NewTransaction(alice.BlockchainAddress(), address, 0)
+	deploy.Contract = &contract.Message{Code: hex.EncodeToString(code), GasLimit: 100000}
+	if err := bc.AddBlock(peerBlock(bc, alice.BlockchainAddress(), sign(t, alice, deploy))); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(sender string) *blockchain_transaction.Transaction {
+		tx := blockchain_transaction.NewTransaction(sender, address, 0)
+		tx.Contract = &contract.Message{GasLimit: 10000}
+		return tx
+	}
+	forged := sign(t, mallory, call(alice.BlockchainAddress()))
+	if err := bc.AddTransactionRequest(requestOf(forged)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("call signed by another key: %v, expected %v", err, ErrInvalidSignature)
+	}
+	if err := bc.AddBlock(peerBlock(bc, mallory.BlockchainAddress(), forged)); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("block with a call signed by another key: %v, expected %v", err, ErrInvalidBlock)
+	}
+	if err := bc.AddBlock(peerBlock(bc, mallory.BlockchainAddress(), call(MINING_SENDER))); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("block with a coinbase call: %v, expected %v", err, ErrInvalidBlock)
+	}
+	info, err := bc.Contract(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Storage) != 0 {
+		t.Fatalf("storage changed by a forged call: %v", info.Storage)
+	}
+
+	if err := bc.AddTransactionRequest(requestOf(sign(t, alice, call(alice.BlockchainAddress())))); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Mining(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ = bc.Contract(address); info.Storage[hex.EncodeToString([]byte("owner"))] != hex.EncodeToString([]byte(alice.BlockchainAddress())) {
+		t.Fatalf("storage %v, expected the address of the signer as owner", info.Storage)
+	}
+}
+
+// Un peer non può coniare moneta: ogni blocco ha una sola coinbase, la
+// prima transazione, con la ricompensa, e un blocco che non la rispetta
+// non entra né da solo né con la catena
+func TestCoinbaseRule(t *testing.T) {
+	miner, mallory := wallet.NewWallet(), wallet.NewWallet()
+	bc := minedBlockchain(t, miner, 1)
+	coinbase := func(value float32) *blockchain_transaction.Transaction {
+		return blockchain_transaction.NewTransaction(MINING_SENDER, mallory.BlockchainAddress(), value)
+	}
+	inflated := map[string]*block.Block{
+		"inflated reward":    rawBlock(bc, coinbase(1000)),
+		"two coinbases":      rawBlock(bc, coinbase(MINING_REWARD), coinbase(MINING_REWARD)),
+		"no coinbase":        rawBlock(bc),
+		"coinbase not first": rawBlock(bc, sign(t, miner, blockchain_transaction.NewTransaction(miner.BlockchainAddress(), mallory.BlockchainAddress(), 0.5)), coinbase(MINING_REWARD)),
+	}
+	for name, b := range inflated {
+		if err := bc.AddBlock(b); !errors.Is(err, ErrInvalidBlock) {
+			t.Fatalf("%s: %v, expected %v", name, err, ErrInvalidBlock)
+		}
+		if _, err := bc.ReplaceChain(append(bc.Chain(), b)); !errors.Is(err, ErrInvalidChain) {
+			t.Fatalf("%s: %v, expected %v", name, err, ErrInvalidChain)
+		}
+	}
+	if amount := bc.CalculateTotalAmount(mallory.BlockchainAddress()); amount != 0 {
+		t.Fatalf("mallory has %v", amount)
+	}
+	if err := bc.AddBlock(rawBlock(bc, coinbase(MINING_REWARD))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// I bilanci dei blocchi ricevuti vengono controllati: un sender non
+// spende monete che non ha, né con valori negativi, né spendendole
+// due volte nello stesso blocco
+func TestBlockOverdraft(t *testing.T) {
+	miner, alice, bob := wallet.NewWallet(), wallet.NewWallet(), wallet.NewWallet()
+	bc := minedBlockchain(t, miner, 1)
+	send := func(from *wallet.Wallet, to *wallet.Wallet, value float32) *blockchain_transaction.Transaction {
+		return sign(t, from, blockchain_transaction.NewTransaction(from.BlockchainAddress(), to.BlockchainAddress(), value))
+	}
+	overdrafts := map[string]*block.Block{
+		"empty balance":  peerBlock(bc, bob.BlockchainAddress(), send(alice, bob, 5)),
+		"above balance":  peerBlock(bc, bob.BlockchainAddress(), send(miner, bob, MINING_REWARD+1)),
+		"negative value": peerBlock(bc, bob.BlockchainAddress(), send(alice, miner, -5)),
+		"spent twice":    peerBlock(bc, bob.BlockchainAddress(), send(miner, bob, 0.6), send(miner, alice, 0.6)),
+	}
+	for name, b := range overdrafts {
+		if err := bc.AddBlock(b); !errors.Is(err, ErrInvalidBlock) {
+			t.Fatalf("%s: %v, expected %v", name, err, ErrInvalidBlock)
+		}
+		if _, err := bc.ReplaceChain(append(bc.Chain(), b)); !errors.Is(err, ErrInvalidChain) {
+			t.Fatalf("%s: %v, expected %v", name, err, ErrInvalidChain)
+		}
+	}
+	if err := bc.AddBlock(peerBlock(bc, bob.BlockchainAddress(), send(miner, alice, 0.5), send(miner, bob, 0.5))); err != nil {
+		t.Fatal(err)
+	}
+	for address, expected := range map[string]float32{
+		miner.BlockchainAddress(): 0,
+		alice.BlockchainAddress(): 0.5,
+		bob.BlockchainAddress():   MINING_REWARD + 0.5,
+	} {
+		if amount := bc.CalculateTotalAmount(address); amount != expected {
+			t.Fatalf("balance of %s is %v, expected %v", address, amount, expected)
+		}
+	}
+}
+
+// Ogni rete ha il suo genesis: una catena minata su un'altra rete
+// non viene accettata, nemmeno se più lunga
+func TestChainIDGenesis(t *testing.T) {
+	miner := wallet.NewWallet()
+	a := NewBlockchain(miner.BlockchainAddress(), 5000, "net-a")
+	b := NewBlockchain(miner.BlockchainAddress(), 5000, "net-b")
+	if a.GenesisHash() == b.GenesisHash() {
+		t.Fatal("different networks share the genesis")
+	}
+	if same := NewBlockchain(miner.BlockchainAddress(), 5001, "net-a"); same.GenesisHash() != a.GenesisHash() {
+		t.Fatal("the same network has different genesis")
+	}
+	if err := b.Mining(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ReplaceChain(b.Chain()); !errors.Is(err, ErrInvalidChain) {
+		t.Fatalf("%v, expected %v", err, ErrInvalidChain)
+	}
+	if err := a.AddBlock(b.LastBlock()); !errors.Is(err, ErrOrphanBlock) {
+		t.Fatalf("%v, expected %v", err, ErrOrphanBlock)
+	}
+}
+
+// Il chain ID è nella firma: una transazione firmata per un'altra rete
+// non entra nel pool né in un blocco, e cambiare il chain ID di una
+// transazione firmata ne invalida la firma
+func TestWrongChainTransaction(t *testing.T) {
+	alice, bob := wallet.NewWallet(), wallet.NewWallet()
+	bc := minedBlockchain(t, alice, 1)
+
+	other := blockchain_transaction.NewTransaction(alice.BlockchainAddress(), bob.BlockchainAddress(), 0.5)
+	other.ChainID = "net-b"
+	other = sign(t, alice, other)
+	if err := bc.AddTransactionRequest(requestOf(other)); !errors.Is(err, ErrWrongChain) {
+		t.Fatalf("%v, expected %v", err, ErrWrongChain)
+	}
+	if err := bc.AddBlock(peerBlock(bc, alice.BlockchainAddress(), other)); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("%v, expected %v", err, ErrInvalidBlock)
+	}
+
+	other.ChainID = DEFAULT_CHAIN_ID
+	if err := bc.AddTransactionRequest(requestOf(other)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("%v, expected %v", err, ErrInvalidSignature)
+	}
+	if err := bc.AddBlock(peerBlock(bc, alice.BlockchainAddress(), other)); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("%v, expected %v", err, ErrInvalidBlock)
+	}
+	check(t, bc.AddTransactionRequest(signedRequest(alice, bob.BlockchainAddress(), 0.5)))
+}
+
+// Una transazione già inviata non si può inviare di nuovo, né così
+// com'è né con una nuova firma dello stesso payload, né nel pool né
+// in un blocco; lo stesso pagamento con un altro nonce è una nuova
+// transazione
+func TestReplay(t *testing.T) {
+	alice, bob := wallet.NewWallet(), wallet.NewWallet()
+	bc := minedBlockchain(t, alice, 2)
+	tr := signedRequest(alice, bob.BlockchainAddress(), 0.25)
+	check(t, bc.AddTransactionRequest(tr))
+	if err := bc.AddTransactionRequest(tr); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("replay in the pool: %v, expected %v", err, ErrReplayed)
+	}
+	check(t, bc.Mining())
+
+	sent := tr.Transaction()
+	if err := bc.AddTransactionRequest(tr); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("replay of a mined transaction: %v, expected %v", err, ErrReplayed)
+	}
+	resigned := sign(t, alice, tr.Transaction())
+	if resigned.Signature == sent.Signature || resigned.ID() != sent.ID() {
+		t.Fatal("signing again changed the payload or kept the signature")
+	}
+	if err := bc.AddTransactionRequest(requestOf(resigned)); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("replay with a new signature: %v, expected %v", err, ErrReplayed)
+	}
+	if err := bc.AddBlock(peerBlock(bc, alice.BlockchainAddress(), resigned)); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("block with a replay: %v, expected %v", err, ErrInvalidBlock)
+	}
+
+	again := signedRequest(alice, bob.BlockchainAddress(), 0.25).Transaction()
+	if err := bc.AddBlock(peerBlock(bc, alice.BlockchainAddress(), again, again)); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("block with a transaction twice: %v, expected %v", err, ErrInvalidBlock)
+	}
+	check(t, bc.AddBlock(peerBlock(bc, alice.BlockchainAddress(), again)))
+	if amount := bc.CalculateTotalAmount(bob.BlockchainAddress()); amount != 0.5 {
+		t.Fatalf("bob has %v, expected 0.5", amount)
+	}
+
+	// Se un blocco ricevuto ha la transazione del pool con un'altra
+	// firma, quella del pool non può più entrare e viene tolta
+	pending := signedRequest(alice, bob.BlockchainAddress(), 0.25)
+	check(t, bc.AddTransactionRequest(pending))
+	check(t, bc.AddBlock(peerBlock(bc, alice.BlockchainAddress(), sign(t, alice, pending.Transaction()))))
+	if pool := bc.TransactionPool(); len(pool) != 0 {
+		t.Fatalf("%d transactions left in the pool", len(pool))
+	}
+}
+
+// Il timestamp di un blocco deve superare la mediana degli ultimi
+// MEDIAN_TIME_BLOCKS e non essere troppo avanti rispetto all'orologio
+// del nodo, così un miner non può spostare il tempo delle transazioni
+func TestBlockTimestamps(t *testing.T) {
+	miner := wallet.NewWallet()
+	bc := NewBlockchain(miner.BlockchainAddress(), 5000, DEFAULT_CHAIN_ID)
+	c := clock.NewManual(time.Unix(0, bc.LastBlock().Timestamp).Add(time.Hour))
+	bc.SetClock(c)
+	for i := 0; i < 2*MEDIAN_TIME_BLOCKS; i++ {
+		c.Advance(time.Minute)
+		check(t, bc.Mining())
+	}
+	median := medianTimePast(bc.Chain())
+	if expected := bc.Chain()[len(bc.Chain())-MEDIAN_TIME_BLOCKS/2-1].Timestamp; median != expected {
+		t.Fatalf("median %d, expected %d", median, expected)
+	}
+	coinbase := blockchain_transaction.NewTransaction(MINING_SENDER, miner.BlockchainAddress(), MINING_REWARD)
+	now := c.Now()
+	rejected := map[string]int64{
+		"at the median":     median,
+		"before the median": median - int64(time.Second),
+		"too far ahead":     now.Add(MAX_FUTURE_BLOCK_TIME_SEC*time.Second + time.Second).UnixNano(),
+	}
+	for name, timestamp := range rejected {
+		b := timedBlock(bc, timestamp, coinbase)
+		if err := bc.AddBlock(b); !errors.Is(err, ErrInvalidBlock) {
+			t.Fatalf("%s: %v, expected %v", name, err, ErrInvalidBlock)
+		}
+		if _, err := bc.ReplaceChain(append(bc.Chain(), b)); !errors.Is(err, ErrInvalidChain) {
+			t.Fatalf("%s: %v, expected %v", name, err, ErrInvalidChain)
+		}
+	}
+	check(t, bc.AddBlock(timedBlock(bc, median+1, coinbase)))
+	check(t, bc.AddBlock(timedBlock(bc, now.Add(time.Minute).UnixNano(), coinbase)))
+
+	// Con l'orologio indietro il miner usa il primo timestamp valido
+	c = clock.NewManual(time.Unix(0, bc.LastBlock().Timestamp).Add(-time.Hour))
+	bc.SetClock(c)
+	median = medianTimePast(bc.Chain())
+	check(t, bc.Mining())
+	if timestamp := bc.LastBlock().Timestamp; timestamp != median+1 {
+		t.Fatalf("mined at %d, expected %d", timestamp, median+1)
+	}
+}
+
+// Il timeout in secondi di un HTLC si controlla con la mediana dei
+// blocchi: un miner che mette un timestamp dopo il timeout non può
+// rimborsare i fondi finché la mediana non lo raggiunge
+func TestHtlcTimeTimeout(t *testing.T) {
+	miner, bob := wallet.NewWallet(), wallet.NewWallet()
+	bc := NewBlockchain(miner.BlockchainAddress(), 5000, DEFAULT_CHAIN_ID)
+	c := clock.NewManual(time.Unix(0, bc.LastBlock().Timestamp).Add(time.Hour))
+	bc.SetClock(c)
+	check(t, bc.Mining())
+
+	_, hash, err := htlc.NewPreimage()
+	check(t, err)
+	timeout := c.Now().Add(10 * time.Minute).Unix()
+	contract, err := htlc.NewContract(miner.BlockchainAddress(), bob.BlockchainAddress(), hash, timeout)
+	check(t, err)
+	c.Advance(time.Minute)
+	check(t, bc.AddBlock(peerBlock(bc, miner.BlockchainAddress(), sign(t, miner, blockchain_transaction.NewTransaction(miner.BlockchainAddress(), contract.Address(), 0.5)))))
+
+	refund := blockchain_transaction.NewTransaction(contract.Address(), miner.BlockchainAddress(), 0.5)
+	refund.Htlc = &htlc.Spend{Contract: *contract}
+	refund.ValidAfter = timeout
+	refund.ChainID = DEFAULT_CHAIN_ID
+	c.Advance(11 * time.Minute)
+	if bc.HtlcStatus(contract).TimedOut {
+		t.Fatal("htlc timed out before the median time")
+	}
+	if err := bc.AddBlock(peerBlock(bc, miner.BlockchainAddress(), refund)); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("%v, expected %v", err, ErrInvalidBlock)
+	}
+
+	for medianTimePast(bc.Chain())/int64(time.Second) < timeout {
+		c.Advance(time.Minute)
+		check(t, bc.Mining())
+	}
+	if !bc.HtlcStatus(contract).TimedOut {
+		t.Fatal("htlc not timed out after the median time")
+	}
+	check(t, bc.AddBlock(peerBlock(bc, miner.BlockchainAddress(), refund)))
+	if amount := bc.CalculateTotalAmount(contract.Address()); amount != 0 {
+		t.Fatalf("htlc still holds %v", amount)
+	}
+}
@@ -0,0 +1,109 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+)
+
+var (
+	// La transazione non pubblica o non chiama un contratto in modo
+	// valido, o la chiamata fallisce
+	ErrContractFailed = errors.New("contract transaction failed")
+	// L'address non è di un contratto pubblicato
+	ErrContractNotFound = errors.New("contract not found")
+)
+
+// Contratto pubblicato, con il codice e lo storage in esadecimale
+type ContractInfo struct {
+	BlockchainAddress string            `json:"blockchain_address"`
+	Code              string            `json:"code"`
+	Storage           map[string]string `json:"storage"`
+}
+
+// Risultato di una chiamata in lettura, che non cambia lo stato
+type CallResult struct {
+	Return  string `json:"return"`
+	GasUsed uint64 `json:"gas_used"`
+}
+
+// Funzione che applica allo stato la transazione di un contratto del
+// blocco all'altezza height
+// Il sender è il CALLER della chiamata: la sua firma l'hanno già
+// verificata addTransaction, per il pool, o wellFormed, per i blocchi
+// ricevuti, e le transazioni coinbase, che nessuno firma, non possono
+// chiamare contratti
+func applyContract(state *contract.State, t *blockchain_transaction.Transaction, height int) error {
+	if t.SenderBlockchainAddress == MINING_SENDER {
+		return errors.New("coinbase transactions cannot call contracts")
+	}
+	if t.Value != 0 {
+		return errors.New("contract transactions have value 0")
+	}
+	if t.Htlc != nil || t.Asset != nil {
+		return errors.New("contract transaction with htlc or asset data")
+	}
+	_, err := state.Apply(&contract.Tx{
+		Sender:    t.SenderBlockchainAddress,
+		Recipient: t.RecipientBlockchainAddress,
+		Message:   t.Contract,
+		Height:    height,
+	})
+	return err
+}
+
+// Metodo che ritorna il contratto pubblicato all'address nell'ultimo
+// blocco, ErrContractNotFound se non c'è
+func (bc *Blockchain) Contract(address string) (*ContractInfo, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	a := bc.state.contracts.Account(address)
+	if a == nil {
+		return nil, ErrContractNotFound
+	}
+	return &ContractInfo{
+		BlockchainAddress: address,
+		Code:              hex.EncodeToString(a.Code),
+		Storage:           a.HexStorage(),
+	}, nil
+}
+
+// Metodo che esegue una chiamata sullo stato dell'ultimo blocco senza
+// cambiarlo, come se entrasse nel prossimo blocco
+// Ritorna ErrContractNotFound o, se la chiamata fallisce,
+// ErrContractFailed
+func (bc *Blockchain) CallContract(address string, caller string, args [][]byte, gasLimit uint64) (*CallResult, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	r, err := bc.state.contracts.Call(address, caller, args, len(bc.chain), gasLimit)
+	if err == contract.ErrNotFound {
+		return nil, ErrContractNotFound
+	}
+	if err != nil {
+		log.Printf("ERROR: call of contract %s: %v", address, err)
+		return nil, fmt.Errorf("%w: %v", ErrContractFailed, err)
+	}
+	return &CallResult{Return: hex.EncodeToString(r.Return), GasUsed: r.GasUsed}, nil
+}
+
+// Funzione che ritorna lo schema OpenAPI di un contratto pubblicato
+func ContractInfoSchema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"blockchain_address": openapi.String("address of the contract"),
+		"code":               openapi.String("hex bytecode"),
+		"storage":            openapi.Map(openapi.String("hex value")),
+	}, "blockchain_address", "code", "storage")
+}
+
+// Funzione che ritorna lo schema OpenAPI del risultato di una chiamata
+func CallResultSchema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"return":   openapi.String("hex value returned with RETURN, empty without"),
+		"gas_used": openapi.Integer(""),
+	}, "return", "gas_used")
+}
@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/events"
+)
+
+// Dati dell'evento di riordino della catena
+type ReorgData struct {
+	// Altezza dell'ultimo blocco in comune tra le due catene
+	ForkHeight int `json:"fork_height"`
+	// Blocchi della vecchia catena scartati
+	Depth     int    `json:"depth"`
+	OldTip    string `json:"old_tip"`
+	OldHeight int    `json:"old_height"`
+}
+
+// Getter del bus degli eventi della blockchain, ci pubblica anche
+// il nodo p2p
+func (bc *Blockchain) Events() *events.Bus {
+	return bc.events
+}
+
+// Funzione che ritorna gli eventi di un blocco entrato nella catena:
+// il nuovo ultimo blocco e la conferma delle sue transazioni
+func BlockEvents(height int, b *block.Block, time int64) []*events.Event {
+	hash := BlockHash(b)
+	evs := make([]*events.Event, 0, len(b.Transactions)+1)
+	for _, t := range b.Transactions {
+		evs = append(evs, &events.Event{
+			Type:      events.TX_CONFIRMED,
+			Height:    height,
+			Hash:      hash,
+			Time:      time,
+			Data:      t,
+			Addresses: []string{t.SenderBlockchainAddress, t.RecipientBlockchainAddress},
+		})
+	}
+	return append(evs, &events.Event{Type: events.NEW_TIP, Height: height, Hash: hash, Time: time, Data: b})
+}
+
+// Metodo che pubblica gli eventi dei blocchi aggiunti dall'altezza
+// start, va chiamato con il lock così gli eventi seguono l'ordine
+// in cui la catena cambia
+func (bc *Blockchain) publishBlocks(start int) {
+	now := bc.clock.Now().UnixNano()
+	for h := start; h < len(bc.chain); h++ {
+		for _, e := range BlockEvents(h, bc.chain[h], now) {
+			bc.events.Publish(e)
+		}
+	}
+}
+
+// Metodo che pubblica l'evento di una transazione entrata nel
+// transaction pool, va chiamato con il lock
+func (bc *Blockchain) publishAccepted(t *blockchain_transaction.Transaction) {
+	bc.events.Publish(&events.Event{
+		Type:      events.TX_ACCEPTED,
+		Time:      bc.clock.Now().UnixNano(),
+		Data:      t,
+		Addresses: []string{t.SenderBlockchainAddress, t.RecipientBlockchainAddress},
+	})
+}
+
+// Metodo che pubblica il riordino della catena, va chiamato con
+// il lock prima di sostituire la catena
+func (bc *Blockchain) publishReorg(fork int, newChain []*block.Block) {
+	old := bc.lastBlock()
+	bc.events.Publish(&events.Event{
+		Type:   events.REORG,
+		Height: len(newChain) - 1,
+		Hash:   BlockHash(newChain[len(newChain)-1]),
+		Time:   bc.clock.Now().UnixNano(),
+		Data: &ReorgData{
+			ForkHeight: fork - 1,
+			Depth:      len(bc.chain) - fork,
+			OldTip:     BlockHash(old),
+			OldHeight:  len(bc.chain) - 1,
+		},
+	})
+}
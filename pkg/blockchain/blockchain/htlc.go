@@ -0,0 +1,183 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/locktime"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+)
+
+// Stati dei fondi di un contratto HTLC nella catena
+const (
+	// Nessuno ha ancora inviato fondi al contratto
+	HTLC_EMPTY = "empty"
+	// Ci sono fondi da riscattare o da rimborsare
+	HTLC_LOCKED = "locked"
+	// Il recipient ha riscattato i fondi rivelando il preimage
+	HTLC_CLAIMED = "claimed"
+	// Il sender ha ripreso i fondi dopo il timeout
+	HTLC_REFUNDED = "refunded"
+)
+
+var (
+	// La transazione non spende i fondi secondo il contratto
+	ErrInvalidHtlc = errors.New("invalid htlc spend")
+	// Il rimborso arriva prima del timeout
+	ErrHtlcTimeout = errors.New("htlc timeout not reached")
+	// Nel transaction pool c'è già una transazione che spende i fondi
+	ErrHtlcPending = errors.New("htlc funds are already being spent")
+	// Il contratto non ha fondi da spendere
+	ErrHtlcEmpty = errors.New("htlc has no funds")
+)
+
+// Stato di un contratto HTLC: i fondi e, se il recipient li ha
+// riscattati o sta per farlo, il preimage, che serve alla controparte
+// di uno scambio per riscattare i fondi sull'altra catena
+type HtlcStatus struct {
+	BlockchainAddress string         `json:"blockchain_address"`
+	Contract          *htlc.Contract `json:"contract"`
+	State             string         `json:"state"`
+	Amount            float32        `json:"amount"`
+	// Il prossimo blocco ha raggiunto il timeout: il riscatto non è
+	// più possibile e il rimborso sì
+	TimedOut bool `json:"timed_out"`
+	// Nel transaction pool c'è una transazione che spende i fondi
+	Pending  bool   `json:"pending"`
+	Preimage string `json:"preimage,omitempty"`
+}
+
+// Funzione che verifica una transazione che spende i fondi di un HTLC
+// con il contratto e il preimage, senza firme
+func verifyHtlc(t *blockchain_transaction.Transaction) error {
+	if !htlc.IsAddress(t.SenderBlockchainAddress) {
+		return errors.New("htlc spend of a sender that is not an htlc")
+	}
+	if t.Htlc == nil {
+		return errors.New("htlc transaction without htlc data")
+	}
+	if t.Witness != nil || t.Script != nil {
+		return errors.New("htlc transaction with a witness or a script")
+	}
+	return t.Htlc.Verify(t.SenderBlockchainAddress, t.RecipientBlockchainAddress, t.ValidAfter, t.ValidUntil)
+}
+
+// Metodo che controlla una transazione che spende i fondi di un HTLC
+// prima di metterla nel transaction pool, va chiamato con il lock
+// Oltre al contratto, il rimborso deve arrivare dopo il timeout e i
+// fondi non devono essere già spesi da una transazione nel pool, così
+// un rimborso in attesa non blocca il riscatto
+// Ritorna ErrInvalidHtlc, ErrHtlcTimeout o ErrHtlcPending
+func (bc *Blockchain) checkHtlc(t *blockchain_transaction.Transaction) error {
+	if err := verifyHtlc(t); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHtlc, err)
+	}
+	if t.Premature(len(bc.chain), medianTimePast(bc.chain)) {
+		return ErrHtlcTimeout
+	}
+	for _, p := range bc.transactionPool {
+		if p.SenderBlockchainAddress == t.SenderBlockchainAddress {
+			return ErrHtlcPending
+		}
+	}
+	return nil
+}
+
+// Metodo che spende tutti i fondi del contratto: con il preimage li
+// riscatta per il recipient, senza li rimborsa al sender
+// La transazione viene aggiunta al transaction pool e annunciata ai
+// vicini, ritorna la richiesta creata o ErrHtlcEmpty se non ci sono
+// fondi, oltre agli errori di AddTransactionRequest
+func (bc *Blockchain) SpendHtlc(s *htlc.Spend) (*transaction_request.TransactionRequest, error) {
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHtlc, err)
+	}
+	sender := s.Address()
+	value := bc.CalculateTotalAmount(sender)
+	if !(value > 0) {
+		return nil, ErrHtlcEmpty
+	}
+	recipient := s.SenderBlockchainAddress
+	if s.Claim() {
+		recipient = s.RecipientBlockchainAddress
+	}
+	// Il nonce distingue la spesa da una uguale fatta prima, se il
+	// contratto è stato finanziato di nuovo con lo stesso valore
+	chainID, nonce := bc.chainID, blockchain_transaction.NewNonce()
+	tr := &transaction_request.TransactionRequest{
+		SenderBlockchainAddress:    &sender,
+		RecipientBlockchainAddress: &recipient,
+		Value:                      &value,
+		ChainID:                    &chainID,
+		Nonce:                      &nonce,
+		Htlc:                       s,
+	}
+	validAfter, validUntil := s.Window()
+	if validAfter != 0 {
+		tr.ValidAfter = &validAfter
+	}
+	if validUntil != 0 {
+		tr.ValidUntil = &validUntil
+	}
+	if err := bc.CreateTransactionRequest(tr); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// Metodo che ritorna lo stato del contratto, che deve essere valido
+func (bc *Blockchain) HtlcStatus(c *htlc.Contract) *HtlcStatus {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	address := c.Address()
+	status := &HtlcStatus{
+		BlockchainAddress: address,
+		Contract:          c,
+		State:             HTLC_EMPTY,
+		Amount:            bc.calculateTotalAmount(address),
+		TimedOut:          locktime.Reached(c.Timeout, len(bc.chain), medianTimePast(bc.chain)),
+	}
+	reveal := func(t *blockchain_transaction.Transaction) {
+		if t.SenderBlockchainAddress == address && t.Htlc != nil && t.Htlc.Claim() {
+			status.Preimage = t.Htlc.Preimage
+		}
+	}
+	for _, b := range bc.chain {
+		for _, t := range b.Transactions {
+			switch {
+			case t.RecipientBlockchainAddress == address:
+				status.State = HTLC_LOCKED
+			case t.SenderBlockchainAddress == address && t.Htlc != nil:
+				status.State = HTLC_REFUNDED
+				if t.Htlc.Claim() {
+					status.State = HTLC_CLAIMED
+				}
+				reveal(t)
+			}
+		}
+	}
+	for _, t := range bc.transactionPool {
+		if t.SenderBlockchainAddress == address {
+			status.Pending = true
+			reveal(t)
+		}
+	}
+	return status
+}
+
+// Funzione che ritorna lo schema OpenAPI dello stato di un contratto,
+// contract è lo schema del contratto
+func HtlcStatusSchema(contract *openapi.Schema) *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"blockchain_address": openapi.String("address of the contract, where the funds are locked"),
+		"contract":           contract,
+		"state":              {Type: "string", Enum: []string{HTLC_EMPTY, HTLC_LOCKED, HTLC_CLAIMED, HTLC_REFUNDED}},
+		"amount":             openapi.Number("funds still locked"),
+		"timed_out":          openapi.Boolean("the next block reaches the timeout: no more claims, refunds allowed"),
+		"pending":            openapi.Boolean("a transaction spending the funds is in the pool"),
+		"preimage":           openapi.String("revealed by a claim in the chain or in the pool"),
+	}, "blockchain_address", "contract", "state", "amount", "timed_out", "pending")
+}
@@ -0,0 +1,33 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/script"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+)
+
+// La transazione non soddisfa lo script dei fondi che spende
+var ErrInvalidScript = errors.New("invalid script spend")
+
+// Funzione che verifica una transazione che spende i fondi di uno
+// script: lo script di blocco deve dare l'address del sender ed essere
+// soddisfatto dallo script di sblocco, con le firme sul payload della
+// transazione e i limiti di tempo confrontati con la sua finestra di
+// validità, che il pool e i blocchi fanno già rispettare
+func verifyScript(t *blockchain_transaction.Transaction) error {
+	if !script.IsAddress(t.SenderBlockchainAddress) {
+		return errors.New("script spend of a sender that is not a script")
+	}
+	if t.Script == nil {
+		return errors.New("script transaction without script")
+	}
+	if t.Witness != nil || t.Htlc != nil {
+		return errors.New("script transaction with a witness or htlc data")
+	}
+	return t.Script.Verify(t.SenderBlockchainAddress, &script.Tx{
+		SigningPayload: t.SigningPayload(),
+		ValidAfter:     t.ValidAfter,
+		ValidUntil:     t.ValidUntil,
+	})
+}
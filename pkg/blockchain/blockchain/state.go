@@ -0,0 +1,202 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+)
+
+// Stato della catena dopo un blocco: i bilanci in monete, gli ID
+// delle transazioni già confermate, i contratti e i token, lo state
+// root dei blocchi copre questi ultimi due, bilanci e ID seguono dalle
+// transazioni
+type chainState struct {
+	coins     map[string]float32
+	confirmed map[string]bool
+	contracts *contract.State
+	assets    *asset.Ledger
+}
+
+// Funzione che crea lo stato vuoto, quello del genesis
+func newChainState() *chainState {
+	return &chainState{coins: make(map[string]float32), confirmed: make(map[string]bool), contracts: contract.NewState(), assets: asset.NewLedger()}
+}
+
+// Metodo che ritorna una copia dello stato, da modificare senza
+// cambiare l'originale
+func (s *chainState) clone() *chainState {
+	coins := make(map[string]float32, len(s.coins))
+	for address, amount := range s.coins {
+		coins[address] = amount
+	}
+	confirmed := make(map[string]bool, len(s.confirmed))
+	for id := range s.confirmed {
+		confirmed[id] = true
+	}
+	return &chainState{coins: coins, confirmed: confirmed, contracts: s.contracts.Clone(), assets: s.assets.Clone()}
+}
+
+// Metodo che ritorna lo state root: quello dei contratti finché non
+// ci sono token, poi lo SHA-256 di quello dei contratti e di quello
+// dei token, così le catene senza token non cambiano
+func (s *chainState) root() [32]byte {
+	assets := s.assets.Root()
+	if assets == [32]byte{} {
+		return s.contracts.Root()
+	}
+	contracts := s.contracts.Root()
+	return sha256.Sum256(append(contracts[:], assets[:]...))
+}
+
+// Funzione che sposta le monete di una transazione: la coinbase crea
+// la ricompensa, le altre transazioni tolgono value al sender, che
+// deve averlo, e lo danno al recipient
+// Le transazioni dei contratti e dei token non inviano monete
+func applyCoins(coins map[string]float32, t *blockchain_transaction.Transaction) error {
+	sender, value := t.SenderBlockchainAddress, t.Value
+	switch {
+	case sender == MINING_SENDER && value != MINING_REWARD:
+		return fmt.Errorf("coinbase of %v, the reward is %v", value, MINING_REWARD)
+	case t.Contract != nil || t.Asset != nil:
+		if value != 0 {
+			return errors.New("contract or asset transaction with a value")
+		}
+		return nil
+	case !(value > 0):
+		return fmt.Errorf("value %v is not positive", value)
+	}
+	if sender != MINING_SENDER {
+		if coins[sender] < value {
+			return fmt.Errorf("balance %v, sending %v", coins[sender], value)
+		}
+		coins[sender] -= value
+	}
+	coins[t.RecipientBlockchainAddress] += value
+	return nil
+}
+
+// Funzione che applica allo stato una transazione del blocco
+// all'altezza height: il suo ID, che non deve essere già nella catena,
+// le monete e, se è di un contratto o di un token, il suo stato
+// Le coinbase hanno tutte lo stesso payload e non hanno ID
+func applyTransaction(state *chainState, t *blockchain_transaction.Transaction, height int) error {
+	if t.SenderBlockchainAddress != MINING_SENDER {
+		id := t.ID()
+		if state.confirmed[id] {
+			return fmt.Errorf("transaction %s is already in the chain", id)
+		}
+		state.confirmed[id] = true
+	}
+	if err := applyCoins(state.coins, t); err != nil {
+		return err
+	}
+	switch {
+	case t.Contract != nil:
+		return applyContract(state.contracts, t, height)
+	case t.Asset != nil:
+		return applyAsset(state.assets, t, height)
+	}
+	return nil
+}
+
+// Funzione che ritorna lo stato dopo il blocco all'altezza height,
+// partendo da quello dopo il blocco precedente, che non viene
+// modificato
+// Nessun sender può spendere più monete di quelle che ha, le
+// transazioni dei contratti e dei token devono riuscire tutte, il
+// gas che possono usare i contratti non può superare MAX_BLOCK_GAS e
+// lo state root del blocco deve essere quello dei contratti e dei
+// token che ne risultano
+func applyBlock(state *chainState, b *block.Block, height int) (*chainState, error) {
+	state = state.clone()
+	var gas uint64
+	for _, t := range b.Transactions {
+		if t.Contract == nil && contract.IsAddress(t.RecipientBlockchainAddress) {
+			return nil, fmt.Errorf("transaction from %s sends coins or assets to a contract", t.SenderBlockchainAddress)
+		}
+		if t.Contract != nil {
+			if gas += t.Contract.GasLimit; gas > contract.MAX_BLOCK_GAS {
+				return nil, errors.New("block gas limit exceeded")
+			}
+		}
+		if err := applyTransaction(state, t, height); err != nil {
+			return nil, fmt.Errorf("transaction from %s: %v", t.SenderBlockchainAddress, err)
+		}
+	}
+	if root := state.root(); root != b.StateRoot {
+		return nil, fmt.Errorf("state root %x, expected %x", b.StateRoot, root)
+	}
+	return state, nil
+}
+
+// Funzione che ricalcola lo stato dopo l'ultimo blocco della catena
+func stateOf(chain []*block.Block) (*chainState, error) {
+	state := newChainState()
+	for height, b := range chain {
+		var err error
+		if state, err = applyBlock(state, b, height); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// Metodo che ritorna lo stato dopo le transazioni del transaction
+// pool, in cui entra una nuova transazione, va chiamato con il lock
+// Le transazioni del pool che ora falliscono vengono saltate, il miner
+// le scarterà
+func (bc *Blockchain) pendingState() *chainState {
+	state := bc.state.clone()
+	for _, t := range bc.transactionPool {
+		applyTransaction(state, t, len(bc.chain))
+	}
+	return state
+}
+
+// Metodo che dice se una transazione con lo stesso ID è già nella
+// catena o nel transaction pool, va chiamato con il lock
+func (bc *Blockchain) replayed(t *blockchain_transaction.Transaction) bool {
+	id := t.ID()
+	if bc.state.confirmed[id] {
+		return true
+	}
+	for _, p := range bc.transactionPool {
+		if p.SenderBlockchainAddress != MINING_SENDER && p.ID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Metodo che controlla una transazione prima di metterla nel
+// transaction pool, va chiamato con il lock: solo le transazioni dei
+// contratti possono avere come recipient un contratto e quelle dei
+// contratti e dei token devono riuscire dopo quelle già nel pool
+// Ritorna ErrContractFailed o ErrAssetFailed
+func (bc *Blockchain) checkState(t *blockchain_transaction.Transaction) error {
+	if t.Contract == nil && contract.IsAddress(t.RecipientBlockchainAddress) {
+		return fmt.Errorf("%w: contracts do not hold coins or assets", ErrContractFailed)
+	}
+	if t.Contract == nil && t.Asset == nil {
+		return nil
+	}
+	if t.Contract != nil && t.Contract.GasLimit > contract.MAX_BLOCK_GAS {
+		return fmt.Errorf("%w: gas_limit above the block gas limit", ErrContractFailed)
+	}
+	state := bc.pendingState()
+	if t.Contract != nil {
+		if err := applyContract(state.contracts, t, len(bc.chain)); err != nil {
+			return fmt.Errorf("%w: %v", ErrContractFailed, err)
+		}
+		return nil
+	}
+	if err := applyAsset(state.assets, t, len(bc.chain)); err != nil {
+		return fmt.Errorf("%w: %v", ErrAssetFailed, err)
+	}
+	return nil
+}
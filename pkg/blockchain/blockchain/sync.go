@@ -0,0 +1,415 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/script"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+)
+
+var (
+	// Il blocco non si attacca all'ultimo blocco della catena
+	ErrOrphanBlock = errors.New("block does not extend the chain")
+	// Il blocco o la catena non rispettano le regole di consenso
+	ErrInvalidBlock = errors.New("invalid block")
+	ErrInvalidChain = errors.New("invalid chain")
+)
+
+// Funzione che ritorna l'hash del blocco in esadecimale
+func BlockHash(b *block.Block) string {
+	return fmt.Sprintf("%x", b.Hash())
+}
+
+// Metodo che ritorna l'altezza dell'ultimo blocco
+func (bc *Blockchain) Height() int {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return len(bc.chain) - 1
+}
+
+// Metodo che ritorna l'identificativo della rete
+func (bc *Blockchain) ChainID() string {
+	return bc.chainID
+}
+
+// Rete della blockchain: i wallet firmano le transazioni con il suo
+// chain ID
+type NetworkInfo struct {
+	ChainID     string `json:"chain_id"`
+	GenesisHash string `json:"genesis_hash"`
+	Height      int    `json:"height"`
+}
+
+// Metodo che ritorna la rete della blockchain e l'altezza dell'ultimo
+// blocco
+func (bc *Blockchain) Network() *NetworkInfo {
+	return &NetworkInfo{ChainID: bc.chainID, GenesisHash: bc.GenesisHash(), Height: bc.Height()}
+}
+
+// Funzione che ritorna lo schema OpenAPI della rete
+func NetworkInfoSchema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"chain_id":     openapi.String("network identifier, part of the signed payload of every transaction"),
+		"genesis_hash": openapi.String("hex sha256 of the first block, derived from chain_id"),
+		"height":       openapi.Integer("height of the last block"),
+	}, "chain_id", "genesis_hash", "height")
+}
+
+// Metodo che ritorna l'hash del genesis
+func (bc *Blockchain) GenesisHash() string {
+	return fmt.Sprintf("%x", bc.genesisHash)
+}
+
+// Metodo che cerca un blocco per hash, ritorna nil se non c'è
+func (bc *Blockchain) BlockByHash(hash string) *block.Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	for i := len(bc.chain) - 1; i >= 0; i-- {
+		if BlockHash(bc.chain[i]) == hash {
+			return bc.chain[i]
+		}
+	}
+	return nil
+}
+
+// Metodo che ritorna il blocco all'altezza height, nil se non c'è
+func (bc *Blockchain) BlockByHeight(height int) *block.Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if height < 0 || height >= len(bc.chain) {
+		return nil
+	}
+	return bc.chain[height]
+}
+
+// Metodo che ritorna l'altezza del blocco con l'hash, -1 se non c'è
+func (bc *Blockchain) HeightOf(hash string) int {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	for i := len(bc.chain) - 1; i >= 0; i-- {
+		if BlockHash(bc.chain[i]) == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// Metodo che ritorna gli hash con cui un peer trova il punto in cui
+// la sua catena si separa da quella locale: gli ultimi 10 blocchi,
+// poi a passi che raddoppiano, e sempre il genesis
+func (bc *Blockchain) Locator() []string {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	locator := make([]string, 0)
+	step := 1
+	for i := len(bc.chain) - 1; i > 0; i -= step {
+		locator = append(locator, BlockHash(bc.chain[i]))
+		if len(locator) >= 10 {
+			step *= 2
+		}
+	}
+	return append(locator, BlockHash(bc.chain[0]))
+}
+
+// Metodo che ritorna al massimo max blocchi che seguono il primo
+// hash del locator presente nella catena locale, e l'altezza del
+// primo blocco ritornato
+func (bc *Blockchain) BlocksAfter(locator []string, max int) (int, []*block.Block) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	start := 1
+	heights := make(map[string]int)
+	for i, b := range bc.chain {
+		heights[BlockHash(b)] = i
+	}
+	for _, hash := range locator {
+		if h, ok := heights[hash]; ok {
+			start = h + 1
+			break
+		}
+	}
+	end := start + max
+	if end > len(bc.chain) {
+		end = len(bc.chain)
+	}
+	if start >= end {
+		return start, []*block.Block{}
+	}
+	blocks := make([]*block.Block, end-start)
+	copy(blocks, bc.chain[start:end])
+	return start, blocks
+}
+
+// Metodo che ritorna una copia dei primi n blocchi della catena
+func (bc *Blockchain) ChainPrefix(n int) []*block.Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if n > len(bc.chain) {
+		n = len(bc.chain)
+	}
+	prefix := make([]*block.Block, n)
+	copy(prefix, bc.chain[:n])
+	return prefix
+}
+
+// Metodo per aggiungere un blocco ricevuto da un peer in cima alla catena
+// Ritorna ErrOrphanBlock se il blocco non si attacca all'ultimo blocco
+// e ErrInvalidBlock se non ha una proof of work valida, se le
+// transazioni dei contratti e dei token falliscono o se non danno il
+// suo state root
+func (bc *Blockchain) AddBlock(b *block.Block) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if b.PreviousHash != bc.lastBlock().Hash() {
+		return ErrOrphanBlock
+	}
+	if !bc.wellFormed(b, bc.chain) || !bc.ValidProof(b.Timestamp, b.Nonce, b.PreviousHash, b.StateRoot, b.Transactions, MINING_DIFFICULTY) {
+		return ErrInvalidBlock
+	}
+	state, err := applyBlock(bc.state, b, len(bc.chain))
+	if err != nil {
+		log.Printf("ERROR: block %s: %v", BlockHash(b), err)
+		return ErrInvalidBlock
+	}
+	bc.chain = append(bc.chain, b)
+	bc.state = state
+	bc.removeConfirmed([]*block.Block{b})
+	bc.removeExpired()
+	bc.publishBlocks(len(bc.chain) - 1)
+	log.Printf("Block %s added at height %d", BlockHash(b), len(bc.chain)-1)
+	return nil
+}
+
+// Metodo per sostituire la catena con una più lunga ricevuta da un peer
+// Ritorna false se la catena non è più lunga di quella locale e
+// ErrInvalidChain se non è valida
+func (bc *Blockchain) ReplaceChain(chain []*block.Block) (bool, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if len(chain) <= len(bc.chain) {
+		return false, nil
+	}
+	state, ok := bc.validChain(chain)
+	if !ok {
+		return false, ErrInvalidChain
+	}
+	fork := 0
+	for fork < len(bc.chain) && chain[fork].Hash() == bc.chain[fork].Hash() {
+		fork += 1
+	}
+	if fork < len(bc.chain) {
+		bc.publishReorg(fork, chain)
+	}
+	bc.chain = chain
+	bc.state = state
+	bc.removeConfirmed(chain[fork:])
+	bc.removeExpired()
+	bc.publishBlocks(fork)
+	log.Printf("Chain replaced, new height %d, reorg depth %d", len(chain)-1, len(chain)-fork-1)
+	return true, nil
+}
+
+// Metodo che controlla che un blocco ricevuto, all'altezza height,
+// non abbia transazioni vuote o fuori dai loro limiti di validità, che
+// le transazioni degli account multisig abbiano un witness valido e
+// quelle degli HTLC il loro contratto, che quelle degli script li
+// soddisfino e che le altre siano firmate dalla chiave del sender
+// La prima transazione, e solo quella, è la coinbase con la ricompensa
+// Il timestamp deve superare la mediana dei blocchi precedenti,
+// previous, e non essere troppo avanti rispetto all'orologio locale
+// Le transazioni a tempo si controllano con la mediana, che un miner
+// da solo non può spostare
+func (bc *Blockchain) wellFormed(b *block.Block, previous []*block.Block) bool {
+	height := len(previous)
+	median := medianTimePast(previous)
+	if b.Timestamp <= median {
+		log.Printf("ERROR: block at height %d has timestamp %d, not after the median %d of the previous blocks", height, b.Timestamp, median)
+		return false
+	}
+	if limit := bc.clock.Now().Add(MAX_FUTURE_BLOCK_TIME_SEC * time.Second).UnixNano(); b.Timestamp > limit {
+		log.Printf("ERROR: block at height %d has timestamp %d, too far in the future", height, b.Timestamp)
+		return false
+	}
+	if len(b.Transactions) == 0 || b.Transactions[0] == nil || b.Transactions[0].SenderBlockchainAddress != MINING_SENDER {
+		log.Printf("ERROR: block at height %d does not start with the coinbase transaction", height)
+		return false
+	}
+	if b.Transactions[0].Value != MINING_REWARD {
+		log.Printf("ERROR: coinbase of %v at height %d, the reward is %v", b.Transactions[0].Value, height, MINING_REWARD)
+		return false
+	}
+	for i, t := range b.Transactions {
+		if t == nil {
+			return false
+		}
+		if i > 0 && t.SenderBlockchainAddress == MINING_SENDER {
+			log.Printf("ERROR: more than one coinbase transaction at height %d", height)
+			return false
+		}
+		if !t.ValidAt(height, median) {
+			log.Printf("ERROR: block transaction from %s outside its validity at height %d", t.SenderBlockchainAddress, height)
+			return false
+		}
+		if err := bc.verifyBlockTransaction(t); err != nil {
+			log.Printf("ERROR: block transaction from %s: %v", t.SenderBlockchainAddress, err)
+			return false
+		}
+	}
+	return true
+}
+
+// Funzione che ritorna la mediana dei timestamp degli ultimi
+// MEDIAN_TIME_BLOCKS blocchi della catena: è il tempo con cui il
+// prossimo blocco controlla i limiti di validità delle transazioni
+func medianTimePast(chain []*block.Block) int64 {
+	if len(chain) > MEDIAN_TIME_BLOCKS {
+		chain = chain[len(chain)-MEDIAN_TIME_BLOCKS:]
+	}
+	timestamps := make([]int64, len(chain))
+	for i, b := range chain {
+		timestamps[i] = b.Timestamp
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// Metodo che verifica chi ha autorizzato una transazione del blocco
+// Chiave pubblica e firma le hanno solo le transazioni degli address
+// normali, le coinbase inviano solo la ricompensa, le altre sono tutte
+// della rete della blockchain
+func (bc *Blockchain) verifyBlockTransaction(t *blockchain_transaction.Transaction) error {
+	sender := t.SenderBlockchainAddress
+	if sender != MINING_SENDER && t.ChainID != bc.chainID {
+		return fmt.Errorf("transaction for chain %q", t.ChainID)
+	}
+	switch {
+	case sender == MINING_SENDER:
+		if t.SenderPublicKey != "" || t.Signature != "" || t.ChainID != "" || t.Witness != nil || t.Htlc != nil || t.Script != nil || t.Contract != nil || t.Asset != nil {
+			return errors.New("coinbase transaction with more than the reward")
+		}
+		return nil
+	case htlc.IsAddress(sender) || t.Htlc != nil || script.IsAddress(sender) || t.Script != nil || multisig.IsAddress(sender) || t.Witness != nil:
+		if t.SenderPublicKey != "" || t.Signature != "" {
+			return errors.New("sender_public_key and signature are replaced by the witness, the htlc or the script")
+		}
+	default:
+		return bc.verifySignature(t)
+	}
+	switch {
+	case htlc.IsAddress(sender) || t.Htlc != nil:
+		return verifyHtlc(t)
+	case script.IsAddress(sender) || t.Script != nil:
+		return verifyScript(t)
+	}
+	return verifyWitness(t)
+}
+
+// Metodo per togliere dal transaction pool le transazioni già
+// contenute nei blocchi, anche con altre firme, va chiamato dopo aver
+// aggiornato lo stato
+func (bc *Blockchain) removeConfirmed(blocks []*block.Block) {
+	confirmed := make([]*blockchain_transaction.Transaction, 0)
+	for _, b := range blocks {
+		confirmed = append(confirmed, b.Transactions...)
+	}
+	pool := make([]*blockchain_transaction.Transaction, 0, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		found := -1
+		for i, c := range confirmed {
+			if c != nil && c.Equal(t) {
+				found = i
+				break
+			}
+		}
+		if found >= 0 {
+			confirmed[found] = nil
+			continue
+		}
+		if t.SenderBlockchainAddress != MINING_SENDER && bc.state.confirmed[t.ID()] {
+			continue
+		}
+		pool = append(pool, t)
+	}
+	bc.transactionPool = pool
+}
+
+// Metodo per togliere dal transaction pool le transazioni scadute,
+// che non possono più entrare nel prossimo blocco
+func (bc *Blockchain) removeExpired() {
+	height, now := len(bc.chain), medianTimePast(bc.chain)
+	pool := make([]*blockchain_transaction.Transaction, 0, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		if t.Expired(height, now) {
+			log.Printf("Transaction from %s expired, removed from the pool", t.SenderBlockchainAddress)
+			continue
+		}
+		pool = append(pool, t)
+	}
+	bc.transactionPool = pool
+}
+
+// Metodo per togliere dal transaction pool le transazioni dei
+// contratti e dei token che il miner ha scartato perché fallivano
+func (bc *Blockchain) removeFailed(failed map[*blockchain_transaction.Transaction]bool) {
+	if len(failed) == 0 {
+		return
+	}
+	pool := make([]*blockchain_transaction.Transaction, 0, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		if !failed[t] {
+			pool = append(pool, t)
+		}
+	}
+	bc.transactionPool = pool
+}
+
+// Metodo che ritorna una copia della catena e del transaction pool,
+// da salvare su disco
+func (bc *Blockchain) Export() ([]*block.Block, []*blockchain_transaction.Transaction) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	chain := make([]*block.Block, len(bc.chain))
+	copy(chain, bc.chain)
+	pool := make([]*blockchain_transaction.Transaction, len(bc.transactionPool))
+	copy(pool, bc.transactionPool)
+	return chain, pool
+}
+
+// Metodo per ripristinare la catena e il transaction pool salvati,
+// la catena deve partire dallo stesso genesis ed essere valida, le
+// transazioni del pool senza una firma valida vengono scartate
+// Ritorna ErrInvalidChain se non lo è
+func (bc *Blockchain) Restore(chain []*block.Block, pool []*blockchain_transaction.Transaction) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	state, ok := bc.validChain(chain)
+	if !ok {
+		return ErrInvalidChain
+	}
+	bc.chain = chain
+	bc.state = state
+	bc.transactionPool = make([]*blockchain_transaction.Transaction, 0, len(pool))
+	for _, t := range pool {
+		if t == nil {
+			continue
+		}
+		// Le transazioni salvate prima che la firma restasse nella
+		// transazione non entrerebbero in un blocco valido
+		if err := bc.verifyBlockTransaction(t); err != nil {
+			log.Printf("Pending transaction from %s dropped: %v", t.SenderBlockchainAddress, err)
+			continue
+		}
+		bc.transactionPool = append(bc.transactionPool, t)
+	}
+	bc.removeExpired()
+	log.Printf("Chain restored at height %d with %d pending transactions", len(chain)-1, len(bc.transactionPool))
+	return nil
+}
@@ -0,0 +1,75 @@
+package chain_store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+)
+
+// Archivio della catena e del transaction pool, salvato su disco in
+// json così che il nodo li ritrovi dopo un riavvio
+type ChainStore struct {
+	path string
+}
+
+// Contenuto del file dell'archivio
+type State struct {
+	Chain        []*block.Block                        `json:"chain"`
+	Transactions []*blockchain_transaction.Transaction `json:"transactions"`
+}
+
+// Funzione per creare un nuovo archivio, se path è vuoto
+// non viene salvato niente
+func NewChainStore(path string) *ChainStore {
+	return &ChainStore{path: path}
+}
+
+// Getter del percorso del file
+func (cs *ChainStore) Path() string {
+	return cs.path
+}
+
+// Metodo per caricare la catena e il transaction pool dal file,
+// ritorna nil se il file non esiste o se path è vuoto
+func (cs *ChainStore) Load() (*State, error) {
+	if cs.path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(cs.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Metodo per salvare la catena e il transaction pool su disco, si
+// scrive prima su un file temporaneo per non lasciare il file a metà
+func (cs *ChainStore) Save(state *State) error {
+	if cs.path == "" {
+		return nil
+	}
+	m, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(cs.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := cs.path + ".tmp"
+	if err := os.WriteFile(tmp, m, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cs.path)
+}
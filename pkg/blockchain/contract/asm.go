@@ -0,0 +1,166 @@
+package contract
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Funzione che converte un contratto dalla forma testuale in codice,
+// per esempio
+//
+//	; conta le chiamate
+//	"count" DUP SLOAD 1 ADD SSTORE
+//
+// I token sono separati da spazi e a capo, da ";" a fine riga è un
+// commento:
+//   - gli opcode per nome, senza distinguere maiuscole e minuscole
+//   - i numeri decimali, "0x" seguito da esadecimale e le stringhe
+//     tra virgolette mettono il valore sullo stack
+//   - "nome:" definisce un'etichetta e "@nome" mette sullo stack la sua
+//     posizione, per JUMP e JUMPI
+func Assemble(src string) ([]byte, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	// Le posizioni delle etichette si conoscono solo alla fine, ogni
+	// "@nome" occupa sempre 4 byte
+	labels := make(map[string]int)
+	var code []byte
+	type fixup struct {
+		pos   int
+		label string
+	}
+	var fixups []fixup
+	for _, t := range tokens {
+		switch {
+		case strings.HasSuffix(t, ":") && !strings.HasPrefix(t, "\""):
+			name := strings.TrimSuffix(t, ":")
+			if name == "" {
+				return nil, fmt.Errorf("%w: empty label", ErrMalformed)
+			}
+			if _, ok := labels[name]; ok {
+				return nil, fmt.Errorf("%w: label %s defined twice", ErrMalformed, name)
+			}
+			labels[name] = len(code)
+		case strings.HasPrefix(t, "@"):
+			fixups = append(fixups, fixup{pos: len(code) + 2, label: t[1:]})
+			code = append(code, OP_PUSH, 2, 0, 0)
+		default:
+			if op, ok := opcodeByName(t); ok {
+				if op == OP_PUSH {
+					return nil, fmt.Errorf("%w: use a literal instead of PUSH", ErrMalformed)
+				}
+				code = append(code, op)
+				continue
+			}
+			v, err := ParseArg(t)
+			if err != nil {
+				return nil, err
+			}
+			if len(v) > 0xff {
+				return nil, ErrElementSize
+			}
+			code = append(append(code, OP_PUSH, byte(len(v))), v...)
+		}
+	}
+	for _, f := range fixups {
+		pos, ok := labels[f.label]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown label %s", ErrMalformed, f.label)
+		}
+		code[f.pos], code[f.pos+1] = byte(pos>>8), byte(pos)
+	}
+	if len(code) > MAX_CODE_SIZE {
+		return nil, ErrCodeSize
+	}
+	return code, nil
+}
+
+// Funzione che divide il testo in token, le stringhe tra virgolette
+// possono contenere spazi
+func tokenize(src string) ([]string, error) {
+	var tokens []string
+	for _, line := range strings.Split(src, "\n") {
+		for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+			if line[0] == ';' {
+				break
+			}
+			if line[0] == '"' {
+				end := strings.IndexByte(line[1:], '"')
+				if end < 0 {
+					return nil, fmt.Errorf("%w: unterminated string %s", ErrMalformed, line)
+				}
+				tokens = append(tokens, line[:end+2])
+				line = line[end+2:]
+				continue
+			}
+			end := strings.IndexAny(line, " \t\r;")
+			if end < 0 {
+				end = len(line)
+			}
+			tokens = append(tokens, line[:end])
+			line = line[end:]
+		}
+	}
+	return tokens, nil
+}
+
+func opcodeByName(name string) (byte, bool) {
+	name = strings.ToUpper(name)
+	for op, n := range opcodeNames {
+		if n == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+// Funzione che converte un valore dalla forma testuale in byte: un
+// numero decimale, "0x" seguito da esadecimale o una stringa tra
+// virgolette
+// Serve anche per gli argomenti delle chiamate
+func ParseArg(s string) ([]byte, error) {
+	switch {
+	case len(s) >= 2 && strings.HasPrefix(s, "\"") && strings.HasSuffix(s, "\""):
+		return []byte(s[1 : len(s)-1]), nil
+	case strings.HasPrefix(s, "0x"):
+		v, err := hex.DecodeString(s[2:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s is not hex", ErrMalformed, s)
+		}
+		return v, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q is not an opcode, a number, hex or a string", ErrMalformed, s)
+	}
+	return EncodeNum(n), nil
+}
+
+// Funzione che ritorna la forma testuale del codice, con le posizioni
+// delle istruzioni: i valori fino a 8 byte sono numeri, gli altri in
+// esadecimale
+func Disassemble(code []byte) (string, error) {
+	instructions, err := parse(code)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, i := range instructions {
+		fmt.Fprintf(&b, "%04d  ", i.pc)
+		switch {
+		case i.opcode != OP_PUSH:
+			b.WriteString(opcodeNames[i.opcode])
+		case len(i.data) <= 8:
+			n, _ := DecodeNum(i.data)
+			b.WriteString(strconv.FormatUint(n, 10))
+		default:
+			b.WriteString("0x" + hex.EncodeToString(i.data))
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,175 @@
+package contract
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Limiti della VM, ogni esecuzione finisce entro il gas della
+// transazione anche se il codice ha dei cicli
+const (
+	// Version byte degli address dei contratti: iniziano con "C"
+	ADDRESS_VERSION = 0x1c
+	// Byte del codice di un contratto
+	MAX_CODE_SIZE = 8192
+	// Gas di una transazione
+	MAX_GAS = 1000000
+	// Gas di tutte le transazioni dei contratti di un blocco
+	MAX_BLOCK_GAS = 5000000
+	// Argomenti di una chiamata
+	MAX_ARGS = 16
+	// Elementi dello stack
+	MAX_STACK_SIZE = 256
+	// Byte di un elemento dello stack e di un valore salvato
+	MAX_ELEMENT_SIZE = 256
+	// Byte di una chiave dello storage
+	MAX_KEY_SIZE = 64
+	// Gas per ogni byte del codice pubblicato
+	GAS_CODE_BYTE = 5
+)
+
+var (
+	// Il codice non si può dividere in istruzioni
+	ErrMalformed = errors.New("malformed code")
+	// Opcode che non esiste
+	ErrBadOpcode = errors.New("unknown opcode")
+	// Il codice supera MAX_CODE_SIZE
+	ErrCodeSize = errors.New("code too large")
+	// L'esecuzione ha superato il gas della transazione
+	ErrOutOfGas = errors.New("out of gas")
+	// Un opcode trova meno elementi di quelli che gli servono
+	ErrStackUnderflow = errors.New("stack underflow")
+	// Lo stack supera MAX_STACK_SIZE
+	ErrStackOverflow = errors.New("stack overflow")
+	// Un elemento supera MAX_ELEMENT_SIZE o una chiave MAX_KEY_SIZE
+	ErrElementSize = errors.New("element too large")
+	// Un numero ha più di 8 byte
+	ErrInvalidNumber = errors.New("invalid number")
+	// Un'operazione supera 2^64-1 o va sotto zero
+	ErrOverflow = errors.New("arithmetic overflow")
+	// Divisione o modulo per zero
+	ErrDivisionByZero = errors.New("division by zero")
+	// Un salto non arriva all'inizio di un'istruzione
+	ErrBadJump = errors.New("invalid jump destination")
+	// Il contratto ha eseguito REVERT
+	ErrReverted = errors.New("execution reverted")
+	// L'address non è di un contratto pubblicato
+	ErrNotFound = errors.New("contract not found")
+	// Un contratto con lo stesso address è già pubblicato
+	ErrExists = errors.New("contract already deployed")
+	// Il recipient della pubblicazione non è l'address del contratto
+	ErrAddressMismatch = errors.New("recipient is not the address of the contract")
+)
+
+// Messaggio di una transazione di un contratto: con Code la
+// transazione pubblica il codice all'address del recipient, senza
+// chiama il contratto del recipient con gli argomenti Args
+// Codice e argomenti sono in esadecimale e il messaggio fa parte del
+// payload firmato dal sender
+type Message struct {
+	Code     string   `json:"code,omitempty"`
+	Args     []string `json:"args,omitempty"`
+	GasLimit uint64   `json:"gas_limit"`
+}
+
+// Metodo che dice se il messaggio pubblica un contratto
+func (m *Message) Deploy() bool {
+	return m.Code != ""
+}
+
+// Metodo che controlla la forma del messaggio, senza eseguirlo
+func (m *Message) Validate() error {
+	if m.GasLimit == 0 || m.GasLimit > MAX_GAS {
+		return fmt.Errorf("gas_limit must be between 1 and %d", MAX_GAS)
+	}
+	if m.Deploy() {
+		if len(m.Args) != 0 {
+			return errors.New("a deploy has no args")
+		}
+		code, err := hex.DecodeString(m.Code)
+		if err != nil {
+			return errors.New("code is not hex")
+		}
+		if len(code) > MAX_CODE_SIZE {
+			return ErrCodeSize
+		}
+		if _, err := parse(code); err != nil {
+			return err
+		}
+		return nil
+	}
+	_, err := m.DecodeArgs()
+	return err
+}
+
+// Metodo che ritorna il codice del messaggio
+func (m *Message) DecodeCode() ([]byte, error) {
+	return hex.DecodeString(m.Code)
+}
+
+// Metodo che ritorna gli argomenti della chiamata
+func (m *Message) DecodeArgs() ([][]byte, error) {
+	if len(m.Args) > MAX_ARGS {
+		return nil, fmt.Errorf("at most %d args", MAX_ARGS)
+	}
+	args := make([][]byte, 0, len(m.Args))
+	for _, a := range m.Args {
+		b, err := hex.DecodeString(a)
+		if err != nil {
+			return nil, fmt.Errorf("arg %q is not hex", a)
+		}
+		if len(b) > MAX_ELEMENT_SIZE {
+			return nil, ErrElementSize
+		}
+		args = append(args, b)
+	}
+	return args, nil
+}
+
+// Funzione che calcola l'address di un contratto pubblicato dal
+// sender: come per le chiavi, RIPEMD-160 dello SHA-256 con version
+// byte e checksum in base58, del sender e del codice
+// Lo stesso sender può pubblicare lo stesso codice una volta sola
+func Address(sender string, code []byte) string {
+	data := append(append([]byte(sender), 0), code...)
+	payload := append([]byte{ADDRESS_VERSION}, hash160(data)...)
+	return base58.Encode(append(payload, checksum(payload)...))
+}
+
+// Funzione che dice se l'address è quello di un contratto
+func IsAddress(address string) bool {
+	b := base58.Decode(address)
+	if len(b) != 25 || b[0] != ADDRESS_VERSION {
+		return false
+	}
+	return bytes.Equal(b[21:], checksum(b[:21]))
+}
+
+func hash160(data []byte) []byte {
+	h := sha256.Sum256(data)
+	r := ripemd160.New()
+	r.Write(h[:])
+	return r.Sum(nil)
+}
+
+func checksum(payload []byte) []byte {
+	h1 := sha256.Sum256(payload)
+	h2 := sha256.Sum256(h1[:])
+	return h2[:4]
+}
+
+// Funzione che ritorna lo schema OpenAPI del messaggio
+func Schema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"code":      openapi.String("hex bytecode to deploy at the recipient address; not for calls"),
+		"args":      openapi.Array(openapi.String("hex argument, pushed on the stack in order")),
+		"gas_limit": openapi.Integer(fmt.Sprintf("from 1 to %d", MAX_GAS)),
+	}, "gas_limit")
+}
@@ -0,0 +1,139 @@
+package contract
+
+// Opcode della VM dei contratti
+// Gli elementi dello stack sono sequenze di byte; i numeri sono interi
+// senza segno fino a 2^64-1, in big endian, e zero è la sequenza vuota
+const (
+	// Ferma il contratto senza risultato
+	OP_STOP = 0x00
+	// Mette sullo stack i byte che seguono, tanti quanto il byte dopo
+	// l'opcode
+	OP_PUSH = 0x01
+
+	// Stack
+	OP_POP   = 0x10
+	OP_DUP   = 0x11
+	OP_SWAP  = 0x12
+	OP_OVER  = 0x13
+	OP_ROT   = 0x14
+	OP_DEPTH = 0x15
+
+	// Aritmetica, un risultato fuori da 0..2^64-1 ferma il contratto
+	OP_ADD = 0x20
+	OP_SUB = 0x21
+	OP_MUL = 0x22
+	OP_DIV = 0x23
+	OP_MOD = 0x24
+
+	// Confronti e logica, true è 1 e false è vuoto
+	OP_LT  = 0x25
+	OP_GT  = 0x26
+	OP_EQ  = 0x27
+	OP_NOT = 0x28
+	OP_AND = 0x29
+	OP_OR  = 0x2a
+
+	// Salti all'inizio di un'istruzione, preso dallo stack
+	OP_JUMP  = 0x30
+	OP_JUMPI = 0x31
+
+	// Storage del contratto, una chiave senza valore è vuota
+	OP_SLOAD  = 0x40
+	OP_SSTORE = 0x41
+
+	// Contesto della chiamata
+	OP_CALLER  = 0x50
+	OP_ADDRESS = 0x51
+	OP_HEIGHT  = 0x52
+
+	// Byte
+	OP_SHA256 = 0x60
+	OP_CONCAT = 0x61
+	OP_SIZE   = 0x62
+
+	// Fine dell'esecuzione: RETURN ritorna l'elemento in cima allo
+	// stack, REVERT annulla le modifiche allo storage
+	OP_RETURN = 0x70
+	OP_REVERT = 0x71
+)
+
+// Nomi degli opcode, per l'assembler
+var opcodeNames = map[byte]string{
+	OP_STOP:    "STOP",
+	OP_PUSH:    "PUSH",
+	OP_POP:     "POP",
+	OP_DUP:     "DUP",
+	OP_SWAP:    "SWAP",
+	OP_OVER:    "OVER",
+	OP_ROT:     "ROT",
+	OP_DEPTH:   "DEPTH",
+	OP_ADD:     "ADD",
+	OP_SUB:     "SUB",
+	OP_MUL:     "MUL",
+	OP_DIV:     "DIV",
+	OP_MOD:     "MOD",
+	OP_LT:      "LT",
+	OP_GT:      "GT",
+	OP_EQ:      "EQ",
+	OP_NOT:     "NOT",
+	OP_AND:     "AND",
+	OP_OR:      "OR",
+	OP_JUMP:    "JUMP",
+	OP_JUMPI:   "JUMPI",
+	OP_SLOAD:   "SLOAD",
+	OP_SSTORE:  "SSTORE",
+	OP_CALLER:  "CALLER",
+	OP_ADDRESS: "ADDRESS",
+	OP_HEIGHT:  "HEIGHT",
+	OP_SHA256:  "SHA256",
+	OP_CONCAT:  "CONCAT",
+	OP_SIZE:    "SIZE",
+	OP_RETURN:  "RETURN",
+	OP_REVERT:  "REVERT",
+}
+
+// Gas degli opcode, quelli che non ci sono costano 1
+var opcodeGas = map[byte]uint64{
+	OP_MUL:    3,
+	OP_DIV:    3,
+	OP_MOD:    3,
+	OP_JUMP:   2,
+	OP_JUMPI:  2,
+	OP_SLOAD:  50,
+	OP_SSTORE: 200,
+	OP_SHA256: 30,
+	OP_CONCAT: 3,
+}
+
+// Istruzione del codice: la posizione, l'opcode e i dati di PUSH
+type instruction struct {
+	pc     int
+	opcode byte
+	data   []byte
+}
+
+// Funzione che divide il codice in istruzioni, controllando che gli
+// opcode esistano
+func parse(code []byte) ([]instruction, error) {
+	if len(code) > MAX_CODE_SIZE {
+		return nil, ErrCodeSize
+	}
+	var instructions []instruction
+	for pc := 0; pc < len(code); {
+		i := instruction{pc: pc, opcode: code[pc]}
+		if _, ok := opcodeNames[i.opcode]; !ok {
+			return nil, ErrBadOpcode
+		}
+		pc++
+		if i.opcode == OP_PUSH {
+			if pc >= len(code) || pc+1+int(code[pc]) > len(code) {
+				return nil, ErrMalformed
+			}
+			size := int(code[pc])
+			i.data = code[pc+1 : pc+1+size]
+			pc += 1 + size
+		}
+		instructions = append(instructions, i)
+	}
+	return instructions, nil
+}
@@ -0,0 +1,183 @@
+package contract
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+)
+
+// Contratto pubblicato: il codice e lo storage
+// Un Account in uno State non viene mai modificato, una chiamata che
+// cambia lo storage lo sostituisce con una copia
+type Account struct {
+	Code    []byte
+	Storage map[string][]byte
+}
+
+// Stato di tutti i contratti dopo un blocco
+type State struct {
+	accounts map[string]*Account
+}
+
+// Transazione di un contratto nel blocco all'altezza Height
+type Tx struct {
+	Sender    string
+	Recipient string
+	Message   *Message
+	Height    int
+}
+
+// Funzione che crea lo stato vuoto, quello del genesis
+func NewState() *State {
+	return &State{accounts: make(map[string]*Account)}
+}
+
+// Metodo che ritorna una copia dello stato, da modificare senza
+// cambiare l'originale
+func (s *State) Clone() *State {
+	c := &State{accounts: make(map[string]*Account, len(s.accounts))}
+	for address, a := range s.accounts {
+		c.accounts[address] = a
+	}
+	return c
+}
+
+// Metodo che ritorna il contratto all'address, nil se non c'è
+// L'Account non va modificato
+func (s *State) Account(address string) *Account {
+	return s.accounts[address]
+}
+
+// Metodo che ritorna l'hash dello stato: lo SHA-256 degli address in
+// ordine, ognuno con il suo codice e lo storage con le chiavi in
+// ordine, ogni campo preceduto dalla sua lunghezza
+// Senza contratti è zero, così i blocchi senza contratti non cambiano
+func (s *State) Root() [32]byte {
+	if len(s.accounts) == 0 {
+		return [32]byte{}
+	}
+	h := sha256.New()
+	write := func(b []byte) {
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(len(b)))
+		h.Write(size)
+		h.Write(b)
+	}
+	for _, address := range sortedKeys(s.accounts) {
+		a := s.accounts[address]
+		write([]byte(address))
+		write(a.Code)
+		keys := make([]string, 0, len(a.Storage))
+		for k := range a.Storage {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(len(keys)))
+		h.Write(size)
+		for _, k := range keys {
+			write([]byte(k))
+			write(a.Storage[k])
+		}
+	}
+	var root [32]byte
+	copy(root[:], h.Sum(nil))
+	return root
+}
+
+func sortedKeys(accounts map[string]*Account) []string {
+	keys := make([]string, 0, len(accounts))
+	for k := range accounts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Metodo che applica allo stato una transazione di un contratto: la
+// pubblicazione del codice o la chiamata, che cambia lo storage solo
+// se finisce senza errori
+// Ritorna il risultato, con il gas usato anche se c'è un errore
+func (s *State) Apply(tx *Tx) (*Result, error) {
+	m := tx.Message
+	if err := m.Validate(); err != nil {
+		return &Result{}, err
+	}
+	if m.Deploy() {
+		code, _ := m.DecodeCode()
+		if tx.Recipient != Address(tx.Sender, code) {
+			return &Result{}, ErrAddressMismatch
+		}
+		if s.accounts[tx.Recipient] != nil {
+			return &Result{}, ErrExists
+		}
+		gas := uint64(len(code)) * GAS_CODE_BYTE
+		if gas > m.GasLimit {
+			return &Result{GasUsed: m.GasLimit}, ErrOutOfGas
+		}
+		s.accounts[tx.Recipient] = &Account{Code: code, Storage: map[string][]byte{}}
+		return &Result{GasUsed: gas}, nil
+	}
+	args, _ := m.DecodeArgs()
+	return s.call(tx.Recipient, tx.Sender, args, tx.Height, m.GasLimit, true)
+}
+
+// Metodo che esegue una chiamata senza cambiare lo stato, per leggere
+// i dati di un contratto
+func (s *State) Call(address string, caller string, args [][]byte, height int, gasLimit uint64) (*Result, error) {
+	return s.call(address, caller, args, height, gasLimit, false)
+}
+
+func (s *State) call(address string, caller string, args [][]byte, height int, gasLimit uint64, commit bool) (*Result, error) {
+	a := s.accounts[address]
+	if a == nil {
+		return &Result{}, ErrNotFound
+	}
+	j := &journal{account: a, writes: make(map[string][]byte)}
+	ctx := &Context{Address: address, Caller: caller, Height: height}
+	r, err := Execute(a.Code, args, ctx, j, gasLimit)
+	if err != nil || !commit || len(j.writes) == 0 {
+		return r, err
+	}
+	storage := make(map[string][]byte, len(a.Storage)+len(j.writes))
+	for k, v := range a.Storage {
+		storage[k] = v
+	}
+	for k, v := range j.writes {
+		if len(v) == 0 {
+			delete(storage, k)
+			continue
+		}
+		storage[k] = v
+	}
+	s.accounts[address] = &Account{Code: a.Code, Storage: storage}
+	return r, nil
+}
+
+// Scritture di una chiamata, applicate allo storage solo se la
+// chiamata finisce senza errori
+type journal struct {
+	account *Account
+	writes  map[string][]byte
+}
+
+func (j *journal) Load(key []byte) []byte {
+	if v, ok := j.writes[string(key)]; ok {
+		return v
+	}
+	return j.account.Storage[string(key)]
+}
+
+func (j *journal) Store(key []byte, value []byte) {
+	j.writes[string(key)] = append([]byte{}, value...)
+}
+
+// Metodo che ritorna lo storage in esadecimale, chiave per chiave
+func (a *Account) HexStorage() map[string]string {
+	storage := make(map[string]string, len(a.Storage))
+	for k, v := range a.Storage {
+		storage[hex.EncodeToString([]byte(k))] = hex.EncodeToString(v)
+	}
+	return storage
+}
@@ -0,0 +1,347 @@
+package contract
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+)
+
+// Storage di un contratto, chiavi e valori di byte
+// Un valore vuoto cancella la chiave
+type Storage interface {
+	Load(key []byte) []byte
+	Store(key []byte, value []byte)
+}
+
+// Contesto della chiamata: l'address del contratto, quello di chi lo
+// chiama e l'altezza del blocco che contiene la chiamata
+// Nelle transazioni Caller è il sender, che la blockchain autentica
+// prima di eseguirle, nelle chiamate in lettura è quello richiesto
+type Context struct {
+	Address string
+	Caller  string
+	Height  int
+}
+
+// Risultato di un'esecuzione: l'elemento ritornato con RETURN e il gas
+// usato, anche se l'esecuzione fallisce
+type Result struct {
+	Return  []byte
+	GasUsed uint64
+}
+
+// Stato dell'esecuzione
+type vm struct {
+	ctx      *Context
+	storage  Storage
+	stack    [][]byte
+	gas      uint64
+	gasLimit uint64
+}
+
+// Funzione che esegue il codice di un contratto con gli argomenti
+// sullo stack, il primo in fondo, finché non arriva a STOP, RETURN o
+// alla fine del codice
+// L'esecuzione è deterministica: dipende solo dal codice, dagli
+// argomenti, dal contesto e dallo storage
+// Se ritorna un errore le modifiche fatte allo storage vanno scartate
+func Execute(code []byte, args [][]byte, ctx *Context, storage Storage, gasLimit uint64) (*Result, error) {
+	e := &vm{ctx: ctx, storage: storage, gasLimit: gasLimit}
+	ret, err := e.run(code, args)
+	return &Result{Return: ret, GasUsed: e.gas}, err
+}
+
+func (e *vm) run(code []byte, args [][]byte) ([]byte, error) {
+	instructions, err := parse(code)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > MAX_ARGS {
+		return nil, ErrStackOverflow
+	}
+	for _, a := range args {
+		if err := e.push(a); err != nil {
+			return nil, err
+		}
+	}
+	// Posizioni dove può arrivare un salto
+	targets := make(map[uint64]int, len(instructions))
+	for n, i := range instructions {
+		targets[uint64(i.pc)] = n
+	}
+	for n := 0; n < len(instructions); n++ {
+		i := &instructions[n]
+		cost, ok := opcodeGas[i.opcode]
+		if !ok {
+			cost = 1
+		}
+		if err := e.useGas(cost); err != nil {
+			return nil, err
+		}
+		switch i.opcode {
+		case OP_STOP:
+			return nil, nil
+		case OP_RETURN:
+			return e.pop()
+		case OP_REVERT:
+			return nil, ErrReverted
+		case OP_JUMP, OP_JUMPI:
+			target, err := e.popNum()
+			if err != nil {
+				return nil, err
+			}
+			if i.opcode == OP_JUMPI {
+				cond, err := e.pop()
+				if err != nil {
+					return nil, err
+				}
+				if !asBool(cond) {
+					continue
+				}
+			}
+			next, ok := targets[target]
+			if !ok {
+				return nil, ErrBadJump
+			}
+			// Il ciclo incrementa n
+			n = next - 1
+		default:
+			if err := e.step(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (e *vm) useGas(cost uint64) error {
+	if e.gas+cost > e.gasLimit {
+		e.gas = e.gasLimit
+		return ErrOutOfGas
+	}
+	e.gas += cost
+	return nil
+}
+
+// Metodo che esegue un'istruzione che non cambia il flusso
+func (e *vm) step(i *instruction) error {
+	switch i.opcode {
+	case OP_PUSH:
+		return e.push(i.data)
+	case OP_POP:
+		_, err := e.pop()
+		return err
+	case OP_DUP, OP_OVER:
+		depth := 1
+		if i.opcode == OP_OVER {
+			depth = 2
+		}
+		if len(e.stack) < depth {
+			return ErrStackUnderflow
+		}
+		return e.push(e.stack[len(e.stack)-depth])
+	case OP_SWAP:
+		if len(e.stack) < 2 {
+			return ErrStackUnderflow
+		}
+		n := len(e.stack)
+		e.stack[n-1], e.stack[n-2] = e.stack[n-2], e.stack[n-1]
+	case OP_ROT:
+		// a b c -> b c a
+		if len(e.stack) < 3 {
+			return ErrStackUnderflow
+		}
+		n := len(e.stack)
+		e.stack[n-3], e.stack[n-2], e.stack[n-1] = e.stack[n-2], e.stack[n-1], e.stack[n-3]
+	case OP_DEPTH:
+		return e.push(EncodeNum(uint64(len(e.stack))))
+	case OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_LT, OP_GT:
+		return e.arithmetic(i.opcode)
+	case OP_EQ, OP_AND, OP_OR, OP_CONCAT:
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		switch i.opcode {
+		case OP_EQ:
+			return e.pushBool(bytes.Equal(a, b))
+		case OP_AND:
+			return e.pushBool(asBool(a) && asBool(b))
+		case OP_OR:
+			return e.pushBool(asBool(a) || asBool(b))
+		}
+		return e.push(append(append([]byte{}, a...), b...))
+	case OP_NOT:
+		v, err := e.pop()
+		if err != nil {
+			return err
+		}
+		return e.pushBool(!asBool(v))
+	case OP_SLOAD:
+		key, err := e.popKey()
+		if err != nil {
+			return err
+		}
+		return e.push(e.storage.Load(key))
+	case OP_SSTORE:
+		value, err := e.pop()
+		if err != nil {
+			return err
+		}
+		key, err := e.popKey()
+		if err != nil {
+			return err
+		}
+		e.storage.Store(key, value)
+	case OP_CALLER:
+		return e.push([]byte(e.ctx.Caller))
+	case OP_ADDRESS:
+		return e.push([]byte(e.ctx.Address))
+	case OP_HEIGHT:
+		return e.push(EncodeNum(uint64(e.ctx.Height)))
+	case OP_SHA256:
+		v, err := e.pop()
+		if err != nil {
+			return err
+		}
+		h := sha256.Sum256(v)
+		return e.push(h[:])
+	case OP_SIZE:
+		v, err := e.pop()
+		if err != nil {
+			return err
+		}
+		return e.push(EncodeNum(uint64(len(v))))
+	default:
+		return ErrBadOpcode
+	}
+	return nil
+}
+
+// Metodo per le operazioni su due numeri, b è in cima allo stack
+func (e *vm) arithmetic(op byte) error {
+	b, err := e.popNum()
+	if err != nil {
+		return err
+	}
+	a, err := e.popNum()
+	if err != nil {
+		return err
+	}
+	switch op {
+	case OP_ADD:
+		sum, carry := bits.Add64(a, b, 0)
+		if carry != 0 {
+			return ErrOverflow
+		}
+		return e.push(EncodeNum(sum))
+	case OP_SUB:
+		if a < b {
+			return ErrOverflow
+		}
+		return e.push(EncodeNum(a - b))
+	case OP_MUL:
+		hi, lo := bits.Mul64(a, b)
+		if hi != 0 {
+			return ErrOverflow
+		}
+		return e.push(EncodeNum(lo))
+	case OP_DIV, OP_MOD:
+		if b == 0 {
+			return ErrDivisionByZero
+		}
+		if op == OP_DIV {
+			return e.push(EncodeNum(a / b))
+		}
+		return e.push(EncodeNum(a % b))
+	case OP_LT:
+		return e.pushBool(a < b)
+	}
+	return e.pushBool(a > b)
+}
+
+func (e *vm) push(v []byte) error {
+	if len(v) > MAX_ELEMENT_SIZE {
+		return ErrElementSize
+	}
+	if len(e.stack) >= MAX_STACK_SIZE {
+		return ErrStackOverflow
+	}
+	e.stack = append(e.stack, v)
+	return nil
+}
+
+func (e *vm) pushBool(b bool) error {
+	if b {
+		return e.push([]byte{1})
+	}
+	return e.push([]byte{})
+}
+
+func (e *vm) pop() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	v := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+	return v, nil
+}
+
+func (e *vm) popNum() (uint64, error) {
+	v, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	return DecodeNum(v)
+}
+
+func (e *vm) popKey() ([]byte, error) {
+	key, err := e.pop()
+	if err != nil {
+		return nil, err
+	}
+	if len(key) > MAX_KEY_SIZE {
+		return nil, ErrElementSize
+	}
+	return key, nil
+}
+
+// Funzione che dice se un elemento è vero: lo è se ha almeno un byte
+// diverso da zero
+func asBool(v []byte) bool {
+	for _, b := range v {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Funzione che codifica un numero in big endian senza zeri iniziali,
+// zero è vuoto
+func EncodeNum(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+// Funzione che decodifica un numero in big endian di al più 8 byte,
+// gli zeri iniziali sono ammessi
+func DecodeNum(b []byte) (uint64, error) {
+	if len(b) > 8 {
+		return 0, ErrInvalidNumber
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
@@ -0,0 +1,56 @@
+package contract_request
+
+import (
+	"fmt"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract"
+)
+
+// Richiesta lato server di una chiamata in lettura a un contratto:
+// l'address del contratto, chi lo chiama, gli argomenti in
+// esadecimale e il gas, MAX_GAS se manca
+type CallRequest struct {
+	BlockchainAddress *string  `json:"blockchain_address"`
+	Caller            *string  `json:"caller,omitempty"`
+	Args              []string `json:"args,omitempty"`
+	GasLimit          *uint64  `json:"gas_limit,omitempty"`
+}
+
+// Valida la richiesta
+// Ritorna un *api_error.ApiError con il campo che manca o non è valido
+func (cr *CallRequest) Validate() error {
+	if cr.BlockchainAddress == nil {
+		return api_error.MissingField("blockchain_address")
+	}
+	if !contract.IsAddress(*cr.BlockchainAddress) {
+		return api_error.InvalidField("blockchain_address", "is not a contract address")
+	}
+	if cr.GasLimit != nil && (*cr.GasLimit == 0 || *cr.GasLimit > contract.MAX_GAS) {
+		return api_error.InvalidField("gas_limit", fmt.Sprintf("must be between 1 and %d", contract.MAX_GAS))
+	}
+	if _, err := cr.message().DecodeArgs(); err != nil {
+		return api_error.InvalidField("args", err.Error())
+	}
+	return nil
+}
+
+func (cr *CallRequest) message() *contract.Message {
+	m := &contract.Message{Args: cr.Args, GasLimit: contract.MAX_GAS}
+	if cr.GasLimit != nil {
+		m.GasLimit = *cr.GasLimit
+	}
+	return m
+}
+
+// Metodo che ritorna chi chiama, vuoto se manca, gli argomenti e il
+// gas, la richiesta deve essere valida
+func (cr *CallRequest) Call() (string, [][]byte, uint64) {
+	var caller string
+	if cr.Caller != nil {
+		caller = *cr.Caller
+	}
+	m := cr.message()
+	args, _ := m.DecodeArgs()
+	return caller, args, m.GasLimit
+}
@@ -0,0 +1,230 @@
+package htlc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/locktime"
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+	"golang.org/x/crypto/ripemd160"
+)
+
+const (
+	// Version byte degli address HTLC: iniziano con "H"
+	ADDRESS_VERSION = 0x28
+	// Lunghezza in byte dei preimage generati, quelli ricevuti possono
+	// essere lunghi da 1 a MAX_PREIMAGE byte
+	PREIMAGE_SIZE = 32
+	MAX_PREIMAGE  = 64
+)
+
+var (
+	// Il contratto non è valido: address mancanti, hash non SHA-256
+	// in esadecimale o timeout non valido
+	ErrInvalidContract = errors.New("invalid htlc contract")
+	// Il contratto non è quello dell'address del sender
+	ErrAddressMismatch = errors.New("htlc contract is not the one of the sender address")
+	// Il preimage non ha l'hash del contratto
+	ErrInvalidPreimage = errors.New("htlc preimage does not match the hash")
+	// Il riscatto va al recipient del contratto e il rimborso al sender
+	ErrWrongRecipient = errors.New("htlc funds can only go to the contract parties")
+	// Il riscatto deve avere valid_until uguale al timeout meno uno e
+	// il rimborso valid_after uguale al timeout
+	ErrWrongWindow = errors.New("htlc spend validity does not match the timeout")
+)
+
+// Contratto HTLC (hash time-locked contract): i fondi inviati al suo
+// address li riscatta il recipient rivelando il preimage dell'hash
+// prima del timeout, altrimenti dopo il timeout tornano al sender
+// Il timeout è un'altezza di blocco o un timestamp in secondi, come
+// valid_after e valid_until delle transazioni
+type Contract struct {
+	SenderBlockchainAddress    string `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress string `json:"recipient_blockchain_address"`
+	// SHA-256 del preimage, in esadecimale minuscolo
+	Hash    string `json:"hash"`
+	Timeout int64  `json:"timeout"`
+}
+
+// Funzione per creare il contratto, l'hash si può passare anche in
+// maiuscolo
+// Ritorna ErrInvalidContract se i dati non sono validi
+func NewContract(sender string, recipient string, hash string, timeout int64) (*Contract, error) {
+	c := &Contract{
+		SenderBlockchainAddress:    sender,
+		RecipientBlockchainAddress: recipient,
+		Hash:                       strings.ToLower(hash),
+		Timeout:                    timeout,
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Metodo che controlla un contratto ricevuto: sender e recipient
+// diversi, hash di 64 caratteri esadecimali minuscoli e timeout valido
+func (c *Contract) Validate() error {
+	if c.SenderBlockchainAddress == "" || c.RecipientBlockchainAddress == "" {
+		return fmt.Errorf("%w: sender and recipient are required", ErrInvalidContract)
+	}
+	if c.SenderBlockchainAddress == c.RecipientBlockchainAddress {
+		return fmt.Errorf("%w: sender and recipient must differ", ErrInvalidContract)
+	}
+	if !ValidHash(c.Hash) {
+		return fmt.Errorf("%w: hash must be 64 lowercase hex characters", ErrInvalidContract)
+	}
+	if !ValidTimeout(c.Timeout) {
+		return fmt.Errorf("%w: timeout must be a block height from 2 or a unix time after %d", ErrInvalidContract, locktime.THRESHOLD)
+	}
+	return nil
+}
+
+// Funzione che dice se hash è uno SHA-256 in esadecimale minuscolo
+func ValidHash(hash string) bool {
+	if len(hash) != 2*sha256.Size || strings.ToLower(hash) != hash {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// Funzione che dice se timeout è valido: il riscatto vale fino a
+// timeout meno uno, che deve essere dello stesso tipo, altezza o
+// timestamp, e non zero
+func ValidTimeout(timeout int64) bool {
+	return timeout >= 2 && locktime.IsHeight(timeout) == locktime.IsHeight(timeout-1)
+}
+
+// Metodo che calcola l'address del contratto: come per le chiavi
+// singole, RIPEMD-160 dello SHA-256 con version byte e checksum in
+// base58, ma del json del contratto
+// Il contratto deve essere valido
+func (c *Contract) Address() string {
+	script, _ := json.Marshal(c)
+	h := sha256.Sum256(script)
+	r := ripemd160.New()
+	r.Write(h[:])
+	payload := append([]byte{ADDRESS_VERSION}, r.Sum(nil)...)
+	return base58.Encode(append(payload, checksum(payload)...))
+}
+
+// Funzione che ritorna i 4 byte di checksum dell'address: i primi
+// byte del doppio SHA-256
+func checksum(payload []byte) []byte {
+	h1 := sha256.Sum256(payload)
+	h2 := sha256.Sum256(h1[:])
+	return h2[:4]
+}
+
+// Funzione che dice se l'address è di un contratto HTLC
+func IsAddress(address string) bool {
+	b := base58.Decode(address)
+	if len(b) != 25 || b[0] != ADDRESS_VERSION {
+		return false
+	}
+	return bytes.Equal(b[21:], checksum(b[:21]))
+}
+
+// Funzione che genera un preimage casuale di PREIMAGE_SIZE byte e
+// ritorna preimage e hash in esadecimale
+func NewPreimage() (string, string, error) {
+	preimage := make([]byte, PREIMAGE_SIZE)
+	if _, err := rand.Read(preimage); err != nil {
+		return "", "", err
+	}
+	h := sha256.Sum256(preimage)
+	return hex.EncodeToString(preimage), hex.EncodeToString(h[:]), nil
+}
+
+// Dati per spendere i fondi di un contratto: il contratto, da cui si
+// ricava l'address del sender della transazione, e il preimage per il
+// riscatto, che manca nel rimborso
+// Non servono firme: il riscatto va sempre al recipient e il rimborso
+// al sender del contratto, chiunque può inviarli
+type Spend struct {
+	Contract
+	// Preimage in esadecimale
+	Preimage string `json:"preimage,omitempty"`
+}
+
+// Metodo che dice se è un riscatto, altrimenti è un rimborso
+func (s *Spend) Claim() bool {
+	return s.Preimage != ""
+}
+
+// Metodo che verifica una transazione che spende i fondi del
+// contratto: il contratto deve essere quello del sender, il riscatto
+// deve avere il preimage, andare al recipient e valere fino al timeout
+// escluso, il rimborso deve andare al sender e valere dal timeout
+// I limiti di validità della transazione fanno rispettare il timeout
+// sia nel transaction pool sia nei blocchi
+func (s *Spend) Verify(sender string, recipient string, validAfter int64, validUntil int64) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if s.Address() != sender {
+		return ErrAddressMismatch
+	}
+	if !s.Claim() {
+		if recipient != s.SenderBlockchainAddress {
+			return fmt.Errorf("%w: a refund goes to %s", ErrWrongRecipient, s.SenderBlockchainAddress)
+		}
+		if validAfter != s.Timeout || validUntil != 0 {
+			return fmt.Errorf("%w: a refund is valid from %d", ErrWrongWindow, s.Timeout)
+		}
+		return nil
+	}
+	preimage, err := hex.DecodeString(s.Preimage)
+	if err != nil || len(preimage) == 0 || len(preimage) > MAX_PREIMAGE {
+		return fmt.Errorf("%w: preimage must be from 1 to %d bytes in hex", ErrInvalidPreimage, MAX_PREIMAGE)
+	}
+	if h := sha256.Sum256(preimage); hex.EncodeToString(h[:]) != s.Hash {
+		return ErrInvalidPreimage
+	}
+	if recipient != s.RecipientBlockchainAddress {
+		return fmt.Errorf("%w: a claim goes to %s", ErrWrongRecipient, s.RecipientBlockchainAddress)
+	}
+	if validAfter != 0 || validUntil != s.Timeout-1 {
+		return fmt.Errorf("%w: a claim is valid until %d", ErrWrongWindow, s.Timeout-1)
+	}
+	return nil
+}
+
+// Metodo che ritorna i limiti di validità della transazione che
+// spende i fondi: fino al timeout escluso per il riscatto, dal timeout
+// per il rimborso
+func (s *Spend) Window() (int64, int64) {
+	if s.Claim() {
+		return 0, s.Timeout - 1
+	}
+	return s.Timeout, 0
+}
+
+// Funzione che ritorna lo schema OpenAPI del contratto
+func ContractSchema() *openapi.Schema {
+	return openapi.Object(contractProperties(), "sender_blockchain_address", "recipient_blockchain_address", "hash", "timeout")
+}
+
+// Funzione che ritorna lo schema OpenAPI dei dati per spendere i fondi
+func SpendSchema() *openapi.Schema {
+	properties := contractProperties()
+	properties["preimage"] = openapi.String("hex preimage of hash, only to claim")
+	return openapi.Object(properties, "sender_blockchain_address", "recipient_blockchain_address", "hash", "timeout")
+}
+
+func contractProperties() map[string]*openapi.Schema {
+	return map[string]*openapi.Schema{
+		"sender_blockchain_address":    openapi.String("locks the funds and gets them back after the timeout"),
+		"recipient_blockchain_address": openapi.String("claims the funds with the preimage before the timeout"),
+		"hash":                         openapi.String("SHA-256 of the preimage, 64 lowercase hex characters"),
+		"timeout":                      openapi.Integer("block height below 500000000, unix time in seconds from there"),
+	}
+}
@@ -0,0 +1,60 @@
+package htlc_request
+
+import (
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+)
+
+// Richiesta lato server su un contratto HTLC: il contratto per lo
+// stato e il rimborso, il contratto e il preimage per il riscatto
+type HtlcRequest struct {
+	SenderBlockchainAddress    *string `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress *string `json:"recipient_blockchain_address"`
+	Hash                       *string `json:"hash"`
+	Timeout                    *int64  `json:"timeout"`
+	Preimage                   *string `json:"preimage,omitempty"`
+}
+
+// Valida il contratto della richiesta, il preimage lo controlla chi
+// lo usa
+// Ritorna un *api_error.ApiError con il campo che manca o non è valido
+func (hr *HtlcRequest) Validate() error {
+	switch {
+	case hr.SenderBlockchainAddress == nil:
+		return api_error.MissingField("sender_blockchain_address")
+	case hr.RecipientBlockchainAddress == nil:
+		return api_error.MissingField("recipient_blockchain_address")
+	case hr.Hash == nil:
+		return api_error.MissingField("hash")
+	case hr.Timeout == nil:
+		return api_error.MissingField("timeout")
+	}
+	if *hr.SenderBlockchainAddress == *hr.RecipientBlockchainAddress {
+		return api_error.InvalidField("recipient_blockchain_address", "must differ from sender_blockchain_address")
+	}
+	if !htlc.ValidHash(strings.ToLower(*hr.Hash)) {
+		return api_error.InvalidField("hash", "must be 64 hexadecimal characters")
+	}
+	if !htlc.ValidTimeout(*hr.Timeout) {
+		return api_error.InvalidField("timeout", "must be a block height from 2 or a unix time in seconds")
+	}
+	return nil
+}
+
+// Metodo che ritorna il contratto, la richiesta deve essere valida
+func (hr *HtlcRequest) Contract() *htlc.Contract {
+	c, _ := htlc.NewContract(*hr.SenderBlockchainAddress, *hr.RecipientBlockchainAddress, *hr.Hash, *hr.Timeout)
+	return c
+}
+
+// Metodo che ritorna i dati per spendere i fondi: il riscatto se c'è
+// il preimage, altrimenti il rimborso
+func (hr *HtlcRequest) Spend() *htlc.Spend {
+	s := &htlc.Spend{Contract: *hr.Contract()}
+	if hr.Preimage != nil {
+		s.Preimage = strings.ToLower(*hr.Preimage)
+	}
+	return s
+}
@@ -0,0 +1,24 @@
+package locktime
+
+import "time"
+
+// Limite tra altezze di blocco e timestamp nei lock time: sotto sono
+// altezze, da qui in poi timestamp unix in secondi, come il locktime
+// di Bitcoin; 500000000 blocchi sono migliaia di anni, 500000000
+// secondi il 1985
+const THRESHOLD = 500000000
+
+// Funzione che dice se lock è un'altezza di blocco
+func IsHeight(lock int64) bool {
+	return lock < THRESHOLD
+}
+
+// Funzione che dice se il blocco all'altezza height, con il timestamp
+// in nanosecondi dei blocchi, ha raggiunto l'altezza o il timestamp
+// in secondi di lock
+func Reached(lock int64, height int, timestamp int64) bool {
+	if IsHeight(lock) {
+		return int64(height) >= lock
+	}
+	return timestamp/int64(time.Second) >= lock
+}
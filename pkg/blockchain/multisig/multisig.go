@@ -0,0 +1,201 @@
+package multisig
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+	"golang.org/x/crypto/ripemd160"
+)
+
+const (
+	// Numero massimo di chiavi di un account multisig
+	MAX_KEYS = 15
+	// Version byte degli address multisig, quelli delle chiavi
+	// singole hanno 0x00: gli address multisig iniziano con "3"
+	ADDRESS_VERSION = 0x05
+)
+
+var (
+	// La policy non è valida: soglia fuori dal numero di chiavi,
+	// chiavi non valide, ripetute o non ordinate
+	ErrInvalidPolicy = errors.New("invalid multisig policy")
+	// La policy non è quella dell'address del sender
+	ErrAddressMismatch = errors.New("multisig policy is not the one of the sender address")
+	// Una firma non è valida o non è di una chiave della policy
+	ErrInvalidSignature = errors.New("invalid multisig signature")
+	// Ci sono meno firme valide della soglia
+	ErrNotEnoughSignatures = errors.New("not enough multisig signatures")
+)
+
+// Policy di un account multisig: servono Threshold firme delle
+// chiavi pubbliche, X e Y in esadecimale come nelle transazioni
+// Le chiavi sono ordinate, così lo stesso insieme di chiavi con la
+// stessa soglia dà sempre lo stesso address
+type Policy struct {
+	Threshold  int      `json:"threshold"`
+	PublicKeys []string `json:"public_keys"`
+}
+
+// Funzione per creare la policy, ordina le chiavi
+// Ritorna ErrInvalidPolicy se la soglia o le chiavi non sono valide
+func NewPolicy(threshold int, publicKeys []string) (*Policy, error) {
+	keys := make([]string, len(publicKeys))
+	for i, k := range publicKeys {
+		keys[i] = strings.ToLower(strings.TrimSpace(k))
+	}
+	sort.Strings(keys)
+	p := &Policy{Threshold: threshold, PublicKeys: keys}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Metodo che controlla una policy ricevuta: la soglia deve essere
+// tra 1 e il numero di chiavi, le chiavi al massimo MAX_KEYS, punti
+// della curva P-256, in esadecimale minuscolo, ordinate e diverse
+func (p *Policy) Validate() error {
+	n := len(p.PublicKeys)
+	if n == 0 || n > MAX_KEYS {
+		return fmt.Errorf("%w: from 1 to %d public keys", ErrInvalidPolicy, MAX_KEYS)
+	}
+	if p.Threshold < 1 || p.Threshold > n {
+		return fmt.Errorf("%w: threshold must be from 1 to %d", ErrInvalidPolicy, n)
+	}
+	for i, k := range p.PublicKeys {
+		if !validPublicKey(k) {
+			return fmt.Errorf("%w: invalid public key %q", ErrInvalidPolicy, k)
+		}
+		if i > 0 && p.PublicKeys[i-1] >= k {
+			return fmt.Errorf("%w: public keys must be sorted and distinct", ErrInvalidPolicy)
+		}
+	}
+	return nil
+}
+
+// Funzione che controlla che k sia una chiave pubblica P-256 in
+// esadecimale minuscolo
+func validPublicKey(k string) bool {
+	if len(k) != 128 || strings.ToLower(k) != k {
+		return false
+	}
+	if _, err := hex.DecodeString(k); err != nil {
+		return false
+	}
+	key := utils.PublicKeyFromString(k)
+	return elliptic.P256().IsOnCurve(key.X, key.Y)
+}
+
+// Metodo che dice se la chiave è della policy
+func (p *Policy) Contains(publicKey string) bool {
+	i := sort.SearchStrings(p.PublicKeys, publicKey)
+	return i < len(p.PublicKeys) && p.PublicKeys[i] == publicKey
+}
+
+// Metodo che calcola l'address dell'account: come per le chiavi
+// singole, RIPEMD-160 dello SHA-256 con version byte e checksum in
+// base58, ma dello script con soglia, numero di chiavi e chiavi
+// La policy deve essere valida
+func (p *Policy) Address() string {
+	var script bytes.Buffer
+	script.WriteByte(byte(p.Threshold))
+	script.WriteByte(byte(len(p.PublicKeys)))
+	for _, k := range p.PublicKeys {
+		b, _ := hex.DecodeString(k)
+		script.Write(b)
+	}
+	h := sha256.Sum256(script.Bytes())
+	r := ripemd160.New()
+	r.Write(h[:])
+	payload := append([]byte{ADDRESS_VERSION}, r.Sum(nil)...)
+	return base58.Encode(append(payload, checksum(payload)...))
+}
+
+// Funzione che ritorna i 4 byte di checksum dell'address: i primi
+// byte del doppio SHA-256
+func checksum(payload []byte) []byte {
+	h1 := sha256.Sum256(payload)
+	h2 := sha256.Sum256(h1[:])
+	return h2[:4]
+}
+
+// Funzione che dice se l'address è di un account multisig
+func IsAddress(address string) bool {
+	b := base58.Decode(address)
+	if len(b) != 25 || b[0] != ADDRESS_VERSION {
+		return false
+	}
+	return bytes.Equal(b[21:], checksum(b[:21]))
+}
+
+// Firma di una delle chiavi della policy, r e s in esadecimale
+type Signature struct {
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+// Dati per verificare una transazione inviata da un account
+// multisig: la policy, da cui si ricava l'address del sender, e le
+// firme delle chiavi
+// Il witness non fa parte del payload firmato
+type Witness struct {
+	Policy
+	Signatures []*Signature `json:"signatures"`
+}
+
+// Metodo che verifica il witness di una transazione del sender sul
+// payload: la policy deve essere quella dell'address e ci devono
+// essere almeno Threshold firme valide di chiavi diverse della policy
+// Una firma non valida rende non valido il witness
+func (w *Witness) Verify(sender string, payload []byte) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	if w.Address() != sender {
+		return ErrAddressMismatch
+	}
+	hash := sha256.Sum256(payload)
+	signed := make(map[string]bool, len(w.Signatures))
+	for _, s := range w.Signatures {
+		if s == nil || !w.Contains(s.PublicKey) || signed[s.PublicKey] {
+			return fmt.Errorf("%w: not a distinct key of the policy", ErrInvalidSignature)
+		}
+		if len(s.Signature) != 128 {
+			return ErrInvalidSignature
+		}
+		if _, err := hex.DecodeString(s.Signature); err != nil {
+			return ErrInvalidSignature
+		}
+		sig := utils.SignatureFromString(s.Signature)
+		if !ecdsa.Verify(utils.PublicKeyFromString(s.PublicKey), hash[:], sig.R, sig.S) {
+			return fmt.Errorf("%w: key %s", ErrInvalidSignature, s.PublicKey[:16])
+		}
+		signed[s.PublicKey] = true
+	}
+	if len(signed) < w.Threshold {
+		return fmt.Errorf("%w: %d of %d", ErrNotEnoughSignatures, len(signed), w.Threshold)
+	}
+	return nil
+}
+
+// Funzione che ritorna lo schema OpenAPI del witness
+func Schema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"threshold":   openapi.Integer("signatures required, from 1 to the number of keys"),
+		"public_keys": openapi.Array(openapi.String("128 hex characters, lowercase and sorted")),
+		"signatures": openapi.Array(openapi.Object(map[string]*openapi.Schema{
+			"public_key": openapi.String("one of public_keys"),
+			"signature":  openapi.String("128 hex characters: r and s"),
+		}, "public_key", "signature")),
+	}, "threshold", "public_keys", "signatures")
+}
@@ -0,0 +1,158 @@
+package multisig
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+)
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Funzione che ritorna la firma del payload con la chiave del wallet
+func sign(t *testing.T, w *wallet.Wallet, payload []byte) *Signature {
+	t.Helper()
+	hash := sha256.Sum256(payload)
+	r, s, err := ecdsa.Sign(rand.Reader, w.PrivateKey(), hash[:])
+	check(t, err)
+	signature := &utils.Signature{R: r, S: s}
+	return &Signature{PublicKey: w.PublicKeyStr(), Signature: signature.String()}
+}
+
+// Funzione che crea n wallet e la policy m di n delle loro chiavi
+func newPolicy(t *testing.T, m int, n int) ([]*wallet.Wallet, *Policy) {
+	t.Helper()
+	wallets := make([]*wallet.Wallet, n)
+	keys := make([]string, n)
+	for i := range wallets {
+		wallets[i] = wallet.NewWallet()
+		keys[i] = wallets[i].PublicKeyStr()
+	}
+	p, err := NewPolicy(m, keys)
+	check(t, err)
+	return wallets, p
+}
+
+// Le policy m di n accettano almeno m firme valide di chiavi diverse,
+// in qualsiasi ordine
+func TestThreshold(t *testing.T) {
+	payload := []byte(`{"value":1}`)
+	for _, c := range []struct{ m, n int }{{1, 1}, {1, 3}, {2, 3}, {3, 3}, {3, 5}} {
+		wallets, p := newPolicy(t, c.m, c.n)
+		address := p.Address()
+		if !IsAddress(address) || !strings.HasPrefix(address, "3") {
+			t.Fatalf("multisig address %s", address)
+		}
+		signatures := make([]*Signature, c.n)
+		for i, w := range wallets {
+			signatures[i] = sign(t, w, payload)
+		}
+		for k := 0; k <= c.n; k++ {
+			// Le ultime k firme, in ordine inverso
+			w := &Witness{Policy: *p}
+			for i := c.n - 1; i >= c.n-k; i-- {
+				w.Signatures = append(w.Signatures, signatures[i])
+			}
+			err := w.Verify(address, payload)
+			if k >= c.m && err != nil {
+				t.Errorf("%d of %d with %d signatures: %v", c.m, c.n, k, err)
+			}
+			if k < c.m && !errors.Is(err, ErrNotEnoughSignatures) {
+				t.Errorf("%d of %d with %d signatures: %v, expected %v", c.m, c.n, k, err, ErrNotEnoughSignatures)
+			}
+		}
+	}
+}
+
+// Le firme ripetute, di chiavi fuori dalla policy o di un altro
+// payload rendono non valido il witness, anche se le altre bastano
+func TestInvalidSignatures(t *testing.T) {
+	payload := []byte(`{"value":1}`)
+	wallets, p := newPolicy(t, 2, 3)
+	a, b := sign(t, wallets[0], payload), sign(t, wallets[1], payload)
+	outsider := wallet.NewWallet()
+
+	tests := map[string][]*Signature{
+		"duplicate":     {a, a},
+		"duplicate key": {a, sign(t, wallets[0], payload), b},
+		"outsider":      {a, b, sign(t, outsider, payload)},
+		"other payload": {a, b, sign(t, wallets[2], []byte("other"))},
+		"swapped key":   {a, {PublicKey: wallets[2].PublicKeyStr(), Signature: b.Signature}},
+		"short":         {a, {PublicKey: b.PublicKey, Signature: b.Signature[2:]}},
+		"not hex":       {a, {PublicKey: b.PublicKey, Signature: strings.Repeat("zz", 64)}},
+		"nil":           {a, b, nil},
+	}
+	for name, signatures := range tests {
+		w := &Witness{Policy: *p, Signatures: signatures}
+		if err := w.Verify(p.Address(), payload); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: %v, expected %v", name, err, ErrInvalidSignature)
+		}
+	}
+
+	w := &Witness{Policy: *p, Signatures: []*Signature{a, b}}
+	check(t, w.Verify(p.Address(), payload))
+	if err := w.Verify(outsider.BlockchainAddress(), payload); !errors.Is(err, ErrAddressMismatch) {
+		t.Fatalf("other sender: %v, expected %v", err, ErrAddressMismatch)
+	}
+	// Con un'altra soglia la policy è di un altro address
+	w.Threshold = 1
+	if err := w.Verify(p.Address(), payload); !errors.Is(err, ErrAddressMismatch) {
+		t.Fatalf("other threshold: %v, expected %v", err, ErrAddressMismatch)
+	}
+}
+
+// Le policy con soglia o chiavi non valide non si creano, e quelle
+// ricevute con le chiavi non ordinate non passano Validate
+func TestInvalidPolicy(t *testing.T) {
+	wallets, p := newPolicy(t, 2, 3)
+	keys := []string{wallets[0].PublicKeyStr(), wallets[1].PublicKeyStr(), wallets[2].PublicKeyStr()}
+	many := make([]string, MAX_KEYS+1)
+	for i := range many {
+		many[i] = wallet.NewWallet().PublicKeyStr()
+	}
+	tests := map[string]struct {
+		threshold int
+		keys      []string
+	}{
+		"no keys":        {1, nil},
+		"zero":           {0, keys},
+		"above n":        {4, keys},
+		"too many keys":  {1, many},
+		"duplicate":      {2, []string{keys[0], keys[0], keys[1]}},
+		"off curve":      {1, []string{strings.Repeat("01", 64)}},
+		"short key":      {1, []string{keys[0][2:]}},
+		"not hex":        {1, []string{strings.Repeat("zz", 64)}},
+		"empty key":      {1, []string{""}},
+		"address as key": {1, []string{wallets[0].BlockchainAddress()}},
+	}
+	for name, test := range tests {
+		if _, err := NewPolicy(test.threshold, test.keys); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("%s: %v, expected %v", name, err, ErrInvalidPolicy)
+		}
+	}
+
+	// Le chiavi in un altro ordine o in maiuscolo danno la stessa policy
+	upper, err := NewPolicy(2, []string{strings.ToUpper(keys[2]), keys[0], " " + keys[1]})
+	check(t, err)
+	if upper.Address() != p.Address() {
+		t.Fatal("the same keys give another address")
+	}
+	unsorted := &Policy{Threshold: 2, PublicKeys: []string{p.PublicKeys[1], p.PublicKeys[0], p.PublicKeys[2]}}
+	if err := unsorted.Validate(); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("unsorted keys: %v, expected %v", err, ErrInvalidPolicy)
+	}
+	if IsAddress(wallets[0].BlockchainAddress()) {
+		t.Fatal("a single key address is multisig")
+	}
+}
@@ -0,0 +1,452 @@
+package script
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/locktime"
+)
+
+// Dati della transazione che servono agli script: il payload firmato
+// dalle chiavi di OP_CHECKSIG e i limiti di validità per i limiti di
+// tempo
+type Tx struct {
+	SigningPayload []byte
+	ValidAfter     int64
+	ValidUntil     int64
+}
+
+// Stato dell'esecuzione dei due script
+type engine struct {
+	tx    *Tx
+	stack [][]byte
+	// Un elemento per ogni OP_IF aperto, true se il ramo si esegue
+	conditions []bool
+	ops        int
+}
+
+// Funzione che esegue lo script di sblocco, che deve solo mettere dati
+// sullo stack, e poi lo script di blocco sullo stack che ne risulta
+// Lo script riesce se alla fine sullo stack resta solo un valore vero
+func Execute(unlockingScript []byte, lockingScript []byte, tx *Tx) error {
+	if len(unlockingScript) > MAX_SCRIPT_SIZE || len(lockingScript) > MAX_SCRIPT_SIZE {
+		return ErrScriptSize
+	}
+	unlock, err := parse(unlockingScript)
+	if err != nil {
+		return err
+	}
+	for _, i := range unlock {
+		if !i.push() {
+			return ErrPushOnly
+		}
+	}
+	lock, err := parse(lockingScript)
+	if err != nil {
+		return err
+	}
+	e := &engine{tx: tx}
+	if err := e.run(unlock); err != nil {
+		return err
+	}
+	if err := e.run(lock); err != nil {
+		return err
+	}
+	if len(e.stack) != 1 || !asBool(e.stack[0]) {
+		return ErrFalse
+	}
+	return nil
+}
+
+// Metodo che esegue uno script, i rami di un OP_IF non presi contano
+// solo per il bilanciamento
+func (e *engine) run(instructions []instruction) error {
+	e.conditions = e.conditions[:0]
+	for _, i := range instructions {
+		if !i.push() {
+			e.ops++
+			if e.ops > MAX_OPS {
+				return ErrOpCount
+			}
+		}
+		executing := e.executing()
+		switch {
+		case i.opcode == OP_IF || i.opcode == OP_NOTIF:
+			branch := false
+			if executing {
+				v, err := e.pop()
+				if err != nil {
+					return err
+				}
+				branch = asBool(v) == (i.opcode == OP_IF)
+			}
+			e.conditions = append(e.conditions, branch)
+			continue
+		case i.opcode == OP_ELSE:
+			if len(e.conditions) == 0 {
+				return ErrUnbalanced
+			}
+			e.conditions[len(e.conditions)-1] = !e.conditions[len(e.conditions)-1]
+			continue
+		case i.opcode == OP_ENDIF:
+			if len(e.conditions) == 0 {
+				return ErrUnbalanced
+			}
+			e.conditions = e.conditions[:len(e.conditions)-1]
+			continue
+		}
+		if !executing {
+			continue
+		}
+		if err := e.step(&i); err != nil {
+			return err
+		}
+		if len(e.stack) > MAX_STACK_SIZE {
+			return ErrStackSize
+		}
+	}
+	if len(e.conditions) != 0 {
+		return ErrUnbalanced
+	}
+	return nil
+}
+
+// Metodo che dice se si sta eseguendo un ramo preso di tutti gli
+// OP_IF aperti
+// Un OP_ELSE dentro un ramo non preso inverte un ramo che resta non
+// eseguito, perché anche quello esterno è false
+func (e *engine) executing() bool {
+	for _, c := range e.conditions {
+		if !c {
+			return false
+		}
+	}
+	return true
+}
+
+// Metodo che esegue un'istruzione fuori dai controlli del flusso
+func (e *engine) step(i *instruction) error {
+	if i.push() {
+		e.push(i.value())
+		return nil
+	}
+	switch i.opcode {
+	case OP_NOP:
+	case OP_VERIFY:
+		return e.verify()
+	case OP_RETURN:
+		return ErrVerify
+	case OP_DEPTH:
+		e.push(encodeNum(int64(len(e.stack))))
+	case OP_DROP:
+		_, err := e.pop()
+		return err
+	case OP_DUP, OP_OVER:
+		depth := 1
+		if i.opcode == OP_OVER {
+			depth = 2
+		}
+		if len(e.stack) < depth {
+			return ErrStackUnderflow
+		}
+		e.push(e.stack[len(e.stack)-depth])
+	case OP_SWAP:
+		if len(e.stack) < 2 {
+			return ErrStackUnderflow
+		}
+		n := len(e.stack)
+		e.stack[n-1], e.stack[n-2] = e.stack[n-2], e.stack[n-1]
+	case OP_SIZE:
+		if len(e.stack) < 1 {
+			return ErrStackUnderflow
+		}
+		e.push(encodeNum(int64(len(e.stack[len(e.stack)-1]))))
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, b, err := e.pop2()
+		if err != nil {
+			return err
+		}
+		e.pushBool(bytes.Equal(a, b))
+		if i.opcode == OP_EQUALVERIFY {
+			return e.verify()
+		}
+	case OP_NOT:
+		n, err := e.popNum()
+		if err != nil {
+			return err
+		}
+		e.pushBool(n == 0)
+	case OP_ADD, OP_SUB, OP_BOOLAND, OP_BOOLOR, OP_NUMEQUAL, OP_NUMEQUALVERIFY,
+		OP_LESSTHAN, OP_GREATERTHAN, OP_LESSTHANOREQUAL, OP_GREATERTHANOREQUAL:
+		return e.arithmetic(i.opcode)
+	case OP_SHA256:
+		v, err := e.pop()
+		if err != nil {
+			return err
+		}
+		h := sha256.Sum256(v)
+		e.push(h[:])
+	case OP_HASH160:
+		v, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.push(hash160(v))
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		publicKey, signature, err := e.pop2()
+		if err != nil {
+			return err
+		}
+		ok, err := e.checkSig(publicKey, signature)
+		if err != nil {
+			return err
+		}
+		e.pushBool(ok)
+		if i.opcode == OP_CHECKSIGVERIFY {
+			return e.verify()
+		}
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		if err := e.checkMultisig(); err != nil {
+			return err
+		}
+		if i.opcode == OP_CHECKMULTISIGVERIFY {
+			return e.verify()
+		}
+	case OP_CHECKLOCKTIMEVERIFY, OP_CHECKEXPIRYVERIFY:
+		return e.checkTime(i.opcode)
+	default:
+		return ErrBadOpcode
+	}
+	return nil
+}
+
+// Metodo per le operazioni su due numeri
+func (e *engine) arithmetic(op byte) error {
+	b, err := e.popNum()
+	if err != nil {
+		return err
+	}
+	a, err := e.popNum()
+	if err != nil {
+		return err
+	}
+	switch op {
+	case OP_ADD:
+		e.push(encodeNum(a + b))
+	case OP_SUB:
+		e.push(encodeNum(a - b))
+	case OP_BOOLAND:
+		e.pushBool(a != 0 && b != 0)
+	case OP_BOOLOR:
+		e.pushBool(a != 0 || b != 0)
+	case OP_NUMEQUAL, OP_NUMEQUALVERIFY:
+		e.pushBool(a == b)
+		if op == OP_NUMEQUALVERIFY {
+			return e.verify()
+		}
+	case OP_LESSTHAN:
+		e.pushBool(a < b)
+	case OP_GREATERTHAN:
+		e.pushBool(a > b)
+	case OP_LESSTHANOREQUAL:
+		e.pushBool(a <= b)
+	case OP_GREATERTHANOREQUAL:
+		e.pushBool(a >= b)
+	}
+	return nil
+}
+
+// Metodo che verifica la firma, r e s di 32 byte, della chiave
+// pubblica, X e Y di 32 byte, sul payload della transazione
+// La firma vuota dà false, una firma non vuota che non è valida è un
+// errore, così nessuno può cambiare le firme di un ramo che fallisce
+func (e *engine) checkSig(publicKey []byte, signature []byte) (bool, error) {
+	if len(publicKey) != 64 {
+		return false, ErrInvalidEncoding
+	}
+	if len(signature) == 0 {
+		return false, nil
+	}
+	if len(signature) != 64 {
+		return false, ErrInvalidEncoding
+	}
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(publicKey[:32]),
+		Y:     new(big.Int).SetBytes(publicKey[32:]),
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return false, ErrInvalidEncoding
+	}
+	hash := sha256.Sum256(e.tx.SigningPayload)
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(key, hash[:], r, s) {
+		return false, ErrNullFail
+	}
+	return true, nil
+}
+
+// Metodo per OP_CHECKMULTISIG: sullo stack ci sono le firme, il loro
+// numero m, le chiavi e il loro numero n, le firme devono essere nello
+// stesso ordine delle chiavi
+// A differenza di Bitcoin non c'è l'elemento in più
+func (e *engine) checkMultisig() error {
+	n, err := e.popNum()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > MAX_MULTISIG_KEYS {
+		return ErrInvalidNumber
+	}
+	e.ops += int(n)
+	if e.ops > MAX_OPS {
+		return ErrOpCount
+	}
+	keys := make([][]byte, n)
+	for k := int(n) - 1; k >= 0; k-- {
+		if keys[k], err = e.pop(); err != nil {
+			return err
+		}
+	}
+	m, err := e.popNum()
+	if err != nil {
+		return err
+	}
+	if m < 0 || m > n {
+		return ErrInvalidNumber
+	}
+	signatures := make([][]byte, m)
+	for k := int(m) - 1; k >= 0; k-- {
+		if signatures[k], err = e.pop(); err != nil {
+			return err
+		}
+	}
+	// Ogni firma deve essere di una chiave successiva a quella della
+	// firma precedente
+	ok := true
+	next := 0
+	for _, signature := range signatures {
+		matched := false
+		for ; next < len(keys) && !matched; next++ {
+			if len(signature) == 0 {
+				break
+			}
+			valid, err := e.checkSig(keys[next], signature)
+			if err == ErrNullFail {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			matched = valid
+		}
+		if !matched {
+			ok = false
+			break
+		}
+	}
+	if !ok {
+		// Come per OP_CHECKSIG, fallire si può solo con firme vuote
+		for _, signature := range signatures {
+			if len(signature) != 0 {
+				return ErrNullFail
+			}
+		}
+	}
+	e.pushBool(ok)
+	return nil
+}
+
+// Metodo per i limiti di tempo: il numero in cima allo stack, che
+// resta sullo stack, è un'altezza o un timestamp come valid_after e
+// valid_until
+// OP_CHECKLOCKTIMEVERIFY richiede che la transazione non possa entrare
+// in un blocco prima di quel limite, OP_CHECKEXPIRYVERIFY che non
+// possa entrarci dopo
+func (e *engine) checkTime(op byte) error {
+	if len(e.stack) < 1 {
+		return ErrStackUnderflow
+	}
+	limit, err := decodeNum(e.stack[len(e.stack)-1])
+	if err != nil {
+		return err
+	}
+	if limit < 0 {
+		return ErrVerify
+	}
+	if op == OP_CHECKLOCKTIMEVERIFY {
+		if e.tx.ValidAfter == 0 || locktime.IsHeight(e.tx.ValidAfter) != locktime.IsHeight(limit) || e.tx.ValidAfter < limit {
+			return ErrVerify
+		}
+		return nil
+	}
+	if e.tx.ValidUntil == 0 || locktime.IsHeight(e.tx.ValidUntil) != locktime.IsHeight(limit) || e.tx.ValidUntil > limit {
+		return ErrVerify
+	}
+	return nil
+}
+
+func (e *engine) verify() error {
+	v, err := e.pop()
+	if err != nil {
+		return err
+	}
+	if !asBool(v) {
+		return ErrVerify
+	}
+	return nil
+}
+
+func (e *engine) push(v []byte) {
+	e.stack = append(e.stack, v)
+}
+
+func (e *engine) pushBool(b bool) {
+	if b {
+		e.push([]byte{1})
+		return
+	}
+	e.push([]byte{})
+}
+
+func (e *engine) pop() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	v := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+	return v, nil
+}
+
+// Metodo che toglie i due elementi in cima, ritorna prima il più in
+// alto
+func (e *engine) pop2() ([]byte, []byte, error) {
+	if len(e.stack) < 2 {
+		return nil, nil, ErrStackUnderflow
+	}
+	a, _ := e.pop()
+	b, _ := e.pop()
+	return a, b, nil
+}
+
+func (e *engine) popNum() (int64, error) {
+	v, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeNum(v)
+}
+
+// Funzione che dice se un elemento è vero: falso è vuoto, solo zeri o
+// zero negativo
+func asBool(v []byte) bool {
+	for i, b := range v {
+		if b != 0 {
+			return !(i == len(v)-1 && b == 0x80)
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package script
+
+// Opcode degli script, con gli stessi valori di Bitcoin Script dove
+// esistono anche lì
+// I byte da 0x01 a 0x4b mettono sullo stack i byte che seguono, tanti
+// quanto il valore dell'opcode
+const (
+	OP_0         = 0x00
+	OP_PUSHDATA1 = 0x4c
+	OP_PUSHDATA2 = 0x4d
+	OP_1NEGATE   = 0x4f
+	OP_1         = 0x51
+	OP_16        = 0x60
+
+	// Controllo del flusso, senza salti né cicli
+	OP_NOP    = 0x61
+	OP_IF     = 0x63
+	OP_NOTIF  = 0x64
+	OP_ELSE   = 0x67
+	OP_ENDIF  = 0x68
+	OP_VERIFY = 0x69
+	OP_RETURN = 0x6a
+
+	// Stack
+	OP_DEPTH = 0x74
+	OP_DROP  = 0x75
+	OP_DUP   = 0x76
+	OP_OVER  = 0x78
+	OP_SWAP  = 0x7c
+	OP_SIZE  = 0x82
+
+	// Confronti
+	OP_EQUAL       = 0x87
+	OP_EQUALVERIFY = 0x88
+
+	// Aritmetica e logica booleana su numeri di al più MAX_NUM_SIZE byte
+	OP_NOT                = 0x91
+	OP_ADD                = 0x93
+	OP_SUB                = 0x94
+	OP_BOOLAND            = 0x9a
+	OP_BOOLOR             = 0x9b
+	OP_NUMEQUAL           = 0x9c
+	OP_NUMEQUALVERIFY     = 0x9d
+	OP_LESSTHAN           = 0x9f
+	OP_GREATERTHAN        = 0xa0
+	OP_LESSTHANOREQUAL    = 0xa1
+	OP_GREATERTHANOREQUAL = 0xa2
+
+	// Hash
+	OP_SHA256  = 0xa8
+	OP_HASH160 = 0xa9
+
+	// Firme ECDSA su P-256 del payload della transazione
+	OP_CHECKSIG            = 0xac
+	OP_CHECKSIGVERIFY      = 0xad
+	OP_CHECKMULTISIG       = 0xae
+	OP_CHECKMULTISIGVERIFY = 0xaf
+
+	// Limiti di tempo, confrontati con valid_after e valid_until della
+	// transazione
+	OP_CHECKLOCKTIMEVERIFY = 0xb1
+	// Non esiste in Bitcoin, che usa 0xb2 per OP_CHECKSEQUENCEVERIFY
+	OP_CHECKEXPIRYVERIFY = 0xb2
+)
+
+// Nomi degli opcode che non mettono dati sullo stack, per
+// l'assembler
+var opcodeNames = map[byte]string{
+	OP_1NEGATE:             "OP_1NEGATE",
+	OP_NOP:                 "OP_NOP",
+	OP_IF:                  "OP_IF",
+	OP_NOTIF:               "OP_NOTIF",
+	OP_ELSE:                "OP_ELSE",
+	OP_ENDIF:               "OP_ENDIF",
+	OP_VERIFY:              "OP_VERIFY",
+	OP_RETURN:              "OP_RETURN",
+	OP_DEPTH:               "OP_DEPTH",
+	OP_DROP:                "OP_DROP",
+	OP_DUP:                 "OP_DUP",
+	OP_OVER:                "OP_OVER",
+	OP_SWAP:                "OP_SWAP",
+	OP_SIZE:                "OP_SIZE",
+	OP_EQUAL:               "OP_EQUAL",
+	OP_EQUALVERIFY:         "OP_EQUALVERIFY",
+	OP_NOT:                 "OP_NOT",
+	OP_ADD:                 "OP_ADD",
+	OP_SUB:                 "OP_SUB",
+	OP_BOOLAND:             "OP_BOOLAND",
+	OP_BOOLOR:              "OP_BOOLOR",
+	OP_NUMEQUAL:            "OP_NUMEQUAL",
+	OP_NUMEQUALVERIFY:      "OP_NUMEQUALVERIFY",
+	OP_LESSTHAN:            "OP_LESSTHAN",
+	OP_GREATERTHAN:         "OP_GREATERTHAN",
+	OP_LESSTHANOREQUAL:     "OP_LESSTHANOREQUAL",
+	OP_GREATERTHANOREQUAL:  "OP_GREATERTHANOREQUAL",
+	OP_SHA256:              "OP_SHA256",
+	OP_HASH160:             "OP_HASH160",
+	OP_CHECKSIG:            "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:      "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+	OP_CHECKEXPIRYVERIFY:   "OP_CHECKEXPIRYVERIFY",
+}
+
+// Istruzione di uno script: l'opcode e, se mette dati sullo stack, i
+// dati
+type instruction struct {
+	opcode byte
+	data   []byte
+}
+
+// Metodo che dice se l'istruzione mette solo dati sullo stack, anche
+// i numeri da OP_1NEGATE a OP_16
+func (i *instruction) push() bool {
+	return i.opcode <= OP_16 && i.opcode != 0x50 && i.opcode != 0x4e
+}
+
+// Metodo che ritorna i dati messi sullo stack da un'istruzione push
+func (i *instruction) value() []byte {
+	switch {
+	case i.opcode == OP_1NEGATE:
+		return encodeNum(-1)
+	case i.opcode >= OP_1 && i.opcode <= OP_16:
+		return encodeNum(int64(i.opcode - OP_1 + 1))
+	}
+	return i.data
+}
+
+// Funzione che divide lo script in istruzioni, controllando che gli
+// opcode esistano e che i dati non superino MAX_ELEMENT_SIZE
+func parse(script []byte) ([]instruction, error) {
+	var instructions []instruction
+	for pc := 0; pc < len(script); {
+		op := script[pc]
+		pc++
+		var size int
+		switch {
+		case op > OP_0 && op < OP_PUSHDATA1:
+			size = int(op)
+		case op == OP_PUSHDATA1:
+			if pc+1 > len(script) {
+				return nil, ErrMalformed
+			}
+			size = int(script[pc])
+			pc++
+		case op == OP_PUSHDATA2:
+			if pc+2 > len(script) {
+				return nil, ErrMalformed
+			}
+			size = int(script[pc]) | int(script[pc+1])<<8
+			pc += 2
+		default:
+			i := instruction{opcode: op}
+			if !i.push() && opcodeNames[op] == "" {
+				return nil, ErrBadOpcode
+			}
+			instructions = append(instructions, i)
+			continue
+		}
+		if size > MAX_ELEMENT_SIZE {
+			return nil, ErrElementSize
+		}
+		if pc+size > len(script) {
+			return nil, ErrMalformed
+		}
+		instructions = append(instructions, instruction{opcode: op, data: script[pc : pc+size]})
+		pc += size
+	}
+	return instructions, nil
+}
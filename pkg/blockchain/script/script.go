@@ -0,0 +1,337 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Limiti di uno script, ogni script finisce in un numero di passi
+// limitato perché non ci sono salti né cicli
+const (
+	// Version byte degli address di uno script: iniziano con "S"
+	ADDRESS_VERSION = 0x3f
+	// Byte di uno script
+	MAX_SCRIPT_SIZE = 10000
+	// Byte di un elemento dello stack
+	MAX_ELEMENT_SIZE = 520
+	// Opcode che non mettono dati sullo stack eseguiti dai due script,
+	// ogni chiave di OP_CHECKMULTISIG conta come un opcode
+	MAX_OPS = 201
+	// Elementi dello stack
+	MAX_STACK_SIZE = 1000
+	// Chiavi di un OP_CHECKMULTISIG
+	MAX_MULTISIG_KEYS = 20
+	// Byte dei numeri, bastano per i timestamp dei limiti di tempo
+	MAX_NUM_SIZE = 5
+)
+
+var (
+	// Lo script non si può dividere in istruzioni
+	ErrMalformed = errors.New("malformed script")
+	// Opcode che non esiste
+	ErrBadOpcode = errors.New("unknown opcode")
+	// Lo script supera MAX_SCRIPT_SIZE
+	ErrScriptSize = errors.New("script too large")
+	// Un elemento supera MAX_ELEMENT_SIZE
+	ErrElementSize = errors.New("stack element too large")
+	// Gli script eseguono più di MAX_OPS opcode
+	ErrOpCount = errors.New("too many opcodes")
+	// Lo stack supera MAX_STACK_SIZE
+	ErrStackSize = errors.New("stack too large")
+	// Un opcode trova meno elementi di quelli che gli servono
+	ErrStackUnderflow = errors.New("stack underflow")
+	// OP_IF, OP_ELSE e OP_ENDIF non sono bilanciati
+	ErrUnbalanced = errors.New("unbalanced conditional")
+	// Un numero supera MAX_NUM_SIZE o non è codificato nel modo più corto
+	ErrInvalidNumber = errors.New("invalid script number")
+	// Lo script di sblocco deve solo mettere dati sullo stack
+	ErrPushOnly = errors.New("unlocking script is not push only")
+	// Chiave pubblica o firma non codificate come X e Y, r e s, di 32
+	// byte ciascuno
+	ErrInvalidEncoding = errors.New("invalid public key or signature encoding")
+	// Una firma non vuota non è valida: una verifica che deve fallire
+	// si fa con la firma vuota
+	ErrNullFail = errors.New("non empty signature failed verification")
+	// Un OP_VERIFY, OP_RETURN o un limite di tempo ha fermato lo script
+	ErrVerify = errors.New("script verification failed")
+	// Alla fine deve restare sullo stack solo un valore vero
+	ErrFalse = errors.New("script evaluated to false")
+	// Lo script di blocco non è quello dell'address del sender
+	ErrAddressMismatch = errors.New("locking script is not the one of the sender address")
+)
+
+// Funzione che calcola l'address dei fondi bloccati da uno script:
+// come per le chiavi singole, RIPEMD-160 dello SHA-256 con version
+// byte e checksum in base58, ma dello script di blocco
+// Chi invia i fondi conosce solo l'address, lo script lo rivela chi
+// li spende
+func Address(lockingScript []byte) string {
+	payload := append([]byte{ADDRESS_VERSION}, hash160(lockingScript)...)
+	return base58.Encode(append(payload, checksum(payload)...))
+}
+
+// Funzione che dice se l'address è quello di uno script
+func IsAddress(address string) bool {
+	b := base58.Decode(address)
+	if len(b) != 25 || b[0] != ADDRESS_VERSION {
+		return false
+	}
+	return bytes.Equal(b[21:], checksum(b[:21]))
+}
+
+func hash160(data []byte) []byte {
+	h := sha256.Sum256(data)
+	r := ripemd160.New()
+	r.Write(h[:])
+	return r.Sum(nil)
+}
+
+func checksum(payload []byte) []byte {
+	h1 := sha256.Sum256(payload)
+	h2 := sha256.Sum256(h1[:])
+	return h2[:4]
+}
+
+// Witness di una transazione che spende i fondi di uno script: lo
+// script di blocco, che deve dare l'address del sender, e lo script
+// di sblocco, che mette sullo stack firme, preimage e scelte dei rami,
+// in esadecimale
+// Il witness non fa parte del payload firmato, come quello multisig
+type Witness struct {
+	LockingScript   string `json:"locking_script"`
+	UnlockingScript string `json:"unlocking_script"`
+}
+
+// Metodo che controlla la forma del witness, senza eseguire gli script
+func (w *Witness) Validate() error {
+	lock, unlock, err := w.decode()
+	if err != nil {
+		return err
+	}
+	if len(lock) == 0 {
+		return fmt.Errorf("%w: empty locking script", ErrMalformed)
+	}
+	if len(lock) > MAX_SCRIPT_SIZE || len(unlock) > MAX_SCRIPT_SIZE {
+		return ErrScriptSize
+	}
+	return nil
+}
+
+// Metodo che verifica la spesa dei fondi dell'address sender: lo
+// script di blocco deve essere quello dell'address e, eseguito dopo
+// lo script di sblocco, deve lasciare sullo stack solo un valore vero
+func (w *Witness) Verify(sender string, tx *Tx) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	lock, unlock, _ := w.decode()
+	if Address(lock) != sender {
+		return ErrAddressMismatch
+	}
+	return Execute(unlock, lock, tx)
+}
+
+func (w *Witness) decode() ([]byte, []byte, error) {
+	lock, err := hex.DecodeString(w.LockingScript)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: locking_script is not hex", ErrMalformed)
+	}
+	unlock, err := hex.DecodeString(w.UnlockingScript)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: unlocking_script is not hex", ErrMalformed)
+	}
+	return lock, unlock, nil
+}
+
+// Funzione che ritorna lo schema OpenAPI del witness
+func Schema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"locking_script":   openapi.String("hex script that gives the sender address"),
+		"unlocking_script": openapi.String("hex script with only pushes, run before the locking script"),
+	}, "locking_script", "unlocking_script")
+}
+
+// Funzione che converte uno script dalla forma testuale, con gli
+// opcode per nome separati da spazi, i numeri in decimale e i dati in
+// esadecimale, per esempio
+//
+//	OP_DUP OP_HASH160 <hex> OP_EQUALVERIFY OP_CHECKSIG
+//
+// I dati tra < e > non vengono mai letti come numeri, "OP_0" o
+// "OP_FALSE" e "OP_TRUE" sono 0 e 1
+func Assemble(asm string) ([]byte, error) {
+	var script []byte
+	for _, token := range strings.Fields(asm) {
+		// Quello tra < e > è sempre un dato, anche se sembra un numero
+		if strings.HasPrefix(token, "<") && strings.HasSuffix(token, ">") {
+			data, err := hex.DecodeString(token[1 : len(token)-1])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s is not hex data", ErrMalformed, token)
+			}
+			if len(data) > MAX_ELEMENT_SIZE {
+				return nil, ErrElementSize
+			}
+			script = append(script, pushData(data)...)
+			continue
+		}
+		upper := strings.ToUpper(token)
+		if !strings.HasPrefix(upper, "OP_") {
+			upper = "OP_" + upper
+		}
+		switch upper {
+		case "OP_0", "OP_FALSE":
+			script = append(script, OP_0)
+			continue
+		case "OP_TRUE":
+			script = append(script, OP_1)
+			continue
+		}
+		if op, ok := opcodeByName(upper); ok {
+			script = append(script, op)
+			continue
+		}
+		if n, err := strconv.Atoi(upper[3:]); err == nil && n >= 1 && n <= 16 {
+			script = append(script, byte(OP_1+n-1))
+			continue
+		}
+		if n, err := strconv.ParseInt(token, 10, 64); err == nil && len(encodeNum(n)) <= MAX_NUM_SIZE {
+			script = append(script, pushNum(n)...)
+			continue
+		}
+		data, err := hex.DecodeString(strings.TrimPrefix(token, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not an opcode, a number or hex data", ErrMalformed, token)
+		}
+		if len(data) > MAX_ELEMENT_SIZE {
+			return nil, ErrElementSize
+		}
+		script = append(script, pushData(data)...)
+	}
+	if len(script) > MAX_SCRIPT_SIZE {
+		return nil, ErrScriptSize
+	}
+	return script, nil
+}
+
+// Funzione che ritorna la forma testuale di uno script, i dati sono
+// in esadecimale tra < e > e i numeri da -1 a 16 in decimale
+func Disassemble(script []byte) (string, error) {
+	instructions, err := parse(script)
+	if err != nil {
+		return "", err
+	}
+	tokens := make([]string, 0, len(instructions))
+	for _, i := range instructions {
+		switch {
+		case i.opcode == OP_0:
+			tokens = append(tokens, "OP_0")
+		case i.opcode == OP_1NEGATE || (i.opcode >= OP_1 && i.opcode <= OP_16):
+			n, _ := decodeNum(i.value())
+			tokens = append(tokens, strconv.FormatInt(n, 10))
+		case i.push():
+			tokens = append(tokens, "<"+hex.EncodeToString(i.data)+">")
+		default:
+			tokens = append(tokens, opcodeNames[i.opcode])
+		}
+	}
+	return strings.Join(tokens, " "), nil
+}
+
+func opcodeByName(name string) (byte, bool) {
+	for op, n := range opcodeNames {
+		if n == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+// Funzione che ritorna l'istruzione più corta che mette i dati sullo
+// stack
+func pushData(data []byte) []byte {
+	switch {
+	case len(data) < OP_PUSHDATA1:
+		return append([]byte{byte(len(data))}, data...)
+	case len(data) <= 0xff:
+		return append([]byte{OP_PUSHDATA1, byte(len(data))}, data...)
+	}
+	size := make([]byte, 2)
+	binary.LittleEndian.PutUint16(size, uint16(len(data)))
+	return append(append([]byte{OP_PUSHDATA2}, size...), data...)
+}
+
+// Funzione che ritorna l'istruzione più corta che mette il numero
+// sullo stack
+func pushNum(n int64) []byte {
+	switch {
+	case n == 0:
+		return []byte{OP_0}
+	case n == -1:
+		return []byte{OP_1NEGATE}
+	case n >= 1 && n <= 16:
+		return []byte{byte(OP_1 + n - 1)}
+	}
+	return pushData(encodeNum(n))
+}
+
+// Funzione che codifica un numero come in Bitcoin Script: little
+// endian con il segno nel bit più alto dell'ultimo byte, zero è vuoto
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	var b []byte
+	for n > 0 {
+		b = append(b, byte(n&0xff))
+		n >>= 8
+	}
+	if b[len(b)-1]&0x80 != 0 {
+		if negative {
+			b = append(b, 0x80)
+		} else {
+			b = append(b, 0x00)
+		}
+	} else if negative {
+		b[len(b)-1] |= 0x80
+	}
+	return b
+}
+
+// Funzione che decodifica un numero di al più MAX_NUM_SIZE byte,
+// codificato nel modo più corto
+func decodeNum(b []byte) (int64, error) {
+	if len(b) > MAX_NUM_SIZE {
+		return 0, ErrInvalidNumber
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	// Il byte più alto serve solo se contiene il segno
+	last := b[len(b)-1]
+	if last&0x7f == 0 && (len(b) == 1 || b[len(b)-2]&0x80 == 0) {
+		return 0, ErrInvalidNumber
+	}
+	var n int64
+	for i, c := range b {
+		n |= int64(c) << (8 * i)
+	}
+	if last&0x80 != 0 {
+		n &^= int64(0x80) << (8 * (len(b) - 1))
+		return -n, nil
+	}
+	return n, nil
+}
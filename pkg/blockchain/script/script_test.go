@@ -0,0 +1,287 @@
+package script
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Funzione che assembla uno script del test
+func asm(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := Assemble(s)
+	check(t, err)
+	return b
+}
+
+// Chiave per le firme degli script
+type key struct {
+	*ecdsa.PrivateKey
+}
+
+func newKey(t *testing.T) *key {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	check(t, err)
+	return &key{k}
+}
+
+// Metodo che ritorna la chiave pubblica come la legge OP_CHECKSIG,
+// X e Y di 32 byte, tra < e >
+func (k *key) public() string {
+	b := make([]byte, 64)
+	k.X.FillBytes(b[:32])
+	k.Y.FillBytes(b[32:])
+	return "<" + hex.EncodeToString(b) + ">"
+}
+
+// Metodo che firma il payload, r e s di 32 byte, tra < e >
+func (k *key) sign(t *testing.T, payload []byte) string {
+	t.Helper()
+	hash := sha256.Sum256(payload)
+	r, s, err := ecdsa.Sign(rand.Reader, k.PrivateKey, hash[:])
+	check(t, err)
+	b := make([]byte, 64)
+	r.FillBytes(b[:32])
+	s.FillBytes(b[32:])
+	return "<" + hex.EncodeToString(b) + ">"
+}
+
+type scriptTest struct {
+	unlock   string
+	lock     string
+	expected error
+}
+
+// Funzione che esegue gli script dei test con la transazione tx
+func run(t *testing.T, tests map[string]scriptTest, tx *Tx) {
+	t.Helper()
+	for name, test := range tests {
+		err := Execute(asm(t, test.unlock), asm(t, test.lock), tx)
+		if test.expected == nil && err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if test.expected != nil && !errors.Is(err, test.expected) {
+			t.Errorf("%s: %v, expected %v", name, err, test.expected)
+		}
+	}
+}
+
+// Esecuzione, stack, numeri e rami
+func TestExecute(t *testing.T) {
+	run(t, map[string]scriptTest{
+		"add":             {"1 2", "OP_ADD 3 OP_EQUAL", nil},
+		"negative":        {"-5 3", "OP_ADD -2 OP_NUMEQUAL", nil},
+		"hash":            {"<61>", "OP_SHA256 <ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb> OP_EQUAL", nil},
+		"false":           {"", "0", ErrFalse},
+		"two values":      {"", "1 1", ErrFalse},
+		"negative zero":   {"", "<80>", ErrFalse},
+		"empty":           {"", "", ErrFalse},
+		"push only":       {"1 OP_DUP", "OP_EQUAL", ErrPushOnly},
+		"underflow":       {"1", "OP_ADD", ErrStackUnderflow},
+		"drop underflow":  {"", "OP_DROP", ErrStackUnderflow},
+		"verify":          {"1 2", "OP_EQUALVERIFY 1", ErrVerify},
+		"return":          {"", "OP_RETURN 1", ErrVerify},
+		"long number":     {"<0000000001>", "1 OP_ADD OP_DROP 1", nil},
+		"too long number": {"<000000000001>", "1 OP_ADD", ErrInvalidNumber},
+		"not minimal":     {"<0100>", "1 OP_ADD", ErrInvalidNumber},
+		"not minimal neg": {"<0180>", "1 OP_ADD", ErrInvalidNumber},
+	}, &Tx{})
+}
+
+// OP_IF e OP_ELSE annidati: un OP_ELSE in un ramo non preso non
+// esegue niente, e i rami devono essere chiusi nello stesso script
+func TestConditionals(t *testing.T) {
+	const nested = "OP_IF OP_IF 2 OP_ELSE 3 OP_ENDIF OP_ELSE OP_IF 4 OP_ELSE 5 OP_ENDIF OP_ENDIF"
+	run(t, map[string]scriptTest{
+		"true true":       {"1 1", nested + " 2 OP_EQUAL", nil},
+		"true false":      {"0 1", nested + " 3 OP_EQUAL", nil},
+		"false true":      {"1 0", nested + " 4 OP_EQUAL", nil},
+		"false false":     {"0 0", nested + " 5 OP_EQUAL", nil},
+		"skipped else":    {"0", "OP_IF 1 OP_IF 2 OP_ELSE 3 OP_ENDIF OP_ELSE 4 OP_ENDIF 4 OP_EQUAL", nil},
+		"notif":           {"0", "OP_NOTIF 1 OP_ELSE 0 OP_ENDIF", nil},
+		"skipped return":  {"0", "OP_IF OP_RETURN OP_ENDIF 1", nil},
+		"skipped pop":     {"0", "OP_IF OP_DROP OP_DROP OP_ENDIF 1", nil},
+		"double else":     {"1", "OP_IF 0 OP_ELSE 1 OP_ELSE 1 OP_ENDIF", ErrFalse},
+		"else first":      {"", "OP_ELSE 1 OP_ENDIF", ErrUnbalanced},
+		"endif first":     {"", "1 OP_ENDIF", ErrUnbalanced},
+		"not closed":      {"1", "OP_IF 1", ErrUnbalanced},
+		"nested open":     {"1 1", "OP_IF OP_IF 1 OP_ENDIF", ErrUnbalanced},
+		"if without cond": {"", "OP_IF 1 OP_ENDIF", ErrStackUnderflow},
+	}, &Tx{})
+}
+
+// Limiti di dimensione, di opcode e dello stack
+func TestLimits(t *testing.T) {
+	ones := strings.Repeat("1 ", MAX_STACK_SIZE)
+	nops := func(n int) string {
+		return strings.Repeat("OP_NOP ", n)
+	}
+	keys := strings.Repeat("<"+strings.Repeat("00", 64)+"> ", MAX_MULTISIG_KEYS)
+	run(t, map[string]scriptTest{
+		"max ops":          {"", nops(MAX_OPS) + "1", nil},
+		"too many ops":     {"", nops(MAX_OPS+1) + "1", ErrOpCount},
+		"skipped ops":      {"0", "OP_IF " + nops(MAX_OPS) + "OP_ENDIF 1", ErrOpCount},
+		"pushes are free":  {"0", "OP_IF " + ones[2*MAX_OPS:] + "OP_ENDIF " + nops(MAX_OPS-2) + "1", nil},
+		"max stack":        {ones, "OP_DEPTH", ErrStackSize},
+		"stack":            {ones[2:], "OP_DEPTH OP_DROP", ErrFalse},
+		"multisig keys":    {"", "0 " + keys + "20 OP_CHECKMULTISIG " + nops(MAX_OPS-MAX_MULTISIG_KEYS-2) + "OP_VERIFY 1", nil},
+		"multisig ops":     {"", "0 " + keys + "20 OP_CHECKMULTISIG " + nops(MAX_OPS-MAX_MULTISIG_KEYS-1) + "OP_VERIFY 1", ErrOpCount},
+		"too many keys":    {"", "0 " + keys + "<00> 21 OP_CHECKMULTISIG", ErrInvalidNumber},
+		"more sigs than n": {"", "0 0 2 <00> 1 OP_CHECKMULTISIG", ErrInvalidNumber},
+	}, &Tx{})
+
+	big := make([]byte, MAX_SCRIPT_SIZE+1)
+	if err := Execute(nil, big, &Tx{}); !errors.Is(err, ErrScriptSize) {
+		t.Errorf("large script: %v, expected %v", err, ErrScriptSize)
+	}
+	if _, err := Assemble("<" + strings.Repeat("00", MAX_ELEMENT_SIZE+1) + ">"); !errors.Is(err, ErrElementSize) {
+		t.Errorf("large element: %v, expected %v", err, ErrElementSize)
+	}
+}
+
+// Script che non si dividono in istruzioni
+func TestMalformed(t *testing.T) {
+	element := append([]byte{OP_PUSHDATA2, 0x09, 0x02}, make([]byte, MAX_ELEMENT_SIZE+1)...)
+	tests := map[string]struct {
+		script   []byte
+		expected error
+	}{
+		"short push":      {[]byte{0x05, 0x01, 0x02}, ErrMalformed},
+		"pushdata1":       {[]byte{OP_PUSHDATA1}, ErrMalformed},
+		"short pushdata1": {[]byte{OP_PUSHDATA1, 0x03, 0x01}, ErrMalformed},
+		"pushdata2":       {[]byte{OP_PUSHDATA2, 0x01}, ErrMalformed},
+		"short pushdata2": {[]byte{OP_PUSHDATA2, 0x02, 0x00, 0x01}, ErrMalformed},
+		"large element":   {element, ErrElementSize},
+		"unknown opcode":  {[]byte{OP_1, 0xff}, ErrBadOpcode},
+		"reserved opcode": {[]byte{0x50}, ErrBadOpcode},
+		"pushdata4":       {[]byte{0x4e, 0x01, 0x00, 0x00, 0x00, 0x01}, ErrBadOpcode},
+	}
+	for name, test := range tests {
+		if err := Execute(nil, test.script, &Tx{}); !errors.Is(err, test.expected) {
+			t.Errorf("%s locking: %v, expected %v", name, err, test.expected)
+		}
+		if err := Execute(test.script, []byte{OP_1}, &Tx{}); !errors.Is(err, test.expected) {
+			t.Errorf("%s unlocking: %v, expected %v", name, err, test.expected)
+		}
+		if _, err := Disassemble(test.script); !errors.Is(err, test.expected) {
+			t.Errorf("%s disassembled: %v, expected %v", name, err, test.expected)
+		}
+	}
+
+	// Le push si leggono anche con OP_PUSHDATA1 e OP_PUSHDATA2
+	for _, script := range [][]byte{{OP_PUSHDATA1, 0x01, 0x07}, {OP_PUSHDATA2, 0x01, 0x00, 0x07}} {
+		check(t, Execute(script, []byte{0x57, OP_EQUAL}, &Tx{}))
+	}
+}
+
+// Firme singole e OP_CHECKMULTISIG: le firme vanno nell'ordine delle
+// chiavi, ogni chiave firma una volta e una firma non valida non
+// vuota è un errore
+func TestCheckSig(t *testing.T) {
+	payload := []byte(`{"value":1}`)
+	tx := &Tx{SigningPayload: payload}
+	a, b, c, outsider := newKey(t), newKey(t), newKey(t), newKey(t)
+	sa, sb, sc := a.sign(t, payload), b.sign(t, payload), c.sign(t, payload)
+	multisig := "2 " + a.public() + " " + b.public() + " " + c.public() + " 3 OP_CHECKMULTISIG"
+	run(t, map[string]scriptTest{
+		"checksig":           {sa, a.public() + " OP_CHECKSIG", nil},
+		"other key":          {sa, b.public() + " OP_CHECKSIG", ErrNullFail},
+		"other payload":      {a.sign(t, []byte("other")), a.public() + " OP_CHECKSIG", ErrNullFail},
+		"empty signature":    {"0", a.public() + " OP_CHECKSIG OP_NOT", nil},
+		"short signature":    {"<" + strings.Repeat("01", 63) + ">", a.public() + " OP_CHECKSIG", ErrInvalidEncoding},
+		"short key":          {sa, "<" + strings.Repeat("01", 63) + "> OP_CHECKSIG", ErrInvalidEncoding},
+		"key off curve":      {sa, "<" + strings.Repeat("01", 64) + "> OP_CHECKSIG", ErrInvalidEncoding},
+		"a b":                {sa + " " + sb, multisig, nil},
+		"a c":                {sa + " " + sc, multisig, nil},
+		"b c":                {sb + " " + sc, multisig, nil},
+		"wrong order":        {sc + " " + sa, multisig, ErrNullFail},
+		"duplicate":          {sa + " " + sa, multisig, ErrNullFail},
+		"outsider":           {sa + " " + outsider.sign(t, payload), multisig, ErrNullFail},
+		"one signature":      {sa, multisig, ErrStackUnderflow},
+		"empty signatures":   {"0 0", multisig + " OP_NOT", nil},
+		"one empty":          {sa + " 0", multisig, ErrNullFail},
+		"verify":             {sa + " " + sb, "2 " + a.public() + " " + b.public() + " 2 OP_CHECKMULTISIGVERIFY 1", nil},
+		"verify empty":       {"0 0", "2 " + a.public() + " " + b.public() + " 2 OP_CHECKMULTISIGVERIFY 1", ErrVerify},
+		"checksigverify":     {sb + " " + sa, a.public() + " OP_CHECKSIGVERIFY " + b.public() + " OP_CHECKSIG", nil},
+		"branch of key":      {sb + " 0", "OP_IF " + a.public() + " OP_ELSE " + b.public() + " OP_ENDIF OP_CHECKSIG", nil},
+		"branch of key fail": {sb + " 1", "OP_IF " + a.public() + " OP_ELSE " + b.public() + " OP_ENDIF OP_CHECKSIG", ErrNullFail},
+	}, tx)
+}
+
+// OP_CHECKLOCKTIMEVERIFY e OP_CHECKEXPIRYVERIFY confrontano il limite
+// con valid_after e valid_until, che devono essere dello stesso tipo:
+// altezze o timestamp
+func TestTimeLocks(t *testing.T) {
+	const timestamp = 1700000000
+	tests := []struct {
+		lock       string
+		validAfter int64
+		validUntil int64
+		expected   error
+	}{
+		{"100 OP_CHECKLOCKTIMEVERIFY", 100, 0, nil},
+		{"100 OP_CHECKLOCKTIMEVERIFY", 150, 0, nil},
+		{"100 OP_CHECKLOCKTIMEVERIFY", 99, 0, ErrVerify},
+		{"100 OP_CHECKLOCKTIMEVERIFY", 0, 0, ErrVerify},
+		{"100 OP_CHECKLOCKTIMEVERIFY", timestamp, 0, ErrVerify},
+		{"1700000000 OP_CHECKLOCKTIMEVERIFY", timestamp, 0, nil},
+		{"1700000000 OP_CHECKLOCKTIMEVERIFY", timestamp - 1, 0, ErrVerify},
+		{"-1 OP_CHECKLOCKTIMEVERIFY", 100, 0, ErrVerify},
+		{"OP_CHECKLOCKTIMEVERIFY", 100, 0, ErrStackUnderflow},
+		{"100 OP_CHECKEXPIRYVERIFY", 0, 100, nil},
+		{"100 OP_CHECKEXPIRYVERIFY", 0, 50, nil},
+		{"100 OP_CHECKEXPIRYVERIFY", 0, 101, ErrVerify},
+		{"100 OP_CHECKEXPIRYVERIFY", 0, 0, ErrVerify},
+		{"1700000000 OP_CHECKEXPIRYVERIFY", 0, 100, ErrVerify},
+	}
+	for _, test := range tests {
+		// Il limite resta sullo stack
+		err := Execute(nil, asm(t, test.lock+" OP_DROP 1"), &Tx{ValidAfter: test.validAfter, ValidUntil: test.validUntil})
+		if test.expected == nil && err != nil {
+			t.Errorf("%s with %d and %d: %v", test.lock, test.validAfter, test.validUntil, err)
+		}
+		if test.expected != nil && !errors.Is(err, test.expected) {
+			t.Errorf("%s with %d and %d: %v, expected %v", test.lock, test.validAfter, test.validUntil, err, test.expected)
+		}
+	}
+}
+
+// Il witness spende solo i fondi dell'address del suo script di
+// blocco, e la forma testuale torna lo stesso script
+func TestWitness(t *testing.T) {
+	lock := asm(t, "OP_SHA256 <ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb> OP_EQUAL")
+	address := Address(lock)
+	if !IsAddress(address) || !strings.HasPrefix(address, "S") {
+		t.Fatalf("script address %s", address)
+	}
+	w := &Witness{LockingScript: hex.EncodeToString(lock), UnlockingScript: hex.EncodeToString(asm(t, "<61>"))}
+	check(t, w.Verify(address, &Tx{}))
+	if err := w.Verify(Address(asm(t, "1")), &Tx{}); !errors.Is(err, ErrAddressMismatch) {
+		t.Fatalf("other address: %v, expected %v", err, ErrAddressMismatch)
+	}
+	w.UnlockingScript = "zz"
+	if err := w.Verify(address, &Tx{}); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("not hex: %v, expected %v", err, ErrMalformed)
+	}
+
+	text := "OP_DUP OP_HASH160 <89abcdefabbaabbaabbaabbaabbaabbaabbaabba> OP_EQUALVERIFY OP_CHECKSIG -1 0 16 1000 <01>"
+	disassembled, err := Disassemble(asm(t, text))
+	check(t, err)
+	if disassembled != strings.Replace(strings.Replace(text, " 0 ", " OP_0 ", 1), "1000", "<e803>", 1) {
+		t.Fatalf("disassembled %q", disassembled)
+	}
+}
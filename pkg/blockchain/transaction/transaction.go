@@ -1,16 +1,59 @@
 package transaction
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/locktime"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/script"
 )
 
 // Transazione, contiene solo address del sender, del recipient e il valore inviato
+// Le transazioni firmate con la chiave del sender hanno SenderPublicKey
+// e Signature, in esadecimale, che restano nel blocco così gli altri
+// nodi le possono verificare
+// Le transazioni di un account multisig hanno anche il Witness, con la
+// policy e le firme, che resta nel blocco così gli altri nodi le
+// possono verificare, quelle che spendono i fondi di un contratto
+// HTLC hanno Htlc, con il contratto e il preimage, e quelle che
+// spendono i fondi di uno script hanno Script, con lo script di blocco
+// e quello di sblocco
+// Le transazioni dei contratti hanno Contract, con il codice da
+// pubblicare o gli argomenti della chiamata, che fa parte del payload
+// firmato, e quelle dei token hanno Asset, con l'operazione sul token,
+// anche questa firmata
+// ValidAfter e ValidUntil, se diversi da zero, limitano i blocchi in
+// cui la transazione può entrare: sono altezze di blocco o timestamp
+// unix in secondi, vedi locktime, e fanno parte del payload firmato
+// ChainID è la rete per cui la transazione è stata firmata, così la
+// firma non vale sulle altre reti, manca solo nelle coinbase
+// Nonce, scelto a caso da chi firma, distingue due transazioni che
+// altrimenti sarebbero uguali: una catena non accetta due volte lo
+// stesso payload firmato, vedi ID
 type Transaction struct {
 	SenderBlockchainAddress    string
 	RecipientBlockchainAddress string
 	Value                      float32
+	SenderPublicKey            string
+	Signature                  string
+	ValidAfter                 int64
+	ValidUntil                 int64
+	ChainID                    string
+	Nonce                      uint64
+	Witness                    *multisig.Witness
+	Htlc                       *htlc.Spend
+	Script                     *script.Witness
+	Contract                   *contract.Message
+	Asset                      *asset.Operation
 }
 
 // Funzione per creare nuova transazione, tipo di ritorno puntatore a Transaction
@@ -20,7 +63,73 @@ type Transaction struct {
 //			   puntatore "*Transaction"
 // Passo i parametri e creo nuova transazione
 func NewTransaction(sender string, recipient string, value float32) *Transaction {
-	return &Transaction{sender, recipient, value}
+	return &Transaction{SenderBlockchainAddress: sender, RecipientBlockchainAddress: recipient, Value: value}
+}
+
+// Metodo che ritorna i byte firmati dal sender: il json della
+// transazione senza la chiave pubblica e la firma, senza il Witness,
+// che contiene le firme, senza Htlc e senza Script
+func (t *Transaction) SigningPayload() []byte {
+	c := *t
+	c.SenderPublicKey, c.Signature = "", ""
+	c.Witness, c.Htlc, c.Script = nil, nil, nil
+	m, _ := json.Marshal(&c)
+	return m
+}
+
+// Metodo che ritorna l'identificativo della transazione, lo SHA-256
+// in esadecimale del payload firmato: firme e witness non contano,
+// così rifirmare lo stesso payload non ne fa una transazione nuova
+func (t *Transaction) ID() string {
+	return fmt.Sprintf("%x", sha256.Sum256(t.SigningPayload()))
+}
+
+// Funzione che ritorna un nonce casuale per una nuova transazione,
+// minore di 2^53 così anche JavaScript lo legge senza arrotondarlo
+// Se la lettura fallisce il nonce è 0, che resta valido
+func NewNonce() uint64 {
+	var b [8]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint64(b[:]) >> 11
+}
+
+// Metodo che dice se la transazione non può ancora entrare nel blocco
+// all'altezza height con il timestamp in nanosecondi dei blocchi
+func (t *Transaction) Premature(height int, timestamp int64) bool {
+	return t.ValidAfter != 0 && !locktime.Reached(t.ValidAfter, height, timestamp)
+}
+
+// Metodo che dice se la transazione non può più entrare nel blocco
+// all'altezza height con il timestamp, né in quelli successivi
+func (t *Transaction) Expired(height int, timestamp int64) bool {
+	return t.ValidUntil != 0 && locktime.Reached(t.ValidUntil+1, height, timestamp)
+}
+
+// Metodo che dice se la transazione può entrare nel blocco
+func (t *Transaction) ValidAt(height int, timestamp int64) bool {
+	return !t.Premature(height, timestamp) && !t.Expired(height, timestamp)
+}
+
+// Metodo che dice se due transazioni sono uguali, chiave pubblica,
+// firma, ChainID, Nonce, Witness, Htlc, Script, Contract e Asset compresi
+func (t *Transaction) Equal(o *Transaction) bool {
+	if t.SenderBlockchainAddress != o.SenderBlockchainAddress || t.RecipientBlockchainAddress != o.RecipientBlockchainAddress || t.Value != o.Value {
+		return false
+	}
+	if t.SenderPublicKey != o.SenderPublicKey || t.Signature != o.Signature {
+		return false
+	}
+	if t.ValidAfter != o.ValidAfter || t.ValidUntil != o.ValidUntil || t.ChainID != o.ChainID || t.Nonce != o.Nonce {
+		return false
+	}
+	return equalJson(t.Witness, o.Witness) && equalJson(t.Htlc, o.Htlc) && equalJson(t.Script, o.Script) && equalJson(t.Contract, o.Contract) && equalJson(t.Asset, o.Asset)
+}
+
+// Funzione che confronta il json di due campi, un puntatore nil è null
+func equalJson(t interface{}, o interface{}) bool {
+	tj, _ := json.Marshal(t)
+	oj, _ := json.Marshal(o)
+	return bytes.Equal(tj, oj)
 }
 
 // Questo è un metodo, perché viene specificato un receiver (t *Transaction).
@@ -37,25 +146,69 @@ func (t *Transaction) Print() {
 // Anche in questo caso si tratta di un metodo, serve a formattare il json
 func (t *Transaction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Sender    string  `json:"sender_blockchain_address"`
-		Recipient string  `json:"recipient_blockchain_address"`
-		Value     float32 `json:"value"`
+		Sender     string            `json:"sender_blockchain_address"`
+		Recipient  string            `json:"recipient_blockchain_address"`
+		Value      float32           `json:"value"`
+		PublicKey  string            `json:"sender_public_key,omitempty"`
+		Signature  string            `json:"signature,omitempty"`
+		ValidAfter int64             `json:"valid_after,omitempty"`
+		ValidUntil int64             `json:"valid_until,omitempty"`
+		ChainID    string            `json:"chain_id,omitempty"`
+		Nonce      uint64            `json:"nonce,omitempty"`
+		Witness    *multisig.Witness `json:"witness,omitempty"`
+		Htlc       *htlc.Spend       `json:"htlc,omitempty"`
+		Script     *script.Witness   `json:"script,omitempty"`
+		Contract   *contract.Message `json:"contract,omitempty"`
+		Asset      *asset.Operation  `json:"asset,omitempty"`
 	}{
-		Sender:    t.SenderBlockchainAddress,
-		Recipient: t.RecipientBlockchainAddress,
-		Value:     t.Value,
+		Sender:     t.SenderBlockchainAddress,
+		Recipient:  t.RecipientBlockchainAddress,
+		Value:      t.Value,
+		PublicKey:  t.SenderPublicKey,
+		Signature:  t.Signature,
+		ValidAfter: t.ValidAfter,
+		ValidUntil: t.ValidUntil,
+		ChainID:    t.ChainID,
+		Nonce:      t.Nonce,
+		Witness:    t.Witness,
+		Htlc:       t.Htlc,
+		Script:     t.Script,
+		Contract:   t.Contract,
+		Asset:      t.Asset,
 	})
 }
 
 func (t *Transaction) UnmarshalJSON(data []byte) error {
 	v := &struct {
-		Sender    *string  `json:"sender_blockchain_address"`
-		Recipient *string  `json:"recipient_blockchain_address"`
-		Value     *float32 `json:"value"`
+		Sender     *string            `json:"sender_blockchain_address"`
+		Recipient  *string            `json:"recipient_blockchain_address"`
+		Value      *float32           `json:"value"`
+		PublicKey  *string            `json:"sender_public_key"`
+		Signature  *string            `json:"signature"`
+		ValidAfter *int64             `json:"valid_after"`
+		ValidUntil *int64             `json:"valid_until"`
+		ChainID    *string            `json:"chain_id"`
+		Nonce      *uint64            `json:"nonce"`
+		Witness    **multisig.Witness `json:"witness"`
+		Htlc       **htlc.Spend       `json:"htlc"`
+		Script     **script.Witness   `json:"script"`
+		Contract   **contract.Message `json:"contract"`
+		Asset      **asset.Operation  `json:"asset"`
 	}{
-		Sender:    &t.SenderBlockchainAddress,
-		Recipient: &t.RecipientBlockchainAddress,
-		Value:     &t.Value,
+		Sender:     &t.SenderBlockchainAddress,
+		Recipient:  &t.RecipientBlockchainAddress,
+		Value:      &t.Value,
+		PublicKey:  &t.SenderPublicKey,
+		Signature:  &t.Signature,
+		ValidAfter: &t.ValidAfter,
+		ValidUntil: &t.ValidUntil,
+		ChainID:    &t.ChainID,
+		Nonce:      &t.Nonce,
+		Witness:    &t.Witness,
+		Htlc:       &t.Htlc,
+		Script:     &t.Script,
+		Contract:   &t.Contract,
+		Asset:      &t.Asset,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
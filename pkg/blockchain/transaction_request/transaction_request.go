@@ -1,22 +1,165 @@
 package transaction_request
 
+import (
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/locktime"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/script"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+)
+
 // Richiesta di transazione lato server
+// Le transazioni degli account multisig hanno il Witness al posto
+// di SenderPublicKey e Signature, quelle che spendono i fondi di un
+// contratto HTLC hanno Htlc e nessuna firma, quelle che spendono i
+// fondi di uno script hanno Script, con le firme nello script di
+// sblocco
+// Le transazioni dei contratti hanno Contract, firmato con il resto
+// della transazione, quelle dei token hanno Asset
+// ValidAfter e ValidUntil sono facoltativi e fanno parte del payload
+// firmato, come ChainID, la rete per cui la transazione è firmata, e
+// Nonce, vedi blockchain_transaction.Transaction
 type TransactionRequest struct {
-	SenderBlockchainAddress    *string  `json:"sender_blockchain_address"`
-	RecipientBlockchainAddress *string  `json:"recipient_blockchain_address"`
-	SenderPublicKey            *string  `json:"sender_public_key"`
-	Value                      *float32 `json:"value"`
-	Signature                  *string  `json:"signature"`
+	SenderBlockchainAddress    *string           `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress *string           `json:"recipient_blockchain_address"`
+	SenderPublicKey            *string           `json:"sender_public_key,omitempty"`
+	Value                      *float32          `json:"value"`
+	ValidAfter                 *int64            `json:"valid_after,omitempty"`
+	ValidUntil                 *int64            `json:"valid_until,omitempty"`
+	ChainID                    *string           `json:"chain_id,omitempty"`
+	Nonce                      *uint64           `json:"nonce,omitempty"`
+	Signature                  *string           `json:"signature,omitempty"`
+	Witness                    *multisig.Witness `json:"witness,omitempty"`
+	Htlc                       *htlc.Spend       `json:"htlc,omitempty"`
+	Script                     *script.Witness   `json:"script,omitempty"`
+	Contract                   *contract.Message `json:"contract,omitempty"`
+	Asset                      *asset.Operation  `json:"asset,omitempty"`
 }
 
 // Valida la richiesta, controllando che ci siano tutti i dati necessari
-func (tr *TransactionRequest) Validate() bool {
-	if tr.SenderBlockchainAddress == nil ||
-		tr.RecipientBlockchainAddress == nil ||
-		tr.SenderPublicKey == nil ||
-		tr.Value == nil ||
-		tr.Signature == nil {
-		return false
-	}
-	return true
+// Ritorna un *api_error.ApiError con il campo che manca o non è valido
+func (tr *TransactionRequest) Validate() error {
+	// Il witness, i dati dell'HTLC e gli script sostituiscono chiave
+	// pubblica e firma
+	unsigned := tr.Witness != nil || tr.Htlc != nil || tr.Script != nil
+	switch {
+	case tr.SenderBlockchainAddress == nil:
+		return api_error.MissingField("sender_blockchain_address")
+	case tr.RecipientBlockchainAddress == nil:
+		return api_error.MissingField("recipient_blockchain_address")
+	case !unsigned && tr.SenderPublicKey == nil:
+		return api_error.MissingField("sender_public_key")
+	case tr.Value == nil:
+		return api_error.MissingField("value")
+	case !unsigned && tr.Signature == nil:
+		return api_error.MissingField("signature")
+	}
+	if err := ValidateWindow(tr.ValidAfter, tr.ValidUntil); err != nil {
+		return err
+	}
+	if tr.Contract != nil {
+		if tr.Htlc != nil {
+			return api_error.InvalidField("contract", "htlc spends cannot call contracts")
+		}
+		if err := tr.Contract.Validate(); err != nil {
+			return api_error.InvalidField("contract", err.Error())
+		}
+	}
+	if tr.Asset != nil {
+		if tr.Htlc != nil || tr.Contract != nil {
+			return api_error.InvalidField("asset", "htlc spends and contract transactions cannot move assets")
+		}
+		if err := tr.Asset.Validate(); err != nil {
+			return api_error.InvalidField("asset", err.Error())
+		}
+	}
+	// I fondi degli script si spendono con lo script di sblocco
+	if tr.Script != nil {
+		if tr.SenderPublicKey != nil || tr.Signature != nil || tr.Witness != nil || tr.Htlc != nil {
+			return api_error.InvalidField("script", "replaces sender_public_key, signature, witness and htlc")
+		}
+		if err := tr.Script.Validate(); err != nil {
+			return api_error.InvalidField("script", err.Error())
+		}
+		return nil
+	}
+	// I fondi degli HTLC si spendono senza firme
+	if tr.Htlc != nil {
+		if tr.SenderPublicKey != nil || tr.Signature != nil || tr.Witness != nil {
+			return api_error.InvalidField("htlc", "replaces sender_public_key, signature and witness")
+		}
+		if err := tr.Htlc.Validate(); err != nil {
+			return api_error.InvalidField("htlc", err.Error())
+		}
+		return nil
+	}
+	// Gli account multisig firmano con il witness
+	if tr.Witness != nil {
+		if tr.SenderPublicKey != nil || tr.Signature != nil {
+			return api_error.InvalidField("witness", "replaces sender_public_key and signature")
+		}
+		if err := tr.Witness.Validate(); err != nil {
+			return api_error.InvalidField("witness", err.Error())
+		}
+		return nil
+	}
+	// Chiave pubblica e firma sono due interi a 256 bit in esadecimale
+	if !utils.IsHex256Pair(*tr.SenderPublicKey) {
+		return api_error.InvalidField("sender_public_key", "must be 128 hexadecimal characters")
+	}
+	if !utils.IsHex256Pair(*tr.Signature) {
+		return api_error.InvalidField("signature", "must be 128 hexadecimal characters")
+	}
+	return nil
+}
+
+// Funzione che controlla i limiti di validità di una transazione:
+// non possono essere negativi e, se sono entrambi altezze o entrambi
+// timestamp, valid_until non può venire prima di valid_after
+func ValidateWindow(validAfter *int64, validUntil *int64) error {
+	if validAfter != nil && *validAfter < 0 {
+		return api_error.InvalidField("valid_after", "must not be negative")
+	}
+	if validUntil != nil && *validUntil < 0 {
+		return api_error.InvalidField("valid_until", "must not be negative")
+	}
+	if validAfter == nil || validUntil == nil || *validAfter == 0 || *validUntil == 0 {
+		return nil
+	}
+	if locktime.IsHeight(*validAfter) == locktime.IsHeight(*validUntil) && *validUntil < *validAfter {
+		return api_error.InvalidField("valid_until", "is before valid_after")
+	}
+	return nil
+}
+
+// Metodo che ritorna la transazione della richiesta, con la chiave
+// pubblica e la firma, i limiti di validità, la rete, il nonce, il
+// witness, i dati dell'HTLC, lo script, il messaggio del contratto e
+// l'operazione sul token, la richiesta deve essere già validata
+func (tr *TransactionRequest) Transaction() *blockchain_transaction.Transaction {
+	t := blockchain_transaction.NewTransaction(*tr.SenderBlockchainAddress, *tr.RecipientBlockchainAddress, *tr.Value)
+	if tr.SenderPublicKey != nil {
+		t.SenderPublicKey = *tr.SenderPublicKey
+	}
+	if tr.Signature != nil {
+		t.Signature = *tr.Signature
+	}
+	if tr.ValidAfter != nil {
+		t.ValidAfter = *tr.ValidAfter
+	}
+	if tr.ValidUntil != nil {
+		t.ValidUntil = *tr.ValidUntil
+	}
+	if tr.ChainID != nil {
+		t.ChainID = *tr.ChainID
+	}
+	if tr.Nonce != nil {
+		t.Nonce = *tr.Nonce
+	}
+	t.Witness, t.Htlc, t.Script, t.Contract, t.Asset = tr.Witness, tr.Htlc, tr.Script, tr.Contract, tr.Asset
+	return t
 }
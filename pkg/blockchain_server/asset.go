@@ -0,0 +1,30 @@
+package blockchain_server
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
+)
+
+// Resolver dell'endpoint "/assets"
+// GET restituisce i token emessi fino all'ultimo blocco, in ordine di
+// simbolo, con i metadati e la quantità in circolazione
+func (bcs *BlockchainServer) Assets(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(struct {
+			Assets []*asset.Info `json:"assets"`
+		}{
+			Assets: bcs.GetBloackchain().Assets(),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
+	}
+}
@@ -0,0 +1,55 @@
+package blockchain_server
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+)
+
+// Header con cui si passa la API key, in alternativa
+// a "Authorization: Bearer <key>"
+const API_KEY_HEADER = "X-Api-Key"
+
+// Funzione che ritorna la API key della richiesta
+func apiKey(req *http.Request) string {
+	if key := req.Header.Get(API_KEY_HEADER); key != "" {
+		return key
+	}
+	return strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+}
+
+// Metodo che dice se la API key è tra quelle configurate
+func (bcs *BlockchainServer) validApiKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, k := range bcs.options.ApiKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware che controlla l'autorità richiesta dall'endpoint
+// prima di chiamare il resolver
+func (bcs *BlockchainServer) authorize(r Route) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		switch r.Authority {
+		case AUTHORITY_PUBLIC:
+		case AUTHORITY_ADMIN:
+			if !bcs.validApiKey(apiKey(req)) {
+				log.Printf("ERROR: invalid API key for %s", req.URL.Path)
+				api_error.Write(w, api_error.Unauthorized("a valid API key is required"))
+				return
+			}
+		default:
+			api_error.Write(w, api_error.Forbidden("endpoint not available"))
+			return
+		}
+		r.Handler(w, req)
+	}
+}
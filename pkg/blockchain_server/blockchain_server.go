@@ -1,70 +1,161 @@
 package blockchain_server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
 	"github.com/iltommi1995/blockchain-go/pkg/blockchain/amount_response"
 	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/chain_store"
 	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
 	blockchain_transaction_request "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+	"github.com/iltommi1995/blockchain-go/pkg/json_rpc"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/node"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/transport"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/peer"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/peers_response"
 	"github.com/iltommi1995/blockchain-go/pkg/utils"
 	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+	"github.com/iltommi1995/blockchain-go/pkg/webhook/dispatcher"
 )
 
-// File nella cache in cui viene salvata la blockchain
-var cache map[string]*blockchain.Blockchain = make(map[string]*blockchain.Blockchain)
+const (
+	DEFAULT_BIND_ADDRESS = "localhost"
+	// Tempo concesso alle richieste in corso quando il server si ferma
+	SHUTDOWN_TIMEOUT_SEC = 10
+)
+
+// Opzioni del server
+type Options struct {
+	// Indirizzo e porta su cui ascolta il server HTTP, con la porta 0
+	// ne viene scelta una libera
+	BindAddress string
+	Port        uint16
+	// Configurazione del nodo p2p
+	Node node.Config
+	// Trasporto del nodo p2p, se nil si usa il TCP
+	Transport transport.Transport
+	// API key che danno accesso agli endpoint di amministrazione
+	ApiKeys []string
+	// Origini delle pagine, oltre a quelle del server, che possono
+	// aprire i websocket di "/rpc" e "/events"
+	AllowedOrigins []string
+	// Se true il nodo mina un blocco ogni blockchain.MINING_TIMER_SEC
+	Mining bool
+	// File in cui salvare la catena e il transaction pool quando il
+	// server si ferma, se vuoto restano solo in memoria
+	ChainPath string
+	// File dei webhook e delle consegne in coda, se vuoto restano
+	// solo in memoria
+	WebhooksPath string
+	// Wallet che riceve le ricompense del mining, di solito letto
+	// da un keystore; se nil ne viene creato uno che resta solo in
+	// memoria
+	Miner *wallet.Wallet
+}
 
-// Blockchain server, ha solo la porta su cui runna
-// così posso startarne di più su porte diverse
+// Blockchain server, ha la sua blockchain, il nodo p2p con cui
+// parla agli altri nodi e il server HTTP per i client
+// Ogni server è indipendente, così se ne possono avviare
+// più di uno nello stesso processo
 type BlockchainServer struct {
-	port uint16
+	options    Options
+	blockchain *blockchain.Blockchain
+	node       *node.Node
+	router     *http.ServeMux
+	rpc        *json_rpc.Server
+	store      *chain_store.ChainStore
+	webhooks   *dispatcher.Dispatcher
+	listener   net.Listener
+	server     *http.Server
+
+	// Contesto dei servizi in background (miner e nodo p2p),
+	// viene cancellato da Shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Contesto degli stream di eventi, cancellato all'inizio di
+	// Shutdown perché il server HTTP non aspetta chi non finisce mai
+	streams      context.Context
+	closeStreams context.CancelFunc
 }
 
-// Funzione per creare un nuovo server
-func NewBlockchainServer(port uint16) *BlockchainServer {
-	return &BlockchainServer{port}
+// Funzione per creare un nuovo server, con il wallet del miner delle
+// opzioni o con uno nuovo
+func NewBlockchainServer(options Options) *BlockchainServer {
+	if options.BindAddress == "" {
+		options.BindAddress = DEFAULT_BIND_ADDRESS
+	}
+	// La chiave privata del miner non viene mai scritta nel log
+	minerWallet := options.Miner
+	if minerWallet == nil {
+		minerWallet = wallet.NewWallet()
+		log.Println("No miner wallet given, mining rewards go to a new in-memory wallet")
+	}
+	log.Printf("public_key %v", minerWallet.PublicKeyStr())
+	log.Printf("blockchain_address %v", minerWallet.BlockchainAddress())
+
+	bcs := &BlockchainServer{options: options, store: chain_store.NewChainStore(options.ChainPath)}
+	bcs.ctx, bcs.cancel = context.WithCancel(context.Background())
+	bcs.blockchain = blockchain.NewBlockchain(minerWallet.BlockchainAddress(), options.Port, options.Node.ChainID)
+	// Il nodo p2p annuncia ai peer le transazioni e i blocchi nuovi
+	bcs.node = node.NewNode(bcs.blockchain, options.Node, options.Transport)
+
+	// I webhook ricevono gli eventi della blockchain
+	bcs.webhooks = dispatcher.NewDispatcher(bcs.blockchain, options.WebhooksPath, clock.Real())
+
+	// I metodi JSON-RPC usano la stessa blockchain degli endpoint REST
+	bcs.rpc = bcs.newRpcServer()
+	bcs.rpc.SetAllowedOrigins(options.AllowedOrigins)
+
+	// Crea endpoint e associa resolver, ognuno con l'autorità richiesta
+	bcs.router = http.NewServeMux()
+	for _, r := range bcs.Routes() {
+		bcs.router.HandleFunc(r.Path, bcs.authorize(r))
+	}
+	bcs.server = &http.Server{Handler: bcs.router}
+	bcs.streams, bcs.closeStreams = context.WithCancel(context.Background())
+	bcs.server.RegisterOnShutdown(bcs.closeStreams)
+	return bcs
 }
 
-// Getter della porta
+// Getter della porta, se il server è avviato è quella su cui ascolta
 func (bcs *BlockchainServer) Port() uint16 {
-	return bcs.port
+	if bcs.listener != nil {
+		return uint16(bcs.listener.Addr().(*net.TCPAddr).Port)
+	}
+	return bcs.options.Port
+}
+
+// Getter dell'indirizzo HTTP del server
+func (bcs *BlockchainServer) Address() string {
+	return net.JoinHostPort(bcs.options.BindAddress, strconv.Itoa(int(bcs.Port())))
 }
 
 // Metodo per avere la blockchain
 func (bcs *BlockchainServer) GetBloackchain() *blockchain.Blockchain {
-	// Recupero la blockchain dalla cache
-	bc, ok := cache["blockchain"]
-
-	// Se non c'è
-	if !ok {
-		// Creo wallet del miner
-		minerWallet := wallet.NewWallet()
-		// Passiamo anche la porta perché poi servirà alla blockchain per cercare
-		// altri nodi
-		// Creo nuova blockchain
-		bc := blockchain.NewBlockchain(minerWallet.BlockchainAddress(), bcs.Port())
-
-		// Controllare catena
-		/*if len(bc.Chain()) == 1 && len(bc.Neighbors()) > 0 {
-			fmt.Println("Risolti i conflitti")
-			bc.ResolveConflicts()
-		}*/
-
-		// Salvo nella cache
-		cache["blockchain"] = bc
-
-		log.Printf("private_key %v", minerWallet.PrivateKeyStr())
-		log.Printf("public_key %v", minerWallet.PublicKeyStr())
-		log.Printf("blockchain_address %v", minerWallet.BlockchainAddress())
-	}
+	return bcs.blockchain
+}
+
+// Getter del nodo p2p
+func (bcs *BlockchainServer) Node() *node.Node {
+	return bcs.node
+}
 
-	// Ritorno la blockchain
-	return bc
+// Getter del router, per usare gli endpoint senza avviare il server
+func (bcs *BlockchainServer) Handler() http.Handler {
+	return bcs.router
 }
 
 func HelloWorld(w http.ResponseWriter, req *http.Request) {
@@ -79,11 +170,8 @@ func (bcs *BlockchainServer) GetChain(w http.ResponseWriter, req *http.Request)
 	case http.MethodGet:
 		// Setto headers
 		w.Header().Add("Content-Type", "application/json")
-		// Blockchain
+		// Blockchain, per vederla in html c'è il block explorer
 		bc := bcs.GetBloackchain()
-		fmt.Println("Stampo la blockchain prima di inviarla")
-		bc.Print()
-		// RIGA DA CONTROLLARE (json della blockchain, fatto in questo modo alla prima chiamata dà null)
 		m, _ := json.Marshal(bc)
 
 		// Restituisco la blockchain
@@ -91,6 +179,7 @@ func (bcs *BlockchainServer) GetChain(w http.ResponseWriter, req *http.Request)
 	default:
 		// Se è altro HTTP Method do errore
 		log.Printf("ERROR: invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
 	}
 }
 
@@ -125,97 +214,43 @@ func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Reque
 		if err != nil {
 			// Dico che è fallita la costruzione della transazione
 			log.Printf("ERROR: %v", err)
-			io.WriteString(w, string(utils.JsonStatus("fail")))
+			api_error.Write(w, api_error.InvalidJson(err))
 			return
 		}
 		// Valido la Transaction Request, vedendo se ci sono tutti i dati
 		// necessari, se no do errore
-		if !t.Validate() {
-			log.Println("ERROR: missing field(s)")
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
-
-		// Prendo la publicKey e la trasformo da String a *ecdsa.PublicKey
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		// Prendo la signature e la trasformo da String a utils.Signature
-		signature := utils.SignatureFromString(*t.Signature)
-
-		bc := bcs.GetBloackchain()
-
-		// Creo la transazione lato server
-		isCreated := bc.CreateTransaction(
-			*t.SenderBlockchainAddress,
-			*t.RecipientBlockchainAddress,
-			*t.Value,
-			publicKey,
-			signature,
-		)
-
-		w.Header().Add("Content-Type", "application/json")
-		// Creo una variabile m per la response
-		var m []byte
-		// Controllo se la transazione è stata creata correttamente
-		if !isCreated {
-			// Se no restituisco il messaggio di errore
-			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
-		} else {
-			// Se sì restituisco il messaggio di successo
-			w.WriteHeader(http.StatusCreated)
-			m = utils.JsonStatus("success")
-		}
-		io.WriteString(w, string(m))
-	// Se è metodo PUT
-	case http.MethodPut:
-		decoder := json.NewDecoder(req.Body)
-		var t blockchain_transaction_request.TransactionRequest
-		err := decoder.Decode(&t)
-		if err != nil {
+		if err := t.Validate(); err != nil {
 			log.Printf("ERROR: %v", err)
-			io.WriteString(w, string(utils.JsonStatus("fail")))
+			api_error.Write(w, err)
 			return
 		}
-		if !t.Validate() {
-			log.Println("ERROR: missing field(s)")
-			io.WriteString(w, string(utils.JsonStatus("fail")))
+
+		// Creo la transazione lato server, se non è valida
+		// restituisco il motivo
+		if err := bcs.submitTransaction(&t); err != nil {
+			api_error.Write(w, err)
 			return
 		}
-
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		signature := utils.SignatureFromString(*t.Signature)
-
-		bc := bcs.GetBloackchain()
-		// Qui le modifiche fatte
-		isUpdated := bc.AddTransaction(
-			*t.SenderBlockchainAddress,
-			*t.RecipientBlockchainAddress,
-			*t.Value,
-			publicKey,
-			signature,
-		)
-
 		w.Header().Add("Content-Type", "application/json")
-		var m []byte
-		if !isUpdated {
-			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
-		} else {
-			m = utils.JsonStatus("success")
-		}
-		io.WriteString(w, string(m))
-	case http.MethodDelete:
-		bc := bcs.GetBloackchain()
-		bc.ClearTransactionPool()
+		w.WriteHeader(http.StatusCreated)
 		io.WriteString(w, string(utils.JsonStatus("success")))
-
 	default:
 		// Se è un altro metodo
 		log.Println("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet, http.MethodPost)
 	}
 }
 
+// Metodo per aggiungere al transaction pool una transazione ricevuta
+// da un client, la usano sia l'endpoint REST sia JSON-RPC
+// La richiesta deve essere già stata validata, se la transazione
+// viene rifiutata ritorna un *api_error.ApiError con il motivo
+func (bcs *BlockchainServer) submitTransaction(t *blockchain_transaction_request.TransactionRequest) error {
+	// Le transazioni degli account multisig si verificano con il
+	// witness, le altre con chiave pubblica e firma
+	return transactionError(bcs.GetBloackchain().CreateTransactionRequest(t))
+}
+
 // Resolver dell'endpoint "/mine"
 func (bcs *BlockchainServer) Mine(w http.ResponseWriter, req *http.Request) {
 	// Controllo il metodo HTTP
@@ -223,23 +258,17 @@ func (bcs *BlockchainServer) Mine(w http.ResponseWriter, req *http.Request) {
 	// Se è GET
 	case http.MethodGet:
 		bc := bcs.GetBloackchain()
-		// Effettuo il imining
-		isMined := bc.Mining()
-
-		// Controllo se il mining è avvenuto correttamente e creo la response
-		var m []byte
-		if !isMined {
-			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
-		} else {
-			m = utils.JsonStatus("success")
+		// Effettuo il imining, se non riesce restituisco il motivo
+		if err := bc.Mining(); err != nil {
+			api_error.Write(w, miningError(err))
+			return
 		}
 		w.Header().Add("Content-Type", "application/json")
-		io.WriteString(w, string(m))
+		io.WriteString(w, string(utils.JsonStatus("success")))
 	// Se è un altro metodo
 	default:
 		log.Println("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
 	}
 }
 
@@ -251,8 +280,8 @@ func (bcs *BlockchainServer) StartMine(w http.ResponseWriter, req *http.Request)
 	// Se è GET
 	case http.MethodGet:
 		bc := bcs.GetBloackchain()
-		// Avvio il Mining
-		bc.StartMining()
+		// Avvio il Mining, si ferma con il server
+		bc.StartMining(bcs.ctx)
 		// Costruisco la response
 		m := utils.JsonStatus("success")
 		w.Header().Add("Content-Type", "application/json")
@@ -260,11 +289,13 @@ func (bcs *BlockchainServer) StartMine(w http.ResponseWriter, req *http.Request)
 	// Se è un altro metodo
 	default:
 		log.Println("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
 	}
 }
 
 // Resolver dell'endpoint "/amount"
+// Con il query param "asset" restituisce il saldo nel token con quel
+// simbolo
 func (bcs *BlockchainServer) Amount(w http.ResponseWriter, req *http.Request) {
 	// Controllo il metodo HTTP
 	switch req.Method {
@@ -272,6 +303,21 @@ func (bcs *BlockchainServer) Amount(w http.ResponseWriter, req *http.Request) {
 	case http.MethodGet:
 		// Recupero il query param con il blockchain address
 		blockchainAddress := req.URL.Query().Get("blockchain_address")
+		if blockchainAddress == "" {
+			api_error.Write(w, api_error.MissingField("blockchain_address"))
+			return
+		}
+		if symbol := req.URL.Query().Get("asset"); symbol != "" {
+			amount, err := bcs.GetBloackchain().CalculateAssetAmount(blockchainAddress, symbol)
+			if err != nil {
+				api_error.Write(w, api_error.NotFound(err.Error()).WithField("asset"))
+				return
+			}
+			m, _ := json.Marshal(&amount_response.AssetAmountResponse{Asset: symbol, Amount: amount})
+			w.Header().Add("Content-Type", "application/json")
+			io.WriteString(w, string(m[:]))
+			return
+		}
 		// Recupero il bilancio
 		amount := bcs.GetBloackchain().CalculateTotalAmount(blockchainAddress)
 		// Preparo la risposta
@@ -282,43 +328,180 @@ func (bcs *BlockchainServer) Amount(w http.ResponseWriter, req *http.Request) {
 	// Se è un altro metodo
 	default:
 		log.Println("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
 	}
 }
 
-func (bcs *BlockchainServer) Consensus(w http.ResponseWriter, req *http.Request) {
+// Resolver dell'endpoint "/network"
+func (bcs *BlockchainServer) Network(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(bcs.GetBloackchain().Network())
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
+	}
+}
+
+// Resolver dell'endpoint "/peers"
+// GET restituisce i peer conosciuti e quelli connessi
+func (bcs *BlockchainServer) Peers(w http.ResponseWriter, req *http.Request) {
 	// Controllo il metodo HTTP
 	switch req.Method {
-	// Se è PUT
-	case http.MethodPut:
-		bc := bcs.GetBloackchain()
-		replaced := bc.ResolveConflicts()
+	// Se è GET
+	case http.MethodGet:
+		pr := &peers_response.PeersResponse{Peers: bcs.node.KnownPeers(), Connected: bcs.node.ConnectedPeers()}
+		m, _ := pr.MarshalJSON()
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	// Se è un altro metodo
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
+	}
+}
 
+// Resolver dell'endpoint "/admin/bans"
+// GET restituisce gli host e i node id bannati, DELETE toglie il ban
+// alla chiave o all'indirizzo passato nel query param "address" o a
+// tutti se manca
+func (bcs *BlockchainServer) Bans(w http.ResponseWriter, req *http.Request) {
+	// Controllo il metodo HTTP
+	switch req.Method {
+	// Se è GET
+	case http.MethodGet:
+		bans := bcs.node.Bans()
+		m, _ := json.Marshal(struct {
+			Bans   []*peer.Reputation `json:"bans"`
+			Length int                `json:"length"`
+		}{
+			Bans:   bans,
+			Length: len(bans),
+		})
 		w.Header().Add("Content-Type", "application/json")
-		if replaced {
-			io.WriteString(w, string(utils.JsonStatus("success")))
-		} else {
-			io.WriteString(w, string(utils.JsonStatus("fail")))
+		io.WriteString(w, string(m[:]))
+	// Se è DELETE
+	case http.MethodDelete:
+		address := req.URL.Query().Get("address")
+		count := bcs.node.Unban(address)
+		if address != "" && count == 0 {
+			api_error.Write(w, api_error.NotFound(fmt.Sprintf("peer %s is not banned", address)).WithField("address"))
+			return
 		}
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(utils.JsonStatus("success")))
 	// Se è un altro metodo
 	default:
 		log.Println("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet, http.MethodDelete)
 	}
 }
 
-// Metodo per avviare il server
+// Metodo per avviare il server senza bloccare: ripristina la catena
+// salvata, si mette in ascolto, avvia il nodo p2p e, se richiesto,
+// il mining
+// Il miner e il nodo si fermano quando ctx viene cancellato, per
+// fermare anche il server HTTP e salvare la catena serve Shutdown
+func (bcs *BlockchainServer) Start(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := bcs.restore(); err != nil {
+		return fmt.Errorf("restoring chain from %s: %w", bcs.store.Path(), err)
+	}
+	if err := bcs.webhooks.Load(); err != nil {
+		return fmt.Errorf("loading webhooks from %s: %w", bcs.webhooks.Path(), err)
+	}
+	var lc net.ListenConfig
+	listener, err := lc.Listen(ctx, "tcp", net.JoinHostPort(bcs.options.BindAddress, strconv.Itoa(int(bcs.options.Port))))
+	if err != nil {
+		return err
+	}
+	bcs.ctx, bcs.cancel = context.WithCancel(ctx)
+	if err := bcs.node.Start(bcs.ctx); err != nil {
+		listener.Close()
+		return fmt.Errorf("starting p2p node: %w", err)
+	}
+	bcs.listener = listener
+	bcs.webhooks.Start(bcs.ctx)
+
+	if len(bcs.options.ApiKeys) == 0 {
+		log.Println("No API key configured, admin endpoints are disabled")
+	}
+	if bcs.options.Mining {
+		log.Println("Running blockchain...")
+		bcs.blockchain.Run(bcs.ctx)
+	}
+
+	go func() {
+		if err := bcs.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("ERROR: %v", err)
+		}
+	}()
+	log.Printf("Blockchain server listening on %s", bcs.Address())
+	return nil
+}
+
+// Metodo per fermare il server: smette di accettare richieste e
+// aspetta quelle in corso finché ctx lo permette, ferma il miner
+// dopo il blocco in corso e il nodo p2p, e infine salva la catena
+// e il transaction pool
+func (bcs *BlockchainServer) Shutdown(ctx context.Context) error {
+	err := bcs.server.Shutdown(ctx)
+	bcs.rpc.CloseAll()
+	bcs.cancel()
+	bcs.blockchain.StopMining()
+	bcs.node.Stop()
+	bcs.webhooks.Wait()
+	if ferr := bcs.Flush(); ferr != nil {
+		log.Printf("ERROR: saving chain: %v", ferr)
+		if err == nil {
+			err = ferr
+		}
+	}
+	log.Println("Blockchain server stopped")
+	return err
+}
+
+// Metodo per salvare la catena e il transaction pool su disco
+func (bcs *BlockchainServer) Flush() error {
+	chain, pool := bcs.blockchain.Export()
+	if err := bcs.store.Save(&chain_store.State{Chain: chain, Transactions: pool}); err != nil {
+		return err
+	}
+	if bcs.store.Path() != "" {
+		log.Printf("Saved %d blocks and %d pending transactions to %s", len(chain), len(pool), bcs.store.Path())
+	}
+	return bcs.webhooks.Save()
+}
+
+// Metodo per ripristinare la catena e il transaction pool salvati
+func (bcs *BlockchainServer) restore() error {
+	state, err := bcs.store.Load()
+	if err != nil || state == nil {
+		return err
+	}
+	return bcs.blockchain.Restore(state.Chain, state.Transactions)
+}
+
+// Metodo per avviare il server e restare in esecuzione fino a
+// SIGINT o SIGTERM, poi il server si ferma in modo ordinato
+// Un secondo segnale termina subito il processo
 func (bcs *BlockchainServer) Run() {
-	bcs.GetBloackchain()
-	log.Println("Running blockchain...")
-	bcs.GetBloackchain().Run()
-
-	// Crea endpoint e associa resolver
-	http.HandleFunc("/", bcs.GetChain)
-	http.HandleFunc("/transactions", bcs.Transactions)
-	http.HandleFunc("/mine", bcs.Mine)
-	http.HandleFunc("/mine/start", bcs.StartMine)
-	http.HandleFunc("/amount", bcs.Amount)
-	http.HandleFunc("/consensus", bcs.Consensus)
-	log.Fatal(http.ListenAndServe("localhost:"+strconv.Itoa(int(bcs.Port())), nil))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := bcs.Start(ctx); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	<-ctx.Done()
+	stop()
+
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT_SEC*time.Second)
+	defer cancel()
+	if err := bcs.Shutdown(shutdownCtx); err != nil {
+		log.Printf("ERROR: shutdown: %v", err)
+	}
 }
@@ -0,0 +1,80 @@
+package blockchain_server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract_request"
+)
+
+// Resolver dell'endpoint "/contract"
+// GET restituisce il codice e lo storage del contratto all'address
+// "blockchain_address", nell'ultimo blocco
+func (bcs *BlockchainServer) Contract(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		blockchainAddress := req.URL.Query().Get("blockchain_address")
+		if blockchainAddress == "" {
+			api_error.Write(w, api_error.MissingField("blockchain_address"))
+			return
+		}
+		info, err := bcs.GetBloackchain().Contract(blockchainAddress)
+		if err != nil {
+			api_error.Write(w, contractError(err))
+			return
+		}
+		m, _ := json.Marshal(info)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
+	}
+}
+
+// Resolver dell'endpoint "/contract/call"
+// Esegue una chiamata sullo stato dell'ultimo blocco senza cambiarlo e
+// restituisce il valore ritornato, per leggere i dati dei contratti
+// Le chiamate che cambiano lo storage sono transazioni, su
+// "/transactions"
+func (bcs *BlockchainServer) CallContract(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var cr contract_request.CallRequest
+		if err := json.NewDecoder(req.Body).Decode(&cr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := cr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		caller, args, gasLimit := cr.Call()
+		r, err := bcs.GetBloackchain().CallContract(*cr.BlockchainAddress, caller, args, gasLimit)
+		if err != nil {
+			api_error.Write(w, contractError(err))
+			return
+		}
+		m, _ := json.Marshal(r)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Funzione che converte l'errore di un contratto nell'errore da
+// restituire al client
+func contractError(err error) error {
+	if errors.Is(err, blockchain.ErrContractNotFound) {
+		return api_error.NotFound(err.Error())
+	}
+	return transactionError(err)
+}
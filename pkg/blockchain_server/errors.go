@@ -0,0 +1,60 @@
+package blockchain_server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+)
+
+// Funzione che converte l'errore di una transazione rifiutata dalla
+// blockchain nell'errore da restituire al client
+func transactionError(err error) error {
+	// Gli errori degli HTLC, degli script, dei contratti e dei token
+	// hanno il dettaglio nel messaggio
+	if errors.Is(err, blockchain.ErrInvalidHtlc) {
+		return api_error.InvalidField("htlc", err.Error())
+	}
+	if errors.Is(err, blockchain.ErrInvalidScript) {
+		return api_error.InvalidField("script", err.Error())
+	}
+	if errors.Is(err, blockchain.ErrContractFailed) {
+		return api_error.New(http.StatusUnprocessableEntity, api_error.CODE_CONTRACT_FAILED, err.Error()).WithField("contract")
+	}
+	if errors.Is(err, blockchain.ErrAssetFailed) {
+		return api_error.New(http.StatusUnprocessableEntity, api_error.CODE_ASSET_FAILED, err.Error()).WithField("asset")
+	}
+	switch err {
+	case nil:
+		return nil
+	case blockchain.ErrInvalidSignature:
+		return api_error.New(http.StatusBadRequest, api_error.CODE_INVALID_SIGNATURE, err.Error()).WithField("signature")
+	case blockchain.ErrInvalidValue:
+		return api_error.InvalidField("value", err.Error())
+	case blockchain.ErrInsufficientBalance:
+		return api_error.New(http.StatusUnprocessableEntity, api_error.CODE_INSUFFICIENT_BALANCE, err.Error()).WithField("value")
+	case blockchain.ErrWrongChain:
+		return api_error.InvalidField("chain_id", err.Error())
+	case blockchain.ErrReplayed:
+		return api_error.New(http.StatusConflict, api_error.CODE_CONFLICT, err.Error()).WithField("nonce")
+	case blockchain.ErrExpired:
+		return api_error.New(http.StatusUnprocessableEntity, api_error.CODE_EXPIRED, err.Error()).WithField("valid_until")
+	case blockchain.ErrHtlcTimeout:
+		return api_error.New(http.StatusUnprocessableEntity, api_error.CODE_TIMEOUT_NOT_REACHED, err.Error()).WithField("timeout")
+	case blockchain.ErrHtlcPending:
+		return api_error.New(http.StatusConflict, api_error.CODE_CONFLICT, err.Error())
+	case blockchain.ErrHtlcEmpty:
+		return api_error.New(http.StatusUnprocessableEntity, api_error.CODE_INSUFFICIENT_BALANCE, err.Error())
+	}
+	return api_error.From(err)
+}
+
+// Funzione che converte l'errore del mining nell'errore da
+// restituire al client
+func miningError(err error) error {
+	if err == blockchain.ErrStaleBlock {
+		return api_error.New(http.StatusConflict, api_error.CODE_STALE_BLOCK, err.Error())
+	}
+	return api_error.From(err)
+}
@@ -0,0 +1,235 @@
+package blockchain_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/events"
+	"github.com/iltommi1995/blockchain-go/pkg/websocket"
+)
+
+// Ogni quanto uno stream SSE senza eventi manda un commento, così
+// i proxy non chiudono la connessione
+const EVENTS_HEARTBEAT_SEC = 15
+
+// Richiesta di uno stream di eventi
+type eventsRequest struct {
+	filter events.Filter
+	// Altezza da cui rimandare gli eventi dei blocchi già nella
+	// catena, -1 per ricevere solo quelli nuovi
+	fromHeight int
+}
+
+// Funzione che legge i query param "types", "address" e
+// "from_height", al posto di quest'ultimo vale l'header
+// Last-Event-ID che il browser rimanda quando si riconnette
+func parseEventsRequest(req *http.Request) (*eventsRequest, error) {
+	q := req.URL.Query()
+	er := &eventsRequest{filter: events.ParseFilter(q.Get("types"), q["address"]), fromHeight: -1}
+	for t := range er.filter.Types {
+		if !events.Known(t) {
+			return nil, api_error.InvalidField("types", fmt.Sprintf("unknown event type %s", t))
+		}
+	}
+	if v := q.Get("from_height"); v != "" {
+		h, err := strconv.Atoi(v)
+		if err != nil || h < 0 {
+			return nil, api_error.InvalidField("from_height", "must be a non negative integer")
+		}
+		er.fromHeight = h
+	} else if v := req.Header.Get("Last-Event-ID"); v != "" {
+		// L'id degli eventi è l'altezza dell'ultimo blocco ricevuto
+		h, err := strconv.Atoi(v)
+		if err != nil || h < 0 {
+			return nil, api_error.InvalidField("Last-Event-ID", "must be a block height")
+		}
+		er.fromHeight = h + 1
+	}
+	return er, nil
+}
+
+// Resolver dell'endpoint "/events"
+// Manda gli eventi del nodo come Server-Sent Events o, con una
+// richiesta di upgrade, come messaggi json su un websocket
+// Con from_height prima rimanda gli eventi dei blocchi già nella
+// catena da quell'altezza, marcati come replay, poi quelli nuovi
+func (bcs *BlockchainServer) Events(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
+		return
+	}
+	er, err := parseEventsRequest(req)
+	if err != nil {
+		api_error.Write(w, err)
+		return
+	}
+	if websocket.IsUpgrade(req) {
+		bcs.streamWebsocket(w, req, er)
+		return
+	}
+	bcs.streamSSE(w, req, er)
+}
+
+// Metodo che si iscrive al bus e ritorna gli eventi da rimandare
+// L'iscrizione viene fatta prima di leggere la catena, così nessun
+// blocco va perso; quelli già rimandati vengono saltati da skip
+func (bcs *BlockchainServer) subscribe(er *eventsRequest) (*events.Subscription, []*events.Event, map[int]string) {
+	sub := bcs.blockchain.Events().Subscribe(er.filter, events.DEFAULT_BUFFER)
+	if er.fromHeight < 0 {
+		return sub, nil, nil
+	}
+	chain := bcs.blockchain.Chain()
+	replay := []*events.Event{}
+	replayed := make(map[int]string)
+	for h := er.fromHeight; h < len(chain); h++ {
+		for _, e := range blockchain.BlockEvents(h, chain[h], chain[h].Timestamp) {
+			replayed[h] = e.Hash
+			if er.filter.Match(e) {
+				e.Replay = true
+				replay = append(replay, e)
+			}
+		}
+	}
+	return sub, replay, replayed
+}
+
+// Funzione che dice se un evento nuovo è già stato rimandato
+func skip(e *events.Event, replayed map[int]string) bool {
+	if e.Type != events.NEW_TIP && e.Type != events.TX_CONFIRMED {
+		return false
+	}
+	hash, ok := replayed[e.Height]
+	return ok && hash == e.Hash
+}
+
+// Metodo che manda gli eventi come Server-Sent Events: il nome
+// dell'evento è il tipo, i dati sono il json dell'evento e l'id è
+// l'altezza per i new_tip, così il browser riprende da lì
+func (bcs *BlockchainServer) streamSSE(w http.ResponseWriter, req *http.Request, er *eventsRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api_error.Write(w, api_error.Internal("streaming not supported"))
+		return
+	}
+	sub, replay, replayed := bcs.subscribe(er)
+	defer sub.Unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(e *events.Event) error {
+		m, _ := json.Marshal(e)
+		var b strings.Builder
+		fmt.Fprintf(&b, "event: %s\n", e.Type)
+		if e.Type == events.NEW_TIP {
+			fmt.Fprintf(&b, "id: %d\n", e.Height)
+		}
+		fmt.Fprintf(&b, "data: %s\n\n", m)
+		if _, err := w.Write([]byte(b.String())); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	for _, e := range replay {
+		if write(e) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(EVENTS_HEARTBEAT_SEC * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C():
+			if !ok {
+				if sub.Lagged() {
+					write(&events.Event{Type: events.LAGGED, Time: time.Now().UnixNano()})
+				}
+				return
+			}
+			if skip(e, replayed) {
+				continue
+			}
+			if write(e) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		case <-bcs.streams.Done():
+			return
+		}
+	}
+}
+
+// Metodo che manda gli eventi su un websocket, un json per messaggio
+// I messaggi del client vengono ignorati, servono solo a vedere
+// quando chiude
+func (bcs *BlockchainServer) streamWebsocket(w http.ResponseWriter, req *http.Request, er *eventsRequest) {
+	upgrader := &websocket.Upgrader{AllowedOrigins: bcs.options.AllowedOrigins}
+	conn, err := upgrader.Upgrade(w, req)
+	if err != nil {
+		log.Printf("ERROR: events websocket: %v", err)
+		return
+	}
+	defer conn.Close()
+	sub, replay, replayed := bcs.subscribe(er)
+	defer sub.Unsubscribe()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(e *events.Event) error {
+		m, _ := json.Marshal(e)
+		return conn.WriteText(m)
+	}
+	for _, e := range replay {
+		if write(e) != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case e, ok := <-sub.C():
+			if !ok {
+				if sub.Lagged() {
+					write(&events.Event{Type: events.LAGGED, Time: time.Now().UnixNano()})
+				}
+				return
+			}
+			if skip(e, replayed) {
+				continue
+			}
+			if write(e) != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-bcs.streams.Done():
+			return
+		}
+	}
+}
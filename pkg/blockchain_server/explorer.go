@@ -0,0 +1,239 @@
+package blockchain_server
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/explorer"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/peer"
+)
+
+// Path delle pagine del block explorer
+const EXPLORER_PATH = "/explorer/"
+
+// Template del block explorer, inclusi nel binario così il server
+// li trova da qualunque directory venga avviato
+//
+//go:embed templates
+var templatesFS embed.FS
+
+// Funzioni usate nei template
+var templateFuncs = template.FuncMap{
+	// Primi caratteri di un hash, per le tabelle
+	"short": func(s string) string {
+		if len(s) <= 16 {
+			return s
+		}
+		return s[:16] + "…"
+	},
+	// Timestamp dei blocchi, in nanosecondi
+	"time": func(ns int64) string {
+		return time.Unix(0, ns).UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"unix": func(s int64) string {
+		if s == 0 {
+			return "-"
+		}
+		return time.Unix(s, 0).UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"amount": func(v float32) string {
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	},
+	"add": func(a int, b int) int {
+		return a + b
+	},
+	"path": url.PathEscape,
+}
+
+// Pagine del block explorer, ognuna con il layout comune
+var explorerPages = parseExplorerPages("index", "block", "tx", "address", "mempool", "peers", "not_found")
+
+func parseExplorerPages(names ...string) map[string]*template.Template {
+	pages := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		pages[name] = template.Must(template.New("layout.html").Funcs(templateFuncs).
+			ParseFS(templatesFS, "templates/layout.html", "templates/"+name+".html"))
+	}
+	return pages
+}
+
+// Dati passati ai template: il titolo, l'ultimo blocco e la ricerca
+// per il layout, Data per la pagina
+type explorerPage struct {
+	Title  string
+	Prefix string
+	Height int
+	Query  string
+	Data   interface{}
+}
+
+// Peer mostrato nella pagina dei peer
+type explorerPeer struct {
+	*peer.Peer
+	Connected bool
+	Banned    bool
+	BanReason string
+	// Punteggio più basso tra quello dell'host e quello del node id
+	Score int
+}
+
+// Resolver delle pagine "/explorer/..."
+func (bcs *BlockchainServer) Explorer(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		e := explorer.NewExplorer(bcs.blockchain)
+		page, arg := strings.TrimPrefix(req.URL.Path, EXPLORER_PATH), ""
+		if i := strings.Index(page, "/"); i >= 0 {
+			page, arg = page[:i], page[i+1:]
+		}
+		switch {
+		case page == "" && arg == "":
+			from := -1
+			if s := req.URL.Query().Get("from"); s != "" {
+				from, _ = strconv.Atoi(s)
+			}
+			blocks, height := e.Latest(from, explorer.LATEST_BLOCKS)
+			bcs.renderExplorer(w, req, http.StatusOK, "index", "Latest blocks", struct {
+				Blocks  []*explorer.BlockSummary
+				Pending int
+				Peers   int
+				Older   int
+				Newer   int
+			}{
+				Blocks:  blocks,
+				Pending: len(bcs.blockchain.TransactionPool()),
+				Peers:   len(bcs.node.ConnectedPeers()),
+				Older:   olderFrom(blocks),
+				Newer:   newerFrom(blocks, height),
+			})
+		case page == "block" && arg != "":
+			b, err := e.Block(arg)
+			if err != nil {
+				bcs.explorerNotFound(w, req, err)
+				return
+			}
+			bcs.renderExplorer(w, req, http.StatusOK, "block", "Block "+strconv.Itoa(b.Height), b)
+		case page == "tx" && arg != "":
+			t, err := e.Transaction(arg)
+			if err != nil {
+				bcs.explorerNotFound(w, req, err)
+				return
+			}
+			bcs.renderExplorer(w, req, http.StatusOK, "tx", "Transaction", t)
+		case page == "address" && arg != "":
+			p, _ := strconv.Atoi(req.URL.Query().Get("page"))
+			bcs.renderExplorer(w, req, http.StatusOK, "address", "Address "+arg, e.Address(arg, p))
+		case page == "mempool" && arg == "":
+			bcs.renderExplorer(w, req, http.StatusOK, "mempool", "Mempool", e.Mempool())
+		case page == "peers" && arg == "":
+			bcs.renderExplorer(w, req, http.StatusOK, "peers", "Peers", bcs.explorerPeers())
+		case page == "search" && arg == "":
+			target, err := e.Search(req.URL.Query().Get("q"))
+			if err != nil {
+				bcs.explorerNotFound(w, req, err)
+				return
+			}
+			http.Redirect(w, req, strings.TrimSuffix(EXPLORER_PATH, "/")+target, http.StatusFound)
+		default:
+			bcs.explorerNotFound(w, req, errors.New("page not found"))
+		}
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
+	}
+}
+
+// Metodo che ritorna i peer dell'address book, prima quelli connessi
+func (bcs *BlockchainServer) explorerPeers() []*explorerPeer {
+	connected := make(map[string]bool)
+	for _, a := range bcs.node.ConnectedPeers() {
+		connected[a] = true
+	}
+	reputations := make(map[string]*peer.Reputation)
+	for _, r := range bcs.node.PeerStore().Reputations() {
+		reputations[r.Key] = r
+	}
+	banned := make(map[string]bool)
+	for _, r := range bcs.node.Bans() {
+		banned[r.Key] = true
+	}
+	peers := make([]*explorerPeer, 0)
+	for _, p := range bcs.node.Peers() {
+		ep := &explorerPeer{Peer: p, Connected: connected[p.Address], Score: peer.INITIAL_SCORE}
+		for _, key := range p.Keys() {
+			r, ok := reputations[key]
+			if !ok {
+				continue
+			}
+			if r.Score < ep.Score {
+				ep.Score = r.Score
+			}
+			if banned[key] {
+				ep.Banned, ep.BanReason = true, r.BanReason
+			}
+		}
+		if ep.Connected {
+			peers = append([]*explorerPeer{ep}, peers...)
+		} else {
+			peers = append(peers, ep)
+		}
+	}
+	return peers
+}
+
+// Metodo che mostra la pagina di una ricerca senza risultati
+func (bcs *BlockchainServer) explorerNotFound(w http.ResponseWriter, req *http.Request, err error) {
+	bcs.renderExplorer(w, req, http.StatusNotFound, "not_found", "Not found", err.Error())
+}
+
+// Metodo che esegue il template della pagina, il risultato viene
+// scritto solo se il template non fallisce
+func (bcs *BlockchainServer) renderExplorer(w http.ResponseWriter, req *http.Request, status int, name string, title string, data interface{}) {
+	var buf bytes.Buffer
+	err := explorerPages[name].Execute(&buf, &explorerPage{
+		Title:  title,
+		Prefix: strings.TrimSuffix(EXPLORER_PATH, "/"),
+		Height: bcs.blockchain.Height(),
+		Query:  req.URL.Query().Get("q"),
+		Data:   data,
+	})
+	if err != nil {
+		log.Printf("ERROR: explorer page %s: %v", name, err)
+		api_error.Write(w, api_error.Internal(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// Funzione che ritorna l'altezza da cui parte la pagina dei blocchi
+// più vecchi, -1 se si è arrivati al genesis
+func olderFrom(blocks []*explorer.BlockSummary) int {
+	if len(blocks) == 0 || blocks[len(blocks)-1].Height == 0 {
+		return -1
+	}
+	return blocks[len(blocks)-1].Height - 1
+}
+
+// Funzione che ritorna l'altezza da cui parte la pagina dei blocchi
+// più recenti, -1 se la pagina parte già dall'ultimo blocco
+func newerFrom(blocks []*explorer.BlockSummary, height int) int {
+	if len(blocks) == 0 || blocks[0].Height >= height {
+		return -1
+	}
+	newer := blocks[0].Height + explorer.LATEST_BLOCKS
+	if newer > height {
+		newer = height
+	}
+	return newer
+}
@@ -0,0 +1,103 @@
+package blockchain_server
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc_request"
+)
+
+// Funzione che legge e valida la richiesta su un contratto HTLC
+func decodeHtlcRequest(req *http.Request) (*htlc_request.HtlcRequest, error) {
+	var hr htlc_request.HtlcRequest
+	if err := json.NewDecoder(req.Body).Decode(&hr); err != nil {
+		log.Printf("ERROR: %v", err)
+		return nil, api_error.InvalidJson(err)
+	}
+	if err := hr.Validate(); err != nil {
+		return nil, err
+	}
+	return &hr, nil
+}
+
+// Resolver dell'endpoint "/htlc/status"
+// Restituisce i fondi e lo stato del contratto, con il preimage se il
+// recipient lo ha rivelato, che serve per riscattare i fondi
+// dell'altra catena in uno scambio atomico
+func (bcs *BlockchainServer) HtlcStatus(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		hr, err := decodeHtlcRequest(req)
+		if err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		m, _ := json.Marshal(bcs.GetBloackchain().HtlcStatus(hr.Contract()))
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Resolver dell'endpoint "/htlc/claim"
+// Invia al recipient tutti i fondi del contratto con il preimage,
+// prima del timeout
+func (bcs *BlockchainServer) ClaimHtlc(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		hr, err := decodeHtlcRequest(req)
+		if err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		if hr.Preimage == nil {
+			api_error.Write(w, api_error.MissingField("preimage"))
+			return
+		}
+		bcs.spendHtlc(w, hr)
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Resolver dell'endpoint "/htlc/refund"
+// Restituisce al sender tutti i fondi del contratto, dal timeout
+func (bcs *BlockchainServer) RefundHtlc(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		hr, err := decodeHtlcRequest(req)
+		if err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		if hr.Preimage != nil {
+			api_error.Write(w, api_error.InvalidField("preimage", "a refund has no preimage, use /htlc/claim"))
+			return
+		}
+		bcs.spendHtlc(w, hr)
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Metodo che spende i fondi del contratto e restituisce la transazione
+// aggiunta al transaction pool
+func (bcs *BlockchainServer) spendHtlc(w http.ResponseWriter, hr *htlc_request.HtlcRequest) {
+	tr, err := bcs.GetBloackchain().SpendHtlc(hr.Spend())
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		api_error.Write(w, transactionError(err))
+		return
+	}
+	m, _ := json.Marshal(tr)
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, string(m[:]))
+}
@@ -0,0 +1,278 @@
+package blockchain_server
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	"github.com/iltommi1995/blockchain-go/pkg/client"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/node"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
+	wallet_transaction_request "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet_server"
+)
+
+const (
+	PASSWORD = "atomic-swap-password"
+	// Valore scambiato, minore della ricompensa di un blocco
+	VALUE = "0.5"
+)
+
+// I log dei server si vedono solo con -v
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// Una delle due catene dello scambio: il blockchain server, il
+// wallet server che gli manda le transazioni e i loro client
+type swapChain struct {
+	t      *testing.T
+	server *BlockchainServer
+	node   *client.NodeClient
+	client *client.WalletClient
+}
+
+// Funzione che crea una catena minata da miner, con un blocco già
+// minato, e il suo wallet server con il keystore ks
+// Entrambi i server sono httptest, chiusi a fine test
+func newSwapChain(t *testing.T, chainID string, miner *wallet.Wallet, ks *keystore.Keystore) *swapChain {
+	t.Helper()
+	server := NewBlockchainServer(Options{
+		BindAddress: "127.0.0.1",
+		Node:        node.Config{Host: "127.0.0.1", ChainID: chainID},
+		Miner:       miner,
+	})
+	gateway := httptest.NewServer(server.Handler())
+	t.Cleanup(gateway.Close)
+
+	ws := wallet_server.NewWalletServer(0, gateway.URL, ks)
+	router := http.NewServeMux()
+	for _, r := range ws.Routes() {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+	walletServer := httptest.NewServer(router)
+	t.Cleanup(walletServer.Close)
+
+	c := &swapChain{
+		t:      t,
+		server: server,
+		node:   client.NewNodeClient([]string{gateway.URL}, client.Options{Retries: -1}),
+		client: client.NewWalletClient([]string{walletServer.URL}, client.Options{Retries: -1}),
+	}
+	c.mine()
+	return c
+}
+
+// Funzione che crea le due catene dello scambio: Alice mina la
+// prima e Bob la seconda, i wallet server hanno le chiavi di entrambi
+func newSwapNetwork(t *testing.T) (alice *wallet.Wallet, bob *wallet.Wallet, a *swapChain, b *swapChain) {
+	t.Helper()
+	ks := keystore.NewKeystore(t.TempDir())
+	alice, err := ks.Create(PASSWORD)
+	check(t, err)
+	bob, err = ks.Create(PASSWORD)
+	check(t, err)
+	return alice, bob, newSwapChain(t, "swap-a", alice, ks), newSwapChain(t, "swap-b", bob, ks)
+}
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Metodo che mina un blocco con le transazioni in attesa
+func (c *swapChain) mine() {
+	c.t.Helper()
+	check(c.t, c.server.GetBloackchain().Mining())
+}
+
+// Metodo che ritorna l'altezza del prossimo blocco
+func (c *swapChain) next() int64 {
+	return int64(c.server.GetBloackchain().Height() + 1)
+}
+
+// Metodo che controlla il bilancio di un address
+func (c *swapChain) assertBalance(ctx context.Context, address string, expected float32) {
+	c.t.Helper()
+	amount, err := c.node.Amount(ctx, address)
+	check(c.t, err)
+	if amount != expected {
+		c.t.Fatalf("balance of %s is %v, expected %v", address, amount, expected)
+	}
+}
+
+// Metodo che controlla lo stato del contratto e lo ritorna
+func (c *swapChain) assertState(ctx context.Context, contract *htlc.Contract, state string) *blockchain.HtlcStatus {
+	c.t.Helper()
+	status, err := c.client.HtlcStatus(ctx, contract)
+	check(c.t, err)
+	if status.State != state {
+		c.t.Fatalf("htlc %s is %s, expected %s", status.BlockchainAddress, status.State, state)
+	}
+	return status
+}
+
+// Funzione che controlla che err sia un errore delle API con il codice
+func expectCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var e *api_error.ApiError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected error %s, got %v", code, err)
+	}
+	if e.Code != code {
+		t.Fatalf("expected error %s, got %s: %s", code, e.Code, e.Message)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// Alice scambia VALUE della catena A con VALUE della catena B di Bob:
+// Alice blocca per prima, con il timeout più lontano, Bob blocca con
+// lo stesso hash e un timeout più vicino, Alice riscatta su B
+// rivelando il preimage e Bob lo usa per riscattare su A
+func TestHtlcSwap(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	aliceWallet, bobWallet, a, b := newSwapNetwork(t)
+	alice, bob := aliceWallet.BlockchainAddress(), bobWallet.BlockchainAddress()
+	value := VALUE
+
+	// Alice blocca sulla catena A, il preimage lo genera il suo
+	// wallet server e lei lo tiene segreto
+	timeoutA := a.next() + 10
+	lockA, err := a.client.LockHtlc(ctx, &wallet_transaction_request.HtlcRequest{
+		SenderBlockchainAddress:    &alice,
+		RecipientBlockchainAddress: &bob,
+		Timeout:                    &timeoutA,
+		Value:                      &value,
+		Password:                   stringPtr(PASSWORD),
+	})
+	if err != nil {
+		t.Fatalf("locking on A: %v", err)
+	}
+	if lockA.Preimage == "" {
+		t.Fatal("the wallet server did not return the generated preimage")
+	}
+	a.mine()
+
+	// Bob controlla i fondi di Alice e blocca sulla catena B con lo
+	// stesso hash, il suo timeout scade prima di quello di Alice
+	statusA := a.assertState(ctx, lockA.Contract, blockchain.HTLC_LOCKED)
+	if statusA.Amount != 0.5 {
+		t.Fatalf("htlc on A holds %v", statusA.Amount)
+	}
+	timeoutB := b.next() + 5
+	lockB, err := b.client.LockHtlc(ctx, &wallet_transaction_request.HtlcRequest{
+		SenderBlockchainAddress:    &bob,
+		RecipientBlockchainAddress: &alice,
+		Hash:                       &lockA.Contract.Hash,
+		Timeout:                    &timeoutB,
+		Value:                      &value,
+		Password:                   stringPtr(PASSWORD),
+	})
+	if err != nil {
+		t.Fatalf("locking on B: %v", err)
+	}
+	if lockB.Preimage != "" {
+		t.Fatal("the wallet server generated a preimage for a given hash")
+	}
+	b.mine()
+
+	// Prima del timeout Bob non può riprendersi i fondi e un preimage
+	// sbagliato non li riscatta
+	_, err = b.client.RefundHtlc(ctx, lockB.Contract)
+	expectCode(t, err, api_error.CODE_TIMEOUT_NOT_REACHED)
+	wrong, _, err := htlc.NewPreimage()
+	check(t, err)
+	_, err = b.client.ClaimHtlc(ctx, lockB.Contract, wrong)
+	expectCode(t, err, api_error.CODE_INVALID_FIELD)
+
+	// Alice riscatta su B e così rivela il preimage
+	if _, err := b.client.ClaimHtlc(ctx, lockB.Contract, lockA.Preimage); err != nil {
+		t.Fatalf("claiming on B: %v", err)
+	}
+	// Una seconda spesa degli stessi fondi non entra nel pool
+	_, err = b.client.ClaimHtlc(ctx, lockB.Contract, lockA.Preimage)
+	expectCode(t, err, api_error.CODE_CONFLICT)
+	b.mine()
+	statusB := b.assertState(ctx, lockB.Contract, blockchain.HTLC_CLAIMED)
+	if statusB.Preimage != lockA.Preimage {
+		t.Fatal("the claim on B did not reveal the preimage")
+	}
+
+	// Bob legge il preimage dalla catena B e riscatta su A
+	if _, err := a.client.ClaimHtlc(ctx, lockA.Contract, statusB.Preimage); err != nil {
+		t.Fatalf("claiming on A: %v", err)
+	}
+	a.mine()
+	a.assertState(ctx, lockA.Contract, blockchain.HTLC_CLAIMED)
+
+	// Alice ha minato tre blocchi su A e ne ha ceduto metà ricompensa,
+	// Bob tre su B
+	a.assertBalance(ctx, bob, 0.5)
+	a.assertBalance(ctx, alice, 3*blockchain.MINING_REWARD-0.5)
+	b.assertBalance(ctx, alice, 0.5)
+	b.assertBalance(ctx, bob, 3*blockchain.MINING_REWARD-0.5)
+	a.assertBalance(ctx, lockA.BlockchainAddress, 0)
+	b.assertBalance(ctx, lockB.BlockchainAddress, 0)
+}
+
+// Bob non risponde: dopo il timeout Alice si riprende i fondi e
+// il riscatto non è più possibile
+func TestHtlcRefund(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	aliceWallet, bobWallet, a, _ := newSwapNetwork(t)
+	alice, bob := aliceWallet.BlockchainAddress(), bobWallet.BlockchainAddress()
+	value := VALUE
+
+	timeout := a.next() + 3
+	lock, err := a.client.LockHtlc(ctx, &wallet_transaction_request.HtlcRequest{
+		SenderBlockchainAddress:    &alice,
+		RecipientBlockchainAddress: &bob,
+		Timeout:                    &timeout,
+		Value:                      &value,
+		Password:                   stringPtr(PASSWORD),
+	})
+	if err != nil {
+		t.Fatalf("locking on A: %v", err)
+	}
+	for a.next() < timeout {
+		a.mine()
+	}
+	status := a.assertState(ctx, lock.Contract, blockchain.HTLC_LOCKED)
+	if !status.TimedOut {
+		t.Fatal("htlc not timed out")
+	}
+
+	_, err = a.client.ClaimHtlc(ctx, lock.Contract, lock.Preimage)
+	expectCode(t, err, api_error.CODE_EXPIRED)
+	if _, err := a.client.RefundHtlc(ctx, lock.Contract); err != nil {
+		t.Fatalf("refunding on A: %v", err)
+	}
+	a.mine()
+	a.assertState(ctx, lock.Contract, blockchain.HTLC_REFUNDED)
+	mined := float32(a.next() - 1)
+	a.assertBalance(ctx, alice, mined*blockchain.MINING_REWARD)
+	a.assertBalance(ctx, bob, 0)
+}
@@ -0,0 +1,537 @@
+package blockchain_server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/script"
+	"github.com/iltommi1995/blockchain-go/pkg/events"
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+)
+
+// Versione delle API REST, da cambiare quando cambiano in modo
+// non compatibile
+const API_VERSION = "1.0.0"
+
+// Metodo che genera il documento OpenAPI dagli endpoint di Routes
+// Ritorna un errore se un endpoint non è documentato o se è
+// documentato un endpoint che non esiste, gli endpoint di
+// amministrazione richiedono la API key
+func (bcs *BlockchainServer) OpenAPI() (*openapi.Document, error) {
+	doc := openapi.NewDocument("Blockchain node API", API_VERSION,
+		"REST API of a blockchain node. Errors use the body described by the Error schema.")
+	doc.Components.Schemas = schemas()
+	doc.Components.SecuritySchemes["apiKey"] = &openapi.SecurityScheme{Type: "apiKey", In: "header", Name: API_KEY_HEADER}
+	doc.Components.SecuritySchemes["bearer"] = &openapi.SecurityScheme{Type: "http", Scheme: "bearer"}
+
+	routes := bcs.Routes()
+	paths := make([]string, 0, len(routes))
+	endpoints := endpoints()
+	for _, r := range routes {
+		paths = append(paths, r.Path)
+		if r.Authority != AUTHORITY_ADMIN {
+			continue
+		}
+		for _, e := range endpoints {
+			if e.Route != r.Path {
+				continue
+			}
+			for _, op := range e.Operations {
+				op.Security = []map[string][]string{{"apiKey": {}}, {"bearer": {}}}
+				op.Responses["401"] = errorResponse("a valid API key is required")
+			}
+		}
+	}
+	if err := doc.AddEndpoints(paths, endpoints); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Resolver dell'endpoint "/openapi.json"
+func (bcs *BlockchainServer) GetOpenAPI(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		doc, err := bcs.OpenAPI()
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.Internal(err.Error()))
+			return
+		}
+		m, _ := doc.Marshal()
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
+	}
+}
+
+func errorResponse(description string) *openapi.Response {
+	return openapi.JsonResponse(description, openapi.Ref("Error"))
+}
+
+func statusResponse(description string) *openapi.Response {
+	return openapi.JsonResponse(description, openapi.Ref("Status"))
+}
+
+// Schemi dei body delle richieste e delle risposte
+func schemas() map[string]*openapi.Schema {
+	return map[string]*openapi.Schema{
+		"Error": api_error.Schema(),
+		"Status": openapi.Object(map[string]*openapi.Schema{
+			"message": openapi.String("\"success\""),
+		}, "message"),
+		"Transaction": openapi.Object(map[string]*openapi.Schema{
+			"sender_blockchain_address":    openapi.String("COINBASE TRANSACTION for mining rewards"),
+			"recipient_blockchain_address": openapi.String(""),
+			"value":                        openapi.Number(""),
+			"sender_public_key":            openapi.String("hex public key of the sender, whose address must be sender_blockchain_address; absent in coinbase, multisig, htlc and script transactions"),
+			"signature":                    openapi.String("hex signature of the transaction by sender_public_key"),
+			"valid_after":                  openapi.Integer("block height below 500000000, unix time in seconds from there; the first block that may include the transaction"),
+			"valid_until":                  openapi.Integer("block height below 500000000, unix time in seconds from there; the last block that may include the transaction"),
+			"chain_id":                     openapi.String("network the transaction is signed for, absent in coinbase transactions"),
+			"nonce":                        openapi.Integer("random, part of the signed payload; omitted when 0"),
+			"witness":                      openapi.Ref("Witness"),
+			"htlc":                         openapi.Ref("Htlc"),
+			"script":                       openapi.Ref("Script"),
+			"contract":                     openapi.Ref("ContractMessage"),
+			"asset":                        openapi.Ref("AssetOperation"),
+		}, "sender_blockchain_address", "recipient_blockchain_address", "value"),
+		"Block": openapi.Object(map[string]*openapi.Schema{
+			"timestamp":     openapi.Integer("unix time in nanoseconds"),
+			"nonce":         openapi.Integer("proof of work nonce"),
+			"previous_hash": openapi.String("hex sha256 of the previous block"),
+			"state_root":    openapi.String("hex sha256 of the contract and asset state after the block, omitted while there are neither contracts nor assets"),
+			"transactions":  openapi.Array(openapi.Ref("Transaction")),
+		}, "timestamp", "nonce", "previous_hash", "transactions"),
+		"Chain": openapi.Object(map[string]*openapi.Schema{
+			"chain": openapi.Array(openapi.Ref("Block")),
+		}, "chain"),
+		"TransactionRequest": openapi.Object(map[string]*openapi.Schema{
+			"sender_blockchain_address":    openapi.String(""),
+			"recipient_blockchain_address": openapi.String(""),
+			"sender_public_key":            openapi.String("128 hex characters, X and Y of the P-256 key; not for multisig, htlc and script senders"),
+			"value":                        openapi.Number("must be greater than 0"),
+			"valid_after":                  openapi.Integer("block height below 500000000, unix time in seconds from there; the first block that may include the transaction"),
+			"valid_until":                  openapi.Integer("block height below 500000000, unix time in seconds from there; the last block that may include the transaction"),
+			"chain_id":                     openapi.String("chain_id of the node, see /network; part of the signed payload"),
+			"nonce":                        openapi.Integer("random, below 2^53, part of the signed payload; the chain accepts a signed payload only once, so equal transactions need different nonces"),
+			"signature":                    openapi.String("128 hex characters, R and S of the ECDSA signature; not for multisig, htlc and script senders"),
+			"witness":                      openapi.Ref("Witness"),
+			"htlc":                         openapi.Ref("Htlc"),
+			"script":                       openapi.Ref("Script"),
+			"contract":                     openapi.Ref("ContractMessage"),
+			"asset":                        openapi.Ref("AssetOperation"),
+		}, "sender_blockchain_address", "recipient_blockchain_address", "value"),
+		"Witness":         multisig.Schema(),
+		"Htlc":            htlc.SpendSchema(),
+		"HtlcContract":    htlc.ContractSchema(),
+		"Script":          script.Schema(),
+		"HtlcStatus":      blockchain.HtlcStatusSchema(openapi.Ref("HtlcContract")),
+		"ContractMessage": contract.Schema(),
+		"ContractInfo":    blockchain.ContractInfoSchema(),
+		"CallRequest": openapi.Object(map[string]*openapi.Schema{
+			"blockchain_address": openapi.String("address of the contract"),
+			"caller":             openapi.String("address pushed by CALLER, empty when missing; not authenticated, since the call changes nothing"),
+			"args":               openapi.Array(openapi.String("hex argument, pushed on the stack in order")),
+			"gas_limit":          openapi.Integer(fmt.Sprintf("from 1 to %d, the default", contract.MAX_GAS)),
+		}, "blockchain_address"),
+		"CallResult": blockchain.CallResultSchema(),
+		"TransactionPool": openapi.Object(map[string]*openapi.Schema{
+			"transactions": openapi.Array(openapi.Ref("Transaction")),
+			"length":       openapi.Integer(""),
+		}, "transactions", "length"),
+		"Amount": openapi.Object(map[string]*openapi.Schema{
+			"amount": openapi.Number("with asset, an integer in the smallest unit of the asset"),
+			"asset":  openapi.String("the asset parameter, if given"),
+		}, "amount"),
+		"AssetOperation": asset.Schema(),
+		"AssetInfo":      asset.InfoSchema(),
+		"Assets": openapi.Object(map[string]*openapi.Schema{
+			"assets": openapi.Array(openapi.Ref("AssetInfo")),
+		}, "assets"),
+		"Network": blockchain.NetworkInfoSchema(),
+		"Peers": openapi.Object(map[string]*openapi.Schema{
+			"peers":     openapi.Array(openapi.String("host:port")),
+			"connected": openapi.Array(openapi.String("host:port")),
+		}, "peers", "connected"),
+		"Peer": openapi.Object(map[string]*openapi.Schema{
+			"address":          openapi.String("host:port"),
+			"source":           openapi.String(""),
+			"inbound":          openapi.Boolean(""),
+			"last_seen":        openapi.Integer(""),
+			"last_attempt":     openapi.Integer(""),
+			"failures":         openapi.Integer(""),
+			"node_id":          openapi.String(""),
+			"public_key":       openapi.String(""),
+			"protocol_version": openapi.Integer(""),
+			"best_height":      openapi.Integer(""),
+			"features":         openapi.Array(openapi.String("")),
+		}, "address"),
+		"Reputation": openapi.Object(map[string]*openapi.Schema{
+			"key":          openapi.String("\"host:\" and the IP the peer connects from, or \"node:\" and its node id"),
+			"address":      openapi.String("host:port last announced by the peer"),
+			"score":        openapi.Integer(""),
+			"banned_until": openapi.Integer(""),
+			"ban_reason":   openapi.String(""),
+		}, "key", "address", "score"),
+		"Bans": openapi.Object(map[string]*openapi.Schema{
+			"bans":   openapi.Array(openapi.Ref("Reputation")),
+			"length": openapi.Integer(""),
+		}, "bans", "length"),
+		"Event": openapi.Object(map[string]*openapi.Schema{
+			"type":   {Type: "string", Enum: events.Types()},
+			"height": openapi.Integer("block height for chain events"),
+			"hash":   openapi.String("block hash for chain events"),
+			"time":   openapi.Integer("unix time in nanoseconds"),
+			"data":   {Description: "transaction, block, reorg or peer details"},
+			"replay": openapi.Boolean("the event was rebuilt from the chain for a resumed stream"),
+		}, "type", "time"),
+		"WebhookRequest": openapi.Object(map[string]*openapi.Schema{
+			"url":           openapi.String("http or https url that receives the POST requests"),
+			"secret":        openapi.String("HMAC key, generated when missing"),
+			"addresses":     openapi.Array(openapi.String("blockchain address")),
+			"types":         openapi.Array(&openapi.Schema{Type: "string", Enum: events.Types()}),
+			"confirmations": openapi.Integer("confirmations before tx_confirmed is delivered, default 1"),
+		}, "url"),
+		"Webhook": openapi.Object(map[string]*openapi.Schema{
+			"id":            openapi.String(""),
+			"url":           openapi.String(""),
+			"secret":        openapi.String("only returned when the webhook is created"),
+			"addresses":     openapi.Array(openapi.String("")),
+			"types":         openapi.Array(openapi.String("")),
+			"confirmations": openapi.Integer(""),
+			"created":       openapi.Integer(""),
+		}, "id", "url", "types", "confirmations", "created"),
+		"Webhooks": openapi.Object(map[string]*openapi.Schema{
+			"webhooks": openapi.Array(openapi.Ref("Webhook")),
+			"length":   openapi.Integer(""),
+		}, "webhooks", "length"),
+		"Delivery": openapi.Object(map[string]*openapi.Schema{
+			"id":           openapi.String(""),
+			"hook_id":      openapi.String(""),
+			"type":         openapi.String(""),
+			"payload":      {Description: "body sent to the webhook"},
+			"attempts":     openapi.Integer(""),
+			"next_attempt": openapi.Integer("unix time in nanoseconds"),
+			"last_error":   openapi.String(""),
+			"created":      openapi.Integer(""),
+		}, "id", "hook_id", "type", "payload", "attempts", "next_attempt", "created"),
+		"Deliveries": openapi.Object(map[string]*openapi.Schema{
+			"deliveries": openapi.Array(openapi.Ref("Delivery")),
+			"length":     openapi.Integer(""),
+		}, "deliveries", "length"),
+		"JsonRpcRequest": openapi.Object(map[string]*openapi.Schema{
+			"jsonrpc": openapi.String("\"2.0\""),
+			"method":  openapi.String(""),
+			"params":  openapi.Map(&openapi.Schema{}),
+			"id":      openapi.String("string, number or null, missing for notifications"),
+		}, "jsonrpc", "method"),
+	}
+}
+
+// Operazioni di tutti gli endpoint di Routes
+func endpoints() []*openapi.Endpoint {
+	getChain := func(id string) map[string]*openapi.Operation {
+		return map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: id,
+				Summary:     "Full chain",
+				Tags:        []string{"chain"},
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("the chain", openapi.Ref("Chain"))},
+			},
+		}
+	}
+	addressParam := openapi.Query("blockchain_address", "", true, openapi.String(""))
+	assetParam := openapi.Query("asset", "symbol of an issued asset; without it, the balance of the coin of the chain", false, openapi.String(""))
+	webhookID := openapi.PathParam("id", "webhook id")
+
+	return []*openapi.Endpoint{
+		{Route: "/", Operations: getChain("getRoot")},
+		{Route: "/chain", Operations: getChain("getChain")},
+		{Route: "/transactions", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "listTransactions",
+				Summary:     "Transactions waiting in the pool",
+				Tags:        []string{"transactions"},
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("the pool", openapi.Ref("TransactionPool"))},
+			},
+			http.MethodPost: {
+				OperationID: "sendTransaction",
+				Summary:     "Add a signed transaction to the pool",
+				Tags:        []string{"transactions"},
+				RequestBody: openapi.JsonBody(openapi.Ref("TransactionRequest")),
+				Responses: map[string]*openapi.Response{
+					"201": statusResponse("accepted"),
+					"400": errorResponse("invalid json, missing or invalid field, invalid signature"),
+					"409": errorResponse("the signed payload is already in the chain or in the pool"),
+					"422": errorResponse("insufficient balance"),
+				},
+			},
+		}},
+		{Route: "/amount", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getAmount",
+				Summary:     "Balance of an address",
+				Tags:        []string{"accounts"},
+				Parameters:  []*openapi.Parameter{addressParam, assetParam},
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the balance", openapi.Ref("Amount")),
+					"400": errorResponse("missing blockchain_address"),
+					"404": errorResponse("the asset was never issued"),
+				},
+			},
+		}},
+		{Route: "/network", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getNetwork",
+				Summary:     "Chain id, genesis and height of the node's network",
+				Description: "Wallets put chain_id in the signed payload of their transactions, so a signature is valid only on this network.",
+				Tags:        []string{"network"},
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("the network", openapi.Ref("Network"))},
+			},
+		}},
+		{Route: "/peers", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getPeers",
+				Summary:     "Known and connected peers",
+				Tags:        []string{"network"},
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("the peers", openapi.Ref("Peers"))},
+			},
+		}},
+		{Route: "/htlc/status", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "getHtlcStatus",
+				Summary:     "Funds and state of a hash time-locked contract",
+				Description: "The preimage is returned once the recipient claims, so the other party of an atomic swap can claim on the other chain.",
+				Tags:        []string{"htlc"},
+				RequestBody: openapi.JsonBody(openapi.Ref("HtlcContract")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the contract status", openapi.Ref("HtlcStatus")),
+					"400": errorResponse("invalid json, missing or invalid field"),
+				},
+			},
+		}},
+		{Route: "/htlc/claim", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "claimHtlc",
+				Summary:     "Send the locked funds to the recipient, revealing the preimage",
+				Description: "The transaction is valid until the block before the timeout.",
+				Tags:        []string{"htlc"},
+				RequestBody: openapi.JsonBody(openapi.Ref("Htlc")),
+				Responses: map[string]*openapi.Response{
+					"201": openapi.JsonResponse("the transaction added to the pool", openapi.Ref("TransactionRequest")),
+					"400": errorResponse("invalid json, missing or invalid field, wrong preimage"),
+					"409": errorResponse("a transaction spending the funds is already in the pool"),
+					"422": errorResponse("no funds locked or timeout reached"),
+				},
+			},
+		}},
+		{Route: "/htlc/refund", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "refundHtlc",
+				Summary:     "Send the locked funds back to the sender after the timeout",
+				Tags:        []string{"htlc"},
+				RequestBody: openapi.JsonBody(openapi.Ref("HtlcContract")),
+				Responses: map[string]*openapi.Response{
+					"201": openapi.JsonResponse("the transaction added to the pool", openapi.Ref("TransactionRequest")),
+					"400": errorResponse("invalid json, missing or invalid field"),
+					"409": errorResponse("a transaction spending the funds is already in the pool"),
+					"422": errorResponse("no funds locked or timeout not reached"),
+				},
+			},
+		}},
+		{Route: "/contract", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getContract",
+				Summary:     "Code and storage of a deployed contract",
+				Tags:        []string{"contracts"},
+				Parameters:  []*openapi.Parameter{addressParam},
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the contract", openapi.Ref("ContractInfo")),
+					"400": errorResponse("missing blockchain_address"),
+					"404": errorResponse("no contract at the address"),
+				},
+			},
+		}},
+		{Route: "/contract/call", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "callContract",
+				Summary:     "Run a contract on the state of the last block without changing it",
+				Description: "Calls that change the storage are transactions with a contract field, sent to /transactions.",
+				Tags:        []string{"contracts"},
+				RequestBody: openapi.JsonBody(openapi.Ref("CallRequest")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the returned value", openapi.Ref("CallResult")),
+					"400": errorResponse("invalid json, missing or invalid field"),
+					"404": errorResponse("no contract at the address"),
+					"422": errorResponse("the call fails"),
+				},
+			},
+		}},
+		{Route: "/assets", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getAssets",
+				Summary:     "Assets issued up to the last block, with their metadata and supply",
+				Description: "Assets are issued, minted, burned and transferred with transactions that have an asset field and value 0.",
+				Tags:        []string{"assets"},
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("the assets, sorted by symbol", openapi.Ref("Assets"))},
+			},
+		}},
+		{Route: "/rpc", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "rpc",
+				Summary:     "JSON-RPC 2.0 request or batch",
+				Description: "The same path accepts a websocket upgrade, every message is a request. " +
+					"Browser pages of other origins can open it only if they are in -allowed-origins, otherwise the upgrade gets 403. " +
+					"Mining methods require the API key of the HTTP request.",
+				Tags:        []string{"rpc"},
+				RequestBody: openapi.JsonBody(openapi.Ref("JsonRpcRequest")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("JSON-RPC response or batch of responses", openapi.Map(&openapi.Schema{})),
+					"204": {Description: "only notifications were sent"},
+				},
+			},
+		}},
+		{Route: "/events", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "streamEvents",
+				Summary:     "Stream of chain, pool and peer events",
+				Description: "Server-Sent Events, or json messages on a websocket when the request is an upgrade. " +
+					"Browser pages of other origins can open the websocket only if they are in -allowed-origins, otherwise the upgrade gets 403. " +
+					"new_tip events carry the block height as id, so browsers resume with Last-Event-ID.",
+				Tags: []string{"events"},
+				Parameters: []*openapi.Parameter{
+					openapi.Query("types", "comma separated event types, all when missing", false, openapi.String("")),
+					openapi.Query("address", "only transactions of these addresses, repeatable or comma separated", false, openapi.String("")),
+					openapi.Query("from_height", "replay the blocks from this height before the live events", false, openapi.Integer("")),
+					openapi.Header("Last-Event-ID", "resume after this block height"),
+				},
+				Responses: map[string]*openapi.Response{
+					"200": {Description: "event stream", Content: map[string]*openapi.MediaType{
+						"text/event-stream": {Schema: openapi.Ref("Event")},
+					}},
+					"400": errorResponse("unknown event type or invalid height"),
+				},
+			},
+		}},
+		{Route: "/openapi.json", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getOpenAPI",
+				Summary:     "This document",
+				Tags:        []string{"meta"},
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("OpenAPI document", openapi.Map(&openapi.Schema{}))},
+			},
+		}},
+		{Route: EXPLORER_PATH, Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getExplorer",
+				Summary:     "Block explorer web pages",
+				Description: "Latest blocks. The other pages are block/{hash or height}, tx/{hash}, address/{address}, mempool, peers and search?q={query}.",
+				Tags:        []string{"meta"},
+				Parameters:  []*openapi.Parameter{openapi.Query("from", "height of the first block listed", false, openapi.Integer(""))},
+				Responses: map[string]*openapi.Response{
+					"200": {Description: "html page", Content: map[string]*openapi.MediaType{"text/html": {Schema: openapi.String("")}}},
+					"404": {Description: "html page of a block, transaction or address that does not exist", Content: map[string]*openapi.MediaType{"text/html": {Schema: openapi.String("")}}},
+				},
+			},
+		}},
+		{Route: "/mine", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "mine",
+				Summary:     "Mine a block with the pending transactions",
+				Tags:        []string{"mining"},
+				Responses: map[string]*openapi.Response{
+					"200": statusResponse("block mined"),
+					"409": errorResponse("the chain changed while mining"),
+				},
+			},
+		}},
+		{Route: "/mine/start", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "startMining",
+				Summary:     "Mine a block periodically until the server stops",
+				Tags:        []string{"mining"},
+				Responses:   map[string]*openapi.Response{"200": statusResponse("mining started")},
+			},
+		}},
+		{Route: "/admin/bans", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "listBans",
+				Summary:     "Banned hosts and node ids",
+				Tags:        []string{"network"},
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("banned peers", openapi.Ref("Bans"))},
+			},
+			http.MethodDelete: {
+				OperationID: "unban",
+				Summary:     "Lift a ban, or all bans without address",
+				Tags:        []string{"network"},
+				Parameters:  []*openapi.Parameter{openapi.Query("address", "key of the ban, or host:port last announced by the peer", false, openapi.String(""))},
+				Responses: map[string]*openapi.Response{
+					"200": statusResponse("ban lifted"),
+					"404": errorResponse("the peer is not banned"),
+				},
+			},
+		}},
+		{Route: "/admin/webhooks", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "listWebhooks",
+				Summary:     "Registered webhooks, without secrets",
+				Tags:        []string{"webhooks"},
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("webhooks", openapi.Ref("Webhooks"))},
+			},
+			http.MethodPost: {
+				OperationID: "createWebhook",
+				Summary:     "Register a webhook",
+				Description: "Deliveries are POSTed with the X-Webhook-Signature header, " +
+					"sha256= followed by the hex HMAC-SHA256 of \"<X-Webhook-Timestamp>.<body>\".",
+				Tags:        []string{"webhooks"},
+				RequestBody: openapi.JsonBody(openapi.Ref("WebhookRequest")),
+				Responses: map[string]*openapi.Response{
+					"201": openapi.JsonResponse("the webhook with its secret", openapi.Ref("Webhook")),
+					"400": errorResponse("invalid json or field"),
+				},
+			},
+		}},
+		{Route: WEBHOOK_PATH, Path: WEBHOOK_PATH + "{id}", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getWebhook",
+				Summary:     "A webhook, without secret",
+				Tags:        []string{"webhooks"},
+				Parameters:  []*openapi.Parameter{webhookID},
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the webhook", openapi.Ref("Webhook")),
+					"404": errorResponse("webhook not found"),
+				},
+			},
+			http.MethodDelete: {
+				OperationID: "deleteWebhook",
+				Summary:     "Remove a webhook and its pending deliveries",
+				Tags:        []string{"webhooks"},
+				Parameters:  []*openapi.Parameter{webhookID},
+				Responses: map[string]*openapi.Response{
+					"200": statusResponse("removed"),
+					"404": errorResponse("webhook not found"),
+				},
+			},
+		}},
+		{Route: "/admin/webhooks/deliveries", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "listWebhookDeliveries",
+				Summary:     "Deliveries waiting to be sent or retried",
+				Tags:        []string{"webhooks"},
+				Parameters:  []*openapi.Parameter{openapi.Query("hook_id", "only the deliveries of this webhook", false, openapi.String(""))},
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("deliveries", openapi.Ref("Deliveries"))},
+			},
+		}},
+	}
+}
@@ -0,0 +1,64 @@
+package blockchain_server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
+	wallet_transaction_request "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+)
+
+// Una transazione firmata offline e inoltrata dal wallet server entra
+// una volta sola: chi la rilancia, prima o dopo il mining, riceve un
+// conflitto, mentre lo stesso pagamento preparato di nuovo ha un altro
+// nonce e passa
+func TestRelayReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ks := keystore.NewKeystore(t.TempDir())
+	alice, err := ks.Create(PASSWORD)
+	check(t, err)
+	bob := wallet.NewWallet()
+	c := newSwapChain(t, "relay", alice, ks)
+
+	sender, recipient, value := alice.BlockchainAddress(), bob.BlockchainAddress(), "0.25"
+	unsigned := func() *wallet_transaction_request.UnsignedTransactionRequest {
+		return &wallet_transaction_request.UnsignedTransactionRequest{
+			SenderBlockchainAddress:    &sender,
+			RecipientBlockchainAddress: &recipient,
+			Value:                      &value,
+		}
+	}
+	first, err := c.client.UnsignedTransaction(ctx, unsigned())
+	check(t, err)
+	second, err := c.client.UnsignedTransaction(ctx, unsigned())
+	check(t, err)
+	if first.ChainID != "relay" {
+		t.Fatalf("unsigned transaction for chain %q", first.ChainID)
+	}
+	if first.Nonce == second.Nonce || first.SigningHash == second.SigningHash {
+		t.Fatal("two payments prepared with the same payload")
+	}
+
+	signed, err := first.Sign(alice)
+	check(t, err)
+	check(t, c.client.RelayTransaction(ctx, signed))
+	err = c.client.RelayTransaction(ctx, signed)
+	expectCode(t, err, api_error.CODE_CONFLICT)
+	c.mine()
+	err = c.client.RelayTransaction(ctx, signed)
+	expectCode(t, err, api_error.CODE_CONFLICT)
+	resigned, err := first.Sign(alice)
+	check(t, err)
+	err = c.client.RelayTransaction(ctx, resigned)
+	expectCode(t, err, api_error.CODE_CONFLICT)
+
+	signed, err = second.Sign(alice)
+	check(t, err)
+	check(t, c.client.RelayTransaction(ctx, signed))
+	c.mine()
+	c.assertBalance(ctx, recipient, 0.5)
+}
@@ -0,0 +1,61 @@
+package blockchain_server
+
+import "net/http"
+
+// Autorità richiesta per chiamare un endpoint
+const (
+	// Chiunque può chiamare l'endpoint
+	AUTHORITY_PUBLIC = "public"
+	// Solo chi ha una API key valida
+	AUTHORITY_ADMIN = "admin"
+)
+
+// Endpoint del server, con il path, l'autorità richiesta e il resolver
+type Route struct {
+	Path      string
+	Authority string
+	Handler   http.HandlerFunc
+}
+
+// Metodo che ritorna tutti gli endpoint del server
+// Quelli per i client stanno nella root e quelli di amministrazione
+// sotto "/admin/", gli altri nodi usano il protocollo p2p
+func (bcs *BlockchainServer) Routes() []Route {
+	return []Route{
+		// Endpoint per i client
+		{"/", AUTHORITY_PUBLIC, bcs.GetChain},
+		{"/chain", AUTHORITY_PUBLIC, bcs.GetChain},
+		{"/transactions", AUTHORITY_PUBLIC, bcs.Transactions},
+		{"/amount", AUTHORITY_PUBLIC, bcs.Amount},
+		{"/network", AUTHORITY_PUBLIC, bcs.Network},
+		{"/peers", AUTHORITY_PUBLIC, bcs.Peers},
+		// Contratti HTLC per gli scambi atomici tra catene
+		{"/htlc/status", AUTHORITY_PUBLIC, bcs.HtlcStatus},
+		{"/htlc/claim", AUTHORITY_PUBLIC, bcs.ClaimHtlc},
+		{"/htlc/refund", AUTHORITY_PUBLIC, bcs.RefundHtlc},
+		// Contratti pubblicati, le chiamate in lettura non cambiano lo
+		// stato
+		{"/contract", AUTHORITY_PUBLIC, bcs.Contract},
+		{"/contract/call", AUTHORITY_PUBLIC, bcs.CallContract},
+		// Token emessi dagli utenti
+		{"/assets", AUTHORITY_PUBLIC, bcs.Assets},
+		// JSON-RPC 2.0 via POST o websocket, i metodi di
+		// amministrazione controllano da soli la API key
+		{"/rpc", AUTHORITY_PUBLIC, bcs.Rpc},
+		// Eventi della catena, del transaction pool e dei peer via
+		// Server-Sent Events o websocket
+		{"/events", AUTHORITY_PUBLIC, bcs.Events},
+		// Documento OpenAPI generato da questi endpoint
+		{"/openapi.json", AUTHORITY_PUBLIC, bcs.GetOpenAPI},
+		// Block explorer, pagine html per chi guarda la catena
+		{EXPLORER_PATH, AUTHORITY_PUBLIC, bcs.Explorer},
+
+		// Endpoint di amministrazione
+		{"/mine", AUTHORITY_ADMIN, bcs.Mine},
+		{"/mine/start", AUTHORITY_ADMIN, bcs.StartMine},
+		{"/admin/bans", AUTHORITY_ADMIN, bcs.Bans},
+		{"/admin/webhooks", AUTHORITY_ADMIN, bcs.Webhooks},
+		{WEBHOOK_PATH, AUTHORITY_ADMIN, bcs.Webhook},
+		{"/admin/webhooks/deliveries", AUTHORITY_ADMIN, bcs.WebhookDeliveries},
+	}
+}
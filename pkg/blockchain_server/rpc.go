@@ -0,0 +1,217 @@
+package blockchain_server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/amount_response"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	blockchain_transaction_request "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/explorer"
+	"github.com/iltommi1995/blockchain-go/pkg/json_rpc"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/node"
+)
+
+// Codici di errore dei metodi JSON-RPC del nodo, quelli da -32000
+// a -32099 sono riservati alle applicazioni
+const (
+	RPC_UNAUTHORIZED         = -32001
+	RPC_NOT_FOUND            = -32004
+	RPC_TRANSACTION_REJECTED = -32010
+	RPC_MINING_FAILED        = -32020
+)
+
+// Chiave del contesto che dice se la richiesta ha una API key valida
+type adminKey struct{}
+
+// Blocco restituito dai metodi della catena
+type BlockResult struct {
+	Height int          `json:"height"`
+	Hash   string       `json:"hash"`
+	Block  *block.Block `json:"block"`
+}
+
+// Metodo che crea il server JSON-RPC e registra i metodi, che usano
+// la stessa blockchain degli endpoint REST
+func (bcs *BlockchainServer) newRpcServer() *json_rpc.Server {
+	s := json_rpc.NewServer()
+	s.Register("chain_getHeight", bcs.rpcGetHeight)
+	s.Register("chain_getBlockByHeight", bcs.rpcGetBlockByHeight)
+	s.Register("chain_getBlockByHash", bcs.rpcGetBlockByHash)
+	s.Register("tx_send", bcs.rpcSendTransaction)
+	s.Register("account_getBalance", bcs.rpcGetBalance)
+	s.Register("account_getActivity", bcs.rpcGetActivity)
+	s.Register("mempool_list", bcs.rpcListMempool)
+	s.Register("mining_mine", admin(bcs.rpcMine))
+	s.Register("mining_start", admin(bcs.rpcStartMining))
+	s.Register("mining_stop", admin(bcs.rpcStopMining))
+	return s
+}
+
+// Resolver dell'endpoint "/rpc", con POST o con un websocket
+// I metodi di amministrazione richiedono la API key nella richiesta
+// HTTP, per un websocket quella dell'upgrade
+func (bcs *BlockchainServer) Rpc(w http.ResponseWriter, req *http.Request) {
+	ctx := context.WithValue(req.Context(), adminKey{}, bcs.validApiKey(apiKey(req)))
+	bcs.rpc.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// Funzione che limita un metodo a chi ha una API key valida
+func admin(h json_rpc.Handler) json_rpc.Handler {
+	return func(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+		if ok, _ := ctx.Value(adminKey{}).(bool); !ok {
+			return nil, json_rpc.NewError(RPC_UNAUTHORIZED, "a valid API key is required", nil)
+		}
+		return h(ctx, params)
+	}
+}
+
+// Funzione per leggere i parametri, che devono essere un oggetto
+func decodeParams(params json.RawMessage, v interface{}) *json_rpc.Error {
+	if len(params) == 0 || params[0] != '{' {
+		return json_rpc.InvalidParams("params must be an object")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return json_rpc.InvalidParams("%v", err)
+	}
+	return nil
+}
+
+// Funzione che crea un errore JSON-RPC con il messaggio dell'errore
+// REST equivalente, che finisce nei dati con il suo codice e il campo
+func rpcError(code int, err error) *json_rpc.Error {
+	e := api_error.From(err)
+	return json_rpc.NewError(code, e.Message, e)
+}
+
+// Funzione che crea il risultato per un blocco
+func blockResult(height int, b *block.Block) *BlockResult {
+	return &BlockResult{Height: height, Hash: blockchain.BlockHash(b), Block: b}
+}
+
+func (bcs *BlockchainServer) rpcGetHeight(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	return bcs.blockchain.Height(), nil
+}
+
+func (bcs *BlockchainServer) rpcGetBlockByHeight(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	var p struct {
+		Height *int `json:"height"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Height == nil {
+		return nil, json_rpc.InvalidParams("missing height")
+	}
+	b := bcs.blockchain.BlockByHeight(*p.Height)
+	if b == nil {
+		return nil, json_rpc.NewError(RPC_NOT_FOUND, "block not found", map[string]int{"height": *p.Height})
+	}
+	return blockResult(*p.Height, b), nil
+}
+
+func (bcs *BlockchainServer) rpcGetBlockByHash(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	var p struct {
+		Hash string `json:"hash"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Hash == "" {
+		return nil, json_rpc.InvalidParams("missing hash")
+	}
+	height := bcs.blockchain.HeightOf(p.Hash)
+	if height < 0 {
+		return nil, json_rpc.NewError(RPC_NOT_FOUND, "block not found", map[string]string{"hash": p.Hash})
+	}
+	return blockResult(height, bcs.blockchain.BlockByHeight(height)), nil
+}
+
+// I parametri sono gli stessi del POST su "/transactions"
+func (bcs *BlockchainServer) rpcSendTransaction(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	var t blockchain_transaction_request.TransactionRequest
+	if err := decodeParams(params, &t); err != nil {
+		return nil, err
+	}
+	if err := t.Validate(); err != nil {
+		return nil, rpcError(json_rpc.INVALID_PARAMS, err)
+	}
+	if err := bcs.submitTransaction(&t); err != nil {
+		return nil, rpcError(RPC_TRANSACTION_REJECTED, err)
+	}
+	return map[string]string{"hash": node.TransactionHash(&t)}, nil
+}
+
+func (bcs *BlockchainServer) rpcGetBalance(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	var p struct {
+		BlockchainAddress string `json:"blockchain_address"`
+		Asset             string `json:"asset"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.BlockchainAddress == "" {
+		return nil, json_rpc.InvalidParams("missing blockchain_address")
+	}
+	if p.Asset != "" {
+		amount, err := bcs.blockchain.CalculateAssetAmount(p.BlockchainAddress, p.Asset)
+		if err != nil {
+			return nil, rpcError(RPC_NOT_FOUND, api_error.NotFound(err.Error()).WithField("asset"))
+		}
+		return &amount_response.AssetAmountResponse{Asset: p.Asset, Amount: amount}, nil
+	}
+	return map[string]float32{"amount": bcs.blockchain.CalculateTotalAmount(p.BlockchainAddress)}, nil
+}
+
+// Numero di transazioni di ogni indirizzo, usato dai wallet HD per
+// trovare gli indirizzi già usati
+func (bcs *BlockchainServer) rpcGetActivity(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	var p struct {
+		BlockchainAddresses []string `json:"blockchain_addresses"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(p.BlockchainAddresses) == 0:
+		return nil, json_rpc.InvalidParams("missing blockchain_addresses")
+	case len(p.BlockchainAddresses) > explorer.MAX_ACTIVITY_ADDRESSES:
+		return nil, json_rpc.InvalidParams("at most %d blockchain_addresses", explorer.MAX_ACTIVITY_ADDRESSES)
+	}
+	return map[string][]*explorer.AddressActivity{
+		"accounts": explorer.NewExplorer(bcs.blockchain).Activity(p.BlockchainAddresses),
+	}, nil
+}
+
+func (bcs *BlockchainServer) rpcListMempool(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	transactions := bcs.blockchain.TransactionPool()
+	return struct {
+		Transactions []*blockchain_transaction.Transaction `json:"transactions"`
+		Length       int                                   `json:"length"`
+	}{
+		Transactions: transactions,
+		Length:       len(transactions),
+	}, nil
+}
+
+func (bcs *BlockchainServer) rpcMine(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	if err := bcs.blockchain.Mining(); err != nil {
+		return nil, rpcError(RPC_MINING_FAILED, miningError(err))
+	}
+	height := bcs.blockchain.Height()
+	return blockResult(height, bcs.blockchain.BlockByHeight(height)), nil
+}
+
+func (bcs *BlockchainServer) rpcStartMining(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	started := bcs.blockchain.StartMining(bcs.ctx)
+	return map[string]bool{"mining": true, "started": started}, nil
+}
+
+func (bcs *BlockchainServer) rpcStopMining(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	bcs.blockchain.StopMining()
+	return map[string]bool{"mining": false}, nil
+}
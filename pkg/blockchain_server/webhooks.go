@@ -0,0 +1,118 @@
+package blockchain_server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+	"github.com/iltommi1995/blockchain-go/pkg/webhook/dispatcher"
+	"github.com/iltommi1995/blockchain-go/pkg/webhook/hook"
+)
+
+// Prefisso degli endpoint di un singolo webhook, "/admin/webhooks/<id>"
+const WEBHOOK_PATH = "/admin/webhooks/"
+
+// Resolver dell'endpoint "/admin/webhooks"
+// GET restituisce i webhook registrati, POST ne registra uno nuovo
+// e restituisce anche il segreto con cui vengono firmate le consegne
+func (bcs *BlockchainServer) Webhooks(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		hooks := bcs.webhooks.Hooks()
+		m, _ := json.Marshal(struct {
+			Webhooks []*hook.Hook `json:"webhooks"`
+			Length   int          `json:"length"`
+		}{
+			Webhooks: hooks,
+			Length:   len(hooks),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	case http.MethodPost:
+		var hr hook.HookRequest
+		if err := json.NewDecoder(req.Body).Decode(&hr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := hr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		h, err := bcs.webhooks.Add(&hr)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.Internal(fmt.Sprintf("saving webhook: %v", err)))
+			return
+		}
+		m, _ := json.Marshal(h)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet, http.MethodPost)
+	}
+}
+
+// Resolver dell'endpoint "/admin/webhooks/<id>"
+// GET restituisce il webhook, DELETE lo toglie insieme alle sue
+// consegne in coda
+func (bcs *BlockchainServer) Webhook(w http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, WEBHOOK_PATH)
+	switch req.Method {
+	case http.MethodGet:
+		h := bcs.webhooks.Hook(id)
+		if h == nil {
+			api_error.Write(w, api_error.NotFound(fmt.Sprintf("webhook %s not found", id)))
+			return
+		}
+		m, _ := json.Marshal(h)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	case http.MethodDelete:
+		err := bcs.webhooks.Remove(id)
+		if errors.Is(err, dispatcher.ErrNotFound) {
+			api_error.Write(w, api_error.NotFound(fmt.Sprintf("webhook %s not found", id)))
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.Internal(fmt.Sprintf("removing webhook: %v", err)))
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(utils.JsonStatus("success")))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// Resolver dell'endpoint "/admin/webhooks/deliveries"
+// GET restituisce le consegne in coda, solo quelle del webhook
+// passato nel query param "hook_id" se c'è
+func (bcs *BlockchainServer) WebhookDeliveries(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		deliveries := bcs.webhooks.Deliveries(req.URL.Query().Get("hook_id"))
+		m, _ := json.Marshal(struct {
+			Deliveries []*hook.Delivery `json:"deliveries"`
+			Length     int              `json:"length"`
+		}{
+			Deliveries: deliveries,
+			Length:     len(deliveries),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
+	}
+}
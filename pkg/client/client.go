@@ -0,0 +1,307 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+)
+
+const (
+	// Tempo massimo di una richiesta, se Options.Timeout è 0
+	DEFAULT_TIMEOUT_SEC = 10
+	// Giri di tentativi su tutti gli url dopo il primo, se
+	// Options.Retries è 0
+	DEFAULT_RETRIES = 2
+	// Attesa prima del secondo giro, raddoppia a ogni giro
+	DEFAULT_RETRY_DELAY_MS = 200
+)
+
+// Nessuno degli url ha risposto, l'errore contiene l'ultimo motivo
+var ErrUnavailable = errors.New("no server available")
+
+// Autenticazione delle richieste, viene chiamata prima di ogni
+// tentativo
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// Funzione usata come Authenticator
+type AuthenticatorFunc func(req *http.Request) error
+
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// Autenticazione con la API key degli endpoint di amministrazione
+func ApiKey(key string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set("X-Api-Key", key)
+		return nil
+	})
+}
+
+// Autenticazione con "Authorization: Bearer <token>"
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// Opzioni del client, i campi vuoti usano i valori di default
+type Options struct {
+	// Client HTTP da usare, per cambiare il trasporto
+	HTTPClient *http.Client
+	// Tempo massimo di ogni tentativo, non vale per gli stream
+	Timeout time.Duration
+	// Giri di tentativi dopo il primo, negativo per non ritentare
+	Retries    int
+	RetryDelay time.Duration
+	// Autenticazione, nil per le richieste anonime
+	Auth      Authenticator
+	UserAgent string
+}
+
+// Client HTTP che parla con uno o più server con le stesse API
+// Ogni richiesta va al server che ha risposto per ultimo, se non
+// risponde si passa al successivo; le richieste che si possono
+// ripetere vengono ritentate anche quando il server risponde che
+// non è disponibile
+type Client struct {
+	urls    []string
+	options Options
+	http    *http.Client
+	stream  *http.Client
+	// Indice dell'url che ha risposto per ultimo
+	current int
+	mux     sync.Mutex
+}
+
+// Funzione per creare un client per gli url, che devono essere
+// assoluti come "http://localhost:5000"
+func New(urls []string, options Options) *Client {
+	if options.Timeout == 0 {
+		options.Timeout = DEFAULT_TIMEOUT_SEC * time.Second
+	}
+	if options.Retries == 0 {
+		options.Retries = DEFAULT_RETRIES
+	}
+	if options.Retries < 0 {
+		options.Retries = 0
+	}
+	if options.RetryDelay == 0 {
+		options.RetryDelay = DEFAULT_RETRY_DELAY_MS * time.Millisecond
+	}
+	base := options.HTTPClient
+	if base == nil {
+		base = &http.Client{}
+	}
+	c := &Client{options: options}
+	for _, u := range urls {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			c.urls = append(c.urls, u)
+		}
+	}
+	// Le richieste normali hanno il timeout, gli stream durano
+	// finché il contesto non viene cancellato
+	c.http = &http.Client{Transport: base.Transport, Jar: base.Jar, CheckRedirect: base.CheckRedirect, Timeout: options.Timeout}
+	c.stream = &http.Client{Transport: base.Transport, Jar: base.Jar, CheckRedirect: base.CheckRedirect}
+	return c
+}
+
+// Getter degli url
+func (c *Client) URLs() []string {
+	return append([]string{}, c.urls...)
+}
+
+// Metodo che ritorna gli url nell'ordine in cui provarli, partendo
+// da quello che ha risposto per ultimo
+func (c *Client) order() []int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	order := make([]int, len(c.urls))
+	for i := range order {
+		order[i] = (c.current + i) % len(c.urls)
+	}
+	return order
+}
+
+func (c *Client) setCurrent(i int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.current = i
+}
+
+// Metodo che esegue una richiesta json: body viene inviato in json
+// se non è nil, la risposta viene decodificata in out se non è nil
+// Se lo stato non è tra quelli attesi ritorna l'*api_error.ApiError
+// del server
+func (c *Client) Do(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}, expected ...int) error {
+	var data []byte
+	if body != nil {
+		m, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		data = m
+	}
+	resp, err := c.send(c.http, ctx, method, path, query, nil, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if len(expected) == 0 {
+		expected = []int{http.StatusOK}
+	}
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			if out == nil {
+				io.Copy(io.Discard, resp.Body)
+				return nil
+			}
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return api_error.GatewayError(fmt.Sprintf("invalid response to %s %s: %v", method, path, err))
+			}
+			return nil
+		}
+	}
+	return api_error.Read(resp)
+}
+
+// Metodo che apre uno stream con GET, senza timeout: la risposta
+// resta aperta finché ctx non viene cancellato o il server la chiude
+// Se lo stato non è 200 ritorna l'*api_error.ApiError del server
+func (c *Client) Open(ctx context.Context, path string, query url.Values, header http.Header) (*http.Response, error) {
+	resp, err := c.send(c.stream, ctx, http.MethodGet, path, query, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, api_error.Read(resp)
+	}
+	return resp, nil
+}
+
+// Metodo che invia la richiesta provando tutti gli url, per più
+// giri se la richiesta si può ripetere
+func (c *Client) send(hc *http.Client, ctx context.Context, method string, path string, query url.Values, header http.Header, data []byte) (*http.Response, error) {
+	if len(c.urls) == 0 {
+		return nil, fmt.Errorf("%w: no url configured", ErrUnavailable)
+	}
+	idempotent := method == http.MethodGet || method == http.MethodHead || method == http.MethodDelete
+	var lastErr error
+	// Ultima risposta di un server non disponibile, se nessuno
+	// risponde viene restituita al chiamante con il suo errore
+	var lastResp *http.Response
+	defer func() {
+		if lastResp != nil {
+			lastResp.Body.Close()
+		}
+	}()
+	for round := 0; round <= c.options.Retries; round++ {
+		if round > 0 {
+			delay := c.options.RetryDelay << (round - 1)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		for _, i := range c.order() {
+			resp, err := c.attempt(hc, ctx, c.urls[i], method, path, query, header, data)
+			if ctx.Err() != nil {
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return nil, ctx.Err()
+			}
+			if err != nil {
+				lastErr = err
+				if lastResp != nil {
+					lastResp.Body.Close()
+					lastResp = nil
+				}
+				// Una richiesta che potrebbe essere arrivata al
+				// server non si ripete se non è idempotente
+				if !idempotent && !notSent(err) {
+					return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+				}
+				continue
+			}
+			if idempotent && unavailable(resp.StatusCode) {
+				if lastResp != nil {
+					lastResp.Body.Close()
+				}
+				lastResp, lastErr = resp, nil
+				continue
+			}
+			c.setCurrent(i)
+			return resp, nil
+		}
+	}
+	if lastResp != nil {
+		resp := lastResp
+		lastResp = nil
+		return resp, nil
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnavailable, lastErr)
+}
+
+// Metodo che fa un singolo tentativo su un url
+func (c *Client) attempt(hc *http.Client, ctx context.Context, base string, method string, path string, query url.Values, header http.Header, data []byte) (*http.Response, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(query) > 0 {
+		req.URL.RawQuery = query.Encode()
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	if c.options.UserAgent != "" {
+		req.Header.Set("User-Agent", c.options.UserAgent)
+	}
+	if c.options.Auth != nil {
+		if err := c.options.Auth.Authenticate(req); err != nil {
+			return nil, err
+		}
+	}
+	return hc.Do(req)
+}
+
+// Funzione che dice se l'errore è avvenuto prima che la richiesta
+// partisse, quindi si può ripetere su un altro url
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// Funzione che dice se lo stato indica un server che non può
+// rispondere in questo momento
+func unavailable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
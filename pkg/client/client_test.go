@@ -0,0 +1,314 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+)
+
+const WAIT = 5 * time.Second
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Server di test che risponde con gli stati della lista, uno per
+// richiesta, poi sempre con l'ultimo, e conta le richieste ricevute
+type server struct {
+	*httptest.Server
+	mux      sync.Mutex
+	statuses []int
+	body     string
+	requests int
+	last     *http.Request
+}
+
+func newServer(t *testing.T, body string, statuses ...int) *server {
+	t.Helper()
+	s := &server{statuses: statuses, body: body}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.mux.Lock()
+		status := s.statuses[0]
+		if len(s.statuses) > 1 {
+			s.statuses = s.statuses[1:]
+		}
+		s.requests++
+		s.last = req
+		s.mux.Unlock()
+		io.Copy(io.Discard, req.Body)
+		if status >= 300 && s.body == "" {
+			api_error.Write(w, api_error.New(status, "test_error", fmt.Sprintf("status %d", status)))
+			return
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, s.body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Getter dell'ultima richiesta ricevuta
+func (s *server) Last() *http.Request {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.last
+}
+
+// Getter del numero di richieste ricevute
+func (s *server) Requests() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.requests
+}
+
+// Funzione che ritorna l'url di un server chiuso, a cui non ci si
+// riesce a connettere
+func closedURL() string {
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+	return s.URL
+}
+
+// Gli stati non attesi ritornano l'errore del server, le risposte
+// che non si decodificano un errore del gateway
+func TestErrors(t *testing.T) {
+	tests := map[string]struct {
+		body     string
+		status   int
+		expected []int
+		code     string
+	}{
+		"api error":        {"", http.StatusNotFound, nil, "test_error"},
+		"not expected":     {"{}", http.StatusOK, []int{http.StatusCreated}, api_error.CODE_GATEWAY_ERROR},
+		"not an api error": {"<html>", http.StatusInternalServerError, nil, api_error.CODE_GATEWAY_ERROR},
+		"invalid json":     {"{", http.StatusOK, nil, api_error.CODE_GATEWAY_ERROR},
+		"other status":     {`{"value": 1}`, http.StatusCreated, []int{http.StatusOK, http.StatusCreated}, ""},
+	}
+	for name, test := range tests {
+		s := newServer(t, test.body, test.status)
+		c := New([]string{s.URL}, Options{Retries: -1})
+		var out struct {
+			Value int `json:"value"`
+		}
+		err := c.Do(context.Background(), http.MethodGet, "/test", nil, nil, &out, test.expected...)
+		if test.code == "" {
+			if err != nil || out.Value != 1 {
+				t.Errorf("%s: %v, decoded %+v", name, err, out)
+			}
+			continue
+		}
+		var e *api_error.ApiError
+		if !errors.As(err, &e) || e.Code != test.code {
+			t.Errorf("%s: %v, expected code %s", name, err, test.code)
+		}
+	}
+
+	s := newServer(t, "", http.StatusConflict)
+	err := New([]string{s.URL}, Options{}).Do(context.Background(), http.MethodPost, "/test", nil, map[string]int{"value": 1}, nil)
+	var e *api_error.ApiError
+	if !errors.As(err, &e) || e.Status != http.StatusConflict || e.Message != "status 409" {
+		t.Fatalf("%v, expected the error of the server", err)
+	}
+}
+
+// Le richieste che si possono ripetere vengono ritentate quando il
+// server non è disponibile, le altre no
+func TestRetry(t *testing.T) {
+	options := Options{RetryDelay: time.Millisecond}
+	s := newServer(t, "{}", http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	c := New([]string{s.URL}, options)
+	check(t, c.Do(context.Background(), http.MethodGet, "/test", nil, nil, nil))
+	if s.Requests() != 3 {
+		t.Fatalf("%d requests, expected 3", s.Requests())
+	}
+
+	// Finiti i giri ritorna l'ultima risposta del server
+	s = newServer(t, "", http.StatusServiceUnavailable)
+	err := New([]string{s.URL}, options).Do(context.Background(), http.MethodGet, "/test", nil, nil, nil)
+	var e *api_error.ApiError
+	if !errors.As(err, &e) || e.Status != http.StatusServiceUnavailable {
+		t.Fatalf("%v, expected the error of the server", err)
+	}
+	if s.Requests() != DEFAULT_RETRIES+1 {
+		t.Fatalf("%d requests, expected %d", s.Requests(), DEFAULT_RETRIES+1)
+	}
+
+	s = newServer(t, "", http.StatusServiceUnavailable)
+	err = New([]string{s.URL}, options).Do(context.Background(), http.MethodPost, "/test", nil, struct{}{}, nil)
+	if !errors.As(err, &e) || e.Status != http.StatusServiceUnavailable || s.Requests() != 1 {
+		t.Fatalf("post: %v after %d requests, expected one request", err, s.Requests())
+	}
+
+	s = newServer(t, "", http.StatusServiceUnavailable)
+	New([]string{s.URL}, Options{Retries: -1}).Do(context.Background(), http.MethodGet, "/test", nil, nil, nil)
+	if s.Requests() != 1 {
+		t.Fatalf("%d requests without retries", s.Requests())
+	}
+
+	s = newServer(t, "", http.StatusBadRequest)
+	New([]string{s.URL}, options).Do(context.Background(), http.MethodGet, "/test", nil, nil, nil)
+	if s.Requests() != 1 {
+		t.Fatalf("%d requests for a client error", s.Requests())
+	}
+}
+
+// Se un server non risponde si passa al successivo, che viene usato
+// anche per le richieste dopo
+func TestFailover(t *testing.T) {
+	options := Options{RetryDelay: time.Millisecond}
+	first := newServer(t, "", http.StatusServiceUnavailable)
+	second := newServer(t, "{}", http.StatusOK)
+	c := New([]string{closedURL(), first.URL + "/", " ", second.URL}, options)
+	if len(c.URLs()) != 3 {
+		t.Fatalf("urls %v", c.URLs())
+	}
+	check(t, c.Do(context.Background(), http.MethodGet, "/test", nil, nil, nil))
+	check(t, c.Do(context.Background(), http.MethodGet, "/test", nil, nil, nil))
+	if first.Requests() != 1 || second.Requests() != 2 {
+		t.Fatalf("%d and %d requests, expected 1 and 2", first.Requests(), second.Requests())
+	}
+
+	// Una POST che non è partita si può mandare al server successivo
+	c = New([]string{closedURL(), second.URL}, options)
+	check(t, c.Do(context.Background(), http.MethodPost, "/test", nil, struct{}{}, nil))
+	if second.Requests() != 3 {
+		t.Fatal("the post was not sent to the second server")
+	}
+
+	err := New([]string{closedURL(), closedURL()}, options).Do(context.Background(), http.MethodGet, "/test", nil, nil, nil)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("%v, expected %v", err, ErrUnavailable)
+	}
+	if err := New(nil, options).Do(context.Background(), http.MethodGet, "/test", nil, nil, nil); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("no url: %v, expected %v", err, ErrUnavailable)
+	}
+}
+
+// La cancellazione del contesto interrompe la richiesta in corso e
+// l'attesa tra i giri, senza provare gli altri server
+func TestContextCancellation(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	blocking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-release:
+		}
+	}))
+	defer blocking.Close()
+	other := newServer(t, "{}", http.StatusOK)
+	unavailable := newServer(t, "", http.StatusServiceUnavailable)
+
+	tests := map[string]struct {
+		urls    []string
+		options Options
+	}{
+		"request":     {[]string{blocking.URL, other.URL}, Options{}},
+		"retry delay": {[]string{unavailable.URL}, Options{RetryDelay: time.Hour}},
+	}
+	for name, test := range tests {
+		requests := other.Requests()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- New(test.urls, test.options).Do(ctx, http.MethodGet, "/test", nil, nil, nil)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: %v, expected %v", name, err, context.Canceled)
+			}
+		case <-time.After(WAIT):
+			t.Fatalf("%s: the request was not interrupted", name)
+		}
+		if other.Requests() != requests {
+			t.Errorf("%s: tried another server after the cancellation", name)
+		}
+	}
+
+	err := New([]string{blocking.URL}, Options{Timeout: 50 * time.Millisecond, Retries: -1}).Do(context.Background(), http.MethodGet, "/test", nil, nil, nil)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("timeout: %v, expected %v", err, ErrUnavailable)
+	}
+}
+
+// Ogni richiesta ha l'autenticazione, lo user agent, la query e il
+// content type del body
+func TestHeaders(t *testing.T) {
+	s := newServer(t, "{}", http.StatusOK)
+	tests := map[string]struct {
+		auth   Authenticator
+		header string
+		value  string
+	}{
+		"api key": {ApiKey("secret"), "X-Api-Key", "secret"},
+		"bearer":  {BearerToken("token"), "Authorization", "Bearer token"},
+	}
+	for name, test := range tests {
+		c := New([]string{s.URL}, Options{Auth: test.auth, UserAgent: "client-test"})
+		check(t, c.Do(context.Background(), http.MethodPost, "/test", url.Values{"a": {"1"}}, struct{}{}, nil))
+		req := s.Last()
+		if req.Header.Get(test.header) != test.value {
+			t.Errorf("%s: %s is %q, expected %q", name, test.header, req.Header.Get(test.header), test.value)
+		}
+		if req.Header.Get("User-Agent") != "client-test" || req.Header.Get("Content-Type") != "application/json" || req.URL.Query().Get("a") != "1" {
+			t.Errorf("%s: request %s with headers %v", name, req.URL, req.Header)
+		}
+	}
+
+	failing := AuthenticatorFunc(func(req *http.Request) error { return errors.New("no credentials") })
+	requests := s.Requests()
+	if err := New([]string{s.URL}, Options{Auth: failing, Retries: -1}).Do(context.Background(), http.MethodGet, "/test", nil, nil, nil); err == nil {
+		t.Fatal("sent without credentials")
+	}
+	if s.Requests() != requests {
+		t.Fatal("the request reached the server")
+	}
+}
+
+// Lo stream degli eventi salta i commenti, unisce le righe data e
+// ricorda l'altezza dell'ultimo evento
+func TestEvents(t *testing.T) {
+	s := newServer(t, ": connected\n\nid: 4\ndata: {\"type\": \"block\",\ndata: \"height\": 4}\n\n: ping\n\nid: 5\ndata: {\"type\": \"block\", \"height\": 5}\n\n", http.StatusOK)
+	nc := NewNodeClient([]string{s.URL}, Options{})
+	es, err := nc.Events(context.Background(), EventsOptions{Types: []string{"block"}, Resume: true, FromHeight: 3})
+	check(t, err)
+	defer es.Close()
+	if es.LastHeight() != -1 {
+		t.Fatalf("last height %d before the first event", es.LastHeight())
+	}
+	for _, height := range []int{4, 5} {
+		e, err := es.Next()
+		check(t, err)
+		if e.Type != "block" || e.Height != height || es.LastHeight() != height {
+			t.Fatalf("event %+v, last height %d, expected %d", e, es.LastHeight(), height)
+		}
+	}
+	if _, err := es.Next(); err != io.EOF {
+		t.Fatalf("end of the stream: %v, expected %v", err, io.EOF)
+	}
+	if req := s.Last(); req.URL.Query().Get("types") != "block" || req.URL.Query().Get("from_height") != "3" || req.Header.Get("Accept") != "text/event-stream" {
+		t.Fatalf("request %s with headers %v", req.URL, req.Header)
+	}
+
+	s = newServer(t, "", http.StatusForbidden)
+	var e *api_error.ApiError
+	if _, err := NewNodeClient([]string{s.URL}, Options{}).Events(context.Background(), EventsOptions{}); !errors.As(err, &e) || e.Status != http.StatusForbidden {
+		t.Fatalf("%v, expected the error of the server", err)
+	}
+}
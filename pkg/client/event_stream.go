@@ -0,0 +1,80 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/events"
+)
+
+// Stream di Server-Sent Events aperto con Client.Open
+type EventStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	lastID string
+}
+
+func newEventStream(resp *http.Response) *EventStream {
+	return &EventStream{body: resp.Body, reader: bufio.NewReader(resp.Body)}
+}
+
+// Metodo che aspetta il prossimo evento, ritorna io.EOF quando il
+// server chiude lo stream
+func (es *EventStream) Next() (*events.Event, error) {
+	var data strings.Builder
+	for {
+		line, err := es.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" {
+				return nil, io.EOF
+			}
+			if err != io.EOF {
+				return nil, err
+			}
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			// Una riga vuota chiude l'evento, i commenti non ne hanno
+			if data.Len() == 0 {
+				if err == io.EOF {
+					return nil, io.EOF
+				}
+				continue
+			}
+			var e events.Event
+			if err := json.Unmarshal([]byte(data.String()), &e); err != nil {
+				return nil, fmt.Errorf("invalid event: %v", err)
+			}
+			return &e, nil
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		case strings.HasPrefix(line, "id:"):
+			es.lastID = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		}
+	}
+}
+
+// Metodo che ritorna l'altezza dell'ultimo blocco ricevuto, da cui
+// riprendere con un nuovo stream, -1 se non ne è arrivato nessuno
+func (es *EventStream) LastHeight() int {
+	h, err := strconv.Atoi(es.lastID)
+	if err != nil {
+		return -1
+	}
+	return h
+}
+
+// Metodo per chiudere lo stream
+func (es *EventStream) Close() error {
+	return es.body.Close()
+}
@@ -0,0 +1,339 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/amount_response"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract_request"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	blockchain_transaction_request "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/explorer"
+	"github.com/iltommi1995/blockchain-go/pkg/json_rpc"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/peer"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/peers_response"
+	"github.com/iltommi1995/blockchain-go/pkg/webhook/hook"
+)
+
+// Client delle API di un blockchain server, con più url passa a
+// un altro nodo quando quello in uso non risponde
+// Gli errori dei nodi sono *api_error.ApiError, quelli dei metodi
+// JSON-RPC *json_rpc.Error
+type NodeClient struct {
+	*Client
+}
+
+// Funzione per creare un client dei nodi agli url
+func NewNodeClient(urls []string, options Options) *NodeClient {
+	return &NodeClient{New(urls, options)}
+}
+
+// Opzioni dello stream degli eventi, i campi vuoti non filtrano
+type EventsOptions struct {
+	Types     []string
+	Addresses []string
+	// Con Resume prima arrivano gli eventi dei blocchi già nella
+	// catena da FromHeight, senza solo quelli nuovi
+	Resume     bool
+	FromHeight int
+}
+
+// GET "/chain"
+func (nc *NodeClient) Chain(ctx context.Context) ([]*block.Block, error) {
+	var v struct {
+		Chain []*block.Block `json:"chain"`
+	}
+	if err := nc.Do(ctx, http.MethodGet, "/chain", nil, nil, &v); err != nil {
+		return nil, err
+	}
+	return v.Chain, nil
+}
+
+// GET "/transactions"
+func (nc *NodeClient) Transactions(ctx context.Context) ([]*blockchain_transaction.Transaction, error) {
+	var v struct {
+		Transactions []*blockchain_transaction.Transaction `json:"transactions"`
+	}
+	if err := nc.Do(ctx, http.MethodGet, "/transactions", nil, nil, &v); err != nil {
+		return nil, err
+	}
+	return v.Transactions, nil
+}
+
+// POST "/transactions", la transazione deve essere già firmata
+// Non viene ritentata su un altro nodo se la richiesta potrebbe
+// essere già arrivata
+func (nc *NodeClient) SendTransaction(ctx context.Context, t *blockchain_transaction_request.TransactionRequest) error {
+	return nc.Do(ctx, http.MethodPost, "/transactions", nil, t, nil, http.StatusCreated)
+}
+
+// GET "/amount"
+func (nc *NodeClient) Amount(ctx context.Context, blockchainAddress string) (float32, error) {
+	var ar amount_response.AmountResponse
+	query := url.Values{"blockchain_address": {blockchainAddress}}
+	if err := nc.Do(ctx, http.MethodGet, "/amount", query, nil, &ar); err != nil {
+		return 0, err
+	}
+	return ar.Amount, nil
+}
+
+// GET "/amount" con il simbolo di un token
+func (nc *NodeClient) AssetAmount(ctx context.Context, blockchainAddress string, symbol string) (uint64, error) {
+	var ar amount_response.AssetAmountResponse
+	query := url.Values{"blockchain_address": {blockchainAddress}, "asset": {symbol}}
+	if err := nc.Do(ctx, http.MethodGet, "/amount", query, nil, &ar); err != nil {
+		return 0, err
+	}
+	return ar.Amount, nil
+}
+
+// GET "/assets"
+func (nc *NodeClient) Assets(ctx context.Context) ([]*asset.Info, error) {
+	var v struct {
+		Assets []*asset.Info `json:"assets"`
+	}
+	if err := nc.Do(ctx, http.MethodGet, "/assets", nil, nil, &v); err != nil {
+		return nil, err
+	}
+	return v.Assets, nil
+}
+
+// POST "/htlc/status"
+func (nc *NodeClient) HtlcStatus(ctx context.Context, c *htlc.Contract) (*blockchain.HtlcStatus, error) {
+	var hs blockchain.HtlcStatus
+	if err := nc.Do(ctx, http.MethodPost, "/htlc/status", nil, c, &hs); err != nil {
+		return nil, err
+	}
+	return &hs, nil
+}
+
+// POST "/htlc/claim", ritorna la transazione aggiunta al pool
+func (nc *NodeClient) ClaimHtlc(ctx context.Context, c *htlc.Contract, preimage string) (*blockchain_transaction_request.TransactionRequest, error) {
+	return nc.spendHtlc(ctx, "/htlc/claim", &htlc.Spend{Contract: *c, Preimage: preimage})
+}
+
+// POST "/htlc/refund", ritorna la transazione aggiunta al pool
+func (nc *NodeClient) RefundHtlc(ctx context.Context, c *htlc.Contract) (*blockchain_transaction_request.TransactionRequest, error) {
+	return nc.spendHtlc(ctx, "/htlc/refund", &htlc.Spend{Contract: *c})
+}
+
+func (nc *NodeClient) spendHtlc(ctx context.Context, path string, s *htlc.Spend) (*blockchain_transaction_request.TransactionRequest, error) {
+	var tr blockchain_transaction_request.TransactionRequest
+	if err := nc.Do(ctx, http.MethodPost, path, nil, s, &tr, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &tr, nil
+}
+
+// GET "/contract"
+func (nc *NodeClient) Contract(ctx context.Context, blockchainAddress string) (*blockchain.ContractInfo, error) {
+	var ci blockchain.ContractInfo
+	query := url.Values{"blockchain_address": {blockchainAddress}}
+	if err := nc.Do(ctx, http.MethodGet, "/contract", query, nil, &ci); err != nil {
+		return nil, err
+	}
+	return &ci, nil
+}
+
+// POST "/contract/call", la chiamata non cambia lo stato
+func (nc *NodeClient) CallContract(ctx context.Context, cr *contract_request.CallRequest) (*blockchain.CallResult, error) {
+	var r blockchain.CallResult
+	if err := nc.Do(ctx, http.MethodPost, "/contract/call", nil, cr, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Metodo JSON-RPC "account_getActivity", al massimo
+// explorer.MAX_ACTIVITY_ADDRESSES indirizzi per chiamata
+func (nc *NodeClient) Activity(ctx context.Context, addresses []string) ([]*explorer.AddressActivity, error) {
+	var v struct {
+		Accounts []*explorer.AddressActivity `json:"accounts"`
+	}
+	params := map[string][]string{"blockchain_addresses": addresses}
+	if err := nc.Call(ctx, "account_getActivity", params, &v); err != nil {
+		return nil, err
+	}
+	return v.Accounts, nil
+}
+
+// Metodo che dice quali indirizzi compaiono in almeno una
+// transazione, anche solo nel transaction pool
+// Ha la firma di hd_wallet.UsedFunc, per la scansione dei wallet HD
+func (nc *NodeClient) Used(ctx context.Context, addresses []string) ([]bool, error) {
+	used := make([]bool, 0, len(addresses))
+	for start := 0; start < len(addresses); start += explorer.MAX_ACTIVITY_ADDRESSES {
+		end := start + explorer.MAX_ACTIVITY_ADDRESSES
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+		activity, err := nc.Activity(ctx, addresses[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range activity {
+			used = append(used, a.Used())
+		}
+	}
+	return used, nil
+}
+
+// GET "/network"
+func (nc *NodeClient) Network(ctx context.Context) (*blockchain.NetworkInfo, error) {
+	var ni blockchain.NetworkInfo
+	if err := nc.Do(ctx, http.MethodGet, "/network", nil, nil, &ni); err != nil {
+		return nil, err
+	}
+	return &ni, nil
+}
+
+// GET "/peers"
+func (nc *NodeClient) Peers(ctx context.Context) (*peers_response.PeersResponse, error) {
+	var pr peers_response.PeersResponse
+	if err := nc.Do(ctx, http.MethodGet, "/peers", nil, nil, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// GET "/openapi.json"
+func (nc *NodeClient) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var doc json.RawMessage
+	if err := nc.Do(ctx, http.MethodGet, "/openapi.json", nil, nil, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// GET "/mine", richiede la API key
+func (nc *NodeClient) Mine(ctx context.Context) error {
+	return nc.Do(ctx, http.MethodGet, "/mine", nil, nil, nil)
+}
+
+// GET "/mine/start", richiede la API key
+func (nc *NodeClient) StartMining(ctx context.Context) error {
+	return nc.Do(ctx, http.MethodGet, "/mine/start", nil, nil, nil)
+}
+
+// GET "/admin/bans"
+func (nc *NodeClient) Bans(ctx context.Context) ([]*peer.Reputation, error) {
+	var v struct {
+		Bans []*peer.Reputation `json:"bans"`
+	}
+	if err := nc.Do(ctx, http.MethodGet, "/admin/bans", nil, nil, &v); err != nil {
+		return nil, err
+	}
+	return v.Bans, nil
+}
+
+// DELETE "/admin/bans", toglie il ban a tutti se address è vuoto
+func (nc *NodeClient) Unban(ctx context.Context, address string) error {
+	var query url.Values
+	if address != "" {
+		query = url.Values{"address": {address}}
+	}
+	return nc.Do(ctx, http.MethodDelete, "/admin/bans", query, nil, nil)
+}
+
+// GET "/admin/webhooks"
+func (nc *NodeClient) Webhooks(ctx context.Context) ([]*hook.Hook, error) {
+	var v struct {
+		Webhooks []*hook.Hook `json:"webhooks"`
+	}
+	if err := nc.Do(ctx, http.MethodGet, "/admin/webhooks", nil, nil, &v); err != nil {
+		return nil, err
+	}
+	return v.Webhooks, nil
+}
+
+// POST "/admin/webhooks", il webhook restituito contiene il segreto
+func (nc *NodeClient) CreateWebhook(ctx context.Context, hr *hook.HookRequest) (*hook.Hook, error) {
+	var h hook.Hook
+	if err := nc.Do(ctx, http.MethodPost, "/admin/webhooks", nil, hr, &h, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// GET "/admin/webhooks/<id>"
+func (nc *NodeClient) Webhook(ctx context.Context, id string) (*hook.Hook, error) {
+	var h hook.Hook
+	if err := nc.Do(ctx, http.MethodGet, "/admin/webhooks/"+url.PathEscape(id), nil, nil, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// DELETE "/admin/webhooks/<id>"
+func (nc *NodeClient) DeleteWebhook(ctx context.Context, id string) error {
+	return nc.Do(ctx, http.MethodDelete, "/admin/webhooks/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// GET "/admin/webhooks/deliveries", di tutti i webhook se hookID
+// è vuoto
+func (nc *NodeClient) WebhookDeliveries(ctx context.Context, hookID string) ([]*hook.Delivery, error) {
+	var query url.Values
+	if hookID != "" {
+		query = url.Values{"hook_id": {hookID}}
+	}
+	var v struct {
+		Deliveries []*hook.Delivery `json:"deliveries"`
+	}
+	if err := nc.Do(ctx, http.MethodGet, "/admin/webhooks/deliveries", query, nil, &v); err != nil {
+		return nil, err
+	}
+	return v.Deliveries, nil
+}
+
+// GET "/events", lo stream resta aperto finché ctx non viene
+// cancellato o non viene chiuso
+func (nc *NodeClient) Events(ctx context.Context, options EventsOptions) (*EventStream, error) {
+	query := url.Values{}
+	if len(options.Types) > 0 {
+		query.Set("types", strings.Join(options.Types, ","))
+	}
+	for _, a := range options.Addresses {
+		query.Add("address", a)
+	}
+	if options.Resume {
+		query.Set("from_height", strconv.Itoa(options.FromHeight))
+	}
+	resp, err := nc.Open(ctx, "/events", query, http.Header{"Accept": {"text/event-stream"}})
+	if err != nil {
+		return nil, err
+	}
+	return newEventStream(resp), nil
+}
+
+// POST "/rpc": chiama un metodo JSON-RPC e decodifica il risultato
+// in result, se non è nil
+func (nc *NodeClient) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	var raw json.RawMessage
+	if params != nil {
+		m, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		raw = m
+	}
+	request := &json_rpc.Request{JsonRpc: json_rpc.VERSION, Method: method, Params: raw, ID: json.RawMessage("1")}
+	var response json_rpc.Response
+	if err := nc.Do(ctx, http.MethodPost, "/rpc", nil, request, &response); err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil || response.Result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result.(json.RawMessage), result)
+}
@@ -0,0 +1,278 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	blockchain_transaction_request "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/partial_transaction"
+	wallet_transaction_request "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/unsigned_transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet_request"
+)
+
+// Client delle API di un wallet server
+type WalletClient struct {
+	*Client
+}
+
+// Funzione per creare un client dei wallet server agli url
+func NewWalletClient(urls []string, options Options) *WalletClient {
+	return &WalletClient{New(urls, options)}
+}
+
+// Dati pubblici di un wallet del keystore del wallet server
+type WalletInfo struct {
+	PublicKey         string `json:"public_key"`
+	BlockchainAddress string `json:"blockchain_address"`
+	SeedID            string `json:"seed_id,omitempty"`
+	Path              string `json:"path,omitempty"`
+	Created           int64  `json:"created,omitempty"`
+}
+
+// Wallet HD del keystore del wallet server, Mnemonic c'è solo
+// quando viene creato
+type SeedInfo struct {
+	SeedID   string              `json:"seed_id"`
+	Mnemonic string              `json:"mnemonic,omitempty"`
+	Accounts []*keystore.Account `json:"accounts"`
+	Wallets  []*WalletInfo       `json:"wallets"`
+	Created  int64               `json:"created"`
+}
+
+// Contratto HTLC in cui il wallet server ha bloccato i fondi,
+// Preimage c'è solo se lo ha generato il server
+type HtlcInfo struct {
+	BlockchainAddress string         `json:"blockchain_address"`
+	Contract          *htlc.Contract `json:"contract"`
+	Preimage          string         `json:"preimage,omitempty"`
+}
+
+// GET "/wallet"
+func (wc *WalletClient) Wallets(ctx context.Context) ([]*WalletInfo, error) {
+	var v struct {
+		Wallets []*WalletInfo `json:"wallets"`
+	}
+	if err := wc.Do(ctx, http.MethodGet, "/wallet", nil, nil, &v); err != nil {
+		return nil, err
+	}
+	return v.Wallets, nil
+}
+
+// POST "/wallet", il wallet viene salvato nel keystore del server
+// cifrato con la password
+func (wc *WalletClient) CreateWallet(ctx context.Context, password string) (*WalletInfo, error) {
+	var info WalletInfo
+	request := &wallet_request.WalletRequest{Password: &password}
+	if err := wc.Do(ctx, http.MethodPost, "/wallet", nil, request, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// POST "/wallet/password"
+func (wc *WalletClient) ChangePassword(ctx context.Context, blockchainAddress string, password string, newPassword string) error {
+	request := &wallet_request.PasswordRequest{BlockchainAddress: &blockchainAddress, Password: &password, NewPassword: &newPassword}
+	return wc.Do(ctx, http.MethodPost, "/wallet/password", nil, request, nil)
+}
+
+// GET "/wallet/hd"
+func (wc *WalletClient) HDWallets(ctx context.Context) ([]*SeedInfo, error) {
+	var v struct {
+		Seeds []*SeedInfo `json:"seeds"`
+	}
+	if err := wc.Do(ctx, http.MethodGet, "/wallet/hd", nil, nil, &v); err != nil {
+		return nil, err
+	}
+	return v.Seeds, nil
+}
+
+// POST "/wallet/hd", crea un wallet HD con una frase nuova o, se la
+// richiesta ha la frase, lo recupera con gli indirizzi usati
+func (wc *WalletClient) CreateHDWallet(ctx context.Context, hr *wallet_request.HDWalletRequest) (*SeedInfo, error) {
+	var info SeedInfo
+	if err := wc.Do(ctx, http.MethodPost, "/wallet/hd", nil, hr, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// POST "/wallet/hd/address"
+func (wc *WalletClient) DeriveAddress(ctx context.Context, seedID string, password string, account uint32) (*WalletInfo, error) {
+	var info WalletInfo
+	request := &wallet_request.HDAddressRequest{SeedID: &seedID, Password: &password, Account: account}
+	if err := wc.Do(ctx, http.MethodPost, "/wallet/hd/address", nil, request, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// POST "/wallet/hd/scan", con gapLimit 0 usa quello di default
+func (wc *WalletClient) ScanHDWallet(ctx context.Context, seedID string, password string, gapLimit int) (*SeedInfo, error) {
+	var info SeedInfo
+	request := &wallet_request.HDScanRequest{SeedID: &seedID, Password: &password, GapLimit: gapLimit}
+	if err := wc.Do(ctx, http.MethodPost, "/wallet/hd/scan", nil, request, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GET "/wallet/multisig"
+func (wc *WalletClient) MultisigWallets(ctx context.Context) ([]*keystore.MultisigFile, error) {
+	var v struct {
+		Wallets []*keystore.MultisigFile `json:"wallets"`
+	}
+	if err := wc.Do(ctx, http.MethodGet, "/wallet/multisig", nil, nil, &v); err != nil {
+		return nil, err
+	}
+	return v.Wallets, nil
+}
+
+// POST "/wallet/multisig", crea un account multisig dalla soglia e
+// dalle chiavi pubbliche dei firmatari
+func (wc *WalletClient) CreateMultisigWallet(ctx context.Context, mr *wallet_request.MultisigRequest) (*keystore.MultisigFile, error) {
+	var mf keystore.MultisigFile
+	if err := wc.Do(ctx, http.MethodPost, "/wallet/multisig", nil, mr, &mf); err != nil {
+		return nil, err
+	}
+	return &mf, nil
+}
+
+// GET "/wallet/amount"
+func (wc *WalletClient) Amount(ctx context.Context, blockchainAddress string) (float32, error) {
+	var v struct {
+		Amount float32 `json:"amount"`
+	}
+	query := url.Values{"blockchain_address": {blockchainAddress}}
+	if err := wc.Do(ctx, http.MethodGet, "/wallet/amount", query, nil, &v); err != nil {
+		return 0, err
+	}
+	return v.Amount, nil
+}
+
+// POST "/transaction", il wallet server firma la transazione con la
+// chiave del keystore, decifrata con la password, e la invia al nodo
+func (wc *WalletClient) SendTransaction(ctx context.Context, t *wallet_transaction_request.TransactionRequest) error {
+	return wc.Do(ctx, http.MethodPost, "/transaction", nil, t, nil)
+}
+
+// POST "/transaction/unsigned", la transazione da firmare fuori dal
+// wallet server, per esempio con UnsignedTransaction.Sign
+func (wc *WalletClient) UnsignedTransaction(ctx context.Context, ur *wallet_transaction_request.UnsignedTransactionRequest) (*unsigned_transaction.UnsignedTransaction, error) {
+	var ut unsigned_transaction.UnsignedTransaction
+	if err := wc.Do(ctx, http.MethodPost, "/transaction/unsigned", nil, ur, &ut); err != nil {
+		return nil, err
+	}
+	return &ut, nil
+}
+
+// POST "/transaction/relay", inoltra al nodo la transazione firmata
+func (wc *WalletClient) RelayTransaction(ctx context.Context, tr *blockchain_transaction_request.TransactionRequest) error {
+	return wc.Do(ctx, http.MethodPost, "/transaction/relay", nil, tr, nil)
+}
+
+// POST "/transaction/partial", la transazione parzialmente firmata,
+// senza firme, da passare ai firmatari
+func (wc *WalletClient) PartialTransaction(ctx context.Context, ur *wallet_transaction_request.UnsignedTransactionRequest) (*partial_transaction.PartialTransaction, error) {
+	var pt partial_transaction.PartialTransaction
+	if err := wc.Do(ctx, http.MethodPost, "/transaction/partial", nil, ur, &pt); err != nil {
+		return nil, err
+	}
+	return &pt, nil
+}
+
+// POST "/transaction/partial/sign", aggiunge una firma
+func (wc *WalletClient) SignPartialTransaction(ctx context.Context, sr *wallet_transaction_request.PartialSignRequest) (*partial_transaction.PartialTransaction, error) {
+	var pt partial_transaction.PartialTransaction
+	if err := wc.Do(ctx, http.MethodPost, "/transaction/partial/sign", nil, sr, &pt); err != nil {
+		return nil, err
+	}
+	return &pt, nil
+}
+
+// POST "/transaction/partial/combine", unisce le firme delle copie
+func (wc *WalletClient) CombinePartialTransactions(ctx context.Context, pts ...*partial_transaction.PartialTransaction) (*partial_transaction.PartialTransaction, error) {
+	var pt partial_transaction.PartialTransaction
+	cr := &wallet_transaction_request.PartialCombineRequest{PartialTransactions: pts}
+	if err := wc.Do(ctx, http.MethodPost, "/transaction/partial/combine", nil, cr, &pt); err != nil {
+		return nil, err
+	}
+	return &pt, nil
+}
+
+// POST "/transaction/partial/finalize", la transazione firmata e, con
+// relay, inviata anche al nodo
+func (wc *WalletClient) FinalizePartialTransaction(ctx context.Context, pt *partial_transaction.PartialTransaction, relay bool) (*blockchain_transaction_request.TransactionRequest, error) {
+	var tr blockchain_transaction_request.TransactionRequest
+	fr := &wallet_transaction_request.PartialFinalizeRequest{PartialTransaction: pt, Relay: relay}
+	if err := wc.Do(ctx, http.MethodPost, "/transaction/partial/finalize", nil, fr, &tr); err != nil {
+		return nil, err
+	}
+	return &tr, nil
+}
+
+// POST "/htlc", blocca i fondi del sender nel contratto, senza hash
+// il preimage lo genera il server
+func (wc *WalletClient) LockHtlc(ctx context.Context, hr *wallet_transaction_request.HtlcRequest) (*HtlcInfo, error) {
+	var info HtlcInfo
+	if err := wc.Do(ctx, http.MethodPost, "/htlc", nil, hr, &info, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// POST "/htlc/status"
+func (wc *WalletClient) HtlcStatus(ctx context.Context, c *htlc.Contract) (*blockchain.HtlcStatus, error) {
+	var hs blockchain.HtlcStatus
+	if err := wc.Do(ctx, http.MethodPost, "/htlc/status", nil, c, &hs); err != nil {
+		return nil, err
+	}
+	return &hs, nil
+}
+
+// POST "/htlc/claim", ritorna la transazione aggiunta al pool
+func (wc *WalletClient) ClaimHtlc(ctx context.Context, c *htlc.Contract, preimage string) (*blockchain_transaction_request.TransactionRequest, error) {
+	return wc.spendHtlc(ctx, "/htlc/claim", &htlc.Spend{Contract: *c, Preimage: preimage})
+}
+
+// POST "/htlc/refund", ritorna la transazione aggiunta al pool
+func (wc *WalletClient) RefundHtlc(ctx context.Context, c *htlc.Contract) (*blockchain_transaction_request.TransactionRequest, error) {
+	return wc.spendHtlc(ctx, "/htlc/refund", &htlc.Spend{Contract: *c})
+}
+
+func (wc *WalletClient) spendHtlc(ctx context.Context, path string, s *htlc.Spend) (*blockchain_transaction_request.TransactionRequest, error) {
+	var tr blockchain_transaction_request.TransactionRequest
+	if err := wc.Do(ctx, http.MethodPost, path, nil, s, &tr, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &tr, nil
+}
+
+// GET "/openapi.json"
+func (wc *WalletClient) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var doc json.RawMessage
+	if err := wc.Do(ctx, http.MethodGet, "/openapi.json", nil, nil, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// GET "/wallet/events", con lastHeight >= 0 riprende dal blocco
+// successivo
+func (wc *WalletClient) Events(ctx context.Context, blockchainAddress string, lastHeight int) (*EventStream, error) {
+	header := http.Header{"Accept": {"text/event-stream"}}
+	if lastHeight >= 0 {
+		header.Set("Last-Event-ID", strconv.Itoa(lastHeight))
+	}
+	resp, err := wc.Open(ctx, "/wallet/events", url.Values{"blockchain_address": {blockchainAddress}}, header)
+	if err != nil {
+		return nil, err
+	}
+	return newEventStream(resp), nil
+}
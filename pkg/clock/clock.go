@@ -0,0 +1,247 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Orologio usato dalla blockchain e dal nodo p2p, così nelle
+// simulazioni il tempo può essere fatto avanzare a mano
+type Clock interface {
+	Now() time.Time
+	// Canale che riceve l'ora dopo d
+	After(d time.Duration) <-chan time.Time
+	// Chiama f dopo d
+	AfterFunc(d time.Duration, f func()) Timer
+	// Ticker che scatta ogni d
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer creato con AfterFunc
+type Timer interface {
+	// Ferma il timer, ritorna false se era già scattato o fermato
+	Stop() bool
+}
+
+// Ticker creato con NewTicker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Orologio di sistema
+type realClock struct{}
+
+// Funzione che ritorna l'orologio di sistema
+func Real() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (rt *realTicker) C() <-chan time.Time {
+	return rt.t.C
+}
+
+func (rt *realTicker) Stop() {
+	rt.t.Stop()
+}
+
+// Orologio manuale: il tempo si muove solo con Advance e i timer
+// scattano in ordine di scadenza, quelli con la stessa scadenza in
+// ordine di creazione
+type Manual struct {
+	now    time.Time
+	timers []*manualTimer
+	seq    int
+	mux    sync.Mutex
+}
+
+type manualTimer struct {
+	clock *Manual
+	when  time.Time
+	seq   int
+	f     func()
+	// Per i ticker, il periodo con cui il timer viene riarmato
+	period time.Duration
+	active bool
+}
+
+// Funzione per creare un orologio manuale fermo a start
+func NewManual(start time.Time) *Manual {
+	return &Manual{now: start}
+}
+
+func (m *Manual) Now() time.Time {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.now
+}
+
+func (m *Manual) After(d time.Duration) <-chan time.Time {
+	c := make(chan time.Time, 1)
+	m.AfterFunc(d, func() {
+		c <- m.Now()
+	})
+	return c
+}
+
+func (m *Manual) AfterFunc(d time.Duration, f func()) Timer {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.schedule(d, 0, f)
+}
+
+func (m *Manual) NewTicker(d time.Duration) Ticker {
+	c := make(chan time.Time, 1)
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	t := m.schedule(d, d, nil)
+	// Come time.Ticker, se nessuno legge i tick vengono persi
+	t.f = func() {
+		select {
+		case c <- m.Now():
+		default:
+		}
+	}
+	return &manualTicker{t, c}
+}
+
+// Metodo che aggiunge un timer, va chiamato con il lock
+func (m *Manual) schedule(d time.Duration, period time.Duration, f func()) *manualTimer {
+	if d < 0 {
+		d = 0
+	}
+	m.seq += 1
+	t := &manualTimer{clock: m, when: m.now.Add(d), seq: m.seq, f: f, period: period, active: true}
+	m.timers = append(m.timers, t)
+	return t
+}
+
+// Metodo che fa avanzare il tempo di d, facendo scattare in ordine
+// i timer che scadono nel frattempo
+// Le funzioni dei timer vengono chiamate senza lock, quindi possono
+// creare altri timer
+func (m *Manual) Advance(d time.Duration) {
+	m.mux.Lock()
+	target := m.now.Add(d)
+	m.mux.Unlock()
+	for m.fireNext(target) {
+	}
+	m.mux.Lock()
+	if target.After(m.now) {
+		m.now = target
+	}
+	m.mux.Unlock()
+}
+
+// Metodo che fa scattare solo il prossimo timer, se scade entro
+// target, portando l'orologio alla sua scadenza
+// Ritorna false se non ci sono timer da far scattare
+func (m *Manual) Step(target time.Time) bool {
+	return m.fireNext(target)
+}
+
+// Metodo che ritorna la scadenza del prossimo timer attivo
+func (m *Manual) Next() (time.Time, bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	t := m.next()
+	if t == nil {
+		return time.Time{}, false
+	}
+	return t.when, true
+}
+
+// Metodo che fa scattare il prossimo timer se scade entro target
+// Ritorna false se non ci sono timer da far scattare
+func (m *Manual) fireNext(target time.Time) bool {
+	m.mux.Lock()
+	t := m.next()
+	if t == nil || t.when.After(target) {
+		m.mux.Unlock()
+		return false
+	}
+	if t.when.After(m.now) {
+		m.now = t.when
+	}
+	if t.period > 0 {
+		m.seq += 1
+		t.when = t.when.Add(t.period)
+		t.seq = m.seq
+	} else {
+		t.active = false
+		m.remove(t)
+	}
+	f := t.f
+	m.mux.Unlock()
+	f()
+	return true
+}
+
+// Metodo che ritorna il timer che scade per primo, va chiamato con il lock
+func (m *Manual) next() *manualTimer {
+	if len(m.timers) == 0 {
+		return nil
+	}
+	sort.SliceStable(m.timers, func(i, j int) bool {
+		if !m.timers[i].when.Equal(m.timers[j].when) {
+			return m.timers[i].when.Before(m.timers[j].when)
+		}
+		return m.timers[i].seq < m.timers[j].seq
+	})
+	return m.timers[0]
+}
+
+// Metodo che toglie un timer, va chiamato con il lock
+func (m *Manual) remove(t *manualTimer) {
+	for i, other := range m.timers {
+		if other == t {
+			m.timers = append(m.timers[:i], m.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mux.Lock()
+	defer t.clock.mux.Unlock()
+	if !t.active {
+		return false
+	}
+	t.active = false
+	t.clock.remove(t)
+	return true
+}
+
+type manualTicker struct {
+	t *manualTimer
+	c chan time.Time
+}
+
+func (mt *manualTicker) C() <-chan time.Time {
+	return mt.c
+}
+
+func (mt *manualTicker) Stop() {
+	mt.t.Stop()
+}
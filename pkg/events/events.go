@@ -0,0 +1,202 @@
+package events
+
+import (
+	"strings"
+	"sync"
+)
+
+// Tipi di evento
+const (
+	// Nuovo ultimo blocco della catena
+	NEW_TIP = "new_tip"
+	// La catena è stata sostituita da una più lunga
+	REORG = "reorg"
+	// Transazione entrata nel transaction pool
+	TX_ACCEPTED = "tx_accepted"
+	// Transazione entrata in un blocco della catena
+	TX_CONFIRMED = "tx_confirmed"
+	// Connessione con un peer aperta o chiusa
+	PEER_CONNECTED    = "peer_connected"
+	PEER_DISCONNECTED = "peer_disconnected"
+	// Inviato dagli stream a chi viene scollegato perché resta
+	// indietro, può riconnettersi riprendendo dall'ultima altezza
+	LAGGED = "lagged"
+)
+
+// Numero di eventi che un iscritto può avere in coda prima di
+// essere scollegato
+const DEFAULT_BUFFER = 256
+
+// Evento del nodo, Height e Hash sono quelli del blocco per gli
+// eventi della catena
+type Event struct {
+	Type   string      `json:"type"`
+	Height int         `json:"height,omitempty"`
+	Hash   string      `json:"hash,omitempty"`
+	Time   int64       `json:"time"`
+	Data   interface{} `json:"data,omitempty"`
+	// L'evento è stato ricostruito dalla catena per chi riprende
+	// da un'altezza, non è appena successo
+	Replay bool `json:"replay,omitempty"`
+	// Indirizzi coinvolti, per filtrare le transazioni
+	Addresses []string `json:"-"`
+}
+
+// Funzione che ritorna i tipi di evento pubblicati sul bus
+func Types() []string {
+	return []string{NEW_TIP, REORG, TX_ACCEPTED, TX_CONFIRMED, PEER_CONNECTED, PEER_DISCONNECTED}
+}
+
+// Funzione che dice se il tipo è uno di quelli pubblicati sul bus
+func Known(eventType string) bool {
+	for _, t := range Types() {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Funzione che dice se il tipo di evento riguarda una transazione
+func IsTransaction(eventType string) bool {
+	return eventType == TX_ACCEPTED || eventType == TX_CONFIRMED
+}
+
+// Filtro degli eventi di un iscritto, i campi vuoti non filtrano
+// Gli indirizzi filtrano solo gli eventi delle transazioni, gli
+// altri arrivano comunque se il tipo è tra quelli richiesti
+type Filter struct {
+	Types     map[string]bool
+	Addresses map[string]bool
+}
+
+// Funzione che crea un filtro da liste separate da virgole
+func ParseFilter(types string, addresses []string) Filter {
+	f := Filter{Types: make(map[string]bool), Addresses: make(map[string]bool)}
+	for _, t := range strings.Split(types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			f.Types[t] = true
+		}
+	}
+	for _, list := range addresses {
+		for _, a := range strings.Split(list, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				f.Addresses[a] = true
+			}
+		}
+	}
+	return f
+}
+
+// Metodo che dice se l'evento passa il filtro
+func (f Filter) Match(e *Event) bool {
+	if len(f.Types) > 0 && !f.Types[e.Type] {
+		return false
+	}
+	if len(f.Addresses) == 0 || !IsTransaction(e.Type) {
+		return true
+	}
+	for _, a := range e.Addresses {
+		if f.Addresses[a] {
+			return true
+		}
+	}
+	return false
+}
+
+// Iscrizione agli eventi, il canale viene chiuso quando l'iscritto
+// si cancella, resta troppo indietro o il bus viene chiuso
+type Subscription struct {
+	bus    *Bus
+	filter Filter
+	events chan *Event
+	// true se è stata chiusa perché la coda era piena
+	lagged bool
+	closed bool
+}
+
+// Canale da cui leggere gli eventi
+func (s *Subscription) C() <-chan *Event {
+	return s.events
+}
+
+// Metodo che dice se l'iscrizione è stata chiusa perché
+// l'iscritto non leggeva abbastanza in fretta
+func (s *Subscription) Lagged() bool {
+	s.bus.mux.Lock()
+	defer s.bus.mux.Unlock()
+	return s.lagged
+}
+
+// Metodo per cancellare l'iscrizione
+func (s *Subscription) Unsubscribe() {
+	s.bus.mux.Lock()
+	defer s.bus.mux.Unlock()
+	s.bus.remove(s)
+}
+
+// Bus degli eventi del nodo: chi pubblica non si blocca mai, chi
+// resta indietro di più di buffer eventi viene scollegato
+type Bus struct {
+	subs   map[*Subscription]bool
+	closed bool
+	mux    sync.Mutex
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]bool)}
+}
+
+// Metodo per iscriversi agli eventi che passano il filtro
+func (b *Bus) Subscribe(filter Filter, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DEFAULT_BUFFER
+	}
+	s := &Subscription{bus: b, filter: filter, events: make(chan *Event, buffer)}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.closed {
+		s.closed = true
+		close(s.events)
+		return s
+	}
+	b.subs[s] = true
+	return s
+}
+
+// Metodo per pubblicare un evento a tutti gli iscritti interessati
+func (b *Bus) Publish(e *Event) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for s := range b.subs {
+		if !s.filter.Match(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			s.lagged = true
+			b.remove(s)
+		}
+	}
+}
+
+// Metodo per chiudere il bus e tutte le iscrizioni
+func (b *Bus) Close() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.closed = true
+	for s := range b.subs {
+		b.remove(s)
+	}
+}
+
+// Metodo che toglie un iscritto, va chiamato con il lock
+func (b *Bus) remove(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(b.subs, s)
+	close(s.events)
+}
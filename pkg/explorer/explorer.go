@@ -0,0 +1,439 @@
+package explorer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+)
+
+const (
+	// Blocchi mostrati in ogni pagina degli ultimi blocchi
+	LATEST_BLOCKS = 20
+	// Movimenti mostrati in ogni pagina di un indirizzo
+	HISTORY_PAGE_SIZE = 50
+	// Indirizzi di una sola richiesta di Activity
+	MAX_ACTIVITY_ADDRESSES = 100
+)
+
+// Direzione di un movimento rispetto all'indirizzo
+const (
+	DIRECTION_IN   = "in"
+	DIRECTION_OUT  = "out"
+	DIRECTION_SELF = "self"
+)
+
+// Il blocco, la transazione o l'indirizzo cercati non esistono
+var ErrNotFound = errors.New("not found")
+
+// Riepilogo di un blocco, per le liste
+type BlockSummary struct {
+	Height       int
+	Hash         string
+	PreviousHash string
+	Timestamp    int64
+	Nonce        int
+	Transactions int
+	// Somma dei valori delle transazioni, ricompensa compresa
+	Value float32
+}
+
+// Dettaglio di un blocco, con le sue transazioni
+type BlockDetail struct {
+	BlockSummary
+	// Hash del blocco successivo, vuoto se è l'ultimo
+	NextHash     string
+	Transactions []*TransactionRef
+}
+
+// Transazione nella catena o nel transaction pool
+// Le transazioni non hanno un identificativo, l'hash è quello dei
+// loro dati e due transazioni uguali hanno lo stesso hash
+type TransactionRef struct {
+	Hash string
+	// Altezza, hash e timestamp del blocco, -1 e vuoti se la
+	// transazione è nel transaction pool
+	Height    int
+	BlockHash string
+	Timestamp int64
+	// Posizione nel blocco o nel transaction pool
+	Index       int
+	Coinbase    bool
+	Transaction *blockchain_transaction.Transaction
+}
+
+// Metodo che dice se la transazione è ancora nel transaction pool
+func (tr *TransactionRef) Pending() bool {
+	return tr.Height < 0
+}
+
+// Dettaglio di una transazione: tutti i blocchi in cui compare e
+// le copie in attesa nel transaction pool
+type TransactionDetail struct {
+	Hash        string
+	Transaction *blockchain_transaction.Transaction
+	// Altezza dell'ultimo blocco, per le conferme
+	TipHeight int
+	Confirmed []*TransactionRef
+	Pending   []*TransactionRef
+}
+
+// Metodo che dice se è la ricompensa di un blocco
+func (td *TransactionDetail) Coinbase() bool {
+	return td.Transaction.SenderBlockchainAddress == blockchain.MINING_SENDER
+}
+
+// Metodo che ritorna le conferme di un blocco della transazione
+func (td *TransactionDetail) Confirmations(tr *TransactionRef) int {
+	return td.TipHeight - tr.Height + 1
+}
+
+// Movimento di un indirizzo
+type AddressEntry struct {
+	*TransactionRef
+	Direction string
+	// Valore con il segno: positivo se entra, negativo se esce
+	Amount float32
+	// Bilancio dopo il movimento, solo per quelli confermati
+	Balance float32
+}
+
+// Dettaglio di un indirizzo, con i movimenti dal più recente
+type AddressDetail struct {
+	Address  string
+	Balance  float32
+	Received float32
+	Sent     float32
+	// Numero di transazioni confermate
+	Count   int
+	History []*AddressEntry
+	Pending []*AddressEntry
+	// Pagina della storia, da 0, e numero di pagine
+	Page  int
+	Pages int
+}
+
+// Attività di un indirizzo, per capire se è già stato usato senza
+// leggerne tutta la storia
+type AddressActivity struct {
+	Address string `json:"blockchain_address"`
+	// Transazioni confermate e in attesa nel transaction pool
+	Transactions int     `json:"transactions"`
+	Pending      int     `json:"pending"`
+	Balance      float32 `json:"balance"`
+}
+
+// Metodo che dice se l'indirizzo compare in qualche transazione
+func (a *AddressActivity) Used() bool {
+	return a.Transactions > 0 || a.Pending > 0
+}
+
+// Explorer legge la blockchain per le pagine del block explorer
+// Ogni metodo lavora su una copia della catena, quindi non vede
+// blocchi a metà anche se la catena cambia nel frattempo
+type Explorer struct {
+	blockchain *blockchain.Blockchain
+}
+
+// Funzione per creare l'explorer della blockchain
+func NewExplorer(bc *blockchain.Blockchain) *Explorer {
+	return &Explorer{blockchain: bc}
+}
+
+// Funzione che calcola l'hash di una transazione, dai suoi dati in
+// json
+func TransactionHash(t *blockchain_transaction.Transaction) string {
+	m, _ := json.Marshal(t)
+	return fmt.Sprintf("%x", sha256.Sum256(m))
+}
+
+// Metodo che ritorna l'altezza dell'ultimo blocco
+func (e *Explorer) Height() int {
+	return e.blockchain.Height()
+}
+
+// Metodo che ritorna count blocchi partendo dall'altezza from verso
+// il genesis, con from negativo parte dall'ultimo blocco
+// Ritorna anche l'altezza dell'ultimo blocco
+func (e *Explorer) Latest(from int, count int) ([]*BlockSummary, int) {
+	chain := e.blockchain.Chain()
+	tip := len(chain) - 1
+	if from < 0 || from > tip {
+		from = tip
+	}
+	blocks := make([]*BlockSummary, 0, count)
+	for h := from; h >= 0 && len(blocks) < count; h-- {
+		blocks = append(blocks, summary(h, chain[h]))
+	}
+	return blocks, tip
+}
+
+// Metodo che cerca un blocco per hash o per altezza
+func (e *Explorer) Block(id string) (*BlockDetail, error) {
+	chain := e.blockchain.Chain()
+	height := findBlock(chain, id)
+	if height < 0 {
+		return nil, fmt.Errorf("block %s: %w", id, ErrNotFound)
+	}
+	b := chain[height]
+	detail := &BlockDetail{BlockSummary: *summary(height, b)}
+	if height+1 < len(chain) {
+		detail.NextHash = blockchain.BlockHash(chain[height+1])
+	}
+	for i, t := range b.Transactions {
+		detail.Transactions = append(detail.Transactions, confirmedRef(height, detail.Hash, b.Timestamp, i, t))
+	}
+	return detail, nil
+}
+
+// Metodo che cerca una transazione per hash nella catena e nel
+// transaction pool
+func (e *Explorer) Transaction(hash string) (*TransactionDetail, error) {
+	hash = strings.ToLower(hash)
+	chain := e.blockchain.Chain()
+	detail := &TransactionDetail{Hash: hash, TipHeight: len(chain) - 1}
+	for h := len(chain) - 1; h >= 0; h-- {
+		b := chain[h]
+		var blockHash string
+		for i, t := range b.Transactions {
+			if TransactionHash(t) != hash {
+				continue
+			}
+			if blockHash == "" {
+				blockHash = blockchain.BlockHash(b)
+			}
+			detail.Transaction = t
+			detail.Confirmed = append(detail.Confirmed, confirmedRef(h, blockHash, b.Timestamp, i, t))
+		}
+	}
+	for _, tr := range e.Mempool() {
+		if tr.Hash == hash {
+			detail.Transaction = tr.Transaction
+			detail.Pending = append(detail.Pending, tr)
+		}
+	}
+	if detail.Transaction == nil {
+		return nil, fmt.Errorf("transaction %s: %w", hash, ErrNotFound)
+	}
+	return detail, nil
+}
+
+// Metodo che ritorna le transazioni del transaction pool
+func (e *Explorer) Mempool() []*TransactionRef {
+	pool := e.blockchain.TransactionPool()
+	refs := make([]*TransactionRef, 0, len(pool))
+	for i, t := range pool {
+		refs = append(refs, &TransactionRef{Hash: TransactionHash(t), Height: -1, Index: i, Transaction: t})
+	}
+	return refs
+}
+
+// Metodo che ritorna bilancio e movimenti di un indirizzo, con la
+// pagina page della storia confermata
+func (e *Explorer) Address(address string, page int) *AddressDetail {
+	chain := e.blockchain.Chain()
+	detail := &AddressDetail{Address: address}
+	// La catena si scorre dal genesis per il bilancio dopo ogni
+	// movimento, poi la storia si gira dal più recente
+	history := make([]*AddressEntry, 0)
+	for h, b := range chain {
+		var blockHash string
+		for i, t := range b.Transactions {
+			entry := addressEntry(address, t)
+			if entry == nil {
+				continue
+			}
+			if blockHash == "" {
+				blockHash = blockchain.BlockHash(b)
+			}
+			entry.TransactionRef = confirmedRef(h, blockHash, b.Timestamp, i, t)
+			detail.Balance += entry.Amount
+			entry.Balance = detail.Balance
+			if entry.Direction != DIRECTION_OUT {
+				detail.Received += t.Value
+			}
+			if entry.Direction != DIRECTION_IN {
+				detail.Sent += t.Value
+			}
+			history = append(history, entry)
+		}
+	}
+	detail.Count = len(history)
+	detail.Pages = (len(history) + HISTORY_PAGE_SIZE - 1) / HISTORY_PAGE_SIZE
+	if page < 0 || page >= detail.Pages {
+		page = 0
+	}
+	detail.Page = page
+	for i := len(history) - 1 - page*HISTORY_PAGE_SIZE; i >= 0 && len(detail.History) < HISTORY_PAGE_SIZE; i-- {
+		detail.History = append(detail.History, history[i])
+	}
+	for _, tr := range e.Mempool() {
+		if entry := addressEntry(address, tr.Transaction); entry != nil {
+			entry.TransactionRef = tr
+			detail.Pending = append(detail.Pending, entry)
+		}
+	}
+	return detail
+}
+
+// Metodo che ritorna l'attività degli indirizzi, nello stesso
+// ordine, scorrendo la catena una volta sola
+func (e *Explorer) Activity(addresses []string) []*AddressActivity {
+	activity := make([]*AddressActivity, len(addresses))
+	byAddress := make(map[string][]*AddressActivity, len(addresses))
+	for i, address := range addresses {
+		activity[i] = &AddressActivity{Address: address}
+		byAddress[address] = append(byAddress[address], activity[i])
+	}
+	count := func(t *blockchain_transaction.Transaction, pending bool) {
+		for _, address := range []string{t.SenderBlockchainAddress, t.RecipientBlockchainAddress} {
+			entry := addressEntry(address, t)
+			for _, a := range byAddress[address] {
+				// Le transazioni verso se stessi si contano una volta
+				if entry.Direction == DIRECTION_SELF && address == t.RecipientBlockchainAddress {
+					continue
+				}
+				if pending {
+					a.Pending++
+				} else {
+					a.Transactions++
+					a.Balance += entry.Amount
+				}
+			}
+		}
+	}
+	for _, b := range e.blockchain.Chain() {
+		for _, t := range b.Transactions {
+			count(t, false)
+		}
+	}
+	for _, t := range e.blockchain.TransactionPool() {
+		count(t, true)
+	}
+	return activity
+}
+
+// Metodo che ritorna il path della pagina che corrisponde alla
+// ricerca: un'altezza, l'hash di un blocco o di una transazione,
+// oppure un indirizzo che compare nella catena o nel pool
+func (e *Explorer) Search(query string) (string, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return "", fmt.Errorf("empty query: %w", ErrNotFound)
+	}
+	chain := e.blockchain.Chain()
+	if _, err := strconv.Atoi(query); err == nil {
+		if findBlock(chain, query) >= 0 {
+			return "/block/" + query, nil
+		}
+		return "", fmt.Errorf("block %s: %w", query, ErrNotFound)
+	}
+	if isHash(query) {
+		hash := strings.ToLower(query)
+		if findBlock(chain, hash) >= 0 {
+			return "/block/" + hash, nil
+		}
+		if _, err := e.Transaction(hash); err == nil {
+			return "/tx/" + hash, nil
+		}
+	}
+	if e.known(chain, query) {
+		return "/address/" + query, nil
+	}
+	return "", fmt.Errorf("%s: %w", query, ErrNotFound)
+}
+
+// Metodo che dice se l'indirizzo compare in una transazione della
+// catena o del transaction pool
+func (e *Explorer) known(chain []*block.Block, address string) bool {
+	for _, b := range chain {
+		for _, t := range b.Transactions {
+			if addressEntry(address, t) != nil {
+				return true
+			}
+		}
+	}
+	for _, t := range e.blockchain.TransactionPool() {
+		if addressEntry(address, t) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Funzione che ritorna l'altezza del blocco con l'hash o l'altezza
+// id, -1 se non c'è
+func findBlock(chain []*block.Block, id string) int {
+	if height, err := strconv.Atoi(id); err == nil {
+		if height < 0 || height >= len(chain) {
+			return -1
+		}
+		return height
+	}
+	id = strings.ToLower(id)
+	for h := len(chain) - 1; h >= 0; h-- {
+		if blockchain.BlockHash(chain[h]) == id {
+			return h
+		}
+	}
+	return -1
+}
+
+// Funzione che dice se s è un hash sha256 in esadecimale
+func isHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func summary(height int, b *block.Block) *BlockSummary {
+	s := &BlockSummary{
+		Height:       height,
+		Hash:         blockchain.BlockHash(b),
+		PreviousHash: fmt.Sprintf("%x", b.PreviousHash),
+		Timestamp:    b.Timestamp,
+		Nonce:        b.Nonce,
+		Transactions: len(b.Transactions),
+	}
+	for _, t := range b.Transactions {
+		s.Value += t.Value
+	}
+	return s
+}
+
+func confirmedRef(height int, blockHash string, timestamp int64, index int, t *blockchain_transaction.Transaction) *TransactionRef {
+	return &TransactionRef{
+		Hash:        TransactionHash(t),
+		Height:      height,
+		BlockHash:   blockHash,
+		Timestamp:   timestamp,
+		Index:       index,
+		Coinbase:    t.SenderBlockchainAddress == blockchain.MINING_SENDER,
+		Transaction: t,
+	}
+}
+
+// Funzione che ritorna il movimento della transazione per
+// l'indirizzo, nil se non lo riguarda
+func addressEntry(address string, t *blockchain_transaction.Transaction) *AddressEntry {
+	in := t.RecipientBlockchainAddress == address
+	out := t.SenderBlockchainAddress == address
+	switch {
+	case in && out:
+		return &AddressEntry{Direction: DIRECTION_SELF}
+	case in:
+		return &AddressEntry{Direction: DIRECTION_IN, Amount: t.Value}
+	case out:
+		return &AddressEntry{Direction: DIRECTION_OUT, Amount: -t.Value}
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+package json_rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/iltommi1995/blockchain-go/pkg/websocket"
+)
+
+const VERSION = "2.0"
+
+// Codici di errore definiti da JSON-RPC 2.0
+const (
+	PARSE_ERROR      = -32700
+	INVALID_REQUEST  = -32600
+	METHOD_NOT_FOUND = -32601
+	INVALID_PARAMS   = -32602
+	INTERNAL_ERROR   = -32603
+)
+
+const (
+	// Dimensione massima del body di una richiesta HTTP
+	MAX_REQUEST_SIZE = 1 << 20
+	// Numero massimo di richieste in un batch
+	MAX_BATCH_SIZE = 100
+)
+
+// Richiesta JSON-RPC, senza id è una notifica e non ha risposta
+type Request struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Risposta JSON-RPC, c'è sempre o il risultato o l'errore
+type Response struct {
+	JsonRpc string
+	Result  interface{}
+	Error   *Error
+	ID      json.RawMessage
+}
+
+// Il risultato va sempre scritto quando non c'è errore, anche se è null
+func (r *Response) MarshalJSON() ([]byte, error) {
+	if r.Error != nil {
+		return json.Marshal(struct {
+			JsonRpc string          `json:"jsonrpc"`
+			Error   *Error          `json:"error"`
+			ID      json.RawMessage `json:"id"`
+		}{r.JsonRpc, r.Error, r.ID})
+	}
+	return json.Marshal(struct {
+		JsonRpc string          `json:"jsonrpc"`
+		Result  interface{}     `json:"result"`
+		ID      json.RawMessage `json:"id"`
+	}{r.JsonRpc, r.Result, r.ID})
+}
+
+func (r *Response) UnmarshalJSON(data []byte) error {
+	var v struct {
+		JsonRpc string          `json:"jsonrpc"`
+		Result  json.RawMessage `json:"result"`
+		Error   *Error          `json:"error"`
+		ID      json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	r.JsonRpc, r.Error, r.ID = v.JsonRpc, v.Error, v.ID
+	if v.Result != nil {
+		r.Result = v.Result
+	}
+	return nil
+}
+
+// Errore JSON-RPC, Data contiene i dettagli leggibili da un programma
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// Funzione per creare un errore
+func NewError(code int, message string, data interface{}) *Error {
+	return &Error{Code: code, Message: message, Data: data}
+}
+
+// Funzione per creare l'errore di parametri non validi
+func InvalidParams(format string, args ...interface{}) *Error {
+	return &Error{Code: INVALID_PARAMS, Message: fmt.Sprintf(format, args...)}
+}
+
+// Metodo esposto via JSON-RPC, riceve i parametri grezzi e ritorna il
+// risultato o un errore
+type Handler func(ctx context.Context, params json.RawMessage) (interface{}, *Error)
+
+// Server JSON-RPC 2.0, risponde via HTTP POST e via websocket
+// sullo stesso endpoint
+type Server struct {
+	methods map[string]Handler
+	// Upgrade dei websocket, con le origini ammesse
+	upgrader websocket.Upgrader
+	// Connessioni websocket aperte, chiuse da CloseAll
+	conns map[*websocket.Conn]bool
+	mux   sync.Mutex
+}
+
+// Funzione per creare un server senza metodi
+func NewServer() *Server {
+	return &Server{methods: make(map[string]Handler), conns: make(map[*websocket.Conn]bool)}
+}
+
+// Metodo per registrare un metodo
+func (s *Server) Register(method string, h Handler) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.methods[method] = h
+}
+
+// Metodo che ritorna i nomi dei metodi registrati, in ordine
+func (s *Server) Methods() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Metodo che esegue una richiesta o un batch e ritorna la risposta
+// da inviare, nil se erano solo notifiche
+func (s *Server) Handle(ctx context.Context, data []byte) []byte {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return marshal(errorResponse(nil, NewError(PARSE_ERROR, "parse error", err.Error())))
+		}
+		if len(batch) == 0 {
+			return marshal(errorResponse(nil, NewError(INVALID_REQUEST, "empty batch", nil)))
+		}
+		if len(batch) > MAX_BATCH_SIZE {
+			return marshal(errorResponse(nil, NewError(INVALID_REQUEST, fmt.Sprintf("batch larger than %d requests", MAX_BATCH_SIZE), nil)))
+		}
+		responses := make([]*Response, 0, len(batch))
+		for _, raw := range batch {
+			if r := s.call(ctx, raw); r != nil {
+				responses = append(responses, r)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return marshal(responses)
+	}
+	if r := s.call(ctx, data); r != nil {
+		return marshal(r)
+	}
+	return nil
+}
+
+// Metodo che esegue una singola richiesta, ritorna nil per le notifiche
+func (s *Server) call(ctx context.Context, raw json.RawMessage) *Response {
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		// Un oggetto json che non è una richiesta è invalido,
+		// tutto il resto non si riesce nemmeno a leggere
+		if json.Valid(raw) {
+			return errorResponse(nil, NewError(INVALID_REQUEST, "invalid request", err.Error()))
+		}
+		return errorResponse(nil, NewError(PARSE_ERROR, "parse error", err.Error()))
+	}
+	if req.JsonRpc != VERSION || req.Method == "" || !validID(req.ID) {
+		return errorResponse(req.ID, NewError(INVALID_REQUEST, "invalid request", nil))
+	}
+
+	s.mux.Lock()
+	h, ok := s.methods[req.Method]
+	s.mux.Unlock()
+
+	var result interface{}
+	var rpcErr *Error
+	if !ok {
+		rpcErr = NewError(METHOD_NOT_FOUND, "method not found", req.Method)
+	} else {
+		result, rpcErr = s.invoke(ctx, h, req.Params)
+	}
+	if req.ID == nil {
+		return nil
+	}
+	if rpcErr != nil {
+		return errorResponse(req.ID, rpcErr)
+	}
+	return &Response{JsonRpc: VERSION, Result: result, ID: req.ID}
+}
+
+// Metodo che chiama il metodo trasformando un panic in errore interno
+func (s *Server) invoke(ctx context.Context, h Handler, params json.RawMessage) (result interface{}, rpcErr *Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ERROR: json-rpc method panicked: %v", r)
+			result, rpcErr = nil, NewError(INTERNAL_ERROR, "internal error", nil)
+		}
+	}()
+	return h(ctx, params)
+}
+
+// Funzione che controlla che l'id sia una stringa, un numero o null
+func validID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	var v interface{}
+	if err := json.Unmarshal(id, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case string, float64, nil:
+		return true
+	}
+	return false
+}
+
+func errorResponse(id json.RawMessage, err *Error) *Response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &Response{JsonRpc: VERSION, Error: err, ID: id}
+}
+
+func marshal(v interface{}) []byte {
+	m, err := json.Marshal(v)
+	if err != nil {
+		m, _ = json.Marshal(errorResponse(nil, NewError(INTERNAL_ERROR, "internal error", err.Error())))
+	}
+	return m
+}
+
+// Resolver HTTP: con POST esegue il body, con una richiesta di
+// upgrade apre un websocket su cui ogni messaggio è una richiesta
+// Il contesto della richiesta HTTP viene passato ai metodi
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if websocket.IsUpgrade(req) {
+		s.serveWebsocket(w, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write(marshal(errorResponse(nil, NewError(INVALID_REQUEST, "use POST or a websocket", nil))))
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(req.Body, MAX_REQUEST_SIZE+1))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if len(data) > MAX_REQUEST_SIZE {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write(marshal(errorResponse(nil, NewError(INVALID_REQUEST, "request too large", nil))))
+		return
+	}
+	response := s.Handle(req.Context(), data)
+	if response == nil {
+		// Solo notifiche, niente da rispondere
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Write(response)
+}
+
+// Metodo per ammettere i websocket aperti dalle pagine di altre
+// origini, di default solo quelle del server stesso
+func (s *Server) SetAllowedOrigins(origins []string) {
+	s.upgrader.AllowedOrigins = origins
+}
+
+// Metodo che esegue le richieste che arrivano sul websocket, una
+// alla volta e nell'ordine in cui arrivano
+func (s *Server) serveWebsocket(w http.ResponseWriter, req *http.Request) {
+	// Il contesto della richiesta non vale più dopo l'upgrade, quindi
+	// si tengono solo i valori messi dai middleware
+	ctx := detach(req.Context())
+	conn, err := s.upgrader.Upgrade(w, req)
+	if err != nil {
+		log.Printf("ERROR: json-rpc websocket: %v", err)
+		return
+	}
+	s.mux.Lock()
+	s.conns[conn] = true
+	s.mux.Unlock()
+	defer func() {
+		s.mux.Lock()
+		delete(s.conns, conn)
+		s.mux.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if response := s.Handle(ctx, data); response != nil {
+			if err := conn.WriteText(response); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Metodo per chiudere tutti i websocket aperti, http.Server.Shutdown
+// non li vede perché sono passati fuori dal server HTTP
+func (s *Server) CloseAll() {
+	s.mux.Lock()
+	conns := make([]*websocket.Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mux.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// Contesto che tiene i valori di un altro contesto ma non viene
+// mai cancellato
+type detached struct {
+	context.Context
+	values context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detached{Context: context.Background(), values: ctx}
+}
+
+func (d detached) Value(key interface{}) interface{} {
+	return d.values.Value(key)
+}
@@ -0,0 +1,231 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const VERSION = "3.0.3"
+
+// Documento OpenAPI, contiene solo le parti usate dai server
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operazioni di un path, per metodo HTTP in minuscolo
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema json, solo i campi che servono a descrivere le API
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	// Per gli oggetti usati come mappe
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// Endpoint documentato: il path con cui è registrato nel router e
+// le sue operazioni
+type Endpoint struct {
+	Route string
+	// Path nel documento se diverso da Route, per gli endpoint che
+	// hanno parametri nel path come "/admin/webhooks/{id}"
+	Path       string
+	Operations map[string]*Operation
+}
+
+// Funzione per creare un documento vuoto
+func NewDocument(title string, version string, description string) *Document {
+	return &Document{
+		OpenAPI: VERSION,
+		Info:    Info{Title: title, Version: version, Description: description},
+		Paths:   make(map[string]*PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]*SecurityScheme),
+		},
+	}
+}
+
+// Metodo che aggiunge gli endpoint al documento controllando che
+// siano esattamente quelli registrati nel router: ogni route deve
+// essere documentata e ogni endpoint documentato deve esistere
+// Ritorna un errore con tutte le differenze trovate
+func (d *Document) AddEndpoints(routes []string, endpoints []*Endpoint) error {
+	documented := make(map[string]*Endpoint)
+	problems := []string{}
+	for _, e := range endpoints {
+		if _, ok := documented[e.Route]; ok {
+			problems = append(problems, fmt.Sprintf("route %s documented twice", e.Route))
+		}
+		documented[e.Route] = e
+	}
+	registered := make(map[string]bool)
+	for _, r := range routes {
+		registered[r] = true
+		if _, ok := documented[r]; !ok {
+			problems = append(problems, fmt.Sprintf("route %s is not documented", r))
+		}
+	}
+	for _, e := range endpoints {
+		if !registered[e.Route] {
+			problems = append(problems, fmt.Sprintf("documented route %s is not registered", e.Route))
+			continue
+		}
+		if len(e.Operations) == 0 {
+			problems = append(problems, fmt.Sprintf("route %s has no operations", e.Route))
+		}
+		path := e.Path
+		if path == "" {
+			path = e.Route
+		}
+		item := PathItem{}
+		for method, op := range e.Operations {
+			item[strings.ToLower(method)] = op
+		}
+		d.Paths[path] = &item
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("openapi document does not match the routes: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Metodo che ritorna il documento in json indentato, con una
+// newline finale così il file si può confrontare con quello generato
+func (d *Document) Marshal() ([]byte, error) {
+	m, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(m, '\n'), nil
+}
+
+// Funzioni per costruire gli schemi
+
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func String(description string) *Schema {
+	return &Schema{Type: "string", Description: description}
+}
+
+func Integer(description string) *Schema {
+	return &Schema{Type: "integer", Format: "int64", Description: description}
+}
+
+func Number(description string) *Schema {
+	return &Schema{Type: "number", Format: "float", Description: description}
+}
+
+func Boolean(description string) *Schema {
+	return &Schema{Type: "boolean", Description: description}
+}
+
+func Array(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// Oggetto con le proprietà e quelle obbligatorie
+func Object(properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{Type: "object", Properties: properties, Required: required}
+}
+
+// Oggetto con chiavi libere e valori dello schema
+func Map(values *Schema) *Schema {
+	return &Schema{Type: "object", AdditionalProperties: values}
+}
+
+// Contenuto json con lo schema
+func Json(schema *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: schema}}
+}
+
+// Body json obbligatorio
+func JsonBody(schema *Schema) *RequestBody {
+	return &RequestBody{Required: true, Content: Json(schema)}
+}
+
+// Risposta json
+func JsonResponse(description string, schema *Schema) *Response {
+	return &Response{Description: description, Content: Json(schema)}
+}
+
+// Query param
+func Query(name string, description string, required bool, schema *Schema) *Parameter {
+	return &Parameter{Name: name, In: "query", Description: description, Required: required, Schema: schema}
+}
+
+// Parametro nel path, sempre obbligatorio
+func PathParam(name string, description string) *Parameter {
+	return &Parameter{Name: name, In: "path", Description: description, Required: true, Schema: String("")}
+}
+
+// Header
+func Header(name string, description string) *Parameter {
+	return &Parameter{Name: name, In: "header", Description: description, Schema: String("")}
+}
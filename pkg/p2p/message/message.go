@@ -0,0 +1,127 @@
+package message
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Comandi del protocollo tra nodi
+const (
+	CMD_VERSION    = "version"
+	CMD_VERACK     = "verack"
+	CMD_PING       = "ping"
+	CMD_PONG       = "pong"
+	CMD_INV        = "inv"
+	CMD_GETDATA    = "getdata"
+	CMD_BLOCK      = "block"
+	CMD_TX         = "tx"
+	CMD_GETHEADERS = "getheaders"
+	CMD_HEADERS    = "headers"
+	CMD_GETADDR    = "getaddr"
+	CMD_ADDR       = "addr"
+)
+
+const (
+	// Lunghezza del campo comando nell'header
+	COMMAND_SIZE = 12
+	// Header: magic (4) + comando (12) + lunghezza (4) + checksum (4)
+	HEADER_SIZE = 4 + COMMAND_SIZE + 4 + 4
+	// Dimensione massima del payload di un messaggio
+	MAX_PAYLOAD_SIZE = 32 << 20
+)
+
+var (
+	ErrBadMagic    = errors.New("bad magic")
+	ErrBadChecksum = errors.New("bad checksum")
+	ErrTooLarge    = errors.New("payload too large")
+)
+
+// Messaggio scambiato tra due nodi, il payload è in json
+type Message struct {
+	Command string
+	Payload []byte
+}
+
+// Funzione che ricava il magic della rete dal chain id, così i
+// messaggi di reti diverse vengono scartati già dall'header
+func Magic(chainID string) [4]byte {
+	h := sha256.Sum256([]byte(chainID))
+	var magic [4]byte
+	copy(magic[:], h[:4])
+	return magic
+}
+
+// Funzione che calcola il checksum del payload: i primi 4 bytes
+// del doppio SHA-256
+func Checksum(payload []byte) [4]byte {
+	h := sha256.Sum256(payload)
+	h = sha256.Sum256(h[:])
+	var checksum [4]byte
+	copy(checksum[:], h[:4])
+	return checksum
+}
+
+// Funzione che codifica un messaggio nel formato:
+// magic | comando | lunghezza del payload | checksum | payload
+// Lunghezza in big endian, comando riempito di zeri
+func Encode(magic [4]byte, m *Message) ([]byte, error) {
+	if len(m.Command) > COMMAND_SIZE {
+		return nil, fmt.Errorf("command %q too long", m.Command)
+	}
+	if len(m.Payload) > MAX_PAYLOAD_SIZE {
+		return nil, ErrTooLarge
+	}
+	buf := make([]byte, HEADER_SIZE+len(m.Payload))
+	copy(buf[0:4], magic[:])
+	copy(buf[4:4+COMMAND_SIZE], m.Command)
+	binary.BigEndian.PutUint32(buf[16:20], uint32(len(m.Payload)))
+	checksum := Checksum(m.Payload)
+	copy(buf[20:24], checksum[:])
+	copy(buf[HEADER_SIZE:], m.Payload)
+	return buf, nil
+}
+
+// Funzione che scrive un messaggio in un'unica Write
+func Write(w io.Writer, magic [4]byte, m *Message) error {
+	buf, err := Encode(magic, m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// Funzione che legge un messaggio, controllando magic,
+// dimensione e checksum
+func Read(r io.Reader, magic [4]byte) (*Message, error) {
+	header := make([]byte, HEADER_SIZE)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[0:4], magic[:]) {
+		return nil, ErrBadMagic
+	}
+	length := binary.BigEndian.Uint32(header[16:20])
+	if length > MAX_PAYLOAD_SIZE {
+		return nil, ErrTooLarge
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		// Dopo l'header la connessione chiusa è un frame troncato
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if checksum := Checksum(payload); !bytes.Equal(header[20:24], checksum[:]) {
+		return nil, ErrBadChecksum
+	}
+	return &Message{
+		Command: string(bytes.TrimRight(header[4:4+COMMAND_SIZE], "\x00")),
+		Payload: payload,
+	}, nil
+}
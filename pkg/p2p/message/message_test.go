@@ -0,0 +1,133 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Funzione che codifica un messaggio del test
+func encode(t *testing.T, magic [4]byte, m *Message) []byte {
+	t.Helper()
+	b, err := Encode(magic, m)
+	check(t, err)
+	return b
+}
+
+// I messaggi scritti uno dopo l'altro si rileggono uguali, anche
+// letti un byte alla volta, e l'header ha magic, comando, lunghezza
+// in big endian e checksum
+func TestRoundTrip(t *testing.T) {
+	magic := Magic("message-test")
+	messages := []*Message{
+		New(CMD_PING, &Ping{Nonce: 42}),
+		{Command: CMD_VERACK, Payload: []byte{}},
+		New(CMD_GETHEADERS, &GetHeaders{Locator: []string{"aa", "bb"}}),
+		{Command: "abcdefghijkl", Payload: bytes.Repeat([]byte{0xff}, 1000)},
+	}
+	var stream bytes.Buffer
+	for _, m := range messages {
+		check(t, Write(&stream, magic, m))
+	}
+
+	first := encode(t, magic, messages[0])
+	if !bytes.Equal(first[0:4], magic[:]) || string(bytes.TrimRight(first[4:16], "\x00")) != CMD_PING {
+		t.Fatalf("header %x", first[:HEADER_SIZE])
+	}
+	checksum := Checksum(messages[0].Payload)
+	if binary.BigEndian.Uint32(first[16:20]) != uint32(len(messages[0].Payload)) || !bytes.Equal(first[20:24], checksum[:]) {
+		t.Fatalf("header %x", first[:HEADER_SIZE])
+	}
+
+	r := iotest.OneByteReader(&stream)
+	for _, expected := range messages {
+		m, err := Read(r, magic)
+		check(t, err)
+		if m.Command != expected.Command || !bytes.Equal(m.Payload, expected.Payload) {
+			t.Fatalf("read %s %q, expected %s %q", m.Command, m.Payload, expected.Command, expected.Payload)
+		}
+	}
+	if _, err := Read(r, magic); err != io.EOF {
+		t.Fatalf("after the last message: %v, expected %v", err, io.EOF)
+	}
+
+	var ping Ping
+	check(t, messages[0].Decode(&ping))
+	if ping.Nonce != 42 {
+		t.Fatalf("decoded %+v", ping)
+	}
+	if Magic("message-test") == Magic("other") {
+		t.Fatal("two networks with the same magic")
+	}
+}
+
+// I messaggi troppo grandi non si scrivono e non si leggono: la
+// lunghezza dell'header viene controllata prima di leggere il payload
+func TestSizeLimits(t *testing.T) {
+	magic := Magic("message-test")
+	if _, err := Encode(magic, &Message{Command: "abcdefghijklm"}); err == nil {
+		t.Fatal("encoded a command longer than COMMAND_SIZE")
+	}
+	if _, err := Encode(magic, &Message{Command: CMD_BLOCK, Payload: make([]byte, MAX_PAYLOAD_SIZE+1)}); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("large payload: %v, expected %v", err, ErrTooLarge)
+	}
+	check(t, Write(io.Discard, magic, &Message{Command: CMD_BLOCK, Payload: make([]byte, MAX_PAYLOAD_SIZE)}))
+
+	for _, length := range []uint32{MAX_PAYLOAD_SIZE + 1, 0xffffffff} {
+		header := encode(t, magic, &Message{Command: CMD_BLOCK})
+		binary.BigEndian.PutUint32(header[16:20], length)
+		if _, err := Read(bytes.NewReader(header), magic); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("length %d: %v, expected %v", length, err, ErrTooLarge)
+		}
+	}
+}
+
+// Frame troncati, di un'altra rete o con il payload cambiato
+func TestMalformed(t *testing.T) {
+	magic := Magic("message-test")
+	frame := encode(t, magic, New(CMD_ADDR, &Addr{Addresses: []string{"127.0.0.1:5000"}}))
+	corrupted := append([]byte{}, frame...)
+	corrupted[len(corrupted)-2] ^= 0x01
+	badChecksum := append([]byte{}, frame...)
+	badChecksum[20] ^= 0x01
+	longer := append([]byte{}, frame...)
+	binary.BigEndian.PutUint32(longer[16:20], uint32(len(frame)))
+
+	tests := map[string]struct {
+		data     []byte
+		expected error
+	}{
+		"empty":            {nil, io.EOF},
+		"truncated header": {frame[:HEADER_SIZE-1], io.ErrUnexpectedEOF},
+		"header only":      {frame[:HEADER_SIZE], io.ErrUnexpectedEOF},
+		"truncated":        {frame[:len(frame)-1], io.ErrUnexpectedEOF},
+		"length too long":  {longer, io.ErrUnexpectedEOF},
+		"other network":    {encode(t, Magic("other"), New(CMD_ADDR, &Addr{})), ErrBadMagic},
+		"payload":          {corrupted, ErrBadChecksum},
+		"checksum":         {badChecksum, ErrBadChecksum},
+	}
+	for name, test := range tests {
+		if _, err := Read(bytes.NewReader(test.data), magic); !errors.Is(err, test.expected) {
+			t.Errorf("%s: %v, expected %v", name, err, test.expected)
+		}
+	}
+
+	// Un payload che non è il json del comando si legge ma non si
+	// decodifica
+	m, err := Read(bytes.NewReader(encode(t, magic, &Message{Command: CMD_INV, Payload: []byte("{")})), magic)
+	check(t, err)
+	if err := m.Decode(&Inv{}); err == nil {
+		t.Fatal("decoded a malformed payload")
+	}
+}
@@ -0,0 +1,90 @@
+package message
+
+import (
+	"encoding/json"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/handshake"
+)
+
+// Tipi di oggetto annunciati con inv e richiesti con getdata
+const (
+	INV_TX    = "tx"
+	INV_BLOCK = "block"
+)
+
+// Payload di version: l'handshake del nodo più un nonce casuale
+// che l'altro nodo deve firmare nel verack
+type Version struct {
+	Handshake *handshake.Handshake `json:"handshake"`
+	Nonce     string               `json:"nonce"`
+}
+
+// Payload di verack: la firma del nonce ricevuto con version,
+// prova che il nodo possiede la chiave che ha annunciato
+type Verack struct {
+	Signature string `json:"signature"`
+}
+
+// Payload di ping e pong
+type Ping struct {
+	Nonce uint64 `json:"nonce"`
+}
+
+// Oggetto annunciato o richiesto
+type InvItem struct {
+	Type string `json:"type"`
+	Hash string `json:"hash"`
+}
+
+// Payload di inv e getdata
+type Inv struct {
+	Items []InvItem `json:"items"`
+}
+
+// Payload di block
+type Block struct {
+	Block *block.Block `json:"block"`
+}
+
+// Payload di tx
+type Tx struct {
+	Transaction *transaction_request.TransactionRequest `json:"transaction"`
+}
+
+// Payload di getheaders: hash di blocchi della catena locale, dal più
+// recente al genesis, con cui il peer trova il punto di biforcazione
+type GetHeaders struct {
+	Locator []string `json:"locator"`
+}
+
+// Header di un blocco, con l'altezza nella catena
+type Header struct {
+	Height       int    `json:"height"`
+	Hash         string `json:"hash"`
+	PreviousHash string `json:"previous_hash"`
+	Timestamp    int64  `json:"timestamp"`
+	Nonce        int    `json:"nonce"`
+}
+
+// Payload di headers
+type Headers struct {
+	Headers []Header `json:"headers"`
+}
+
+// Payload di addr
+type Addr struct {
+	Addresses []string `json:"addresses"`
+}
+
+// Funzione per creare un messaggio a partire dal payload
+func New(command string, payload interface{}) *Message {
+	m, _ := json.Marshal(payload)
+	return &Message{Command: command, Payload: m}
+}
+
+// Metodo per leggere il payload del messaggio
+func (m *Message) Decode(payload interface{}) error {
+	return json.Unmarshal(m.Payload, payload)
+}
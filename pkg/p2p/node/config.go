@@ -0,0 +1,108 @@
+package node
+
+import (
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+)
+
+const (
+	DEFAULT_HOST               = "127.0.0.1"
+	DEFAULT_P2P_PORT           = 6000
+	DEFAULT_CHAIN_ID           = blockchain.DEFAULT_CHAIN_ID
+	DEFAULT_MAX_OUTBOUND_PEERS = 8
+	DEFAULT_MAX_INBOUND_PEERS  = 16
+
+	// Range di porte e di IP scansionati per la discovery nella LAN
+	P2P_PORT_RANGE_START    = 6000
+	P2P_PORT_RANGE_END      = 6003
+	NEIGHBOR_IP_RANGE_START = 0
+	NEIGHBOR_IP_RANGE_END   = 1
+
+	// Ogni quanto si cercano nuovi peer e si eliminano quelli morti
+	DISCOVERY_INTERVAL_SEC = 20
+	DIAL_TIMEOUT_SEC       = 3
+	HANDSHAKE_TIMEOUT_SEC  = 10
+
+	PEER_EXCHANGE_LIMIT   = 50
+	PEER_PRUNE_AFTER_SEC  = 3600
+	PEER_MAX_FAILURES     = 5
+	PEER_BAN_DURATION_SEC = 24 * 3600
+
+	// Numero massimo di header e di oggetti in un messaggio
+	MAX_HEADERS   = 2000
+	MAX_INV_ITEMS = 2000
+	// Transazioni ricordate per rispondere ai getdata dei peer
+	TX_CACHE_SIZE = 5000
+
+	// Richieste di sincronizzazione e di indirizzi accettate da un peer
+	REQUEST_RATE_LIMIT      = 30
+	REQUEST_RATE_WINDOW_SEC = 60
+)
+
+// Penalità per le violazioni del protocollo da parte di un peer,
+// un peer parte da peer.INITIAL_SCORE punti
+const (
+	PENALTY_INVALID_BLOCK     = 50
+	PENALTY_INVALID_CHAIN     = 50
+	PENALTY_MALFORMED_MESSAGE = 10
+	PENALTY_UNREQUESTED_DATA  = 10
+	PENALTY_INVALID_TX        = 20
+	PENALTY_FLOOD             = 5
+)
+
+// Configurazione del nodo p2p
+type Config struct {
+	// Host e porta su cui il nodo ascolta e con cui si annuncia agli altri,
+	// con la porta 0 ne viene scelta una libera
+	Host string
+	Port uint16
+	// Identificativo della rete, i nodi di reti diverse non si parlano,
+	// se vuoto è quello della blockchain
+	ChainID string
+	// Peer da cui partire per scoprire la rete
+	Seeds []string
+	// File dell'address book, se vuoto resta solo in memoria
+	AddressBookPath string
+	// Numero di peer da contattare e di peer accettati in ingresso
+	MaxOutbound int
+	MaxInbound  int
+	// Se true si cercano anche i nodi scansionando le porte della LAN
+	LanDiscovery bool
+	// File con la chiave del nodo, se vuoto la chiave è nuova ad ogni avvio
+	NodeKeyPath string
+	// Orologio del nodo, se nil si usa quello di sistema
+	Clock clock.Clock
+}
+
+// Funzione che ritorna la configurazione di default: nessun seed,
+// address book in memoria e scansione della LAN attiva
+func DefaultConfig() Config {
+	return Config{
+		Host:         DEFAULT_HOST,
+		Port:         DEFAULT_P2P_PORT,
+		ChainID:      DEFAULT_CHAIN_ID,
+		MaxOutbound:  DEFAULT_MAX_OUTBOUND_PEERS,
+		MaxInbound:   DEFAULT_MAX_INBOUND_PEERS,
+		LanDiscovery: true,
+	}
+}
+
+// Metodo che riempie i campi mancanti con i valori di default
+func (c Config) withDefaults() Config {
+	if c.Host == "" {
+		c.Host = DEFAULT_HOST
+	}
+	if c.ChainID == "" {
+		c.ChainID = DEFAULT_CHAIN_ID
+	}
+	if c.MaxOutbound <= 0 {
+		c.MaxOutbound = DEFAULT_MAX_OUTBOUND_PEERS
+	}
+	if c.MaxInbound <= 0 {
+		c.MaxInbound = DEFAULT_MAX_INBOUND_PEERS
+	}
+	if c.Clock == nil {
+		c.Clock = clock.Real()
+	}
+	return c
+}
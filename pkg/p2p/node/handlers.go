@@ -0,0 +1,316 @@
+package node
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/events"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/message"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/peer_conn"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/handshake"
+)
+
+// Metodo chiamato per ogni messaggio ricevuto da un peer
+func (n *Node) HandleMessage(pc *peer_conn.PeerConn, m *message.Message) {
+	var err error
+	switch m.Command {
+	case message.CMD_GETADDR:
+		err = n.handleGetAddr(pc)
+	case message.CMD_ADDR:
+		err = n.handleAddr(pc, m)
+	case message.CMD_INV:
+		err = n.handleInv(pc, m)
+	case message.CMD_GETDATA:
+		err = n.handleGetData(pc, m)
+	case message.CMD_TX:
+		err = n.handleTx(pc, m)
+	case message.CMD_BLOCK:
+		err = n.handleBlock(pc, m)
+	case message.CMD_GETHEADERS:
+		err = n.handleGetHeaders(pc, m)
+	case message.CMD_HEADERS:
+		err = n.handleHeaders(pc, m)
+	default:
+		log.Printf("Ignoring unknown command %q from %s", m.Command, pc.Address)
+	}
+	if err != nil {
+		log.Printf("ERROR: %s from %s: %v", m.Command, pc.Address, err)
+	}
+}
+
+// Metodo chiamato quando un peer invia un messaggio corrotto
+func (n *Node) HandleProtocolError(pc *peer_conn.PeerConn, err error) {
+	n.Misbehaving(pc, PENALTY_MALFORMED_MESSAGE, err.Error())
+}
+
+// Metodo chiamato quando la connessione con un peer si chiude
+func (n *Node) HandleClose(pc *peer_conn.PeerConn) {
+	n.mux.Lock()
+	if n.conns[pc.NodeID] == pc {
+		delete(n.conns, pc.NodeID)
+		delete(n.syncs, pc.NodeID)
+	}
+	n.mux.Unlock()
+	log.Printf("Disconnected from peer %s", pc.Address)
+	n.publishPeer(events.PEER_DISCONNECTED, pc)
+}
+
+// Resolver di getaddr: risponde con i peer conosciuti
+func (n *Node) handleGetAddr(pc *peer_conn.PeerConn) error {
+	if !n.allowRequest(pc) {
+		return fmt.Errorf("rate limited")
+	}
+	return pc.Send(message.New(message.CMD_ADDR, &message.Addr{Addresses: n.KnownPeers()}))
+}
+
+// Resolver di addr: aggiunge all'address book i peer ricevuti
+func (n *Node) handleAddr(pc *peer_conn.PeerConn, m *message.Message) error {
+	var addr message.Addr
+	if err := m.Decode(&addr); err != nil {
+		n.Misbehaving(pc, PENALTY_MALFORMED_MESSAGE, "malformed addr")
+		return err
+	}
+	if len(addr.Addresses) > PEER_EXCHANGE_LIMIT {
+		n.Misbehaving(pc, PENALTY_FLOOD, "too many addresses")
+		return fmt.Errorf("too many addresses")
+	}
+	n.addPeers(addr.Addresses)
+	return nil
+}
+
+// Resolver di inv: chiede gli oggetti annunciati che non si conoscono
+func (n *Node) handleInv(pc *peer_conn.PeerConn, m *message.Message) error {
+	var inv message.Inv
+	if err := m.Decode(&inv); err != nil {
+		n.Misbehaving(pc, PENALTY_MALFORMED_MESSAGE, "malformed inv")
+		return err
+	}
+	if len(inv.Items) > MAX_INV_ITEMS {
+		n.Misbehaving(pc, PENALTY_FLOOD, "inv too large")
+		return fmt.Errorf("inv too large")
+	}
+	wanted := make([]message.InvItem, 0)
+	for _, item := range inv.Items {
+		pc.MarkKnown(item.Hash)
+		switch item.Type {
+		case message.INV_TX:
+			if n.transaction(item.Hash) == nil {
+				wanted = append(wanted, item)
+			}
+		case message.INV_BLOCK:
+			if n.bc.BlockByHash(item.Hash) == nil {
+				wanted = append(wanted, item)
+			}
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+	return pc.Send(message.New(message.CMD_GETDATA, &message.Inv{Items: wanted}))
+}
+
+// Resolver di getdata: invia gli oggetti richiesti che si hanno
+func (n *Node) handleGetData(pc *peer_conn.PeerConn, m *message.Message) error {
+	var inv message.Inv
+	if err := m.Decode(&inv); err != nil {
+		n.Misbehaving(pc, PENALTY_MALFORMED_MESSAGE, "malformed getdata")
+		return err
+	}
+	if len(inv.Items) > MAX_INV_ITEMS {
+		n.Misbehaving(pc, PENALTY_FLOOD, "getdata too large")
+		return fmt.Errorf("getdata too large")
+	}
+	for _, item := range inv.Items {
+		var err error
+		switch item.Type {
+		case message.INV_TX:
+			if t := n.transaction(item.Hash); t != nil {
+				err = pc.Send(message.New(message.CMD_TX, &message.Tx{Transaction: t}))
+			}
+		case message.INV_BLOCK:
+			if b := n.bc.BlockByHash(item.Hash); b != nil {
+				err = pc.Send(message.New(message.CMD_BLOCK, &message.Block{Block: b}))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resolver di tx: aggiunge la transazione al transaction pool e,
+// se è valida, la annuncia agli altri peer
+func (n *Node) handleTx(pc *peer_conn.PeerConn, m *message.Message) error {
+	var tx message.Tx
+	if err := m.Decode(&tx); err != nil || tx.Transaction == nil || tx.Transaction.Validate() != nil {
+		n.Misbehaving(pc, PENALTY_MALFORMED_MESSAGE, "malformed transaction")
+		return fmt.Errorf("malformed transaction")
+	}
+	t := tx.Transaction
+	hash := TransactionHash(t)
+	pc.MarkKnown(hash)
+	if n.transaction(hash) != nil {
+		return nil
+	}
+	// Le transazioni coinbase le crea solo chi mina il blocco
+	if *t.SenderBlockchainAddress == blockchain.MINING_SENDER {
+		n.Misbehaving(pc, PENALTY_INVALID_TX, "coinbase transaction relayed")
+		return fmt.Errorf("coinbase transaction relayed")
+	}
+	err := n.bc.AddTransactionRequest(t)
+	// Il bilancio, la scadenza, il timeout degli HTLC e l'esito delle
+	// chiamate dei contratti e delle operazioni sui token possono
+	// dipendere da blocchi che il peer ha e noi non ancora, o dal suo
+	// orologio, e due peer possono annunciare spese diverse dello stesso
+	// HTLC, quindi solo una firma o un valore non validi sono colpa del
+	// peer
+	if err == blockchain.ErrInsufficientBalance || err == blockchain.ErrExpired ||
+		err == blockchain.ErrHtlcTimeout || err == blockchain.ErrHtlcPending ||
+		errors.Is(err, blockchain.ErrContractFailed) || errors.Is(err, blockchain.ErrAssetFailed) {
+		return fmt.Errorf("transaction %s: %w", hash, err)
+	}
+	if err != nil {
+		n.Misbehaving(pc, PENALTY_INVALID_TX, err.Error())
+		return fmt.Errorf("invalid transaction %s: %w", hash, err)
+	}
+	n.BroadcastTransaction(t)
+	return nil
+}
+
+// Resolver di block: il blocco può essere parte di una
+// sincronizzazione in corso oppure un nuovo blocco annunciato
+func (n *Node) handleBlock(pc *peer_conn.PeerConn, m *message.Message) error {
+	var msg message.Block
+	if err := m.Decode(&msg); err != nil || msg.Block == nil {
+		n.Misbehaving(pc, PENALTY_MALFORMED_MESSAGE, "malformed block")
+		return fmt.Errorf("malformed block")
+	}
+	b := msg.Block
+	hash := blockchain.BlockHash(b)
+	pc.MarkKnown(hash)
+	if n.syncBlock(pc, hash, b) {
+		return nil
+	}
+	if n.bc.BlockByHash(hash) != nil {
+		return nil
+	}
+	switch err := n.bc.AddBlock(b); err {
+	case nil:
+		n.BroadcastBlock(b)
+		return nil
+	case blockchain.ErrOrphanBlock:
+		// Il peer ha una catena diversa, si sincronizza da lui
+		n.requestHeaders(pc)
+		return nil
+	default:
+		n.Misbehaving(pc, PENALTY_INVALID_BLOCK, "invalid block")
+		return err
+	}
+}
+
+// Resolver di getheaders: risponde con gli header che seguono
+// il primo blocco del locator che si trova nella catena locale
+func (n *Node) handleGetHeaders(pc *peer_conn.PeerConn, m *message.Message) error {
+	var gh message.GetHeaders
+	if err := m.Decode(&gh); err != nil || len(gh.Locator) > MAX_HEADERS {
+		n.Misbehaving(pc, PENALTY_MALFORMED_MESSAGE, "malformed getheaders")
+		return fmt.Errorf("malformed getheaders")
+	}
+	if !n.allowRequest(pc) {
+		return fmt.Errorf("rate limited")
+	}
+	start, blocks := n.bc.BlocksAfter(gh.Locator, MAX_HEADERS)
+	headers := make([]message.Header, len(blocks))
+	for i, b := range blocks {
+		headers[i] = message.Header{
+			Height:       start + i,
+			Hash:         blockchain.BlockHash(b),
+			PreviousHash: fmt.Sprintf("%x", b.PreviousHash),
+			Timestamp:    b.Timestamp,
+			Nonce:        b.Nonce,
+		}
+	}
+	return pc.Send(message.New(message.CMD_HEADERS, &message.Headers{Headers: headers}))
+}
+
+// Metodo che limita le richieste costose di un peer, contate per
+// host e per node id, chi supera il limite viene penalizzato
+func (n *Node) allowRequest(pc *peer_conn.PeerConn) bool {
+	allowed := true
+	for _, key := range connKeys(pc) {
+		if !n.limiter.Allow(key, n.clock.Now()) {
+			allowed = false
+		}
+	}
+	if allowed {
+		return true
+	}
+	n.Misbehaving(pc, PENALTY_FLOOD, "request flood")
+	return false
+}
+
+// Metodo per annunciare una transazione ai peer, implementa
+// blockchain.Network
+func (n *Node) BroadcastTransaction(t *transaction_request.TransactionRequest) {
+	hash := TransactionHash(t)
+	n.rememberTransaction(hash, t)
+	n.announce(handshake.FEATURE_TX_RELAY, message.InvItem{Type: message.INV_TX, Hash: hash})
+}
+
+// Metodo per annunciare un blocco ai peer, implementa
+// blockchain.Network
+// Viene chiamato mentre la blockchain è bloccata dal mining,
+// quindi non deve usare metodi della blockchain
+func (n *Node) BroadcastBlock(b *block.Block) {
+	n.announce(handshake.FEATURE_BLOCK_RELAY, message.InvItem{Type: message.INV_BLOCK, Hash: blockchain.BlockHash(b)})
+}
+
+// Metodo che invia l'inv ai peer con la funzionalità che non
+// conoscono già l'oggetto, senza aspettare i peer lenti
+func (n *Node) announce(feature string, item message.InvItem) {
+	m := message.New(message.CMD_INV, &message.Inv{Items: []message.InvItem{item}})
+	for _, pc := range n.connections() {
+		if !pc.HasFeature(feature) || !pc.MarkKnown(item.Hash) {
+			continue
+		}
+		if err := pc.TrySend(m); err != nil {
+			log.Printf("ERROR: announcing %s to %s: %v", item.Hash, pc.Address, err)
+		}
+	}
+}
+
+// Funzione che calcola l'hash con cui una transazione viene annunciata
+func TransactionHash(t *transaction_request.TransactionRequest) string {
+	m, _ := json.Marshal(t)
+	return fmt.Sprintf("%x", sha256.Sum256(m))
+}
+
+// Metodo che ricorda una transazione per rispondere ai getdata,
+// le più vecchie vengono dimenticate
+func (n *Node) rememberTransaction(hash string, t *transaction_request.TransactionRequest) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if _, ok := n.txs[hash]; ok {
+		return
+	}
+	n.txs[hash] = t
+	n.txOrder = append(n.txOrder, hash)
+	if len(n.txOrder) > TX_CACHE_SIZE {
+		delete(n.txs, n.txOrder[0])
+		n.txOrder = n.txOrder[1:]
+	}
+}
+
+// Metodo che ritorna una transazione recente, nil se non c'è
+func (n *Node) transaction(hash string) *transaction_request.TransactionRequest {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return n.txs[hash]
+}
@@ -0,0 +1,183 @@
+package node
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/message"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/handshake"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/node_key"
+)
+
+// L'handshake avviene prima di avviare la connessione, con i messaggi
+// letti e scritti direttamente:
+//
+//	chi si connette            chi accetta
+//	version(nonce A)    --->
+//	                    <---   version(nonce B)
+//	                    <---   verack(firma di A)
+//	verack(firma di B)  --->
+//
+// Ogni nodo firma il nonce dell'altro con la chiave annunciata nel
+// version, così dimostra di possederla
+
+// Metodo per l'handshake dal lato di chi si connette
+func (n *Node) initiateHandshake(conn net.Conn) (remote *handshake.Handshake, features []string, incompatible bool, err error) {
+	conn.SetDeadline(n.clock.Now().Add(HANDSHAKE_TIMEOUT_SEC * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	local := n.Handshake()
+	nonce := newNonce()
+	if err := message.Write(conn, n.magic, message.New(message.CMD_VERSION, &message.Version{Handshake: local, Nonce: nonce})); err != nil {
+		return nil, nil, false, err
+	}
+	version, err := n.readVersion(conn)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	remote = version.Handshake
+	if err := local.Check(remote); err != nil {
+		return nil, nil, true, err
+	}
+	if err := n.readVerack(conn, remote, nonce); err != nil {
+		return nil, nil, true, err
+	}
+	if err := n.writeVerack(conn, version.Nonce); err != nil {
+		return nil, nil, false, err
+	}
+	return remote, local.Negotiate(remote), false, nil
+}
+
+// Metodo per l'handshake dal lato di chi accetta la connessione
+func (n *Node) acceptHandshake(conn net.Conn) (*handshake.Handshake, []string, error) {
+	conn.SetDeadline(n.clock.Now().Add(HANDSHAKE_TIMEOUT_SEC * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	version, err := n.readVersion(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	remote := version.Handshake
+	if remote.Address == "" {
+		return nil, nil, fmt.Errorf("missing address")
+	}
+	if n.IsBanned(remoteHost(conn), remote.NodeID) {
+		return nil, nil, fmt.Errorf("peer %s is banned", remote.Address)
+	}
+	ctx, cancel := context.WithTimeout(n.ctx, HANDSHAKE_TIMEOUT_SEC*time.Second)
+	defer cancel()
+	if err := checkRemoteHost(ctx, conn, remote.Address); err != nil {
+		return nil, nil, err
+	}
+	local := n.Handshake()
+	if err := local.Check(remote); err != nil {
+		return nil, nil, err
+	}
+
+	nonce := newNonce()
+	if err := message.Write(conn, n.magic, message.New(message.CMD_VERSION, &message.Version{Handshake: local, Nonce: nonce})); err != nil {
+		return nil, nil, err
+	}
+	if err := n.writeVerack(conn, version.Nonce); err != nil {
+		return nil, nil, err
+	}
+	if err := n.readVerack(conn, remote, nonce); err != nil {
+		return nil, nil, err
+	}
+	return remote, local.Negotiate(remote), nil
+}
+
+// Metodo per leggere il version del peer
+func (n *Node) readVersion(conn net.Conn) (*message.Version, error) {
+	m, err := message.Read(conn, n.magic)
+	if err != nil {
+		return nil, err
+	}
+	if m.Command != message.CMD_VERSION {
+		return nil, fmt.Errorf("expected %s, got %s", message.CMD_VERSION, m.Command)
+	}
+	var v message.Version
+	if err := m.Decode(&v); err != nil {
+		return nil, err
+	}
+	if v.Handshake == nil || v.Nonce == "" {
+		return nil, fmt.Errorf("malformed version")
+	}
+	return &v, nil
+}
+
+// Metodo per firmare il nonce del peer e inviarglielo
+func (n *Node) writeVerack(conn net.Conn, remoteNonce string) error {
+	signature := n.key.Sign(verackDigest(n.config.ChainID, remoteNonce, n.NodeID()))
+	return message.Write(conn, n.magic, message.New(message.CMD_VERACK, &message.Verack{Signature: signature}))
+}
+
+// Metodo per leggere il verack del peer e verificarne la firma
+func (n *Node) readVerack(conn net.Conn, remote *handshake.Handshake, nonce string) error {
+	m, err := message.Read(conn, n.magic)
+	if err != nil {
+		return err
+	}
+	if m.Command != message.CMD_VERACK {
+		return fmt.Errorf("expected %s, got %s", message.CMD_VERACK, m.Command)
+	}
+	var v message.Verack
+	if err := m.Decode(&v); err != nil {
+		return err
+	}
+	if !node_key.Verify(remote.PublicKey, verackDigest(n.config.ChainID, nonce, remote.NodeID), v.Signature) {
+		return fmt.Errorf("invalid verack signature")
+	}
+	return nil
+}
+
+// Funzione che calcola il digest firmato nel verack: la firma vale
+// solo per questa rete, questo nonce e il nodo che firma
+func verackDigest(chainID string, nonce string, nodeID string) []byte {
+	h := sha256.Sum256([]byte(chainID + "|" + nonce + "|" + nodeID))
+	return h[:]
+}
+
+// Funzione che ritorna l'host da cui arriva davvero una connessione
+func remoteHost(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// Funzione che controlla che l'indirizzo annunciato da un peer in
+// ingresso sia sullo stesso host da cui arriva la connessione, così
+// un nodo non può farsi passare per un altro
+// Un nome host annunciato deve risolversi nell'IP della connessione
+func checkRemoteHost(ctx context.Context, conn net.Conn, address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %q", address)
+	}
+	remote := remoteHost(conn)
+	remoteIP := net.ParseIP(remote)
+	// Nella rete simulata gli host sono nomi, senza DNS
+	if remoteIP == nil {
+		if host != remote {
+			return fmt.Errorf("address %s does not match remote host %s", address, remote)
+		}
+		return nil
+	}
+	announced := []net.IP{net.ParseIP(host)}
+	if announced[0] == nil {
+		if announced, err = net.DefaultResolver.LookupIP(ctx, "ip", host); err != nil {
+			return fmt.Errorf("resolving %s: %v", host, err)
+		}
+	}
+	for _, ip := range announced {
+		if ip.Equal(remoteIP) || (ip.IsLoopback() && remoteIP.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("address %s does not match remote host %s", address, remote)
+}
@@ -0,0 +1,452 @@
+package node
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+	"github.com/iltommi1995/blockchain-go/pkg/events"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/message"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/peer_conn"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/transport"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/handshake"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/node_key"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/peer"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/peer_store"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/rate_limiter"
+)
+
+// Nodo della rete p2p: ascolta le connessioni degli altri nodi,
+// mantiene le connessioni in uscita verso i peer dell'address book
+// e scambia con loro transazioni e blocchi
+type Node struct {
+	bc        *blockchain.Blockchain
+	config    Config
+	transport transport.Transport
+	clock     clock.Clock
+	magic     [4]byte
+
+	key      *node_key.NodeKey
+	store    *peer_store.PeerStore
+	limiter  *rate_limiter.RateLimiter
+	listener net.Listener
+
+	// Connessioni attive, per node id
+	conns map[string]*peer_conn.PeerConn
+	// Connessioni con l'handshake in corso, chiuse da Stop
+	pending map[net.Conn]bool
+	// Indirizzi dei peer a cui ci si sta connettendo
+	dialing map[string]bool
+	// Sincronizzazioni della catena in corso, per node id
+	syncs map[string]*chainSync
+	// Transazioni recenti, per rispondere ai getdata
+	txs     map[string]*transaction_request.TransactionRequest
+	txOrder []string
+	mux     sync.Mutex
+
+	// Contesto dei servizi in background del nodo, viene cancellato
+	// da Stop o quando si chiude il contesto passato a Start
+	ctx    context.Context
+	cancel context.CancelFunc
+	loops  sync.WaitGroup
+	once   sync.Once
+	// Preso dalla discovery in corso, Stop lo aspetta
+	discoveryMux sync.Mutex
+}
+
+// Funzione per creare il nodo e collegarlo alla blockchain, così
+// le nuove transazioni e i nuovi blocchi vengono annunciati ai peer
+func NewNode(bc *blockchain.Blockchain, config Config, t transport.Transport) *Node {
+	if config.ChainID == "" {
+		config.ChainID = bc.ChainID()
+	}
+	config = config.withDefaults()
+	if t == nil {
+		t = &transport.TCPTransport{}
+	}
+	n := &Node{
+		bc:        bc,
+		config:    config,
+		transport: t,
+		clock:     config.Clock,
+		magic:     message.Magic(config.ChainID),
+		key:       node_key.NewNodeKey(),
+		store:     peer_store.NewPeerStore(config.AddressBookPath),
+		limiter:   rate_limiter.NewRateLimiter(REQUEST_RATE_LIMIT, REQUEST_RATE_WINDOW_SEC*time.Second),
+		conns:     make(map[string]*peer_conn.PeerConn),
+		pending:   make(map[net.Conn]bool),
+		dialing:   make(map[string]bool),
+		syncs:     make(map[string]*chainSync),
+		txs:       make(map[string]*transaction_request.TransactionRequest),
+	}
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+	bc.SetNetwork(n)
+	return n
+}
+
+// Metodo per avviare il nodo: carica chiave e address book,
+// si mette in ascolto e avvia la discovery
+// Il nodo si ferma quando ctx viene cancellato o con Stop
+func (n *Node) Start(ctx context.Context) error {
+	if n.config.NodeKeyPath != "" {
+		nk, err := node_key.LoadOrCreateNodeKey(n.config.NodeKeyPath)
+		if err != nil {
+			return fmt.Errorf("loading node key: %w", err)
+		}
+		n.key = nk
+	}
+	if err := n.store.Load(); err != nil {
+		log.Printf("ERROR: loading address book: %v", err)
+	}
+	for _, s := range n.config.Seeds {
+		n.store.Add(s, peer.SOURCE_SEED)
+	}
+
+	listener, err := n.transport.Listen(n.Address())
+	if err != nil {
+		return err
+	}
+	n.listener = listener
+	if n.config.Port == 0 {
+		_, port, _ := net.SplitHostPort(listener.Addr().String())
+		p, _ := strconv.Atoi(port)
+		n.config.Port = uint16(p)
+	}
+	log.Printf("P2P node %s listening on %s", n.NodeID(), n.Address())
+
+	n.mux.Lock()
+	n.ctx, n.cancel = context.WithCancel(ctx)
+	n.mux.Unlock()
+	n.loops.Add(1)
+	go n.acceptLoop()
+	n.clock.AfterFunc(0, n.discover)
+	go func() {
+		<-n.ctx.Done()
+		n.Stop()
+	}()
+	return nil
+}
+
+// Metodo per fermare il nodo: chiude il listener e le connessioni,
+// aspetta che la discovery finisca e salva l'address book
+func (n *Node) Stop() {
+	n.once.Do(func() {
+		n.cancel()
+		if n.listener != nil {
+			n.listener.Close()
+		}
+		n.mux.Lock()
+		for conn := range n.pending {
+			conn.Close()
+		}
+		n.mux.Unlock()
+		n.loops.Wait()
+		n.discoveryMux.Lock()
+		n.discoveryMux.Unlock()
+		for _, pc := range n.connections() {
+			pc.Close()
+		}
+		if err := n.store.Save(); err != nil {
+			log.Printf("ERROR: saving address book: %v", err)
+		}
+		log.Printf("P2P node %s stopped", n.NodeID())
+	})
+}
+
+// Indirizzo con cui il nodo si annuncia agli altri
+func (n *Node) Address() string {
+	return net.JoinHostPort(n.config.Host, strconv.Itoa(int(n.config.Port)))
+}
+
+// Getter dell'identificativo del nodo
+func (n *Node) NodeID() string {
+	return n.key.NodeID()
+}
+
+// Getter dell'address book
+func (n *Node) PeerStore() *peer_store.PeerStore {
+	return n.store
+}
+
+// Metodo che ritorna l'handshake del nodo locale
+func (n *Node) Handshake() *handshake.Handshake {
+	return &handshake.Handshake{
+		ProtocolVersion: handshake.PROTOCOL_VERSION,
+		NodeID:          n.key.NodeID(),
+		PublicKey:       n.key.PublicKeyStr(),
+		ChainID:         n.config.ChainID,
+		GenesisHash:     n.bc.GenesisHash(),
+		BestHeight:      n.bc.Height(),
+		Features:        handshake.SUPPORTED_FEATURES,
+		Address:         n.Address(),
+	}
+}
+
+// Goroutine che accetta le connessioni in ingresso
+func (n *Node) acceptLoop() {
+	defer n.loops.Done()
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			if n.ctx.Err() != nil {
+				return
+			}
+			log.Printf("ERROR: accepting connection: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go n.handleInbound(conn)
+	}
+}
+
+// Metodo per ricordare una connessione con l'handshake in corso,
+// ritorna false se il nodo si sta fermando
+func (n *Node) track(conn net.Conn) bool {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if n.ctx.Err() != nil {
+		return false
+	}
+	n.pending[conn] = true
+	return true
+}
+
+// Metodo per dimenticare una connessione a handshake concluso
+func (n *Node) untrack(conn net.Conn) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	delete(n.pending, conn)
+}
+
+// Metodo che gestisce una connessione in ingresso
+func (n *Node) handleInbound(conn net.Conn) {
+	if n.InboundCount() >= n.config.MaxInbound {
+		log.Printf("Inbound connection from %s refused, too many peers", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+	if !n.track(conn) {
+		conn.Close()
+		return
+	}
+	remote, features, err := n.acceptHandshake(conn)
+	n.untrack(conn)
+	if err != nil {
+		log.Printf("ERROR: handshake from %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	address := remote.Address
+	n.store.Add(address, peer.SOURCE_INBOUND)
+	n.store.SetInbound(address, true)
+	n.register(conn, remote, address, true, features)
+}
+
+// Metodo per connettersi a un peer e fare l'handshake
+// Ritorna un errore di rete o, se il peer non è compatibile,
+// incompatible a true
+func (n *Node) Connect(address string) (incompatible bool, err error) {
+	conn, err := n.dial(address)
+	if err != nil {
+		return false, err
+	}
+	return n.handshake(conn, address)
+}
+
+// Metodo per connettersi a un peer senza aspettare l'handshake, che
+// continua in background e alla fine chiama done con il risultato
+// di Connect. Ritorna subito l'errore se la connessione non si apre
+func (n *Node) ConnectAsync(address string, done func(incompatible bool, err error)) error {
+	conn, err := n.dial(address)
+	if err != nil {
+		return err
+	}
+	go func() {
+		done(n.handshake(conn, address))
+	}()
+	return nil
+}
+
+// Metodo che apre la connessione con un peer e la ricorda finché
+// l'handshake non è concluso
+func (n *Node) dial(address string) (net.Conn, error) {
+	conn, err := n.transport.Dial(address, DIAL_TIMEOUT_SEC*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if !n.track(conn) {
+		conn.Close()
+		return nil, net.ErrClosed
+	}
+	n.mux.Lock()
+	n.dialing[address] = true
+	n.mux.Unlock()
+	return conn, nil
+}
+
+// Metodo che fa l'handshake su una connessione aperta da dial e la
+// registra
+func (n *Node) handshake(conn net.Conn, address string) (incompatible bool, err error) {
+	remote, features, incompatible, err := n.initiateHandshake(conn)
+	n.untrack(conn)
+	defer func() {
+		n.mux.Lock()
+		delete(n.dialing, address)
+		n.mux.Unlock()
+	}()
+	if err != nil {
+		conn.Close()
+		return incompatible, err
+	}
+	if n.IsBanned(remoteHost(conn), remote.NodeID) {
+		conn.Close()
+		return false, fmt.Errorf("peer %s is banned", address)
+	}
+	if !n.register(conn, remote, address, false, features) {
+		return false, fmt.Errorf("already connected to %s", remote.NodeID)
+	}
+	return false, nil
+}
+
+// Metodo che registra una connessione dopo l'handshake e la avvia
+// Se col peer c'è già una connessione ne resta una sola: quella
+// aperta dal nodo con l'id minore, così entrambi i nodi scelgono
+// la stessa. Ritorna false se la nuova connessione è stata scartata
+func (n *Node) register(conn net.Conn, remote *handshake.Handshake, address string, inbound bool, features []string) bool {
+	pc := peer_conn.NewPeerConn(conn, n.magic, address, remote.NodeID, inbound, features, n.clock)
+
+	n.mux.Lock()
+	if n.ctx.Err() != nil {
+		n.mux.Unlock()
+		conn.Close()
+		return false
+	}
+	if old, ok := n.conns[remote.NodeID]; ok {
+		if n.dialer(old) < n.dialer(pc) {
+			n.mux.Unlock()
+			conn.Close()
+			return false
+		}
+		delete(n.conns, remote.NodeID)
+		defer old.Close()
+	}
+	n.conns[remote.NodeID] = pc
+	n.mux.Unlock()
+
+	n.store.MarkSeen(address, peer.SOURCE_INBOUND, n.clock.Now())
+	n.store.SetHandshake(address, remote.NodeID, remote.PublicKey, remote.ProtocolVersion, remote.BestHeight, features)
+	log.Printf("Connected to peer %s (%s), inbound %v", address, remote.NodeID, inbound)
+	n.publishPeer(events.PEER_CONNECTED, pc)
+
+	// I primi messaggi vengono accodati prima di avviare la
+	// connessione, così partono sempre prima delle risposte
+	if pc.HasFeature(handshake.FEATURE_PEER_EXCHANGE) {
+		pc.Send(message.New(message.CMD_GETADDR, struct{}{}))
+	}
+	if remote.BestHeight > n.bc.Height() {
+		n.requestHeaders(pc)
+	}
+	pc.Start(n)
+	return true
+}
+
+// Metodo che pubblica la connessione o disconnessione di un peer
+// sul bus degli eventi della blockchain
+func (n *Node) publishPeer(eventType string, pc *peer_conn.PeerConn) {
+	n.bc.Events().Publish(&events.Event{
+		Type: eventType,
+		Time: n.clock.Now().UnixNano(),
+		Data: map[string]interface{}{
+			"address": pc.Address,
+			"node_id": pc.NodeID,
+			"inbound": pc.Inbound,
+		},
+	})
+}
+
+// Metodo che ritorna l'id del nodo che ha aperto la connessione
+func (n *Node) dialer(pc *peer_conn.PeerConn) string {
+	if pc.Inbound {
+		return pc.NodeID
+	}
+	return n.NodeID()
+}
+
+// Metodo che ritorna una copia delle connessioni attive
+func (n *Node) connections() []*peer_conn.PeerConn {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	conns := make([]*peer_conn.PeerConn, 0, len(n.conns))
+	for _, pc := range n.conns {
+		conns = append(conns, pc)
+	}
+	return conns
+}
+
+// Metodo che ritorna il numero di connessioni in ingresso
+func (n *Node) InboundCount() int {
+	count := 0
+	for _, pc := range n.connections() {
+		if pc.Inbound {
+			count += 1
+		}
+	}
+	return count
+}
+
+// Metodo che ritorna il numero di connessioni in uscita
+func (n *Node) OutboundCount() int {
+	return len(n.connections()) - n.InboundCount()
+}
+
+// Metodo che ritorna il numero di connessioni in uscita con
+// l'handshake in corso
+func (n *Node) DialingCount() int {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return len(n.dialing)
+}
+
+// Metodo che dice se il nodo ha del lavoro in corso sulle connessioni,
+// messaggi da scrivere o chiusure non concluse
+func (n *Node) Busy() bool {
+	for _, pc := range n.connections() {
+		if pc.Busy() {
+			return true
+		}
+	}
+	return false
+}
+
+// Metodo che dice se il nodo è connesso al peer con questo indirizzo
+// o sta facendo l'handshake con lui
+func (n *Node) IsConnected(address string) bool {
+	n.mux.Lock()
+	dialing := n.dialing[address]
+	n.mux.Unlock()
+	if dialing {
+		return true
+	}
+	for _, pc := range n.connections() {
+		if pc.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Funzione che genera il nonce da far firmare al peer
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,76 @@
+package node
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+)
+
+// I log dei nodi si vedono solo con -v
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// Funzione che avvia un nodo in ascolto su una porta libera, con la
+// blockchain della rete chainID e il nodo sulla rete nodeChainID
+// Il nodo si ferma a fine test
+func startNode(t *testing.T, chainID string, nodeChainID string) *Node {
+	t.Helper()
+	bc := blockchain.NewBlockchain(wallet.NewWallet().BlockchainAddress(), 0, chainID)
+	n := NewNode(bc, Config{Host: "127.0.0.1", ChainID: nodeChainID}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := n.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		n.Stop()
+	})
+	return n
+}
+
+// I nodi di reti diverse hanno genesis diversi e non si connettono,
+// in nessuna delle due direzioni, quelli della stessa rete sì
+func TestNetworksRejectEachOther(t *testing.T) {
+	a := startNode(t, "net-a", "")
+	b := startNode(t, "net-b", "")
+	if a.Handshake().GenesisHash == b.Handshake().GenesisHash {
+		t.Fatal("different networks share the genesis")
+	}
+	if _, err := a.Connect(b.Address()); err == nil {
+		t.Fatal("a node of net-a connected to net-b")
+	}
+	if _, err := b.Connect(a.Address()); err == nil {
+		t.Fatal("a node of net-b connected to net-a")
+	}
+	if len(a.ConnectedPeers()) != 0 || len(b.ConnectedPeers()) != 0 {
+		t.Fatalf("connected peers %v and %v", a.ConnectedPeers(), b.ConnectedPeers())
+	}
+
+	// Con lo stesso chain ID ma un altro genesis l'handshake fallisce
+	forged := startNode(t, "net-b", "net-a")
+	if err := forged.Handshake().Check(a.Handshake()); err == nil {
+		t.Fatal("the handshake accepts a peer with another genesis")
+	}
+	if _, err := forged.Connect(a.Address()); err == nil {
+		t.Fatal("a node with another genesis connected to net-a")
+	}
+	if _, err := a.Connect(forged.Address()); err == nil {
+		t.Fatal("net-a connected to a node with another genesis")
+	}
+
+	peer := startNode(t, "net-a", "")
+	if _, err := peer.Connect(a.Address()); err != nil {
+		t.Fatal(err)
+	}
+}
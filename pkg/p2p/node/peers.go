@@ -0,0 +1,171 @@
+package node
+
+import (
+	"log"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/peer_conn"
+	"github.com/iltommi1995/blockchain-go/pkg/peer/peer"
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+)
+
+// Timer che periodicamente cerca nuovi peer, fino allo stop del nodo
+func (n *Node) discover() {
+	n.discoveryMux.Lock()
+	defer n.discoveryMux.Unlock()
+	if n.ctx.Err() != nil {
+		return
+	}
+	n.Discover()
+	n.clock.AfterFunc(DISCOVERY_INTERVAL_SEC*time.Second, n.discover)
+}
+
+// Metodo che ricalcola i vicini: prova i peer conosciuti dal più
+// recente al meno recente fino ad avere MaxOutbound connessioni in
+// uscita, e infine elimina i peer morti
+// Gli handshake continuano in background, le connessioni in corso
+// contano già per MaxOutbound
+func (n *Node) Discover() {
+	if n.config.LanDiscovery {
+		for _, a := range utils.FindNeighbors(
+			n.config.Host,
+			n.config.Port,
+			NEIGHBOR_IP_RANGE_START,
+			NEIGHBOR_IP_RANGE_END,
+			P2P_PORT_RANGE_START,
+			P2P_PORT_RANGE_END,
+		) {
+			n.store.Add(a, peer.SOURCE_LAN)
+		}
+	}
+
+	me := n.Address()
+	for _, p := range n.store.Peers() {
+		if n.OutboundCount()+n.DialingCount() >= n.config.MaxOutbound || n.ctx.Err() != nil {
+			break
+		}
+		if p.Address == me {
+			n.store.Remove(p.Address)
+			continue
+		}
+		if n.store.IsBanned(p.Keys(), n.clock.Now()) || n.IsConnected(p.Address) {
+			continue
+		}
+		address := p.Address
+		err := n.ConnectAsync(address, func(incompatible bool, err error) {
+			n.connected(address, incompatible, err)
+		})
+		if err != nil {
+			n.connected(address, false, err)
+		}
+	}
+
+	keep := make(map[string]bool)
+	for _, s := range n.config.Seeds {
+		keep[s] = true
+	}
+	removed := n.store.Prune(n.clock.Now(), PEER_PRUNE_AFTER_SEC*time.Second, PEER_MAX_FAILURES, keep)
+	if len(removed) > 0 {
+		log.Printf("Pruned dead peers %v", removed)
+	}
+	if err := n.store.Save(); err != nil {
+		log.Printf("ERROR: saving address book: %v", err)
+	}
+}
+
+// Metodo che aggiorna l'address book con il risultato di una
+// connessione della discovery
+func (n *Node) connected(address string, incompatible bool, err error) {
+	if incompatible {
+		log.Printf("ERROR: rejected peer %s: %v", address, err)
+		n.store.Remove(address)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: connecting to %s: %v", address, err)
+		n.store.MarkFailed(address, n.clock.Now())
+	}
+}
+
+// Metodo per aggiungere all'address book gli indirizzi ricevuti
+func (n *Node) addPeers(addresses []string) {
+	me := n.Address()
+	for _, a := range addresses {
+		if a != me {
+			n.store.Add(a, peer.SOURCE_EXCHANGE)
+		}
+	}
+}
+
+// Metodo che ritorna gli indirizzi da condividere con gli altri nodi
+func (n *Node) KnownPeers() []string {
+	return n.store.Addresses(PEER_EXCHANGE_LIMIT, n.clock.Now())
+}
+
+// Metodo che ritorna gli indirizzi dei peer connessi
+func (n *Node) ConnectedPeers() []string {
+	addresses := make([]string, 0)
+	for _, pc := range n.connections() {
+		addresses = append(addresses, pc.Address)
+	}
+	return addresses
+}
+
+// Funzione che ritorna le chiavi della reputazione del peer di una
+// connessione: l'host da cui si connette davvero e il suo node id,
+// non l'indirizzo che annuncia
+func connKeys(pc *peer_conn.PeerConn) []string {
+	return peer.Keys(pc.Host, pc.NodeID)
+}
+
+// Metodo per registrare una violazione del protocollo da parte di
+// un peer, se il punteggio del suo host o del suo node id arriva a
+// zero il peer viene bannato e vengono chiuse tutte le connessioni
+// da quell'host o con quel node id
+func (n *Node) Misbehaving(pc *peer_conn.PeerConn, points int, reason string) {
+	log.Printf("ERROR: peer %s misbehaving (-%d): %s", pc.Address, points, reason)
+	if !n.store.Penalize(connKeys(pc), pc.Address, points, reason, n.clock.Now(), PEER_BAN_DURATION_SEC*time.Second) {
+		return
+	}
+	log.Printf("Peer %s banned: %s", pc.Address, reason)
+	for _, c := range n.connections() {
+		if n.store.IsBanned(connKeys(c), n.clock.Now()) {
+			c.Close()
+		}
+	}
+	if err := n.store.Save(); err != nil {
+		log.Printf("ERROR: saving address book: %v", err)
+	}
+}
+
+// Metodo che dice se è bannato l'host da cui arriva una connessione
+// o il node id del peer
+func (n *Node) IsBanned(host string, nodeID string) bool {
+	return n.store.IsBanned(peer.Keys(host, nodeID), n.clock.Now())
+}
+
+// Metodo che ritorna gli host e i node id bannati
+func (n *Node) Bans() []*peer.Reputation {
+	return n.store.Bans(n.clock.Now())
+}
+
+// Metodo per togliere il ban a una chiave, "host:..." o "node:...",
+// o a quelle dell'ultimo indirizzo annunciato, o a tutti se vuoto
+// Ritorna il numero di ban tolti
+func (n *Node) Unban(keyOrAddress string) int {
+	var count int
+	if keyOrAddress == "" {
+		count = n.store.UnbanAll(n.clock.Now())
+	} else {
+		count = n.store.Unban(keyOrAddress, n.clock.Now())
+	}
+	if err := n.store.Save(); err != nil {
+		log.Printf("ERROR: saving address book: %v", err)
+	}
+	return count
+}
+
+// Metodo che ritorna una copia dei peer dell'address book
+func (n *Node) Peers() []*peer.Peer {
+	return n.store.Peers()
+}
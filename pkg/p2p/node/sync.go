@@ -0,0 +1,167 @@
+package node
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/message"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/peer_conn"
+)
+
+// Sincronizzazione della catena con un peer che ne ha una più lunga:
+// si chiedono gli header a partire dal punto di biforcazione, poi i
+// blocchi, e quando sono arrivati tutti si prova a sostituire la catena
+type chainSync struct {
+	// Altezza dell'ultimo blocco in comune con il peer
+	forkHeight int
+	// Hash dei blocchi richiesti, in ordine
+	pending []string
+	// Blocchi ricevuti del batch corrente
+	received map[string]*block.Block
+	// Blocchi dei batch precedenti, già collegati tra loro
+	blocks []*block.Block
+}
+
+// Metodo per chiedere gli header a un peer, a partire dal locator
+// della catena locale, un'eventuale sincronizzazione rimasta a
+// metà con il peer riparte da capo
+func (n *Node) requestHeaders(pc *peer_conn.PeerConn) {
+	n.dropSync(pc)
+	n.requestHeadersFrom(pc, n.bc.Locator())
+}
+
+// Metodo per chiedere gli header a un peer a partire da un locator
+func (n *Node) requestHeadersFrom(pc *peer_conn.PeerConn, locator []string) {
+	if err := pc.Send(message.New(message.CMD_GETHEADERS, &message.GetHeaders{Locator: locator})); err != nil {
+		log.Printf("ERROR: requesting headers from %s: %v", pc.Address, err)
+	}
+}
+
+// Resolver di headers: controlla che gli header siano collegati tra
+// loro e alla catena locale e chiede i blocchi corrispondenti
+func (n *Node) handleHeaders(pc *peer_conn.PeerConn, m *message.Message) error {
+	var msg message.Headers
+	if err := m.Decode(&msg); err != nil || len(msg.Headers) > MAX_HEADERS {
+		n.Misbehaving(pc, PENALTY_MALFORMED_MESSAGE, "malformed headers")
+		return fmt.Errorf("malformed headers")
+	}
+
+	n.mux.Lock()
+	s, ok := n.syncs[pc.NodeID]
+	n.mux.Unlock()
+
+	if len(msg.Headers) == 0 {
+		// Il peer non ha altri blocchi dopo un batch pieno
+		if ok && len(s.pending) == 0 {
+			n.finishSync(pc, s)
+		}
+		return nil
+	}
+
+	first := msg.Headers[0]
+	previous := first.PreviousHash
+	if !ok {
+		// Il primo header deve seguire un blocco della catena locale
+		if first.Height < 1 || n.bc.BlockByHash(first.PreviousHash) == nil {
+			n.Misbehaving(pc, PENALTY_INVALID_CHAIN, "headers do not connect")
+			return fmt.Errorf("headers do not connect")
+		}
+		s = &chainSync{forkHeight: first.Height - 1, blocks: make([]*block.Block, 0)}
+	} else if len(s.pending) > 0 {
+		return fmt.Errorf("headers received while downloading blocks")
+	} else {
+		previous = blockchain.BlockHash(s.blocks[len(s.blocks)-1])
+	}
+
+	zeros := strings.Repeat("0", blockchain.MINING_DIFFICULTY)
+	height := s.forkHeight + len(s.blocks) + 1
+	pending := make([]string, 0, len(msg.Headers))
+	for i, h := range msg.Headers {
+		if h.Height != height+i || h.PreviousHash != previous || !strings.HasPrefix(h.Hash, zeros) {
+			n.Misbehaving(pc, PENALTY_INVALID_CHAIN, "invalid headers")
+			n.dropSync(pc)
+			return fmt.Errorf("invalid header at height %d", h.Height)
+		}
+		previous = h.Hash
+		pending = append(pending, h.Hash)
+	}
+
+	s.pending = pending
+	s.received = make(map[string]*block.Block)
+	n.mux.Lock()
+	n.syncs[pc.NodeID] = s
+	n.mux.Unlock()
+
+	items := make([]message.InvItem, len(pending))
+	for i, hash := range pending {
+		items[i] = message.InvItem{Type: message.INV_BLOCK, Hash: hash}
+	}
+	return pc.Send(message.New(message.CMD_GETDATA, &message.Inv{Items: items}))
+}
+
+// Metodo che gestisce un blocco ricevuto durante una sincronizzazione
+// Ritorna false se il blocco non era stato richiesto per la sincronizzazione
+func (n *Node) syncBlock(pc *peer_conn.PeerConn, hash string, b *block.Block) bool {
+	n.mux.Lock()
+	s, ok := n.syncs[pc.NodeID]
+	n.mux.Unlock()
+	if !ok || !s.isPending(hash) {
+		return false
+	}
+	s.received[hash] = b
+	if len(s.received) < len(s.pending) {
+		return true
+	}
+
+	for _, h := range s.pending {
+		s.blocks = append(s.blocks, s.received[h])
+	}
+	s.pending = nil
+	s.received = nil
+
+	// Se il batch era pieno il peer ha altri blocchi da inviare
+	if len(s.blocks)%MAX_HEADERS == 0 {
+		n.requestHeadersFrom(pc, []string{hash})
+		return true
+	}
+	n.finishSync(pc, s)
+	return true
+}
+
+// Metodo che chiude la sincronizzazione sostituendo la catena locale
+// con quella ricevuta, se è più lunga
+func (n *Node) finishSync(pc *peer_conn.PeerConn, s *chainSync) {
+	n.dropSync(pc)
+	chain := append(n.bc.ChainPrefix(s.forkHeight+1), s.blocks...)
+	replaced, err := n.bc.ReplaceChain(chain)
+	if err != nil {
+		n.Misbehaving(pc, PENALTY_INVALID_CHAIN, err.Error())
+		return
+	}
+	if replaced {
+		n.BroadcastBlock(chain[len(chain)-1])
+	}
+}
+
+// Metodo che dice se il blocco è tra quelli richiesti
+func (s *chainSync) isPending(hash string) bool {
+	if _, ok := s.received[hash]; ok {
+		return false
+	}
+	for _, h := range s.pending {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// Metodo per interrompere la sincronizzazione con un peer
+func (n *Node) dropSync(pc *peer_conn.PeerConn) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	delete(n.syncs, pc.NodeID)
+}
@@ -0,0 +1,278 @@
+package peer_conn
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/message"
+)
+
+const (
+	// Ogni quanto si manda un ping se il peer è silenzioso
+	PING_INTERVAL_SEC = 30
+	// Dopo quanto tempo senza messaggi il peer viene disconnesso
+	IDLE_TIMEOUT_SEC = 3 * PING_INTERVAL_SEC
+	// Tempo massimo per scrivere un messaggio sulla connessione
+	WRITE_TIMEOUT_SEC = 10
+	// Messaggi che possono restare in coda di invio
+	SEND_QUEUE_SIZE = 256
+	// Quanto Send aspetta che si liberi spazio nella coda prima di
+	// considerare il peer troppo lento e disconnetterlo
+	SEND_TIMEOUT_SEC = 5
+)
+
+var (
+	ErrClosed    = errors.New("connection closed")
+	ErrQueueFull = errors.New("send queue full")
+)
+
+// Chi riceve gli eventi di una connessione
+type Handler interface {
+	// Chiamato per ogni messaggio ricevuto, tranne ping e pong
+	HandleMessage(pc *PeerConn, m *message.Message)
+	// Chiamato quando il peer invia un messaggio corrotto
+	HandleProtocolError(pc *PeerConn, err error)
+	// Chiamato una volta quando la connessione si chiude
+	HandleClose(pc *PeerConn)
+}
+
+// Connessione con un peer dopo l'handshake: una goroutine legge i
+// messaggi e li passa all'handler, un'altra scrive i messaggi della
+// coda di invio, i ping tengono viva la connessione
+// Address è l'indirizzo annunciato dal peer, Host quello da cui
+// arriva davvero la connessione
+type PeerConn struct {
+	conn     net.Conn
+	magic    [4]byte
+	Address  string
+	NodeID   string
+	Host     string
+	Inbound  bool
+	Features []string
+
+	send chan *message.Message
+	// Messaggi accodati e non ancora scritti sulla connessione
+	queued int64
+	// Vale 1 mentre la chiusura è in corso
+	closing int32
+	closed  chan struct{}
+	once    sync.Once
+	handler Handler
+	clock   clock.Clock
+
+	// Oggetti che il peer conosce già, per non annunciarglieli di nuovo
+	known    map[string]bool
+	knownMux sync.Mutex
+}
+
+// Funzione per creare la connessione, il peer ha già fatto l'handshake
+func NewPeerConn(conn net.Conn, magic [4]byte, address string, nodeID string, inbound bool, features []string, c clock.Clock) *PeerConn {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		host = conn.RemoteAddr().String()
+	}
+	return &PeerConn{
+		conn:     conn,
+		magic:    magic,
+		Address:  address,
+		NodeID:   nodeID,
+		Host:     host,
+		Inbound:  inbound,
+		Features: features,
+		send:     make(chan *message.Message, SEND_QUEUE_SIZE),
+		closed:   make(chan struct{}),
+		known:    make(map[string]bool),
+		clock:    c,
+	}
+}
+
+// Metodo per avviare le goroutine di lettura e scrittura e il keepalive
+func (pc *PeerConn) Start(handler Handler) {
+	pc.handler = handler
+	go pc.readLoop()
+	go pc.writeLoop()
+	pc.clock.AfterFunc(PING_INTERVAL_SEC*time.Second, pc.keepalive)
+}
+
+// Metodo che dice se la connessione ha del lavoro in corso: messaggi
+// accodati non ancora scritti o la chiusura non ancora conclusa
+func (pc *PeerConn) Busy() bool {
+	if atomic.LoadInt32(&pc.closing) == 1 {
+		return true
+	}
+	select {
+	case <-pc.closed:
+		return false
+	default:
+		return atomic.LoadInt64(&pc.queued) > 0
+	}
+}
+
+// Metodo che dice se la funzionalità è stata negoziata col peer
+func (pc *PeerConn) HasFeature(feature string) bool {
+	for _, f := range pc.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Metodo per accodare un messaggio, se la coda è piena aspetta
+// SEND_TIMEOUT_SEC e poi chiude la connessione con il peer lento
+func (pc *PeerConn) Send(m *message.Message) error {
+	if pc.isClosed() {
+		return ErrClosed
+	}
+	atomic.AddInt64(&pc.queued, 1)
+	select {
+	case pc.send <- m:
+		return nil
+	case <-pc.closed:
+		atomic.AddInt64(&pc.queued, -1)
+		return ErrClosed
+	default:
+	}
+	select {
+	case pc.send <- m:
+		return nil
+	case <-pc.closed:
+		atomic.AddInt64(&pc.queued, -1)
+		return ErrClosed
+	case <-pc.clock.After(SEND_TIMEOUT_SEC * time.Second):
+		atomic.AddInt64(&pc.queued, -1)
+		log.Printf("ERROR: peer %s too slow, disconnecting", pc.Address)
+		pc.Close()
+		return ErrQueueFull
+	}
+}
+
+// Metodo per accodare un messaggio senza aspettare, se la coda
+// è piena il messaggio viene scartato
+func (pc *PeerConn) TrySend(m *message.Message) error {
+	if pc.isClosed() {
+		return ErrClosed
+	}
+	atomic.AddInt64(&pc.queued, 1)
+	select {
+	case pc.send <- m:
+		return nil
+	case <-pc.closed:
+		atomic.AddInt64(&pc.queued, -1)
+		return ErrClosed
+	default:
+		atomic.AddInt64(&pc.queued, -1)
+		return ErrQueueFull
+	}
+}
+
+// Metodo che segna un oggetto come conosciuto dal peer
+// Ritorna false se lo conosceva già
+func (pc *PeerConn) MarkKnown(hash string) bool {
+	pc.knownMux.Lock()
+	defer pc.knownMux.Unlock()
+	if pc.known[hash] {
+		return false
+	}
+	pc.known[hash] = true
+	return true
+}
+
+// Metodo per chiudere la connessione
+func (pc *PeerConn) Close() {
+	pc.once.Do(func() {
+		atomic.StoreInt32(&pc.closing, 1)
+		defer atomic.StoreInt32(&pc.closing, 0)
+		close(pc.closed)
+		pc.conn.Close()
+		if pc.handler != nil {
+			pc.handler.HandleClose(pc)
+		}
+	})
+}
+
+// Metodo che ritorna un canale che si chiude con la connessione
+func (pc *PeerConn) Done() <-chan struct{} {
+	return pc.closed
+}
+
+// Metodo che dice se la connessione è chiusa, Send e TrySend lo
+// controllano prima del select, che sceglie a caso tra i casi pronti
+func (pc *PeerConn) isClosed() bool {
+	select {
+	case <-pc.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Goroutine che legge i messaggi
+func (pc *PeerConn) readLoop() {
+	defer pc.Close()
+	for {
+		pc.conn.SetReadDeadline(pc.clock.Now().Add(IDLE_TIMEOUT_SEC * time.Second))
+		m, err := message.Read(pc.conn, pc.magic)
+		if err != nil {
+			select {
+			case <-pc.closed:
+			default:
+				log.Printf("ERROR: reading from %s: %v", pc.Address, err)
+				// Un messaggio corrotto viene segnalato all'handler
+				// così il peer può essere penalizzato
+				if err == message.ErrBadChecksum || err == message.ErrBadMagic || err == message.ErrTooLarge {
+					pc.handler.HandleProtocolError(pc, err)
+				}
+			}
+			return
+		}
+		switch m.Command {
+		case message.CMD_PING:
+			var p message.Ping
+			_ = m.Decode(&p)
+			pc.TrySend(message.New(message.CMD_PONG, &p))
+		case message.CMD_PONG:
+		default:
+			pc.handler.HandleMessage(pc, m)
+		}
+	}
+}
+
+// Goroutine che scrive i messaggi della coda
+func (pc *PeerConn) writeLoop() {
+	defer pc.Close()
+	for {
+		select {
+		case m := <-pc.send:
+			pc.conn.SetWriteDeadline(pc.clock.Now().Add(WRITE_TIMEOUT_SEC * time.Second))
+			err := message.Write(pc.conn, pc.magic, m)
+			atomic.AddInt64(&pc.queued, -1)
+			if err != nil {
+				log.Printf("ERROR: writing to %s: %v", pc.Address, err)
+				return
+			}
+		case <-pc.closed:
+			return
+		}
+	}
+}
+
+// Timer che manda un ping periodico, la risposta del peer rinnova il
+// timeout di lettura
+// Il ping viene accodato dentro il timer, così con un clock manuale è
+// già in coda quando il tempo smette di avanzare
+func (pc *PeerConn) keepalive() {
+	select {
+	case <-pc.closed:
+		return
+	default:
+	}
+	pc.TrySend(message.New(message.CMD_PING, &message.Ping{Nonce: rand.Uint64()}))
+	pc.clock.AfterFunc(PING_INTERVAL_SEC*time.Second, pc.keepalive)
+}
@@ -0,0 +1,210 @@
+package peer_conn
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/message"
+)
+
+const WAIT = 5 * time.Second
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Handler che passa al test messaggi, errori e chiusura
+type recorder struct {
+	messages chan *message.Message
+	errors   chan error
+	closed   chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{messages: make(chan *message.Message, 16), errors: make(chan error, 16), closed: make(chan struct{})}
+}
+
+func (r *recorder) HandleMessage(pc *PeerConn, m *message.Message) {
+	r.messages <- m
+}
+
+func (r *recorder) HandleProtocolError(pc *PeerConn, err error) {
+	r.errors <- err
+}
+
+func (r *recorder) HandleClose(pc *PeerConn) {
+	close(r.closed)
+}
+
+// Funzione che avvia una connessione con il peer dall'altro capo di
+// una pipe, ritorna la connessione, il suo handler e il capo del peer
+func start(t *testing.T, magic [4]byte) (*PeerConn, *recorder, net.Conn) {
+	t.Helper()
+	local, remote := net.Pipe()
+	pc := NewPeerConn(local, magic, "peer:5000", "node-id", false, nil, clock.NewManual(time.Now()))
+	r := newRecorder()
+	pc.Start(r)
+	t.Cleanup(func() {
+		pc.Close()
+		remote.Close()
+	})
+	return pc, r, remote
+}
+
+// Funzione che aspetta la chiusura della connessione
+func waitClosed(t *testing.T, r *recorder) {
+	t.Helper()
+	select {
+	case <-r.closed:
+	case <-time.After(WAIT):
+		t.Fatal("the connection was not closed")
+	}
+}
+
+// I messaggi arrivano all'handler in ordine, i ping ricevono un pong
+// e non arrivano all'handler, quelli accodati con Send arrivano al peer
+func TestMessages(t *testing.T) {
+	magic := message.Magic("peer-conn-test")
+	pc, r, remote := start(t, magic)
+
+	go func() {
+		message.Write(remote, magic, message.New(message.CMD_INV, &message.Inv{Items: []message.InvItem{{Type: message.INV_TX, Hash: "aa"}}}))
+		message.Write(remote, magic, message.New(message.CMD_PING, &message.Ping{Nonce: 7}))
+		message.Write(remote, magic, message.New(message.CMD_GETADDR, nil))
+	}()
+	for _, command := range []string{message.CMD_INV, message.CMD_GETADDR} {
+		select {
+		case m := <-r.messages:
+			if m.Command != command {
+				t.Fatalf("received %s, expected %s", m.Command, command)
+			}
+		case <-time.After(WAIT):
+			t.Fatalf("%s not received", command)
+		}
+	}
+	pong, err := message.Read(remote, magic)
+	check(t, err)
+	var p message.Ping
+	check(t, pong.Decode(&p))
+	if pong.Command != message.CMD_PONG || p.Nonce != 7 {
+		t.Fatalf("answered %s %+v", pong.Command, p)
+	}
+
+	check(t, pc.Send(message.New(message.CMD_ADDR, &message.Addr{Addresses: []string{"a:1"}})))
+	m, err := message.Read(remote, magic)
+	check(t, err)
+	if m.Command != message.CMD_ADDR {
+		t.Fatalf("sent %s", m.Command)
+	}
+
+	remote.Close()
+	waitClosed(t, r)
+	if err := pc.Send(message.New(message.CMD_PING, &message.Ping{})); !errors.Is(err, ErrClosed) {
+		t.Fatalf("send after close: %v, expected %v", err, ErrClosed)
+	}
+	if len(r.errors) != 0 {
+		t.Fatalf("protocol error %v on a clean close", <-r.errors)
+	}
+}
+
+// I frame corrotti o troppo grandi chiudono la connessione e vengono
+// segnalati all'handler, un frame troncato dalla chiusura no
+func TestProtocolErrors(t *testing.T) {
+	magic := message.Magic("peer-conn-test")
+	frame, err := message.Encode(magic, message.New(message.CMD_GETADDR, nil))
+	check(t, err)
+	corrupted := append([]byte{}, frame...)
+	corrupted[len(corrupted)-1] ^= 0x01
+	large := append([]byte{}, frame[:message.HEADER_SIZE]...)
+	large[16], large[17], large[18], large[19] = 0xff, 0xff, 0xff, 0xff
+	other, err := message.Encode(message.Magic("other"), message.New(message.CMD_GETADDR, nil))
+	check(t, err)
+
+	tests := map[string]struct {
+		data     []byte
+		expected error
+	}{
+		"checksum":      {corrupted, message.ErrBadChecksum},
+		"too large":     {large, message.ErrTooLarge},
+		"other network": {other, message.ErrBadMagic},
+		"truncated":     {frame[:len(frame)-1], nil},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			_, r, remote := start(t, magic)
+			go func() {
+				remote.Write(test.data)
+				if test.expected == nil {
+					remote.Close()
+				}
+			}()
+			waitClosed(t, r)
+			if len(r.messages) != 0 {
+				t.Fatal("the handler received a message")
+			}
+			if test.expected == nil {
+				if len(r.errors) != 0 {
+					t.Fatalf("protocol error %v", <-r.errors)
+				}
+				return
+			}
+			if len(r.errors) != 1 {
+				t.Fatal("no protocol error")
+			}
+			if err := <-r.errors; !errors.Is(err, test.expected) {
+				t.Fatalf("%v, expected %v", err, test.expected)
+			}
+		})
+	}
+}
+
+// Con la coda piena TrySend scarta il messaggio, e la connessione
+// resta occupata finché ci sono messaggi da scrivere
+func TestQueueFull(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	pc := NewPeerConn(local, message.Magic("peer-conn-test"), "peer:5000", "node-id", true, []string{"headers"}, clock.NewManual(time.Now()))
+	defer pc.Close()
+	if pc.Busy() || !pc.HasFeature("headers") || pc.HasFeature("other") {
+		t.Fatal("unexpected state of a new connection")
+	}
+	for i := 0; i < SEND_QUEUE_SIZE; i++ {
+		check(t, pc.TrySend(message.New(message.CMD_PING, &message.Ping{})))
+	}
+	if err := pc.TrySend(message.New(message.CMD_PING, &message.Ping{})); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("full queue: %v, expected %v", err, ErrQueueFull)
+	}
+	if !pc.Busy() {
+		t.Fatal("not busy with queued messages")
+	}
+	if !pc.MarkKnown("aa") || pc.MarkKnown("aa") {
+		t.Fatal("known objects are not remembered")
+	}
+	pc.Close()
+	if pc.Busy() {
+		t.Fatal("busy after close")
+	}
+	if err := pc.TrySend(message.New(message.CMD_PING, &message.Ping{})); !errors.Is(err, ErrClosed) {
+		t.Fatalf("send after close: %v, expected %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,26 @@
+package transport
+
+import (
+	"net"
+	"time"
+)
+
+// Trasporto usato dai nodi per parlarsi, permette di sostituire
+// il TCP con una rete simulata
+type Transport interface {
+	Listen(address string) (net.Listener, error)
+	Dial(address string, timeout time.Duration) (net.Conn, error)
+}
+
+// Trasporto TCP
+type TCPTransport struct{}
+
+// Metodo per mettersi in ascolto su un indirizzo TCP
+func (t *TCPTransport) Listen(address string) (net.Listener, error) {
+	return net.Listen("tcp", address)
+}
+
+// Metodo per connettersi a un indirizzo TCP
+func (t *TCPTransport) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", address, timeout)
+}
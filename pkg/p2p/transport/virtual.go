@@ -0,0 +1,460 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+)
+
+var (
+	ErrConnectionRefused = errors.New("connection refused")
+	ErrAddressInUse      = errors.New("address already in use")
+)
+
+// Rete simulata in memoria, usata per far girare più nodi nello
+// stesso processo. Ogni Write è un messaggio che arriva dopo la
+// latenza, può andare perso e non attraversa le partizioni
+// I messaggi di una connessione arrivano sempre in ordine, quelli
+// che arrivano nello stesso istante in ordine di connessione, e la
+// perdita e il jitter di ogni connessione hanno un generatore
+// proprio, così non dipendono da quale goroutine scrive prima
+type VirtualNetwork struct {
+	clock     clock.Clock
+	latency   time.Duration
+	jitter    time.Duration
+	lossRate  float64
+	rand      *rand.Rand
+	listeners map[string]*virtualListener
+	// Gruppo di ogni host, due host in gruppi diversi non si parlano
+	partitions map[string]int
+	nextPort   int
+
+	// Messaggi in viaggio e connessioni aperte, per capire quando
+	// la rete è ferma
+	deliveries []*delivery
+	streams    map[*stream]bool
+	nextStream int
+	// Numero di eventi visti, cambia finché i nodi stanno lavorando
+	events int64
+	mux    sync.Mutex
+}
+
+// Messaggio in viaggio verso uno stream
+type delivery struct {
+	at     time.Time
+	stream *stream
+	seq    int
+	data   []byte
+}
+
+// Metodo che dice se il messaggio va consegnato prima dell'altro
+func (d *delivery) before(other *delivery) bool {
+	if !d.at.Equal(other.at) {
+		return d.at.Before(other.at)
+	}
+	if d.stream.id != other.stream.id {
+		return d.stream.id < other.stream.id
+	}
+	return d.seq < other.seq
+}
+
+// Funzione per creare una rete simulata, seed rende ripetibili
+// la perdita dei messaggi e il jitter
+func NewVirtualNetwork(c clock.Clock, seed int64) *VirtualNetwork {
+	return &VirtualNetwork{
+		clock:      c,
+		rand:       rand.New(rand.NewSource(seed)),
+		listeners:  make(map[string]*virtualListener),
+		partitions: make(map[string]int),
+		nextPort:   40000,
+		streams:    make(map[*stream]bool),
+	}
+}
+
+// Metodo per impostare la latenza dei messaggi, ogni messaggio
+// ritarda di latency più un valore casuale fino a jitter
+func (vn *VirtualNetwork) SetLatency(latency time.Duration, jitter time.Duration) {
+	vn.mux.Lock()
+	defer vn.mux.Unlock()
+	vn.latency = latency
+	vn.jitter = jitter
+}
+
+// Metodo per impostare la probabilità che un messaggio vada perso
+func (vn *VirtualNetwork) SetLossRate(rate float64) {
+	vn.mux.Lock()
+	defer vn.mux.Unlock()
+	vn.lossRate = rate
+}
+
+// Metodo per dividere la rete: gli host dello stesso gruppo si
+// parlano, quelli di gruppi diversi no. Gli host non elencati
+// finiscono in un gruppo a parte
+func (vn *VirtualNetwork) Partition(groups ...[]string) {
+	vn.mux.Lock()
+	defer vn.mux.Unlock()
+	vn.partitions = make(map[string]int)
+	for i, g := range groups {
+		for _, host := range g {
+			vn.partitions[host] = i + 1
+		}
+	}
+}
+
+// Metodo per togliere tutte le partizioni
+func (vn *VirtualNetwork) Heal() {
+	vn.Partition()
+}
+
+// Metodo che dice se due host si possono parlare, va chiamato con il lock
+func (vn *VirtualNetwork) reachable(a string, b string) bool {
+	if len(vn.partitions) == 0 {
+		return true
+	}
+	return vn.partitions[a] == vn.partitions[b]
+}
+
+// Metodo che ritorna il trasporto di un host della rete
+func (vn *VirtualNetwork) Transport(host string) Transport {
+	return &virtualTransport{network: vn, host: host}
+}
+
+// Metodo che ritorna lo stato della rete: busy se un nodo ha dati
+// ricevuti e non ha ancora finito di lavorarci, cioè non è tornato ad
+// aspettare sulla connessione, inflight i messaggi in viaggio ed events
+// il numero di eventi visti finora, che cambia finché i nodi lavorano
+func (vn *VirtualNetwork) Status() (busy bool, inflight int, events int64) {
+	vn.mux.Lock()
+	defer vn.mux.Unlock()
+	for s := range vn.streams {
+		s.mux.Lock()
+		if s.busy && !s.closed {
+			busy = true
+		}
+		s.mux.Unlock()
+	}
+	return busy, len(vn.deliveries), atomic.LoadInt64(&vn.events)
+}
+
+// Metodo che consegna il primo dei messaggi arrivati, un messaggio
+// nil è la chiusura della connessione
+// Ogni messaggio in viaggio ha un timer che chiama questo metodo, così
+// quelli dello stesso istante vengono consegnati in ordine di
+// connessione qualunque sia l'ordine dei timer
+func (vn *VirtualNetwork) deliverNext() {
+	now := vn.clock.Now()
+	vn.mux.Lock()
+	defer vn.mux.Unlock()
+	next := -1
+	for i, d := range vn.deliveries {
+		if !d.at.After(now) && (next < 0 || d.before(vn.deliveries[next])) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return
+	}
+	d := vn.deliveries[next]
+	vn.deliveries = append(vn.deliveries[:next], vn.deliveries[next+1:]...)
+	d.stream.deliver(d.data)
+	atomic.AddInt64(&vn.events, 1)
+}
+
+// Trasporto di un singolo host
+type virtualTransport struct {
+	network *VirtualNetwork
+	host    string
+}
+
+func (vt *virtualTransport) Listen(address string) (net.Listener, error) {
+	vn := vt.network
+	vn.mux.Lock()
+	defer vn.mux.Unlock()
+	if _, ok := vn.listeners[address]; ok {
+		return nil, ErrAddressInUse
+	}
+	l := &virtualListener{network: vn, address: address, conns: make(chan net.Conn, 64), closed: make(chan struct{})}
+	vn.listeners[address] = l
+	return l, nil
+}
+
+func (vt *virtualTransport) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	vn := vt.network
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	vn.mux.Lock()
+	l, ok := vn.listeners[address]
+	if !ok || !vn.reachable(vt.host, host) {
+		vn.mux.Unlock()
+		return nil, fmt.Errorf("dial %s: %w", address, ErrConnectionRefused)
+	}
+	vn.nextPort += 1
+	local := virtualAddr(net.JoinHostPort(vt.host, strconv.Itoa(vn.nextPort)))
+	remote := virtualAddr(address)
+	toServer, toClient := vn.newStream(), vn.newStream()
+	atomic.AddInt64(&vn.events, 1)
+	vn.mux.Unlock()
+
+	client := &virtualConn{network: vn, local: local, remote: remote, in: toClient, out: toServer}
+	server := &virtualConn{network: vn, local: remote, remote: local, in: toServer, out: toClient}
+	select {
+	case l.conns <- server:
+	case <-l.closed:
+		server.Close()
+		client.Close()
+		return nil, fmt.Errorf("dial %s: %w", address, ErrConnectionRefused)
+	}
+	return client, nil
+}
+
+// Listener della rete simulata
+type virtualListener struct {
+	network *VirtualNetwork
+	address string
+	conns   chan net.Conn
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func (l *virtualListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Le connessioni non ancora accettate vengono chiuse
+func (l *virtualListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+		l.network.mux.Lock()
+		delete(l.network.listeners, l.address)
+		l.network.mux.Unlock()
+		for {
+			select {
+			case c := <-l.conns:
+				c.Close()
+			default:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func (l *virtualListener) Addr() net.Addr {
+	return virtualAddr(l.address)
+}
+
+// Indirizzo della rete simulata, nella forma host:porta
+type virtualAddr string
+
+func (a virtualAddr) Network() string {
+	return "virtual"
+}
+
+func (a virtualAddr) String() string {
+	return string(a)
+}
+
+// Direzione di una connessione: i messaggi in viaggio vengono
+// consegnati in ordine nel buffer, da cui legge l'altro capo
+type stream struct {
+	network *VirtualNetwork
+	id      int
+	// Generatore della perdita e del jitter dei messaggi
+	rand *rand.Rand
+	buf  []byte
+	// Ultima consegna programmata e messaggi inviati, per mantenere
+	// l'ordine
+	last time.Time
+	sent int
+	eof  bool
+	// Chiuso dal lato che legge
+	closed bool
+	// Chi legge ha dati da elaborare: vale dalla creazione e da ogni
+	// consegna finché chi legge non torna ad aspettare
+	busy     bool
+	waiting  int
+	deadline time.Time
+	cond     *sync.Cond
+	mux      sync.Mutex
+}
+
+// Metodo che crea uno stream, va chiamato con il lock
+func (vn *VirtualNetwork) newStream() *stream {
+	vn.nextStream += 1
+	s := &stream{network: vn, id: vn.nextStream, rand: rand.New(rand.NewSource(vn.rand.Int63())), busy: true}
+	s.cond = sync.NewCond(&s.mux)
+	vn.streams[s] = true
+	return s
+}
+
+// Metodo per mettere nel buffer un messaggio arrivato
+func (s *stream) deliver(data []byte) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if data == nil {
+		s.eof = true
+	} else {
+		s.buf = append(s.buf, data...)
+	}
+	s.busy = true
+	s.cond.Broadcast()
+}
+
+// Connessione della rete simulata
+type virtualConn struct {
+	network *VirtualNetwork
+	local   virtualAddr
+	remote  virtualAddr
+	in      *stream
+	out     *stream
+	once    sync.Once
+}
+
+func (c *virtualConn) Read(p []byte) (int, error) {
+	s := c.in
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for len(s.buf) == 0 {
+		if s.closed {
+			return 0, net.ErrClosed
+		}
+		if s.eof {
+			return 0, io.EOF
+		}
+		if !s.deadline.IsZero() && !c.network.clock.Now().Before(s.deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		if s.busy {
+			s.busy = false
+			atomic.AddInt64(&c.network.events, 1)
+		}
+		s.waiting += 1
+		s.cond.Wait()
+		s.waiting -= 1
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// Ogni Write diventa un messaggio della rete simulata
+func (c *virtualConn) Write(p []byte) (int, error) {
+	c.in.mux.Lock()
+	closed := c.in.closed
+	c.in.mux.Unlock()
+	if closed {
+		return 0, net.ErrClosed
+	}
+	data := make([]byte, len(p))
+	copy(data, p)
+	c.send(data, true)
+	return len(p), nil
+}
+
+// Metodo che mette in viaggio un messaggio verso l'altro capo,
+// se lossy il messaggio può andare perso
+func (c *virtualConn) send(data []byte, lossy bool) {
+	vn := c.network
+	localHost, _, _ := net.SplitHostPort(string(c.local))
+	remoteHost, _, _ := net.SplitHostPort(string(c.remote))
+
+	vn.mux.Lock()
+	defer vn.mux.Unlock()
+	atomic.AddInt64(&vn.events, 1)
+	if !vn.reachable(localHost, remoteHost) {
+		return
+	}
+	s := c.out
+	s.mux.Lock()
+	if lossy && vn.lossRate > 0 && s.rand.Float64() < vn.lossRate {
+		s.mux.Unlock()
+		return
+	}
+	delay := vn.latency
+	if vn.jitter > 0 {
+		delay += time.Duration(s.rand.Int63n(int64(vn.jitter)))
+	}
+	now := vn.clock.Now()
+	at := now.Add(delay)
+	if at.Before(s.last) {
+		at = s.last
+	}
+	s.last = at
+	s.sent += 1
+	d := &delivery{at: at, stream: s, seq: s.sent, data: data}
+	s.mux.Unlock()
+	vn.deliveries = append(vn.deliveries, d)
+	vn.clock.AfterFunc(at.Sub(now), vn.deliverNext)
+}
+
+// La chiusura arriva all'altro capo come fine dello stream, dopo
+// i messaggi già in viaggio
+func (c *virtualConn) Close() error {
+	c.once.Do(func() {
+		c.in.mux.Lock()
+		c.in.closed = true
+		c.in.cond.Broadcast()
+		c.in.mux.Unlock()
+		c.send(nil, false)
+
+		vn := c.network
+		vn.mux.Lock()
+		delete(vn.streams, c.in)
+		vn.mux.Unlock()
+	})
+	return nil
+}
+
+func (c *virtualConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *virtualConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Solo la scadenza di lettura ha effetto, le scritture non si
+// bloccano mai
+func (c *virtualConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *virtualConn) SetReadDeadline(t time.Time) error {
+	s := c.in
+	s.mux.Lock()
+	s.deadline = t
+	s.mux.Unlock()
+	if !t.IsZero() {
+		// Sveglia chi sta leggendo quando la scadenza passa, finché
+		// non torna ad aspettare ha da lavorare
+		c.network.clock.AfterFunc(t.Sub(c.network.clock.Now()), func() {
+			s.mux.Lock()
+			if s.waiting > 0 {
+				s.busy = true
+			}
+			s.cond.Broadcast()
+			s.mux.Unlock()
+		})
+	}
+	return nil
+}
+
+func (c *virtualConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,160 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/message"
+)
+
+const LATENCY = 50 * time.Millisecond
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Funzione che crea una rete con un host "b" in ascolto e una
+// connessione da "a", ritorna la rete, il suo orologio e i due capi
+func connect(t *testing.T) (*VirtualNetwork, *clock.Manual, net.Conn, net.Conn) {
+	t.Helper()
+	c := clock.NewManual(time.Unix(1700000000, 0))
+	vn := NewVirtualNetwork(c, 1)
+	vn.SetLatency(LATENCY, 0)
+	l, err := vn.Transport("b").Listen("b:5000")
+	check(t, err)
+	t.Cleanup(func() { l.Close() })
+	client, err := vn.Transport("a").Dial("b:5000", time.Second)
+	check(t, err)
+	server, err := l.Accept()
+	check(t, err)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return vn, c, client, server
+}
+
+// I frame arrivano dopo la latenza, in ordine, anche se un frame è
+// scritto in più Write, e la chiusura arriva dopo i messaggi
+func TestFrames(t *testing.T) {
+	vn, c, client, server := connect(t)
+	magic := message.Magic("transport-test")
+	first, err := message.Encode(magic, message.New(message.CMD_PING, &message.Ping{Nonce: 1}))
+	check(t, err)
+	_, err = client.Write(first[:message.HEADER_SIZE])
+	check(t, err)
+	_, err = client.Write(first[message.HEADER_SIZE:])
+	check(t, err)
+	check(t, message.Write(client, magic, message.New(message.CMD_PONG, &message.Ping{Nonce: 2})))
+	client.Close()
+
+	if _, inflight, _ := vn.Status(); inflight != 4 {
+		t.Fatalf("%d messages in flight, expected 4", inflight)
+	}
+	c.Advance(LATENCY - time.Millisecond)
+	if _, inflight, _ := vn.Status(); inflight != 4 {
+		t.Fatal("delivered before the latency")
+	}
+	c.Advance(time.Millisecond)
+	if _, inflight, _ := vn.Status(); inflight != 0 {
+		t.Fatalf("%d messages in flight after the latency", inflight)
+	}
+
+	for _, expected := range []string{message.CMD_PING, message.CMD_PONG} {
+		m, err := message.Read(server, magic)
+		check(t, err)
+		if m.Command != expected {
+			t.Fatalf("read %s, expected %s", m.Command, expected)
+		}
+	}
+	if _, err := message.Read(server, magic); err != io.EOF {
+		t.Fatalf("after close: %v, expected %v", err, io.EOF)
+	}
+	if _, err := client.Write(first); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("write after close: %v, expected %v", err, net.ErrClosed)
+	}
+}
+
+// Un frame troncato dalla chiusura dell'altro capo è un errore
+func TestTruncatedFrame(t *testing.T) {
+	_, c, client, server := connect(t)
+	magic := message.Magic("transport-test")
+	frame, err := message.Encode(magic, message.New(message.CMD_ADDR, &message.Addr{Addresses: []string{"a:1"}}))
+	check(t, err)
+	_, err = client.Write(frame[:len(frame)-3])
+	check(t, err)
+	client.Close()
+	c.Advance(LATENCY)
+	if _, err := message.Read(server, magic); err != io.ErrUnexpectedEOF {
+		t.Fatalf("truncated frame: %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+// La scadenza di lettura segue l'orologio della rete
+func TestReadDeadline(t *testing.T) {
+	_, c, _, server := connect(t)
+	check(t, server.SetReadDeadline(c.Now().Add(time.Second)))
+	done := make(chan error, 1)
+	go func() {
+		_, err := server.Read(make([]byte, 1))
+		done <- err
+	}()
+	c.Advance(time.Second)
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("%v, expected %v", err, os.ErrDeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the read did not expire")
+	}
+}
+
+// Le partizioni scartano i messaggi e rifiutano le connessioni, la
+// perdita scarta i messaggi, gli indirizzi occupati non si riusano
+func TestPartitionAndLoss(t *testing.T) {
+	vn, c, client, server := connect(t)
+	vn.Partition([]string{"a"}, []string{"b"})
+	_, err := client.Write([]byte("lost"))
+	check(t, err)
+	if _, inflight, _ := vn.Status(); inflight != 0 {
+		t.Fatal("a message crossed the partition")
+	}
+	if _, err := vn.Transport("a").Dial("b:5000", time.Second); !errors.Is(err, ErrConnectionRefused) {
+		t.Fatalf("dial across the partition: %v, expected %v", err, ErrConnectionRefused)
+	}
+	vn.Heal()
+
+	vn.SetLossRate(1)
+	_, err = client.Write([]byte("lost"))
+	check(t, err)
+	if _, inflight, _ := vn.Status(); inflight != 0 {
+		t.Fatal("a message was not lost")
+	}
+	vn.SetLossRate(0)
+	_, err = client.Write([]byte("sent"))
+	check(t, err)
+	c.Advance(LATENCY)
+	received := make([]byte, 4)
+	_, err = io.ReadFull(server, received)
+	check(t, err)
+	if string(received) != "sent" {
+		t.Fatalf("received %q", received)
+	}
+
+	if _, err := vn.Transport("b").Listen("b:5000"); !errors.Is(err, ErrAddressInUse) {
+		t.Fatalf("listen twice: %v, expected %v", err, ErrAddressInUse)
+	}
+	if _, err := vn.Transport("a").Dial("c:5000", time.Second); !errors.Is(err, ErrConnectionRefused) {
+		t.Fatalf("dial without listener: %v, expected %v", err, ErrConnectionRefused)
+	}
+}
@@ -0,0 +1,124 @@
+package handshake
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/iltommi1995/blockchain-go/pkg/peer/node_key"
+)
+
+const (
+	// Versione del protocollo parlato dal nodo e versione
+	// minima accettata dai peer
+	// Dalla versione 2 le richieste tra nodi sono firmate, dalla
+	// versione 3 i nodi si parlano con il protocollo binario su TCP
+	PROTOCOL_VERSION     = 3
+	MIN_PROTOCOL_VERSION = 3
+
+	// Funzionalità che un nodo può supportare
+	FEATURE_PEER_EXCHANGE = "peer-exchange"
+	FEATURE_TX_RELAY      = "tx-relay"
+	FEATURE_BLOCK_RELAY   = "block-relay"
+)
+
+// Funzionalità supportate da questo nodo
+var SUPPORTED_FEATURES = []string{FEATURE_PEER_EXCHANGE, FEATURE_TX_RELAY, FEATURE_BLOCK_RELAY}
+
+// Messaggio che due nodi si scambiano prima di diventare peer
+type Handshake struct {
+	ProtocolVersion int
+	NodeID          string
+	PublicKey       string
+	ChainID         string
+	GenesisHash     string
+	BestHeight      int
+	Features        []string
+	Address         string
+}
+
+// Metodo per controllare che il peer remoto sia compatibile con
+// il nodo locale: stessa rete, stessa genesis e versione accettata
+func (h *Handshake) Check(remote *Handshake) error {
+	if remote.NodeID == "" {
+		return fmt.Errorf("missing node id")
+	}
+	if remote.NodeID != node_key.NodeIDFromPublicKey(remote.PublicKey) {
+		return fmt.Errorf("node id does not match public key")
+	}
+	if remote.NodeID == h.NodeID {
+		return fmt.Errorf("connected to self")
+	}
+	if remote.ChainID != h.ChainID {
+		return fmt.Errorf("different chain id %q", remote.ChainID)
+	}
+	if remote.GenesisHash != h.GenesisHash {
+		return fmt.Errorf("different genesis %s", remote.GenesisHash)
+	}
+	if remote.ProtocolVersion < MIN_PROTOCOL_VERSION {
+		return fmt.Errorf("protocol version %d too old", remote.ProtocolVersion)
+	}
+	return nil
+}
+
+// Metodo che ritorna le funzionalità supportate da entrambi i nodi
+func (h *Handshake) Negotiate(remote *Handshake) []string {
+	features := make([]string, 0)
+	for _, f := range h.Features {
+		for _, rf := range remote.Features {
+			if f == rf {
+				features = append(features, f)
+				break
+			}
+		}
+	}
+	return features
+}
+
+// Json dell'handshake
+func (h *Handshake) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ProtocolVersion int      `json:"protocol_version"`
+		NodeID          string   `json:"node_id"`
+		PublicKey       string   `json:"public_key"`
+		ChainID         string   `json:"chain_id"`
+		GenesisHash     string   `json:"genesis_hash"`
+		BestHeight      int      `json:"best_height"`
+		Features        []string `json:"features"`
+		Address         string   `json:"address"`
+	}{
+		ProtocolVersion: h.ProtocolVersion,
+		NodeID:          h.NodeID,
+		PublicKey:       h.PublicKey,
+		ChainID:         h.ChainID,
+		GenesisHash:     h.GenesisHash,
+		BestHeight:      h.BestHeight,
+		Features:        h.Features,
+		Address:         h.Address,
+	})
+}
+
+func (h *Handshake) UnmarshalJSON(data []byte) error {
+	v := &struct {
+		ProtocolVersion *int      `json:"protocol_version"`
+		NodeID          *string   `json:"node_id"`
+		PublicKey       *string   `json:"public_key"`
+		ChainID         *string   `json:"chain_id"`
+		GenesisHash     *string   `json:"genesis_hash"`
+		BestHeight      *int      `json:"best_height"`
+		Features        *[]string `json:"features"`
+		Address         *string   `json:"address"`
+	}{
+		ProtocolVersion: &h.ProtocolVersion,
+		NodeID:          &h.NodeID,
+		PublicKey:       &h.PublicKey,
+		ChainID:         &h.ChainID,
+		GenesisHash:     &h.GenesisHash,
+		BestHeight:      &h.BestHeight,
+		Features:        &h.Features,
+		Address:         &h.Address,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return nil
+}
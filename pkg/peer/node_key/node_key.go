@@ -0,0 +1,103 @@
+package node_key
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+)
+
+// Chiave del nodo, usata per dimostrare agli altri nodi la propria
+// identità durante l'handshake
+// Non è legata a nessun wallet, serve solo a identificare il nodo
+type NodeKey struct {
+	privateKey *ecdsa.PrivateKey
+}
+
+// Funzione per creare una nuova chiave casuale
+func NewNodeKey() *NodeKey {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return &NodeKey{privateKey}
+}
+
+// Funzione che carica la chiave dal file, se il file non esiste
+// crea una nuova chiave e la salva, così il nodo mantiene la
+// stessa identità tra un riavvio e l'altro
+func LoadOrCreateNodeKey(path string) (*NodeKey, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		nk := NewNodeKey()
+		return nk, nk.Save(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		PrivateKey string `json:"private_key"`
+		PublicKey  string `json:"public_key"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if len(v.PublicKey) != 128 {
+		return nil, fmt.Errorf("invalid node key file %s", path)
+	}
+	publicKey := utils.PublicKeyFromString(v.PublicKey)
+	return &NodeKey{utils.PrivateKeyFromString(v.PrivateKey, publicKey)}, nil
+}
+
+// Metodo per salvare la chiave su file, leggibile solo dal proprietario
+func (nk *NodeKey) Save(path string) error {
+	m, _ := json.MarshalIndent(struct {
+		PrivateKey string `json:"private_key"`
+		PublicKey  string `json:"public_key"`
+	}{
+		PrivateKey: fmt.Sprintf("%064x", nk.privateKey.D.Bytes()),
+		PublicKey:  nk.PublicKeyStr(),
+	}, "", "  ")
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, m, 0600)
+}
+
+// Getter della chiave pubblica come string
+func (nk *NodeKey) PublicKeyStr() string {
+	return fmt.Sprintf("%064x%064x", nk.privateKey.X.Bytes(), nk.privateKey.Y.Bytes())
+}
+
+// Getter dell'identificativo del nodo, derivato dalla chiave pubblica
+func (nk *NodeKey) NodeID() string {
+	return NodeIDFromPublicKey(nk.PublicKeyStr())
+}
+
+// Funzione che ricava l'identificativo di un nodo dalla sua chiave pubblica
+func NodeIDFromPublicKey(publicKey string) string {
+	h := sha256.Sum256([]byte(publicKey))
+	return hex.EncodeToString(h[:16])
+}
+
+// Metodo per firmare un digest, ritorna la firma come string
+func (nk *NodeKey) Sign(digest []byte) string {
+	r, s, _ := ecdsa.Sign(rand.Reader, nk.privateKey, digest)
+	return (&utils.Signature{R: r, S: s}).String()
+}
+
+// Funzione per verificare la firma di un digest con la chiave
+// pubblica di un nodo
+func Verify(publicKey string, digest []byte, signature string) bool {
+	if len(publicKey) != 128 || len(signature) != 128 {
+		return false
+	}
+	s := utils.SignatureFromString(signature)
+	return ecdsa.Verify(utils.PublicKeyFromString(publicKey), digest, s.R, s.S)
+}
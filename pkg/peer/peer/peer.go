@@ -0,0 +1,146 @@
+package peer
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Provenienza di un peer nell'address book
+const (
+	SOURCE_SEED     = "seed"
+	SOURCE_EXCHANGE = "exchange"
+	SOURCE_LAN      = "lan"
+	SOURCE_INBOUND  = "inbound"
+)
+
+// Peer conosciuto dal nodo, con le informazioni necessarie
+// a decidere se contattarlo o eliminarlo
+type Peer struct {
+	Address     string
+	Source      string
+	Inbound     bool
+	LastSeen    int64
+	LastAttempt int64
+	Failures    int
+	// Dati ricevuti con l'handshake
+	NodeID          string
+	PublicKey       string
+	ProtocolVersion int
+	BestHeight      int
+	Features        []string
+}
+
+// Funzione per creare un nuovo peer mai contattato
+func NewPeer(address string, source string) *Peer {
+	return &Peer{Address: address, Source: source}
+}
+
+// Metodo per segnare il peer come raggiungibile
+func (p *Peer) MarkSeen(now time.Time) {
+	p.LastSeen = now.Unix()
+	p.LastAttempt = now.Unix()
+	p.Failures = 0
+}
+
+// Metodo per segnare un tentativo di contatto fallito
+func (p *Peer) MarkFailed(now time.Time) {
+	p.LastAttempt = now.Unix()
+	p.Failures += 1
+}
+
+// Metodo per salvare i dati dell'handshake e le funzionalità negoziate
+func (p *Peer) SetHandshake(nodeID string, publicKey string, protocolVersion int, bestHeight int, features []string) {
+	p.NodeID = nodeID
+	p.PublicKey = publicKey
+	p.ProtocolVersion = protocolVersion
+	p.BestHeight = bestHeight
+	p.Features = features
+}
+
+// Metodo che dice se col peer è già stato fatto l'handshake
+func (p *Peer) IsHandshaked() bool {
+	return p.NodeID != ""
+}
+
+// Metodo che dice se la funzionalità è stata negoziata col peer
+func (p *Peer) HasFeature(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Metodo che dice se il peer è da eliminare: non è stato visto
+// da più di maxAge oppure ha superato il numero massimo di fallimenti
+func (p *Peer) IsDead(now time.Time, maxAge time.Duration, maxFailures int) bool {
+	if p.Failures >= maxFailures {
+		return true
+	}
+	if p.LastSeen == 0 {
+		return false
+	}
+	return now.Sub(time.Unix(p.LastSeen, 0)) > maxAge
+}
+
+// Json del peer
+func (p *Peer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Address         string   `json:"address"`
+		Source          string   `json:"source"`
+		Inbound         bool     `json:"inbound"`
+		LastSeen        int64    `json:"last_seen"`
+		LastAttempt     int64    `json:"last_attempt"`
+		Failures        int      `json:"failures"`
+		NodeID          string   `json:"node_id,omitempty"`
+		PublicKey       string   `json:"public_key,omitempty"`
+		ProtocolVersion int      `json:"protocol_version,omitempty"`
+		BestHeight      int      `json:"best_height,omitempty"`
+		Features        []string `json:"features,omitempty"`
+	}{
+		Address:         p.Address,
+		Source:          p.Source,
+		Inbound:         p.Inbound,
+		LastSeen:        p.LastSeen,
+		LastAttempt:     p.LastAttempt,
+		Failures:        p.Failures,
+		NodeID:          p.NodeID,
+		PublicKey:       p.PublicKey,
+		ProtocolVersion: p.ProtocolVersion,
+		BestHeight:      p.BestHeight,
+		Features:        p.Features,
+	})
+}
+
+func (p *Peer) UnmarshalJSON(data []byte) error {
+	v := &struct {
+		Address         *string   `json:"address"`
+		Source          *string   `json:"source"`
+		Inbound         *bool     `json:"inbound"`
+		LastSeen        *int64    `json:"last_seen"`
+		LastAttempt     *int64    `json:"last_attempt"`
+		Failures        *int      `json:"failures"`
+		NodeID          *string   `json:"node_id"`
+		PublicKey       *string   `json:"public_key"`
+		ProtocolVersion *int      `json:"protocol_version"`
+		BestHeight      *int      `json:"best_height"`
+		Features        *[]string `json:"features"`
+	}{
+		Address:         &p.Address,
+		Source:          &p.Source,
+		Inbound:         &p.Inbound,
+		LastSeen:        &p.LastSeen,
+		LastAttempt:     &p.LastAttempt,
+		Failures:        &p.Failures,
+		NodeID:          &p.NodeID,
+		PublicKey:       &p.PublicKey,
+		ProtocolVersion: &p.ProtocolVersion,
+		BestHeight:      &p.BestHeight,
+		Features:        &p.Features,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package peer
+
+import (
+	"net"
+	"time"
+)
+
+// Prefissi delle chiavi della reputazione: l'host da cui arrivano le
+// connessioni del peer e il suo node id
+const (
+	KEY_HOST = "host:"
+	KEY_NODE = "node:"
+)
+
+// Punteggio iniziale di un peer, quando scende a zero il peer viene bannato
+const INITIAL_SCORE = 100
+
+// Reputazione di un host o di un node id: punteggio e ban valgono
+// per tutte le connessioni che arrivano da lì, qualunque indirizzo
+// annuncino, così un peer bannato non rientra cambiando porta
+type Reputation struct {
+	Key string `json:"key"`
+	// Ultimo indirizzo annunciato, per mostrarlo e togliere il ban
+	Address     string `json:"address"`
+	Score       int    `json:"score"`
+	BannedUntil int64  `json:"banned_until,omitempty"`
+	BanReason   string `json:"ban_reason,omitempty"`
+}
+
+// Funzione per creare la reputazione di una chiave mai penalizzata
+func NewReputation(key string) *Reputation {
+	return &Reputation{Key: key, Score: INITIAL_SCORE}
+}
+
+// Funzione che ritorna le chiavi della reputazione di un peer, dall'host
+// da cui si connette e dal node id, vuoti se non si conoscono
+// Gli host di loopback sono condivisi da tutti i nodi della macchina,
+// per loro vale solo il node id
+func Keys(host string, nodeID string) []string {
+	keys := make([]string, 0, 2)
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsLoopback()) {
+		if ip != nil {
+			host = ip.String()
+		}
+		keys = append(keys, KEY_HOST+host)
+	}
+	if nodeID != "" {
+		keys = append(keys, KEY_NODE+nodeID)
+	}
+	return keys
+}
+
+// Metodo che ritorna le chiavi della reputazione del peer dell'address
+// book, dall'host del suo indirizzo e dal node id dell'handshake
+func (p *Peer) Keys() []string {
+	host, _, err := net.SplitHostPort(p.Address)
+	if err != nil {
+		host = ""
+	}
+	return Keys(host, p.NodeID)
+}
+
+// Metodo per abbassare il punteggio dopo una violazione del
+// protocollo, se il punteggio arriva a zero scatta il ban per
+// banDuration. Ritorna true se è scattato il ban
+func (r *Reputation) Penalize(points int, reason string, now time.Time, banDuration time.Duration) bool {
+	r.Score -= points
+	if r.Score > 0 {
+		return false
+	}
+	r.Score = 0
+	r.BannedUntil = now.Add(banDuration).Unix()
+	r.BanReason = reason
+	return true
+}
+
+// Metodo che dice se la chiave è bannata
+func (r *Reputation) IsBanned(now time.Time) bool {
+	return r.BannedUntil > now.Unix()
+}
+
+// Metodo per togliere il ban e riportare il punteggio iniziale
+func (r *Reputation) Unban() {
+	r.Score = INITIAL_SCORE
+	r.BannedUntil = 0
+	r.BanReason = ""
+}
@@ -0,0 +1,315 @@
+package peer_store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/peer/peer"
+)
+
+// Address book dei peer, salvato su disco in json
+// così che il nodo li ricordi tra un riavvio e l'altro
+// Accanto ai peer tiene la reputazione degli host e dei node id,
+// con i ban
+type PeerStore struct {
+	path        string
+	peers       map[string]*peer.Peer
+	reputations map[string]*peer.Reputation
+	mux         sync.Mutex
+}
+
+// Funzione per creare un nuovo address book, se path è vuoto
+// i peer vengono tenuti solo in memoria
+func NewPeerStore(path string) *PeerStore {
+	return &PeerStore{path: path, peers: make(map[string]*peer.Peer), reputations: make(map[string]*peer.Reputation)}
+}
+
+// Metodo per caricare l'address book dal file, se il file
+// non esiste si parte da un address book vuoto
+func (ps *PeerStore) Load() error {
+	if ps.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(ps.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var v struct {
+		Peers       []*peer.Peer       `json:"peers"`
+		Reputations []*peer.Reputation `json:"reputations"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	for _, p := range v.Peers {
+		ps.peers[p.Address] = p
+	}
+	for _, r := range v.Reputations {
+		ps.reputations[r.Key] = r
+	}
+	return nil
+}
+
+// Metodo per salvare l'address book su disco, si scrive prima
+// su un file temporaneo per non lasciare il file a metà
+func (ps *PeerStore) Save() error {
+	if ps.path == "" {
+		return nil
+	}
+	m, err := json.MarshalIndent(struct {
+		Peers       []*peer.Peer       `json:"peers"`
+		Reputations []*peer.Reputation `json:"reputations"`
+	}{
+		Peers:       ps.Peers(),
+		Reputations: ps.Reputations(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(ps.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := ps.path + ".tmp"
+	if err := os.WriteFile(tmp, m, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ps.path)
+}
+
+// Metodo per aggiungere un peer, ritorna false se era già presente
+func (ps *PeerStore) Add(address string, source string) bool {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	if _, ok := ps.peers[address]; ok {
+		return false
+	}
+	ps.peers[address] = peer.NewPeer(address, source)
+	return true
+}
+
+// Metodo per rimuovere un peer
+func (ps *PeerStore) Remove(address string) {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	delete(ps.peers, address)
+}
+
+// Metodo per segnare un peer come raggiungibile, se non c'è viene aggiunto
+func (ps *PeerStore) MarkSeen(address string, source string, now time.Time) {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	p, ok := ps.peers[address]
+	if !ok {
+		p = peer.NewPeer(address, source)
+		ps.peers[address] = p
+	}
+	p.MarkSeen(now)
+}
+
+// Metodo per segnare un tentativo di contatto fallito
+func (ps *PeerStore) MarkFailed(address string, now time.Time) {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	if p, ok := ps.peers[address]; ok {
+		p.MarkFailed(now)
+	}
+}
+
+// Metodo per segnare un peer come inbound, cioè che si è annunciato lui
+func (ps *PeerStore) SetInbound(address string, inbound bool) {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	if p, ok := ps.peers[address]; ok {
+		p.Inbound = inbound
+	}
+}
+
+// Metodo per salvare i dati dell'handshake di un peer
+func (ps *PeerStore) SetHandshake(address string, nodeID string, publicKey string, protocolVersion int, bestHeight int, features []string) {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	if p, ok := ps.peers[address]; ok {
+		p.SetHandshake(nodeID, publicKey, protocolVersion, bestHeight, features)
+	}
+}
+
+// Metodo che ritorna una copia del peer, nil se non è conosciuto
+func (ps *PeerStore) Get(address string) *peer.Peer {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	p, ok := ps.peers[address]
+	if !ok {
+		return nil
+	}
+	c := *p
+	return &c
+}
+
+// Metodo per abbassare il punteggio delle chiavi di un peer, che si
+// annuncia con address: le chiavi mai penalizzate vengono aggiunte
+// così che il ban venga ricordato
+// Ritorna true se è scattato il ban di almeno una chiave
+func (ps *PeerStore) Penalize(keys []string, address string, points int, reason string, now time.Time, banDuration time.Duration) bool {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	banned := false
+	for _, key := range keys {
+		r, ok := ps.reputations[key]
+		if !ok {
+			r = peer.NewReputation(key)
+			ps.reputations[key] = r
+		}
+		r.Address = address
+		if !r.IsBanned(now) && r.Penalize(points, reason, now, banDuration) {
+			banned = true
+		}
+	}
+	return banned
+}
+
+// Metodo che dice se una delle chiavi è bannata
+func (ps *PeerStore) IsBanned(keys []string, now time.Time) bool {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	for _, key := range keys {
+		if r, ok := ps.reputations[key]; ok && r.IsBanned(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Metodo che ritorna una copia delle reputazioni penalizzate almeno
+// una volta, in ordine di chiave
+func (ps *PeerStore) Reputations() []*peer.Reputation {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	reputations := make([]*peer.Reputation, 0, len(ps.reputations))
+	for _, r := range ps.reputations {
+		c := *r
+		reputations = append(reputations, &c)
+	}
+	sort.Slice(reputations, func(i, j int) bool { return reputations[i].Key < reputations[j].Key })
+	return reputations
+}
+
+// Metodo che ritorna le chiavi bannate
+func (ps *PeerStore) Bans(now time.Time) []*peer.Reputation {
+	bans := make([]*peer.Reputation, 0)
+	for _, r := range ps.Reputations() {
+		if r.IsBanned(now) {
+			bans = append(bans, r)
+		}
+	}
+	return bans
+}
+
+// Metodo per togliere il ban alla chiave o alle chiavi dell'ultimo
+// indirizzo annunciato, ritorna il numero di ban tolti
+func (ps *PeerStore) Unban(keyOrAddress string, now time.Time) int {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	count := 0
+	for key, r := range ps.reputations {
+		if key != keyOrAddress && r.Address != keyOrAddress {
+			continue
+		}
+		if r.IsBanned(now) {
+			count += 1
+		}
+		r.Unban()
+	}
+	return count
+}
+
+// Metodo per togliere tutti i ban, ritorna il numero di ban tolti
+func (ps *PeerStore) UnbanAll(now time.Time) int {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	count := 0
+	for _, r := range ps.reputations {
+		if r.IsBanned(now) {
+			count += 1
+		}
+		r.Unban()
+	}
+	return count
+}
+
+// Metodo che ritorna il numero di peer inbound
+func (ps *PeerStore) InboundCount() int {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	count := 0
+	for _, p := range ps.peers {
+		if p.Inbound {
+			count += 1
+		}
+	}
+	return count
+}
+
+// Metodo che ritorna una copia dei peer, ordinati dal più
+// recentemente visto al meno recente
+func (ps *PeerStore) Peers() []*peer.Peer {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	peers := make([]*peer.Peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		c := *p
+		peers = append(peers, &c)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].LastSeen != peers[j].LastSeen {
+			return peers[i].LastSeen > peers[j].LastSeen
+		}
+		return peers[i].Address < peers[j].Address
+	})
+	return peers
+}
+
+// Metodo che ritorna gli indirizzi dei peer già visti almeno
+// una volta, al massimo limit, da condividere con gli altri nodi
+func (ps *PeerStore) Addresses(limit int, now time.Time) []string {
+	addresses := make([]string, 0)
+	for _, p := range ps.Peers() {
+		if len(addresses) >= limit {
+			break
+		}
+		if p.LastSeen > 0 && !ps.IsBanned(p.Keys(), now) {
+			addresses = append(addresses, p.Address)
+		}
+	}
+	return addresses
+}
+
+// Metodo per eliminare i peer morti, tranne quelli in keep
+// Ritorna gli indirizzi eliminati
+func (ps *PeerStore) Prune(now time.Time, maxAge time.Duration, maxFailures int, keep map[string]bool) []string {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	removed := make([]string, 0)
+	for address, p := range ps.peers {
+		if keep[address] {
+			continue
+		}
+		if p.IsDead(now, maxAge, maxFailures) {
+			delete(ps.peers, address)
+			removed = append(removed, address)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
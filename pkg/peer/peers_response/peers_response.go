@@ -0,0 +1,21 @@
+package peers_response
+
+import "encoding/json"
+
+// Lista di peer conosciuti da un nodo e di quelli a cui
+// è connesso, risposta in json
+type PeersResponse struct {
+	Peers     []string `json:"peers"`
+	Connected []string `json:"connected"`
+}
+
+// Json di PeersResponse
+func (pr *PeersResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Peers     []string `json:"peers"`
+		Connected []string `json:"connected"`
+	}{
+		Peers:     pr.Peers,
+		Connected: pr.Connected,
+	})
+}
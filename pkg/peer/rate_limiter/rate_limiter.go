@@ -0,0 +1,36 @@
+package rate_limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Rate limiter a finestra mobile: ogni chiave può fare al
+// massimo limit richieste nell'intervallo window
+type RateLimiter struct {
+	limit    int
+	window   time.Duration
+	requests map[string][]time.Time
+	mux      sync.Mutex
+}
+
+// Funzione per creare un nuovo rate limiter
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{limit: limit, window: window, requests: make(map[string][]time.Time)}
+}
+
+// Metodo che registra una richiesta della chiave e ritorna
+// false se la chiave ha superato il limite
+func (rl *RateLimiter) Allow(key string, now time.Time) bool {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+	recent := rl.requests[key][:0]
+	for _, t := range rl.requests[key] {
+		if now.Sub(t) < rl.window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	rl.requests[key] = recent
+	return len(recent) <= rl.limit
+}
@@ -0,0 +1,344 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/node"
+	"github.com/iltommi1995/blockchain-go/pkg/p2p/transport"
+	wallet_transaction "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+)
+
+const (
+	SIM_P2P_PORT = 6000
+	SIM_CHAIN_ID = "blockchain-go-sim"
+	// Tempo simulato massimo concesso a Settle
+	DEFAULT_SETTLE_LIMIT_SEC = 60
+)
+
+// Configurazione della simulazione
+type Config struct {
+	Nodes    int
+	Latency  time.Duration
+	Jitter   time.Duration
+	LossRate float64
+	// Seed della rete simulata, rende ripetibili perdite e jitter
+	Seed int64
+	// Ora di partenza dell'orologio simulato
+	Start time.Time
+	// Se true ogni nodo si connette a tutti gli altri all'avvio
+	FullMesh bool
+}
+
+// Nodo della simulazione, con la sua blockchain e il wallet del miner
+type SimNode struct {
+	Name       string
+	Blockchain *blockchain.Blockchain
+	Node       *node.Node
+	Miner      *wallet.Wallet
+}
+
+// Simulazione di N nodi nello stesso processo, collegati da una
+// rete virtuale e con un orologio che avanza solo quando lo
+// fa avanzare lo scenario
+type Simulator struct {
+	Clock   *clock.Manual
+	Network *transport.VirtualNetwork
+	Nodes   []*SimNode
+	config  Config
+}
+
+// Funzione per creare la simulazione, i nodi non sono ancora avviati
+func NewSimulator(config Config) *Simulator {
+	if config.Start.IsZero() {
+		config.Start = time.Unix(1645635740, 0)
+	}
+	c := clock.NewManual(config.Start)
+	vn := transport.NewVirtualNetwork(c, config.Seed)
+	vn.SetLatency(config.Latency, config.Jitter)
+	vn.SetLossRate(config.LossRate)
+
+	s := &Simulator{Clock: c, Network: vn, config: config}
+	for i := 0; i < config.Nodes; i++ {
+		name := fmt.Sprintf("node%d", i)
+		miner := wallet.NewWallet()
+		bc := blockchain.NewBlockchain(miner.BlockchainAddress(), SIM_P2P_PORT, SIM_CHAIN_ID)
+		bc.SetClock(c)
+		seeds := make([]string, 0)
+		if config.FullMesh {
+			for j := 0; j < i; j++ {
+				seeds = append(seeds, address(fmt.Sprintf("node%d", j)))
+			}
+		}
+		n := node.NewNode(bc, node.Config{
+			Host:    name,
+			Port:    SIM_P2P_PORT,
+			ChainID: SIM_CHAIN_ID,
+			Seeds:   seeds,
+			// Un solo nodo per host, non serve cercare nella LAN
+			LanDiscovery: false,
+			Clock:        c,
+		}, vn.Transport(name))
+		s.Nodes = append(s.Nodes, &SimNode{Name: name, Blockchain: bc, Node: n, Miner: miner})
+	}
+	return s
+}
+
+// Funzione che ritorna l'indirizzo p2p di un host simulato
+func address(host string) string {
+	return net.JoinHostPort(host, strconv.Itoa(SIM_P2P_PORT))
+}
+
+// Metodo per avviare tutti i nodi e aspettare che le connessioni
+// iniziali siano stabilite
+func (s *Simulator) Start() error {
+	for _, sn := range s.Nodes {
+		if err := sn.Node.Start(context.Background()); err != nil {
+			return fmt.Errorf("%s: %w", sn.Name, err)
+		}
+		s.Settle(DEFAULT_SETTLE_LIMIT_SEC * time.Second)
+	}
+	return nil
+}
+
+// Metodo per fermare tutti i nodi
+func (s *Simulator) Stop() {
+	for _, sn := range s.Nodes {
+		sn.Node.Stop()
+	}
+}
+
+// Metodo per connettere il nodo i al nodo j, fa avanzare il tempo
+// finché l'handshake non è concluso
+func (s *Simulator) Connect(i int, j int) error {
+	done := make(chan error, 1)
+	err := s.Nodes[i].Node.ConnectAsync(s.Nodes[j].Node.Address(), func(incompatible bool, err error) {
+		done <- err
+	})
+	if err != nil {
+		return err
+	}
+	s.Settle(DEFAULT_SETTLE_LIMIT_SEC * time.Second)
+	return <-done
+}
+
+// Metodo che connette in catena i nodi, 0-1, 1-2 e così via
+func (s *Simulator) ConnectLine() error {
+	for i := 0; i+1 < len(s.Nodes); i++ {
+		if err := s.Connect(i, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Metodo per dividere la rete in gruppi di nodi, per indice
+func (s *Simulator) Partition(groups ...[]int) {
+	hosts := make([][]string, len(groups))
+	for i, g := range groups {
+		for _, n := range g {
+			hosts[i] = append(hosts[i], s.Nodes[n].Name)
+		}
+	}
+	s.Network.Partition(hosts...)
+}
+
+// Metodo per togliere le partizioni
+func (s *Simulator) Heal() {
+	s.Network.Heal()
+}
+
+// Metodo che fa minare un blocco al nodo i e aspetta che la rete
+// lo propaghi
+func (s *Simulator) Mine(i int) *block.Block {
+	bc := s.Nodes[i].Blockchain
+	bc.Mining()
+	// Ogni blocco ha un timestamp diverso
+	s.Run(time.Millisecond)
+	s.Settle(DEFAULT_SETTLE_LIMIT_SEC * time.Second)
+	return bc.LastBlock()
+}
+
+// Metodo per inviare value dal miner del nodo from al destinatario,
+// la transazione viene presentata al nodo via
+// Ogni invio ha il suo nonce, così due invii uguali sono due
+// transazioni
+// Ritorna l'errore se il nodo rifiuta la transazione
+func (s *Simulator) Send(from int, recipient string, value float32, via int) error {
+	w := s.Nodes[from].Miner
+	bc := s.Nodes[via].Blockchain
+	sender, publicKey := w.BlockchainAddress(), w.PublicKeyStr()
+	chainID, nonce := bc.ChainID(), blockchain_transaction.NewNonce()
+	t := wallet_transaction.NewTransaction(w.PrivateKey(), w.PublicKey(), sender, recipient, value)
+	t.SetChainID(chainID)
+	t.SetNonce(nonce)
+	signature := t.GenerateSignature().String()
+	err := bc.CreateTransactionRequest(&transaction_request.TransactionRequest{
+		SenderBlockchainAddress:    &sender,
+		RecipientBlockchainAddress: &recipient,
+		SenderPublicKey:            &publicKey,
+		Value:                      &value,
+		ChainID:                    &chainID,
+		Nonce:                      &nonce,
+		Signature:                  &signature,
+	})
+	s.Settle(DEFAULT_SETTLE_LIMIT_SEC * time.Second)
+	return err
+}
+
+// Metodo che fa avanzare il tempo simulato di d, un evento alla
+// volta, lasciando lavorare i nodi dopo ogni evento
+func (s *Simulator) Run(d time.Duration) {
+	target := s.Clock.Now().Add(d)
+	s.waitQuiet()
+	for s.step(target) {
+	}
+	s.Clock.Advance(target.Sub(s.Clock.Now()))
+}
+
+// Metodo che fa avanzare il tempo finché ci sono messaggi in viaggio
+// o timer già scaduti, al massimo di limit. Ritorna false se la rete
+// non si è fermata
+func (s *Simulator) Settle(limit time.Duration) bool {
+	target := s.Clock.Now().Add(limit)
+	for {
+		if s.waitQuiet() && !s.step(s.Clock.Now()) {
+			return true
+		}
+		if !s.step(target) {
+			return false
+		}
+	}
+}
+
+// Metodo che aspetta che i nodi smettano di lavorare: nessun nodo ha
+// messaggi da scrivere, nessuno ha dati ricevuti da elaborare e il
+// numero di eventi della rete non cambia durante il controllo
+// Ritorna true se non ci sono più messaggi in viaggio
+func (s *Simulator) waitQuiet() bool {
+	for {
+		_, _, before := s.Network.Status()
+		busy := false
+		for _, sn := range s.Nodes {
+			if sn.Node.Busy() {
+				busy = true
+				break
+			}
+		}
+		networkBusy, inflight, after := s.Network.Status()
+		if !busy && !networkBusy && before == after {
+			return inflight == 0
+		}
+		runtime.Gosched()
+	}
+}
+
+// Metodo che fa scattare il prossimo timer, se scade entro target,
+// e aspetta che i nodi finiscano di lavorare
+func (s *Simulator) step(target time.Time) bool {
+	s.waitQuiet()
+	if !s.Clock.Step(target) {
+		return false
+	}
+	s.waitQuiet()
+	return true
+}
+
+// Metodo che ritorna l'altezza della catena di ogni nodo
+func (s *Simulator) Heights() []int {
+	heights := make([]int, len(s.Nodes))
+	for i, sn := range s.Nodes {
+		heights[i] = sn.Blockchain.Height()
+	}
+	return heights
+}
+
+// Metodo che ritorna l'hash dell'ultimo blocco di ogni nodo
+func (s *Simulator) Tips() []string {
+	tips := make([]string, len(s.Nodes))
+	for i, sn := range s.Nodes {
+		tips[i] = blockchain.BlockHash(sn.Blockchain.LastBlock())
+	}
+	return tips
+}
+
+// Metodo che ritorna una copia della catena del nodo i, da usare
+// con ReorgDepth
+func (s *Simulator) Snapshot(i int) []*block.Block {
+	return s.Nodes[i].Blockchain.ChainPrefix(s.Nodes[i].Blockchain.Height() + 1)
+}
+
+// Metodo che ritorna quanti blocchi della catena before il nodo i
+// ha scartato per passare alla catena attuale
+func (s *Simulator) ReorgDepth(i int, before []*block.Block) int {
+	after := s.Snapshot(i)
+	common := 0
+	for common < len(before) && common < len(after) && before[common].Hash() == after[common].Hash() {
+		common += 1
+	}
+	return len(before) - common
+}
+
+// Metodo che ritorna il bilancio di un indirizzo visto dal nodo i
+func (s *Simulator) Balance(i int, blockchainAddress string) float32 {
+	return s.Nodes[i].Blockchain.CalculateTotalAmount(blockchainAddress)
+}
+
+// Metodo che controlla che tutti i nodi abbiano lo stesso ultimo blocco
+func (s *Simulator) AssertConverged() error {
+	tips := s.Tips()
+	for i, tip := range tips {
+		if tip != tips[0] {
+			return fmt.Errorf("%s has tip %s at height %d, %s has %s at height %d",
+				s.Nodes[i].Name, tip, s.Nodes[i].Blockchain.Height(),
+				s.Nodes[0].Name, tips[0], s.Nodes[0].Blockchain.Height())
+		}
+	}
+	return nil
+}
+
+// Metodo che controlla l'altezza della catena di tutti i nodi
+func (s *Simulator) AssertHeight(height int) error {
+	for i, h := range s.Heights() {
+		if h != height {
+			return fmt.Errorf("%s has height %d, expected %d", s.Nodes[i].Name, h, height)
+		}
+	}
+	return nil
+}
+
+// Metodo che controlla il bilancio di un indirizzo su tutti i nodi
+func (s *Simulator) AssertBalance(blockchainAddress string, amount float32) error {
+	for i := range s.Nodes {
+		if b := s.Balance(i, blockchainAddress); b != amount {
+			return fmt.Errorf("%s sees balance %.1f for %s, expected %.1f", s.Nodes[i].Name, b, blockchainAddress, amount)
+		}
+	}
+	return nil
+}
+
+// Metodo che controlla la profondità del riordino fatto dal nodo i
+func (s *Simulator) AssertReorgDepth(i int, before []*block.Block, depth int) error {
+	if d := s.ReorgDepth(i, before); d != depth {
+		return fmt.Errorf("%s reorganized %d blocks, expected %d", s.Nodes[i].Name, d, depth)
+	}
+	return nil
+}
+
+// Metodo per stampare lo stato dei nodi
+func (s *Simulator) Print() {
+	for i, sn := range s.Nodes {
+		log.Printf("%s height %d tip %s peers %v", sn.Name, s.Heights()[i], s.Tips()[i], sn.Node.ConnectedPeers())
+	}
+}
@@ -0,0 +1,181 @@
+package simulator
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+)
+
+// I log dei nodi si vedono solo con -v
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// Funzione per creare e avviare una simulazione, fermata a fine test
+func start(t *testing.T, config Config) *Simulator {
+	t.Helper()
+	sim := NewSimulator(config)
+	t.Cleanup(sim.Stop)
+	if err := sim.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Quattro nodi in catena: i blocchi e le transazioni arrivano
+// da un capo all'altro e tutti vedono gli stessi bilanci
+func TestPropagation(t *testing.T) {
+	sim := start(t, Config{Nodes: 4, Latency: 50 * time.Millisecond, Seed: 1})
+	check(t, sim.ConnectLine())
+
+	for i := 0; i < 3; i++ {
+		sim.Mine(0)
+	}
+	check(t, sim.AssertHeight(3))
+
+	recipient := sim.Nodes[3].Miner.BlockchainAddress()
+	if err := sim.Send(0, recipient, 1.5, 3); err != nil {
+		t.Fatalf("transaction rejected: %v", err)
+	}
+	sim.Mine(1)
+	check(t, sim.AssertConverged())
+	check(t, sim.AssertHeight(4))
+	check(t, sim.AssertBalance(recipient, 1.5))
+	check(t, sim.AssertBalance(sim.Nodes[0].Miner.BlockchainAddress(), 3*blockchain.MINING_REWARD-1.5))
+	check(t, sim.AssertBalance(sim.Nodes[1].Miner.BlockchainAddress(), blockchain.MINING_REWARD))
+}
+
+// Due gruppi di nodi separati da una partizione minano catene
+// diverse, quando la rete si ricongiunge vince la più lunga e
+// il gruppo che aveva la più corta la riordina
+func TestPartition(t *testing.T) {
+	sim := start(t, Config{Nodes: 4, Latency: 20 * time.Millisecond, Seed: 1, FullMesh: true})
+	sim.Mine(0)
+	check(t, sim.AssertHeight(1))
+
+	sim.Partition([]int{0, 1}, []int{2, 3})
+	// Le connessioni tra i gruppi scadono
+	sim.Run(2 * time.Minute)
+	sim.Mine(0)
+	sim.Mine(1)
+	sim.Mine(2)
+	sim.Mine(3)
+	sim.Mine(2)
+	// Ogni gruppo vede solo i propri blocchi
+	for i, expected := range []int{3, 3, 4, 4} {
+		if h := sim.Nodes[i].Blockchain.Height(); h != expected {
+			t.Fatalf("%s has height %d before healing, expected %d", sim.Nodes[i].Name, h, expected)
+		}
+	}
+	losing := sim.Snapshot(0)
+	winning := sim.Snapshot(2)
+
+	sim.Heal()
+	// La discovery riconnette i gruppi e la sincronizzazione
+	// porta tutti sulla catena più lunga
+	sim.Run(time.Minute)
+	check(t, sim.AssertConverged())
+	check(t, sim.AssertHeight(4))
+	check(t, sim.AssertReorgDepth(0, losing, 2))
+	check(t, sim.AssertReorgDepth(1, losing, 2))
+	check(t, sim.AssertReorgDepth(2, winning, 0))
+	// I blocchi del gruppo perdente non contano più
+	check(t, sim.AssertBalance(sim.Nodes[0].Miner.BlockchainAddress(), blockchain.MINING_REWARD))
+	check(t, sim.AssertBalance(sim.Nodes[1].Miner.BlockchainAddress(), 0))
+	check(t, sim.AssertBalance(sim.Nodes[2].Miner.BlockchainAddress(), 2*blockchain.MINING_REWARD))
+	check(t, sim.AssertBalance(sim.Nodes[3].Miner.BlockchainAddress(), blockchain.MINING_REWARD))
+}
+
+// Rete con latenza variabile e messaggi persi: qualche annuncio non
+// arriva, ma il blocco successivo fa sincronizzare chi è rimasto indietro
+func TestLossy(t *testing.T) {
+	for _, seed := range []int64{1, 2, 3} {
+		sim := start(t, Config{
+			Nodes:    5,
+			Latency:  80 * time.Millisecond,
+			Jitter:   40 * time.Millisecond,
+			Seed:     seed,
+			FullMesh: true,
+		})
+		sim.Network.SetLossRate(0.1)
+		for i := 0; i < 10; i++ {
+			sim.Mine(i % len(sim.Nodes))
+			sim.Run(5 * time.Second)
+		}
+		// Senza perdite un ultimo blocco minato sulla catena più
+		// lunga raggiunge tutti
+		sim.Network.SetLossRate(0)
+		heights := sim.Heights()
+		best := 0
+		for i, h := range heights {
+			if h > heights[best] {
+				best = i
+			}
+		}
+		sim.Mine(best)
+		sim.Run(30 * time.Second)
+		if err := sim.AssertConverged(); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if err := sim.AssertHeight(heights[best] + 1); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+	}
+}
+
+// Con lo stesso seed la simulazione con perdite e jitter va sempre
+// nello stesso modo
+func TestDeterministic(t *testing.T) {
+	run := func() []int {
+		sim := start(t, Config{
+			Nodes:    5,
+			Latency:  80 * time.Millisecond,
+			Jitter:   40 * time.Millisecond,
+			Seed:     7,
+			FullMesh: true,
+		})
+		defer sim.Stop()
+		sim.Network.SetLossRate(0.2)
+		for i := 0; i < 6; i++ {
+			sim.Mine(i % len(sim.Nodes))
+			sim.Run(time.Second)
+		}
+		return sim.Heights()
+	}
+	first := run()
+	for i := 0; i < 3; i++ {
+		if again := run(); !equal(first, again) {
+			t.Fatalf("heights %v, then %v", first, again)
+		}
+	}
+}
+
+// Funzione che confronta due liste di altezze
+func equal(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -35,6 +35,17 @@ func String2BigIntTuple(s string) (big.Int, big.Int) {
 	return bix, biy
 }
 
+// Funzione che controlla che s sia una coppia di interi a 256 bit in
+// esadecimale, il formato delle chiavi pubbliche e delle firme, prima
+// di passarla a SignatureFromString o a PublicKeyFromString
+func IsHex256Pair(s string) bool {
+	if len(s) != 128 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
 // Funzione che restituisce la signature a partire dalla versione string della signature
 func SignatureFromString(s string) *Signature {
 	x, y := String2BigIntTuple(s)
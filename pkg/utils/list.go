@@ -0,0 +1,15 @@
+package utils
+
+import "strings"
+
+// Funzione per dividere una lista separata da virgole, come quelle dei
+// flag, senza spazi e senza elementi vuoti
+func SplitList(s string) []string {
+	list := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
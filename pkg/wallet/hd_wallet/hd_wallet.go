@@ -0,0 +1,288 @@
+package hd_wallet
+
+import (
+	"context"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Derivazione delle chiavi figlie come in BIP32, con le regole di
+// SLIP-10 per la curva P-256 delle chiavi dei wallet
+const (
+	// Chiave HMAC della chiave master, quella di SLIP-10 per P-256
+	MASTER_KEY = "Nist256p1 seed"
+	// Gli indici da qui in su sono derivati in modo hardened: la
+	// chiave figlia dipende dalla private key del padre
+	HARDENED = uint32(1) << 31
+)
+
+// Path delle chiavi dei wallet, come in BIP44:
+// m / purpose' / coin_type' / account' / change / address_index
+const (
+	PURPOSE = 44
+	// Coin type di SLIP-44 per le reti di test, questa blockchain
+	// non ne ha uno registrato
+	COIN_TYPE = 1
+	// Catena degli indirizzi da dare agli altri e catena dei resti
+	EXTERNAL_CHAIN = 0
+	INTERNAL_CHAIN = 1
+	// Indirizzi consecutivi mai usati dopo i quali la scansione si
+	// ferma
+	GAP_LIMIT = 20
+)
+
+// Il path non è nel formato "m/44'/1'/0'/0/0"
+var ErrInvalidPath = errors.New("invalid derivation path")
+
+// Chiave estesa: la private key con il chain code, da cui si
+// derivano le chiavi figlie
+type ExtendedKey struct {
+	key       []byte
+	chainCode []byte
+	path      string
+}
+
+// Funzione che ritorna la chiave master del seed
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("seed must be 16 to 64 bytes, not %d", len(seed))
+	}
+	mac := hmac.New(sha512.New, []byte(MASTER_KEY))
+	mac.Write(seed)
+	i := mac.Sum(nil)
+	// Se la chiave non è valida si rifà l'HMAC del risultato
+	for !validKey(i[:32]) {
+		mac = hmac.New(sha512.New, []byte(MASTER_KEY))
+		mac.Write(i)
+		i = mac.Sum(nil)
+	}
+	return &ExtendedKey{key: i[:32], chainCode: i[32:], path: "m"}, nil
+}
+
+// Funzione che dice se i 32 byte sono una private key valida
+func validKey(b []byte) bool {
+	k := new(big.Int).SetBytes(b)
+	return k.Sign() > 0 && k.Cmp(elliptic.P256().Params().N) < 0
+}
+
+// Metodo che deriva la chiave figlia con l'indice, hardened se
+// index >= HARDENED
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	curve := elliptic.P256()
+	n := curve.Params().N
+	data := make([]byte, 0, 37)
+	if index >= HARDENED {
+		data = append(append(data, 0x00), k.key...)
+	} else {
+		data = append(data, k.compressedPublicKey()...)
+	}
+	data = appendIndex(data, index)
+	for {
+		mac := hmac.New(sha512.New, k.chainCode)
+		mac.Write(data)
+		i := mac.Sum(nil)
+		il := new(big.Int).SetBytes(i[:32])
+		child := new(big.Int).Add(il, new(big.Int).SetBytes(k.key))
+		child.Mod(child, n)
+		if il.Cmp(n) < 0 && child.Sign() != 0 {
+			return &ExtendedKey{key: child.FillBytes(make([]byte, 32)), chainCode: i[32:], path: k.path + "/" + formatIndex(index)}, nil
+		}
+		// Caso quasi impossibile: SLIP-10 riprova con la seconda
+		// metà del risultato
+		data = appendIndex(append([]byte{0x01}, i[32:]...), index)
+	}
+}
+
+// Funzione che aggiunge l'indice in 4 byte big-endian
+func appendIndex(data []byte, index uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, index)
+	return append(data, b...)
+}
+
+// Metodo che deriva la chiave del path, relativo alla chiave se non
+// comincia con "m"
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, absolute, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if absolute && k.path != "m" {
+		return nil, fmt.Errorf("%w: %s is absolute but the key is not a master key", ErrInvalidPath, path)
+	}
+	child := k
+	for _, index := range indexes {
+		if child, err = child.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return child, nil
+}
+
+// Funzione che legge un path come "m/44'/1'/0'/0/5": gli indici con
+// ' o h sono hardened
+// Ritorna anche se il path parte dalla chiave master
+func ParsePath(path string) ([]uint32, bool, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	absolute := parts[0] == "m"
+	if absolute {
+		parts = parts[1:]
+	}
+	indexes := make([]uint32, 0, len(parts))
+	for _, p := range parts {
+		hardened := strings.HasSuffix(p, "'") || strings.HasSuffix(p, "h")
+		if hardened {
+			p = p[:len(p)-1]
+		}
+		index, err := strconv.ParseUint(p, 10, 32)
+		if err != nil || uint32(index) >= HARDENED {
+			return nil, false, fmt.Errorf("%w: %q", ErrInvalidPath, path)
+		}
+		if hardened {
+			index += uint64(HARDENED)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, absolute, nil
+}
+
+// Funzione che scrive l'indice come nei path
+func formatIndex(index uint32) string {
+	if index >= HARDENED {
+		return strconv.FormatUint(uint64(index-HARDENED), 10) + "'"
+	}
+	return strconv.FormatUint(uint64(index), 10)
+}
+
+// Funzione che ritorna il path dell'indirizzo dell'account
+func AddressPath(account uint32, change uint32, index uint32) string {
+	return fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", PURPOSE, COIN_TYPE, account, change, index)
+}
+
+// Getter del path della chiave
+func (k *ExtendedKey) Path() string {
+	return k.path
+}
+
+// Metodo che ritorna la chiave pubblica compressa: 0x02 o 0x03 per
+// la parità di Y, poi X
+func (k *ExtendedKey) compressedPublicKey() []byte {
+	x, y := elliptic.P256().ScalarBaseMult(k.key)
+	return append([]byte{0x02 + byte(y.Bit(0))}, x.FillBytes(make([]byte, 32))...)
+}
+
+// Metodo che ritorna il fingerprint della chiave, i primi 4 byte del
+// RIPEMD-160 del SHA-256 della chiave pubblica compressa, in
+// esadecimale
+// Quello della chiave master identifica il seed senza rivelarlo
+func (k *ExtendedKey) Fingerprint() string {
+	h := sha256.Sum256(k.compressedPublicKey())
+	r := ripemd160.New()
+	r.Write(h[:])
+	return hex.EncodeToString(r.Sum(nil)[:4])
+}
+
+// Metodo che ritorna il wallet della chiave, con lo stesso formato
+// di indirizzo dei wallet casuali
+func (k *ExtendedKey) Wallet() *wallet.Wallet {
+	w, _ := wallet.NewWalletFromBytes(k.key)
+	return w
+}
+
+// Metodo che ritorna la chiave dell'account: m/44'/1'/account'
+func (k *ExtendedKey) Account(account uint32) (*ExtendedKey, error) {
+	if account >= HARDENED {
+		return nil, fmt.Errorf("%w: account %d", ErrInvalidPath, account)
+	}
+	return k.Derive(fmt.Sprintf("m/%d'/%d'/%d'", PURPOSE, COIN_TYPE, account))
+}
+
+// Metodo che deriva dalla chiave dell'account il wallet dell'indirizzo
+// con l'indice, sulla catena esterna o su quella dei resti
+func (k *ExtendedKey) Address(change uint32, index uint32) (*wallet.Wallet, error) {
+	child, err := k.Derive(formatIndex(change) + "/" + formatIndex(index))
+	if err != nil {
+		return nil, err
+	}
+	return child.Wallet(), nil
+}
+
+// Funzione che chiede al nodo quali indirizzi compaiono in almeno
+// una transazione, ritorna un valore per ogni indirizzo
+type UsedFunc func(ctx context.Context, addresses []string) ([]bool, error)
+
+// Funzione che cerca gli indirizzi usati sulla catena esterna della
+// chiave dell'account, a blocchi di gapLimit indirizzi, finché non
+// ne trova gapLimit consecutivi mai usati
+// Ritorna l'indice successivo all'ultimo indirizzo usato, 0 se
+// l'account non è mai stato usato
+func Scan(ctx context.Context, account *ExtendedKey, gapLimit int, used UsedFunc) (uint32, error) {
+	if gapLimit <= 0 {
+		gapLimit = GAP_LIMIT
+	}
+	next, unused := uint32(0), 0
+	for index := uint32(0); unused < gapLimit; {
+		addresses := make([]string, gapLimit)
+		for i := range addresses {
+			w, err := account.Address(EXTERNAL_CHAIN, index+uint32(i))
+			if err != nil {
+				return 0, err
+			}
+			addresses[i] = w.BlockchainAddress()
+		}
+		result, err := used(ctx, addresses)
+		if err != nil {
+			return 0, err
+		}
+		if len(result) != len(addresses) {
+			return 0, fmt.Errorf("expected %d results, got %d", len(addresses), len(result))
+		}
+		for i, u := range result {
+			if u {
+				next, unused = index+uint32(i)+1, 0
+			} else {
+				unused++
+			}
+		}
+		index += uint32(gapLimit)
+	}
+	return next, nil
+}
+
+// Funzione che cerca gli account usati, come in BIP44: si passa al
+// successivo solo se quello prima ha almeno un indirizzo usato
+// Ritorna per ogni account usato l'indice successivo all'ultimo
+// indirizzo usato, almeno un account anche se è vuoto
+func ScanAccounts(ctx context.Context, master *ExtendedKey, gapLimit int, used UsedFunc) ([]uint32, error) {
+	accounts := make([]uint32, 0)
+	for a := uint32(0); a < HARDENED; a++ {
+		account, err := master.Account(a)
+		if err != nil {
+			return nil, err
+		}
+		next, err := Scan(ctx, account, gapLimit, used)
+		if err != nil {
+			return nil, err
+		}
+		if next == 0 {
+			if a == 0 {
+				accounts = append(accounts, 0)
+			}
+			break
+		}
+		accounts = append(accounts, next)
+	}
+	return accounts, nil
+}
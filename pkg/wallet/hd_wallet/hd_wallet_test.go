@@ -0,0 +1,300 @@
+package hd_wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	check(t, err)
+	return b
+}
+
+// Vettori di BIP39, quelli di trezor/python-mnemonic con la passphrase
+// "TREZOR"
+func TestBip39Vectors(t *testing.T) {
+	vectors := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{
+			"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			"80808080808080808080808080808080",
+			"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+			"d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8",
+		},
+		{
+			"ffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+			"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+		},
+		{
+			"9e885d952ad362caeb4efe34a8e91bd2",
+			"ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic",
+			"274ddc525802f7c828d8ef7ddbcdc5304e87ac3535913611fbbfa986d0c9e5476c91689f9c8a54fd55bd38606aa6a8595ad213d4c9c9f9aca3fb217069a41028",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+			"bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+		},
+		{
+			"68a79eaca2324873eacc50cb9c6eca8cc68ea5d936f98787c60c7ebc74e6ce7c",
+			"hamster diagram private dutch cause delay private meat slide toddler razor book happy fancy gospel tennis maple dilemma loan word shrug inflict delay length",
+			"64c87cde7e12ecf6704ab95bb1408bef047c22db4cc7491c4271d170a1b213d20b385bc1588d9c7b38f1b39d415665b8a9030c9ec653d75e65f847d8fc1fc440",
+		},
+	}
+	for _, v := range vectors {
+		mnemonic, err := NewMnemonic(decodeHex(t, v.entropy))
+		check(t, err)
+		if mnemonic != v.mnemonic {
+			t.Errorf("entropy %s: mnemonic %q, expected %q", v.entropy, mnemonic, v.mnemonic)
+		}
+		entropy, err := MnemonicEntropy(v.mnemonic)
+		check(t, err)
+		if hex.EncodeToString(entropy) != v.entropy {
+			t.Errorf("%q: entropy %x, expected %s", v.mnemonic, entropy, v.entropy)
+		}
+		seed, err := Seed(v.mnemonic, "TREZOR")
+		check(t, err)
+		if hex.EncodeToString(seed) != v.seed {
+			t.Errorf("%q: seed %x, expected %s", v.mnemonic, seed, v.seed)
+		}
+	}
+
+	// Maiuscole e spazi in più non cambiano il seed
+	seed, err := Seed("  Legal WINNER thank year wave sausage worth useful legal winner thank yellow ", "TREZOR")
+	check(t, err)
+	if hex.EncodeToString(seed) != vectors[1].seed {
+		t.Error("the mnemonic is not normalized")
+	}
+}
+
+// Le frasi sbagliate non danno un seed
+func TestInvalidMnemonic(t *testing.T) {
+	tests := map[string]struct {
+		mnemonic string
+		expected error
+	}{
+		"checksum":     {"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", ErrChecksum},
+		"swapped":      {"legal winner thank year wave sausage worth useful legal winner yellow thank", ErrChecksum},
+		"unknown word": {"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon bitcoin", ErrUnknownWord},
+		"11 words":     {"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", ErrMnemonicLength},
+		"13 words":     {"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", ErrMnemonicLength},
+		"empty":        {"", ErrMnemonicLength},
+	}
+	for name, test := range tests {
+		if ValidMnemonic(test.mnemonic) {
+			t.Errorf("%s: valid", name)
+		}
+		if _, err := Seed(test.mnemonic, ""); !errors.Is(err, test.expected) {
+			t.Errorf("%s: %v, expected %v", name, err, test.expected)
+		}
+	}
+	if _, err := NewMnemonic(make([]byte, 15)); err == nil {
+		t.Error("mnemonic of 120 bits")
+	}
+	for _, bits := range []int{128, 160, 192, 224, 256} {
+		mnemonic, err := GenerateMnemonic(bits)
+		check(t, err)
+		if words := len(strings.Fields(mnemonic)); words != (bits+bits/32)/WORD_BITS || !ValidMnemonic(mnemonic) {
+			t.Errorf("%d bits: %d words, valid %v", bits, words, ValidMnemonic(mnemonic))
+		}
+	}
+}
+
+// Chiave attesa di un path dei vettori di SLIP-10 per nist256p1
+type slip10Vector struct {
+	path      string
+	chainCode string
+	key       string
+	publicKey string
+}
+
+// Funzione che controlla le chiavi derivate dal seed con i vettori
+func checkSlip10(t *testing.T, seed string, vectors []slip10Vector) {
+	t.Helper()
+	master, err := NewMasterKey(decodeHex(t, seed))
+	check(t, err)
+	for _, v := range vectors {
+		k, err := master.Derive(v.path)
+		check(t, err)
+		if k.Path() != v.path {
+			t.Errorf("path %s, expected %s", k.Path(), v.path)
+		}
+		if got := hex.EncodeToString(k.chainCode); got != v.chainCode {
+			t.Errorf("%s: chain code %s, expected %s", v.path, got, v.chainCode)
+		}
+		if got := hex.EncodeToString(k.key); got != v.key {
+			t.Errorf("%s: private key %s, expected %s", v.path, got, v.key)
+		}
+		if got := hex.EncodeToString(k.compressedPublicKey()); got != v.publicKey {
+			t.Errorf("%s: public key %s, expected %s", v.path, got, v.publicKey)
+		}
+	}
+}
+
+// Vettore 1 di SLIP-10 per nist256p1: figli hardened e non hardened
+func TestSlip10Vector1(t *testing.T) {
+	checkSlip10(t, "000102030405060708090a0b0c0d0e0f", []slip10Vector{
+		{"m", "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2", "0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8"},
+		{"m/0'", "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c", "0384610f5ecffe8fda089363a41f56a5c7ffc1d81b59a612d0d649b2d22355590c"},
+		{"m/0'/1", "4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c", "284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129", "03526c63f8d0b4bbbf9c80df553fe66742df4676b241dabefdef67733e070f6844"},
+		{"m/0'/1/2'", "98c7514f562e64e74170cc3cf304ee1ce54d6b6da4f880f313e8204c2a185318", "694596e8a54f252c960eb771a3c41e7e32496d03b954aeb90f61635b8e092aa7", "0359cf160040778a4b14c5f4d7b76e327ccc8c4a6086dd9451b7482b5a4972dda0"},
+		{"m/0'/1/2'/2", "ba96f776a5c3907d7fd48bde5620ee374d4acfd540378476019eab70790c63a0", "5996c37fd3dd2679039b23ed6f70b506c6b56b3cb5e424681fb0fa64caf82aaa", "029f871f4cb9e1c97f9f4de9ccd0d4a2f2a171110c61178f84430062230833ff20"},
+		{"m/0'/1/2'/2/1000000000", "b9b7b82d326bb9cb5b5b121066feea4eb93d5241103c9e7a18aad40f1dde8059", "21c4f269ef0a5fd1badf47eeacebeeaa3de22eb8e5b0adcd0f27dd99d34d0119", "02216cd26d31147f72427a453c443ed2cde8a1e53c9cc44e5ddf739725413fe3f4"},
+	})
+
+	// Il fingerprint della chiave master è quello che i vettori danno
+	// come fingerprint del padre di m/0'
+	master, err := NewMasterKey(decodeHex(t, "000102030405060708090a0b0c0d0e0f"))
+	check(t, err)
+	if fingerprint := master.Fingerprint(); fingerprint != "be6105b5" {
+		t.Errorf("fingerprint %s, expected be6105b5", fingerprint)
+	}
+}
+
+// Vettore 2 di SLIP-10 per nist256p1: il primo figlio non è hardened
+func TestSlip10Vector2(t *testing.T) {
+	checkSlip10(t, "fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542", []slip10Vector{
+		{"m", "96cd4465a9644e31528eda3592aa35eb39a9527769ce1855beafc1b81055e75d", "eaa31c2e46ca2962227cf21d73a7ef0ce8b31c756897521eb6c7b39796633357", "02c9e16154474b3ed5b38218bb0463e008f89ee03e62d22fdcc8014beab25b48fa"},
+		{"m/0", "84e9c258bb8557a40e0d041115b376dd55eda99c0042ce29e81ebe4efed9b86a", "d7d065f63a62624888500cdb4f88b6d59c2927fee9e6d0cdff9cad555884df6e", "039b6df4bece7b6c81e2adfeea4bcf5c8c8a6e40ea7ffa3cf6e8494c61a1fc82cc"},
+		{"m/0/2147483647'", "f235b2bc5c04606ca9c30027a84f353acf4e4683edbd11f635d0dcc1cd106ea6", "96d2ec9316746a75e7793684ed01e3d51194d81a42a3276858a5b7376d4b94b9", "02f89c5deb1cae4fedc9905f98ae6cbf6cbab120d8cb85d5bd9a91a72f4c068c76"},
+		{"m/0/2147483647'/1", "7c0b833106235e452eba79d2bdd58d4086e663bc8cc55e9773d2b5eeda313f3b", "974f9096ea6873a915910e82b29d7c338542ccde39d2064d1cc228f371542bbc", "03abe0ad54c97c1d654c1852dfdc32d6d3e487e75fa16f0fd6304b9ceae4220c64"},
+		{"m/0/2147483647'/1/2147483646'", "5794e616eadaf33413aa309318a26ee0fd5163b70466de7a4512fd4b1a5c9e6a", "da29649bbfaff095cd43819eda9a7be74236539a29094cd8336b07ed8d4eff63", "03cb8cb067d248691808cd6b5a5a06b48e34ebac4d965cba33e6dc46fe13d9b933"},
+		{"m/0/2147483647'/1/2147483646'/2", "3bfb29ee8ac4484f09db09c2079b520ea5616df7820f071a20320366fbe226a7", "bb0a77ba01cc31d77205d51d08bd313b979a71ef4de9b062f8958297e746bd67", "020ee02e18967237cf62672983b253ee62fa4dd431f8243bfeccdf39dbe181387f"},
+	})
+}
+
+// Vettori di SLIP-10 per nist256p1 in cui l'HMAC va rifatto, per la
+// chiave master e per una chiave figlia
+func TestSlip10Retry(t *testing.T) {
+	checkSlip10(t, "a7305bc8df8d0951f0cb224c0e95d7707cbdf2c6ce7e8d481fec69c7ff5e9446", []slip10Vector{
+		{"m", "7762f9729fed06121fd13f326884c82f59aa95c57ac492ce8c9654e60efd130c", "3b8c18469a4634517d6d0b65448f8e6c62091b45540a1743c5846be55d47d88f", "0383619fadcde31063d8c5cb00dbfe1713f3e6fa169d8541a798752a1c1ca0cb20"},
+	})
+	checkSlip10(t, "000102030405060708090a0b0c0d0e0f", []slip10Vector{
+		{"m/28578'", "e94c8ebe30c2250a14713212f6449b20f3329105ea15b652ca5bdfc68f6c65c2", "06f0db126f023755d0b8d86d4591718a5210dd8d024e3e14b6159d63f53aa669", "02519b5554a4872e8c9c1c847115363051ec43e93400e030ba3c36b52a3e70a5b7"},
+		{"m/28578'/33941", "9e87fe95031f14736774cd82f25fd885065cb7c358c1edf813c72af535e83071", "092154eed4af83e078ff9b84322015aefe5769e31270f62c3f66c33888335f3a", "0235bfee614c0d5b2cae260000bb1d0d84b270099ad790022c1ae0b2e782efe120"},
+	})
+}
+
+// Gli indirizzi dei wallet sono in m/44'/1'/account'/change/index:
+// Account e Address derivano le stesse chiavi del path completo
+func TestBip44Path(t *testing.T) {
+	seed, err := Seed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	check(t, err)
+	master, err := NewMasterKey(seed)
+	check(t, err)
+	for _, p := range []struct {
+		account, change, index uint32
+		path                   string
+	}{
+		{0, EXTERNAL_CHAIN, 0, "m/44'/1'/0'/0/0"},
+		{0, INTERNAL_CHAIN, 3, "m/44'/1'/0'/1/3"},
+		{7, EXTERNAL_CHAIN, 19, "m/44'/1'/7'/0/19"},
+	} {
+		if path := AddressPath(p.account, p.change, p.index); path != p.path {
+			t.Errorf("path %s, expected %s", path, p.path)
+		}
+		account, err := master.Account(p.account)
+		check(t, err)
+		w, err := account.Address(p.change, p.index)
+		check(t, err)
+		k, err := master.Derive(p.path)
+		check(t, err)
+		if w.BlockchainAddress() != k.Wallet().BlockchainAddress() || w.PrivateKeyStr() != k.Wallet().PrivateKeyStr() {
+			t.Errorf("%s: the account derives another key", p.path)
+		}
+	}
+
+	if _, err := master.Account(HARDENED); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("account %d: %v, expected %v", HARDENED, err, ErrInvalidPath)
+	}
+	account, err := master.Account(0)
+	check(t, err)
+	if _, err := account.Derive("m/0"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("absolute path from an account: %v, expected %v", err, ErrInvalidPath)
+	}
+}
+
+// I path si leggono con ' o h per gli indici hardened
+func TestParsePath(t *testing.T) {
+	indexes, absolute, err := ParsePath("m/44'/1h/0'/0/5")
+	check(t, err)
+	expected := []uint32{44 + HARDENED, 1 + HARDENED, HARDENED, 0, 5}
+	if !absolute || len(indexes) != len(expected) {
+		t.Fatalf("parsed %v, absolute %v", indexes, absolute)
+	}
+	for i := range expected {
+		if indexes[i] != expected[i] {
+			t.Fatalf("parsed %v, expected %v", indexes, expected)
+		}
+	}
+	for _, path := range []string{"m/", "m/a", "m/2147483648", "m/-1", "m/1''", "m//1"} {
+		if _, _, err := ParsePath(path); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%q: %v, expected %v", path, err, ErrInvalidPath)
+		}
+	}
+}
+
+// La scansione si ferma dopo gapLimit indirizzi mai usati, anche se
+// l'ultimo usato è oltre il primo blocco, e passa all'account
+// successivo solo se quello prima è stato usato
+func TestScan(t *testing.T) {
+	master, err := NewMasterKey(decodeHex(t, "000102030405060708090a0b0c0d0e0f"))
+	check(t, err)
+	usedAddresses := make(map[string]bool)
+	use := func(account uint32, index uint32) {
+		a, err := master.Account(account)
+		check(t, err)
+		w, err := a.Address(EXTERNAL_CHAIN, index)
+		check(t, err)
+		usedAddresses[w.BlockchainAddress()] = true
+	}
+	use(0, 2)
+	use(0, 6)
+	use(1, 0)
+	used := func(ctx context.Context, addresses []string) ([]bool, error) {
+		result := make([]bool, len(addresses))
+		for i, a := range addresses {
+			result[i] = usedAddresses[a]
+		}
+		return result, nil
+	}
+
+	accounts, err := ScanAccounts(context.Background(), master, 5, used)
+	check(t, err)
+	if len(accounts) != 2 || accounts[0] != 7 || accounts[1] != 1 {
+		t.Fatalf("accounts %v, expected [7 1]", accounts)
+	}
+	empty, err := NewMasterKey(decodeHex(t, "fffcf9f6f3f0edeae7e4e1dedbd8d5d2"))
+	check(t, err)
+	accounts, err = ScanAccounts(context.Background(), empty, 5, used)
+	check(t, err)
+	if len(accounts) != 1 || accounts[0] != 0 {
+		t.Fatalf("accounts of an empty seed %v, expected [0]", accounts)
+	}
+}
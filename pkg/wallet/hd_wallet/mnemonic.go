@@ -0,0 +1,145 @@
+package hd_wallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Frasi mnemoniche come in BIP39: l'entropia più i primi bit del
+// suo sha256 come checksum, divisi in gruppi di 11 bit, ognuno
+// l'indice di una parola della lista inglese di BIP39
+const (
+	// Entropia delle frasi nuove: 128 bit, 12 parole
+	DEFAULT_ENTROPY_BITS = 128
+	MIN_ENTROPY_BITS     = 128
+	MAX_ENTROPY_BITS     = 256
+	// Bit di ogni parola
+	WORD_BITS = 11
+	// Iterazioni di PBKDF2 e lunghezza del seed, in byte
+	SEED_ITERATIONS = 2048
+	SEED_LENGTH     = 64
+)
+
+// Lista delle 2048 parole, la stessa di BIP39, quindi una frase
+// generata qui si può scrivere e controllare con gli strumenti BIP39
+//
+//go:embed english.txt
+var english string
+
+var (
+	wordList  = strings.Fields(english)
+	wordIndex = indexWords(wordList)
+)
+
+var (
+	// Il numero di parole non corrisponde a un'entropia valida
+	ErrMnemonicLength = errors.New("mnemonic must have 12, 15, 18, 21 or 24 words")
+	// Una parola non è nella lista
+	ErrUnknownWord = errors.New("unknown mnemonic word")
+	// Il checksum non corrisponde, di solito per una parola sbagliata
+	// o nell'ordine sbagliato
+	ErrChecksum = errors.New("invalid mnemonic checksum")
+)
+
+func indexWords(words []string) map[string]int {
+	index := make(map[string]int, len(words))
+	for i, w := range words {
+		index[w] = i
+	}
+	return index
+}
+
+// Funzione che genera una frase nuova con bits bit di entropia
+func GenerateMnemonic(bits int) (string, error) {
+	if bits < MIN_ENTROPY_BITS || bits > MAX_ENTROPY_BITS || bits%32 != 0 {
+		return "", fmt.Errorf("entropy must be 128, 160, 192, 224 or 256 bits, not %d", bits)
+	}
+	entropy := make([]byte, bits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	return NewMnemonic(entropy)
+}
+
+// Funzione che ritorna la frase dell'entropia, da 16 a 32 byte
+func NewMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < MIN_ENTROPY_BITS || bits > MAX_ENTROPY_BITS || bits%32 != 0 {
+		return "", fmt.Errorf("entropy must be 16, 20, 24, 28 or 32 bytes, not %d", len(entropy))
+	}
+	// Il checksum è lungo un bit ogni 32 di entropia
+	checksumBits := bits / 32
+	hash := sha256.Sum256(entropy)
+	n := new(big.Int).SetBytes(entropy)
+	n.Lsh(n, uint(checksumBits))
+	n.Or(n, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	count := (bits + checksumBits) / WORD_BITS
+	words := make([]string, count)
+	mask := big.NewInt(1<<WORD_BITS - 1)
+	for i := count - 1; i >= 0; i-- {
+		words[i] = wordList[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, WORD_BITS)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// Funzione che ritorna l'entropia della frase, dopo aver controllato
+// le parole e il checksum
+func MnemonicEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	count := len(words)
+	if count < 12 || count > 24 || count%3 != 0 {
+		return nil, ErrMnemonicLength
+	}
+	n := new(big.Int)
+	for _, w := range words {
+		i, ok := wordIndex[w]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownWord, w)
+		}
+		n.Lsh(n, WORD_BITS)
+		n.Or(n, big.NewInt(int64(i)))
+	}
+	checksumBits := count * WORD_BITS / 33
+	checksum := byte(new(big.Int).And(n, big.NewInt(int64(1)<<checksumBits-1)).Int64())
+	n.Rsh(n, uint(checksumBits))
+	entropy := n.FillBytes(make([]byte, checksumBits*4))
+	hash := sha256.Sum256(entropy)
+	if hash[0]>>(8-checksumBits) != checksum {
+		return nil, ErrChecksum
+	}
+	return entropy, nil
+}
+
+// Funzione che dice se la frase è valida
+func ValidMnemonic(mnemonic string) bool {
+	_, err := MnemonicEntropy(mnemonic)
+	return err == nil
+}
+
+// Funzione che normalizza la frase: minuscole e un solo spazio tra
+// le parole, come va passata a Seed
+func NormalizeMnemonic(mnemonic string) string {
+	return strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+}
+
+// Funzione che ritorna il seed da 64 byte della frase, con la
+// passphrase opzionale: PBKDF2 con HMAC-SHA512, 2048 iterazioni e
+// "mnemonic"+passphrase come sale
+// A differenza di BIP39 il testo non viene normalizzato in NFKD,
+// quindi il seed è lo stesso per le frasi e le passphrase ASCII
+func Seed(mnemonic string, passphrase string) ([]byte, error) {
+	if _, err := MnemonicEntropy(mnemonic); err != nil {
+		return nil, err
+	}
+	return pbkdf2.Key([]byte(NormalizeMnemonic(mnemonic)), []byte("mnemonic"+passphrase), SEED_ITERATIONS, SEED_LENGTH, sha512.New), nil
+}
@@ -0,0 +1,458 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Formato dei file del keystore, descritto in docs/keystore.md
+// Ogni file contiene una sola chiave, cifrata con AES-256-GCM con
+// una chiave derivata dalla password con scrypt
+const (
+	VERSION = 1
+	KDF     = "scrypt"
+	CIPHER  = "aes-256-gcm"
+	// Estensione dei file, il nome è l'indirizzo del wallet
+	EXTENSION = ".json"
+)
+
+// Parametri di scrypt dei nuovi file, quelli raccomandati per le
+// password interattive: circa 32MB di memoria per ogni derivazione
+const (
+	SCRYPT_N = 1 << 15
+	SCRYPT_R = 8
+	SCRYPT_P = 1
+	// Lunghezza del sale e della chiave derivata, in byte
+	SALT_LENGTH = 32
+	KEY_LENGTH  = 32
+)
+
+// Limiti dei parametri letti da un file, per non bloccare il
+// processo con un file costruito apposta
+const (
+	MAX_SCRYPT_N = 1 << 20
+	MAX_SCRYPT_R = 32
+	MAX_SCRYPT_P = 16
+)
+
+var (
+	// La password non decifra la chiave, o il file è stato modificato
+	ErrWrongPassword = errors.New("wrong password or corrupted key file")
+	// Nel keystore non c'è una chiave per l'indirizzo
+	ErrNotFound = errors.New("key not found")
+	// Nel keystore c'è già una chiave per l'indirizzo
+	ErrExists = errors.New("key already exists")
+	// Le chiavi non si salvano senza password
+	ErrEmptyPassword = errors.New("empty password")
+)
+
+// Parametri di scrypt
+type ScryptParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+}
+
+// Parte cifrata del file
+type Crypto struct {
+	Kdf        string       `json:"kdf"`
+	KdfParams  ScryptParams `json:"kdf_params"`
+	Cipher     string       `json:"cipher"`
+	Nonce      string       `json:"nonce"`
+	Ciphertext string       `json:"ciphertext"`
+}
+
+// File del keystore: l'indirizzo e la chiave pubblica sono in
+// chiaro, così si possono elencare le chiavi senza la password, e
+// vengono autenticati insieme alla chiave privata cifrata
+// Le chiavi derivate da un seed hanno anche l'id del seed e il path
+type KeyFile struct {
+	Version           int    `json:"version"`
+	BlockchainAddress string `json:"blockchain_address"`
+	PublicKey         string `json:"public_key"`
+	Seed              string `json:"seed,omitempty"`
+	Path              string `json:"path,omitempty"`
+	Crypto            Crypto `json:"crypto"`
+	Created           int64  `json:"created"`
+}
+
+// Funzione che cifra la chiave privata del wallet con la password
+func Encrypt(w *wallet.Wallet, password string) (*KeyFile, error) {
+	return encrypt(w, password, &KeyFile{Created: time.Now().Unix()})
+}
+
+// Funzione che cifra la chiave privata con la password, con la data
+// di creazione, il seed e il path di info
+func encrypt(w *wallet.Wallet, password string, info *KeyFile) (*KeyFile, error) {
+	kf := &KeyFile{
+		Version:           VERSION,
+		BlockchainAddress: w.BlockchainAddress(),
+		PublicKey:         w.PublicKeyStr(),
+		Seed:              info.Seed,
+		Path:              info.Path,
+		Created:           info.Created,
+	}
+	plaintext := w.PrivateKey().D.FillBytes(make([]byte, KEY_LENGTH))
+	c, err := seal(plaintext, password, kf.additionalData())
+	if err != nil {
+		return nil, err
+	}
+	kf.Crypto = *c
+	return kf, nil
+}
+
+// Metodo che decifra la chiave privata e ricrea il wallet
+// Ritorna ErrWrongPassword se la password è sbagliata o se il
+// file è stato modificato
+func (kf *KeyFile) Decrypt(password string) (*wallet.Wallet, error) {
+	if kf.Version != VERSION {
+		return nil, fmt.Errorf("unsupported key file version %d", kf.Version)
+	}
+	plaintext, err := kf.Crypto.open(password, kf.additionalData())
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext) != KEY_LENGTH {
+		return nil, ErrWrongPassword
+	}
+	w, err := wallet.NewWalletFromBytes(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	// L'indirizzo e la chiave pubblica sono autenticati, ma si
+	// controlla comunque che corrispondano alla chiave
+	if w.BlockchainAddress() != kf.BlockchainAddress || w.PublicKeyStr() != kf.PublicKey {
+		return nil, ErrWrongPassword
+	}
+	return w, nil
+}
+
+// Dati autenticati insieme alla chiave privata: tutto quello che
+// nel file è in chiaro e descrive la chiave
+// Seed e path si aggiungono solo se ci sono, così i file delle
+// chiavi casuali restano quelli di prima
+func (kf *KeyFile) additionalData() []byte {
+	ad := fmt.Sprintf("%d|%s|%s|%d", kf.Version, kf.BlockchainAddress, kf.PublicKey, kf.Created)
+	if kf.Seed != "" || kf.Path != "" {
+		ad += fmt.Sprintf("|%s|%s", kf.Seed, kf.Path)
+	}
+	return []byte(ad)
+}
+
+// Funzione che cifra plaintext con una chiave derivata dalla password,
+// con un sale e un nonce nuovi
+func seal(plaintext []byte, password string, additionalData []byte) (*Crypto, error) {
+	if password == "" {
+		return nil, ErrEmptyPassword
+	}
+	salt := make([]byte, SALT_LENGTH)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	c := &Crypto{
+		Kdf:       KDF,
+		KdfParams: ScryptParams{N: SCRYPT_N, R: SCRYPT_R, P: SCRYPT_P, Salt: hex.EncodeToString(salt)},
+		Cipher:    CIPHER,
+	}
+	aead, err := c.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	c.Nonce = hex.EncodeToString(nonce)
+	c.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, plaintext, additionalData))
+	return c, nil
+}
+
+// Metodo che decifra il testo cifrato con la password
+// Ritorna ErrWrongPassword se la password è sbagliata o se i dati
+// sono stati modificati
+func (c *Crypto) open(password string, additionalData []byte) ([]byte, error) {
+	if c.Kdf != KDF || c.Cipher != CIPHER {
+		return nil, fmt.Errorf("unsupported kdf %q or cipher %q", c.Kdf, c.Cipher)
+	}
+	aead, err := c.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(c.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	ciphertext, err := hex.DecodeString(c.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext")
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	return plaintext, nil
+}
+
+// Metodo che deriva dalla password la chiave AES e ritorna il
+// cifrario autenticato
+func (c *Crypto) aead(password string) (cipher.AEAD, error) {
+	p := c.KdfParams
+	if p.N <= 1 || p.N&(p.N-1) != 0 || p.N > MAX_SCRYPT_N || p.R <= 0 || p.R > MAX_SCRYPT_R || p.P <= 0 || p.P > MAX_SCRYPT_P {
+		return nil, fmt.Errorf("invalid scrypt parameters n=%d r=%d p=%d", p.N, p.R, p.P)
+	}
+	salt, err := hex.DecodeString(p.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("invalid salt")
+	}
+	key, err := scrypt.Key([]byte(password), salt, p.N, p.R, p.P, KEY_LENGTH)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Funzione che ricrea il wallet da una chiave privata in esadecimale,
+// per importare nel keystore le chiavi salvate in chiaro
+func ParsePrivateKey(privateKey string) (*wallet.Wallet, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(privateKey))
+	if err != nil || len(b) == 0 || len(b) > KEY_LENGTH {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	return wallet.NewWalletFromBytes(append(make([]byte, KEY_LENGTH-len(b)), b...))
+}
+
+// Funzione che legge un file del keystore, senza decifrarlo
+func ReadFile(path string) (*KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kf KeyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	return &kf, nil
+}
+
+// Metodo per scrivere il file, leggibile solo dal proprietario
+func (kf *KeyFile) WriteFile(path string) error {
+	return writeFile(path, kf)
+}
+
+// Funzione che scrive v in json nel file, leggibile solo dal
+// proprietario
+// Il file viene scritto a parte e poi rinominato, così un errore
+// a metà non rovina la chiave che c'era prima
+func writeFile(path string, v interface{}) error {
+	m, _ := json.MarshalIndent(v, "", "  ")
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, m, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Keystore: una directory con un file per ogni chiave, chiamato
+// come l'indirizzo del wallet
+type Keystore struct {
+	dir string
+	// Serializza le modifiche ai file dei seed e degli account multisig
+	mu sync.Mutex
+}
+
+// Funzione per creare il keystore nella directory, che viene creata
+// al primo salvataggio
+func NewKeystore(dir string) *Keystore {
+	return &Keystore{dir: dir}
+}
+
+// Getter della directory
+func (ks *Keystore) Dir() string {
+	return ks.dir
+}
+
+// Metodo che ritorna il path del file dell'indirizzo
+func (ks *Keystore) Path(blockchainAddress string) string {
+	return filepath.Join(ks.dir, blockchainAddress+EXTENSION)
+}
+
+// Metodo per salvare il wallet cifrato con la password
+// Ritorna ErrExists se c'è già, per cambiare la password di una
+// chiave salvata si usa ChangePassword
+func (ks *Keystore) Save(w *wallet.Wallet, password string) error {
+	_, err := ks.save(w, password, &KeyFile{Created: time.Now().Unix()})
+	return err
+}
+
+// Metodo che salva il wallet con la data di creazione, il seed e il
+// path di info
+func (ks *Keystore) save(w *wallet.Wallet, password string, info *KeyFile) (*KeyFile, error) {
+	path := ks.Path(w.BlockchainAddress())
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%s: %w", w.BlockchainAddress(), ErrExists)
+	}
+	kf, err := encrypt(w, password, info)
+	if err != nil {
+		return nil, err
+	}
+	return kf, kf.WriteFile(path)
+}
+
+// Metodo che crea un nuovo wallet e lo salva
+func (ks *Keystore) Create(password string) (*wallet.Wallet, error) {
+	w := wallet.NewWallet()
+	if err := ks.Save(w, password); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Metodo che legge il file dell'indirizzo, senza decifrarlo
+func (ks *Keystore) KeyFile(blockchainAddress string) (*KeyFile, error) {
+	if !validName(blockchainAddress) {
+		return nil, fmt.Errorf("%s: %w", blockchainAddress, ErrNotFound)
+	}
+	kf, err := ReadFile(ks.Path(blockchainAddress))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", blockchainAddress, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if kf.BlockchainAddress != blockchainAddress {
+		return nil, fmt.Errorf("key file %s contains address %s", ks.Path(blockchainAddress), kf.BlockchainAddress)
+	}
+	return kf, nil
+}
+
+// Metodo che carica e decifra il wallet dell'indirizzo
+func (ks *Keystore) Load(blockchainAddress string, password string) (*wallet.Wallet, error) {
+	kf, err := ks.KeyFile(blockchainAddress)
+	if err != nil {
+		return nil, err
+	}
+	return kf.Decrypt(password)
+}
+
+// Metodo che ritorna i file del keystore, ordinati per indirizzo
+// I file che non sono chiavi valide vengono saltati
+func (ks *Keystore) List() ([]*KeyFile, error) {
+	entries, err := os.ReadDir(ks.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []*KeyFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*KeyFile, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, EXTENSION) {
+			continue
+		}
+		kf, err := ks.KeyFile(strings.TrimSuffix(name, EXTENSION))
+		if err != nil || kf.Version != VERSION {
+			continue
+		}
+		list = append(list, kf)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].BlockchainAddress < list[j].BlockchainAddress
+	})
+	return list, nil
+}
+
+// Metodo che cifra di nuovo la chiave con un'altra password, con un
+// nuovo sale e i parametri di scrypt attuali
+func (ks *Keystore) ChangePassword(blockchainAddress string, oldPassword string, newPassword string) error {
+	old, err := ks.KeyFile(blockchainAddress)
+	if err != nil {
+		return err
+	}
+	w, err := old.Decrypt(oldPassword)
+	if err != nil {
+		return err
+	}
+	kf, err := encrypt(w, newPassword, old)
+	if err != nil {
+		return err
+	}
+	return kf.WriteFile(ks.Path(blockchainAddress))
+}
+
+// Funzione che dice se l'indirizzo si può usare come nome di file
+func validName(blockchainAddress string) bool {
+	return blockchainAddress != "" && !strings.ContainsAny(blockchainAddress, `/\.`)
+}
+
+// Metodo che carica la chiave con cui un servizio firma: quella
+// dell'indirizzo se è indicato, altrimenti l'unica del keystore,
+// che viene creata se il keystore è vuoto
+// Ritorna anche se la chiave è stata creata
+func (ks *Keystore) LoadOrCreate(blockchainAddress string, password string) (*wallet.Wallet, bool, error) {
+	if blockchainAddress != "" {
+		w, err := ks.Load(blockchainAddress, password)
+		return w, false, err
+	}
+	list, err := ks.List()
+	if err != nil {
+		return nil, false, err
+	}
+	switch len(list) {
+	case 0:
+		w, err := ks.Create(password)
+		return w, err == nil, err
+	case 1:
+		w, err := list[0].Decrypt(password)
+		return w, false, err
+	}
+	return nil, false, fmt.Errorf("%d keys in %s, choose the address to use", len(list), ks.dir)
+}
+
+// Variabile d'ambiente con la password del keystore, usata dai
+// comandi quando non viene indicato un file
+const PASSWORD_ENV = "KEYSTORE_PASSWORD"
+
+// Funzione che legge la password dal file, senza l'a capo finale,
+// o se path è vuoto dalla variabile d'ambiente PASSWORD_ENV
+func ReadPassword(path string) (string, error) {
+	if path == "" {
+		if password := os.Getenv(PASSWORD_ENV); password != "" {
+			return password, nil
+		}
+		return "", fmt.Errorf("%w: set %s or use a password file", ErrEmptyPassword, PASSWORD_ENV)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	password := strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("%w in %s", ErrEmptyPassword, path)
+	}
+	return password, nil
+}
@@ -0,0 +1,199 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+)
+
+const PASSWORD = "keystore-test-password"
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Funzione che cambia il primo byte di un valore in esadecimale
+func flipHex(t *testing.T, s string) string {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	check(t, err)
+	b[0] ^= 0x01
+	return hex.EncodeToString(b)
+}
+
+// Una chiave salvata si rilegge uguale dal keystore e dopo il cambio
+// di password si apre solo con la nuova
+func TestRoundTrip(t *testing.T) {
+	ks := NewKeystore(t.TempDir())
+	w, err := ks.Create(PASSWORD)
+	check(t, err)
+	if err := ks.Save(w, PASSWORD); !errors.Is(err, ErrExists) {
+		t.Fatalf("saving twice: %v, expected %v", err, ErrExists)
+	}
+
+	loaded, err := ks.Load(w.BlockchainAddress(), PASSWORD)
+	check(t, err)
+	if loaded.PrivateKeyStr() != w.PrivateKeyStr() || loaded.BlockchainAddress() != w.BlockchainAddress() {
+		t.Fatal("the loaded key is not the saved one")
+	}
+	list, err := ks.List()
+	check(t, err)
+	if len(list) != 1 || list[0].BlockchainAddress != w.BlockchainAddress() || list[0].PublicKey != w.PublicKeyStr() {
+		t.Fatalf("listed %+v", list)
+	}
+
+	check(t, ks.ChangePassword(w.BlockchainAddress(), PASSWORD, "new-"+PASSWORD))
+	if _, err := ks.Load(w.BlockchainAddress(), PASSWORD); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("old password: %v, expected %v", err, ErrWrongPassword)
+	}
+	loaded, err = ks.Load(w.BlockchainAddress(), "new-"+PASSWORD)
+	check(t, err)
+	if loaded.PrivateKeyStr() != w.PrivateKeyStr() {
+		t.Fatal("changing the password changed the key")
+	}
+
+	imported, err := ParsePrivateKey(w.PrivateKeyStr())
+	check(t, err)
+	if imported.BlockchainAddress() != w.BlockchainAddress() {
+		t.Fatal("the imported key has another address")
+	}
+}
+
+// Password sbagliate e file modificati non si aprono: il testo cifrato,
+// il nonce e il sale sono autenticati, come l'indirizzo, la chiave
+// pubblica, la data e il path, che sono in chiaro
+func TestDecryptErrors(t *testing.T) {
+	w := wallet.NewWallet()
+	other := wallet.NewWallet()
+	encrypted, err := encrypt(w, PASSWORD, &KeyFile{Created: 1700000000, Seed: "0a1b2c3d", Path: "m/44'/1'/0'/0/0"})
+	check(t, err)
+
+	tests := map[string]struct {
+		password string
+		modify   func(kf *KeyFile)
+		expected error
+	}{
+		"wrong password":   {password: "wrong", expected: ErrWrongPassword},
+		"empty password":   {password: "", expected: ErrWrongPassword},
+		"ciphertext":       {modify: func(kf *KeyFile) { kf.Crypto.Ciphertext = flipHex(t, kf.Crypto.Ciphertext) }, expected: ErrWrongPassword},
+		"truncated":        {modify: func(kf *KeyFile) { kf.Crypto.Ciphertext = kf.Crypto.Ciphertext[:len(kf.Crypto.Ciphertext)-2] }, expected: ErrWrongPassword},
+		"nonce":            {modify: func(kf *KeyFile) { kf.Crypto.Nonce = flipHex(t, kf.Crypto.Nonce) }, expected: ErrWrongPassword},
+		"salt":             {modify: func(kf *KeyFile) { kf.Crypto.KdfParams.Salt = flipHex(t, kf.Crypto.KdfParams.Salt) }, expected: ErrWrongPassword},
+		"address":          {modify: func(kf *KeyFile) { kf.BlockchainAddress = other.BlockchainAddress() }, expected: ErrWrongPassword},
+		"public key":       {modify: func(kf *KeyFile) { kf.PublicKey = other.PublicKeyStr() }, expected: ErrWrongPassword},
+		"created":          {modify: func(kf *KeyFile) { kf.Created++ }, expected: ErrWrongPassword},
+		"seed":             {modify: func(kf *KeyFile) { kf.Seed = "ffffffff" }, expected: ErrWrongPassword},
+		"path":             {modify: func(kf *KeyFile) { kf.Path = "m/44'/1'/0'/0/1" }, expected: ErrWrongPassword},
+		"version":          {modify: func(kf *KeyFile) { kf.Version = VERSION + 1 }},
+		"cipher":           {modify: func(kf *KeyFile) { kf.Crypto.Cipher = "aes-128-ctr" }},
+		"kdf":              {modify: func(kf *KeyFile) { kf.Crypto.Kdf = "pbkdf2" }},
+		"scrypt n":         {modify: func(kf *KeyFile) { kf.Crypto.KdfParams.N = 1000 }},
+		"scrypt n too big": {modify: func(kf *KeyFile) { kf.Crypto.KdfParams.N = MAX_SCRYPT_N * 2 }},
+		"scrypt r":         {modify: func(kf *KeyFile) { kf.Crypto.KdfParams.R = MAX_SCRYPT_R + 1 }},
+		"invalid nonce":    {modify: func(kf *KeyFile) { kf.Crypto.Nonce = "zz" }},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			kf := *encrypted
+			password := PASSWORD
+			if test.modify != nil {
+				test.modify(&kf)
+			} else {
+				password = test.password
+			}
+			_, err := kf.Decrypt(password)
+			if err == nil {
+				t.Fatal("decrypted")
+			}
+			if test.expected != nil && !errors.Is(err, test.expected) {
+				t.Fatalf("%v, expected %v", err, test.expected)
+			}
+		})
+	}
+
+	decrypted, err := encrypted.Decrypt(PASSWORD)
+	check(t, err)
+	if decrypted.PrivateKeyStr() != w.PrivateKeyStr() {
+		t.Fatal("the decrypted key is not the encrypted one")
+	}
+	if _, err := Encrypt(w, ""); !errors.Is(err, ErrEmptyPassword) {
+		t.Fatalf("empty password: %v, expected %v", err, ErrEmptyPassword)
+	}
+}
+
+// Anche il seed è autenticato con il suo id e la data
+func TestSeedTampering(t *testing.T) {
+	seed := make([]byte, 64)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	sf, err := EncryptSeed(seed, PASSWORD)
+	check(t, err)
+	_, err = sf.Decrypt(PASSWORD)
+	check(t, err)
+
+	for name, modify := range map[string]func(sf *SeedFile){
+		"ciphertext": func(sf *SeedFile) { sf.Crypto.Ciphertext = flipHex(t, sf.Crypto.Ciphertext) },
+		"id":         func(sf *SeedFile) { sf.ID = "ffffffff" },
+		"created":    func(sf *SeedFile) { sf.Created++ },
+	} {
+		c := *sf
+		modify(&c)
+		if _, err := c.Decrypt(PASSWORD); !errors.Is(err, ErrWrongPassword) {
+			t.Errorf("%s: %v, expected %v", name, err, ErrWrongPassword)
+		}
+	}
+	if _, err := sf.Decrypt("wrong"); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("wrong password: %v, expected %v", err, ErrWrongPassword)
+	}
+}
+
+// I file delle chiavi e dei seed li legge solo il proprietario, e le
+// directory che il keystore crea le apre solo lui
+func TestFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix permissions")
+	}
+	ks := NewKeystore(filepath.Join(t.TempDir(), "keystore"))
+	w, err := ks.Create(PASSWORD)
+	check(t, err)
+	seed := make([]byte, 64)
+	sf, err := ks.SaveSeed(seed, PASSWORD)
+	check(t, err)
+
+	for path, mode := range map[string]os.FileMode{
+		ks.Dir():                           0700,
+		ks.Path(w.BlockchainAddress()):     0600,
+		filepath.Join(ks.Dir(), SEEDS_DIR): 0700,
+		ks.SeedPath(sf.ID):                 0600,
+	} {
+		info, err := os.Stat(path)
+		check(t, err)
+		if perm := info.Mode().Perm(); perm != mode {
+			t.Errorf("%s has mode %o, expected %o", path, perm, mode)
+		}
+	}
+	if _, err := os.Stat(ks.Path(w.BlockchainAddress()) + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("the temporary file was left behind")
+	}
+}
+
+// Gli indirizzi che non sono nomi di file validi non escono dal
+// keystore
+func TestInvalidAddress(t *testing.T) {
+	ks := NewKeystore(t.TempDir())
+	for _, address := range []string{"", "../key", `a\b`, "a.json"} {
+		if _, err := ks.KeyFile(address); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%q: %v, expected %v", address, err, ErrNotFound)
+		}
+	}
+}
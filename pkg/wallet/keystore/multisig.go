@@ -0,0 +1,111 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+)
+
+// Sottodirectory del keystore con le policy degli account multisig,
+// un file per account chiamato con il suo address
+const MULTISIG_DIR = "multisig"
+
+// File di un account multisig: la policy è pubblica e non è cifrata,
+// le chiavi private sono dei firmatari, ognuno nel suo keystore
+type MultisigFile struct {
+	Version           int    `json:"version"`
+	BlockchainAddress string `json:"blockchain_address"`
+	multisig.Policy
+	Created int64 `json:"created"`
+}
+
+// Metodo che ritorna il path del file dell'account multisig
+func (ks *Keystore) MultisigPath(blockchainAddress string) string {
+	return filepath.Join(ks.dir, MULTISIG_DIR, blockchainAddress+EXTENSION)
+}
+
+// Metodo che salva la policy di un account multisig
+// Ritorna ErrExists, con il file già salvato, se l'account c'è già
+func (ks *Keystore) SaveMultisig(p *multisig.Policy) (*MultisigFile, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	mf := &MultisigFile{
+		Version:           VERSION,
+		BlockchainAddress: p.Address(),
+		Policy:            *p,
+		Created:           time.Now().Unix(),
+	}
+	if old, err := ks.multisigFile(mf.BlockchainAddress); err == nil {
+		return old, fmt.Errorf("%s: %w", mf.BlockchainAddress, ErrExists)
+	}
+	return mf, writeFile(ks.MultisigPath(mf.BlockchainAddress), mf)
+}
+
+// Metodo che legge il file dell'account multisig
+func (ks *Keystore) MultisigFile(blockchainAddress string) (*MultisigFile, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.multisigFile(blockchainAddress)
+}
+
+func (ks *Keystore) multisigFile(blockchainAddress string) (*MultisigFile, error) {
+	if !validName(blockchainAddress) {
+		return nil, fmt.Errorf("multisig %s: %w", blockchainAddress, ErrNotFound)
+	}
+	data, err := os.ReadFile(ks.MultisigPath(blockchainAddress))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("multisig %s: %w", blockchainAddress, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var mf MultisigFile
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return nil, fmt.Errorf("invalid multisig file %s: %w", ks.MultisigPath(blockchainAddress), err)
+	}
+	// L'address si ricalcola dalla policy, il file non è autenticato
+	if err := mf.Validate(); err != nil || mf.Address() != blockchainAddress {
+		return nil, fmt.Errorf("multisig file %s does not contain the policy of %s", ks.MultisigPath(blockchainAddress), blockchainAddress)
+	}
+	return &mf, nil
+}
+
+// Metodo che ritorna gli account multisig del keystore, ordinati per
+// address
+func (ks *Keystore) MultisigList() ([]*MultisigFile, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	entries, err := os.ReadDir(filepath.Join(ks.dir, MULTISIG_DIR))
+	if errors.Is(err, os.ErrNotExist) {
+		return []*MultisigFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*MultisigFile, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, EXTENSION) {
+			continue
+		}
+		mf, err := ks.multisigFile(strings.TrimSuffix(name, EXTENSION))
+		if err != nil || mf.Version != VERSION {
+			continue
+		}
+		list = append(list, mf)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].BlockchainAddress < list[j].BlockchainAddress
+	})
+	return list, nil
+}
@@ -0,0 +1,286 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/hd_wallet"
+)
+
+// Sottodirectory del keystore con i seed dei wallet HD, un file per
+// seed chiamato con il suo id
+const SEEDS_DIR = "seeds"
+
+// Account di un seed con il numero di indirizzi derivati sulla
+// catena esterna: il prossimo ha indice Addresses
+type Account struct {
+	Index     uint32 `json:"index"`
+	Addresses uint32 `json:"addresses"`
+}
+
+// File di un seed: il seed da 64 byte è cifrato come le chiavi,
+// l'id e gli account sono in chiaro
+// L'id è il fingerprint della chiave master e viene autenticato, gli
+// account cambiano a ogni indirizzo derivato e non lo sono
+type SeedFile struct {
+	Version  int        `json:"version"`
+	ID       string     `json:"id"`
+	Crypto   Crypto     `json:"crypto"`
+	Accounts []*Account `json:"accounts"`
+	Created  int64      `json:"created"`
+}
+
+// Funzione che cifra il seed con la password
+func EncryptSeed(seed []byte, password string) (*SeedFile, error) {
+	master, err := hd_wallet.NewMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	sf := &SeedFile{
+		Version:  VERSION,
+		ID:       master.Fingerprint(),
+		Accounts: []*Account{},
+		Created:  time.Now().Unix(),
+	}
+	c, err := seal(seed, password, sf.additionalData())
+	if err != nil {
+		return nil, err
+	}
+	sf.Crypto = *c
+	return sf, nil
+}
+
+// Metodo che decifra il seed e ritorna la chiave master
+func (sf *SeedFile) Decrypt(password string) (*hd_wallet.ExtendedKey, error) {
+	if sf.Version != VERSION {
+		return nil, fmt.Errorf("unsupported seed file version %d", sf.Version)
+	}
+	seed, err := sf.Crypto.open(password, sf.additionalData())
+	if err != nil {
+		return nil, err
+	}
+	master, err := hd_wallet.NewMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	if master.Fingerprint() != sf.ID {
+		return nil, ErrWrongPassword
+	}
+	return master, nil
+}
+
+// Dati autenticati insieme al seed
+func (sf *SeedFile) additionalData() []byte {
+	return []byte(fmt.Sprintf("%d|seed|%s|%d", sf.Version, sf.ID, sf.Created))
+}
+
+// Metodo che ritorna l'account con l'indice, creandolo se non c'è
+func (sf *SeedFile) account(index uint32) *Account {
+	for _, a := range sf.Accounts {
+		if a.Index == index {
+			return a
+		}
+	}
+	a := &Account{Index: index}
+	sf.Accounts = append(sf.Accounts, a)
+	sort.Slice(sf.Accounts, func(i, j int) bool {
+		return sf.Accounts[i].Index < sf.Accounts[j].Index
+	})
+	return a
+}
+
+// Metodo che ritorna il path del file del seed
+func (ks *Keystore) SeedPath(id string) string {
+	return filepath.Join(ks.dir, SEEDS_DIR, id+EXTENSION)
+}
+
+// Metodo che salva il seed cifrato con la password
+// Ritorna ErrExists, con il file già salvato, se il seed c'è già
+func (ks *Keystore) SaveSeed(seed []byte, password string) (*SeedFile, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	sf, err := EncryptSeed(seed, password)
+	if err != nil {
+		return nil, err
+	}
+	if old, err := ks.seedFile(sf.ID); err == nil {
+		return old, fmt.Errorf("seed %s: %w", sf.ID, ErrExists)
+	}
+	return sf, writeFile(ks.SeedPath(sf.ID), sf)
+}
+
+// Metodo che legge il file del seed, senza decifrarlo
+func (ks *Keystore) SeedFile(id string) (*SeedFile, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.seedFile(id)
+}
+
+func (ks *Keystore) seedFile(id string) (*SeedFile, error) {
+	if !validName(id) {
+		return nil, fmt.Errorf("seed %s: %w", id, ErrNotFound)
+	}
+	data, err := os.ReadFile(ks.SeedPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("seed %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sf SeedFile
+	if err := json.Unmarshal(data, &sf); err != nil {
+		return nil, fmt.Errorf("invalid seed file %s: %w", ks.SeedPath(id), err)
+	}
+	if sf.ID != id {
+		return nil, fmt.Errorf("seed file %s contains seed %s", ks.SeedPath(id), sf.ID)
+	}
+	return &sf, nil
+}
+
+// Metodo che ritorna i seed del keystore, ordinati per id
+func (ks *Keystore) Seeds() ([]*SeedFile, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	entries, err := os.ReadDir(filepath.Join(ks.dir, SEEDS_DIR))
+	if errors.Is(err, os.ErrNotExist) {
+		return []*SeedFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*SeedFile, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, EXTENSION) {
+			continue
+		}
+		sf, err := ks.seedFile(strings.TrimSuffix(name, EXTENSION))
+		if err != nil || sf.Version != VERSION {
+			continue
+		}
+		list = append(list, sf)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+// Metodo che ritorna le chiavi del keystore derivate dal seed,
+// ordinate per account e indice
+func (ks *Keystore) SeedKeys(id string) ([]*KeyFile, error) {
+	list, err := ks.List()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*KeyFile, 0)
+	indexes := make(map[*KeyFile][]uint32)
+	for _, kf := range list {
+		if kf.Seed == id {
+			keys = append(keys, kf)
+			indexes[kf], _, _ = hd_wallet.ParsePath(kf.Path)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := indexes[keys[i]], indexes[keys[j]]
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return keys, nil
+}
+
+// Metodo che deriva il prossimo indirizzo dell'account e lo salva
+// nel keystore, cifrato con la password del seed
+func (ks *Keystore) DeriveAddress(id string, account uint32, password string) (*KeyFile, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	sf, master, err := ks.loadSeed(id, password)
+	if err != nil {
+		return nil, err
+	}
+	a := sf.account(account)
+	keys, err := ks.deriveAddresses(sf, master, a, a.Addresses+1, password)
+	if err != nil {
+		return nil, err
+	}
+	return keys[0], nil
+}
+
+// Metodo che porta gli account del seed almeno al numero di indirizzi
+// di addresses, uno per account a partire da 0, per esempio dopo una
+// scansione: gli indirizzi mancanti vengono derivati e salvati
+// Ritorna le chiavi dei nuovi indirizzi
+func (ks *Keystore) ExtendAccounts(id string, addresses []uint32, password string) ([]*KeyFile, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	sf, master, err := ks.loadSeed(id, password)
+	if err != nil {
+		return nil, err
+	}
+	saved := make([]*KeyFile, 0)
+	for i, count := range addresses {
+		a := sf.account(uint32(i))
+		keys, err := ks.deriveAddresses(sf, master, a, count, password)
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, keys...)
+	}
+	// Anche un account senza indirizzi finisce nel file
+	return saved, writeFile(ks.SeedPath(id), sf)
+}
+
+// Metodo che legge e decifra il seed
+func (ks *Keystore) loadSeed(id string, password string) (*SeedFile, *hd_wallet.ExtendedKey, error) {
+	sf, err := ks.seedFile(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	master, err := sf.Decrypt(password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sf, master, nil
+}
+
+// Metodo che deriva e salva gli indirizzi dell'account fino all'indice
+// count escluso, poi aggiorna il file del seed
+// Le chiavi già nel keystore, per esempio importate, vengono lasciate
+// come sono e ritornate insieme alle altre
+func (ks *Keystore) deriveAddresses(sf *SeedFile, master *hd_wallet.ExtendedKey, a *Account, count uint32, password string) ([]*KeyFile, error) {
+	if count <= a.Addresses {
+		return []*KeyFile{}, nil
+	}
+	accountKey, err := master.Account(a.Index)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*KeyFile, 0, count-a.Addresses)
+	for index := a.Addresses; index < count; index++ {
+		w, err := accountKey.Address(hd_wallet.EXTERNAL_CHAIN, index)
+		if err != nil {
+			return nil, err
+		}
+		info := &KeyFile{Seed: sf.ID, Path: hd_wallet.AddressPath(a.Index, hd_wallet.EXTERNAL_CHAIN, index), Created: time.Now().Unix()}
+		kf, err := ks.save(w, password, info)
+		if errors.Is(err, ErrExists) {
+			kf, err = ks.KeyFile(w.BlockchainAddress())
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, kf)
+	}
+	a.Addresses = count
+	return keys, writeFile(ks.SeedPath(sf.ID), sf)
+}
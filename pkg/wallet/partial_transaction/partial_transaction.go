@@ -0,0 +1,294 @@
+package partial_transaction
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	blockchain_transaction_request "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/unsigned_transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+)
+
+// Versione del formato delle transazioni parzialmente firmate
+const VERSION = 1
+
+var (
+	// La chiave non è di nessuno dei firmatari richiesti
+	ErrNotSigner = errors.New("the key is not of a required signer")
+	// Le transazioni da unire non sono la stessa transazione o non
+	// hanno gli stessi firmatari
+	ErrMismatch = errors.New("partial transactions are not for the same transaction")
+	// Mancano firme per finalizzare la transazione
+	ErrIncomplete = errors.New("partial transaction is missing signatures")
+)
+
+// Firmatario richiesto, con la sua chiave pubblica e la sua firma
+// quando ha firmato
+// I firmatari di un account multisig hanno la chiave pubblica della
+// policy anche prima di firmare
+type Signer struct {
+	BlockchainAddress string `json:"blockchain_address"`
+	PublicKey         string `json:"public_key,omitempty"`
+	Signature         string `json:"signature,omitempty"`
+}
+
+// Metodo che dice se il firmatario ha firmato
+func (s *Signer) Signed() bool {
+	return s.Signature != ""
+}
+
+// Transazione parzialmente firmata, da passare tra le parti prima di
+// inviarla: la transazione da firmare, i firmatari richiesti e le
+// firme raccolte finora
+// Ogni parte firma la sua copia, le copie si uniscono con Combine e,
+// quando ci sono abbastanza firme, Finalize dà la transazione firmata
+// Se il sender è un account multisig c'è la sua policy: i firmatari
+// sono le chiavi della policy e bastano Threshold firme
+type PartialTransaction struct {
+	Version     int                                       `json:"version"`
+	Transaction *unsigned_transaction.UnsignedTransaction `json:"transaction"`
+	Multisig    *multisig.Policy                          `json:"multisig,omitempty"`
+	Signers     []*Signer                                 `json:"signers"`
+}
+
+// Funzione per creare la transazione parzialmente firmata, senza
+// firme, a partire dalla transazione da firmare
+// L'unico firmatario richiesto è il sender, per gli account multisig
+// si usa NewMultisigPartialTransaction
+func NewPartialTransaction(ut *unsigned_transaction.UnsignedTransaction) (*PartialTransaction, error) {
+	if err := ut.Check(); err != nil {
+		return nil, err
+	}
+	return &PartialTransaction{
+		Version:     VERSION,
+		Transaction: ut,
+		Signers:     []*Signer{{BlockchainAddress: ut.SenderBlockchainAddress}},
+	}, nil
+}
+
+// Funzione per creare la transazione parzialmente firmata di un
+// account multisig, senza firme: i firmatari sono le chiavi della
+// policy, che deve essere quella dell'address del sender
+func NewMultisigPartialTransaction(ut *unsigned_transaction.UnsignedTransaction, p *multisig.Policy) (*PartialTransaction, error) {
+	if err := ut.Check(); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.Address() != ut.SenderBlockchainAddress {
+		return nil, multisig.ErrAddressMismatch
+	}
+	signers := make([]*Signer, len(p.PublicKeys))
+	for i, k := range p.PublicKeys {
+		signers[i] = &Signer{BlockchainAddress: wallet.AddressFromPublicKey(utils.PublicKeyFromString(k)), PublicKey: k}
+	}
+	return &PartialTransaction{Version: VERSION, Transaction: ut, Multisig: p, Signers: signers}, nil
+}
+
+// Metodo che controlla la transazione ricevuta da un'altra parte:
+// il payload deve corrispondere ai campi, i firmatari devono essere
+// diversi tra loro e le firme presenti devono essere valide
+func (pt *PartialTransaction) Check() error {
+	if pt.Version != VERSION {
+		return fmt.Errorf("unsupported partial transaction version %d", pt.Version)
+	}
+	if pt.Transaction == nil {
+		return errors.New("partial transaction without transaction")
+	}
+	if err := pt.Transaction.Check(); err != nil {
+		return err
+	}
+	if len(pt.Signers) == 0 {
+		return errors.New("partial transaction without signers")
+	}
+	if err := pt.checkMultisig(); err != nil {
+		return err
+	}
+	sender := pt.Multisig != nil
+	seen := make(map[string]bool, len(pt.Signers))
+	for _, s := range pt.Signers {
+		if seen[s.BlockchainAddress] {
+			return fmt.Errorf("duplicate signer %s", s.BlockchainAddress)
+		}
+		seen[s.BlockchainAddress] = true
+		sender = sender || s.BlockchainAddress == pt.Transaction.SenderBlockchainAddress
+		if !s.Signed() {
+			continue
+		}
+		if err := pt.verify(s.BlockchainAddress, s.PublicKey, s.Signature); err != nil {
+			return fmt.Errorf("signer %s: %w", s.BlockchainAddress, err)
+		}
+	}
+	if !sender {
+		return errors.New("the sender is not a signer")
+	}
+	return nil
+}
+
+// Metodo che controlla che la policy, se c'è, sia quella del sender
+// e che i firmatari siano le sue chiavi, nello stesso ordine
+func (pt *PartialTransaction) checkMultisig() error {
+	if pt.Multisig == nil {
+		return nil
+	}
+	if err := pt.Multisig.Validate(); err != nil {
+		return err
+	}
+	if pt.Multisig.Address() != pt.Transaction.SenderBlockchainAddress {
+		return multisig.ErrAddressMismatch
+	}
+	if len(pt.Signers) != len(pt.Multisig.PublicKeys) {
+		return errors.New("the signers are not the keys of the multisig policy")
+	}
+	for i, k := range pt.Multisig.PublicKeys {
+		s := pt.Signers[i]
+		if s.PublicKey != k || s.BlockchainAddress != wallet.AddressFromPublicKey(utils.PublicKeyFromString(k)) {
+			return errors.New("the signers are not the keys of the multisig policy")
+		}
+	}
+	return nil
+}
+
+// Metodo che controlla la firma di un firmatario sul payload
+func (pt *PartialTransaction) verify(address string, publicKey string, signature string) error {
+	return unsigned_transaction.VerifySignature([]byte(pt.Transaction.SigningPayload), address, publicKey, signature)
+}
+
+// Metodo che ritorna il firmatario con l'address, nil se non c'è
+func (pt *PartialTransaction) signer(address string) *Signer {
+	for _, s := range pt.Signers {
+		if s.BlockchainAddress == address {
+			return s
+		}
+	}
+	return nil
+}
+
+// Metodo che firma con la chiave del wallet, che deve essere di uno
+// dei firmatari
+func (pt *PartialTransaction) Sign(w *wallet.Wallet) error {
+	if err := pt.Check(); err != nil {
+		return err
+	}
+	s := pt.signer(w.BlockchainAddress())
+	if s == nil {
+		return fmt.Errorf("%w: %s", ErrNotSigner, w.BlockchainAddress())
+	}
+	hash := sha256.Sum256([]byte(pt.Transaction.SigningPayload))
+	r, sig, err := ecdsa.Sign(rand.Reader, w.PrivateKey(), hash[:])
+	if err != nil {
+		return err
+	}
+	signature := &utils.Signature{R: r, S: sig}
+	s.PublicKey, s.Signature = w.PublicKeyStr(), signature.String()
+	return nil
+}
+
+// Metodo che aggiunge una firma fatta altrove, per esempio nel
+// browser: la chiave pubblica dice di quale firmatario è
+func (pt *PartialTransaction) AddSignature(publicKey string, signature string) error {
+	publicKey = strings.ToLower(publicKey)
+	for _, s := range pt.Signers {
+		err := pt.verify(s.BlockchainAddress, publicKey, signature)
+		if errors.Is(err, unsigned_transaction.ErrInvalidPublicKey) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.PublicKey, s.Signature = publicKey, signature
+		return nil
+	}
+	return ErrNotSigner
+}
+
+// Metodo che ritorna gli address dei firmatari che non hanno firmato
+func (pt *PartialTransaction) Missing() []string {
+	missing := []string{}
+	for _, s := range pt.Signers {
+		if !s.Signed() {
+			missing = append(missing, s.BlockchainAddress)
+		}
+	}
+	return missing
+}
+
+// Metodo che ritorna il numero di firme necessarie: la soglia della
+// policy multisig, altrimenti tutti i firmatari
+func (pt *PartialTransaction) Threshold() int {
+	if pt.Multisig != nil {
+		return pt.Multisig.Threshold
+	}
+	return len(pt.Signers)
+}
+
+// Metodo che dice se ci sono abbastanza firme
+func (pt *PartialTransaction) Complete() bool {
+	return len(pt.Signers)-len(pt.Missing()) >= pt.Threshold()
+}
+
+// Funzione che unisce le firme di più copie della stessa transazione,
+// firmate da parti diverse, e ritorna una nuova copia
+// Se un firmatario ha firmato in più copie si tiene la prima firma
+func Combine(pts ...*PartialTransaction) (*PartialTransaction, error) {
+	if len(pts) == 0 {
+		return nil, errors.New("no partial transactions to combine")
+	}
+	for _, pt := range pts {
+		if err := pt.Check(); err != nil {
+			return nil, err
+		}
+	}
+	first := pts[0]
+	combined := &PartialTransaction{Version: VERSION, Transaction: first.Transaction, Multisig: first.Multisig, Signers: make([]*Signer, len(first.Signers))}
+	for i, s := range first.Signers {
+		c := *s
+		combined.Signers[i] = &c
+	}
+	for _, pt := range pts {
+		if *pt.Transaction != *first.Transaction || len(pt.Signers) != len(first.Signers) {
+			return nil, ErrMismatch
+		}
+		for i, s := range pt.Signers {
+			c := combined.Signers[i]
+			if s.BlockchainAddress != c.BlockchainAddress {
+				return nil, ErrMismatch
+			}
+			if s.Signed() && !c.Signed() {
+				c.PublicKey, c.Signature = s.PublicKey, s.Signature
+			}
+		}
+	}
+	return combined, nil
+}
+
+// Metodo che ritorna la transazione firmata da inviare al nodo,
+// quando ci sono abbastanza firme
+// Per un account multisig il witness ha le prime Threshold firme,
+// nell'ordine delle chiavi
+func (pt *PartialTransaction) Finalize() (*blockchain_transaction_request.TransactionRequest, error) {
+	if err := pt.Check(); err != nil {
+		return nil, err
+	}
+	if !pt.Complete() {
+		return nil, fmt.Errorf("%w: %d of %d, missing %v", ErrIncomplete, len(pt.Signers)-len(pt.Missing()), pt.Threshold(), pt.Missing())
+	}
+	if pt.Multisig == nil {
+		sender := pt.signer(pt.Transaction.SenderBlockchainAddress)
+		return pt.Transaction.Signed(sender.PublicKey, sender.Signature), nil
+	}
+	witness := &multisig.Witness{Policy: *pt.Multisig, Signatures: make([]*multisig.Signature, 0, pt.Multisig.Threshold)}
+	for _, s := range pt.Signers {
+		if s.Signed() && len(witness.Signatures) < pt.Multisig.Threshold {
+			witness.Signatures = append(witness.Signatures, &multisig.Signature{PublicKey: s.PublicKey, Signature: s.Signature})
+		}
+	}
+	return pt.Transaction.Witnessed(witness), nil
+}
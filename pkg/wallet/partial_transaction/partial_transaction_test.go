@@ -0,0 +1,190 @@
+package partial_transaction
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/unsigned_transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+)
+
+const CHAIN_ID = "partial-test"
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Funzione che ritorna una copia indipendente, come quella che una
+// parte riceve in json
+func copyOf(t *testing.T, pt *PartialTransaction) *PartialTransaction {
+	t.Helper()
+	b, err := json.Marshal(pt)
+	check(t, err)
+	c := &PartialTransaction{}
+	check(t, json.Unmarshal(b, c))
+	return c
+}
+
+// Funzione che crea un account 2 di 3 e la transazione da firmare
+// che spende i suoi fondi
+func newMultisig(t *testing.T) ([]*wallet.Wallet, *PartialTransaction) {
+	t.Helper()
+	keys := []*wallet.Wallet{wallet.NewWallet(), wallet.NewWallet(), wallet.NewWallet()}
+	p, err := multisig.NewPolicy(2, []string{keys[0].PublicKeyStr(), keys[1].PublicKeyStr(), keys[2].PublicKeyStr()})
+	check(t, err)
+	ut := unsigned_transaction.NewUnsignedTransaction(CHAIN_ID, p.Address(), wallet.NewWallet().BlockchainAddress(), 2, 0, 0)
+	pt, err := NewMultisigPartialTransaction(ut, p)
+	check(t, err)
+	return keys, pt
+}
+
+// Le parti firmano ciascuna la sua copia, le copie unite danno una
+// transazione che il nodo accetta
+func TestCombineAndFinalize(t *testing.T) {
+	keys, pt := newMultisig(t)
+	if _, err := pt.Finalize(); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("finalized without signatures: %v", err)
+	}
+
+	first, second := copyOf(t, pt), copyOf(t, pt)
+	check(t, first.Sign(keys[0]))
+	check(t, second.Sign(keys[2]))
+	if _, err := first.Finalize(); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("finalized with one signature of two: %v", err)
+	}
+
+	combined, err := Combine(pt, first, second)
+	check(t, err)
+	if !combined.Complete() || len(combined.Missing()) != 1 {
+		t.Fatalf("combined with missing %v", combined.Missing())
+	}
+	if len(first.Missing()) != 2 || len(pt.Missing()) != 3 {
+		t.Fatal("combining changed the copies")
+	}
+	tr, err := combined.Finalize()
+	check(t, err)
+	check(t, tr.Validate())
+	check(t, unsigned_transaction.Verify(tr))
+	if len(tr.Witness.Signatures) != 2 {
+		t.Fatalf("witness with %d signatures", len(tr.Witness.Signatures))
+	}
+
+	// Tutte e tre le firme: il witness ha solo le prime due
+	check(t, combined.Sign(keys[1]))
+	tr, err = combined.Finalize()
+	check(t, err)
+	check(t, unsigned_transaction.Verify(tr))
+	if len(tr.Witness.Signatures) != 2 {
+		t.Fatalf("witness with %d signatures", len(tr.Witness.Signatures))
+	}
+}
+
+// Le firme fatte altrove si aggiungono con la chiave pubblica, quelle
+// di chiavi che non firmano o di un altro payload no
+func TestAddSignature(t *testing.T) {
+	keys, pt := newMultisig(t)
+	signature, err := pt.Transaction.SignPayload(keys[1])
+	check(t, err)
+	check(t, pt.AddSignature(keys[1].PublicKeyStr(), signature))
+	if s := pt.signer(keys[1].BlockchainAddress()); !s.Signed() || len(pt.Missing()) != 2 {
+		t.Fatalf("added the signature, missing %v", pt.Missing())
+	}
+
+	outsider := wallet.NewWallet()
+	signature, err = pt.Transaction.SignPayload(outsider)
+	check(t, err)
+	if err := pt.AddSignature(outsider.PublicKeyStr(), signature); !errors.Is(err, ErrNotSigner) {
+		t.Fatalf("signature of an outsider: %v, expected %v", err, ErrNotSigner)
+	}
+	if err := pt.Sign(outsider); !errors.Is(err, ErrNotSigner) {
+		t.Fatalf("signing as an outsider: %v, expected %v", err, ErrNotSigner)
+	}
+
+	_, other := newMultisig(t)
+	signature, err = other.Transaction.SignPayload(keys[0])
+	check(t, err)
+	if err := pt.AddSignature(keys[0].PublicKeyStr(), signature); !errors.Is(err, unsigned_transaction.ErrInvalidSignature) {
+		t.Fatalf("signature of another payload: %v, expected %v", err, unsigned_transaction.ErrInvalidSignature)
+	}
+}
+
+// Le copie di transazioni diverse, o con firmatari diversi, non si
+// uniscono, e una copia con il payload o una firma cambiati non passa
+// il controllo
+func TestMismatch(t *testing.T) {
+	keys, pt := newMultisig(t)
+	_, other := newMultisig(t)
+	if _, err := Combine(pt, other); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("other transaction: %v, expected %v", err, ErrMismatch)
+	}
+
+	sender := wallet.NewWallet()
+	ut := unsigned_transaction.NewUnsignedTransaction(CHAIN_ID, sender.BlockchainAddress(), wallet.NewWallet().BlockchainAddress(), 1, 0, 0)
+	single, err := NewPartialTransaction(ut)
+	check(t, err)
+	withSigner := copyOf(t, single)
+	withSigner.Signers = append(withSigner.Signers, &Signer{BlockchainAddress: wallet.NewWallet().BlockchainAddress()})
+	if _, err := Combine(single, withSigner); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("other signers: %v, expected %v", err, ErrMismatch)
+	}
+
+	changed := copyOf(t, pt)
+	changed.Transaction.Value = 100
+	if _, err := Combine(pt, changed); !errors.Is(err, unsigned_transaction.ErrPayloadMismatch) {
+		t.Fatalf("changed value: %v, expected %v", err, unsigned_transaction.ErrPayloadMismatch)
+	}
+
+	forged := copyOf(t, pt)
+	check(t, forged.Sign(keys[0]))
+	signed := forged.signer(keys[0].BlockchainAddress())
+	for _, s := range forged.Signers {
+		if s != signed {
+			s.Signature, signed.Signature = signed.Signature, ""
+			break
+		}
+	}
+	if _, err := Combine(pt, forged); !errors.Is(err, unsigned_transaction.ErrInvalidSignature) {
+		t.Fatalf("signature moved to another signer: %v, expected %v", err, unsigned_transaction.ErrInvalidSignature)
+	}
+
+	reordered := copyOf(t, pt)
+	reordered.Signers[0], reordered.Signers[1] = reordered.Signers[1], reordered.Signers[0]
+	if err := reordered.Check(); err == nil {
+		t.Fatal("signers not in the order of the policy")
+	}
+	duplicate := copyOf(t, single)
+	duplicate.Signers = append(duplicate.Signers, duplicate.Signers[0])
+	if err := duplicate.Check(); err == nil {
+		t.Fatal("duplicate signer")
+	}
+}
+
+// La transazione di una chiave singola si finalizza con la firma del
+// sender, senza witness
+func TestSingleSigner(t *testing.T) {
+	sender := wallet.NewWallet()
+	ut := unsigned_transaction.NewUnsignedTransaction(CHAIN_ID, sender.BlockchainAddress(), wallet.NewWallet().BlockchainAddress(), 1, 0, 0)
+	pt, err := NewPartialTransaction(ut)
+	check(t, err)
+	if pt.Threshold() != 1 {
+		t.Fatalf("threshold %d", pt.Threshold())
+	}
+	check(t, pt.Sign(sender))
+	tr, err := pt.Finalize()
+	check(t, err)
+	if tr.Witness != nil || *tr.SenderPublicKey != sender.PublicKeyStr() {
+		t.Fatal("not signed by the sender")
+	}
+	check(t, unsigned_transaction.Verify(tr))
+
+	_, mp := newMultisig(t)
+	if _, err := NewMultisigPartialTransaction(ut, mp.Multisig); !errors.Is(err, multisig.ErrAddressMismatch) {
+		t.Fatalf("policy of another address: %v, expected %v", err, multisig.ErrAddressMismatch)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
 	"github.com/iltommi1995/blockchain-go/pkg/utils"
 )
 
@@ -16,6 +17,11 @@ type Transaction struct {
 	senderBloackchainAddress   string
 	recipientBlockchainAddress string
 	value                      float32
+	validAfter                 int64
+	validUntil                 int64
+	chainID                    string
+	nonce                      uint64
+	asset                      *asset.Operation
 }
 
 // Funzione per creare nuova transaction
@@ -31,6 +37,33 @@ func NewTransaction(senderPrivateKey *ecdsa.PrivateKey,
 		value:                      value}
 }
 
+// Metodo per limitare i blocchi in cui la transazione può entrare,
+// con altezze o timestamp come nelle transazioni del nodo, 0 vuol
+// dire senza limite
+func (t *Transaction) SetValidity(validAfter int64, validUntil int64) {
+	t.validAfter = validAfter
+	t.validUntil = validUntil
+}
+
+// Metodo per indicare la rete della transazione, il chain ID del nodo:
+// viene firmato con il resto, così la firma non vale sulle altre reti
+func (t *Transaction) SetChainID(chainID string) {
+	t.chainID = chainID
+}
+
+// Metodo per impostare il nonce, firmato con il resto: la catena
+// accetta lo stesso payload una volta sola, quindi due pagamenti uguali
+// devono avere nonce diversi, vedi blockchain_transaction.NewNonce
+func (t *Transaction) SetNonce(nonce uint64) {
+	t.nonce = nonce
+}
+
+// Metodo per fare della transazione un'operazione su un token, che
+// viene firmata con il resto: il valore deve essere 0
+func (t *Transaction) SetAsset(op *asset.Operation) {
+	t.asset = op
+}
+
 // Metodo per generare la signature
 func (t *Transaction) GenerateSignature() *utils.Signature {
 	// Vogliamo computare l'hash della transazione
@@ -48,12 +81,22 @@ func (t *Transaction) GenerateSignature() *utils.Signature {
 // Json della transazione
 func (t *Transaction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Sender    string  `json:"sender_blockchain_address"`
-		Recipient string  `json:"recipient_blockchain_address"`
-		Value     float32 `json:"value"`
+		Sender     string           `json:"sender_blockchain_address"`
+		Recipient  string           `json:"recipient_blockchain_address"`
+		Value      float32          `json:"value"`
+		ValidAfter int64            `json:"valid_after,omitempty"`
+		ValidUntil int64            `json:"valid_until,omitempty"`
+		ChainID    string           `json:"chain_id,omitempty"`
+		Nonce      uint64           `json:"nonce,omitempty"`
+		Asset      *asset.Operation `json:"asset,omitempty"`
 	}{
-		Sender:    t.senderBloackchainAddress,
-		Recipient: t.recipientBlockchainAddress,
-		Value:     t.value,
+		Sender:     t.senderBloackchainAddress,
+		Recipient:  t.recipientBlockchainAddress,
+		Value:      t.value,
+		ValidAfter: t.validAfter,
+		ValidUntil: t.validUntil,
+		ChainID:    t.chainID,
+		Nonce:      t.nonce,
+		Asset:      t.asset,
 	})
 }
@@ -1,22 +1,197 @@
 package transaction_request
 
+import (
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	blockchain_transaction_request "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/partial_transaction"
+)
+
 // Transaction request, che si fa lato wallet
+// La chiave del sender viene letta dal keystore del wallet server
+// e decifrata con la password
+// ValidAfter e ValidUntil sono facoltativi, come nelle transazioni
+// del nodo
+// Con Asset la transazione è un'operazione su un token, come nelle
+// transazioni del nodo, e non ha Value
 type TransactionRequest struct {
-	SenderPrivateKey           *string `json:"sender_private_key"`
-	SenderBloackchainAddress   *string `json:"sender_blockchain_address"`
+	SenderBloackchainAddress   *string          `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress *string          `json:"recipient_blockchain_address"`
+	Value                      *string          `json:"value"`
+	ValidAfter                 *int64           `json:"valid_after"`
+	ValidUntil                 *int64           `json:"valid_until"`
+	Asset                      *asset.Operation `json:"asset"`
+	Password                   *string          `json:"password"`
+}
+
+// Metodo per validare TransactionRequest
+// Ritorna un *api_error.ApiError con il primo campo che manca
+func (tr *TransactionRequest) Validate() error {
+	// Controllo se tutti i dati non sono null
+	switch {
+	case tr.SenderBloackchainAddress == nil:
+		return api_error.MissingField("sender_blockchain_address")
+	case tr.RecipientBlockchainAddress == nil:
+		return api_error.MissingField("recipient_blockchain_address")
+	case tr.Value == nil && tr.Asset == nil:
+		return api_error.MissingField("value")
+	case tr.Password == nil:
+		return api_error.MissingField("password")
+	}
+	if err := validateAsset(tr.Asset, tr.Value); err != nil {
+		return err
+	}
+	return blockchain_transaction_request.ValidateWindow(tr.ValidAfter, tr.ValidUntil)
+}
+
+// Funzione che controlla l'operazione sul token di una richiesta, che
+// sostituisce il valore
+func validateAsset(op *asset.Operation, value *string) error {
+	if op == nil {
+		return nil
+	}
+	if value != nil {
+		return api_error.InvalidField("value", "asset transactions have no value, the amount is in asset")
+	}
+	if err := op.Validate(); err != nil {
+		return api_error.InvalidField("asset", err.Error())
+	}
+	return nil
+}
+
+// Richiesta di una transazione da firmare fuori dal wallet server:
+// come TransactionRequest ma senza password, la chiave non serve
+type UnsignedTransactionRequest struct {
+	SenderBlockchainAddress    *string          `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress *string          `json:"recipient_blockchain_address"`
+	Value                      *string          `json:"value"`
+	ValidAfter                 *int64           `json:"valid_after"`
+	ValidUntil                 *int64           `json:"valid_until"`
+	Asset                      *asset.Operation `json:"asset"`
+}
+
+// Metodo per validare UnsignedTransactionRequest
+func (ur *UnsignedTransactionRequest) Validate() error {
+	switch {
+	case ur.SenderBlockchainAddress == nil || *ur.SenderBlockchainAddress == "":
+		return api_error.MissingField("sender_blockchain_address")
+	case ur.RecipientBlockchainAddress == nil || *ur.RecipientBlockchainAddress == "":
+		return api_error.MissingField("recipient_blockchain_address")
+	case ur.Value == nil && ur.Asset == nil:
+		return api_error.MissingField("value")
+	}
+	if err := validateAsset(ur.Asset, ur.Value); err != nil {
+		return err
+	}
+	return blockchain_transaction_request.ValidateWindow(ur.ValidAfter, ur.ValidUntil)
+}
+
+// Richiesta di firma di una transazione parzialmente firmata: con la
+// password firma la chiave dell'address nel keystore del wallet
+// server, con chiave pubblica e firma si aggiunge una firma fatta
+// altrove
+type PartialSignRequest struct {
+	PartialTransaction *partial_transaction.PartialTransaction `json:"partial_transaction"`
+	BlockchainAddress  *string                                 `json:"blockchain_address"`
+	Password           *string                                 `json:"password"`
+	PublicKey          *string                                 `json:"public_key"`
+	Signature          *string                                 `json:"signature"`
+}
+
+// Metodo per validare PartialSignRequest
+func (sr *PartialSignRequest) Validate() error {
+	switch {
+	case sr.PartialTransaction == nil:
+		return api_error.MissingField("partial_transaction")
+	case sr.PublicKey != nil || sr.Signature != nil:
+		if sr.PublicKey == nil {
+			return api_error.MissingField("public_key")
+		}
+		if sr.Signature == nil {
+			return api_error.MissingField("signature")
+		}
+	case sr.BlockchainAddress == nil || *sr.BlockchainAddress == "":
+		return api_error.MissingField("blockchain_address")
+	case sr.Password == nil:
+		return api_error.MissingField("password")
+	}
+	return nil
+}
+
+// Richiesta di unione delle copie di una transazione parzialmente
+// firmata
+type PartialCombineRequest struct {
+	PartialTransactions []*partial_transaction.PartialTransaction `json:"partial_transactions"`
+}
+
+// Metodo per validare PartialCombineRequest
+func (cr *PartialCombineRequest) Validate() error {
+	if len(cr.PartialTransactions) == 0 {
+		return api_error.MissingField("partial_transactions")
+	}
+	for _, pt := range cr.PartialTransactions {
+		if pt == nil {
+			return api_error.InvalidField("partial_transactions", "must not contain null")
+		}
+	}
+	return nil
+}
+
+// Richiesta di finalizzazione di una transazione parzialmente
+// firmata, con Relay la transazione firmata si invia anche al nodo
+type PartialFinalizeRequest struct {
+	PartialTransaction *partial_transaction.PartialTransaction `json:"partial_transaction"`
+	Relay              bool                                    `json:"relay"`
+}
+
+// Metodo per validare PartialFinalizeRequest
+func (fr *PartialFinalizeRequest) Validate() error {
+	if fr.PartialTransaction == nil {
+		return api_error.MissingField("partial_transaction")
+	}
+	return nil
+}
+
+// Richiesta di blocco di fondi in un contratto HTLC: il wallet server
+// firma con la chiave del sender l'invio di Value all'address del
+// contratto
+// Senza Hash il server genera il preimage e lo restituisce, è chi
+// inizia uno scambio atomico; chi risponde usa l'hash della
+// controparte con un timeout più vicino
+type HtlcRequest struct {
+	SenderBlockchainAddress    *string `json:"sender_blockchain_address"`
 	RecipientBlockchainAddress *string `json:"recipient_blockchain_address"`
-	SenderPublicKey            *string `json:"sender_public_key"`
+	Hash                       *string `json:"hash"`
+	Timeout                    *int64  `json:"timeout"`
 	Value                      *string `json:"value"`
+	Password                   *string `json:"password"`
 }
 
-// Metodo per validare TransactionRequest
-func (tr *TransactionRequest) Validate() bool {
-	// Controllo se tutti i dati non sono null e restituisco un bool
-	if tr.SenderPrivateKey == nil ||
-		tr.SenderBloackchainAddress == nil ||
-		tr.SenderPublicKey == nil ||
-		tr.Value == nil {
-		return false
-	}
-	return true
+// Metodo per validare HtlcRequest
+func (hr *HtlcRequest) Validate() error {
+	switch {
+	case hr.SenderBlockchainAddress == nil || *hr.SenderBlockchainAddress == "":
+		return api_error.MissingField("sender_blockchain_address")
+	case hr.RecipientBlockchainAddress == nil || *hr.RecipientBlockchainAddress == "":
+		return api_error.MissingField("recipient_blockchain_address")
+	case hr.Timeout == nil:
+		return api_error.MissingField("timeout")
+	case hr.Value == nil:
+		return api_error.MissingField("value")
+	case hr.Password == nil:
+		return api_error.MissingField("password")
+	}
+	if *hr.SenderBlockchainAddress == *hr.RecipientBlockchainAddress {
+		return api_error.InvalidField("recipient_blockchain_address", "must differ from sender_blockchain_address")
+	}
+	if hr.Hash != nil && !htlc.ValidHash(strings.ToLower(*hr.Hash)) {
+		return api_error.InvalidField("hash", "must be 64 hexadecimal characters")
+	}
+	if !htlc.ValidTimeout(*hr.Timeout) {
+		return api_error.InvalidField("timeout", "must be a block height from 2 or a unix time in seconds")
+	}
+	return nil
 }
@@ -0,0 +1,274 @@
+package unsigned_transaction
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/script"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	blockchain_transaction_request "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+)
+
+// Versione del formato delle transazioni da firmare, la 2 firma anche
+// il chain ID
+const VERSION = 2
+
+var (
+	// Il payload non corrisponde ai campi della transazione, o
+	// l'hash non corrisponde al payload
+	ErrPayloadMismatch = errors.New("signing payload does not match the transaction")
+	// La chiave pubblica non è un punto della curva o non è quella
+	// dell'address del sender
+	ErrInvalidPublicKey = errors.New("public key is not valid for the sender address")
+	// La firma non è della chiave pubblica sul payload
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// Transazione da firmare: i campi che si leggono e il payload che
+// si firma, cioè il json che il nodo ricalcola per verificare la
+// firma, byte per byte
+// Chi firma con SHA-256 e ECDSA su P-256, per esempio con WebCrypto,
+// firma i byte di SigningPayload; chi firma un hash usa SigningHash
+// ValidAfter e ValidUntil, se ci sono, limitano i blocchi in cui la
+// transazione può entrare e fanno parte del payload, come ChainID, la
+// rete del nodo, Nonce, casuale così due transazioni uguali non sono
+// lo stesso payload, Contract per le transazioni dei contratti e Asset
+// per quelle dei token
+type UnsignedTransaction struct {
+	Version                    int               `json:"version"`
+	SenderBlockchainAddress    string            `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress string            `json:"recipient_blockchain_address"`
+	Value                      float32           `json:"value"`
+	ValidAfter                 int64             `json:"valid_after,omitempty"`
+	ValidUntil                 int64             `json:"valid_until,omitempty"`
+	ChainID                    string            `json:"chain_id"`
+	Nonce                      uint64            `json:"nonce,omitempty"`
+	Contract                   *contract.Message `json:"contract,omitempty"`
+	Asset                      *asset.Operation  `json:"asset,omitempty"`
+	SigningPayload             string            `json:"signing_payload"`
+	// SHA-256 del payload, in esadecimale
+	SigningHash string `json:"signing_hash"`
+}
+
+// Funzione per creare la transazione da firmare per la rete chainID,
+// validAfter e validUntil sono 0 se la transazione non ha limiti di
+// validità
+func NewUnsignedTransaction(chainID string, sender string, recipient string, value float32, validAfter int64, validUntil int64) *UnsignedTransaction {
+	ut := &UnsignedTransaction{
+		Version:                    VERSION,
+		ChainID:                    chainID,
+		Nonce:                      blockchain_transaction.NewNonce(),
+		SenderBlockchainAddress:    sender,
+		RecipientBlockchainAddress: recipient,
+		Value:                      value,
+		ValidAfter:                 validAfter,
+		ValidUntil:                 validUntil,
+	}
+	ut.setPayload()
+	return ut
+}
+
+// Funzione per creare la transazione che pubblica o chiama un
+// contratto, con valore 0: per pubblicarlo recipient è l'address
+// calcolato con contract.Address
+func NewContractTransaction(chainID string, sender string, recipient string, m *contract.Message) *UnsignedTransaction {
+	ut := &UnsignedTransaction{
+		Version:                    VERSION,
+		ChainID:                    chainID,
+		Nonce:                      blockchain_transaction.NewNonce(),
+		SenderBlockchainAddress:    sender,
+		RecipientBlockchainAddress: recipient,
+		Contract:                   m,
+	}
+	ut.setPayload()
+	return ut
+}
+
+// Funzione per creare la transazione di un'operazione su un token, con
+// valore 0 e i limiti di validità come NewUnsignedTransaction
+func NewAssetTransaction(chainID string, sender string, recipient string, op *asset.Operation, validAfter int64, validUntil int64) *UnsignedTransaction {
+	ut := &UnsignedTransaction{
+		Version:                    VERSION,
+		ChainID:                    chainID,
+		Nonce:                      blockchain_transaction.NewNonce(),
+		SenderBlockchainAddress:    sender,
+		RecipientBlockchainAddress: recipient,
+		ValidAfter:                 validAfter,
+		ValidUntil:                 validUntil,
+		Asset:                      op,
+	}
+	ut.setPayload()
+	return ut
+}
+
+func (ut *UnsignedTransaction) setPayload() {
+	payload := ut.transaction().SigningPayload()
+	hash := sha256.Sum256(payload)
+	ut.SigningPayload, ut.SigningHash = string(payload), hex.EncodeToString(hash[:])
+}
+
+// Metodo che ritorna la transazione del nodo, il cui payload è quello
+// che il nodo usa in VerifyTransactionSignature
+func (ut *UnsignedTransaction) transaction() *blockchain_transaction.Transaction {
+	t := blockchain_transaction.NewTransaction(ut.SenderBlockchainAddress, ut.RecipientBlockchainAddress, ut.Value)
+	t.ValidAfter, t.ValidUntil, t.ChainID, t.Nonce = ut.ValidAfter, ut.ValidUntil, ut.ChainID, ut.Nonce
+	t.Contract, t.Asset = ut.Contract, ut.Asset
+	return t
+}
+
+// Metodo che controlla che payload e hash corrispondano ai campi,
+// da fare prima di firmare una transazione ricevuta da altri
+func (ut *UnsignedTransaction) Check() error {
+	if ut.Version != VERSION {
+		return fmt.Errorf("unsupported unsigned transaction version %d", ut.Version)
+	}
+	payload := ut.transaction().SigningPayload()
+	hash := sha256.Sum256(payload)
+	if ut.SigningPayload != string(payload) || ut.SigningHash != hex.EncodeToString(hash[:]) {
+		return ErrPayloadMismatch
+	}
+	return nil
+}
+
+// Metodo che firma la transazione con la chiave del wallet, che deve
+// essere quella del sender, e ritorna la richiesta da inviare al nodo
+func (ut *UnsignedTransaction) Sign(w *wallet.Wallet) (*blockchain_transaction_request.TransactionRequest, error) {
+	if err := ut.Check(); err != nil {
+		return nil, err
+	}
+	if w.BlockchainAddress() != ut.SenderBlockchainAddress {
+		return nil, fmt.Errorf("%w: the key is for %s", ErrInvalidPublicKey, w.BlockchainAddress())
+	}
+	signature, err := ut.SignPayload(w)
+	if err != nil {
+		return nil, err
+	}
+	return ut.Signed(w.PublicKeyStr(), signature), nil
+}
+
+// Metodo che firma il payload con la chiave di un wallet qualsiasi e
+// ritorna la firma in esadecimale, per gli script che controllano le
+// firme di chiavi diverse da quella del sender
+func (ut *UnsignedTransaction) SignPayload(w *wallet.Wallet) (string, error) {
+	if err := ut.Check(); err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(ut.SigningPayload))
+	r, s, err := ecdsa.Sign(rand.Reader, w.PrivateKey(), hash[:])
+	if err != nil {
+		return "", err
+	}
+	signature := &utils.Signature{R: r, S: s}
+	return signature.String(), nil
+}
+
+// Metodo che ritorna la richiesta da inviare al nodo con la chiave
+// pubblica e la firma fatte altrove, in esadecimale
+func (ut *UnsignedTransaction) Signed(publicKey string, signature string) *blockchain_transaction_request.TransactionRequest {
+	tr := ut.request()
+	tr.SenderPublicKey, tr.Signature = &publicKey, &signature
+	return tr
+}
+
+// Metodo che ritorna la richiesta da inviare al nodo per un account
+// multisig, con il witness al posto di chiave pubblica e firma
+func (ut *UnsignedTransaction) Witnessed(witness *multisig.Witness) *blockchain_transaction_request.TransactionRequest {
+	tr := ut.request()
+	tr.Witness = witness
+	return tr
+}
+
+// Metodo che ritorna la richiesta da inviare al nodo per i fondi di
+// uno script, con gli script di blocco e di sblocco al posto di chiave
+// pubblica e firma
+func (ut *UnsignedTransaction) Scripted(witness *script.Witness) *blockchain_transaction_request.TransactionRequest {
+	tr := ut.request()
+	tr.Script = witness
+	return tr
+}
+
+// Metodo che ritorna la richiesta senza firme, i limiti di validità
+// ci sono solo se non sono 0
+func (ut *UnsignedTransaction) request() *blockchain_transaction_request.TransactionRequest {
+	sender, recipient, value, chainID := ut.SenderBlockchainAddress, ut.RecipientBlockchainAddress, ut.Value, ut.ChainID
+	tr := &blockchain_transaction_request.TransactionRequest{
+		SenderBlockchainAddress:    &sender,
+		RecipientBlockchainAddress: &recipient,
+		Value:                      &value,
+		ChainID:                    &chainID,
+		Contract:                   ut.Contract,
+		Asset:                      ut.Asset,
+	}
+	if ut.ValidAfter != 0 {
+		validAfter := ut.ValidAfter
+		tr.ValidAfter = &validAfter
+	}
+	if ut.ValidUntil != 0 {
+		validUntil := ut.ValidUntil
+		tr.ValidUntil = &validUntil
+	}
+	if ut.Nonce != 0 {
+		nonce := ut.Nonce
+		tr.Nonce = &nonce
+	}
+	return tr
+}
+
+// Funzione che controlla una transazione firmata prima di inoltrarla:
+// la chiave pubblica deve essere quella dell'address del sender e la
+// firma deve essere valida, o il witness di un account multisig deve
+// avere la sua policy e abbastanza firme valide, o la spesa di un
+// HTLC deve rispettare il contratto, o quella di uno script deve
+// soddisfarlo
+// La richiesta deve essere già validata con Validate
+func Verify(tr *blockchain_transaction_request.TransactionRequest) error {
+	if tr.Htlc != nil {
+		t := tr.Transaction()
+		return tr.Htlc.Verify(t.SenderBlockchainAddress, t.RecipientBlockchainAddress, t.ValidAfter, t.ValidUntil)
+	}
+	if tr.Script != nil {
+		t := tr.Transaction()
+		return tr.Script.Verify(t.SenderBlockchainAddress, &script.Tx{
+			SigningPayload: t.SigningPayload(),
+			ValidAfter:     t.ValidAfter,
+			ValidUntil:     t.ValidUntil,
+		})
+	}
+	payload := tr.Transaction().SigningPayload()
+	if tr.Witness != nil {
+		return tr.Witness.Verify(*tr.SenderBlockchainAddress, payload)
+	}
+	return VerifySignature(payload, *tr.SenderBlockchainAddress, *tr.SenderPublicKey, *tr.Signature)
+}
+
+// Funzione che controlla la firma di un payload: la chiave pubblica,
+// X e Y in esadecimale, deve essere quella dell'address e la firma,
+// r e s in esadecimale, deve essere sua
+func VerifySignature(payload []byte, address string, publicKey string, signature string) error {
+	if !utils.IsHex256Pair(publicKey) {
+		return ErrInvalidPublicKey
+	}
+	key := utils.PublicKeyFromString(publicKey)
+	if !elliptic.P256().IsOnCurve(key.X, key.Y) || wallet.AddressFromPublicKey(key) != address {
+		return ErrInvalidPublicKey
+	}
+	if !utils.IsHex256Pair(signature) {
+		return ErrInvalidSignature
+	}
+	hash := sha256.Sum256(payload)
+	s := utils.SignatureFromString(signature)
+	if !ecdsa.Verify(key, hash[:], s.R, s.S) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
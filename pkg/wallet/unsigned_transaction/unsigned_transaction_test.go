@@ -0,0 +1,78 @@
+package unsigned_transaction
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+)
+
+const CHAIN_ID = "unsigned-test"
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// La transazione firmata dà la richiesta che il nodo verifica con lo
+// stesso payload, e due transazioni uguali hanno payload diversi
+func TestSignAndVerify(t *testing.T) {
+	sender, recipient := wallet.NewWallet(), wallet.NewWallet()
+	ut := NewUnsignedTransaction(CHAIN_ID, sender.BlockchainAddress(), recipient.BlockchainAddress(), 1.5, 3, 10)
+	check(t, ut.Check())
+	tr, err := ut.Sign(sender)
+	check(t, err)
+	check(t, tr.Validate())
+	check(t, Verify(tr))
+	if string(tr.Transaction().SigningPayload()) != ut.SigningPayload {
+		t.Fatal("the request has another payload")
+	}
+
+	again := NewUnsignedTransaction(CHAIN_ID, sender.BlockchainAddress(), recipient.BlockchainAddress(), 1.5, 3, 10)
+	if again.Nonce == ut.Nonce || again.SigningPayload == ut.SigningPayload {
+		t.Fatal("two payments with the same payload")
+	}
+
+	if _, err := ut.Sign(recipient); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Fatalf("signing with another key: %v, expected %v", err, ErrInvalidPublicKey)
+	}
+	signature, err := ut.SignPayload(recipient)
+	check(t, err)
+	if err := Verify(ut.Signed(recipient.PublicKeyStr(), signature)); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Fatalf("key of another address: %v, expected %v", err, ErrInvalidPublicKey)
+	}
+	if err := Verify(again.Signed(sender.PublicKeyStr(), *tr.Signature)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("signature of another payload: %v, expected %v", err, ErrInvalidSignature)
+	}
+}
+
+// Una transazione ricevuta con i campi cambiati dopo il payload, o con
+// il payload cambiato, non si firma
+func TestPayloadMismatch(t *testing.T) {
+	sender := wallet.NewWallet()
+	tests := map[string]func(ut *UnsignedTransaction){
+		"value":     func(ut *UnsignedTransaction) { ut.Value = 100 },
+		"recipient": func(ut *UnsignedTransaction) { ut.RecipientBlockchainAddress = sender.BlockchainAddress() },
+		"chain":     func(ut *UnsignedTransaction) { ut.ChainID = "other" },
+		"nonce":     func(ut *UnsignedTransaction) { ut.Nonce++ },
+		"valid":     func(ut *UnsignedTransaction) { ut.ValidUntil = 0 },
+		"payload":   func(ut *UnsignedTransaction) { ut.SigningPayload += " " },
+		"hash":      func(ut *UnsignedTransaction) { ut.SigningHash = ut.SigningHash[1:] + "0" },
+	}
+	for name, modify := range tests {
+		ut := NewUnsignedTransaction(CHAIN_ID, sender.BlockchainAddress(), wallet.NewWallet().BlockchainAddress(), 1, 0, 10)
+		modify(ut)
+		if _, err := ut.Sign(sender); !errors.Is(err, ErrPayloadMismatch) {
+			t.Errorf("%s: %v, expected %v", name, err, ErrPayloadMismatch)
+		}
+	}
+
+	ut := NewUnsignedTransaction(CHAIN_ID, sender.BlockchainAddress(), wallet.NewWallet().BlockchainAddress(), 1, 0, 0)
+	ut.Version = 1
+	if err := ut.Check(); err == nil {
+		t.Fatal("version 1 checked")
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/btcsuite/btcutil/base58"
 	"golang.org/x/crypto/ripemd160"
@@ -24,9 +26,15 @@ type Wallet struct {
 
 // Funzione per creare nuovo wallet
 func NewWallet() *Wallet {
-	w := new(Wallet)
 	// Ottengo la private key randomica con la libreria ecdsa
 	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return NewWalletFromPrivateKey(privateKey)
+}
+
+// Funzione per creare il wallet di una private key già esistente,
+// per esempio letta da un keystore
+func NewWalletFromPrivateKey(privateKey *ecdsa.PrivateKey) *Wallet {
+	w := new(Wallet)
 	w.privateKey = privateKey
 
 	// Passaggi per generare l'address:
@@ -34,11 +42,20 @@ func NewWallet() *Wallet {
 	// 1. Dalla private key ottengo la public key
 	w.publicKey = &w.privateKey.PublicKey
 
+	// 2-9. Dalla public key ottengo l'address
+	w.blockchainAddress = AddressFromPublicKey(w.publicKey)
+	return w
+}
+
+// Funzione che calcola la blockchain address della public key, così
+// si può controllare che una chiave pubblica ricevuta corrisponda
+// all'address del sender
+func AddressFromPublicKey(publicKey *ecdsa.PublicKey) string {
 	// Creare address
 	// 2. SHA-256 della chiave pubblica (32 bytes)
 	h2 := sha256.New()
-	h2.Write(w.publicKey.X.Bytes())
-	h2.Write(w.publicKey.Y.Bytes())
+	h2.Write(publicKey.X.Bytes())
+	h2.Write(publicKey.Y.Bytes())
 	digest2 := h2.Sum(nil)
 
 	// 3. Hash function RIPEMD-160 sul risultato di SHA-256 (20 byres)
@@ -74,8 +91,24 @@ func NewWallet() *Wallet {
 	// 9. Convertire il risultato da byte string a base58
 	address := base58.Encode(dc8)
 
-	w.blockchainAddress = address
-	return w
+	return address
+}
+
+// Lunghezza in byte della private key serializzata
+const PRIVATE_KEY_LENGTH = 32
+
+// Funzione per creare il wallet dai 32 byte della private key,
+// big-endian, come la salvano il keystore e le chiavi derivate
+func NewWalletFromBytes(b []byte) (*Wallet, error) {
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(b)
+	if len(b) != PRIVATE_KEY_LENGTH || d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("invalid private key")
+	}
+	privateKey := &ecdsa.PrivateKey{D: d}
+	privateKey.PublicKey.Curve = curve
+	privateKey.PublicKey.X, privateKey.PublicKey.Y = curve.ScalarBaseMult(b)
+	return NewWalletFromPrivateKey(privateKey), nil
 }
 
 // è una specie di getter, alternativa a scrivere in
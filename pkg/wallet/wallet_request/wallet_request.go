@@ -0,0 +1,156 @@
+package wallet_request
+
+import (
+	"fmt"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/hd_wallet"
+)
+
+// Lunghezza minima delle password del keystore
+const MIN_PASSWORD_LENGTH = 8
+
+// Gap limit massimo di una scansione dei wallet HD
+const MAX_GAP_LIMIT = 1000
+
+// Richiesta di creazione di un wallet nel keystore
+type WalletRequest struct {
+	Password *string `json:"password"`
+}
+
+// Metodo per validare WalletRequest
+func (wr *WalletRequest) Validate() error {
+	if wr.Password == nil {
+		return api_error.MissingField("password")
+	}
+	return validPassword("password", *wr.Password)
+}
+
+// Richiesta di cambio della password di un wallet del keystore
+type PasswordRequest struct {
+	BlockchainAddress *string `json:"blockchain_address"`
+	Password          *string `json:"password"`
+	NewPassword       *string `json:"new_password"`
+}
+
+// Metodo per validare PasswordRequest
+func (pr *PasswordRequest) Validate() error {
+	switch {
+	case pr.BlockchainAddress == nil:
+		return api_error.MissingField("blockchain_address")
+	case pr.Password == nil:
+		return api_error.MissingField("password")
+	case pr.NewPassword == nil:
+		return api_error.MissingField("new_password")
+	}
+	return validPassword("new_password", *pr.NewPassword)
+}
+
+// Funzione che controlla la lunghezza di una nuova password
+func validPassword(field string, password string) error {
+	if len(password) < MIN_PASSWORD_LENGTH {
+		return api_error.InvalidField(field, fmt.Sprintf("must be at least %d characters", MIN_PASSWORD_LENGTH))
+	}
+	return nil
+}
+
+// Richiesta di creazione di un wallet HD: senza mnemonic viene
+// generata una frase nuova, con mnemonic il wallet viene recuperato
+// e gli indirizzi usati si cercano sul nodo
+type HDWalletRequest struct {
+	Password *string `json:"password"`
+	Mnemonic *string `json:"mnemonic"`
+	// Passphrase opzionale della frase, come in BIP39
+	Passphrase string `json:"passphrase"`
+	// Parole della frase nuova, 12 se è 0
+	Words int `json:"words"`
+}
+
+// Metodo per validare HDWalletRequest
+func (hr *HDWalletRequest) Validate() error {
+	if hr.Password == nil {
+		return api_error.MissingField("password")
+	}
+	if err := validPassword("password", *hr.Password); err != nil {
+		return err
+	}
+	if hr.Mnemonic != nil {
+		if _, err := hd_wallet.MnemonicEntropy(*hr.Mnemonic); err != nil {
+			return api_error.InvalidField("mnemonic", err.Error())
+		}
+	}
+	if hr.Words != 0 && (hr.Words < 12 || hr.Words > 24 || hr.Words%3 != 0) {
+		return api_error.InvalidField("words", "must be 12, 15, 18, 21 or 24")
+	}
+	return nil
+}
+
+// Metodo che ritorna i bit di entropia della frase nuova
+func (hr *HDWalletRequest) EntropyBits() int {
+	if hr.Words == 0 {
+		return hd_wallet.DEFAULT_ENTROPY_BITS
+	}
+	// Ogni parola ha 11 bit, uno ogni 33 è di checksum
+	return hr.Words * 32 / 3
+}
+
+// Richiesta di un nuovo indirizzo di un wallet HD
+type HDAddressRequest struct {
+	SeedID   *string `json:"seed_id"`
+	Password *string `json:"password"`
+	Account  uint32  `json:"account"`
+}
+
+// Metodo per validare HDAddressRequest
+func (ar *HDAddressRequest) Validate() error {
+	switch {
+	case ar.SeedID == nil:
+		return api_error.MissingField("seed_id")
+	case ar.Password == nil:
+		return api_error.MissingField("password")
+	case ar.Account >= hd_wallet.HARDENED:
+		return api_error.InvalidField("account", "must be less than 2^31")
+	}
+	return nil
+}
+
+// Richiesta di scansione degli indirizzi usati di un wallet HD
+type HDScanRequest struct {
+	SeedID   *string `json:"seed_id"`
+	Password *string `json:"password"`
+	// Indirizzi consecutivi mai usati dopo i quali la scansione di un
+	// account si ferma, hd_wallet.GAP_LIMIT se è 0
+	GapLimit int `json:"gap_limit"`
+}
+
+// Metodo per validare HDScanRequest
+func (sr *HDScanRequest) Validate() error {
+	switch {
+	case sr.SeedID == nil:
+		return api_error.MissingField("seed_id")
+	case sr.Password == nil:
+		return api_error.MissingField("password")
+	case sr.GapLimit < 0 || sr.GapLimit > MAX_GAP_LIMIT:
+		return api_error.InvalidField("gap_limit", fmt.Sprintf("must be between 1 and %d", MAX_GAP_LIMIT))
+	}
+	return nil
+}
+
+// Richiesta di creazione di un account multisig: servono Threshold
+// firme delle chiavi pubbliche, in qualsiasi ordine
+type MultisigRequest struct {
+	Threshold  *int     `json:"threshold"`
+	PublicKeys []string `json:"public_keys"`
+}
+
+// Metodo per validare MultisigRequest, la policy la controlla
+// multisig.NewPolicy
+func (mr *MultisigRequest) Validate() error {
+	switch {
+	case mr.Threshold == nil:
+		return api_error.MissingField("threshold")
+	case len(mr.PublicKeys) == 0:
+		return api_error.MissingField("public_keys")
+	}
+	return nil
+}
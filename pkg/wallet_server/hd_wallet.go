@@ -0,0 +1,231 @@
+package wallet_server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/hd_wallet"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet_request"
+)
+
+// Dati di un wallet HD: il seed, i suoi account e gli indirizzi
+// derivati, che sono nel keystore come gli altri wallet
+// La frase c'è solo nella risposta alla creazione, il keystore salva
+// il seed e non la frase
+type seedInfo struct {
+	SeedID   string              `json:"seed_id"`
+	Mnemonic string              `json:"mnemonic,omitempty"`
+	Accounts []*keystore.Account `json:"accounts"`
+	Wallets  []*walletInfo       `json:"wallets"`
+	Created  int64               `json:"created"`
+}
+
+// Resolver per l'endpoint "/wallet/hd"
+// GET restituisce i wallet HD del keystore, POST ne crea uno nuovo,
+// con una frase generata, o lo recupera dalla frase della richiesta
+func (ws *WalletServer) HDWallet(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		seeds, err := ws.keystore.Seeds()
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.Internal(err.Error()))
+			return
+		}
+		list := make([]*seedInfo, 0, len(seeds))
+		for _, sf := range seeds {
+			info, err := ws.seedInfo(sf)
+			if err != nil {
+				log.Printf("ERROR: %v", err)
+				api_error.Write(w, api_error.Internal(err.Error()))
+				return
+			}
+			list = append(list, info)
+		}
+		m, _ := json.Marshal(struct {
+			Seeds  []*seedInfo `json:"seeds"`
+			Length int         `json:"length"`
+		}{
+			Seeds:  list,
+			Length: len(list),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	case http.MethodPost:
+		var hr wallet_request.HDWalletRequest
+		if err := json.NewDecoder(req.Body).Decode(&hr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := hr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		restore := hr.Mnemonic != nil
+		mnemonic := ""
+		if restore {
+			mnemonic = hd_wallet.NormalizeMnemonic(*hr.Mnemonic)
+		} else {
+			var err error
+			if mnemonic, err = hd_wallet.GenerateMnemonic(hr.EntropyBits()); err != nil {
+				log.Printf("ERROR: %v", err)
+				api_error.Write(w, api_error.Internal(err.Error()))
+				return
+			}
+		}
+		seed, err := hd_wallet.Seed(mnemonic, hr.Passphrase)
+		if err != nil {
+			api_error.Write(w, api_error.InvalidField("mnemonic", err.Error()))
+			return
+		}
+		// Un seed già nel keystore si può recuperare di nuovo, con la
+		// sua password, per cercare altri indirizzi
+		sf, err := ws.keystore.SaveSeed(seed, *hr.Password)
+		if err != nil && !(restore && errors.Is(err, keystore.ErrExists)) {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, keystoreError(err, ""))
+			return
+		}
+		// Un wallet nuovo parte con il primo indirizzo, uno recuperato
+		// con quelli usati che si trovano sul nodo
+		addresses := []uint32{1}
+		if restore {
+			master, _ := hd_wallet.NewMasterKey(seed)
+			if addresses, err = hd_wallet.ScanAccounts(req.Context(), master, hd_wallet.GAP_LIMIT, ws.node.Used); err != nil {
+				log.Printf("ERROR: %v", err)
+				api_error.Write(w, gatewayError(err))
+				return
+			}
+			if addresses[0] == 0 {
+				addresses[0] = 1
+			}
+		}
+		info, err := ws.extendAccounts(sf.ID, addresses, *hr.Password)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, keystoreError(err, "password"))
+			return
+		}
+		if !restore {
+			info.Mnemonic = mnemonic
+		}
+		m, _ := json.Marshal(info)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet, http.MethodPost)
+	}
+}
+
+// Resolver per l'endpoint "/wallet/hd/address"
+// Deriva il prossimo indirizzo dell'account e lo salva nel keystore
+func (ws *WalletServer) HDWalletAddress(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var ar wallet_request.HDAddressRequest
+		if err := json.NewDecoder(req.Body).Decode(&ar); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := ar.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		kf, err := ws.keystore.DeriveAddress(*ar.SeedID, ar.Account, *ar.Password)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, keystoreError(err, "seed_id"))
+			return
+		}
+		m, _ := json.Marshal(newWalletInfo(kf))
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Resolver per l'endpoint "/wallet/hd/scan"
+// Cerca sul nodo gli indirizzi usati del seed e salva nel keystore
+// quelli che mancano, per esempio quelli derivati su un'altra
+// macchina con la stessa frase
+func (ws *WalletServer) HDWalletScan(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var sr wallet_request.HDScanRequest
+		if err := json.NewDecoder(req.Body).Decode(&sr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := sr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		sf, err := ws.keystore.SeedFile(*sr.SeedID)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, keystoreError(err, "seed_id"))
+			return
+		}
+		master, err := sf.Decrypt(*sr.Password)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, keystoreError(err, "seed_id"))
+			return
+		}
+		addresses, err := hd_wallet.ScanAccounts(req.Context(), master, sr.GapLimit, ws.node.Used)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, gatewayError(err))
+			return
+		}
+		info, err := ws.extendAccounts(sf.ID, addresses, *sr.Password)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, keystoreError(err, "seed_id"))
+			return
+		}
+		m, _ := json.Marshal(info)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Metodo che deriva gli indirizzi mancanti degli account e ritorna i
+// dati aggiornati del seed
+func (ws *WalletServer) extendAccounts(id string, addresses []uint32, password string) (*seedInfo, error) {
+	if _, err := ws.keystore.ExtendAccounts(id, addresses, password); err != nil {
+		return nil, err
+	}
+	sf, err := ws.keystore.SeedFile(id)
+	if err != nil {
+		return nil, err
+	}
+	return ws.seedInfo(sf)
+}
+
+// Metodo che ritorna i dati del seed con i suoi indirizzi
+func (ws *WalletServer) seedInfo(sf *keystore.SeedFile) (*seedInfo, error) {
+	keys, err := ws.keystore.SeedKeys(sf.ID)
+	if err != nil {
+		return nil, err
+	}
+	wallets := make([]*walletInfo, 0, len(keys))
+	for _, kf := range keys {
+		wallets = append(wallets, newWalletInfo(kf))
+	}
+	return &seedInfo{SeedID: sf.ID, Accounts: sf.Accounts, Wallets: wallets, Created: sf.Created}, nil
+}
@@ -0,0 +1,213 @@
+package wallet_server
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc_request"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	blockchain_transaction_request "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	wallet_transaction "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction"
+	wallet_transaction_request "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction_request"
+)
+
+// Resolver per l'endpoint "/htlc"
+// Blocca i fondi del sender in un contratto HTLC: firma con la chiave
+// del keystore l'invio del valore all'address del contratto
+// Restituisce il contratto, che va passato alla controparte, e il
+// preimage se lo ha generato il server, da tenere segreto fino al
+// riscatto
+func (ws *WalletServer) LockHtlc(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var hr wallet_transaction_request.HtlcRequest
+		if err := json.NewDecoder(req.Body).Decode(&hr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := hr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		value, err := strconv.ParseFloat(*hr.Value, 32)
+		if err != nil {
+			api_error.Write(w, api_error.InvalidField("value", "must be a number"))
+			return
+		}
+		if !(value > 0) {
+			api_error.Write(w, api_error.InvalidField("value", "must be greater than 0"))
+			return
+		}
+		senderWallet, err := ws.keystore.Load(*hr.SenderBlockchainAddress, *hr.Password)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, keystoreError(err, "sender_blockchain_address"))
+			return
+		}
+		// Senza hash si inizia uno scambio, il preimage lo genero io
+		var preimage, hash string
+		if hr.Hash != nil {
+			hash = strings.ToLower(*hr.Hash)
+		} else if preimage, hash, err = htlc.NewPreimage(); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.Internal(err.Error()))
+			return
+		}
+		c, err := htlc.NewContract(*hr.SenderBlockchainAddress, *hr.RecipientBlockchainAddress, hash, *hr.Timeout)
+		if err != nil {
+			api_error.Write(w, api_error.InvalidField("timeout", err.Error()))
+			return
+		}
+		chainID, err := ws.nodeChainID(req.Context())
+		if err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		address := c.Address()
+		value32 := float32(value)
+		transaction := wallet_transaction.NewTransaction(
+			senderWallet.PrivateKey(),
+			senderWallet.PublicKey(),
+			*hr.SenderBlockchainAddress,
+			address,
+			value32)
+		transaction.SetChainID(chainID)
+		nonce := blockchain_transaction.NewNonce()
+		transaction.SetNonce(nonce)
+		publicKeyStr := senderWallet.PublicKeyStr()
+		signatureStr := transaction.GenerateSignature().String()
+		bt := &blockchain_transaction_request.TransactionRequest{
+			SenderBlockchainAddress:    hr.SenderBlockchainAddress,
+			RecipientBlockchainAddress: &address,
+			SenderPublicKey:            &publicKeyStr,
+			Value:                      &value32,
+			ChainID:                    &chainID,
+			Nonce:                      &nonce,
+			Signature:                  &signatureStr,
+		}
+		if err := ws.node.SendTransaction(req.Context(), bt); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, gatewayError(err))
+			return
+		}
+		m, _ := json.Marshal(struct {
+			BlockchainAddress string         `json:"blockchain_address"`
+			Contract          *htlc.Contract `json:"contract"`
+			Preimage          string         `json:"preimage,omitempty"`
+		}{
+			BlockchainAddress: address,
+			Contract:          c,
+			Preimage:          preimage,
+		})
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Funzione che legge e valida la richiesta su un contratto HTLC da
+// inoltrare al nodo
+func decodeHtlcRequest(req *http.Request) (*htlc_request.HtlcRequest, error) {
+	var hr htlc_request.HtlcRequest
+	if err := json.NewDecoder(req.Body).Decode(&hr); err != nil {
+		log.Printf("ERROR: %v", err)
+		return nil, api_error.InvalidJson(err)
+	}
+	if err := hr.Validate(); err != nil {
+		return nil, err
+	}
+	return &hr, nil
+}
+
+// Resolver per l'endpoint "/htlc/status"
+// Inoltra al nodo la richiesta dello stato del contratto
+func (ws *WalletServer) HtlcStatus(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		hr, err := decodeHtlcRequest(req)
+		if err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		status, err := ws.node.HtlcStatus(req.Context(), hr.Contract())
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, gatewayError(err))
+			return
+		}
+		m, _ := json.Marshal(status)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Resolver per l'endpoint "/htlc/claim"
+// Inoltra al nodo il riscatto con il preimage, non servono chiavi
+func (ws *WalletServer) ClaimHtlc(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		hr, err := decodeHtlcRequest(req)
+		if err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		if hr.Preimage == nil {
+			api_error.Write(w, api_error.MissingField("preimage"))
+			return
+		}
+		tr, err := ws.node.ClaimHtlc(req.Context(), hr.Contract(), hr.Spend().Preimage)
+		writeHtlcSpend(w, tr, err)
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Resolver per l'endpoint "/htlc/refund"
+// Inoltra al nodo il rimborso dopo il timeout, non servono chiavi
+func (ws *WalletServer) RefundHtlc(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		hr, err := decodeHtlcRequest(req)
+		if err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		if hr.Preimage != nil {
+			api_error.Write(w, api_error.InvalidField("preimage", "a refund has no preimage, use /htlc/claim"))
+			return
+		}
+		tr, err := ws.node.RefundHtlc(req.Context(), hr.Contract())
+		writeHtlcSpend(w, tr, err)
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Funzione che restituisce la transazione che spende i fondi del
+// contratto creata dal nodo, o il suo errore
+func writeHtlcSpend(w http.ResponseWriter, tr *blockchain_transaction_request.TransactionRequest, err error) {
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		api_error.Write(w, gatewayError(err))
+		return
+	}
+	m, _ := json.Marshal(tr)
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, string(m[:]))
+}
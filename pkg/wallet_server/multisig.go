@@ -0,0 +1,69 @@
+package wallet_server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet_request"
+)
+
+// Resolver per l'endpoint "/wallet/multisig"
+// GET restituisce gli account multisig del keystore, POST ne crea uno
+// dalla soglia e dalle chiavi pubbliche dei firmatari
+// Il keystore salva solo la policy, le chiavi private restano ai
+// firmatari, che firmano con "/transaction/partial/sign"
+func (ws *WalletServer) MultisigWallet(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		list, err := ws.keystore.MultisigList()
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.Internal(err.Error()))
+			return
+		}
+		m, _ := json.Marshal(struct {
+			Wallets []*keystore.MultisigFile `json:"wallets"`
+			Length  int                      `json:"length"`
+		}{
+			Wallets: list,
+			Length:  len(list),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	case http.MethodPost:
+		var mr wallet_request.MultisigRequest
+		if err := json.NewDecoder(req.Body).Decode(&mr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := mr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		p, err := multisig.NewPolicy(*mr.Threshold, mr.PublicKeys)
+		if err != nil {
+			api_error.Write(w, api_error.InvalidField("public_keys", err.Error()))
+			return
+		}
+		// Lo stesso account si può creare di nuovo, l'address è lo stesso
+		mf, err := ws.keystore.SaveMultisig(p)
+		if err != nil && !errors.Is(err, keystore.ErrExists) {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.Internal(err.Error()))
+			return
+		}
+		m, _ := json.Marshal(mf)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet, http.MethodPost)
+	}
+}
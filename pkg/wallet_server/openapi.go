@@ -0,0 +1,531 @@
+package wallet_server
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/asset"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/contract"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/htlc"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/script"
+	"github.com/iltommi1995/blockchain-go/pkg/openapi"
+)
+
+// Versione delle API REST, da cambiare quando cambiano in modo
+// non compatibile
+const API_VERSION = "1.0.0"
+
+// Metodo che genera il documento OpenAPI dagli endpoint di Routes
+// Ritorna un errore se un endpoint non è documentato o se è
+// documentato un endpoint che non esiste
+func (ws *WalletServer) OpenAPI() (*openapi.Document, error) {
+	doc := openapi.NewDocument("Wallet server API", API_VERSION,
+		"REST API of the wallet server, which signs transactions and forwards them to a blockchain node.")
+	doc.Components.Schemas = map[string]*openapi.Schema{
+		"Error": api_error.Schema(),
+		"Status": openapi.Object(map[string]*openapi.Schema{
+			"message": openapi.String("\"success\""),
+		}, "message"),
+		"Wallet": openapi.Object(map[string]*openapi.Schema{
+			"public_key":         openapi.String("128 hex characters"),
+			"blockchain_address": openapi.String(""),
+			"seed_id":            openapi.String("HD wallet the key was derived from"),
+			"path":               openapi.String("derivation path, as m/44'/1'/0'/0/0"),
+			"created":            openapi.Integer("unix time the key was created, only in listings"),
+		}, "public_key", "blockchain_address"),
+		"Wallets": openapi.Object(map[string]*openapi.Schema{
+			"wallets": openapi.Array(openapi.Ref("Wallet")),
+			"length":  openapi.Integer(""),
+		}, "wallets", "length"),
+		"JsonRpcRequest": openapi.Object(map[string]*openapi.Schema{
+			"jsonrpc": openapi.String("\"2.0\""),
+			"method":  openapi.String("wallet_create, wallet_list, wallet_sign or wallet_send"),
+			"params":  openapi.Map(&openapi.Schema{}),
+			"id":      openapi.String("string, number or null, missing for notifications"),
+		}, "jsonrpc", "method"),
+		"WalletRequest": openapi.Object(map[string]*openapi.Schema{
+			"password": openapi.String("encrypts the key in the keystore, at least 8 characters"),
+		}, "password"),
+		"PasswordRequest": openapi.Object(map[string]*openapi.Schema{
+			"blockchain_address": openapi.String(""),
+			"password":           openapi.String("current password"),
+			"new_password":       openapi.String("at least 8 characters"),
+		}, "blockchain_address", "password", "new_password"),
+		"Account": openapi.Object(map[string]*openapi.Schema{
+			"index":     openapi.Integer("account index, hardened in the path"),
+			"addresses": openapi.Integer("addresses derived on the external chain, the next one has this index"),
+		}, "index", "addresses"),
+		"HDWallet": openapi.Object(map[string]*openapi.Schema{
+			"seed_id":  openapi.String("fingerprint of the master key, 8 hex characters"),
+			"mnemonic": openapi.String("only when the wallet is created: write it down, it is not stored"),
+			"accounts": openapi.Array(openapi.Ref("Account")),
+			"wallets":  openapi.Array(openapi.Ref("Wallet")),
+			"created":  openapi.Integer("unix time the seed was saved"),
+		}, "seed_id", "accounts", "wallets", "created"),
+		"HDWallets": openapi.Object(map[string]*openapi.Schema{
+			"seeds":  openapi.Array(openapi.Ref("HDWallet")),
+			"length": openapi.Integer(""),
+		}, "seeds", "length"),
+		"HDWalletRequest": openapi.Object(map[string]*openapi.Schema{
+			"password":   openapi.String("encrypts the seed and the derived keys, at least 8 characters"),
+			"mnemonic":   openapi.String("BIP39 mnemonic to restore, without it a new one is generated"),
+			"passphrase": openapi.String("optional BIP39 passphrase"),
+			"words":      openapi.Integer("words of the new mnemonic: 12, 15, 18, 21 or 24, default 12"),
+		}, "password"),
+		"HDAddressRequest": openapi.Object(map[string]*openapi.Schema{
+			"seed_id":  openapi.String(""),
+			"password": openapi.String("password of the seed"),
+			"account":  openapi.Integer("default 0"),
+		}, "seed_id", "password"),
+		"HDScanRequest": openapi.Object(map[string]*openapi.Schema{
+			"seed_id":   openapi.String(""),
+			"password":  openapi.String("password of the seed"),
+			"gap_limit": openapi.Integer("unused addresses in a row that end the scan of an account, default 20"),
+		}, "seed_id", "password"),
+		"WalletAmount": openapi.Object(map[string]*openapi.Schema{
+			"message": openapi.String("\"success\""),
+			"amount":  openapi.Number("with asset, an integer in the smallest unit of the asset"),
+			"asset":   openapi.String("the asset parameter, if given"),
+		}, "message", "amount"),
+		"UnsignedTransactionRequest": openapi.Object(map[string]*openapi.Schema{
+			"sender_blockchain_address":    openapi.String(""),
+			"recipient_blockchain_address": openapi.String(""),
+			"value":                        openapi.String("decimal amount, greater than 0; not for asset operations"),
+			"valid_after":                  openapi.Integer("block height below 500000000, unix time in seconds from there; the first block that may include the transaction"),
+			"valid_until":                  openapi.Integer("block height below 500000000, unix time in seconds from there; the last block that may include the transaction"),
+			"asset":                        openapi.Ref("AssetOperation"),
+		}, "sender_blockchain_address", "recipient_blockchain_address"),
+		"UnsignedTransaction": openapi.Object(map[string]*openapi.Schema{
+			"version":                      openapi.Integer("format version, 2"),
+			"sender_blockchain_address":    openapi.String(""),
+			"recipient_blockchain_address": openapi.String(""),
+			"value":                        openapi.Number(""),
+			"valid_after":                  openapi.Integer("omitted when 0, part of signing_payload"),
+			"valid_until":                  openapi.Integer("omitted when 0, part of signing_payload"),
+			"chain_id":                     openapi.String("the network of the gateway node, part of signing_payload"),
+			"nonce":                        openapi.Integer("random, below 2^53, part of signing_payload"),
+			"contract":                     openapi.Ref("ContractMessage"),
+			"asset":                        openapi.Ref("AssetOperation"),
+			"signing_payload":              openapi.String("the exact bytes to sign with ECDSA P-256 and SHA-256"),
+			"signing_hash":                 openapi.String("SHA-256 of signing_payload, in hex, for signers that take a hash"),
+		}, "version", "sender_blockchain_address", "recipient_blockchain_address", "value", "chain_id", "signing_payload", "signing_hash"),
+		"SignedTransaction": openapi.Object(map[string]*openapi.Schema{
+			"sender_blockchain_address":    openapi.String(""),
+			"recipient_blockchain_address": openapi.String(""),
+			"sender_public_key":            openapi.String("128 hex characters, the key of the sender address; not for multisig, htlc and script senders"),
+			"value":                        openapi.Number("the value of the unsigned transaction"),
+			"valid_after":                  openapi.Integer("the valid_after of the unsigned transaction"),
+			"valid_until":                  openapi.Integer("the valid_until of the unsigned transaction"),
+			"chain_id":                     openapi.String("the chain_id of the unsigned transaction"),
+			"nonce":                        openapi.Integer("the nonce of the unsigned transaction"),
+			"signature":                    openapi.String("128 hex characters: r and s; not for multisig, htlc and script senders"),
+			"witness":                      openapi.Ref("Witness"),
+			"htlc":                         openapi.Ref("Htlc"),
+			"script":                       openapi.Ref("Script"),
+			"contract":                     openapi.Ref("ContractMessage"),
+			"asset":                        openapi.Ref("AssetOperation"),
+		}, "sender_blockchain_address", "recipient_blockchain_address", "value"),
+		"Witness":         multisig.Schema(),
+		"Htlc":            htlc.SpendSchema(),
+		"HtlcContract":    htlc.ContractSchema(),
+		"Script":          script.Schema(),
+		"HtlcStatus":      blockchain.HtlcStatusSchema(openapi.Ref("HtlcContract")),
+		"ContractMessage": contract.Schema(),
+		"AssetOperation":  asset.Schema(),
+		"HtlcRequest": openapi.Object(map[string]*openapi.Schema{
+			"sender_blockchain_address":    openapi.String("wallet in the keystore, gets the funds back after the timeout"),
+			"recipient_blockchain_address": openapi.String("claims the funds with the preimage before the timeout"),
+			"hash":                         openapi.String("SHA-256 of the preimage in hex; the server generates the preimage when missing"),
+			"timeout":                      openapi.Integer("block height below 500000000, unix time in seconds from there"),
+			"value":                        openapi.String("decimal amount, greater than 0"),
+			"password":                     openapi.String("decrypts the sender key"),
+		}, "sender_blockchain_address", "recipient_blockchain_address", "timeout", "value", "password"),
+		"LockedHtlc": openapi.Object(map[string]*openapi.Schema{
+			"blockchain_address": openapi.String("address of the contract, where the funds are locked"),
+			"contract":           openapi.Ref("HtlcContract"),
+			"preimage":           openapi.String("only when generated by the server: keep it secret until the claim"),
+		}, "blockchain_address", "contract"),
+		"MultisigRequest": openapi.Object(map[string]*openapi.Schema{
+			"threshold":   openapi.Integer("signatures required, from 1 to the number of keys"),
+			"public_keys": openapi.Array(openapi.String("128 hex characters, in any order")),
+		}, "threshold", "public_keys"),
+		"MultisigWallet": openapi.Object(map[string]*openapi.Schema{
+			"version":            openapi.Integer("file format version, 1"),
+			"blockchain_address": openapi.String("multisig address, starts with 3"),
+			"threshold":          openapi.Integer(""),
+			"public_keys":        openapi.Array(openapi.String("sorted")),
+			"created":            openapi.Integer("unix time the account was saved"),
+		}, "version", "blockchain_address", "threshold", "public_keys", "created"),
+		"MultisigWallets": openapi.Object(map[string]*openapi.Schema{
+			"wallets": openapi.Array(openapi.Ref("MultisigWallet")),
+			"length":  openapi.Integer(""),
+		}, "wallets", "length"),
+		"Signer": openapi.Object(map[string]*openapi.Schema{
+			"blockchain_address": openapi.String("address that must sign"),
+			"public_key":         openapi.String("128 hex characters, once signed"),
+			"signature":          openapi.String("128 hex characters: r and s, once signed"),
+		}, "blockchain_address"),
+		"PartialTransaction": openapi.Object(map[string]*openapi.Schema{
+			"version":     openapi.Integer("format version, 1"),
+			"transaction": openapi.Ref("UnsignedTransaction"),
+			"multisig": openapi.Object(map[string]*openapi.Schema{
+				"threshold":   openapi.Integer(""),
+				"public_keys": openapi.Array(openapi.String("sorted, the keys of the signers")),
+			}, "threshold", "public_keys"),
+			"signers": openapi.Array(openapi.Ref("Signer")),
+		}, "version", "transaction", "signers"),
+		"PartialSignRequest": openapi.Object(map[string]*openapi.Schema{
+			"partial_transaction": openapi.Ref("PartialTransaction"),
+			"blockchain_address":  openapi.String("signer wallet in the keystore, with password"),
+			"password":            openapi.String("decrypts the signer key"),
+			"public_key":          openapi.String("key of a signature made elsewhere, instead of blockchain_address and password"),
+			"signature":           openapi.String("signature made elsewhere, with public_key"),
+		}, "partial_transaction"),
+		"PartialCombineRequest": openapi.Object(map[string]*openapi.Schema{
+			"partial_transactions": openapi.Array(openapi.Ref("PartialTransaction")),
+		}, "partial_transactions"),
+		"PartialFinalizeRequest": openapi.Object(map[string]*openapi.Schema{
+			"partial_transaction": openapi.Ref("PartialTransaction"),
+			"relay":               openapi.Boolean("also send the signed transaction to the node"),
+		}, "partial_transaction"),
+		"TransactionRequest": openapi.Object(map[string]*openapi.Schema{
+			"sender_blockchain_address":    openapi.String("wallet in the keystore"),
+			"recipient_blockchain_address": openapi.String(""),
+			"value":                        openapi.String("decimal amount, greater than 0; not for asset operations"),
+			"valid_after":                  openapi.Integer("block height below 500000000, unix time in seconds from there; the first block that may include the transaction"),
+			"valid_until":                  openapi.Integer("block height below 500000000, unix time in seconds from there; the last block that may include the transaction"),
+			"asset":                        openapi.Ref("AssetOperation"),
+			"password":                     openapi.String("decrypts the sender key"),
+		}, "sender_blockchain_address", "recipient_blockchain_address", "password"),
+	}
+
+	gatewayErrors := func(responses map[string]*openapi.Response) map[string]*openapi.Response {
+		responses["502"] = openapi.JsonResponse("the blockchain node is unreachable or failed", openapi.Ref("Error"))
+		return responses
+	}
+	addressParam := openapi.Query("blockchain_address", "", true, openapi.String(""))
+	assetParam := openapi.Query("asset", "symbol of an issued asset; without it, the balance of the coin of the chain", false, openapi.String(""))
+	endpoints := []*openapi.Endpoint{
+		{Route: "/", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getIndex",
+				Summary:     "Wallet web page",
+				Responses:   map[string]*openapi.Response{"200": {Description: "html page"}},
+			},
+		}},
+		{Route: "/wallet", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "listWallets",
+				Summary:     "Wallets in the keystore",
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("the public data of the wallets", openapi.Ref("Wallets"))},
+			},
+			http.MethodPost: {
+				OperationID: "createWallet",
+				Summary:     "Create a new wallet, saved in the keystore encrypted with the password",
+				RequestBody: openapi.JsonBody(openapi.Ref("WalletRequest")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the public data of the wallet, the private key never leaves the keystore", openapi.Ref("Wallet")),
+					"400": openapi.JsonResponse("invalid json, missing or short password", openapi.Ref("Error")),
+				},
+			},
+		}},
+		{Route: "/wallet/password", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "changeWalletPassword",
+				Summary:     "Encrypt the key of a wallet with a new password",
+				RequestBody: openapi.JsonBody(openapi.Ref("PasswordRequest")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("password changed", openapi.Ref("Status")),
+					"400": openapi.JsonResponse("invalid json, missing field or short new password", openapi.Ref("Error")),
+					"401": openapi.JsonResponse("wrong password", openapi.Ref("Error")),
+					"404": openapi.JsonResponse("wallet not in the keystore", openapi.Ref("Error")),
+				},
+			},
+		}},
+		{Route: "/wallet/hd", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "listHDWallets",
+				Summary:     "HD wallets in the keystore, with their accounts and addresses",
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("the HD wallets", openapi.Ref("HDWallets"))},
+			},
+			http.MethodPost: {
+				OperationID: "createHDWallet",
+				Summary:     "Create an HD wallet with a new mnemonic, or restore one and find its used addresses on the node",
+				RequestBody: openapi.JsonBody(openapi.Ref("HDWalletRequest")),
+				Responses: gatewayErrors(map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the HD wallet, with the mnemonic if it is new", openapi.Ref("HDWallet")),
+					"400": openapi.JsonResponse("invalid json, short password, invalid mnemonic or word count", openapi.Ref("Error")),
+					"401": openapi.JsonResponse("the seed is already in the keystore with another password", openapi.Ref("Error")),
+				}),
+			},
+		}},
+		{Route: "/wallet/hd/address", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "deriveHDAddress",
+				Summary:     "Derive the next address of an account and save its key in the keystore",
+				RequestBody: openapi.JsonBody(openapi.Ref("HDAddressRequest")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the new wallet", openapi.Ref("Wallet")),
+					"400": openapi.JsonResponse("invalid json, missing or invalid field", openapi.Ref("Error")),
+					"401": openapi.JsonResponse("wrong password", openapi.Ref("Error")),
+					"404": openapi.JsonResponse("seed not in the keystore", openapi.Ref("Error")),
+				},
+			},
+		}},
+		{Route: "/wallet/hd/scan", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "scanHDWallet",
+				Summary:     "Find the used addresses of an HD wallet on the node and save the missing keys",
+				RequestBody: openapi.JsonBody(openapi.Ref("HDScanRequest")),
+				Responses: gatewayErrors(map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the HD wallet", openapi.Ref("HDWallet")),
+					"400": openapi.JsonResponse("invalid json, missing or invalid field", openapi.Ref("Error")),
+					"401": openapi.JsonResponse("wrong password", openapi.Ref("Error")),
+					"404": openapi.JsonResponse("seed not in the keystore", openapi.Ref("Error")),
+				}),
+			},
+		}},
+		{Route: "/wallet/multisig", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "listMultisigWallets",
+				Summary:     "Multisig accounts in the keystore",
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("the policies of the accounts", openapi.Ref("MultisigWallets"))},
+			},
+			http.MethodPost: {
+				OperationID: "createMultisigWallet",
+				Summary:     "Create an M-of-N multisig account from the public keys of the signers",
+				RequestBody: openapi.JsonBody(openapi.Ref("MultisigRequest")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the account, also when it already exists", openapi.Ref("MultisigWallet")),
+					"400": openapi.JsonResponse("invalid json, missing field, invalid threshold or public keys", openapi.Ref("Error")),
+				},
+			},
+		}},
+		{Route: "/wallet/amount", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getWalletAmount",
+				Summary:     "Balance of an address, read from the node",
+				Parameters:  []*openapi.Parameter{addressParam, assetParam},
+				Responses: gatewayErrors(map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the balance", openapi.Ref("WalletAmount")),
+					"400": openapi.JsonResponse("missing blockchain_address", openapi.Ref("Error")),
+					"404": openapi.JsonResponse("the asset was never issued", openapi.Ref("Error")),
+				}),
+			},
+		}},
+		{Route: "/wallet/events", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "streamWalletEvents",
+				Summary:     "Server-Sent Events of the node that concern the address",
+				Parameters:  []*openapi.Parameter{addressParam, openapi.Header("Last-Event-ID", "resume after this block height")},
+				Responses: gatewayErrors(map[string]*openapi.Response{
+					"200": {Description: "event stream of the node", Content: map[string]*openapi.MediaType{
+						"text/event-stream": {Schema: &openapi.Schema{}},
+					}},
+					"400": openapi.JsonResponse("missing blockchain_address", openapi.Ref("Error")),
+				}),
+			},
+		}},
+		{Route: "/transaction", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "createTransaction",
+				Summary:     "Sign a transaction with a keystore key and send it to the node",
+				RequestBody: openapi.JsonBody(openapi.Ref("TransactionRequest")),
+				Responses: gatewayErrors(map[string]*openapi.Response{
+					"200": openapi.JsonResponse("accepted by the node", openapi.Ref("Status")),
+					"400": openapi.JsonResponse("invalid json, missing or invalid field", openapi.Ref("Error")),
+					"401": openapi.JsonResponse("wrong password", openapi.Ref("Error")),
+					"404": openapi.JsonResponse("sender wallet not in the keystore", openapi.Ref("Error")),
+					"422": openapi.JsonResponse("insufficient balance", openapi.Ref("Error")),
+				}),
+			},
+		}},
+		{Route: "/transaction/unsigned", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "createUnsignedTransaction",
+				Summary:     "Build a transaction to sign outside the server",
+				RequestBody: openapi.JsonBody(openapi.Ref("UnsignedTransactionRequest")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the transaction and the payload to sign", openapi.Ref("UnsignedTransaction")),
+					"400": openapi.JsonResponse("invalid json, missing or invalid field", openapi.Ref("Error")),
+				},
+			},
+		}},
+		{Route: "/transaction/relay", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "relayTransaction",
+				Summary:     "Check a signed transaction and send it to the node",
+				RequestBody: openapi.JsonBody(openapi.Ref("SignedTransaction")),
+				Responses: gatewayErrors(map[string]*openapi.Response{
+					"200": openapi.JsonResponse("accepted by the node", openapi.Ref("Status")),
+					"400": openapi.JsonResponse("invalid json, missing field, public key not of the sender or invalid signature", openapi.Ref("Error")),
+					"409": openapi.JsonResponse("the transaction was already relayed", openapi.Ref("Error")),
+					"422": openapi.JsonResponse("insufficient balance", openapi.Ref("Error")),
+				}),
+			},
+		}},
+		{Route: "/transaction/partial", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "createPartialTransaction",
+				Summary:     "Build a partially signed transaction, without signatures, to pass to the signers",
+				RequestBody: openapi.JsonBody(openapi.Ref("UnsignedTransactionRequest")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the transaction and its required signers", openapi.Ref("PartialTransaction")),
+					"400": openapi.JsonResponse("invalid json, missing or invalid field", openapi.Ref("Error")),
+					"404": openapi.JsonResponse("multisig sender not in the keystore", openapi.Ref("Error")),
+				},
+			},
+		}},
+		{Route: "/transaction/partial/sign", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "signPartialTransaction",
+				Summary:     "Add a signature, with a key in the keystore or made elsewhere",
+				RequestBody: openapi.JsonBody(openapi.Ref("PartialSignRequest")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the transaction with the new signature", openapi.Ref("PartialTransaction")),
+					"400": openapi.JsonResponse("invalid json, missing field, invalid transaction, not a required signer or invalid signature", openapi.Ref("Error")),
+					"401": openapi.JsonResponse("wrong password", openapi.Ref("Error")),
+					"404": openapi.JsonResponse("signer wallet not in the keystore", openapi.Ref("Error")),
+				},
+			},
+		}},
+		{Route: "/transaction/partial/combine", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "combinePartialTransactions",
+				Summary:     "Merge the signatures of copies signed by different signers",
+				RequestBody: openapi.JsonBody(openapi.Ref("PartialCombineRequest")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the transaction with all the signatures", openapi.Ref("PartialTransaction")),
+					"400": openapi.JsonResponse("invalid json, missing field, invalid transaction or copies of different transactions", openapi.Ref("Error")),
+				},
+			},
+		}},
+		{Route: "/transaction/partial/finalize", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "finalizePartialTransaction",
+				Summary:     "Build the signed transaction once all the signers have signed, and optionally send it to the node",
+				RequestBody: openapi.JsonBody(openapi.Ref("PartialFinalizeRequest")),
+				Responses: gatewayErrors(map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the signed transaction", openapi.Ref("SignedTransaction")),
+					"400": openapi.JsonResponse("invalid json, missing field, invalid transaction or missing signatures", openapi.Ref("Error")),
+					"422": openapi.JsonResponse("insufficient balance, with relay", openapi.Ref("Error")),
+				}),
+			},
+		}},
+		{Route: "/htlc", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "lockHtlc",
+				Summary:     "Lock funds of a keystore wallet in a hash time-locked contract",
+				Description: "Without hash the server generates the preimage, to start an atomic swap. " +
+					"The other party locks on its chain with the same hash and an earlier timeout.",
+				RequestBody: openapi.JsonBody(openapi.Ref("HtlcRequest")),
+				Responses: gatewayErrors(map[string]*openapi.Response{
+					"201": openapi.JsonResponse("the contract and the generated preimage", openapi.Ref("LockedHtlc")),
+					"400": openapi.JsonResponse("invalid json, missing or invalid field", openapi.Ref("Error")),
+					"401": openapi.JsonResponse("wrong password", openapi.Ref("Error")),
+					"404": openapi.JsonResponse("sender wallet not in the keystore", openapi.Ref("Error")),
+					"422": openapi.JsonResponse("insufficient balance", openapi.Ref("Error")),
+				}),
+			},
+		}},
+		{Route: "/htlc/status", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "getHtlcStatus",
+				Summary:     "Funds and state of a contract, with the preimage once claimed",
+				RequestBody: openapi.JsonBody(openapi.Ref("HtlcContract")),
+				Responses: gatewayErrors(map[string]*openapi.Response{
+					"200": openapi.JsonResponse("the contract status", openapi.Ref("HtlcStatus")),
+					"400": openapi.JsonResponse("invalid json, missing or invalid field", openapi.Ref("Error")),
+				}),
+			},
+		}},
+		{Route: "/htlc/claim", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "claimHtlc",
+				Summary:     "Send the locked funds to the recipient, revealing the preimage",
+				RequestBody: openapi.JsonBody(openapi.Ref("Htlc")),
+				Responses: gatewayErrors(map[string]*openapi.Response{
+					"201": openapi.JsonResponse("the transaction added to the pool", openapi.Ref("SignedTransaction")),
+					"400": openapi.JsonResponse("invalid json, missing or invalid field, wrong preimage", openapi.Ref("Error")),
+					"409": openapi.JsonResponse("a transaction spending the funds is already in the pool", openapi.Ref("Error")),
+					"422": openapi.JsonResponse("no funds locked or timeout reached", openapi.Ref("Error")),
+				}),
+			},
+		}},
+		{Route: "/htlc/refund", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "refundHtlc",
+				Summary:     "Send the locked funds back to the sender after the timeout",
+				RequestBody: openapi.JsonBody(openapi.Ref("HtlcContract")),
+				Responses: gatewayErrors(map[string]*openapi.Response{
+					"201": openapi.JsonResponse("the transaction added to the pool", openapi.Ref("SignedTransaction")),
+					"400": openapi.JsonResponse("invalid json, missing or invalid field", openapi.Ref("Error")),
+					"409": openapi.JsonResponse("a transaction spending the funds is already in the pool", openapi.Ref("Error")),
+					"422": openapi.JsonResponse("no funds locked or timeout not reached", openapi.Ref("Error")),
+				}),
+			},
+		}},
+		{Route: "/sign", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getSignPage",
+				Summary:     "Web page that signs an unsigned transaction in the browser, also offline",
+				Responses:   map[string]*openapi.Response{"200": {Description: "html page"}},
+			},
+		}},
+		{Route: "/rpc", Operations: map[string]*openapi.Operation{
+			http.MethodPost: {
+				OperationID: "rpc",
+				Summary:     "JSON-RPC 2.0 request or batch",
+				Description: "The same path accepts a websocket upgrade, every message is a request. " +
+					"Browser pages of other origins can open it only if they are in -allowed-origins, otherwise the upgrade gets 403. " +
+					"wallet_create takes the body of POST /wallet, wallet_sign and wallet_send the body of POST /transaction: " +
+					"wallet_sign returns the signed transaction for tx_send of the node, wallet_send sends it and returns it.",
+				RequestBody: openapi.JsonBody(openapi.Ref("JsonRpcRequest")),
+				Responses: map[string]*openapi.Response{
+					"200": openapi.JsonResponse("JSON-RPC response or batch of responses", openapi.Map(&openapi.Schema{})),
+					"204": {Description: "only notifications were sent"},
+				},
+			},
+		}},
+		{Route: "/openapi.json", Operations: map[string]*openapi.Operation{
+			http.MethodGet: {
+				OperationID: "getOpenAPI",
+				Summary:     "This document",
+				Responses:   map[string]*openapi.Response{"200": openapi.JsonResponse("OpenAPI document", openapi.Map(&openapi.Schema{}))},
+			},
+		}},
+	}
+
+	routes := ws.Routes()
+	paths := make([]string, 0, len(routes))
+	for _, r := range routes {
+		paths = append(paths, r.Path)
+	}
+	if err := doc.AddEndpoints(paths, endpoints); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Resolver dell'endpoint "/openapi.json"
+func (ws *WalletServer) GetOpenAPI(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		doc, err := ws.OpenAPI()
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.Internal(err.Error()))
+			return
+		}
+		m, _ := doc.Marshal()
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
+	}
+}
@@ -0,0 +1,219 @@
+package wallet_server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/multisig"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/partial_transaction"
+	wallet_transaction_request "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/unsigned_transaction"
+)
+
+// Resolver per l'endpoint "/transaction/partial"
+// Crea una transazione parzialmente firmata, senza firme, da passare
+// ai firmatari, che per un account multisig sono le chiavi della
+// policy
+func (ws *WalletServer) PartialTransaction(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var ur wallet_transaction_request.UnsignedTransactionRequest
+		if err := json.NewDecoder(req.Body).Decode(&ur); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := ur.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		chainID, err := ws.nodeChainID(req.Context())
+		if err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		ut, err := newUnsignedTransaction(chainID, &ur)
+		if err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		pt, err := ws.newPartialTransaction(ut)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, err)
+			return
+		}
+		writePartial(w, pt)
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Resolver per l'endpoint "/transaction/partial/sign"
+// Aggiunge una firma alla transazione: con la password firma la
+// chiave dell'address che è nel keystore, altrimenti si passano
+// chiave pubblica e firma fatte altrove
+func (ws *WalletServer) SignPartialTransaction(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var sr wallet_transaction_request.PartialSignRequest
+		if err := json.NewDecoder(req.Body).Decode(&sr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := sr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		pt := sr.PartialTransaction
+		if err := pt.Check(); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, partialError(err, "partial_transaction"))
+			return
+		}
+		if sr.PublicKey != nil {
+			if err := pt.AddSignature(*sr.PublicKey, *sr.Signature); err != nil {
+				log.Printf("ERROR: %v", err)
+				api_error.Write(w, partialError(err, "public_key"))
+				return
+			}
+			writePartial(w, pt)
+			return
+		}
+		signer, err := ws.keystore.Load(*sr.BlockchainAddress, *sr.Password)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, keystoreError(err, "blockchain_address"))
+			return
+		}
+		if err := pt.Sign(signer); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, partialError(err, "blockchain_address"))
+			return
+		}
+		writePartial(w, pt)
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Resolver per l'endpoint "/transaction/partial/combine"
+// Unisce le firme delle copie firmate dai diversi firmatari
+func (ws *WalletServer) CombinePartialTransactions(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var cr wallet_transaction_request.PartialCombineRequest
+		if err := json.NewDecoder(req.Body).Decode(&cr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := cr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		pt, err := partial_transaction.Combine(cr.PartialTransactions...)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, partialError(err, "partial_transactions"))
+			return
+		}
+		writePartial(w, pt)
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Resolver per l'endpoint "/transaction/partial/finalize"
+// Ritorna la transazione firmata quando ci sono abbastanza firme e, con
+// relay, la inoltra anche al nodo
+func (ws *WalletServer) FinalizePartialTransaction(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var fr wallet_transaction_request.PartialFinalizeRequest
+		if err := json.NewDecoder(req.Body).Decode(&fr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := fr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		tr, err := fr.PartialTransaction.Finalize()
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, partialError(err, "partial_transaction"))
+			return
+		}
+		if fr.Relay {
+			if err := ws.node.SendTransaction(req.Context(), tr); err != nil {
+				log.Printf("ERROR: %v", err)
+				api_error.Write(w, gatewayError(err))
+				return
+			}
+		}
+		m, _ := json.Marshal(tr)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Metodo che crea la transazione parzialmente firmata: se il sender
+// è un account multisig la sua policy deve essere nel keystore
+func (ws *WalletServer) newPartialTransaction(ut *unsigned_transaction.UnsignedTransaction) (*partial_transaction.PartialTransaction, error) {
+	if !multisig.IsAddress(ut.SenderBlockchainAddress) {
+		pt, err := partial_transaction.NewPartialTransaction(ut)
+		if err != nil {
+			return nil, api_error.Internal(err.Error())
+		}
+		return pt, nil
+	}
+	mf, err := ws.keystore.MultisigFile(ut.SenderBlockchainAddress)
+	if errors.Is(err, keystore.ErrNotFound) {
+		return nil, api_error.NotFound("multisig account not in the keystore").WithField("sender_blockchain_address")
+	}
+	if err != nil {
+		return nil, api_error.Internal(err.Error())
+	}
+	pt, err := partial_transaction.NewMultisigPartialTransaction(ut, &mf.Policy)
+	if err != nil {
+		return nil, api_error.Internal(err.Error())
+	}
+	return pt, nil
+}
+
+// Funzione che scrive la transazione parzialmente firmata nella
+// risposta
+func writePartial(w http.ResponseWriter, pt *partial_transaction.PartialTransaction) {
+	m, _ := json.Marshal(pt)
+	w.Header().Add("Content-Type", "application/json")
+	io.WriteString(w, string(m[:]))
+}
+
+// Funzione che converte gli errori delle transazioni parzialmente
+// firmate in errori dell'API, field è il campo della richiesta a cui
+// si riferisce l'errore
+func partialError(err error, field string) error {
+	switch {
+	case errors.Is(err, partial_transaction.ErrNotSigner):
+		return api_error.InvalidField(field, "is not of a required signer")
+	case errors.Is(err, partial_transaction.ErrMismatch):
+		return api_error.InvalidField(field, "are not copies of the same transaction")
+	case errors.Is(err, unsigned_transaction.ErrInvalidSignature) && field == "public_key":
+		return api_error.InvalidField("signature", "does not verify with the public key")
+	}
+	return api_error.InvalidField(field, err.Error())
+}
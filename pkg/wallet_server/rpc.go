@@ -0,0 +1,138 @@
+package wallet_server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/json_rpc"
+	wallet_transaction_request "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet_request"
+)
+
+// Codici di errore dei metodi JSON-RPC del wallet, gli stessi del
+// nodo per gli stessi casi
+const (
+	RPC_WRONG_PASSWORD       = -32003
+	RPC_NOT_FOUND            = -32004
+	RPC_TRANSACTION_REJECTED = -32010
+	RPC_GATEWAY_UNREACHABLE  = -32030
+)
+
+// Metodo che crea il server JSON-RPC e registra i metodi, che usano
+// lo stesso keystore degli endpoint REST
+func (ws *WalletServer) newRpcServer() *json_rpc.Server {
+	s := json_rpc.NewServer()
+	s.Register("wallet_create", ws.rpcCreateWallet)
+	s.Register("wallet_list", ws.rpcListWallets)
+	s.Register("wallet_sign", ws.rpcSignTransaction)
+	s.Register("wallet_send", ws.rpcSendTransaction)
+	return s
+}
+
+// Resolver dell'endpoint "/rpc", con POST o con un websocket
+func (ws *WalletServer) Rpc(w http.ResponseWriter, req *http.Request) {
+	ws.rpc.ServeHTTP(w, req)
+}
+
+// Funzione per leggere i parametri, che devono essere un oggetto
+func decodeParams(params json.RawMessage, v interface{}) *json_rpc.Error {
+	if len(params) == 0 || params[0] != '{' {
+		return json_rpc.InvalidParams("params must be an object")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return json_rpc.InvalidParams("%v", err)
+	}
+	return nil
+}
+
+// Funzione che crea un errore JSON-RPC con il messaggio dell'errore
+// REST equivalente, che finisce nei dati con il suo codice e il campo
+// Il codice JSON-RPC dipende da quello REST, code vale per gli altri
+func rpcError(code int, err error) *json_rpc.Error {
+	e := api_error.From(err)
+	switch e.Code {
+	case api_error.CODE_MISSING_FIELD, api_error.CODE_INVALID_FIELD, api_error.CODE_INVALID_JSON:
+		code = json_rpc.INVALID_PARAMS
+	case api_error.CODE_WRONG_PASSWORD:
+		code = RPC_WRONG_PASSWORD
+	case api_error.CODE_NOT_FOUND:
+		code = RPC_NOT_FOUND
+	case api_error.CODE_GATEWAY_UNREACHABLE:
+		code = RPC_GATEWAY_UNREACHABLE
+	}
+	return json_rpc.NewError(code, e.Message, e)
+}
+
+// I parametri sono gli stessi del POST su "/wallet"
+func (ws *WalletServer) rpcCreateWallet(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	var wr wallet_request.WalletRequest
+	if err := decodeParams(params, &wr); err != nil {
+		return nil, err
+	}
+	if err := wr.Validate(); err != nil {
+		return nil, rpcError(json_rpc.INVALID_PARAMS, err)
+	}
+	w, err := ws.keystore.Create(*wr.Password)
+	if err != nil {
+		return nil, rpcError(json_rpc.INTERNAL_ERROR, keystoreError(err, ""))
+	}
+	return &walletInfo{PublicKey: w.PublicKeyStr(), BlockchainAddress: w.BlockchainAddress()}, nil
+}
+
+func (ws *WalletServer) rpcListWallets(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	list, err := ws.keystore.List()
+	if err != nil {
+		return nil, rpcError(json_rpc.INTERNAL_ERROR, api_error.Internal(err.Error()))
+	}
+	wallets := make([]*walletInfo, 0, len(list))
+	for _, kf := range list {
+		wallets = append(wallets, newWalletInfo(kf))
+	}
+	return map[string][]*walletInfo{"wallets": wallets}, nil
+}
+
+// Funzione che legge e valida i parametri di una transazione, gli
+// stessi del POST su "/transaction"
+func transactionParams(params json.RawMessage) (*wallet_transaction_request.TransactionRequest, *json_rpc.Error) {
+	var t wallet_transaction_request.TransactionRequest
+	if err := decodeParams(params, &t); err != nil {
+		return nil, err
+	}
+	if err := t.Validate(); err != nil {
+		return nil, rpcError(json_rpc.INVALID_PARAMS, err)
+	}
+	return &t, nil
+}
+
+// Firma la transazione senza inviarla, il risultato si può passare
+// al metodo tx_send del nodo
+func (ws *WalletServer) rpcSignTransaction(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	t, rpcErr := transactionParams(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	bt, err := ws.signTransaction(ctx, t)
+	if err != nil {
+		return nil, rpcError(json_rpc.INTERNAL_ERROR, err)
+	}
+	return bt, nil
+}
+
+// Firma la transazione e la invia al nodo, ritorna la transazione
+// accettata
+func (ws *WalletServer) rpcSendTransaction(ctx context.Context, params json.RawMessage) (interface{}, *json_rpc.Error) {
+	t, rpcErr := transactionParams(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	bt, err := ws.signTransaction(ctx, t)
+	if err != nil {
+		return nil, rpcError(json_rpc.INTERNAL_ERROR, err)
+	}
+	if err := ws.node.SendTransaction(ctx, bt); err != nil {
+		return nil, rpcError(RPC_TRANSACTION_REJECTED, gatewayError(err))
+	}
+	return bt, nil
+}
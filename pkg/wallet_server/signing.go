@@ -0,0 +1,150 @@
+package wallet_server
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	blockchain_transaction_request "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/utils"
+	wallet_transaction_request "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/unsigned_transaction"
+)
+
+// Resolver per l'endpoint "/sign"
+// Pagina che firma nel browser, con WebCrypto, una transazione da
+// firmare: la chiave privata non lascia il browser e la pagina
+// funziona anche salvata e aperta senza rete
+func (ws *WalletServer) SignPage(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		t, err := template.ParseFiles(path.Join(tempDir, "sign.html"))
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.Internal(err.Error()))
+			return
+		}
+		t.Execute(w, "")
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
+	}
+}
+
+// Resolver per l'endpoint "/transaction/unsigned"
+// Prepara la transazione da firmare fuori dal server, con la CLI o
+// nel browser, il server non ha bisogno della chiave
+func (ws *WalletServer) UnsignedTransaction(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var ur wallet_transaction_request.UnsignedTransactionRequest
+		if err := json.NewDecoder(req.Body).Decode(&ur); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := ur.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		chainID, err := ws.nodeChainID(req.Context())
+		if err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		ut, err := newUnsignedTransaction(chainID, &ur)
+		if err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		m, _ := json.Marshal(ut)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Funzione che crea la transazione da firmare per la rete chainID
+// dalla richiesta già validata, il valore deve essere un numero
+// maggiore di 0, se non è un'operazione su un token, e i limiti di
+// validità, se mancano, sono 0
+func newUnsignedTransaction(chainID string, ur *wallet_transaction_request.UnsignedTransactionRequest) (*unsigned_transaction.UnsignedTransaction, error) {
+	var validAfter, validUntil int64
+	if ur.ValidAfter != nil {
+		validAfter = *ur.ValidAfter
+	}
+	if ur.ValidUntil != nil {
+		validUntil = *ur.ValidUntil
+	}
+	if ur.Asset != nil {
+		return unsigned_transaction.NewAssetTransaction(chainID, *ur.SenderBlockchainAddress, *ur.RecipientBlockchainAddress, ur.Asset, validAfter, validUntil), nil
+	}
+	value, err := strconv.ParseFloat(*ur.Value, 32)
+	if err != nil {
+		return nil, api_error.InvalidField("value", "must be a number")
+	}
+	if !(value > 0) {
+		return nil, api_error.InvalidField("value", "must be greater than 0")
+	}
+	return unsigned_transaction.NewUnsignedTransaction(chainID, *ur.SenderBlockchainAddress, *ur.RecipientBlockchainAddress, float32(value), validAfter, validUntil), nil
+}
+
+// Resolver per l'endpoint "/transaction/relay"
+// Inoltra al nodo una transazione già firmata, dopo aver controllato
+// che la chiave pubblica sia quella del sender e che la firma sia
+// valida, o il witness se il sender è multisig, così gli errori si
+// vedono prima di arrivare al nodo
+func (ws *WalletServer) RelayTransaction(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var tr blockchain_transaction_request.TransactionRequest
+		if err := json.NewDecoder(req.Body).Decode(&tr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := tr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		if err := unsigned_transaction.Verify(&tr); err != nil {
+			log.Printf("ERROR: %v", err)
+			if tr.Witness != nil {
+				api_error.Write(w, api_error.InvalidField("witness", err.Error()))
+				return
+			}
+			if tr.Htlc != nil {
+				api_error.Write(w, api_error.InvalidField("htlc", err.Error()))
+				return
+			}
+			if tr.Script != nil {
+				api_error.Write(w, api_error.InvalidField("script", err.Error()))
+				return
+			}
+			if errors.Is(err, unsigned_transaction.ErrInvalidPublicKey) {
+				api_error.Write(w, api_error.InvalidField("sender_public_key", "is not the key of the sender address"))
+				return
+			}
+			api_error.Write(w, api_error.InvalidField("signature", "does not verify with the public key"))
+			return
+		}
+		if err := ws.node.SendTransaction(req.Context(), &tr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, gatewayError(err))
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(utils.JsonStatus("success")))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
@@ -1,38 +1,74 @@
 package wallet_server
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"path"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/iltommi1995/blockchain-go/pkg/blockchain/amount_response"
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	blockchain_transaction "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
 	blockchain_transaction_request "github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction_request"
+	"github.com/iltommi1995/blockchain-go/pkg/client"
+	"github.com/iltommi1995/blockchain-go/pkg/json_rpc"
 	"github.com/iltommi1995/blockchain-go/pkg/utils"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/keystore"
 	wallet_transaction "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction"
 	wallet_transaction_request "github.com/iltommi1995/blockchain-go/pkg/wallet/transaction_request"
-	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet"
+	"github.com/iltommi1995/blockchain-go/pkg/wallet/wallet_request"
 )
 
 // Path della directory dei template
 const tempDir = "pkg/wallet_server/templates"
 
-// Wallet server ha 2 proprietà:
+// Tempo concesso alle richieste in corso quando il server si ferma
+const SHUTDOWN_TIMEOUT_SEC = 10
+
+// Tipi di evento che il wallet inoltra alla pagina
+const WALLET_EVENT_TYPES = "new_tip,reorg,tx_accepted,tx_confirmed"
+
+// Wallet server ha 3 proprietà:
 // - porta su cui sarà in ascolto
-// - gateway, che è l'url del blockchain server
+// - gateway, che è l'url del blockchain server, o più url separati
+// da virgole tra cui scegliere quando uno non risponde
+// - keystore con le chiavi dei wallet, cifrate con le loro password
 type WalletServer struct {
-	port    uint16
-	gateway string
+	port     uint16
+	gateway  string
+	keystore *keystore.Keystore
+	// Client dei blockchain server del gateway
+	node *client.NodeClient
+	// Chain ID della rete del gateway, letto dal nodo la prima volta
+	// che serve firmare
+	chainID  string
+	chainMux sync.Mutex
+	// Server JSON-RPC dell'endpoint "/rpc"
+	rpc *json_rpc.Server
+	// Contesto degli stream di eventi inoltrati, cancellato quando
+	// il server si ferma
+	streams      context.Context
+	closeStreams context.CancelFunc
 }
 
 // Funzione per creare il wallet server
-func NewWalletServer(port uint16, gateway string) *WalletServer {
-	return &WalletServer{port, gateway}
+func NewWalletServer(port uint16, gateway string, ks *keystore.Keystore) *WalletServer {
+	ws := &WalletServer{port: port, gateway: gateway, keystore: ks}
+	ws.node = client.NewNodeClient(strings.Split(gateway, ","), client.Options{})
+	ws.rpc = ws.newRpcServer()
+	ws.streams, ws.closeStreams = context.WithCancel(context.Background())
+	return ws
 }
 
 // Getter di port
@@ -45,6 +81,17 @@ func (ws *WalletServer) Gateway() string {
 	return ws.gateway
 }
 
+// Getter del keystore
+func (ws *WalletServer) Keystore() *keystore.Keystore {
+	return ws.keystore
+}
+
+// Metodo per ammettere i websocket di "/rpc" aperti dalle pagine di
+// altre origini, di default solo quelle del wallet server
+func (ws *WalletServer) SetAllowedOrigins(origins []string) {
+	ws.rpc.SetAllowedOrigins(origins)
+}
+
 // Resolver per l'endpoint "/"
 func (ws *WalletServer) Index(w http.ResponseWriter, req *http.Request) {
 	// Controllo il metodo
@@ -58,26 +105,108 @@ func (ws *WalletServer) Index(w http.ResponseWriter, req *http.Request) {
 	default:
 		// Per qualsiasi altro HTTP Method, dò errore
 		log.Printf("ERROR: invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
 	}
 }
 
 // Resolver per l'endpoint "/wallet"
+// GET restituisce i wallet del keystore, POST ne crea uno nuovo
+// cifrato con la password della richiesta
+// La chiave privata resta nel keystore e non viene mai restituita
 func (ws *WalletServer) Wallet(w http.ResponseWriter, req *http.Request) {
 	// Controllo il metodo
 	switch req.Method {
+	// Se è GET
+	case http.MethodGet:
+		list, err := ws.keystore.List()
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.Internal(err.Error()))
+			return
+		}
+		wallets := make([]*walletInfo, 0, len(list))
+		for _, kf := range list {
+			wallets = append(wallets, newWalletInfo(kf))
+		}
+		m, _ := json.Marshal(struct {
+			Wallets []*walletInfo `json:"wallets"`
+			Length  int           `json:"length"`
+		}{
+			Wallets: wallets,
+			Length:  len(wallets),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
 	// Se è POST
 	case http.MethodPost:
-		// Setto gli headers
+		var wr wallet_request.WalletRequest
+		if err := json.NewDecoder(req.Body).Decode(&wr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := wr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		// Creo un nuovo wallet e lo salvo nel keystore
+		myWallet, err := ws.keystore.Create(*wr.Password)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, keystoreError(err, ""))
+			return
+		}
+		// Restituisco, in json, i dati pubblici del wallet
+		m, _ := json.Marshal(&walletInfo{PublicKey: myWallet.PublicKeyStr(), BlockchainAddress: myWallet.BlockchainAddress()})
 		w.Header().Add("Content-Type", "application/json")
-		// Creo un nuovo wallet
-		myWallet := wallet.NewWallet()
-		// Restituisco, in json, i dati del wallet
-		m, _ := myWallet.MarshalJSON()
 		io.WriteString(w, string(m[:]))
 	default:
 		// Per qualsiasi altro HTTP Method, dò errore
-		w.WriteHeader(http.StatusBadRequest)
 		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet, http.MethodPost)
+	}
+}
+
+// Dati pubblici di un wallet del keystore, con il seed e il path
+// se è derivato da un wallet HD
+type walletInfo struct {
+	PublicKey         string `json:"public_key"`
+	BlockchainAddress string `json:"blockchain_address"`
+	SeedID            string `json:"seed_id,omitempty"`
+	Path              string `json:"path,omitempty"`
+	Created           int64  `json:"created,omitempty"`
+}
+
+// Funzione che ritorna i dati pubblici del file del keystore
+func newWalletInfo(kf *keystore.KeyFile) *walletInfo {
+	return &walletInfo{PublicKey: kf.PublicKey, BlockchainAddress: kf.BlockchainAddress, SeedID: kf.Seed, Path: kf.Path, Created: kf.Created}
+}
+
+// Resolver per l'endpoint "/wallet/password"
+// Cifra di nuovo la chiave del wallet con la nuova password
+func (ws *WalletServer) WalletPassword(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		var pr wallet_request.PasswordRequest
+		if err := json.NewDecoder(req.Body).Decode(&pr); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, api_error.InvalidJson(err))
+			return
+		}
+		if err := pr.Validate(); err != nil {
+			api_error.Write(w, err)
+			return
+		}
+		if err := ws.keystore.ChangePassword(*pr.BlockchainAddress, *pr.Password, *pr.NewPassword); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, keystoreError(err, "blockchain_address"))
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(utils.JsonStatus("success")))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
 	}
 }
 
@@ -97,87 +226,132 @@ func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Reque
 		// Se il decode fallisce, restituisco errore
 		if err != nil {
 			log.Printf("ERROR: %v", err)
-			io.WriteString(w, string(utils.JsonStatus("fail")))
+			api_error.Write(w, api_error.InvalidJson(err))
 			return
 		}
 		// La transazione non è valida, restituisco errore
-		if !t.Validate() {
-			log.Println("ERROR: missing field(s)")
-			io.WriteString(w, string(utils.JsonStatus("fail")))
+		if err := t.Validate(); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, err)
 			return
 		}
-		/*
-			fmt.Println(len(*t.SenderPublicKey))
-			fmt.Println(len(*t.SenderBloackchainAddress))
-			fmt.Println(len(*t.SenderPrivateKey))
-			fmt.Println(*t.RecipientBlockchainAddress)
-			fmt.Println(*t.Value)
-		*/
-
-		// Converto la Public Key da stringa ecdsa.PublicKey
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		// Converto la Private Key da stringa ecdsa.PrivateKey
-		privateKey := utils.PrivateKeyFromString(*t.SenderPrivateKey, publicKey)
-		// Converto il value in un float
-		value, err := strconv.ParseFloat(*t.Value, 32)
-		// In caso di errore dico che c'è stato un errore di parsing
+		// Firmo la transazione con la chiave del keystore
+		bt, err := ws.signTransaction(req.Context(), &t)
 		if err != nil {
-			log.Println("ERROR: parse error")
-			io.WriteString(w, string(utils.JsonStatus("fail")))
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, err)
 			return
 		}
-		//
-		value32 := float32(value)
-		/*
-			fmt.Println(publicKey)
-			fmt.Println(privateKey)
-			fmt.Printf("%.1f\n", value32)
-		*/
-
-		w.Header().Add("Content-Type", "application/json")
-
-		// Creo una transazione lato wallet, passando i dati necessari
-		transaction := wallet_transaction.NewTransaction(
-			privateKey,
-			publicKey,
-			*t.SenderBloackchainAddress,
-			*t.RecipientBlockchainAddress,
-			value32)
-		// Creo la signature della transaction
-		signature := transaction.GenerateSignature()
-		// Versione string della signature
-		signatureStr := signature.String()
-
-		// Creo transaction request lato server
-		bt := &blockchain_transaction_request.TransactionRequest{
-			SenderBlockchainAddress:    t.SenderBloackchainAddress,
-			RecipientBlockchainAddress: t.RecipientBlockchainAddress,
-			SenderPublicKey:            t.SenderPublicKey,
-			Value:                      &value32,
-			Signature:                  &signatureStr,
-		}
-		// Converto in json la transaction request
-		m, _ := json.Marshal(bt)
-		// Creo un buffer della transaction request
-		buf := bytes.NewBuffer(m)
-		// Faccio una post request all'endpoint del blockchain server, inviando i dati
-		// della transaction request
-		resp, _ := http.Post(ws.Gateway()+"/transactions", "application/json", buf)
-		// Se lo status code è 201, restituisco success
-		if resp.StatusCode == 201 {
-			io.WriteString(w, string(utils.JsonStatus("success")))
+		// Invio la transaction request al blockchain server, se la
+		// rifiuta restituisco il suo errore
+		if err := ws.node.SendTransaction(req.Context(), bt); err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, gatewayError(err))
 			return
 		}
-		// Altrimenti restituisco fail
-		io.WriteString(w, string(utils.JsonStatus("fail")))
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(utils.JsonStatus("success")))
 	default:
 		// Per qualsiasi altro HTTP Method, dò errore
-		w.WriteHeader(http.StatusBadRequest)
 		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodPost)
+	}
+}
+
+// Metodo che ritorna il chain ID della rete del gateway, da firmare
+// con le transazioni, lo chiede al nodo solo la prima volta
+// Ritorna l'errore del gateway se il nodo non risponde
+func (ws *WalletServer) nodeChainID(ctx context.Context) (string, error) {
+	ws.chainMux.Lock()
+	defer ws.chainMux.Unlock()
+	if ws.chainID == "" {
+		network, err := ws.node.Network(ctx)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			return "", gatewayError(err)
+		}
+		ws.chainID = network.ChainID
+	}
+	return ws.chainID, nil
+}
+
+// Metodo che firma la transazione della richiesta, già validata, con
+// la chiave del sender letta dal keystore, per la rete del gateway
+// Ritorna la transazione da inviare al nodo o un *api_error.ApiError
+func (ws *WalletServer) signTransaction(ctx context.Context, t *wallet_transaction_request.TransactionRequest) (*blockchain_transaction_request.TransactionRequest, error) {
+	chainID, err := ws.nodeChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Leggo la chiave del sender dal keystore
+	senderWallet, err := ws.keystore.Load(*t.SenderBloackchainAddress, *t.Password)
+	if err != nil {
+		return nil, keystoreError(err, "sender_blockchain_address")
+	}
+	publicKey := senderWallet.PublicKey()
+	privateKey := senderWallet.PrivateKey()
+	publicKeyStr := senderWallet.PublicKeyStr()
+	// Converto il value in un float, le operazioni sui token non
+	// hanno value
+	var value32 float32
+	if t.Asset == nil {
+		value, err := strconv.ParseFloat(*t.Value, 32)
+		// In caso di errore dico che c'è stato un errore di parsing
+		if err != nil {
+			return nil, api_error.InvalidField("value", "must be a number")
+		}
+		value32 = float32(value)
 	}
+	/*
+		fmt.Println(publicKey)
+		fmt.Println(privateKey)
+		fmt.Printf("%.1f\n", value32)
+	*/
+
+	// Creo una transazione lato wallet, passando i dati necessari
+	transaction := wallet_transaction.NewTransaction(
+		privateKey,
+		publicKey,
+		*t.SenderBloackchainAddress,
+		*t.RecipientBlockchainAddress,
+		value32)
+	// I limiti di validità fanno parte di quello che si firma
+	var validAfter, validUntil int64
+	if t.ValidAfter != nil {
+		validAfter = *t.ValidAfter
+	}
+	if t.ValidUntil != nil {
+		validUntil = *t.ValidUntil
+	}
+	transaction.SetValidity(validAfter, validUntil)
+	transaction.SetChainID(chainID)
+	// Il nonce fa sì che due pagamenti uguali siano due transazioni
+	nonce := blockchain_transaction.NewNonce()
+	transaction.SetNonce(nonce)
+	transaction.SetAsset(t.Asset)
+	// Creo la signature della transaction
+	signature := transaction.GenerateSignature()
+	// Versione string della signature
+	signatureStr := signature.String()
+
+	// Creo transaction request lato server
+	return &blockchain_transaction_request.TransactionRequest{
+		SenderBlockchainAddress:    t.SenderBloackchainAddress,
+		RecipientBlockchainAddress: t.RecipientBlockchainAddress,
+		SenderPublicKey:            &publicKeyStr,
+		Value:                      &value32,
+		ValidAfter:                 t.ValidAfter,
+		ValidUntil:                 t.ValidUntil,
+		ChainID:                    &chainID,
+		Nonce:                      &nonce,
+		Signature:                  &signatureStr,
+		Asset:                      t.Asset,
+	}, nil
 }
 
 // Resolver dell'endpoint "/wallet/amount"
+// Con il query param "asset" restituisce il saldo nel token con quel
+// simbolo
 func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 	// Controllo il metodo
 	switch req.Method {
@@ -185,72 +359,207 @@ func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 	case http.MethodGet:
 		// Recupero l'indirizzo dal query param
 		blockchainAddress := req.URL.Query().Get("blockchain_address")
-		// Preparo l'endpoint corretto
-		endpoint := fmt.Sprintf("%s/amount", ws.Gateway())
-
-		// Preparo il client
-		client := &http.Client{}
-		// Creo GET request all'endpoint
-		bcsReq, _ := http.NewRequest("GET", endpoint, nil)
-		// Aggiungo i query param
-		q := bcsReq.URL.Query()
-		q.Add("blockchain_address", blockchainAddress)
-		// Faccio l'encode dell'url
-		bcsReq.URL.RawQuery = q.Encode()
-
-		// Creo la response, inviando la request
-		bcsResp, err := client.Do(bcsReq)
-
-		// Se ci sono errori, restituisco fail
-		if err != nil {
-			log.Printf("ERROR: %v", err)
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
-
-		w.Header().Add("Content-Type", "application/json")
-		// Se lo status code della response è 200
-		if bcsResp.StatusCode == 200 {
-			// Faccio decode del body della response
-			decoder := json.NewDecoder(bcsResp.Body)
-			var bar amount_response.AmountResponse
-			// Decode in amount_response
-			err := decoder.Decode(&bar)
-
-			// Se c'è un errore nel decoding restituisco l'errore
+		if symbol := req.URL.Query().Get("asset"); symbol != "" {
+			amount, err := ws.node.AssetAmount(req.Context(), blockchainAddress, symbol)
 			if err != nil {
 				log.Printf("ERROR: %v", err)
-				io.WriteString(w, string(utils.JsonStatus("fail")))
+				api_error.Write(w, gatewayError(err))
 				return
 			}
-
-			// Creo il json da dare in risposta
 			m, _ := json.Marshal(struct {
-				Message string  `json:"message"`
-				Amount  float32 `json:"amount"`
+				Message string `json:"message"`
+				Asset   string `json:"asset"`
+				Amount  uint64 `json:"amount"`
 			}{
 				Message: "success",
-				Amount:  bar.Amount,
+				Asset:   symbol,
+				Amount:  amount,
 			})
-			// Risposta
+			w.Header().Add("Content-Type", "application/json")
 			io.WriteString(w, string(m[:]))
-			// Se lo stato non è 200 restituisco fail
-		} else {
-			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		// Chiedo il bilancio al blockchain server
+		amount, err := ws.node.Amount(req.Context(), blockchainAddress)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			api_error.Write(w, gatewayError(err))
+			return
 		}
+
+		// Creo il json da dare in risposta
+		m, _ := json.Marshal(struct {
+			Message string  `json:"message"`
+			Amount  float32 `json:"amount"`
+		}{
+			Message: "success",
+			Amount:  amount,
+		})
+		// Risposta
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
 	default:
 		// Per qualsiasi altro HTTP Method, dò errore
-		w.WriteHeader(http.StatusBadRequest)
 		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
 	}
 }
 
-// Funzione per avviare il server
+// Resolver dell'endpoint "/wallet/events"
+// Inoltra lo stream di eventi del blockchain server per l'indirizzo
+// del wallet, così la pagina aggiorna il bilancio quando cambia
+// L'header Last-Event-ID viene passato al gateway, che rimanda i
+// blocchi persi mentre la pagina era scollegata
+func (ws *WalletServer) WalletEvents(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		log.Println("ERROR: Invalid HTTP Method")
+		api_error.WriteMethodNotAllowed(w, req, http.MethodGet)
+		return
+	}
+	blockchainAddress := req.URL.Query().Get("blockchain_address")
+	if blockchainAddress == "" {
+		api_error.Write(w, api_error.MissingField("blockchain_address"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api_error.Write(w, api_error.Internal("streaming not supported"))
+		return
+	}
+
+	// Lo stream si chiude quando la pagina si scollega o il server
+	// si ferma
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-ws.streams.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	query := url.Values{"address": {blockchainAddress}, "types": {WALLET_EVENT_TYPES}}
+	header := http.Header{"Accept": {"text/event-stream"}}
+	if id := req.Header.Get("Last-Event-ID"); id != "" {
+		header.Set("Last-Event-ID", id)
+	}
+	bcsResp, err := ws.node.Open(ctx, "/events", query, header)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		api_error.Write(w, gatewayError(err))
+		return
+	}
+	defer bcsResp.Body.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	// Copio lo stream così com'è, mandando subito ogni pezzo
+	buf := make([]byte, 4096)
+	for {
+		n, err := bcsResp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Funzione che converte l'errore del client del gateway: gli errori
+// del blockchain server vengono inoltrati, gli altri vuol dire che
+// il gateway non risponde
+func gatewayError(err error) error {
+	var e *api_error.ApiError
+	if errors.As(err, &e) {
+		return e
+	}
+	return api_error.GatewayUnreachable(err)
+}
+
+// Funzione che converte un errore del keystore nell'errore da
+// restituire, addressField è il campo con l'indirizzo del wallet
+func keystoreError(err error, addressField string) *api_error.ApiError {
+	switch {
+	case errors.Is(err, keystore.ErrWrongPassword):
+		return api_error.WrongPassword("password")
+	case errors.Is(err, keystore.ErrNotFound):
+		return api_error.NotFound("wallet not found in the keystore").WithField(addressField)
+	case errors.Is(err, keystore.ErrEmptyPassword):
+		return api_error.MissingField("password")
+	}
+	return api_error.Internal(err.Error())
+}
+
+// Endpoint del server, con il path e il resolver
+type Route struct {
+	Path    string
+	Handler http.HandlerFunc
+}
+
+// Metodo che ritorna tutti gli endpoint del server
+func (ws *WalletServer) Routes() []Route {
+	return []Route{
+		{"/", ws.Index},
+		{"/wallet", ws.Wallet},
+		{"/wallet/password", ws.WalletPassword},
+		{"/wallet/hd", ws.HDWallet},
+		{"/wallet/hd/address", ws.HDWalletAddress},
+		{"/wallet/hd/scan", ws.HDWalletScan},
+		{"/wallet/multisig", ws.MultisigWallet},
+		{"/wallet/amount", ws.WalletAmount},
+		{"/wallet/events", ws.WalletEvents},
+		{"/transaction", ws.CreateTransaction},
+		{"/transaction/unsigned", ws.UnsignedTransaction},
+		{"/transaction/relay", ws.RelayTransaction},
+		{"/transaction/partial", ws.PartialTransaction},
+		{"/transaction/partial/sign", ws.SignPartialTransaction},
+		{"/transaction/partial/combine", ws.CombinePartialTransactions},
+		{"/transaction/partial/finalize", ws.FinalizePartialTransaction},
+		{"/htlc", ws.LockHtlc},
+		{"/htlc/status", ws.HtlcStatus},
+		{"/htlc/claim", ws.ClaimHtlc},
+		{"/htlc/refund", ws.RefundHtlc},
+		{"/sign", ws.SignPage},
+		{"/rpc", ws.Rpc},
+		{"/openapi.json", ws.GetOpenAPI},
+	}
+}
+
+// Funzione per avviare il server, resta in esecuzione fino a SIGINT
+// o SIGTERM e poi aspetta le richieste in corso
 func (ws *WalletServer) Run() {
 	// Qui si creano gli endpoint e si associano i resolver
-	http.HandleFunc("/", ws.Index)
-	http.HandleFunc("/wallet", ws.Wallet)
-	http.HandleFunc("/wallet/amount", ws.WalletAmount)
-	http.HandleFunc("/transaction", ws.CreateTransaction)
-	log.Fatal(http.ListenAndServe("localhost:"+strconv.Itoa((int(ws.port))), nil))
+	router := http.NewServeMux()
+	for _, r := range ws.Routes() {
+		router.HandleFunc(r.Path, r.Handler)
+	}
+	server := &http.Server{Addr: "localhost:" + strconv.Itoa((int(ws.port))), Handler: router}
+	server.RegisterOnShutdown(ws.closeStreams)
+	server.RegisterOnShutdown(ws.rpc.CloseAll)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		stop()
+		log.Println("Shutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT_SEC*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("ERROR: shutdown: %v", err)
+		}
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
 }
@@ -0,0 +1,528 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+	"github.com/iltommi1995/blockchain-go/pkg/events"
+	"github.com/iltommi1995/blockchain-go/pkg/webhook/hook"
+	"github.com/iltommi1995/blockchain-go/pkg/webhook/webhook_store"
+)
+
+const (
+	// Tempo massimo di risposta di un webhook
+	DELIVERY_TIMEOUT_SEC = 10
+	// Attesa prima del secondo tentativo, raddoppia a ogni
+	// fallimento fino a RETRY_MAX_SEC
+	RETRY_BASE_SEC = 5
+	RETRY_MAX_SEC  = 3600
+	// Tentativi dopo i quali la consegna viene scartata
+	MAX_ATTEMPTS = 12
+	// Ogni quanto si controlla se ci sono consegne da ritentare
+	POLL_INTERVAL_SEC = 1
+	// Eventi che il dispatcher può avere in coda dal bus
+	EVENTS_BUFFER = 4096
+)
+
+var ErrNotFound = errors.New("webhook not found")
+
+// Catena da cui arrivano gli eventi, serve anche a contare le
+// conferme dei blocchi
+type Chain interface {
+	Events() *events.Bus
+	BlockByHeight(height int) *block.Block
+}
+
+// Dispatcher dei webhook: trasforma gli eventi della catena in
+// consegne e le invia, ritentando quelle fallite
+// I webhook e la coda delle consegne vengono salvati a ogni modifica
+type Dispatcher struct {
+	chain  Chain
+	store  *webhook_store.WebhookStore
+	clock  clock.Clock
+	client *http.Client
+
+	hooks map[string]*hook.Hook
+	queue []*hook.Delivery
+	// Blocchi di cui sono già state consegnate le transazioni, per
+	// altezza e conferme, così un riordino non le rimanda se il
+	// blocco non è cambiato
+	confirmed map[confirmedKey]string
+	mux       sync.Mutex
+	// Serializza i salvataggi su disco
+	saveMux sync.Mutex
+
+	// Sveglia il ciclo delle consegne quando ne arriva una nuova
+	wake chan struct{}
+	done sync.WaitGroup
+}
+
+type confirmedKey struct {
+	height        int
+	confirmations int
+}
+
+// Funzione per creare un dispatcher, se path è vuoto webhook e
+// consegne restano solo in memoria
+func NewDispatcher(chain Chain, path string, c clock.Clock) *Dispatcher {
+	return &Dispatcher{
+		chain:     chain,
+		store:     webhook_store.NewWebhookStore(path),
+		clock:     c,
+		client:    &http.Client{Timeout: DELIVERY_TIMEOUT_SEC * time.Second},
+		hooks:     make(map[string]*hook.Hook),
+		confirmed: make(map[confirmedKey]string),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Getter del percorso del file
+func (d *Dispatcher) Path() string {
+	return d.store.Path()
+}
+
+// Metodo per caricare webhook e consegne salvati
+func (d *Dispatcher) Load() error {
+	state, err := d.store.Load()
+	if err != nil || state == nil {
+		return err
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	for _, h := range state.Hooks {
+		d.hooks[h.ID] = h
+	}
+	d.queue = state.Deliveries
+	log.Printf("Loaded %d webhooks and %d pending deliveries from %s", len(state.Hooks), len(state.Deliveries), d.store.Path())
+	return nil
+}
+
+// Metodo per salvare webhook e consegne
+func (d *Dispatcher) Save() error {
+	d.saveMux.Lock()
+	defer d.saveMux.Unlock()
+	d.mux.Lock()
+	state := &webhook_store.State{Hooks: d.sortedHooks(), Deliveries: append([]*hook.Delivery{}, d.queue...)}
+	d.mux.Unlock()
+	return d.store.Save(state)
+}
+
+// Metodo che salva e scrive nel log se non ci riesce, per le
+// modifiche che non possono restituire l'errore a nessuno
+func (d *Dispatcher) persist() {
+	if err := d.Save(); err != nil {
+		log.Printf("ERROR: saving webhooks: %v", err)
+	}
+}
+
+// Metodo per avviare il dispatcher, si ferma quando ctx viene
+// cancellato, Wait aspetta che abbia finito
+func (d *Dispatcher) Start(ctx context.Context) {
+	sub := d.chain.Events().Subscribe(events.Filter{}, EVENTS_BUFFER)
+	d.done.Add(2)
+	go d.eventsLoop(ctx, sub)
+	go d.deliveryLoop(ctx)
+}
+
+// Metodo che aspetta che il dispatcher si sia fermato
+func (d *Dispatcher) Wait() {
+	d.done.Wait()
+}
+
+// Metodo per registrare un webhook, la richiesta deve essere già
+// stata validata
+// Ritorna il webhook con il segreto, che non viene più mostrato
+func (d *Dispatcher) Add(hr *hook.HookRequest) (*hook.Hook, error) {
+	h := &hook.Hook{
+		ID:            newID(),
+		URL:           *hr.URL,
+		Addresses:     hr.Addresses,
+		Types:         hr.Types,
+		Confirmations: 1,
+		Created:       d.clock.Now().UnixNano(),
+	}
+	if hr.Secret != nil {
+		h.Secret = *hr.Secret
+	} else {
+		h.Secret = newID() + newID()
+	}
+	if len(h.Types) == 0 {
+		h.Types = append([]string{}, hook.DEFAULT_TYPES...)
+	}
+	if hr.Confirmations != nil {
+		h.Confirmations = *hr.Confirmations
+	}
+	d.mux.Lock()
+	d.hooks[h.ID] = h
+	d.mux.Unlock()
+	if err := d.Save(); err != nil {
+		return nil, err
+	}
+	log.Printf("Webhook %s registered for %s", h.ID, h.URL)
+	c := *h
+	return &c, nil
+}
+
+// Metodo che ritorna i webhook registrati, senza segreti
+func (d *Dispatcher) Hooks() []*hook.Hook {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	hooks := d.sortedHooks()
+	for i, h := range hooks {
+		hooks[i] = h.Public()
+	}
+	return hooks
+}
+
+// Metodo che ritorna un webhook senza segreto, nil se non esiste
+func (d *Dispatcher) Hook(id string) *hook.Hook {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if h, ok := d.hooks[id]; ok {
+		return h.Public()
+	}
+	return nil
+}
+
+// Metodo per togliere un webhook insieme alle sue consegne in coda
+func (d *Dispatcher) Remove(id string) error {
+	d.mux.Lock()
+	if _, ok := d.hooks[id]; !ok {
+		d.mux.Unlock()
+		return ErrNotFound
+	}
+	delete(d.hooks, id)
+	queue := make([]*hook.Delivery, 0, len(d.queue))
+	for _, dl := range d.queue {
+		if dl.HookID != id {
+			queue = append(queue, dl)
+		}
+	}
+	d.queue = queue
+	d.mux.Unlock()
+	log.Printf("Webhook %s removed", id)
+	return d.Save()
+}
+
+// Metodo che ritorna le consegne in coda, di tutti i webhook se
+// hookID è vuoto
+func (d *Dispatcher) Deliveries(hookID string) []*hook.Delivery {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	deliveries := make([]*hook.Delivery, 0, len(d.queue))
+	for _, dl := range d.queue {
+		if hookID == "" || dl.HookID == hookID {
+			c := *dl
+			deliveries = append(deliveries, &c)
+		}
+	}
+	return deliveries
+}
+
+// Metodo che ritorna i webhook in ordine di creazione, va chiamato
+// con il lock
+func (d *Dispatcher) sortedHooks() []*hook.Hook {
+	hooks := make([]*hook.Hook, 0, len(d.hooks))
+	for _, h := range d.hooks {
+		hooks = append(hooks, h)
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		if hooks[i].Created != hooks[j].Created {
+			return hooks[i].Created < hooks[j].Created
+		}
+		return hooks[i].ID < hooks[j].ID
+	})
+	return hooks
+}
+
+// Ciclo che trasforma gli eventi in consegne
+// Se il dispatcher resta indietro il bus lo scollega: si iscrive di
+// nuovo, gli eventi persi nel frattempo non vengono consegnati
+func (d *Dispatcher) eventsLoop(ctx context.Context, sub *events.Subscription) {
+	defer d.done.Done()
+	for {
+		select {
+		case e, ok := <-sub.C():
+			if !ok {
+				if !sub.Lagged() {
+					return
+				}
+				log.Println("ERROR: webhook dispatcher lagged behind, some events were not delivered")
+				sub = d.chain.Events().Subscribe(events.Filter{}, EVENTS_BUFFER)
+				continue
+			}
+			d.handle(e)
+		case <-ctx.Done():
+			sub.Unsubscribe()
+			return
+		}
+	}
+}
+
+// Metodo che mette in coda le consegne di un evento
+func (d *Dispatcher) handle(e *events.Event) {
+	d.mux.Lock()
+	hooks := d.sortedHooks()
+	d.mux.Unlock()
+
+	added := 0
+	switch e.Type {
+	case events.TX_CONFIRMED:
+		// Le conferme vengono contate a ogni new_tip
+	case events.NEW_TIP:
+		// Un blocco che nel frattempo è stato sostituito non conta
+		if b := d.chain.BlockByHeight(e.Height); b == nil || blockchain.BlockHash(b) != e.Hash {
+			return
+		}
+		for _, h := range hooks {
+			if h.Filter().Match(e) {
+				d.enqueue(h, e, nil)
+				added++
+			}
+		}
+		added += d.handleConfirmations(hooks, e)
+	case events.TX_ACCEPTED:
+		zero := 0
+		for _, h := range hooks {
+			if h.Filter().Match(e) {
+				d.enqueue(h, e, &zero)
+				added++
+			}
+		}
+	default:
+		for _, h := range hooks {
+			if h.Filter().Match(e) {
+				d.enqueue(h, e, nil)
+				added++
+			}
+		}
+	}
+	if added > 0 {
+		d.persist()
+		d.notify()
+	}
+}
+
+// Metodo che, con un nuovo blocco in cima alla catena, mette in
+// coda le transazioni dei blocchi che hanno appena raggiunto le
+// conferme richieste dai webhook
+func (d *Dispatcher) handleConfirmations(hooks []*hook.Hook, tip *events.Event) int {
+	added := 0
+	for _, h := range hooks {
+		height := tip.Height - h.Confirmations + 1
+		if height < 0 {
+			continue
+		}
+		b := d.chain.BlockByHeight(height)
+		if b == nil {
+			continue
+		}
+		hash := blockchain.BlockHash(b)
+		key := confirmedKey{height, h.Confirmations}
+		d.mux.Lock()
+		seen := d.confirmed[key] == hash
+		d.mux.Unlock()
+		if seen {
+			continue
+		}
+		filter := h.Filter()
+		confirmations := h.Confirmations
+		for _, e := range blockchain.BlockEvents(height, b, tip.Time) {
+			if e.Type == events.TX_CONFIRMED && filter.Match(e) {
+				d.enqueue(h, e, &confirmations)
+				added++
+			}
+		}
+	}
+
+	// Segno i blocchi dopo aver visto tutti i webhook, che possono
+	// chiedere le stesse conferme
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	for _, h := range hooks {
+		height := tip.Height - h.Confirmations + 1
+		if b := d.chain.BlockByHeight(height); height >= 0 && b != nil {
+			d.confirmed[confirmedKey{height, h.Confirmations}] = blockchain.BlockHash(b)
+		}
+	}
+	for key := range d.confirmed {
+		if key.height < tip.Height-hook.MAX_CONFIRMATIONS {
+			delete(d.confirmed, key)
+		}
+	}
+	return added
+}
+
+// Metodo che mette in coda la consegna di un evento a un webhook
+func (d *Dispatcher) enqueue(h *hook.Hook, e *events.Event, confirmations *int) {
+	now := d.clock.Now()
+	dl := &hook.Delivery{
+		ID:          newID(),
+		HookID:      h.ID,
+		Type:        e.Type,
+		NextAttempt: now.UnixNano(),
+		Created:     now.UnixNano(),
+	}
+	payload, err := json.Marshal(&hook.Payload{
+		ID:            dl.ID,
+		HookID:        h.ID,
+		Type:          e.Type,
+		Height:        e.Height,
+		Hash:          e.Hash,
+		Confirmations: confirmations,
+		Time:          e.Time,
+		Data:          e.Data,
+	})
+	if err != nil {
+		log.Printf("ERROR: webhook payload: %v", err)
+		return
+	}
+	dl.Payload = payload
+	d.mux.Lock()
+	d.queue = append(d.queue, dl)
+	d.mux.Unlock()
+}
+
+// Metodo che sveglia il ciclo delle consegne
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Ciclo che invia le consegne quando è il loro momento, una alla
+// volta e nell'ordine in cui sono state messe in coda
+func (d *Dispatcher) deliveryLoop(ctx context.Context) {
+	defer d.done.Done()
+	ticker := d.clock.NewTicker(POLL_INTERVAL_SEC * time.Second)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			dl, h := d.nextDue()
+			if dl == nil {
+				break
+			}
+			d.attempt(ctx, dl, h)
+		}
+		select {
+		case <-ticker.C():
+		case <-d.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Metodo che ritorna la prima consegna da inviare e il suo webhook
+// Le consegne di webhook che non esistono più vengono scartate
+func (d *Dispatcher) nextDue() (*hook.Delivery, *hook.Hook) {
+	now := d.clock.Now().UnixNano()
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	for _, dl := range d.queue {
+		if dl.NextAttempt > now {
+			continue
+		}
+		if h, ok := d.hooks[dl.HookID]; ok {
+			return dl, h
+		}
+	}
+	return nil, nil
+}
+
+// Metodo che invia una consegna, se fallisce la rimette in coda
+// per più tardi o la scarta se ha finito i tentativi
+func (d *Dispatcher) attempt(ctx context.Context, dl *hook.Delivery, h *hook.Hook) {
+	err := d.send(ctx, dl, h)
+	if ctx.Err() != nil {
+		// Il server si sta fermando, la consegna resta in coda
+		return
+	}
+
+	d.mux.Lock()
+	if err == nil {
+		d.removeDelivery(dl)
+	} else {
+		dl.Attempts += 1
+		dl.LastError = err.Error()
+		if dl.Attempts >= MAX_ATTEMPTS {
+			d.removeDelivery(dl)
+			log.Printf("ERROR: webhook %s delivery %s dropped after %d attempts: %v", h.ID, dl.ID, dl.Attempts, err)
+		} else {
+			dl.NextAttempt = d.clock.Now().Add(Backoff(dl.Attempts)).UnixNano()
+			log.Printf("ERROR: webhook %s delivery %s failed (attempt %d): %v", h.ID, dl.ID, dl.Attempts, err)
+		}
+	}
+	d.mux.Unlock()
+	d.persist()
+}
+
+// Metodo che invia la richiesta firmata al webhook
+func (d *Dispatcher) send(ctx context.Context, dl *hook.Delivery, h *hook.Hook) error {
+	timestamp := d.clock.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(hook.DELIVERY_HEADER, dl.ID)
+	req.Header.Set(hook.EVENT_HEADER, dl.Type)
+	req.Header.Set(hook.TIMESTAMP_HEADER, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(hook.SIGNATURE_HEADER, hook.Sign(h.Secret, timestamp, dl.Payload))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %s", resp.Status)
+	}
+	return nil
+}
+
+// Metodo che toglie una consegna dalla coda, va chiamato con il lock
+func (d *Dispatcher) removeDelivery(dl *hook.Delivery) {
+	for i, other := range d.queue {
+		if other == dl {
+			d.queue = append(d.queue[:i], d.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// Funzione che ritorna l'attesa prima del prossimo tentativo dopo
+// attempts fallimenti
+func Backoff(attempts int) time.Duration {
+	delay := time.Duration(RETRY_BASE_SEC) * time.Second
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= RETRY_MAX_SEC*time.Second {
+			return RETRY_MAX_SEC * time.Second
+		}
+	}
+	return delay
+}
+
+// Funzione che genera un id casuale
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,354 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/block"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/blockchain"
+	"github.com/iltommi1995/blockchain-go/pkg/blockchain/transaction"
+	"github.com/iltommi1995/blockchain-go/pkg/clock"
+	"github.com/iltommi1995/blockchain-go/pkg/events"
+	"github.com/iltommi1995/blockchain-go/pkg/webhook/hook"
+)
+
+const (
+	ALICE  = "alice-address"
+	BOB    = "bob-address"
+	SECRET = "dispatcher-test-secret"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// Funzione che fa fallire il test se un controllo fallisce
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Catena finta: i blocchi si cambiano a mano, anche quelli già
+// confermati, per simulare un riordino
+type fakeChain struct {
+	bus    *events.Bus
+	blocks []*block.Block
+}
+
+func newFakeChain() *fakeChain {
+	return &fakeChain{bus: events.NewBus(), blocks: []*block.Block{block.FirstBlock(0, [32]byte{}, nil)}}
+}
+
+func (c *fakeChain) Events() *events.Bus {
+	return c.bus
+}
+
+func (c *fakeChain) BlockByHeight(height int) *block.Block {
+	if height < 0 || height >= len(c.blocks) {
+		return nil
+	}
+	return c.blocks[height]
+}
+
+// Metodo che mette in cima un blocco con una transazione da sender a
+// recipient e ritorna l'evento new_tip
+func (c *fakeChain) mine(sender string, recipient string) *events.Event {
+	previous := c.blocks[len(c.blocks)-1].Hash()
+	b := block.NewBlock(int64(len(c.blocks)), 0, previous, []*transaction.Transaction{transaction.NewTransaction(sender, recipient, 1)})
+	c.blocks = append(c.blocks, b)
+	return c.tip()
+}
+
+// Metodo che ritorna l'evento new_tip dell'ultimo blocco
+func (c *fakeChain) tip() *events.Event {
+	height := len(c.blocks) - 1
+	return &events.Event{Type: events.NEW_TIP, Height: height, Hash: blockchain.BlockHash(c.blocks[height]), Time: int64(height)}
+}
+
+// Webhook finto: risponde con i codici di status, uno per richiesta,
+// e poi con 200, e tiene le richieste ricevute
+type receiver struct {
+	server   *httptest.Server
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+	mux      sync.Mutex
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *receiver) count() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return len(r.requests)
+}
+
+// Funzione che registra un webhook con le conferme richieste
+func addHook(t *testing.T, d *Dispatcher, url string, confirmations int, addresses ...string) *hook.Hook {
+	t.Helper()
+	secret := SECRET
+	h, err := d.Add(&hook.HookRequest{URL: &url, Secret: &secret, Addresses: addresses, Confirmations: &confirmations})
+	check(t, err)
+	return h
+}
+
+// Funzione che prova le consegne già dovute, come il ciclo delle
+// consegne, e ritorna quante ne ha provate
+func deliverDue(d *Dispatcher) int {
+	n := 0
+	for {
+		dl, h := d.nextDue()
+		if dl == nil {
+			return n
+		}
+		d.attempt(context.Background(), dl, h)
+		n++
+	}
+}
+
+// Funzione che ritorna il body di una consegna
+func payloadOf(t *testing.T, dl *hook.Delivery) *hook.Payload {
+	t.Helper()
+	p := &hook.Payload{}
+	check(t, json.Unmarshal(dl.Payload, p))
+	return p
+}
+
+// L'attesa tra i tentativi raddoppia fino a RETRY_MAX_SEC
+func TestBackoff(t *testing.T) {
+	expected := []time.Duration{5, 10, 20, 40, 80, 160, 320, 640, 1280, 2560, 3600, 3600}
+	for i, e := range expected {
+		if b := Backoff(i + 1); b != e*time.Second {
+			t.Errorf("attempt %d: %v, expected %v", i+1, b, e*time.Second)
+		}
+	}
+}
+
+// Una consegna fallita viene ritentata solo quando è passato il
+// backoff, con lo stesso id e lo stesso body firmati di nuovo, e
+// viene scartata dopo MAX_ATTEMPTS tentativi
+func TestRetry(t *testing.T) {
+	c := clock.NewManual(time.Unix(1700000000, 0))
+	r := newReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable)
+	d := NewDispatcher(newFakeChain(), "", c)
+	h := addHook(t, d, r.server.URL, 1)
+	d.handle(&events.Event{Type: events.TX_ACCEPTED, Time: 1, Addresses: []string{ALICE, BOB}})
+
+	if n := deliverDue(d); n != 1 {
+		t.Fatalf("%d attempts, expected 1", n)
+	}
+	queue := d.Deliveries(h.ID)
+	if len(queue) != 1 || queue[0].Attempts != 1 || queue[0].LastError == "" {
+		t.Fatalf("queue after a failure %+v", queue)
+	}
+	c.Advance(Backoff(1) - time.Second)
+	if n := deliverDue(d); n != 0 {
+		t.Fatal("retried before the backoff")
+	}
+	c.Advance(time.Second)
+	if n := deliverDue(d); n != 1 {
+		t.Fatal("not retried after the backoff")
+	}
+	c.Advance(Backoff(2))
+	if n := deliverDue(d); n != 1 || len(d.Deliveries("")) != 0 {
+		t.Fatalf("delivered, queue %+v", d.Deliveries(""))
+	}
+
+	if r.count() != 3 {
+		t.Fatalf("%d requests, expected 3", r.count())
+	}
+	for i, req := range r.requests {
+		if req.Header.Get(hook.DELIVERY_HEADER) != queue[0].ID || req.Header.Get(hook.EVENT_HEADER) != events.TX_ACCEPTED {
+			t.Errorf("request %d headers %v", i, req.Header)
+		}
+		if !hook.Verify(SECRET, req.Header.Get(hook.TIMESTAMP_HEADER), r.bodies[i], req.Header.Get(hook.SIGNATURE_HEADER)) {
+			t.Errorf("request %d is not signed", i)
+		}
+		if string(r.bodies[i]) != string(queue[0].Payload) {
+			t.Errorf("request %d has another body", i)
+		}
+	}
+	if p := payloadOf(t, queue[0]); p.Confirmations == nil || *p.Confirmations != 0 {
+		t.Fatal("accepted transaction without 0 confirmations")
+	}
+
+	// Un webhook che fallisce sempre perde la consegna dopo
+	// MAX_ATTEMPTS tentativi
+	failing := make([]int, MAX_ATTEMPTS)
+	for i := range failing {
+		failing[i] = http.StatusInternalServerError
+	}
+	r = newReceiver(t, failing...)
+	addHook(t, d, r.server.URL, 1)
+	d.handle(&events.Event{Type: events.TX_ACCEPTED, Time: 2})
+	deliverDue(d)
+	for attempt := 1; attempt < MAX_ATTEMPTS; attempt++ {
+		if len(d.Deliveries("")) != 1 {
+			t.Fatalf("dropped after %d attempts", attempt)
+		}
+		c.Advance(Backoff(attempt))
+		deliverDue(d)
+	}
+	if len(d.Deliveries("")) != 0 || r.count() != MAX_ATTEMPTS {
+		t.Fatalf("%d attempts, queue %+v", r.count(), d.Deliveries(""))
+	}
+}
+
+// Le transazioni di un blocco vengono consegnate una volta sola,
+// quando il blocco raggiunge le conferme del webhook, e solo quelle
+// degli indirizzi del webhook
+func TestConfirmations(t *testing.T) {
+	chain := newFakeChain()
+	d := NewDispatcher(chain, "", clock.NewManual(time.Unix(1700000000, 0)))
+	three := addHook(t, d, "http://127.0.0.1:1/three", 3, ALICE)
+	one := addHook(t, d, "http://127.0.0.1:1/one", 1)
+
+	d.handle(chain.mine(ALICE, BOB))
+	if len(d.Deliveries(three.ID)) != 0 || len(d.Deliveries(one.ID)) != 1 {
+		t.Fatalf("deliveries after 1 confirmation: %d and %d", len(d.Deliveries(three.ID)), len(d.Deliveries(one.ID)))
+	}
+	d.handle(chain.mine(BOB, "carol-address"))
+	d.handle(chain.tip())
+	if len(d.Deliveries(three.ID)) != 0 || len(d.Deliveries(one.ID)) != 2 {
+		t.Fatal("a block was confirmed twice or too early")
+	}
+
+	// Gli eventi tx_confirmed del bus non danno consegne, le conferme
+	// si contano a ogni new_tip
+	d.handle(&events.Event{Type: events.TX_CONFIRMED, Height: 1, Addresses: []string{ALICE}})
+	d.handle(chain.mine(BOB, "carol-address"))
+	deliveries := d.Deliveries(three.ID)
+	if len(deliveries) != 1 {
+		t.Fatalf("%d deliveries after 3 confirmations, expected 1", len(deliveries))
+	}
+	p := payloadOf(t, deliveries[0])
+	if p.Type != events.TX_CONFIRMED || p.Height != 1 || p.Confirmations == nil || *p.Confirmations != 3 || p.Hash != blockchain.BlockHash(chain.blocks[1]) {
+		t.Fatalf("payload %+v", p)
+	}
+	d.handle(chain.mine(BOB, "carol-address"))
+	if len(d.Deliveries(three.ID)) != 1 {
+		t.Fatal("the transaction of bob was delivered to the webhook of alice")
+	}
+
+	// Un new_tip di un blocco che non è più nella catena non conta
+	stale := chain.tip()
+	stale.Hash = "stale"
+	before := len(d.Deliveries(""))
+	d.handle(stale)
+	if len(d.Deliveries("")) != before {
+		t.Fatal("delivered the transactions of a stale tip")
+	}
+}
+
+// Dopo un riordino le transazioni dei blocchi sostituiti vengono
+// consegnate di nuovo quando i nuovi blocchi raggiungono le conferme,
+// quelle dei blocchi rimasti uguali no
+func TestReorgRedelivery(t *testing.T) {
+	chain := newFakeChain()
+	d := NewDispatcher(chain, "", clock.NewManual(time.Unix(1700000000, 0)))
+	h := addHook(t, d, "http://127.0.0.1:1/hook", 2, ALICE)
+	d.handle(chain.mine(ALICE, BOB))
+	d.handle(chain.mine(BOB, ALICE))
+	d.handle(chain.mine(BOB, "carol-address"))
+	if len(d.Deliveries(h.ID)) != 2 {
+		t.Fatalf("%d deliveries before the reorg, expected 2", len(d.Deliveries(h.ID)))
+	}
+
+	// La catena cambia dal blocco 2: il blocco 1 resta uguale
+	chain.blocks = chain.blocks[:2]
+	chain.blocks = append(chain.blocks, block.NewBlock(100, 1, chain.blocks[1].Hash(), []*transaction.Transaction{transaction.NewTransaction(ALICE, "dave-address", 2)}))
+	d.handle(chain.tip())
+	d.handle(chain.mine(BOB, "carol-address"))
+	d.handle(chain.mine(BOB, "carol-address"))
+	deliveries := d.Deliveries(h.ID)
+	if len(deliveries) != 3 {
+		t.Fatalf("%d deliveries after the reorg, expected 3", len(deliveries))
+	}
+	p := payloadOf(t, deliveries[2])
+	if p.Height != 2 || p.Hash != blockchain.BlockHash(chain.blocks[2]) {
+		t.Fatalf("redelivered %+v", p)
+	}
+}
+
+// Webhook e consegne in coda si ritrovano dopo un riavvio, con i
+// tentativi fatti, in un file che legge solo il proprietario
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks", "webhooks.json")
+	c := clock.NewManual(time.Unix(1700000000, 0))
+	r := newReceiver(t, http.StatusInternalServerError, http.StatusInternalServerError)
+	d := NewDispatcher(newFakeChain(), path, c)
+	h := addHook(t, d, r.server.URL, 4, ALICE)
+	c.Advance(time.Second)
+	other := addHook(t, d, r.server.URL, 1)
+	d.handle(&events.Event{Type: events.TX_ACCEPTED, Time: 1, Addresses: []string{ALICE}})
+	deliverDue(d)
+	if len(d.Deliveries("")) != 2 {
+		t.Fatalf("queue %+v", d.Deliveries(""))
+	}
+
+	info, err := os.Stat(path)
+	check(t, err)
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("file mode %o", info.Mode().Perm())
+	}
+
+	loaded := NewDispatcher(newFakeChain(), path, c)
+	check(t, loaded.Load())
+	if hooks := loaded.Hooks(); len(hooks) != 2 || hooks[0].ID != h.ID || hooks[0].Confirmations != 4 || hooks[0].Secret != "" {
+		t.Fatalf("loaded hooks %+v", hooks)
+	}
+	if loaded.hooks[h.ID].Secret != SECRET {
+		t.Fatal("the secret was not saved")
+	}
+	queue := loaded.Deliveries(h.ID)
+	if len(queue) != 1 || queue[0].Attempts != 1 || queue[0].NextAttempt != c.Now().Add(Backoff(1)).UnixNano() {
+		t.Fatalf("loaded queue %+v", queue)
+	}
+
+	// Togliere un webhook toglie anche le sue consegne dal file
+	check(t, loaded.Remove(other.ID))
+	if err := loaded.Remove(other.ID); err != ErrNotFound {
+		t.Fatalf("removed twice: %v", err)
+	}
+	reloaded := NewDispatcher(newFakeChain(), path, c)
+	check(t, reloaded.Load())
+	if len(reloaded.Hooks()) != 1 || len(reloaded.Deliveries("")) != 1 {
+		t.Fatalf("reloaded %d hooks and %d deliveries", len(reloaded.Hooks()), len(reloaded.Deliveries("")))
+	}
+	c.Advance(Backoff(1))
+	if n := deliverDue(reloaded); n != 1 || len(reloaded.Deliveries("")) != 0 {
+		t.Fatal("the loaded delivery was not retried")
+	}
+}
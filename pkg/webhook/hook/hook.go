@@ -0,0 +1,153 @@
+package hook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/iltommi1995/blockchain-go/pkg/api_error"
+	"github.com/iltommi1995/blockchain-go/pkg/events"
+)
+
+// Header delle richieste inviate ai webhook
+const (
+	// Id della consegna, uguale in tutti i tentativi
+	DELIVERY_HEADER = "X-Webhook-Delivery"
+	// Tipo dell'evento
+	EVENT_HEADER = "X-Webhook-Event"
+	// Secondi unix in cui è stata firmata la richiesta
+	TIMESTAMP_HEADER = "X-Webhook-Timestamp"
+	// "sha256=" seguito dall'HMAC-SHA256 in esadecimale di
+	// "<timestamp>.<body>" con il segreto del webhook
+	SIGNATURE_HEADER = "X-Webhook-Signature"
+)
+
+const (
+	// Conferme massime che si possono chiedere prima della consegna
+	MAX_CONFIRMATIONS = 100
+	// Lunghezza minima del segreto scelto dal client
+	MIN_SECRET_LENGTH = 16
+)
+
+// Eventi inviati ai webhook che non ne indicano nessuno
+var DEFAULT_TYPES = []string{events.TX_ACCEPTED, events.TX_CONFIRMED, events.REORG}
+
+// Webhook registrato da un client: riceve in POST gli eventi dei
+// tipi richiesti, quelli delle transazioni solo se riguardano uno
+// degli indirizzi, se ce ne sono
+// Le transazioni confermate vengono inviate quando il blocco ha
+// raggiunto Confirmations conferme
+type Hook struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Secret        string   `json:"secret,omitempty"`
+	Addresses     []string `json:"addresses,omitempty"`
+	Types         []string `json:"types"`
+	Confirmations int      `json:"confirmations"`
+	Created       int64    `json:"created"`
+}
+
+// Metodo che ritorna il filtro degli eventi del webhook
+func (h *Hook) Filter() events.Filter {
+	return events.ParseFilter(strings.Join(h.Types, ","), h.Addresses)
+}
+
+// Metodo che ritorna una copia del webhook senza il segreto, da
+// mostrare nelle liste
+func (h *Hook) Public() *Hook {
+	c := *h
+	c.Secret = ""
+	return &c
+}
+
+// Richiesta di registrazione di un webhook, se il segreto manca
+// viene generato e restituito nella risposta
+type HookRequest struct {
+	URL           *string  `json:"url"`
+	Secret        *string  `json:"secret"`
+	Addresses     []string `json:"addresses"`
+	Types         []string `json:"types"`
+	Confirmations *int     `json:"confirmations"`
+}
+
+// Valida la richiesta, ritorna un *api_error.ApiError con il campo
+// che manca o non è valido
+func (hr *HookRequest) Validate() error {
+	if hr.URL == nil || *hr.URL == "" {
+		return api_error.MissingField("url")
+	}
+	u, err := url.Parse(*hr.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return api_error.InvalidField("url", "must be an absolute http or https url")
+	}
+	if hr.Secret != nil && len(*hr.Secret) < MIN_SECRET_LENGTH {
+		return api_error.InvalidField("secret", fmt.Sprintf("must be at least %d characters", MIN_SECRET_LENGTH))
+	}
+	for _, t := range hr.Types {
+		if !events.Known(t) {
+			return api_error.InvalidField("types", fmt.Sprintf("unknown event type %s", t))
+		}
+	}
+	for _, a := range hr.Addresses {
+		if strings.TrimSpace(a) == "" || strings.Contains(a, ",") {
+			return api_error.InvalidField("addresses", "must be a list of blockchain addresses")
+		}
+	}
+	if hr.Confirmations != nil && (*hr.Confirmations < 1 || *hr.Confirmations > MAX_CONFIRMATIONS) {
+		return api_error.InvalidField("confirmations", fmt.Sprintf("must be between 1 and %d", MAX_CONFIRMATIONS))
+	}
+	return nil
+}
+
+// Consegna di un evento a un webhook, resta in coda finché il
+// webhook non risponde con un 2xx o finiscono i tentativi
+type Delivery struct {
+	ID     string `json:"id"`
+	HookID string `json:"hook_id"`
+	Type   string `json:"type"`
+	// Body della richiesta, lo stesso per tutti i tentativi
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt int64           `json:"next_attempt"`
+	LastError   string          `json:"last_error,omitempty"`
+	Created     int64           `json:"created"`
+}
+
+// Body delle richieste inviate ai webhook
+// Confirmations c'è solo per le transazioni, 0 per quelle ancora
+// nel transaction pool
+type Payload struct {
+	ID            string      `json:"id"`
+	HookID        string      `json:"hook_id"`
+	Type          string      `json:"type"`
+	Height        int         `json:"height,omitempty"`
+	Hash          string      `json:"hash,omitempty"`
+	Confirmations *int        `json:"confirmations,omitempty"`
+	Time          int64       `json:"time"`
+	Data          interface{} `json:"data,omitempty"`
+}
+
+// Funzione che firma il body di una richiesta
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Funzione per chi riceve i webhook: controlla la firma degli header
+// SIGNATURE_HEADER e TIMESTAMP_HEADER, chi la usa dovrebbe anche
+// rifiutare i timestamp troppo vecchi
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
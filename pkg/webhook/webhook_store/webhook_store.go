@@ -0,0 +1,76 @@
+package webhook_store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/iltommi1995/blockchain-go/pkg/webhook/hook"
+)
+
+// Archivio dei webhook e delle consegne in coda, salvato su disco
+// in json così che dopo un riavvio le consegne riprendano
+type WebhookStore struct {
+	path string
+}
+
+// Contenuto del file dell'archivio
+type State struct {
+	Hooks      []*hook.Hook     `json:"hooks"`
+	Deliveries []*hook.Delivery `json:"deliveries"`
+}
+
+// Funzione per creare un nuovo archivio, se path è vuoto
+// non viene salvato niente
+func NewWebhookStore(path string) *WebhookStore {
+	return &WebhookStore{path: path}
+}
+
+// Getter del percorso del file
+func (ws *WebhookStore) Path() string {
+	return ws.path
+}
+
+// Metodo per caricare webhook e consegne dal file, ritorna nil se
+// il file non esiste o se path è vuoto
+func (ws *WebhookStore) Load() (*State, error) {
+	if ws.path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(ws.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Metodo per salvare webhook e consegne su disco, si scrive prima
+// su un file temporaneo per non lasciare il file a metà
+// Il file contiene i segreti dei webhook, quindi è leggibile solo
+// dal proprietario
+func (ws *WebhookStore) Save(state *State) error {
+	if ws.path == "" {
+		return nil
+	}
+	m, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(ws.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := ws.path + ".tmp"
+	if err := os.WriteFile(tmp, m, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ws.path)
+}
@@ -0,0 +1,371 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Implementazione minima di RFC 6455, quanto basta per scambiare
+// messaggi json con i client: niente estensioni né sottoprotocolli
+
+// Tipi di frame
+const (
+	OP_CONTINUATION = 0x0
+	OP_TEXT         = 0x1
+	OP_BINARY       = 0x2
+	OP_CLOSE        = 0x8
+	OP_PING         = 0x9
+	OP_PONG         = 0xA
+)
+
+const (
+	// Dimensione massima di un messaggio ricevuto
+	MAX_MESSAGE_SIZE = 1 << 20
+	// Codici di chiusura
+	CLOSE_NORMAL       = 1000
+	CLOSE_GOING_AWAY   = 1001
+	CLOSE_PROTOCOL     = 1002
+	CLOSE_TOO_BIG      = 1009
+	HANDSHAKE_GUID     = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	WRITE_TIMEOUT_SEC  = 10
+	DIAL_TIMEOUT_SEC   = 10
+	handshakeKeyLength = 16
+)
+
+var (
+	ErrBadHandshake    = errors.New("websocket: bad handshake")
+	ErrBadOrigin       = errors.New("websocket: origin not allowed")
+	ErrMessageTooBig   = errors.New("websocket: message too big")
+	ErrProtocol        = errors.New("websocket: protocol error")
+	ErrConnectionClose = errors.New("websocket: connection closed")
+)
+
+// Connessione websocket, i messaggi si possono scrivere da più
+// goroutine ma vanno letti da una sola
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// Il client maschera i frame che invia, il server no
+	client bool
+	mux    sync.Mutex
+	once   sync.Once
+}
+
+// Funzione che dice se la richiesta HTTP chiede di passare a websocket
+func IsUpgrade(req *http.Request) bool {
+	return headerContains(req.Header, "Connection", "upgrade") &&
+		headerContains(req.Header, "Upgrade", "websocket")
+}
+
+// Lato server dell'upgrade, con le origini ammesse
+// I browser aprono un websocket verso qualunque server da qualunque
+// pagina, senza il controllo CORS, ma mandano sempre l'header Origin:
+// una richiesta con Origin viene accettata solo dalla pagina del
+// server stesso o da una delle AllowedOrigins. Quelle senza Origin
+// non vengono da un browser e sono accettate
+type Upgrader struct {
+	// Origini ammesse oltre a quella del server, come
+	// "https://example.com", "*" le ammette tutte
+	AllowedOrigins []string
+}
+
+// Metodo che dice se l'origine della richiesta è ammessa
+func (u *Upgrader) CheckOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	o, err := url.Parse(origin)
+	if err != nil || o.Host == "" {
+		return false
+	}
+	if strings.EqualFold(o.Host, req.Host) {
+		return true
+	}
+	for _, a := range u.AllowedOrigins {
+		if a == "*" || strings.EqualFold(strings.TrimSuffix(a, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Funzione per accettare una richiesta di upgrade lato server, solo
+// dalle pagine del server stesso, vedi Upgrader
+func Upgrade(w http.ResponseWriter, req *http.Request) (*Conn, error) {
+	return (&Upgrader{}).Upgrade(w, req)
+}
+
+// Metodo per accettare una richiesta di upgrade lato server, se la
+// richiesta non è valida risponde con un errore HTTP, con 403 se
+// l'origine non è ammessa
+func (u *Upgrader) Upgrade(w http.ResponseWriter, req *http.Request) (*Conn, error) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if req.Method != http.MethodGet || !IsUpgrade(req) || key == "" ||
+		req.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "websocket handshake required", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+	if !u.CheckOrigin(req) {
+		http.Error(w, "websocket origin not allowed", http.StatusForbidden)
+		return nil, ErrBadOrigin
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, ErrBadHandshake
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, reader: rw.Reader}, nil
+}
+
+// Funzione per aprire una connessione websocket verso rawurl
+// (ws://host:porta/path), header viene aggiunto alla richiesta
+func Dial(rawurl string, header http.Header) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, DIAL_TIMEOUT_SEC*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, handshakeKeyLength)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	conn.SetDeadline(time.Now().Add(DIAL_TIMEOUT_SEC * time.Second))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("%w: status %s", ErrBadHandshake, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return &Conn{conn: conn, reader: reader, client: true}, nil
+}
+
+// Funzione che calcola Sec-WebSocket-Accept dalla chiave del client
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + HANDSHAKE_GUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// Funzione che dice se un header contiene il valore, senza
+// distinguere maiuscole e minuscole
+func headerContains(h http.Header, name string, value string) bool {
+	for _, v := range h.Values(name) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Metodo per leggere il prossimo messaggio, ricompone i frame
+// frammentati e risponde da solo a ping e close
+// Ritorna ErrConnectionClose quando l'altro capo chiude
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	opcode := -1
+	message := make([]byte, 0)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case OP_PING:
+			c.WriteMessage(OP_PONG, payload)
+			continue
+		case OP_PONG:
+			continue
+		case OP_CLOSE:
+			c.writeClose(CLOSE_NORMAL)
+			c.conn.Close()
+			return 0, nil, ErrConnectionClose
+		case OP_CONTINUATION:
+			if opcode < 0 {
+				return 0, nil, c.fail(CLOSE_PROTOCOL, ErrProtocol)
+			}
+		case OP_TEXT, OP_BINARY:
+			if opcode >= 0 {
+				return 0, nil, c.fail(CLOSE_PROTOCOL, ErrProtocol)
+			}
+			opcode = op
+		default:
+			return 0, nil, c.fail(CLOSE_PROTOCOL, ErrProtocol)
+		}
+		if len(message)+len(payload) > MAX_MESSAGE_SIZE {
+			return 0, nil, c.fail(CLOSE_TOO_BIG, ErrMessageTooBig)
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// Metodo che legge un frame e toglie la maschera al payload
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	op := int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > MAX_MESSAGE_SIZE {
+		return false, 0, nil, c.fail(CLOSE_TOO_BIG, ErrMessageTooBig)
+	}
+	// I frame del client devono essere mascherati, quelli del server no
+	if masked == c.client {
+		return false, 0, nil, c.fail(CLOSE_PROTOCOL, ErrProtocol)
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// Metodo per inviare un messaggio in un solo frame
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	frame := make([]byte, 0, len(data)+14)
+	frame = append(frame, 0x80|byte(opcode))
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(data) < 126:
+		frame = append(frame, maskBit|byte(len(data)))
+	case len(data) <= 0xFFFF:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(data)))
+	default:
+		frame = append(frame, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(data)))
+	}
+	if c.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, data...)
+		for i := range data {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, data...)
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT_SEC * time.Second))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Metodo per inviare un messaggio di testo
+func (c *Conn) WriteText(data []byte) error {
+	return c.WriteMessage(OP_TEXT, data)
+}
+
+// Metodo che invia il frame di chiusura con il codice
+func (c *Conn) writeClose(code int) error {
+	var payload [2]byte
+	binary.BigEndian.PutUint16(payload[:], uint16(code))
+	return c.WriteMessage(OP_CLOSE, payload[:])
+}
+
+// Metodo che chiude la connessione dopo un errore di protocollo
+func (c *Conn) fail(code int, err error) error {
+	c.writeClose(code)
+	c.conn.Close()
+	return err
+}
+
+// Metodo per chiudere la connessione avvisando l'altro capo
+func (c *Conn) Close() error {
+	var err error
+	c.once.Do(func() {
+		c.writeClose(CLOSE_GOING_AWAY)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// Getter dell'indirizzo dell'altro capo
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}